@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// aliasImpl implements the alias command functionality. The card is given the alias,
+// which can then be used wherever a card ID is. An alias of another card is only moved
+// to this card if force is set and the user can change both cards.
+func aliasImpl(cardID int, alias string, force bool) error {
+	alias, err := common.NormalizeCardAlias(alias)
+	if err != nil {
+		return err
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+	if err := checkCardWrite(queries, owner, int32(cardID)); err != nil {
+		return err
+	}
+
+	// Make sure the card exists
+	title, err := queries.GetCardTitle(context.Background(), int32(cardID))
+	if err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	current, err := queries.GetCardByAlias(context.Background(), alias)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("error looking up alias %s: %w", alias, err)
+	}
+	if err == nil && current == int32(cardID) {
+		fmt.Printf("Card %d is already called %s\n", cardID, alias)
+		return nil
+	}
+	if err == nil && !force {
+		return fmt.Errorf("alias %s is already given to card %d, move it with --force", alias, current)
+	}
+	if err == nil {
+		if err := checkCardWrite(queries, owner, current); err != nil {
+			return fmt.Errorf("can't move alias %s from card %d: %w", alias, current, err)
+		}
+	}
+
+	err = queries.SetCardAlias(context.Background(), database.SetCardAliasParams{
+		Alias:  alias,
+		CardID: int32(cardID),
+	})
+	if err != nil {
+		return fmt.Errorf("error storing alias: %w", err)
+	}
+
+	fmt.Printf("Card %d \"%s\" can now be called %s\n", cardID, title, alias)
+	return nil
+}
+
+// aliasDeleteImpl removes an alias from its card, if the user can change the card
+func aliasDeleteImpl(alias string) error {
+	alias, err := common.NormalizeCardAlias(alias)
+	if err != nil {
+		return err
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	cardID, err := queries.GetCardByAlias(context.Background(), alias)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("alias %s not found: %w", alias, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error looking up alias %s: %w", alias, err)
+	}
+	if err := requireCardWrite(queries, int(cardID)); err != nil {
+		return err
+	}
+
+	deleted, err := queries.DeleteCardAlias(context.Background(), alias)
+	if err != nil {
+		return fmt.Errorf("error deleting alias: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("alias %s not found: %w", alias, pgx.ErrNoRows)
+	}
+
+	fmt.Printf("Deleted alias %s\n", alias)
+	return nil
+}
+
+// aliasListImpl lists the aliases of the cards accessible to the current user
+func aliasListImpl() error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	aliases, err := queries.ListCardAliases(context.Background(), owner)
+	if err != nil {
+		return fmt.Errorf("error listing aliases: %w", err)
+	}
+
+	if len(aliases) == 0 {
+		fmt.Println("No aliases found. Give a card one with: ume alias <card_id> <alias>")
+		return nil
+	}
+
+	fmt.Println("Card\tAlias\t\t\tTitle")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, alias := range aliases {
+		fmt.Printf("%4d\t%-20s\t%s\n", alias.CardID, alias.Alias, alias.Title)
+	}
+	return nil
+}
+
+// resolveCardAlias looks up the ID of a card given by its alias on the command line
+func resolveCardAlias(alias string) (int32, error) {
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return 0, fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	return queries.GetCardByAlias(context.Background(), alias)
+}
+
+// cardAliasResolver looks up card aliases with an open connection, for the servers
+// that resolve the aliases in the paths of every request
+func cardAliasResolver(queries *database.Queries) func(string) (int32, error) {
+	return func(alias string) (int32, error) {
+		return queries.GetCardByAlias(context.Background(), alias)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// archiveImpl implements the archive command functionality. Archived cards keep all their
+// data but are left out of lookups, lists and the gallery unless they are asked for. If
+// archived is not set the card is taken out of the archive.
+func archiveImpl(cardID int, archived bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
+	}
+
+	updated, err := queries.SetCardArchived(context.Background(), database.SetCardArchivedParams{
+		Archived: archived,
+		ID:       int32(cardID),
+	})
+	if err != nil {
+		return fmt.Errorf("error archiving card: %w", err)
+	}
+	if updated == 0 {
+		return &common.CardError{CardID: int32(cardID)}
+	}
+
+	if archived {
+		fmt.Printf("Archived card %d. Restore it with: ume archive --restore %d\n", cardID, cardID)
+	} else {
+		fmt.Printf("Restored card %d from the archive\n", cardID)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// attachmentObjectName returns the name of the object an attachment of a card is stored as
+func attachmentObjectName(cardID int32, filename string) string {
+	return fmt.Sprintf("%d/%s", cardID, filename)
+}
+
+// attachImpl implements the attach command functionality. The files are stored in the
+// attachment bucket under their names, replacing the attachments of the card with the
+// same names.
+func attachImpl(cardID int, paths []string) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
+	}
+
+	// Make sure the card exists
+	title, err := queries.GetCardTitle(context.Background(), int32(cardID))
+	if err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	// Initialize Minio client
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory, only files can be attached", path)
+		}
+
+		filename := filepath.Base(path)
+		objectName := attachmentObjectName(int32(cardID), filename)
+		if _, err := minioClient.UploadFileFromPath(minioClient.AttachmentBucket, objectName, path); err != nil {
+			return fmt.Errorf("error uploading %s: %w", path, err)
+		}
+
+		_, err = queries.CreateAttachment(context.Background(), database.CreateAttachmentParams{
+			CardID:      int32(cardID),
+			Filename:    filename,
+			ObjectName:  objectName,
+			ContentType: common.ContentTypeForFile(path),
+			Size:        info.Size(),
+		})
+		if err != nil {
+			return fmt.Errorf("error recording attachment %s: %w", filename, err)
+		}
+		fmt.Printf("Attached %s to card %d \"%s\"\n", filename, cardID, title)
+	}
+	return nil
+}
+
+// detachImpl implements the detach command functionality. The attachment is deleted from
+// storage, after confirming unless yes is set.
+func detachImpl(cardID int, filename string, yes bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
+	}
+
+	attachment, err := queries.GetAttachment(context.Background(), database.GetAttachmentParams{
+		CardID:   int32(cardID),
+		Filename: filename,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("card %d has no attachment %s: %w", cardID, filename, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting attachment: %w", err)
+	}
+
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Delete the attachment %s of card %d?", filename, cardID), "--yes")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Detach cancelled.")
+			return nil
+		}
+	}
+
+	// Initialize Minio client
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	if err := minioClient.DeleteFileFromMinio(minioClient.AttachmentBucket, attachment.ObjectName); err != nil {
+		return fmt.Errorf("error deleting %s from storage: %w", attachment.ObjectName, err)
+	}
+
+	_, err = queries.DeleteAttachment(context.Background(), database.DeleteAttachmentParams{
+		CardID:   int32(cardID),
+		Filename: filename,
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting attachment: %w", err)
+	}
+
+	fmt.Printf("Detached %s from card %d\n", filename, cardID)
+	return nil
+}
+
+// listAttachmentsImpl implements the list-attachments command functionality
+func listAttachmentsImpl(cardID int) error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	// Make sure the card exists
+	if _, err := queries.GetCardTitle(context.Background(), int32(cardID)); err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	attachments, err := queries.ListAttachments(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error listing attachments: %w", err)
+	}
+
+	if len(attachments) == 0 {
+		fmt.Printf("Card %d has no attachments.\n", cardID)
+		return nil
+	}
+
+	fmt.Println("Size\t\tAttached\t\tName")
+	fmt.Println("------------------------------------------------------------")
+	for _, attachment := range attachments {
+		fmt.Printf("%10d\t%s\t%s\n", attachment.Size,
+			attachment.CreatedAt.Time.Local().Format("2006-01-02 15:04:05"), attachment.Filename)
+	}
+	return nil
+}
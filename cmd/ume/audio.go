@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// audioImpl creates a card from a voice memo. The memo is transcribed, formatted
+// as markdown and stored like a card created from text, with the audio kept in
+// place of the image. It returns the ID of the new card. The stages are shown with a
+// spinner on terminals, with quiet only the new card is printed.
+func audioImpl(filePath, language string, normalize, quiet bool) (int32, error) {
+	// Check if the file exists and is readable
+	_, err := os.Stat(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("error accessing file: %w", err)
+	}
+
+	progress := common.NewProgress(quiet)
+	defer progress.Done()
+
+	// Transcribe before anything is stored, so a failed transcription leaves no empty card
+	progress.Stage("Transcribing audio")
+	transcript, err := common.TranscribeAudio(filePath, language)
+	if err != nil {
+		return 0, fmt.Errorf("error transcribing audio: %w", err)
+	}
+	if strings.TrimSpace(transcript) == "" {
+		return 0, fmt.Errorf("no speech found in %s, the card was not created", filePath)
+	}
+
+	openaiClient, err := common.NewOpenAIClient()
+	if err != nil {
+		return 0, fmt.Errorf("error initializing OpenAI client: %w", err)
+	}
+
+	progress.Stage("Converting transcript to markdown")
+	content, err := openaiClient.TranscriptToMarkdown(transcript)
+	if err != nil {
+		return 0, fmt.Errorf("error converting transcript to markdown: %w", err)
+	}
+
+	progress.Printf("Successfully converted transcript to markdown\n")
+
+	if normalize {
+		content = common.NormalizeMarkdown(content)
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return 0, fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	// Initialize Minio client
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return 0, fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	// The card belongs to the user set with UME_API_KEY, if any
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return 0, err
+	}
+
+	cardID, err := queries.CreateCard(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("error creating card: %w", err)
+	}
+
+	if owner.Valid {
+		err = queries.SetCardOwner(context.Background(), database.SetCardOwnerParams{ID: cardID, OwnerID: owner})
+		if err != nil {
+			return 0, fmt.Errorf("error setting card owner: %w", err)
+		}
+	}
+
+	// The audio is kept with the images so it can be played back from the card
+	progress.Stage("Uploading audio")
+	audioName, err := minioClient.UploadImageForCard(cardID, filePath)
+	if err != nil {
+		return 0, fmt.Errorf("error uploading audio file: %w", err)
+	}
+
+	err = queries.CreateImage(context.Background(), database.CreateImageParams{
+		CardID:   cardID,
+		Filename: audioName,
+		Method:   common.MethodAudio.String(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error associating audio with card: %w", err)
+	}
+
+	progress.Stage("Generating embeddings and title")
+	title, err := storeFirstVersion(dbpool, queries, minioClient, openaiClient.ApiKey, cardID, content, common.MethodAudio)
+	if err != nil {
+		return 0, err
+	}
+	progress.Done()
+
+	fmt.Printf("Created card %d \"%s\" from %s\n", cardID, title, audioName)
+	return cardID, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// Cards that weren't placed on the board yet are laid out in a grid of this many columns,
+// with cells of this size in pixels
+const (
+	boardColumns    = 6
+	boardCellWidth  = 240
+	boardCellHeight = 200
+)
+
+// boardCard is a card entry rendered by the board template
+type boardCard struct {
+	galleryCard
+	X, Y  float32
+	Group string
+}
+
+// boardLayout is the position and group of a card sent by the board when it is moved
+type boardLayout struct {
+	X     float32 `json:"x"`
+	Y     float32 `json:"y"`
+	Group string  `json:"group"`
+}
+
+// boardCards returns the cards with their positions on the board of the owner. Cards that
+// weren't placed yet are laid out in a grid below the placed ones.
+func boardCards(ctx context.Context, queries *database.Queries, owner pgtype.Int4) ([]boardCard, error) {
+	cards, err := galleryCards(queries, owner, pgtype.Int4{})
+	if err != nil {
+		return nil, err
+	}
+
+	layouts, err := queries.ListLayouts(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("error listing board positions: %w", err)
+	}
+	placed := make(map[int32]database.ListLayoutsRow)
+	var bottom float32
+	for _, layout := range layouts {
+		placed[layout.CardID] = layout
+		bottom = max(bottom, layout.Y+boardCellHeight)
+	}
+
+	board := make([]boardCard, 0, len(cards))
+	unplaced := 0
+	for _, card := range cards {
+		layout, ok := placed[card.CardID]
+		if !ok {
+			layout.X = float32(unplaced%boardColumns) * boardCellWidth
+			layout.Y = bottom + float32(unplaced/boardColumns)*boardCellHeight
+			unplaced++
+		}
+		board = append(board, boardCard{galleryCard: card, X: layout.X, Y: layout.Y, Group: layout.GroupName})
+	}
+	return board, nil
+}
+
+// registerBoardHandlers adds the board, where cards are arranged and grouped by dragging
+// them around. owner returns the user whose board a request is for.
+func registerBoardHandlers(mux *http.ServeMux, queries *database.Queries, owner func(r *http.Request) pgtype.Int4) {
+	mux.HandleFunc("GET /board", func(w http.ResponseWriter, r *http.Request) {
+		cards, err := boardCards(r.Context(), queries, owner(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		renderTemplate(w, "board.html", cards)
+	})
+
+	mux.HandleFunc("PUT /api/board/{id}", func(w http.ResponseWriter, r *http.Request) {
+		cardID, err := common.ParseCardIDString(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Cards owned by other users are reported as missing
+		if user := owner(r); user.Valid {
+			ok, err := queries.CanAccessCard(r.Context(), database.CanAccessCardParams{
+				CardID: int32(cardID),
+				UserID: user.Int32,
+			})
+			if err != nil || !ok {
+				http.Error(w, "card not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		var layout boardLayout
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&layout); err != nil {
+			http.Error(w, fmt.Sprintf("invalid layout: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		err = queries.SaveLayout(r.Context(), database.SaveLayoutParams{
+			OwnerID:   owner(r),
+			CardID:    int32(cardID),
+			X:         max(layout.X, 0),
+			Y:         max(layout.Y, 0),
+			GroupName: strings.TrimSpace(layout.Group),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// botImageExpiry is how long the image links posted by the bot stay valid
+const botImageExpiry = 24 * time.Hour
+
+// slackBot answers Slack slash commands and turns posted images into cards
+type slackBot struct {
+	signingSecret string
+	token         string
+	method        common.Method
+	language      string
+	owner         pgtype.Int4
+	queries       *database.Queries
+	minioClient   *common.MinioClient
+}
+
+// slackFile is a file attached to a Slack message
+type slackFile struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Mimetype           string `json:"mimetype"`
+	URLPrivateDownload string `json:"url_private_download"`
+}
+
+// slackEvent is the payload of the Slack Events API
+type slackEvent struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Event     struct {
+		Type     string      `json:"type"`
+		Subtype  string      `json:"subtype"`
+		BotID    string      `json:"bot_id"`
+		Channel  string      `json:"channel"`
+		TS       string      `json:"ts"`
+		ThreadTS string      `json:"thread_ts"`
+		Files    []slackFile `json:"files"`
+	} `json:"event"`
+}
+
+// botImpl implements the bot command functionality
+func botImpl(addr string, method common.Method, language string) error {
+	signingSecret, err := common.RequireEnvVar("SLACK_SIGNING_SECRET")
+	if err != nil {
+		return err
+	}
+	token, err := common.RequireEnvVar("SLACK_BOT_TOKEN")
+	if err != nil {
+		return err
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	// The bot searches and uploads as the user set with UME_API_KEY
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	bot := &slackBot{
+		signingSecret: signingSecret,
+		token:         token,
+		method:        method,
+		language:      language,
+		owner:         owner,
+		queries:       queries,
+		minioClient:   minioClient,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /slack/commands", bot.handleCommand)
+	mux.HandleFunc("POST /slack/events", bot.handleEvent)
+
+	fmt.Printf("Listening for Slack requests on %s\n", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// readVerifiedBody reads the request body and checks that the request was signed by Slack
+func (b *slackBot) readVerifiedBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	err = common.VerifySlackSignature(b.signingSecret,
+		r.Header.Get("X-Slack-Request-Timestamp"),
+		r.Header.Get("X-Slack-Signature"),
+		body, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return body, true
+}
+
+// handleCommand answers `/ume search <query>`
+func (b *slackBot) handleCommand(w http.ResponseWriter, r *http.Request) {
+	body, ok := b.readVerifiedBody(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse the form from the body that was already read for the signature
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	text := strings.TrimSpace(r.PostForm.Get("text"))
+	responseURL := r.PostForm.Get("response_url")
+
+	subcommand, query, _ := strings.Cut(text, " ")
+	query = strings.TrimSpace(query)
+	if subcommand != "search" || query == "" {
+		writeSlackJSON(w, map[string]string{
+			"response_type": "ephemeral",
+			"text":          "Usage: `/ume search <query>`, or post an image to create a card.",
+		})
+		return
+	}
+
+	// Slack expects an answer within 3 seconds, so the results are sent afterwards
+	writeSlackJSON(w, map[string]string{
+		"response_type": "ephemeral",
+		"text":          fmt.Sprintf("Searching for \"%s\"...", query),
+	})
+
+	go func() {
+		reply := b.searchReply(query)
+		if err := postSlackJSON(responseURL, "", map[string]string{
+			"response_type": "in_channel",
+			"text":          reply,
+		}); err != nil {
+			fmt.Printf("Error answering search for \"%s\": %v\n", query, err)
+		}
+	}()
+}
+
+// searchReply searches the cards and formats the results as a Slack message
+func (b *slackBot) searchReply(query string) string {
+	results, err := searchCards(b.queries, query, 10, searchOptions{Owner: b.owner})
+	if err != nil {
+		return fmt.Sprintf("Search for \"%s\" failed: %v", query, err)
+	}
+
+	var reply strings.Builder
+	fmt.Fprintf(&reply, "Cards matching \"%s\":\n", query)
+	for i, result := range results {
+		if i == 5 {
+			break
+		}
+
+		title := result.Title
+		if title == "" {
+			title = fmt.Sprintf("Card %d", result.CardID)
+		}
+
+		// Link to the card's image, which is only reachable through a presigned URL
+		line := fmt.Sprintf("*%d* %s", result.CardID, title)
+		image, err := b.queries.GetCardImage(context.Background(), result.CardID)
+		if err == nil {
+			url, err := b.minioClient.PresignedImageURL(image.Filename, botImageExpiry)
+			if err == nil {
+				line = fmt.Sprintf("*<%s|%d>* %s", url, result.CardID, title)
+			}
+		}
+
+		fmt.Fprintf(&reply, "%s (%.3f)\n> %s\n", line, result.Distance, common.Snippet(result.Text, 120))
+	}
+
+	return reply.String()
+}
+
+// handleEvent creates cards from images posted in channels the bot is in
+func (b *slackBot) handleEvent(w http.ResponseWriter, r *http.Request) {
+	body, ok := b.readVerifiedBody(w, r)
+	if !ok {
+		return
+	}
+
+	var event slackEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	// Slack checks the endpoint with a challenge when it's configured
+	if event.Type == "url_verification" {
+		writeSlackJSON(w, map[string]string{"challenge": event.Challenge})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Retries would create the same cards again
+	if r.Header.Get("X-Slack-Retry-Num") != "" {
+		return
+	}
+
+	if event.Type != "event_callback" || event.Event.Type != "message" || event.Event.BotID != "" {
+		return
+	}
+
+	threadTS := event.Event.ThreadTS
+	if threadTS == "" {
+		threadTS = event.Event.TS
+	}
+
+	for _, file := range event.Event.Files {
+		if file.Mimetype != "image/jpeg" && file.Mimetype != "image/png" {
+			continue
+		}
+
+		go func(file slackFile) {
+			reply := b.uploadReply(file)
+			err := postSlackJSON("https://slack.com/api/chat.postMessage", b.token, map[string]string{
+				"channel":   event.Event.Channel,
+				"thread_ts": threadTS,
+				"text":      reply,
+			})
+			if err != nil {
+				fmt.Printf("Error replying to upload of %s: %v\n", file.Name, err)
+			}
+		}(file)
+	}
+}
+
+// uploadReply downloads a posted image, creates a card from it and returns the reply message
+func (b *slackBot) uploadReply(file slackFile) string {
+	dir, err := os.MkdirTemp("", "ume_bot_*")
+	if err != nil {
+		return fmt.Sprintf("Could not create a card from %s: %v", file.Name, err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The file name becomes the object name of the image, so keep it unique
+	imagePath := filepath.Join(dir, fmt.Sprintf("slack_%s_%s", file.ID, filepath.Base(file.Name)))
+	if err := downloadSlackFile(file.URLPrivateDownload, b.token, imagePath); err != nil {
+		return fmt.Sprintf("Could not download %s: %v", file.Name, err)
+	}
+
+	cardID, err := uploadImpl(imagePath, b.method, b.language, false, false, false, false)
+	if err != nil {
+		return fmt.Sprintf("Could not create a card from %s: %v", file.Name, err)
+	}
+
+	title, err := b.queries.GetCardTitle(context.Background(), cardID)
+	if err != nil || title == "" {
+		return fmt.Sprintf("Created card %d from %s", cardID, file.Name)
+	}
+	return fmt.Sprintf("Created card %d \"%s\" from %s", cardID, title, file.Name)
+}
+
+// downloadSlackFile downloads a private Slack file to a local path
+func downloadSlackFile(url, token, path string) error {
+	ctx, cancel := common.CallContext()
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := common.HTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
+
+// postSlackJSON posts a JSON payload to a Slack URL, authenticated with token if it's not empty
+func postSlackJSON(url, token string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := common.CallContext()
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := common.HTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// writeSlackJSON writes a JSON response to a Slack request
+func writeSlackJSON(w http.ResponseWriter, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payload)
+}
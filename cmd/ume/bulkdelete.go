@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// bulkDeleteImpl deletes all cards uploaded before the given time and in the given
+// collection, in batches. A zero time or an empty collection doesn't filter the cards.
+// With dryRun it only previews what would be removed.
+func bulkDeleteImpl(before time.Time, collection string, batchSize int, dryRun, quiet, trash bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	collectionID, err := resolveCollection(queries, owner, collection)
+	if err != nil {
+		return err
+	}
+
+	cards, err := queries.ListCardsToDelete(context.Background(), database.ListCardsToDeleteParams{
+		CollectionID: collectionID,
+		OwnerID:      owner,
+		Before:       pgtype.Timestamptz{Time: before, Valid: !before.IsZero()},
+	})
+	if err != nil {
+		return fmt.Errorf("error listing cards: %w", err)
+	}
+
+	if len(cards) == 0 {
+		fmt.Println("No cards match the filters.")
+		return nil
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	// Preview the database rows and objects of each card
+	var total database.CountCardRowsRow
+	totalObjects := 0
+	for _, card := range cards {
+		rows, err := queries.CountCardRows(context.Background(), card.ID)
+		if err != nil {
+			return fmt.Errorf("error counting rows of card %d: %w", card.ID, err)
+		}
+		total.Versions += rows.Versions
+		total.Chunks += rows.Chunks
+		total.Links += rows.Links
+
+		objects, err := common.ListCardObjects(queries, minioClient.ImageBucket, minioClient.MarkdownBucket, minioClient.OCRBucket, minioClient.AttachmentBucket, card.ID)
+		if err != nil {
+			return err
+		}
+		totalObjects += len(objects)
+
+		fmt.Printf("Card %d \"%s\" (uploaded %s)\n", card.ID, card.Title, card.CreatedAt.Time.Local().Format("2006-01-02"))
+		if dryRun || !quiet {
+			fmt.Printf("  %d markdown versions, %d chunks, %d links\n", rows.Versions, rows.Chunks, rows.Links)
+			for _, object := range objects {
+				fmt.Printf("  %s/%s\n", object.Bucket, object.Name)
+			}
+		}
+	}
+
+	action := "delete"
+	if trash {
+		action = "move to the trash"
+	}
+
+	fmt.Printf("\nWould %s %d cards with %d markdown versions, %d chunks, %d links and %d objects.\n", action, len(cards), total.Versions, total.Chunks, total.Links, totalObjects)
+	if dryRun {
+		fmt.Println("Dry run, nothing was removed.")
+		return nil
+	}
+
+	// Ask for confirmation, if quiet is on, assume yes
+	if !quiet {
+		ok, err := confirm(fmt.Sprintf("Are you sure you want to %s these cards?", action), "--quiet")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println(common.T(msgDeleteCancelled))
+			return nil
+		}
+	}
+
+	if batchSize <= 0 {
+		batchSize = len(cards)
+	}
+
+	for start := 0; start < len(cards); start += batchSize {
+		end := min(start+batchSize, len(cards))
+		batch := cards[start:end]
+
+		if trash {
+			for _, card := range batch {
+				if err := trashCard(queries, minioClient, card.ID, true); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// Remove the objects first, so no card is left without its files in the database
+		for _, card := range batch {
+			objects, err := common.ListCardObjects(queries, minioClient.ImageBucket, minioClient.MarkdownBucket, minioClient.OCRBucket, minioClient.AttachmentBucket, card.ID)
+			if err != nil {
+				return err
+			}
+			for _, object := range objects {
+				err := minioClient.DeleteFileFromMinio(object.Bucket, object.Name)
+				if err != nil && !quiet {
+					fmt.Printf("Warning: Failed to delete %s: %v\n", object.Name, err)
+				}
+			}
+		}
+
+		// Delete the batch in a single transaction, cascade deletion takes care of related records
+		tx, err := dbpool.Begin(context.Background())
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		qtx := queries.WithTx(tx)
+		for _, card := range batch {
+			if err := qtx.DeleteCard(context.Background(), card.ID); err != nil {
+				tx.Rollback(context.Background())
+				return fmt.Errorf("error deleting card %d: %w", card.ID, err)
+			}
+		}
+		if err := tx.Commit(context.Background()); err != nil {
+			return fmt.Errorf("error committing deletion: %w", err)
+		}
+
+		fmt.Printf("Deleted cards %d/%d\n", end, len(cards))
+	}
+
+	if trash {
+		fmt.Printf("Moved %d cards to the trash.\n", len(cards))
+	} else {
+		fmt.Printf("Deleted %d cards and all associated data.\n", len(cards))
+	}
+	return nil
+}
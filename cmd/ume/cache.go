@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// cacheDir is a directory of the local caches, named by what it keeps
+type cacheDir struct {
+	Name string
+	Path string
+}
+
+// cacheDirs returns the directories of the local caches. The images of cards uploaded
+// offline are kept outside of them, as they are not in Minio yet.
+func cacheDirs() ([]cacheDir, error) {
+	contentCache, err := common.NewContentCache()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := common.CacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return []cacheDir{
+		{Name: "markdown", Path: filepath.Join(contentCache.Dir, common.CacheMarkdown)},
+		{Name: "images", Path: filepath.Join(contentCache.Dir, common.CacheImages)},
+		{Name: "queries", Path: filepath.Join(dir, "queries")},
+	}, nil
+}
+
+// dirUsage returns the number of files in a directory and their total size. A directory
+// that doesn't exist is empty.
+func dirUsage(dir string) (int, int64, error) {
+	files, size := 0, int64(0)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files++
+		size += info.Size()
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, nil
+	}
+	return files, size, err
+}
+
+// cacheStatsImpl implements the cache stats command functionality
+func cacheStatsImpl() error {
+	dirs, err := cacheDirs()
+	if err != nil {
+		return err
+	}
+
+	dir, err := common.CacheDir()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Cache directory: %s\n\n", dir)
+
+	fmt.Println("Cache\t\tFiles\t      Size")
+	fmt.Println("----------------------------------")
+	totalFiles, totalSize := 0, int64(0)
+	for _, d := range dirs {
+		files, size, err := dirUsage(d.Path)
+		if err != nil {
+			return fmt.Errorf("error reading %s cache: %w", d.Name, err)
+		}
+		fmt.Printf("%-8s\t%5d\t%10d\n", d.Name, files, size)
+		totalFiles += files
+		totalSize += size
+	}
+	fmt.Printf("%-8s\t%5d\t%10d\n", "total", totalFiles, totalSize)
+	return nil
+}
+
+// cacheClearImpl implements the cache clear command functionality
+func cacheClearImpl() error {
+	dirs, err := cacheDirs()
+	if err != nil {
+		return err
+	}
+
+	totalFiles, totalSize := 0, int64(0)
+	for _, d := range dirs {
+		files, size, err := dirUsage(d.Path)
+		if err != nil {
+			return fmt.Errorf("error reading %s cache: %w", d.Name, err)
+		}
+		if err := os.RemoveAll(d.Path); err != nil {
+			return fmt.Errorf("error clearing %s cache: %w", d.Name, err)
+		}
+		totalFiles += files
+		totalSize += size
+	}
+
+	fmt.Printf("Removed %d cached files (%d bytes)\n", totalFiles, totalSize)
+	return nil
+}
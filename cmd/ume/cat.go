@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// catImpl implements the cat command functionality. The markdown of a card version is
+// shown through the pager on a terminal, and written as it is when it's piped.
+// If version is -1 the latest version is printed.
+func catImpl(cardID int, version int) error {
+	content, err := cardMarkdown(cardID, version)
+	if err != nil {
+		return err
+	}
+	return pageText(content)
+}
+
+// cardMarkdown returns the markdown of a card version, or of the latest version if
+// version is -1
+func cardMarkdown(cardID int, version int) (string, error) {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return "", fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if version == -1 {
+		latestVersion, err := queries.GetLatestMarkdownVersion(context.Background(), int32(cardID))
+		if err != nil {
+			return "", fmt.Errorf("error getting latest markdown version: %w", err)
+		}
+		version = int(latestVersion)
+	} else {
+		_, err := queries.GetMarkdownFile(context.Background(), database.GetMarkdownFileParams{
+			CardID: int32(cardID),
+			Ver:    int32(version),
+		})
+		if err != nil {
+			return "", &common.CardError{CardID: int32(cardID), Version: int32(version), Err: err}
+		}
+	}
+
+	// Minio is only used for versions without a copy in the database
+	return common.ReadMarkdown(context.Background(), queries, nil, int32(cardID), int32(version))
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// cleanTmpImpl implements the clean-tmp command functionality. Temporary files of ume
+// not modified within olderThan are removed, so files in use by a running command stay.
+func cleanTmpImpl(olderThan time.Duration) error {
+	removed, err := common.CleanTempFiles(os.TempDir(), time.Now().Add(-olderThan))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range removed {
+		fmt.Printf("Removed %s\n", path)
+	}
+	fmt.Printf("Removed %d temporary files\n", len(removed))
+	return nil
+}
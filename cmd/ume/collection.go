@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// collectionCreateImpl creates a collection owned by the current user
+func collectionCreateImpl(name string) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	collectionID, err := queries.CreateCollection(context.Background(), database.CreateCollectionParams{
+		Name:    name,
+		OwnerID: owner,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating collection: %w", err)
+	}
+
+	fmt.Printf("Created collection %d \"%s\"\n", collectionID, name)
+	return nil
+}
+
+// collectionAddImpl adds cards to a collection the current user can write to
+func collectionAddImpl(name string, cardIDs []int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	collection, err := findCollection(queries, owner, name)
+	if err != nil {
+		return err
+	}
+
+	if !collection.CanWrite {
+		return fmt.Errorf("collection \"%s\" is shared with you read-only", name)
+	}
+
+	for _, cardID := range cardIDs {
+		// Users can only add the cards they can change, so cards shared with them
+		// read-only can't be shared further
+		if err := checkCardWrite(queries, owner, int32(cardID)); err != nil {
+			return err
+		}
+
+		err = queries.AddCardToCollection(context.Background(), database.AddCardToCollectionParams{
+			CollectionID: collection.ID,
+			CardID:       int32(cardID),
+		})
+		if err != nil {
+			return fmt.Errorf("error adding card %d to collection: %w", cardID, err)
+		}
+
+		fmt.Printf("Added card %d to collection \"%s\"\n", cardID, name)
+	}
+
+	return nil
+}
+
+// collectionShareImpl shares a collection owned by the current user with another user
+func collectionShareImpl(name, userName string, write bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	collection, err := findCollection(queries, owner, name)
+	if err != nil {
+		return err
+	}
+
+	// Only the owner can share a collection
+	if owner.Valid && collection.OwnerID != owner {
+		return fmt.Errorf("only the owner of collection \"%s\" can share it", name)
+	}
+
+	user, err := queries.GetUserByName(context.Background(), userName)
+	if err != nil {
+		return fmt.Errorf("user \"%s\" not found", userName)
+	}
+
+	err = queries.ShareCollection(context.Background(), database.ShareCollectionParams{
+		CollectionID: collection.ID,
+		UserID:       user.ID,
+		CanWrite:     write,
+	})
+	if err != nil {
+		return fmt.Errorf("error sharing collection: %w", err)
+	}
+
+	access := "read-only"
+	if write {
+		access = "read-write"
+	}
+	fmt.Printf("Shared collection \"%s\" with %s (%s)\n", name, user.Name, access)
+	return nil
+}
+
+// collectionListImpl lists the collections accessible to the current user
+func collectionListImpl() error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	collections, err := queries.ListCollections(context.Background(), owner)
+	if err != nil {
+		return fmt.Errorf("error listing collections: %w", err)
+	}
+
+	if len(collections) == 0 {
+		fmt.Println("No collections found. Create one with: ume collection create <name>")
+		return nil
+	}
+
+	fmt.Println("ID\tCards\tOwner\tName")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, collection := range collections {
+		ownerName := collection.OwnerName
+		if ownerName == "" {
+			ownerName = "-"
+		}
+		fmt.Printf("%4d\t%5d\t%s\t%s\n", collection.ID, collection.Cards, ownerName, collection.Name)
+	}
+
+	return nil
+}
+
+// findCollection looks up a collection by name among the ones accessible to the owner
+func findCollection(queries *database.Queries, owner pgtype.Int4, name string) (database.FindCollectionRow, error) {
+	collection, err := queries.FindCollection(context.Background(), database.FindCollectionParams{
+		UserID: owner,
+		Name:   name,
+	})
+	if err != nil {
+		return database.FindCollectionRow{}, fmt.Errorf("collection \"%s\" not found", name)
+	}
+	return collection, nil
+}
+
+// resolveCollection returns the ID of a collection to filter cards with.
+// An empty name doesn't filter.
+func resolveCollection(queries *database.Queries, owner pgtype.Int4, name string) (pgtype.Int4, error) {
+	if name == "" {
+		return pgtype.Int4{}, nil
+	}
+
+	collection, err := findCollection(queries, owner, name)
+	if err != nil {
+		return pgtype.Int4{}, err
+	}
+	return pgtype.Int4{Int32: collection.ID, Valid: true}, nil
+}
@@ -0,0 +1,1129 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// CommandFunc is a function type for commands. Its arguments start with the name of the command.
+type CommandFunc func([]string) error
+
+// Command is a command of ume. Its definition is used for dispatch, help and completion.
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	Help        string
+	Func        CommandFunc
+
+	// Subcommands are dispatched on the first argument after the command name
+	Subcommands []*Command
+
+	// CardArgs is the number of card IDs the command takes as its first arguments
+	CardArgs int
+
+	// id identifies the description and help of the command in the message catalogs
+	id string
+}
+
+// commands are the commands of ume. lookup is the first command, which is used when
+// the first argument is not a command.
+var commands []*Command
+
+// init defines the commands. They are assigned here because helpCmd refers to them.
+func init() {
+	commands = []*Command{
+		{
+			Name:        "lookup",
+			Usage:       "ume lookup [--collection=name] [--since=date] [--until=date] [--recency=days] [--expand] [--model=name] [--method=name] [--all-versions] [--include-archived] [--page=n] [--explain] <search_query>\nume <search_query>",
+			Description: "Search for text in the database (default if no command is specified)",
+			Help: `Search for text in the database and display the results.
+
+This command will:
+1. Generate an embedding for your search query
+2. Find text chunks in the database that are semantically similar
+3. Display the top matching cards
+4. Offer to view (v), edit (e), show (s) or open the image (o) of a result, like "v 2".
+   Without a number the best match is used, and an empty answer quits
+
+Options:
+  --collection, -c    Only search the cards in this collection
+  --since             Only search cards created on or after a date (YYYY-MM-DD) or an age like 7d, 2w, 3m, 1y
+  --until             Only search cards created on or before a date or an age
+  --recency           Rank newer cards higher, with a half-life in days (e.g. 30)
+  --expand            Also search 2-3 paraphrases and translations of the query written by the
+                      chat model, and rank cards found by several of them first. Helps short queries
+  --model             Search the chunks embedded with this model instead of the current one, set
+                      with UME_EMBEDDING_MODEL. Only chunks of the same model are compared
+  --method            Only search the cards created with this method: ocr, mistral, vision, text or audio
+  --all-versions      Also search the earlier versions of the cards. Each card is listed once, with
+                      the version that matched best
+  --include-archived  Also search the cards archived with ume archive
+  --page              Show this page of results, 10 cards a page (default: 1)
+  --explain           Show how each result was scored: the distance of the chunk that matched,
+                      the penalty for its age with --recency, the fusion score with --expand,
+                      whether it is pinned, and the version and chunk that matched`,
+			Func: lookupCmd,
+		},
+		{
+			Name:        "list",
+			Usage:       "ume list [--collection=name] [--include-archived]",
+			Description: "List all cards with their titles",
+			Help: `List all cards with their latest version and title.
+
+Options:
+  --collection, -c    Only list the cards in this collection
+  --include-archived  Also list the cards archived with ume archive, marked as archived`,
+			Func: listCmd,
+		},
+		{
+			Name:        "upload",
+			Usage:       "ume upload [--method=mistral|ocr|vision|auto] [-l=language] [--handwriting] [--diagram] [--dry-run] [--async] <image_file>\nume upload [options] --url <image_url>\nume upload [options] --clipboard\nume upload [-l=language] [--normalize] --audio <audio_file>",
+			Description: "Upload an image file, extract text, and store the results",
+			Help: `Upload an image file, extract text, and store the results in the database.
+
+Options:
+  --method=ocr      Use Azure OCR service(default)
+  --method=mistral  Use Mistral OCR service
+  --method=vision   Use OpenAI's Vision API
+  --method=auto     Classify the image with a small vision request first (handwriting, table,
+                    diagram or printed text) and use the best configured method for it.
+                    Handwriting is transcribed with the handwriting settings and diagrams
+                    are also described like with --diagram
+  -l, --lang        Language for OCR recognition (default: auto) - only applies to OCR method
+                    Examples: en, de, fr, es, zh, ja
+                    With auto the language is detected by the OCR service
+                    Full list: https://learn.microsoft.com/en-us/azure/ai-services/computer-vision/language-support#optical-character-recognition-ocr
+  --normalize       Normalize whitespace, headings and image links before storing
+  --handwriting     Use settings tuned for handwritten cards. Uncertain words are marked with [?]
+                    With --method=vision the card is transcribed instead of described
+  --diagram         For diagram-heavy cards: transcribe the text on the image and also describe
+                    what the diagrams show, in a "Diagram description" section
+  --url             Download the image from a URL instead of reading a file
+  --clipboard       Read the image from the clipboard, e.g. a screenshot
+                    Uses osascript on macOS, wl-paste or xclip on Linux and PowerShell on Windows
+  --audio           Create the card from a voice memo (m4a, mp3, wav, ogg, webm) instead of an image
+                    The memo is transcribed with OpenAI Whisper and formatted as markdown, -l sets its language
+                    Set UME_STT_URL, UME_STT_MODEL and UME_STT_KEY to use another OpenAI compatible provider
+  -q, --quiet       Only print the ID of the new card
+  --dry-run         Extract the text, convert it and chunk it, then print the markdown, the chunks
+                    and the estimated embedding cost without storing anything
+  --async           Only upload the image and queue a job to process it, processed by ume worker.
+                    Returns right away, so many cards can be scanned in a row
+
+On a terminal each stage is shown with a spinner, its elapsed time and retries.
+
+This command will:
+1. Upload the image to storage
+2. Extract text using the specified method (Mistral, OCR, or Vision)
+3. Convert the result to markdown
+4. Generate embeddings for the markdown content
+5. Generate a title for the card
+6. Store everything in the database`,
+			Func: uploadCmd,
+		},
+		{
+			Name:        "compare-ocr",
+			Usage:       "ume compare-ocr [--methods=mistral,ocr,vision] [-l=language] [--handwriting] [--web] <image_file>",
+			Description: "Compare the markdown extracted from an image with each method",
+			Help: `Extract the text of an image with every configured method and show the markdown of
+each side by side, to choose the method that works best for your cards. The result you
+pick is kept as a new card.
+
+Options:
+  --methods       Comma-separated methods to compare (default: every method whose
+                  provider is configured)
+  -l, --lang      Language for OCR recognition (default: auto) - only applies to OCR method
+  --handwriting   Use settings tuned for handwritten cards
+  --web           Show the image and the rendered markdown in the browser instead`,
+			Func: compareOCRCmd,
+		},
+		{
+			Name:        "import",
+			Usage:       "ume import [--normalize] --notion <export.zip>\nume import [--normalize] --gdocs <export.zip>",
+			Description: "Import pages from Notion or Google Docs as cards",
+			Help: `Import the pages of an export from another note app as text cards.
+
+Options:
+  --notion      A Notion "Markdown & CSV" export. Databases and attachments are skipped
+  --gdocs       A Google Drive download or Takeout export. Google Docs exported as Word
+                documents are converted to markdown, markdown and text files are kept
+  --normalize   Normalize the markdown before storing it
+
+Each card remembers the page it came from, by its Notion page ID or its path in the
+Drive export. Importing a newer export adds a version to the cards whose pages changed
+instead of creating them again.`,
+			Func: importCmd,
+		},
+		{
+			Name:        "new",
+			Usage:       "ume new [--normalize] [-]",
+			Description: "Create a card from text without an image",
+			Help: `Create a card from markdown text, without an image.
+
+Without arguments the editor is opened to write the card, with - the markdown is read from stdin:
+  echo "idea" | ume new -
+
+Options:
+  --normalize      Normalize whitespace, headings and image links before storing`,
+			Func: newCmd,
+		},
+		{
+			Name:        "edit",
+			Usage:       "ume edit [options] <card_id>",
+			Description: "Download and edit a card's markdown content",
+			Help: `Download and edit a card's markdown content.
+
+Options:
+  -v, --verbose    Enable verbose output
+  --version        Version to edit and branch from (default: latest)
+  --normalize      Normalize whitespace, headings and image links before saving
+  -q, --quiet      Suppress the progress and output after saving
+  --stdin          Save the content read from stdin instead of opening an editor
+  --replace        Same as --stdin
+  --stdout         Print the content to stdout instead of opening an editor
+
+This command will:
+1. Download the latest (or specified) markdown version for the card
+2. Open it in $VISUAL, $EDITOR or neovim for you to edit. Without any of them the
+   file is opened with the default app of the OS, and saved when you press Enter
+3. If you make changes, upload the new version
+   (if another session saved a newer version meanwhile, offer to merge or abort)
+4. Generate new embeddings for the updated content
+
+For scripts, --stdout and --stdin edit without an editor:
+  ume edit --stdout 12 > card.md
+  ume edit --replace 12 < card.md`,
+			CardArgs: 1,
+			Func:     editCmd,
+		},
+		{
+			Name:        "reconvert",
+			Usage:       "ume reconvert [options] <card_id>",
+			Description: "Convert the stored OCR result of a card to markdown again",
+			Help: `Convert the stored OCR result of a card to markdown again and store it as a new version.
+The raw OCR result is kept when a card is uploaded with the ocr or mistral method,
+so the conversion can be improved without running OCR again.
+
+Options:
+  --model          Model used for the conversion (default: o1-mini)
+  --normalize      Normalize whitespace, headings and image links before storing
+  -q, --quiet      Only print the new version`,
+			CardArgs: 1,
+			Func:     reconvertCmd,
+		},
+		{
+			Name:        "history",
+			Usage:       "ume history <card_id>",
+			Description: "Show the version history of a card's markdown content",
+			Help: `Show the version history of a card's markdown content.
+
+Versions edited from an older version are shown as indented branches. The UID of the
+card, which identifies it across instances, is shown with its ID.`,
+			CardArgs: 1,
+			Func:     historyCmd,
+		},
+		{
+			Name:        "object-history",
+			Usage:       "ume object-history <card_id>",
+			Description: "List the versions Minio keeps of a card's markdown objects",
+			Help: `List the versions Minio keeps of the markdown objects of a card, its translations
+and the objects moved to the trash, with their version IDs.
+
+Every version is only kept when versioning of the markdown bucket is on, which is
+turned on with MINIO_MARKDOWN_VERSIONING. Objects overwritten or deleted since then,
+even by hand, can be recovered by their version ID with the Minio tools.`,
+			CardArgs: 1,
+			Func:     objectHistoryCmd,
+		},
+		{
+			Name:        "rename",
+			Usage:       "ume rename <card_id> <title>",
+			Description: "Change the title of a card",
+			Help: `Change the title of a card.
+
+Titles are generated automatically on upload and shown by list, lookup and show.`,
+			CardArgs: 1,
+			Func:     renameCmd,
+		},
+		{
+			Name:        "links",
+			Usage:       "ume links <card_id>",
+			Description: "Show links from and to a card",
+			Help: `Show the cards a card links to and the cards linking to it.
+
+Links are written as [[card:123]] in the markdown and are updated on upload and edit.
+Links written with the UID of the card, [[card:<uid>]], stay valid when the card is
+synced to another instance.
+In ume show they are rendered as links to the other cards.`,
+			CardArgs: 1,
+			Func:     linksCmd,
+		},
+		{
+			Name:        "related",
+			Usage:       "ume related [options] <card_id>",
+			Description: "Find cards related to a card",
+			Help: `Find the cards that are closest in content to a card.
+
+Options:
+  -n, --limit     Number of related cards to show (default: 10)
+
+This command will:
+1. Average the embeddings of the card's latest chunks
+2. Find the other cards whose chunks are closest to that average
+3. Display them ordered by distance`,
+			CardArgs: 1,
+			Func:     relatedCmd,
+		},
+		{
+			Name:        "map",
+			Usage:       "ume map [options]",
+			Description: "Group cards into topics by their embeddings",
+			Help: `Group the latest versions of all cards into topics.
+
+Options:
+  -k              Number of topics (default: based on the number of cards)
+  --no-labels     Don't label topics with the chat API
+
+This command will:
+1. Cluster the embeddings of all latest chunks with k-means
+2. Label each cluster from its most central chunks using OpenAI
+3. Display the topics with the cards they contain`,
+			Func: mapCmd,
+		},
+		{
+			Name:        "dedupe",
+			Usage:       "ume dedupe [options]",
+			Description: "Find near-duplicate cards and merge or delete them",
+			Help: `Find cards with nearly the same content, e.g. after importing overlapping scans.
+
+Options:
+  --threshold     Maximum cosine distance of duplicates (default: 0.03)
+  --width         Width of each column in the side by side view (default: 40)
+
+This command will:
+1. Compare the embeddings of the latest versions of all cards
+2. Show each pair of close cards side by side, closest first
+3. Merge the second card into the first, move it to the trash, or skip the pair`,
+			Func: dedupeCmd,
+		},
+		{
+			Name:        "merge",
+			Usage:       "ume merge [options] <target_card_id> <source_card_id>",
+			Description: "Merge a card into another card",
+			Help: `Merge the source card into the target card.
+
+Options:
+  --dry-run       Only show the merged markdown and what would change
+
+This command will:
+1. Append the latest markdown of the source to the latest markdown of the target
+2. Store the result as a new version of the target and generate its embeddings
+3. Move the images of the source to the target
+4. Move the source card to the trash`,
+			CardArgs: 2,
+			Func:     mergeCmd,
+		},
+		{
+			Name:        "split",
+			Usage:       "ume split <card_id>",
+			Description: "Split a card into several cards",
+			Help: `Split a card that holds several ideas into separate cards.
+
+This command will:
+1. Open the latest markdown of the card in the editor
+2. Let you separate the sections with lines containing only ---
+3. Keep the first section in the card as a new version
+4. Create a new card for every other section, sharing the card's image
+5. Generate titles and embeddings for the new cards`,
+			CardArgs: 1,
+			Func:     splitCmd,
+		},
+		{
+			Name:        "alias",
+			Usage:       "ume alias [--force] <card_id> <alias>\nume alias --delete <alias>\nume alias",
+			Description: "Give a card a memorable name to use instead of its ID",
+			Help: `Give a card an alias, which is accepted wherever a card ID is:
+  ume alias 123 metabolism-notes
+  ume cat metabolism-notes
+
+Aliases start with a letter and contain letters, digits, '.', '-' and '_'. They are
+case-insensitive. Without arguments the aliases of your cards are listed.
+
+Options:
+  --force    Move the alias from the card it was given to
+  --delete   Delete the alias`,
+			CardArgs: 1,
+			Func:     aliasCmd,
+		},
+		{
+			Name:        "archive",
+			Usage:       "ume archive [--restore] <card_id>",
+			Description: "Archive a dormant card, leaving it out of searches and lists",
+			Help: `Archive a card of a finished project. Archived cards keep all their versions,
+images and embeddings, and can still be opened by ID, but are left out of ume lookup,
+ume list and the gallery unless --include-archived is given.
+
+Options:
+  --restore   Take the card out of the archive`,
+			CardArgs: 1,
+			Func:     archiveCmd,
+		},
+		{
+			Name:        "pin",
+			Usage:       "ume pin [--remove] <card_id>",
+			Description: "Pin a card in active use, listed first by lookup and the gallery",
+			Help: `Pin a card you are using in a writing project. Pinned cards are listed first
+by ume lookup when they match, marked with *, and in their own section of the gallery.
+Each user has their own pins.
+
+Options:
+  --remove   Unpin the card`,
+			CardArgs: 1,
+			Func:     pinCmd,
+		},
+		{
+			Name:        "pins",
+			Usage:       "ume pins",
+			Description: "List the pinned cards",
+			Help:        `List your pinned cards, the latest pinned first.`,
+			Func:        pinsCmd,
+		},
+		{
+			Name:        "attach",
+			Usage:       "ume attach <card_id> <file>...",
+			Description: "Attach files such as recordings, PDFs or datasets to a card",
+			Help: `Attach files to a card, stored with it in the card-attachments bucket. A file
+with the same name as an attachment of the card replaces it. The attachments are
+shown as download links in the web view of the card, and are deleted with the card.`,
+			CardArgs: 1,
+			Func:     attachCmd,
+		},
+		{
+			Name:        "detach",
+			Usage:       "ume detach [--yes] <card_id> <filename>",
+			Description: "Delete an attachment of a card",
+			Help: `Delete an attachment of a card from storage.
+
+Options:
+  --yes   Delete without asking for confirmation`,
+			CardArgs: 1,
+			Func:     detachCmd,
+		},
+		{
+			Name:        "list-attachments",
+			Usage:       "ume list-attachments <card_id>",
+			Description: "List the files attached to a card",
+			CardArgs:    1,
+			Func:        listAttachmentsCmd,
+		},
+		{
+			Name:        "meta",
+			Usage:       "ume meta <set|show> <card_id> [field=value]...",
+			Description: "Record the source a card was taken from",
+			Help: `Record the source of a card, so quoted cards can be traced back to it. The
+source is shown in the web view and included in exports.`,
+			Subcommands: []*Command{
+				{
+					Name:        "set",
+					Usage:       "ume meta set <card_id> field=value...",
+					Description: "Set the source of a card",
+					Help: `Set fields of the source of a card, the other fields keep their values:
+  ume meta set 123 book="The Art of Note Taking" page=12 read=2024-05-01
+
+Fields:
+  book   Title of the book or article
+  page   Page or page range
+  url    Web address of the source
+  read   Date the source was read (YYYY-MM-DD)
+
+An empty value clears a field.`,
+					CardArgs: 1,
+					Func:     metaSetCmd,
+				},
+				{
+					Name:        "show",
+					Usage:       "ume meta show <card_id>",
+					Description: "Show the source of a card",
+					CardArgs:    1,
+					Func:        metaShowCmd,
+				},
+			},
+		},
+		{
+			Name:        "graph",
+			Usage:       "ume graph [options]",
+			Description: "Export or show the relationships between cards",
+			Help: `Export the links between cards and the pairs of cards with similar embeddings as a
+graph, to see clusters and isolated cards at a glance.
+
+Options:
+  --format           dot for Graphviz or json (default: dot)
+  -o, --output       File to write the graph to (default: stdout)
+  -c, --collection   Only include the cards in this collection
+  --min-similarity   Join cards at least this similar, from -1 to 1 (default: 0.6)
+  --web              Show an interactive graph in the browser instead
+
+Render the DOT output with Graphviz, for example:
+  ume graph | dot -Tsvg -o cards.svg`,
+			Func: graphCmd,
+		},
+		{
+			Name:        "compose",
+			Usage:       "ume compose [options] [card_id...]",
+			Description: "Draft a document from a set of cards",
+			Help: `Assemble the latest markdown of cards, in the order they are given, into a draft
+document and store it. The headings of each card move one level down under the title
+of the document, and each section starts with the title of its card.
+
+Options:
+  -t, --title        Title of the document, the collection or the first card by default
+  -c, --collection   Compose the cards in this collection when no card IDs are given
+  --arrange          Order the cards in the editor before composing, removing a line
+                     leaves the card out
+  --smooth           Smooth the transitions between the cards with the chat model
+  --dry-run          Only print the document, without storing it
+
+Read the stored documents with "ume documents".`,
+			Func: composeCmd,
+		},
+		{
+			Name:        "documents",
+			Usage:       "ume documents <list|cat|cards> [document_id]",
+			Description: "List and read the documents drafted by ume compose",
+			Help:        `Manage the documents drafted from cards with ume compose.`,
+			Subcommands: []*Command{
+				{
+					Name:        "list",
+					Usage:       "ume documents list",
+					Description: "List the documents",
+					Help:        `List the documents with the number of cards they were composed from.`,
+					Func:        documentsListCmd,
+				},
+				{
+					Name:        "cat",
+					Usage:       "ume documents cat <document_id>",
+					Description: "Print the markdown of a document",
+					Help:        `Print the markdown of a document, through the pager on a terminal.`,
+					Func:        documentsCatCmd,
+				},
+				{
+					Name:        "cards",
+					Usage:       "ume documents cards <document_id>",
+					Description: "List the cards a document was composed from",
+					Help:        `List the cards a document was composed from, in order, with the version of each that was used.`,
+					Func:        documentsCardsCmd,
+				},
+			},
+		},
+		{
+			Name:        "review",
+			Usage:       "ume review [options]",
+			Description: "Study due cards with spaced repetition",
+			Help: `Study cards that are due, scheduled with spaced repetition (SM-2).
+
+Options:
+  -n, --limit     Maximum number of cards to review (default: 20)
+  -l, --lang      Show cards translated to the specified language
+
+This command will:
+1. Select the cards that are due or have never been reviewed
+2. Show each card in the browser
+3. Ask how well you recalled it (0-2 forgotten, 3 hard, 4 good, 5 easy)
+4. Schedule the next review based on the grade`,
+			Func: reviewCmd,
+		},
+		{
+			Name:        "review-queue",
+			Usage:       "ume review-queue [--done=card_id]",
+			Description: "List cards whose OCR needs review",
+			Help: `List the cards flagged because the OCR was unsure of their text, least certain first.
+
+A card is flagged when the confidence of its OCR is below the review threshold
+(default: 0.8, set UME_OCR_REVIEW_THRESHOLD to change it). Only Azure OCR reports
+confidences, cards converted with other methods are never flagged.
+Editing a card removes it from the queue.
+
+Options:
+  --done    Remove a card from the queue without editing it`,
+			Func: reviewQueueCmd,
+		},
+		{
+			Name:        "verify",
+			Usage:       "ume verify",
+			Description: "Check that the stored objects match the database",
+			Help: `Check the integrity of the cards outside the trash.
+
+This command will:
+1. Download every markdown version and compare its SHA-256 with the stored hash
+2. Copy the markdown into the database where the copy there is missing or differs,
+   so it can be read without Minio. Minio keeps the canonical copy
+3. Move markdown stored before it was stored by its hash to the name of its hash
+4. Check that every markdown version has embeddings
+5. Check that every image of a card is in Minio
+6. Check for uploads that were interrupted before they were stored
+7. Report each problem with a suggestion to fix it, and exit with an error if there are any`,
+			Func: verifyCmd,
+		},
+		{
+			Name:        "config",
+			Usage:       "ume config <set-secret|delete-secret> <name>",
+			Description: "Store API keys and passwords in the OS keychain",
+			Help: `Store secrets in the OS keychain instead of the environment or .env.
+
+Secrets are read from the environment first, then from the keychain: the macOS
+Keychain, the Secret Service (secret-tool) on Linux, or the Windows Credential Manager.
+
+Secrets:
+  OPENAI_KEY, AZURE_KEY, MISTRAL_KEY, MINIO_USER, MINIO_PASSWORD, UME_ENCRYPTION_KEY,
+  UME_SYNC_KEY`,
+			Subcommands: []*Command{
+				{
+					Name:        "set-secret",
+					Usage:       "ume config set-secret <name>",
+					Description: "Store a secret, read without echo from the terminal or from stdin",
+					Func:        configSetSecretCmd,
+				},
+				{
+					Name:        "delete-secret",
+					Usage:       "ume config delete-secret <name>",
+					Description: "Remove a secret from the keychain",
+					Func:        configDeleteSecretCmd,
+				},
+			},
+		},
+		{
+			Name:        "cat",
+			Usage:       "ume cat [options] <card_id>",
+			Description: "Print a card's markdown",
+			Help: `Print the markdown of a card to standard output.
+
+Options:
+  -v, --version   Version number of markdown to print (default: latest)
+
+On a terminal the markdown is shown through $PAGER (less by default). When the output
+is piped it is written as it is, e.g. ume cat 12 | glow -`,
+			CardArgs: 1,
+			Func:     catCmd,
+		},
+		{
+			Name:        "publish",
+			Usage:       "ume publish [--collection=name] <dir>",
+			Description: "Write the cards as a static website",
+			Help: `Write the latest version of the cards as a static website, like a public
+knowledge garden hosted on GitHub Pages.
+
+Options:
+  --collection, -c    Only publish the cards in this collection
+
+The directory gets an index.html with a search box over the text of the cards, and a
+page per card with its image and links to related cards, found with their embeddings.
+Links to cards that are not published are left as text. Images are written decrypted,
+so only publish cards you want to be public.`,
+			Func: publishCmd,
+		},
+		{
+			Name:        "sync",
+			Usage:       "ume sync remote [--dry-run] <url>",
+			Description: "Copy cards between this instance and a ume serve instance",
+			Subcommands: []*Command{
+				{
+					Name:        "remote",
+					Usage:       "ume sync remote [--dry-run] <url>",
+					Description: "Sync the cards with the ume serve instance at a URL",
+					Help: `Sync the cards of this instance with a ume serve instance, like a laptop with a server.
+
+Options:
+  --dry-run   Only print what would be copied and the conflicts
+
+Cards are matched by their UID. The markdown versions, embeddings and images missing
+on either side are copied, so nothing is embedded again. A card with a version that
+was edited on both sides, or that is in the trash on one side and changed on the
+other, is reported as a conflict and left alone.
+
+The remote is accessed with the API key in UME_SYNC_KEY, which can be stored with
+ume config set-secret UME_SYNC_KEY. Only the cards of that user are synced.`,
+					Func: syncRemoteCmd,
+				},
+			},
+		},
+		{
+			Name:        "migrate-embeddings",
+			Usage:       "ume migrate-embeddings --precision=<full|half> [--yes]",
+			Description: "Store embeddings with full or half precision",
+			Help: `Convert the stored chunk embeddings between full precision (vector) and half
+precision (halfvec), and create the indexes of each embedding model again.
+
+Half precision takes half the space, and its indexes are smaller and faster to search,
+for a little accuracy. Indexes support up to 2000 dimensions with full precision and
+4000 with half, so text-embedding-3-large is only indexed with half precision.
+
+Options:
+  --precision   full or half
+  --yes         Convert without asking for confirmation
+
+Converting back to full precision doesn't restore the precision that was lost. The table
+is locked while it is converted, so run it when ume isn't used.`,
+			Func: migrateEmbeddingsCmd,
+		},
+		{
+			Name:        "clean-tmp",
+			Usage:       "ume clean-tmp [--older-than=24h]",
+			Description: "Remove temporary files left behind by ume",
+			Help: `Remove the temporary files and directories ume left in the temporary directory.
+
+Options:
+  --older-than   Only remove files last modified longer ago than this (default: 24h)
+
+Commands remove their temporary files when they finish. Files are left behind when a
+command is killed, when saving an edit fails (the edit is kept so it isn't lost), and
+for images opened in the browser. Files written to /tmp/<card>_<version>.md by older
+versions of ume are removed too.`,
+			Func: cleanTmpCmd,
+		},
+		{
+			Name:        "tui",
+			Usage:       "ume tui [search_query]",
+			Description: "Browse, search and edit cards in a terminal UI",
+			Help: `Browse and search cards in a full screen terminal UI.
+
+The screen shows a search bar, the list of matching cards (all cards without a query),
+a preview of the selected card and the keys available in the status bar.
+Images are drawn in the preview on terminals with kitty or iTerm2 graphics
+(kitty, Ghostty, iTerm2, WezTerm) and opened in the browser otherwise.
+
+Keys:
+  /, tab          Edit the search query, enter to search
+  j/k, up/down    Select a card
+  space/b         Scroll the preview
+  i               Show the image of the card instead of its markdown
+  e               Edit the card in the editor
+  d               Move the card to the trash
+  t               Add the card to a collection
+  q, ctrl+c       Quit`,
+			Func: tuiCmd,
+		},
+		{
+			Name:        "bot",
+			Usage:       "ume bot [options]",
+			Description: "Run a Slack bot for searching and uploading cards",
+			Help: `Run a Slack bot that searches cards and creates cards from posted images.
+
+Options:
+  --addr          Address to listen on (default: :8080)
+  --method        Text extraction method for posted images: ocr (default), mistral, vision, or auto
+  --lang          Language for OCR (default: auto)
+
+The Slack app needs:
+- SLACK_SIGNING_SECRET and SLACK_BOT_TOKEN in the environment
+- A /ume slash command pointing to /slack/commands, used as "/ume search <query>"
+- Message events pointing to /slack/events, and the files:read and chat:write scopes`,
+			Func: botCmd,
+		},
+		{
+			Name:        "show",
+			Usage:       "ume show [options] <card_id>\nume show --all",
+			Description: "Show a card's image and markdown content in the browser",
+			Help: `Show a card's image and rendered markdown in the browser.
+
+Options:
+  -v, --version   Version number of markdown to show (default: latest)
+  -l, --lang      Translate the card to the specified language
+  --all           Show a searchable gallery of all cards
+  --chunk         Scroll to and highlight a chunk, as suggested by ume lookup
+
+The gallery links to a board where cards can be dragged around and grouped by name,
+like cards spread on a desk. Their positions are kept for the next time.
+
+The card is served from a local server that stops when you press Enter.`,
+			CardArgs: 1,
+			Func:     showCmd,
+		},
+		{
+			Name:        "serve",
+			Usage:       "ume serve [options]",
+			Description: "Serve cards to multiple users over HTTP",
+			Help: `Serve the gallery, card pages and a search API for all users.
+
+Options:
+  --addr          Address to listen on (default: :8080)
+  -l, --lang      Translate cards to the specified language
+
+Requests are authenticated with a user's API key (see "ume user"),
+sent as an Authorization: Bearer header or entered once in the browser at /login, which keeps
+a session cookie. The cookie is only sent over HTTPS or to localhost.
+Users see their own cards, cards without an owner and cards in collections shared with them.
+
+Endpoints:
+  /                 Gallery of cards
+  /board            Board to arrange and group cards, kept for each user
+  /graph            Graph of the links and similarities between cards
+  /api/graph        The graph as JSON, with ?min_similarity= and ?collection=<id>
+  /card/<id>        Card page
+  /api/search?q=    Search results as JSON, with &include_archived=true to search archived cards
+  /metrics          Prometheus metrics, without an API key`,
+			Func: serveCmd,
+		},
+		{
+			Name:        "user",
+			Usage:       "ume user <add|list> [name]",
+			Description: "Create and list users and their API keys",
+			Help: `Manage the users of a shared deployment.
+
+Set UME_API_KEY or --api-key to act as a user from the command line: uploaded cards are
+owned by that user, and list and lookup only show its cards and shared cards.`,
+			Subcommands: []*Command{
+				{
+					Name:        "add",
+					Usage:       "ume user add <name>",
+					Description: "Create a user and print its API key",
+					Func:        userAddCmd,
+				},
+				{
+					Name:        "list",
+					Usage:       "ume user list",
+					Description: "List users with the number of cards they own",
+					Func:        userListCmd,
+				},
+			},
+		},
+		{
+			Name:        "collection",
+			Usage:       "ume collection <create|add|share|list> [options]",
+			Description: "Manage shared collections of cards",
+			Help: `Group cards into collections and share them with other users.
+
+Cards in a collection shared with you show up in list, lookup and serve.
+Use --collection with list and lookup to only see the cards in a collection.`,
+			Subcommands: []*Command{
+				{
+					Name:        "create",
+					Usage:       "ume collection create <name>",
+					Description: "Create a collection owned by you",
+					Func:        collectionCreateCmd,
+				},
+				{
+					Name:        "add",
+					Usage:       "ume collection add <name> <card_id>...",
+					Description: "Add cards to a collection you can write to",
+					Func:        collectionAddCmd,
+				},
+				{
+					Name:        "share",
+					Usage:       "ume collection share [--write] <name> <user>",
+					Description: "Share a collection you own",
+					Help: `Share a collection you own with another user.
+
+Options:
+  --write         Allow the user to add cards to the collection (default: read-only)`,
+					Func: collectionShareCmd,
+				},
+				{
+					Name:        "list",
+					Usage:       "ume collection list",
+					Description: "List the collections you can access",
+					Func:        collectionListCmd,
+				},
+			},
+		},
+		{
+			Name:        "translate",
+			Usage:       "ume translate [options] <card_id>",
+			Description: "Translate a card's markdown and store the translation",
+			Help: `Translate a card's markdown and store the translation for reuse.
+
+Options:
+  -l, --lang      Language to translate to (required)
+  -v, --version   Version number of markdown to translate (default: latest)
+  --force         Translate again even if a stored translation exists
+  --embed         Also embed the translated chunks, so lookups in that language find the card
+
+This command will:
+1. Reuse the stored translation for the card version and language if there is one
+2. Otherwise translate the markdown with OpenAI and store it in Minio and the database
+3. Print the translated markdown
+
+Stored translations are also used by ume show --lang.`,
+			CardArgs: 1,
+			Func:     translateCmd,
+		},
+		{
+			Name:        "export",
+			Usage:       "ume export [options] <card_id>",
+			Description: "Export a card to a self-contained HTML, PDF or markdown file",
+			Help: `Export a card's image and markdown into a self-contained document. The source of
+the card is cited below the markdown, or written to the frontmatter with md.
+
+Options:
+  --format        Output format: html (default), pdf or md
+  -v, --version   Version number of markdown to export (default: latest)
+  -o, --output    Output file (default: card_<card_id>.<format>)
+
+This command will:
+1. Render the markdown of the card on the server side
+2. Embed the card image as a data URI and inline the stylesheet
+3. Write an HTML file, or convert it to PDF with wkhtmltopdf or chromium
+
+With md only the markdown is written, after YAML frontmatter with the title, UID,
+version and source of the card.`,
+			CardArgs: 1,
+			Func:     exportCmd,
+		},
+		{
+			Name:        "delete",
+			Usage:       "ume delete [options] <card_id>\nume delete [--before <date>] [--collection <name>] [--dry-run]",
+			Description: "Delete a card and all its associated data",
+			Help: `Delete a card and all its associated data (images, markdown files, and embeddings).
+
+Options:
+  -q, --quiet    Suppress confirmation and verbose output
+  --trash        Move the card to the trash instead, see "ume trash"
+  --before       Delete all cards uploaded before a date (YYYY-MM-DD) instead of a single card
+  --collection   Delete all cards in a collection instead of a single card, or only the ones
+                 uploaded before the date of --before. --tag is the same
+  --dry-run      With filters, only show the cards, their rows and objects that would be removed
+  --batch-size   With filters, number of cards deleted per transaction (default: 50)
+
+This command will:
+1. Confirm you want to delete the card (unless --quiet is specified)
+2. Delete object files from Minio storage (images and markdown)
+3. Delete the card from the database (related data is cascade deleted)`,
+			CardArgs: 1,
+			Func:     deleteCmd,
+		},
+		{
+			Name:        "resume",
+			Usage:       "ume resume [-q] <card_id|--all>",
+			Description: "Continue uploads that were interrupted",
+			Help: `Continue the upload of a card that was interrupted, from the last stage that finished.
+
+Upload records each stage of a card when it finishes: the image is uploaded, the
+markdown is extracted, and the markdown, title and embeddings are stored. Until the last
+stage the card isn't found by lookup. Resuming after the extraction doesn't run the OCR
+again. The card is processed with the options it was uploaded with.
+
+Options:
+  --all         Resume every interrupted upload, except the ones queued for ume worker
+  -q, --quiet   Don't show the stages
+
+ume verify reports the cards whose upload was interrupted.`,
+			CardArgs: 1,
+			Func:     resumeCmd,
+		},
+		{
+			Name:        "worker",
+			Usage:       "ume worker [--poll=5s] [--once]",
+			Description: "Process the jobs queued by ume upload --async",
+			Help: `Process the jobs queued by ume upload --async, one at a time.
+
+Options:
+  --poll    How often to check for new jobs when the queue is empty (default: 5s)
+  --once    Stop when the queue is empty instead of waiting for new jobs
+
+A failed job is tried again after 1, 4 and 9 minutes, then it is marked as failed and can
+be queued again with ume jobs retry. Jobs of a worker that stopped while processing them
+are picked up by another worker after 30 minutes. Several workers can run at once.
+Ctrl+C stops the worker after the current job.`,
+			Func: workerCmd,
+		},
+		{
+			Name:        "daemon",
+			Usage:       "ume daemon",
+			Description: "Keep connections open so ume lookup is faster",
+			Help: `Keep the database and OpenAI connections open in the background, so ume lookup
+doesn't connect to them on every search.
+
+While the daemon is running, ume lookup sends its searches to it over a unix socket
+that only the user can access. The socket is daemon/daemon.sock in the cache directory,
+which is made private, or UME_DAEMON_SOCKET, in a directory only the user can access
+(chmod 700). Without the daemon, ume lookup searches by itself as before.
+
+The daemon searches with the environment it was started with. Restart it after
+changing DB_STRING, OPENAI_KEY or other settings. UME_API_KEY is sent with every
+search, so each search still only finds the cards of the user running ume lookup.
+Ctrl+C stops the daemon.`,
+			Func: daemonCmd,
+		},
+		{
+			Name:        "cache",
+			Usage:       "ume cache <stats|clear>",
+			Description: "Show or clear the local caches",
+			Help: `Manage the local caches in the cache directory, ~/.cache/umesao or UME_CACHE_DIR.
+
+Markdown and translations downloaded from Minio are kept by their hash, and card images
+by their name and ETag, so show, cat and edit only download them once and can show them
+offline.
+The embeddings of search queries are kept for UME_QUERY_CACHE_TTL.`,
+			Subcommands: []*Command{
+				{
+					Name:        "stats",
+					Usage:       "ume cache stats",
+					Description: "Show the number and size of the cached files",
+					Func:        cacheStatsCmd,
+				},
+				{
+					Name:        "clear",
+					Usage:       "ume cache clear",
+					Description: "Remove the cached files",
+					Help: `Remove the cached markdown, images and query embeddings. They are downloaded or
+embedded again when they are needed. Images of cards uploaded offline are kept until
+ume worker uploads them.`,
+					Func: cacheClearCmd,
+				},
+			},
+		},
+		{
+			Name:        "jobs",
+			Usage:       "ume jobs <list|retry> [options]",
+			Description: "List and retry the jobs processed by ume worker",
+			Help:        `Manage the jobs queued by ume upload --async and processed by ume worker.`,
+			Subcommands: []*Command{
+				{
+					Name:        "list",
+					Usage:       "ume jobs list [--status=queued|running|done|failed] [--limit=20]",
+					Description: "List the latest jobs with their status",
+					Help: `List the latest jobs with their status, attempts and last error.
+
+Options:
+  --status   Only list the jobs with this status: queued, running, done or failed
+  --limit    Maximum number of jobs to list (default: 20)`,
+					Func: jobsListCmd,
+				},
+				{
+					Name:        "retry",
+					Usage:       "ume jobs retry [job_id]",
+					Description: "Queue failed jobs again",
+					Help:        `Queue a failed job again with all its attempts, or every failed job without a job ID.`,
+					Func:        jobsRetryCmd,
+				},
+			},
+		},
+		{
+			Name:        "trash",
+			Usage:       "ume trash <list|restore|empty> [options]",
+			Description: "List, restore or permanently delete trashed cards",
+			Help: `Manage cards moved to the trash with "ume delete --trash".
+
+Cards in the trash are excluded from lookup, list, related, map and review.`,
+			Subcommands: []*Command{
+				{
+					Name:        "list",
+					Usage:       "ume trash list",
+					Description: "List the cards in the trash",
+					Func:        trashListCmd,
+				},
+				{
+					Name:        "restore",
+					Usage:       "ume trash restore <card_id>",
+					Description: "Move a card out of the trash",
+					CardArgs:    1,
+					Func:        trashRestoreCmd,
+				},
+				{
+					Name:        "empty",
+					Usage:       "ume trash empty [-q]",
+					Description: "Permanently delete all cards in the trash",
+					Help: `Permanently delete all cards in the trash.
+
+Options:
+  -q, --quiet    Suppress confirmation and verbose output`,
+					Func: trashEmptyCmd,
+				},
+			},
+		},
+		{
+			Name:        "completion",
+			Usage:       "ume completion <bash|zsh|fish>",
+			Description: "Print a shell completion script",
+			Help: `Print a shell completion script.
+
+Commands, card IDs with their titles and collection names are completed.
+Card IDs and collections are read from the database, which is given up on after half a second.
+
+Setup:
+  bash    Add to ~/.bashrc: source <(ume completion bash)
+  zsh     Add to ~/.zshrc: source <(ume completion zsh)
+  fish    ume completion fish > ~/.config/fish/completions/ume.fish`,
+			Func: completionCmd,
+		},
+		{
+			Name:        "help",
+			Usage:       "ume help [command] [subcommand]",
+			Description: "Show help information",
+			Func:        helpCmd,
+		},
+	}
+	setCommandIDs(commands, "")
+}
+
+// findCommand returns the command with the name, or nil if there is none
+func findCommand(commands []*Command, name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// run runs the command, or the subcommand named by its second argument. -h and --help
+// print the help of the command instead.
+func (c *Command) run(args []string) error {
+	if len(args) > 1 && (args[1] == "-h" || args[1] == "--help") {
+		c.printHelp()
+		return nil
+	}
+
+	if len(c.Subcommands) == 0 {
+		return c.Func(args)
+	}
+
+	if len(args) < 2 {
+		return usageError{common.T(msgUsageError, c.Usage)}
+	}
+	sub := findCommand(c.Subcommands, args[1])
+	if sub == nil {
+		return usageError{common.T(msgUnknownSubcmd, c.Name, args[1])}
+	}
+	return sub.run(args[1:])
+}
+
+// printHelp prints the usage and help of the command, and lists its subcommands
+func (c *Command) printHelp() {
+	for i, line := range strings.Split(c.Usage, "\n") {
+		if i == 0 {
+			fmt.Println(common.T(msgHelpCommandUsage, line))
+		} else {
+			fmt.Println(common.T(msgHelpCommandUsageEx, line))
+		}
+	}
+
+	if c.Help != "" {
+		fmt.Printf("\n%s\n", common.T(common.Message{ID: "command." + c.id + ".help", Other: c.Help}))
+	} else {
+		fmt.Printf("\n%s.\n", strings.TrimSuffix(c.description(), "。"))
+	}
+
+	if len(c.Subcommands) > 0 {
+		fmt.Println("\n" + common.T(msgHelpCommands))
+		for _, sub := range c.Subcommands {
+			fmt.Printf("  %-10s %s\n", sub.Name, sub.description())
+		}
+	}
+}
+
+// description returns the description of the command in the language of the user
+func (c *Command) description() string {
+	return common.T(common.Message{ID: "command." + c.id + ".description", Other: c.Description})
+}
+
+// setCommandIDs sets the message IDs of commands and their subcommands, their names
+// joined by dots after the ID of their parent
+func setCommandIDs(commands []*Command, parent string) {
+	for _, cmd := range commands {
+		cmd.id = parent + cmd.Name
+		setCommandIDs(cmd.Subcommands, cmd.id+".")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// ocrComparison is the result of extracting the text of an image with one method
+type ocrComparison struct {
+	extraction
+	Duration time.Duration
+	Err      error
+}
+
+// comparedResult is a result rendered by the compare template
+type comparedResult struct {
+	Number  int
+	Method  common.Method
+	Summary string
+	Content template.HTML
+	Error   string
+}
+
+// summary describes how long extracting the result took, and the quality of the OCR
+// result when it has confidences
+func (c ocrComparison) summary() string {
+	summary := c.Duration.Round(100 * time.Millisecond).String()
+	if parsed, err := common.ParseOCRResult(c.OCRResult); err == nil {
+		if quality, ok := parsed.Quality(); ok {
+			summary += fmt.Sprintf(", quality %.2f", quality)
+		}
+	}
+	return summary
+}
+
+// compareOCRImpl implements the compare-ocr command functionality. The text of the image
+// is extracted with each of methods, or with every configured method if none are given,
+// and the markdown of each is shown side by side, or in the browser with web. The result
+// that is picked is kept as a new card.
+func compareOCRImpl(filePath string, methods []common.Method, language string, handwriting, web bool) error {
+	if _, err := os.Stat(filePath); err != nil {
+		return fmt.Errorf("error accessing file: %w", err)
+	}
+
+	if len(methods) == 0 {
+		methods = common.ConfiguredImageMethods()
+	}
+	if len(methods) == 0 {
+		return fmt.Errorf("no OCR providers are configured, set OPENAI_KEY with AZURE_ENDPOINT and AZURE_KEY or MISTRAL_KEY")
+	}
+
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	// A method that fails is shown with its error, so the others can still be compared
+	progress := common.NewProgress(false)
+	results := make([]ocrComparison, 0, len(methods))
+	succeeded := 0
+	for _, method := range methods {
+		progress.Stage(fmt.Sprintf("Extracting text with %s", method))
+		start := time.Now()
+		content, ocrResult, err := common.ExtractMarkdown(filePath, method, language, openaiKey, handwriting, nil)
+		results = append(results, ocrComparison{
+			extraction: extraction{Method: method, Content: content, OCRResult: ocrResult},
+			Duration:   time.Since(start),
+			Err:        err,
+		})
+		if err == nil {
+			succeeded++
+		}
+	}
+	progress.Done()
+
+	if succeeded == 0 {
+		return fmt.Errorf("text could not be extracted with any method: %w", results[0].Err)
+	}
+
+	if web {
+		if err := serveComparison(filePath, results); err != nil {
+			return err
+		}
+	} else {
+		printComparison(results)
+	}
+
+	result, ok, err := promptComparison(results)
+	if err != nil || !ok {
+		return err
+	}
+
+	// The language is only used by the ocr method, like with ume upload
+	job := uploadJob{Method: result.Method, Handwriting: handwriting}
+	if result.Method == common.MethodOCR {
+		job.Language = language
+	}
+	if _, err := uploadCard(filePath, job, &result.extraction, false, false); err != nil {
+		return err
+	}
+	fmt.Printf("To extract text with %s by default, upload with: ume upload --method=%s\n", result.Method, result.Method)
+	return nil
+}
+
+// printComparison prints the markdown of the results side by side, in columns that fit the
+// terminal
+func printComparison(results []ocrComparison) {
+	_, cols := terminalSize()
+	width := max((cols-3*(len(results)-1))/len(results), 10)
+
+	headers := make([]string, len(results))
+	contents := make([]string, len(results))
+	for i, result := range results {
+		headers[i] = fmt.Sprintf("%d. %s (%s)", i+1, result.Method, result.summary())
+		contents[i] = result.Content
+		if result.Err != nil {
+			headers[i] = fmt.Sprintf("%d. %s (failed)", i+1, result.Method)
+			contents[i] = result.Err.Error()
+		}
+	}
+
+	separators := make([]string, len(results))
+	for i := range separators {
+		separators[i] = strings.Repeat("-", width)
+	}
+
+	fmt.Println()
+	fmt.Print(common.Columns(headers, width))
+	fmt.Println(strings.Join(separators, "-+-"))
+	fmt.Print(common.Columns(contents, width))
+	fmt.Println()
+}
+
+// serveComparison shows the image next to the rendered markdown of the results in the
+// browser, until Enter is pressed
+func serveComparison(filePath string, results []ocrComparison) error {
+	rendered := make([]comparedResult, len(results))
+	for i, result := range results {
+		rendered[i] = comparedResult{Number: i + 1, Method: result.Method, Summary: result.summary()}
+		if result.Err != nil {
+			rendered[i].Error = result.Err.Error()
+			continue
+		}
+		content, err := common.RenderMarkdown(result.Content)
+		if err != nil {
+			return err
+		}
+		rendered[i].Content = content
+	}
+
+	mux := newWebMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		renderTemplate(w, "compare.html", rendered)
+	})
+	mux.HandleFunc("GET /image", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filePath)
+	})
+	return serveUntilEnter(mux, "/")
+}
+
+// promptComparison asks which result to keep as a new card, and reports whether one was
+// picked. Without a terminal nothing is kept.
+func promptComparison(results []ocrComparison) (ocrComparison, bool, error) {
+	if !common.CanPrompt() {
+		return ocrComparison{}, false, nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Keep which result as a new card (1-%d), or none (Enter)? ", len(results))
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return ocrComparison{}, false, fmt.Errorf("error reading input: %w", err)
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			fmt.Println("Nothing was kept.")
+			return ocrComparison{}, false, nil
+		}
+		n, err := strconv.Atoi(input)
+		if err != nil || n < 1 || n > len(results) {
+			fmt.Printf("Please enter a number from 1 to %d.\n", len(results))
+			continue
+		}
+		if results[n-1].Err != nil {
+			fmt.Printf("%s failed, pick another result.\n", results[n-1].Method)
+			continue
+		}
+		return results[n-1], true, nil
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// completionTimeout bounds the database queries made while completing, so a
+// slow or unreachable database doesn't block the shell
+const completionTimeout = 500 * time.Millisecond
+
+// completionScripts are the completion scripts for each shell. They pass the words
+// of the command line to ume __complete and fall back to file names without candidates.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for ume
+# Add to ~/.bashrc: source <(ume completion bash)
+_ume() {
+    local IFS=$'\n'
+    local candidates
+    candidates=$(ume __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | cut -f1)
+    COMPREPLY=($(compgen -W "$candidates" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+complete -o default -F _ume ume
+`,
+	"zsh": `#compdef ume
+# zsh completion for ume
+# Add to ~/.zshrc: source <(ume completion zsh)
+_ume() {
+    local -a candidates
+    candidates=("${(@f)$(ume __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    candidates=("${(@)candidates:#}")
+    if (( ${#candidates} )); then
+        candidates=("${(@)candidates//:/\\:}")
+        candidates=("${(@)candidates//$'\t'/:}")
+        _describe 'ume' candidates
+    else
+        _files
+    fi
+}
+if [ "$funcstack[1]" = "_ume" ]; then
+    _ume "$@"
+else
+    compdef _ume ume
+fi
+`,
+	"fish": `# fish completion for ume
+# Save as ~/.config/fish/completions/ume.fish: ume completion fish > ~/.config/fish/completions/ume.fish
+function __ume_complete
+    set -l words (commandline -opc)
+    set -e words[1]
+    set -l current (commandline -ct)
+    set -l candidates (ume __complete $words "$current" 2>/dev/null)
+    if test (count $candidates) -gt 0
+        printf '%s\n' $candidates
+    else
+        __fish_complete_path (commandline -ct)
+    end
+end
+complete -c ume -f -a '(__ume_complete)'
+`,
+}
+
+// completionImpl prints the completion script for a shell
+func completionImpl(shell string) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell: %s. Must be one of 'bash', 'zsh' or 'fish'", shell)
+	}
+
+	fmt.Print(script)
+	return nil
+}
+
+// completeImpl prints the completion candidates for the words of a command line, one
+// per line with an optional description after a tab. The last word is the one being
+// completed. Nothing is printed when there are no candidates, so the shell completes
+// file names instead.
+func completeImpl(commands []*Command, words []string) error {
+	// The values of global flags are files or keys, which are not completed here
+	if len(words) > 1 && isGlobalFlag(words[len(words)-2]) {
+		return nil
+	}
+
+	words = skipGlobalFlags(words)
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+
+	// The first word is a command, or a search query
+	if len(words) == 1 {
+		printCommands(commands, current)
+		return nil
+	}
+
+	previous := words[len(words)-2]
+	args := positionalArgs(words[1 : len(words)-1])
+
+	switch {
+	case strings.HasPrefix(current, "-"):
+		// Flags are not completed
+		return nil
+	case previous == "--collection" || previous == "-c":
+		return completeCollections(current)
+	case words[0] == "help":
+		// help takes the names of a command and its subcommand
+		candidates := commands
+		for _, name := range args {
+			cmd := findCommand(candidates, name)
+			if cmd == nil {
+				return nil
+			}
+			candidates = cmd.Subcommands
+		}
+		printCommands(candidates, current)
+		return nil
+	}
+
+	cmd := findCommand(commands, words[0])
+	if cmd == nil {
+		return nil
+	}
+
+	if len(cmd.Subcommands) > 0 {
+		if len(args) == 0 {
+			printCommands(cmd.Subcommands, current)
+			return nil
+		}
+
+		sub := findCommand(cmd.Subcommands, args[0])
+		if sub == nil {
+			return nil
+		}
+		args = args[1:]
+
+		switch {
+		case cmd.Name == "collection" && (sub.Name == "add" || sub.Name == "share") && len(args) == 0:
+			return completeCollections(current)
+		case cmd.Name == "collection" && sub.Name == "add":
+			return completeCards(current, false)
+		case len(args) < sub.CardArgs:
+			return completeCards(current, cmd.Name == "trash")
+		}
+		return nil
+	}
+
+	if len(args) < cmd.CardArgs {
+		return completeCards(current, false)
+	}
+
+	return nil
+}
+
+// skipGlobalFlags removes the global flags before the command, and their values
+func skipGlobalFlags(words []string) []string {
+	for len(words) > 1 && strings.HasPrefix(words[0], "-") {
+		if isGlobalFlag(words[0]) {
+			words = words[1:]
+		}
+		words = words[1:]
+	}
+	return words
+}
+
+// isGlobalFlag reports whether a word is a global flag that takes its value from the next word
+func isGlobalFlag(word string) bool {
+	return strings.HasPrefix(word, "-") && globalFlags.Lookup(strings.TrimLeft(word, "-")) != nil
+}
+
+// printCommands prints the names of the commands that start with the word being completed
+func printCommands(commands []*Command, current string) {
+	for _, cmd := range commands {
+		printCandidate(cmd.Name, cmd.Description, current)
+	}
+}
+
+// positionalArgs returns the words that are not flags
+func positionalArgs(words []string) []string {
+	var args []string
+	for _, word := range words {
+		if !strings.HasPrefix(word, "-") {
+			args = append(args, word)
+		}
+	}
+	return args
+}
+
+// printCandidate prints a candidate if it starts with the word being completed
+func printCandidate(value, description, current string) {
+	if !strings.HasPrefix(value, current) {
+		return
+	}
+	if description == "" {
+		fmt.Println(value)
+		return
+	}
+	fmt.Printf("%s\t%s\n", value, description)
+}
+
+// completeCards prints the IDs of the cards accessible to the current user, with their
+// titles as descriptions. With trashed the cards in the trash are printed instead.
+func completeCards(current string, trashed bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	dbpool, queries, err := common.InitDBLazy()
+	if err != nil {
+		return err
+	}
+	defer dbpool.Close()
+
+	// Give up quickly if the database can't be reached
+	if err := dbpool.Ping(ctx); err != nil {
+		return err
+	}
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	if trashed {
+		cards, err := queries.ListTrashedCards(ctx, owner)
+		if err != nil {
+			return err
+		}
+		for _, card := range cards {
+			printCandidate(strconv.Itoa(int(card.ID)), card.Title, current)
+		}
+		return nil
+	}
+
+	cards, err := queries.ListCards(ctx, database.ListCardsParams{OwnerID: owner})
+	if err != nil {
+		return err
+	}
+	for _, card := range cards {
+		printCandidate(strconv.Itoa(int(card.ID)), card.Title, current)
+	}
+
+	// Aliases are completed along with the IDs
+	aliases, err := queries.ListCardAliases(ctx, owner)
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		printCandidate(alias.Alias, alias.Title, current)
+	}
+	return nil
+}
+
+// completeCollections prints the names of the collections accessible to the current user
+func completeCollections(current string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	dbpool, queries, err := common.InitDBLazy()
+	if err != nil {
+		return err
+	}
+	defer dbpool.Close()
+
+	// Give up quickly if the database can't be reached
+	if err := dbpool.Ping(ctx); err != nil {
+		return err
+	}
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	collections, err := queries.ListCollections(ctx, owner)
+	if err != nil {
+		return err
+	}
+	for _, collection := range collections {
+		printCandidate(collection.Name, fmt.Sprintf("%d cards", collection.Cards), current)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// composeImpl implements the compose command functionality. The latest markdown of the
+// cards is assembled in their order into a draft document, which is stored as a document.
+// Without card IDs the cards of the collection are used. With arrange the cards are listed
+// in the editor first, to reorder them or leave some out, and with smooth the chat model
+// connects the sections. With dryRun the draft is only printed.
+func composeImpl(cardIDs []int, collection, title string, arrange, smooth, dryRun bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	if len(cardIDs) == 0 {
+		collectionID, err := resolveCollection(queries, owner, collection)
+		if err != nil {
+			return err
+		}
+		if !collectionID.Valid {
+			return fmt.Errorf("no cards to compose, give card IDs or a collection")
+		}
+		cards, err := queries.ListCards(context.Background(), database.ListCardsParams{OwnerID: owner, CollectionID: collectionID})
+		if err != nil {
+			return fmt.Errorf("error listing cards: %w", err)
+		}
+		for _, card := range cards {
+			cardIDs = append(cardIDs, int(card.ID))
+		}
+		if len(cardIDs) == 0 {
+			return fmt.Errorf("collection \"%s\" has no cards to compose", collection)
+		}
+	}
+
+	cards, err := composedCards(queries, owner, cardIDs)
+	if err != nil {
+		return err
+	}
+
+	if arrange {
+		cards, err = arrangeCards(cards)
+		if err != nil {
+			return err
+		}
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	versions := make([]int32, len(cards))
+	for i := range cards {
+		versions[i], cards[i].Content, err = latestMarkdown(queries, minioClient, cards[i].CardID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if title == "" {
+		title = collection
+	}
+	if title == "" {
+		title = cards[0].Title
+	}
+	document := common.ComposeDocument(title, cards)
+
+	if smooth {
+		client, err := common.NewOpenAIClient()
+		if err != nil {
+			return fmt.Errorf("error creating OpenAI client: %w", err)
+		}
+		document, err = client.SmoothTransitions(document)
+		if err != nil {
+			return fmt.Errorf("error smoothing the transitions: %w", err)
+		}
+	}
+
+	if dryRun {
+		fmt.Print(document)
+		return nil
+	}
+
+	// The document is stored with the cards it was composed from, or not at all
+	tx, err := dbpool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+	qtx := queries.WithTx(tx)
+
+	documentID, err := qtx.CreateDocument(context.Background(), database.CreateDocumentParams{
+		Title:    title,
+		OwnerID:  owner,
+		Content:  document,
+		Smoothed: smooth,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating document: %w", err)
+	}
+
+	for i, card := range cards {
+		err = qtx.AddDocumentCard(context.Background(), database.AddDocumentCardParams{
+			DocumentID: documentID,
+			Position:   int32(i),
+			CardID:     card.CardID,
+			Ver:        versions[i],
+		})
+		if err != nil {
+			return fmt.Errorf("error adding card %d to document: %w", card.CardID, err)
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("error committing document: %w", err)
+	}
+
+	fmt.Printf("Composed document %d \"%s\" from %d cards\n", documentID, title, len(cards))
+	fmt.Printf("Read it with: ume documents cat %d\n", documentID)
+	return nil
+}
+
+// composedCards returns the cards to compose with their titles, checking that each one
+// can be read by the owner and isn't in the trash
+func composedCards(queries *database.Queries, owner pgtype.Int4, cardIDs []int) ([]common.ComposedCard, error) {
+	seen := make(map[int]bool)
+	var cards []common.ComposedCard
+	for _, cardID := range cardIDs {
+		if seen[cardID] {
+			return nil, fmt.Errorf("card %d is listed twice", cardID)
+		}
+		seen[cardID] = true
+
+		// Users can only compose the cards they can see
+		if owner.Valid {
+			ok, err := queries.CanAccessCard(context.Background(), database.CanAccessCardParams{
+				CardID: int32(cardID),
+				UserID: owner.Int32,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error checking access to card %d: %w", cardID, err)
+			}
+			if !ok {
+				return nil, &common.CardError{CardID: int32(cardID)}
+			}
+		}
+
+		title, err := queries.GetCardTitle(context.Background(), int32(cardID))
+		if err != nil {
+			return nil, &common.CardError{CardID: int32(cardID), Err: err}
+		}
+
+		trashed, err := isTrashed(queries, int32(cardID))
+		if err != nil {
+			return nil, err
+		}
+		if trashed {
+			return nil, fmt.Errorf("card %d is in the trash, restore it first with: ume trash restore %d", cardID, cardID)
+		}
+
+		cards = append(cards, common.ComposedCard{CardID: int32(cardID), Title: title})
+	}
+	return cards, nil
+}
+
+// arrangeCards lists the cards in the editor, one per line, and returns them in the order
+// of the lines that are left. Like spreading cards on a desk, lines can be moved around
+// and removed.
+func arrangeCards(cards []common.ComposedCard) ([]common.ComposedCard, error) {
+	var b strings.Builder
+	b.WriteString("# Order the cards of the document, one per line. Remove a line to leave the card out.\n")
+	for _, card := range cards {
+		fmt.Fprintf(&b, "%d %s\n", card.CardID, card.Title)
+	}
+
+	tempFile, err := common.WriteTempFile(common.TempPrefix+"compose_*.txt", []byte(b.String()))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempFile)
+
+	if err := openInEditor(tempFile); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(tempFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading temporary file: %w", err)
+	}
+	defer file.Close()
+
+	byID := make(map[int32]common.ComposedCard)
+	for _, card := range cards {
+		byID[card.CardID] = card
+	}
+
+	var arranged []common.ComposedCard
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		cardID, err := common.ParseCardIDString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid card ID in line \"%s\": %w", scanner.Text(), err)
+		}
+		card, ok := byID[int32(cardID)]
+		if !ok {
+			return nil, fmt.Errorf("card %d is not one of the cards to compose, or is listed twice", cardID)
+		}
+		delete(byID, int32(cardID))
+		arranged = append(arranged, card)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading temporary file: %w", err)
+	}
+
+	if len(arranged) == 0 {
+		return nil, fmt.Errorf("no cards left, the document was not composed")
+	}
+	return arranged, nil
+}
+
+// documentsListImpl lists the documents composed by ume compose
+func documentsListImpl() error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	documents, err := queries.ListDocuments(context.Background(), owner)
+	if err != nil {
+		return fmt.Errorf("error listing documents: %w", err)
+	}
+
+	if len(documents) == 0 {
+		fmt.Println("No documents found. Compose one with: ume compose <card_id>...")
+		return nil
+	}
+
+	fmt.Println("Doc\tCards\tCreated\t\tTitle")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, document := range documents {
+		title := document.Title
+		if document.Smoothed {
+			title += " (smoothed)"
+		}
+		fmt.Printf("%3d\t%5d\t%s\t%s\n", document.ID, document.Cards, document.CreatedAt.Time.Local().Format("2006-01-02"), title)
+	}
+	return nil
+}
+
+// findDocument returns a document the owner can read
+func findDocument(queries *database.Queries, owner pgtype.Int4, documentID int) (database.GetDocumentRow, error) {
+	document, err := queries.GetDocument(context.Background(), int32(documentID))
+	if err != nil {
+		return database.GetDocumentRow{}, fmt.Errorf("document %d not found: %w", documentID, err)
+	}
+	if owner.Valid && document.OwnerID.Valid && document.OwnerID.Int32 != owner.Int32 {
+		return database.GetDocumentRow{}, fmt.Errorf("document %d not found: %w", documentID, pgx.ErrNoRows)
+	}
+	return document, nil
+}
+
+// documentsCatImpl prints the markdown of a document, through the pager on a terminal
+func documentsCatImpl(documentID int) error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	document, err := findDocument(queries, owner, documentID)
+	if err != nil {
+		return err
+	}
+	return pageText(document.Content)
+}
+
+// documentsCardsImpl lists the cards a document was composed from, in order, with the
+// version of each that was used
+func documentsCardsImpl(documentID int) error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	if _, err := findDocument(queries, owner, documentID); err != nil {
+		return err
+	}
+
+	cards, err := queries.ListDocumentCards(context.Background(), int32(documentID))
+	if err != nil {
+		return fmt.Errorf("error listing the cards of document %d: %w", documentID, err)
+	}
+
+	fmt.Println("#\tCard\tVer\tTitle")
+	fmt.Println("------------------------------------------------------------------------------")
+	for i, card := range cards {
+		fmt.Printf("%2d\t%4d\t%2d\t%s\n", i+1, card.CardID, card.Ver, card.Title)
+	}
+	return nil
+}
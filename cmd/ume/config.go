@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// configSetSecretImpl reads a secret from the terminal or standard input and stores it
+// in the OS keychain
+func configSetSecretImpl(name string) error {
+	value, err := readSecret(fmt.Sprintf("Value of %s: ", name))
+	if err != nil {
+		return fmt.Errorf("error reading the value of %s: %w", name, err)
+	}
+
+	if err := common.SetSecret(name, value); err != nil {
+		return err
+	}
+
+	fmt.Printf("Stored %s in the keychain\n", name)
+	if os.Getenv(name) != "" {
+		fmt.Printf("Note: %s is also set in the environment or .env, which takes precedence\n", name)
+	}
+	return nil
+}
+
+// configDeleteSecretImpl removes a secret from the OS keychain
+func configDeleteSecretImpl(name string) error {
+	if err := common.DeleteSecret(name); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %s from the keychain\n", name)
+	return nil
+}
+
+// readSecret reads a line without echoing it when standard input is a terminal, so the
+// secret isn't left on the screen or in the shell history
+func readSecret(prompt string) (string, error) {
+	stat, err := os.Stdin.Stat()
+	terminal := err == nil && stat.Mode()&os.ModeCharDevice != 0
+
+	if terminal && common.NoInput {
+		return "", fmt.Errorf("%w: pipe the secret to standard input", common.ErrInputRequired)
+	}
+	if terminal {
+		fmt.Print(prompt)
+		if runtime.GOOS != "windows" {
+			setEcho(false)
+			defer func() {
+				setEcho(true)
+				fmt.Println()
+			}()
+		}
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// setEcho turns echoing of the terminal on or off with stty
+func setEcho(on bool) {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	cmd.Run()
+}
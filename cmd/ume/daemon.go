@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// errNoDaemon is returned by daemonLookup when no daemon is listening, so the search is
+// done without it
+var errNoDaemon = errors.New("ume daemon is not running")
+
+// daemonSocketPath returns the unix socket the daemon listens on, set with
+// UME_DAEMON_SOCKET, or daemon.sock in the daemon directory of the cache directory
+func daemonSocketPath() (string, error) {
+	if path := os.Getenv("UME_DAEMON_SOCKET"); path != "" {
+		return path, nil
+	}
+	dir, err := common.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "daemon", "daemon.sock"), nil
+}
+
+// makeSocketDir creates the directory of the socket only the user can access. A
+// directory only the daemon uses is restricted even if it already existed, others are
+// left as they are and checked by checkPrivateDir.
+func makeSocketDir(dir string, dedicated bool) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating socket directory: %w", err)
+	}
+	if dedicated && runtime.GOOS != "windows" {
+		if err := os.Chmod(dir, 0o700); err != nil {
+			return fmt.Errorf("error restricting access to socket directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// daemonClient returns a client that sends its requests to the daemon on a socket
+func daemonClient(path string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+// checkPrivateDir returns an error if the directory isn't owned by the user or users
+// other than the owner can access it. Windows doesn't have these permissions, so
+// directories aren't checked there.
+func checkPrivateDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("error checking socket directory: %w", err)
+	}
+	if !ownedByUser(info) {
+		return fmt.Errorf("socket directory %s is owned by another user, set UME_DAEMON_SOCKET to a socket in a directory of your own", dir)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("socket directory %s can be accessed by other users (%04o), restrict it with chmod 700 or set UME_DAEMON_SOCKET to a socket in a private directory", dir, perm)
+	}
+	return nil
+}
+
+// daemonImpl implements the daemon command functionality. The daemon keeps a pool of
+// database connections and the connections to OpenAI open, and searches for ume lookup
+// over a unix socket only the user can access, until it is interrupted.
+func daemonImpl() error {
+	path, err := daemonSocketPath()
+	if err != nil {
+		return err
+	}
+
+	// A socket left behind by a daemon that didn't stop cleanly is replaced
+	if _, err := daemonClient(path, time.Second).Get("http://ume/health"); err == nil {
+		return fmt.Errorf("ume daemon is already running on %s", path)
+	}
+	os.Remove(path)
+
+	if err := makeSocketDir(filepath.Dir(path), os.Getenv("UME_DAEMON_SOCKET") == ""); err != nil {
+		return err
+	}
+	// The socket is created with the permissions of the umask before it is restricted,
+	// so it is only created in a directory other users can't enter
+	if err := checkPrivateDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", path, err)
+	}
+	defer os.Remove(path)
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return fmt.Errorf("error restricting access to %s: %w", path, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /lookup", func(w http.ResponseWriter, r *http.Request) {
+		var req lookupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("error decoding lookup request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		response, err := lookupSearch(queries, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Printf("Searched for \"%s\" in %v\n", req.Query, time.Since(start).Round(time.Millisecond))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	fmt.Printf("Listening on %s, press Ctrl+C to stop\n", path)
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving lookups: %w", err)
+	}
+	return nil
+}
+
+// daemonLookup delegates a search to the daemon. It returns errNoDaemon when no daemon
+// is listening, and the error of the search otherwise.
+func daemonLookup(req lookupRequest) (lookupResponse, error) {
+	// Offline the search is done here, as the daemon would embed the query with OpenAI
+	if common.Offline {
+		return lookupResponse{}, errNoDaemon
+	}
+
+	path, err := daemonSocketPath()
+	if err != nil {
+		return lookupResponse{}, errNoDaemon
+	}
+	if _, err := os.Stat(path); err != nil {
+		return lookupResponse{}, errNoDaemon
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return lookupResponse{}, fmt.Errorf("error encoding lookup request: %w", err)
+	}
+
+	// A socket that can't be connected to was left behind by a daemon that stopped
+	resp, err := daemonClient(path, common.DefaultHTTPTimeout).Post("http://ume/lookup", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return lookupResponse{}, errNoDaemon
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return lookupResponse{}, errors.New(strings.TrimSpace(string(message)))
+	}
+
+	var response lookupResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return lookupResponse{}, fmt.Errorf("error decoding lookup response: %w", err)
+	}
+	return response, nil
+}
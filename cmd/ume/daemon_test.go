@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestCheckPrivateDir tests that the daemon only creates its socket in a directory
+// other users can't access
+func TestCheckPrivateDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test because Windows doesn't have directory permissions")
+	}
+
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatalf("Error changing permissions: %v", err)
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		t.Errorf("Expected no error for a private directory, got: %v", err)
+	}
+
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatalf("Error changing permissions: %v", err)
+	}
+	if err := checkPrivateDir(dir); err == nil {
+		t.Error("Expected an error for a directory other users can enter")
+	}
+}
+
+// TestMakeSocketDir tests that the directory of the default socket is made private even
+// if it already existed, like a cache directory created with 0755
+func TestMakeSocketDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test because Windows doesn't have directory permissions")
+	}
+
+	dir := filepath.Join(t.TempDir(), "daemon")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatalf("Error changing permissions: %v", err)
+	}
+
+	if err := makeSocketDir(dir, true); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		t.Errorf("Expected the directory to be private, got: %v", err)
+	}
+
+	// A directory set with UME_DAEMON_SOCKET isn't changed
+	shared := t.TempDir()
+	if err := os.Chmod(shared, 0o755); err != nil {
+		t.Fatalf("Error changing permissions: %v", err)
+	}
+	if err := makeSocketDir(shared, false); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := checkPrivateDir(shared); err == nil {
+		t.Error("Expected an error for a directory other users can enter")
+	}
+}
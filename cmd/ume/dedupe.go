@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// dedupeImpl implements the dedupe command functionality. It shows pairs of cards
+// whose embeddings are within maxDistance side by side, and lets the user merge
+// them or move one of them to the trash.
+func dedupeImpl(maxDistance float64, width int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	// Merged cards are embedded again
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	embeddingModel, err := common.CurrentEmbeddingModel()
+	if err != nil {
+		return err
+	}
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	pairs, err := queries.ListDuplicateCards(context.Background(), database.ListDuplicateCardsParams{
+		Model:       embeddingModel.Name,
+		OwnerID:     owner,
+		MaxDistance: float32(maxDistance),
+	})
+	if err != nil {
+		return fmt.Errorf("error searching duplicate cards: %w", err)
+	}
+
+	if len(pairs) == 0 {
+		fmt.Printf("No duplicate cards found within a distance of %.3f.\n", maxDistance)
+		return nil
+	}
+
+	fmt.Printf("Found %d pairs of possible duplicates\n", len(pairs))
+
+	// Without a terminal the pairs are only listed, as if each was skipped
+	if !common.CanPrompt() {
+		for _, pair := range pairs {
+			fmt.Printf("  %d and %d, distance %.3f\n", pair.CardIDA, pair.CardIDB, pair.Distance)
+		}
+		return nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	// Cards that were merged or trashed are skipped in the remaining pairs
+	gone := make(map[int32]bool)
+	resolved := 0
+	for i, pair := range pairs {
+		if gone[pair.CardIDA] || gone[pair.CardIDB] {
+			continue
+		}
+
+		a, b := pair.CardIDA, pair.CardIDB
+		if err := showDuplicatePair(queries, minioClient, a, b, width); err != nil {
+			return err
+		}
+		fmt.Printf("[%d/%d] Distance %.3f\n", i+1, len(pairs), pair.Distance)
+
+		action, err := promptDedupeAction(reader, a, b)
+		if err != nil {
+			return err
+		}
+
+		switch action {
+		case "q":
+			fmt.Printf("\nResolved %d pairs\n", resolved)
+			return nil
+		case "s":
+			continue
+		case "m":
+			version, err := mergeCards(dbpool, queries, minioClient, openaiKey, a, b)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Merged card %d into card %d as version %d\n", b, a, version)
+			gone[b] = true
+		case "d":
+			if err := trashCard(queries, minioClient, b, true); err != nil {
+				return err
+			}
+			gone[b] = true
+		}
+		resolved++
+	}
+
+	fmt.Printf("\nResolved %d pairs\n", resolved)
+	return nil
+}
+
+// showDuplicatePair prints the titles and the latest markdown of two cards side by side
+func showDuplicatePair(queries *database.Queries, minioClient *common.MinioClient, a, b int32, width int) error {
+	titleA, err := queries.GetCardTitle(context.Background(), a)
+	if err != nil {
+		return &common.CardError{CardID: a, Err: err}
+	}
+	titleB, err := queries.GetCardTitle(context.Background(), b)
+	if err != nil {
+		return &common.CardError{CardID: b, Err: err}
+	}
+
+	_, contentA, err := latestMarkdown(queries, minioClient, a)
+	if err != nil {
+		return err
+	}
+	_, contentB, err := latestMarkdown(queries, minioClient, b)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Print(common.SideBySide(fmt.Sprintf("Card %d: %s", a, titleA), fmt.Sprintf("Card %d: %s", b, titleB), width))
+	fmt.Println(strings.Repeat("-", width) + "-+-" + strings.Repeat("-", width))
+	fmt.Print(common.SideBySide(contentA, contentB, width))
+	return nil
+}
+
+// promptDedupeAction asks what to do with a pair of cards until a valid action is entered.
+// It returns m to merge b into a, d to move b to the trash, s to skip and q to quit.
+func promptDedupeAction(reader *bufio.Reader, a, b int32) (string, error) {
+	for {
+		fmt.Printf("Merge %d into %d (m), move %d to the trash (d), skip (s) or quit (q)? ", b, a, b)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("error reading input: %w", err)
+		}
+
+		input = strings.TrimSpace(strings.ToLower(input))
+		switch input {
+		case "m", "merge":
+			return "m", nil
+		case "d", "delete":
+			return "d", nil
+		case "s", "skip", "":
+			return "s", nil
+		case "q", "quit":
+			return "q", nil
+		}
+		fmt.Println("Please enter m, d, s or q.")
+	}
+}
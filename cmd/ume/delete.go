@@ -1,106 +1,82 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"os"
-	"strings"
 
 	"github.com/yasushisakai/umesao/pkg/common"
 )
 
-// deleteImpl implements the delete command functionality
-func deleteImpl(cardID int, quiet bool) error {
+// deleteImpl implements the delete command functionality.
+// If trash is set the card is moved to the trash instead of being deleted.
+func deleteImpl(cardID int, quiet, trash bool) error {
 	// Initialize database connection
 	dbpool, queries, err := common.InitDB()
 	if err != nil {
-		return fmt.Errorf("error initializing database: %v", err)
+		return fmt.Errorf("error initializing database: %w", err)
 	}
 	defer dbpool.Close()
 
-	// Display card information before deletion to confirm
-	if !quiet {
-		fmt.Printf("You are about to delete card %d and all associated data.\n", cardID)
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
 	}
 
-	// Try to get the image info for this card
-	imageInfo, err := queries.GetCardImage(context.Background(), int32(cardID))
-	if err == nil {
-		if !quiet {
-			fmt.Printf("Card %d has image: %s (method: %s)\n", cardID, imageInfo.Filename, imageInfo.Method)
-		}
-	} else {
-		fmt.Printf("Note: Could not find image for card %d: %v\n", cardID, err)
+	// Make sure the card exists
+	title, err := queries.GetCardTitle(context.Background(), int32(cardID))
+	if err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	// Initialize Minio client to delete files
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
 	}
 
-	// Try to get the latest markdown version for the card
-	latestVersion, err := queries.GetLatestMarkdownVersion(context.Background(), int32(cardID))
-	if err == nil {
-		if !quiet {
-			fmt.Printf("Card %d has markdown version: %d\n", cardID, latestVersion)
+	// Enumerate every object recorded for the card
+	objects, err := common.ListCardObjects(queries, minioClient.ImageBucket, minioClient.MarkdownBucket, minioClient.OCRBucket, minioClient.AttachmentBucket, int32(cardID))
+	if err != nil {
+		return err
+	}
+
+	// Display card information before deletion to confirm
+	if !quiet {
+		if trash {
+			fmt.Println(common.T(msgTrashCard, cardID, title))
+		} else {
+			fmt.Println(common.T(msgDeleteCard, cardID, title))
+		}
+		for _, object := range objects {
+			fmt.Printf("  %s/%s\n", object.Bucket, object.Name)
 		}
-	} else {
-		fmt.Printf("Note: Could not find markdown for card %d: %v\n", cardID, err)
 	}
 
 	// Ask for confirmation, if quiet is on, assume yes
 	if !quiet {
-		fmt.Print("Are you sure you want to delete this card? (y/n): ")
-		reader := bufio.NewReader(os.Stdin)
-		input, err := reader.ReadString('\n')
+		ok, err := confirm(common.T(msgDeleteConfirm), "--quiet")
 		if err != nil {
-			return fmt.Errorf("error reading input: %v", err)
+			return err
 		}
-
-		// Check user confirmation
-		input = strings.TrimSpace(strings.ToLower(input))
-		if input != "y" && input != "yes" {
-			fmt.Println("Deletion cancelled.")
+		if !ok {
+			fmt.Println(common.T(msgDeleteCancelled))
 			return nil
 		}
 	}
 
-	// Initialize Minio client to delete files
-	minioClient, err := common.NewMinioClient()
-	if err != nil {
-		return fmt.Errorf("error initializing Minio client: %v", err)
+	if trash {
+		return trashCard(queries, minioClient, int32(cardID), quiet)
 	}
 
-	// Try to delete image file if it exists
-	if imageInfo.Filename != "" {
-		if !quiet {
-			fmt.Printf("Deleting image file: %s\n", imageInfo.Filename)
-		}
-		err := minioClient.DeleteFileFromMinio(minioClient.ImageBucket, imageInfo.Filename)
-		if err != nil && !quiet {
-			fmt.Printf("Warning: Failed to delete image file %s: %v\n", imageInfo.Filename, err)
-		}
-	}
-
-	// Try to delete all markdown files for this card if any exist
-	if latestVersion > 0 {
-		if !quiet {
-			fmt.Printf("Deleting markdown files for card %d (versions 1-%d)\n", cardID, latestVersion)
-		}
-		
-		// Delete each version
-		for version := int32(1); version <= latestVersion; version++ {
-			markdownFileName := fmt.Sprintf("%d_%d.md", cardID, version)
-			err := minioClient.DeleteFileFromMinio(minioClient.MarkdownBucket, markdownFileName)
-			if err != nil && !quiet {
-				fmt.Printf("Warning: Failed to delete markdown file %s: %v\n", markdownFileName, err)
-			}
+	warnings, err := common.DeleteCardObjects(queries, minioClient, objects, int32(cardID))
+	if !quiet {
+		for _, warning := range warnings {
+			fmt.Println(common.T(msgWarning, warning))
 		}
 	}
-
-	// Delete the card (cascade deletion will take care of database records)
-	err = queries.DeleteCard(context.Background(), int32(cardID))
 	if err != nil {
-		return fmt.Errorf("error deleting card: %v", err)
+		return err
 	}
 
-	fmt.Printf("Deleted card %d and all associated data.\n", cardID)
+	fmt.Println(common.T(msgDeletedCard, cardID))
 	return nil
 }
-
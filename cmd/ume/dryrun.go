@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// dryRunUploadImpl runs text extraction, markdown conversion and chunking like uploadImpl
+// and prints the results, without storing anything in the database or Minio
+func dryRunUploadImpl(filePath string, job uploadJob) error {
+	if _, err := os.Stat(filePath); err != nil {
+		return fmt.Errorf("error accessing file: %w", err)
+	}
+
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	// With the auto method the image is classified to pick its method, like in uploads
+	progress := common.NewProgress(false)
+	job, err = classifyUpload(filePath, job, progress)
+	if err != nil {
+		progress.Done()
+		return err
+	}
+
+	chunker, err := common.ChunkerFor(job.Method)
+	if err != nil {
+		progress.Done()
+		return err
+	}
+
+	progress.Stage(fmt.Sprintf("Extracting text with %s", job.Method))
+	content, ocrResult, err := extractJob(filePath, job, openaiKey, progress.Live())
+	progress.Done()
+	if err != nil {
+		return err
+	}
+
+	if job.Normalize {
+		content = common.NormalizeMarkdown(content)
+	}
+
+	chunks, err := common.ExtractChunks(content, chunker)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Markdown:\n\n%s\n\n", content)
+
+	fmt.Printf("Chunks (%d, %s):\n", len(chunks), chunker.Name())
+	for i, chunk := range chunks {
+		fmt.Printf("%4d  %-18s  %s\n", i+1, common.ChunkLabel(chunk.Type, chunk.Page), common.Snippet(chunk.Text, 100))
+	}
+	fmt.Println()
+
+	// Only results with confidences, like the ones from Azure, have a quality
+	if parsed, err := common.ParseOCRResult(ocrResult); err == nil {
+		if quality, ok := parsed.Quality(); ok {
+			fmt.Printf("OCR quality: %.2f", quality)
+			if quality < common.OCRReviewThreshold() {
+				fmt.Print(" (would be flagged for review)")
+			}
+			fmt.Println()
+		}
+	}
+	if lang := common.DetectLanguage(content); lang != "" {
+		fmt.Printf("Language: %s\n", lang)
+	}
+
+	tokens, cost := common.EstimateEmbeddingCost(common.ChunkTexts(chunks))
+	fmt.Printf("Estimated embedding cost: %d tokens, $%.6f\n", tokens, cost)
+	fmt.Println("Dry run: nothing was stored")
+	return nil
+}
@@ -1,80 +1,131 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
 
-	"github.com/pgvector/pgvector-go"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/yasushisakai/umesao/database"
 	"github.com/yasushisakai/umesao/pkg/common"
 )
 
-// editImpl implements the edit command functionality
-func editImpl(cardID int, verbose bool) error {
+// editImpl implements the edit command functionality.
+// If version is -1 the latest version is edited, otherwise the new version
+// is branched from the given version. If normalize is set the markdown is
+// normalized before hashing, so whitespace-only edits are not saved. With stdin the new
+// content is read from standard input instead of being edited, for scripts.
+func editImpl(cardID int, version int, normalize, verbose, quiet, stdin bool) (err error) {
+	// The stages are traced when OTLP is configured
+	span := common.StartSpan("edit")
+	defer func() { span.End(err) }()
+
 	// Initialize database connection
 	dbpool, queries, err := common.InitDB()
 	if err != nil {
-		return fmt.Errorf("error initializing database: %v", err)
+		return fmt.Errorf("error initializing database: %w", err)
 	}
 	defer dbpool.Close()
 
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
+	}
+
 	// Get the latest markdown version for the card
 	latestVersion, err := queries.GetLatestMarkdownVersion(context.Background(), int32(cardID))
 	if err != nil {
-		return fmt.Errorf("error getting latest markdown version: %v", err)
+		return fmt.Errorf("error getting latest markdown version: %w", err)
+	}
+
+	// Determine which version to base the edit on
+	baseVersion := latestVersion
+	if version != -1 {
+		_, err := queries.GetMarkdownFile(context.Background(), database.GetMarkdownFileParams{
+			CardID: int32(cardID),
+			Ver:    int32(version),
+		})
+		if err != nil {
+			return &common.CardError{CardID: int32(cardID), Version: int32(version), Err: err}
+		}
+		baseVersion = int32(version)
+	}
+
+	if verbose && baseVersion != latestVersion {
+		fmt.Printf("Editing version %d (latest is %d)\n", baseVersion, latestVersion)
 	}
 
 	// Display image for the card if available
-	err = common.DisplayCardImages(int32(cardID), *queries)
-	if err != nil {
-		fmt.Printf("Note: %v (no image found or error displaying)\n", err)
+	if !stdin {
+		err = common.DisplayCardImages(int32(cardID), *queries)
+		if err != nil {
+			fmt.Printf("Note: %v (no image found or error displaying)\n", err)
+		}
 	}
 
 	// Initialize Minio client
 	minioClient, err := common.NewMinioClient()
 	if err != nil {
-		return fmt.Errorf("error initializing Minio client: %v", err)
+		return fmt.Errorf("error initializing Minio client: %w", err)
 	}
 
-	// Create a temporary file to store the markdown content
-	tempFile := fmt.Sprintf("/tmp/%d_%d.md", cardID, latestVersion)
-
-	// Download the markdown file using the common function
-	err = minioClient.GetMarkdownForCard(int32(cardID), latestVersion, tempFile)
+	content, err := common.ReadMarkdown(context.Background(), queries, minioClient, int32(cardID), baseVersion)
 	if err != nil {
-		return fmt.Errorf("error downloading content file: %v", err)
+		return err
 	}
+	mdContent := []byte(content)
 
-	if verbose {
-		fmt.Printf("Successfully downloaded content file to %s\n", tempFile)
+	// Calculate hash of the markdown content
+	if normalize {
+		mdContent = []byte(common.NormalizeMarkdown(string(mdContent)))
 	}
+	downloadHashString := common.CalculateFileHash(mdContent)
 
-	// Read the markdown file content
-	mdContent, err := os.ReadFile(tempFile)
-	if err != nil {
-		return fmt.Errorf("error reading markdown file: %v", err)
-	}
+	var tempFile string
+	var editedContent []byte
+	changed := false
+	if stdin {
+		editedContent, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("error reading stdin: %w", err)
+		}
+	} else {
+		// Write the markdown to a new temporary file only this session uses
+		tempFile, err = common.WriteTempFile(fmt.Sprintf("%s%d_%d_*.md", common.TempPrefix, cardID, baseVersion), []byte(content))
+		if err != nil {
+			return err
+		}
 
-	// Calculate hash of the markdown content
-	downloadHashString := common.CalculateFileHash(mdContent)
+		// The file is removed when the command ends, unless it holds changes that weren't saved
+		defer func() {
+			if err != nil && changed {
+				fmt.Fprintf(os.Stderr, "Your changes are kept in %s\n", tempFile)
+				return
+			}
+			os.Remove(tempFile)
+		}()
+
+		if verbose {
+			fmt.Printf("Successfully wrote content file to %s\n", tempFile)
+		}
 
-	// Open the file in neovim for editing
-	cmd := exec.Command("nvim", tempFile)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+		err = openInEditor(tempFile)
+		if err != nil {
+			return err
+		}
 
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("error opening file in neovim: %v", err)
+		// Read the file content after editing
+		editedContent, err = os.ReadFile(tempFile)
+		if err != nil {
+			return fmt.Errorf("error reading edited file: %w", err)
+		}
 	}
 
-	// Read the file content after editing
-	editedContent, err := os.ReadFile(tempFile)
-	if err != nil {
-		return fmt.Errorf("error reading edited file: %v", err)
+	if normalize {
+		editedContent = []byte(common.NormalizeMarkdown(string(editedContent)))
 	}
 
 	// Calculate hash of the edited content
@@ -83,92 +134,186 @@ func editImpl(cardID int, verbose bool) error {
 	// Check if the content has changed
 	if downloadHashString == editedHashString {
 		fmt.Println("No changes detected. Exiting.")
-		os.Remove(tempFile)
 		return nil
 	}
+	changed = true
 
 	if verbose {
 		fmt.Println("Changes detected. Updating content version in Minio and database.")
 	}
 
+	// Make sure no other session saved a new version while we were editing. Edits of an
+	// older version branch off it and don't take in the newer versions, so only an edit of
+	// the latest version is merged with the versions saved in between.
+	parentVersion := baseVersion
+	currentLatest, err := queries.GetLatestMarkdownVersion(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error getting latest markdown version: %w", err)
+	}
+
+	if currentLatest != latestVersion && baseVersion == latestVersion {
+		if stdin {
+			return fmt.Errorf("version %d was saved by another session while reading stdin, run the edit again", currentLatest)
+		}
+		editedContent, err = resolveConcurrentEdit(queries, minioClient, cardID, currentLatest, mdContent, editedContent, tempFile)
+		if err != nil {
+			return err
+		}
+		if normalize {
+			editedContent = []byte(common.NormalizeMarkdown(string(editedContent)))
+		}
+		parentVersion = currentLatest
+	}
+	latestVersion = currentLatest
+
+	// Saving generates embeddings, which takes a while
+	progress := common.NewProgress(quiet)
+	defer progress.Done()
+
 	// Increment version number
 	newVersion := latestVersion + 1
 
-	// Upload the edited markdown file using the common function
-	err = minioClient.UploadMarkdownForCard(int32(cardID), newVersion, editedContent)
+	// Get environment variables for OpenAI API
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	// Get the method used for this card (ocr, mistral, vision or text), the edited
+	// markdown is chunked with the chunker of the method that was used for upload
+	methodName, err := queries.GetCardMethod(context.Background(), int32(cardID))
 	if err != nil {
-		return fmt.Errorf("error uploading edited content file: %v", err)
+		return fmt.Errorf("error retrieving card method: %w", err)
 	}
 
-	if verbose {
-		fmt.Printf("Successfully uploaded edited content for card %d, version %d\n", cardID, newVersion)
+	progress.Stage("Storing markdown and embeddings")
+	dbSpan := common.StartSpan("db.store_version")
+	err = storeVersion(dbpool, queries, minioClient, openaiKey, int32(cardID), newVersion, pgtype.Int4{Int32: parentVersion, Valid: true}, string(editedContent), common.Method(methodName))
+	dbSpan.End(err)
+	if err != nil {
+		return err
 	}
 
-	// Store the new markdown hash in the database
-	err = queries.CreateMarkdown(context.Background(), database.CreateMarkdownParams{
-		CardID: int32(cardID),
-		Ver:    newVersion,
-		Hash:   editedHashString,
-	})
+	// The card was looked at, so it no longer needs review
+	err = queries.SetCardNeedsReview(context.Background(), database.SetCardNeedsReviewParams{ID: int32(cardID), NeedsReview: false})
 	if err != nil {
-		return fmt.Errorf("error storing new markdown hash in database: %v", err)
+		return fmt.Errorf("error clearing the review flag: %w", err)
 	}
 
-	if verbose {
-		fmt.Printf("Successfully stored new markdown hash in database for card %d, version %d\n", cardID, newVersion)
+	// Always show this important message even in non-verbose mode
+	progress.Done()
+	progress.Printf("Successfully stored version %d of card %d\n", newVersion, cardID)
+
+	return nil
+}
+
+// openInEditor opens a file in the editor set in $VISUAL or $EDITOR, or in neovim, and
+// waits for the editor to exit. Without any of them the file is opened with the default
+// app of the OS, like Notepad on Windows.
+func openInEditor(path string) error {
+	if common.NoInput {
+		return fmt.Errorf("%w: --no-input is set, so no editor is opened", common.ErrInputRequired)
 	}
 
-	// Get environment variables for OpenAI API
-	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		if _, err := exec.LookPath("nvim"); err == nil {
+			editor = "nvim"
+		}
+	}
+	if editor == "" {
+		return openWithDefaultApp(path)
+	}
+
+	// The editor can have arguments, like "code --wait"
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error opening file in %s: %w", fields[0], err)
+	}
+	return nil
+}
+
+// openWithDefaultApp opens a file with the default app of the OS and waits for Enter,
+// as the app doesn't have to exit when the file is saved
+func openWithDefaultApp(path string) error {
+	if !common.CanPrompt() {
+		return fmt.Errorf("no editor found, set $EDITOR or pass the content on stdin with --stdin")
+	}
+
+	if err := common.OpenBrowser(path); err != nil {
+		return fmt.Errorf("no editor found, set $EDITOR (error opening %s: %w)", path, err)
+	}
+
+	fmt.Printf("Opened %s. Save it, then press Enter to continue.", path)
+	if _, err := bufio.NewReader(os.Stdin).ReadString('\n'); err != nil {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+	return nil
+}
+
+// resolveConcurrentEdit handles a newer version being saved by another session while
+// the card was being edited. It either merges both edits or aborts the edit.
+func resolveConcurrentEdit(queries *database.Queries, minioClient *common.MinioClient, cardID int, latestVersion int32, base, edited []byte, tempFile string) ([]byte, error) {
+	fmt.Printf("Version %d of card %d was saved by another session while you were editing.\n", latestVersion, cardID)
+	if !common.CanPrompt() {
+		return nil, fmt.Errorf("%w: edit aborted because version %d was saved concurrently", common.ErrInputRequired, latestVersion)
+	}
+	fmt.Print("Merge your changes into it or abort? (m/a): ")
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
 	if err != nil {
-		return fmt.Errorf("error getting OpenAI API key: %v", err)
+		return nil, fmt.Errorf("error reading input: %w", err)
+	}
+
+	input = strings.TrimSpace(strings.ToLower(input))
+	if input != "m" && input != "merge" {
+		return nil, fmt.Errorf("edit aborted because version %d was saved concurrently", latestVersion)
 	}
 
-	// Get the method used for this card (ocr or vision)
-	imageInfo, err := queries.GetCardImage(context.Background(), int32(cardID))
+	// Get the concurrently saved version
+	latest, err := common.ReadMarkdown(context.Background(), queries, minioClient, int32(cardID), latestVersion)
 	if err != nil {
-		return fmt.Errorf("error retrieving card image method: %v", err)
+		return nil, err
 	}
 
-	// Extract chunks from the edited markdown using the same method that was used for upload
-	mdString := string(editedContent)
-	chunks := common.ExtractChunks(mdString, imageInfo.Method)
-	if verbose {
-		fmt.Printf("Extracted %d chunks from markdown using %s method\n", len(chunks), imageInfo.Method)
+	merged, conflict, err := common.MergeMarkdown(base, edited, []byte(latest))
+	if err != nil {
+		return nil, fmt.Errorf("error merging changes: %w", err)
 	}
 
-	// Generate embeddings for chunks
-	embeddings, err := common.LineEmbeddings(openaiKey, "text-embedding-3-small", 1536, chunks)
+	err = os.WriteFile(tempFile, merged, 0644)
 	if err != nil {
-		return fmt.Errorf("error generating embeddings: %v", err)
+		return nil, fmt.Errorf("error writing merged file: %w", err)
 	}
 
-	if verbose {
-		fmt.Printf("Generated %d embeddings\n", len(embeddings))
-	}
-
-	// Store embeddings in the database
-	for i, embedding := range embeddings {
-		pgvEmbed := pgvector.NewVector(common.ConvertFloat64ToFloat32(embedding))
-		err = queries.CreateEmbeddings(context.Background(), database.CreateEmbeddingsParams{
-			CardID:    int32(cardID),
-			Ver:       newVersion,
-			Idx:       int32(i),
-			Model:     "text-embedding-3-small",
-			Text:      chunks[i],
-			Embedding: pgvEmbed,
-		})
+	if !conflict {
+		fmt.Printf("Merged your changes with version %d.\n", latestVersion)
+		return merged, nil
+	}
 
-		if err != nil {
-			return fmt.Errorf("error storing embedding %d in database: %v", i, err)
-		}
+	// Let the user resolve the conflicts in the editor
+	fmt.Println("Both sessions changed the same lines. Resolve the conflicts in the editor.")
+	err = openInEditor(tempFile)
+	if err != nil {
+		return nil, err
 	}
 
-	// Always show this important message even in non-verbose mode
-	fmt.Printf("Successfully stored %d embeddings in database for card %d, version %d\n", len(embeddings), cardID, newVersion)
+	merged, err = os.ReadFile(tempFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading merged file: %w", err)
+	}
 
-	// Clean up the temporary file
-	os.Remove(tempFile)
+	if strings.Contains(string(merged), "<<<<<<< edited") || strings.Contains(string(merged), ">>>>>>> latest") {
+		return nil, fmt.Errorf("unresolved conflicts remain")
+	}
 
-	return nil
-}
\ No newline at end of file
+	return merged, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// Exit codes of ume, so scripts can tell why a command failed
+const (
+	exitError               = 1  // any other error
+	exitUsage               = 2  // invalid flags, as the flag package exits with
+	exitNotFound            = 3  // a card or another record doesn't exist
+	exitNoAPIKey            = 4  // an API key or secret isn't set or was rejected
+	exitNotConfigured       = 5  // another setting isn't set
+	exitProviderUnavailable = 6  // OpenAI, Azure or another service can't be used right now, or offline
+	exitDatabaseUnavailable = 7  // the database can't be reached
+	exitInputRequired       = 8  // the command has to ask, but can't
+	exitDeadline            = 9  // the command or a request took longer than --deadline or --timeout
+	exitConflict            = 10 // another edit stored the same version of a card first
+)
+
+// usageError is an error in the arguments of a command, which exits with exitUsage
+type usageError struct {
+	msg string
+}
+
+// Error returns the message of the error
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// exitCode returns the exit code of the error a command failed with
+func exitCode(err error) int {
+	switch {
+	case errors.As(err, &usageError{}):
+		return exitUsage
+	case errors.Is(err, common.ErrCardNotFound), errors.Is(err, pgx.ErrNoRows):
+		return exitNotFound
+	case errors.Is(err, common.ErrNoAPIKey):
+		return exitNoAPIKey
+	case errors.Is(err, common.ErrNotConfigured):
+		return exitNotConfigured
+	case errors.Is(err, common.ErrInputRequired):
+		return exitInputRequired
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitDeadline
+	case errors.Is(err, common.ErrProviderUnavailable), errors.Is(err, common.ErrOffline):
+		return exitProviderUnavailable
+	case errors.Is(err, common.ErrDatabaseUnavailable):
+		return exitDatabaseUnavailable
+	case errors.Is(err, common.ErrVersionConflict):
+		return exitConflict
+	default:
+		return exitError
+	}
+}
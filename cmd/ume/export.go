@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// exportPage is the data rendered by the export template
+type exportPage struct {
+	cardPage
+	Style     template.CSS
+	ImageData template.URL
+}
+
+// exportImpl implements the export command functionality. With the md format the
+// markdown is written with frontmatter instead of a rendered document.
+func exportImpl(cardID int, version int, format, output string) error {
+	if format != "html" && format != "pdf" && format != "md" {
+		return fmt.Errorf("invalid format: %s. Must be one of 'html', 'pdf' or 'md'", format)
+	}
+
+	if output == "" {
+		output = fmt.Sprintf("card_%d.%s", cardID, format)
+	}
+
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	page, err := loadCardPage(queries, minioClient, cardID, version, "", -1)
+	if err != nil {
+		return err
+	}
+
+	// Markdown is exported as it is stored, after frontmatter that cites its source
+	if format == "md" {
+		markdown, err := common.ReadMarkdown(context.Background(), queries, minioClient, int32(cardID), int32(page.Version))
+		if err != nil {
+			return fmt.Errorf("error reading markdown: %w", err)
+		}
+		content := common.ExportFrontmatter(page.Title, page.UID, page.Version, page.Source) + "\n" + markdown
+		if err := os.WriteFile(output, []byte(content), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", output, err)
+		}
+		fmt.Printf("Exported card %d, version %d to %s\n", cardID, page.Version, output)
+		return nil
+	}
+
+	// Embed the image as a data URI so the document is self-contained.
+	// Cards created from text have no image.
+	var imageData template.URL
+	if page.HasImage {
+		imageData, err = imageDataURI(queries, minioClient, cardID)
+		if err != nil {
+			return err
+		}
+	}
+
+	style, err := staticFS.ReadFile("static/style.css")
+	if err != nil {
+		return fmt.Errorf("error reading stylesheet: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = webTemplates.ExecuteTemplate(&buf, "export.html", exportPage{
+		cardPage:  page,
+		Style:     template.CSS(style),
+		ImageData: imageData,
+	})
+	if err != nil {
+		return fmt.Errorf("error rendering document: %w", err)
+	}
+
+	if format == "html" {
+		if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", output, err)
+		}
+	} else {
+		if err := htmlToPDF(buf.Bytes(), output); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Exported card %d, version %d to %s\n", cardID, page.Version, output)
+	return nil
+}
+
+// imageDataURI downloads the image of a card and encodes it as a data URI
+func imageDataURI(queries *database.Queries, minioClient *common.MinioClient, cardID int) (template.URL, error) {
+	card, err := queries.GetCardImage(context.Background(), int32(cardID))
+	if err != nil {
+		return "", fmt.Errorf("error getting card image: %w", err)
+	}
+
+	obj, info, err := minioClient.OpenObject(minioClient.ImageBucket, card.Filename)
+	if err != nil {
+		return "", fmt.Errorf("error downloading image: %w", err)
+	}
+	defer obj.Close()
+
+	imageBytes, err := io.ReadAll(obj)
+	if err != nil {
+		return "", fmt.Errorf("error reading image: %w", err)
+	}
+
+	return template.URL(fmt.Sprintf("data:%s;base64,%s", info.ContentType, base64.StdEncoding.EncodeToString(imageBytes))), nil
+}
+
+// htmlToPDF converts an HTML document to PDF using the first converter found on the system
+func htmlToPDF(html []byte, output string) error {
+	htmlFile, err := os.CreateTemp("", "ume_export_*.html")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(htmlFile.Name())
+
+	_, err = htmlFile.Write(html)
+	htmlFile.Close()
+	if err != nil {
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return fmt.Errorf("error getting absolute path: %w", err)
+	}
+
+	converters := [][]string{
+		{"wkhtmltopdf", "--enable-local-file-access", htmlFile.Name(), absOutput},
+		{"chromium", "--headless", "--print-to-pdf=" + absOutput, htmlFile.Name()},
+		{"chromium-browser", "--headless", "--print-to-pdf=" + absOutput, htmlFile.Name()},
+		{"google-chrome", "--headless", "--print-to-pdf=" + absOutput, htmlFile.Name()},
+	}
+
+	for _, converter := range converters {
+		if _, err := exec.LookPath(converter[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(converter[0], converter[1:]...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error converting to PDF with %s: %v\n%s", converter[0], err, out)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no PDF converter found, install wkhtmltopdf or chromium")
+}
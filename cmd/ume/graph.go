@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// defaultMinSimilarity is the similarity above which cards are joined in a graph
+const defaultMinSimilarity = 0.6
+
+// buildGraph returns the cards accessible to the owner with their links and the pairs of
+// them more similar than minSimilarity. If collectionID is set only the cards in that
+// collection are included.
+func buildGraph(ctx context.Context, queries *database.Queries, owner, collectionID pgtype.Int4, minSimilarity float64) (common.Graph, error) {
+	cards, err := galleryCards(queries, owner, collectionID)
+	if err != nil {
+		return common.Graph{}, err
+	}
+
+	graph := common.Graph{Nodes: make([]common.GraphNode, 0, len(cards)), Edges: []common.GraphEdge{}}
+	included := make(map[int32]bool)
+	for _, card := range cards {
+		graph.Nodes = append(graph.Nodes, common.GraphNode{ID: card.CardID, Title: card.Title})
+		included[card.CardID] = true
+	}
+
+	// Links and similar pairs are only kept between cards in the graph
+	links, err := queries.ListCardLinks(ctx, owner)
+	if err != nil {
+		return common.Graph{}, fmt.Errorf("error listing card links: %w", err)
+	}
+	for _, link := range links {
+		if included[link.SrcCardID] && included[link.DstCardID] {
+			graph.Edges = append(graph.Edges, common.GraphEdge{Source: link.SrcCardID, Target: link.DstCardID, Kind: common.EdgeLink, Weight: 1})
+		}
+	}
+
+	embeddingModel, err := common.CurrentEmbeddingModel()
+	if err != nil {
+		return common.Graph{}, err
+	}
+	similar, err := queries.ListSimilarCards(ctx, database.ListSimilarCardsParams{
+		Model:         embeddingModel.Name,
+		MinSimilarity: float32(minSimilarity),
+	})
+	if err != nil {
+		return common.Graph{}, fmt.Errorf("error searching similar cards: %w", err)
+	}
+	for _, pair := range similar {
+		if included[pair.CardIDA] && included[pair.CardIDB] {
+			graph.Edges = append(graph.Edges, common.GraphEdge{Source: pair.CardIDA, Target: pair.CardIDB, Kind: common.EdgeSimilar, Weight: float64(pair.Similarity)})
+		}
+	}
+
+	return graph, nil
+}
+
+// graphImpl implements the graph command functionality. The links and similarities between
+// the cards are written as DOT or JSON to output, or to stdout if it's empty. With web the
+// graph is shown in the browser instead.
+func graphImpl(format, output, collection string, minSimilarity float64, web bool) error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	collectionID, err := resolveCollection(queries, owner, collection)
+	if err != nil {
+		return err
+	}
+
+	if web {
+		minioClient, err := common.NewMinioClient()
+		if err != nil {
+			return fmt.Errorf("error initializing Minio client: %w", err)
+		}
+		common.ResolveCardUID = cardUIDResolver(queries)
+		common.ResolveCardAlias = cardAliasResolver(queries)
+
+		mux := newCardServer(queries, minioClient, "").mux()
+		registerGraphHandlers(mux, queries, func(*http.Request) pgtype.Int4 { return owner })
+		return serveUntilEnter(mux, fmt.Sprintf("/graph?collection=%d&min_similarity=%g", collectionID.Int32, minSimilarity))
+	}
+
+	graph, err := buildGraph(context.Background(), queries, owner, collectionID, minSimilarity)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if format == "json" {
+		data, err = json.MarshalIndent(graph, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding graph: %w", err)
+		}
+		data = append(data, '\n')
+	} else {
+		data = []byte(graph.DOT())
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", output, err)
+	}
+	fmt.Printf("Wrote a graph of %d cards and %d relationships to %s, %d cards are isolated\n",
+		len(graph.Nodes), len(graph.Edges), output, len(graph.Isolated()))
+	return nil
+}
+
+// registerGraphHandlers adds the force-directed graph of the cards and the JSON it is drawn
+// from. owner returns the user whose cards a request is for.
+func registerGraphHandlers(mux *http.ServeMux, queries *database.Queries, owner func(r *http.Request) pgtype.Int4) {
+	mux.HandleFunc("GET /graph", func(w http.ResponseWriter, r *http.Request) {
+		renderTemplate(w, "graph.html", nil)
+	})
+
+	mux.HandleFunc("GET /api/graph", func(w http.ResponseWriter, r *http.Request) {
+		minSimilarity := defaultMinSimilarity
+		if s := r.URL.Query().Get("min_similarity"); s != "" {
+			var err error
+			minSimilarity, err = strconv.ParseFloat(s, 64)
+			if err != nil || minSimilarity < -1 || minSimilarity > 1 {
+				http.Error(w, "invalid min_similarity, expected a similarity from -1 to 1", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Collections are given by ID, 0 for all cards
+		var collectionID pgtype.Int4
+		if c := r.URL.Query().Get("collection"); c != "" && c != "0" {
+			id, err := strconv.Atoi(c)
+			if err != nil {
+				http.Error(w, "invalid collection", http.StatusBadRequest)
+				return
+			}
+			collectionID = pgtype.Int4{Int32: int32(id), Valid: true}
+		}
+
+		graph, err := buildGraph(r.Context(), queries, owner(r), collectionID, minSimilarity)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(graph)
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// historyImpl implements the history command functionality
+func historyImpl(cardID int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	versions, err := queries.ListMarkdownVersions(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error listing markdown versions: %w", err)
+	}
+
+	if len(versions) == 0 {
+		return fmt.Errorf("no markdown versions found for card %d", cardID)
+	}
+
+	// Group versions by their parent so branches can be printed as a tree
+	children := make(map[int32][]int32)
+	created := make(map[int32]string)
+	var roots []int32
+	for _, v := range versions {
+		created[v.Ver] = v.CreatedAt.Time.Format("2006-01-02 15:04")
+		if v.ParentVer.Valid {
+			children[v.ParentVer.Int32] = append(children[v.ParentVer.Int32], v.Ver)
+		} else {
+			roots = append(roots, v.Ver)
+		}
+	}
+
+	uid, err := queries.GetCardUID(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error getting card UID: %w", err)
+	}
+
+	fmt.Printf("History of card %d (%s):\n\n", cardID, uid)
+
+	var printVersion func(ver int32, depth int)
+	printVersion = func(ver int32, depth int) {
+		fmt.Printf("%sv%d\t%s\n", strings.Repeat("  ", depth), ver, created[ver])
+		for _, child := range children[ver] {
+			// A single child continues the same line of history,
+			// more than one means the card was branched here
+			if len(children[ver]) == 1 {
+				printVersion(child, depth)
+			} else {
+				printVersion(child, depth+1)
+			}
+		}
+	}
+
+	for _, root := range roots {
+		printVersion(root, 0)
+	}
+
+	return nil
+}
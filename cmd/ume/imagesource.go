@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg" // Import jpeg decoder
+	_ "image/png"  // Import png decoder
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// imageExtensions maps image content types to file extensions
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+	"image/tiff": ".tiff",
+}
+
+// downloadImage downloads an image from a URL into dir and returns its path.
+// The file gets a unique name, as images are stored under their file name.
+func downloadImage(url, dir string) (string, error) {
+	ctx, cancel := common.CallContext()
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error downloading image: %w", err)
+	}
+	resp, err := common.HTTPClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error downloading image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error downloading image: unexpected status %s", resp.Status)
+	}
+
+	// Some servers don't send the content type of images, fall back to the extension in the URL
+	contentType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		urlType := mime.TypeByExtension(strings.ToLower(path.Ext(strings.Split(url, "?")[0])))
+		ext, ok = imageExtensions[urlType]
+		if !ok || (contentType != "" && contentType != "application/octet-stream") {
+			return "", fmt.Errorf("URL is not an image: %s", contentType)
+		}
+	}
+
+	imagePath := filepath.Join(dir, fmt.Sprintf("url_%d%s", time.Now().UnixNano(), ext))
+	file, err := os.Create(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("error creating image file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		return "", fmt.Errorf("error downloading image: %w", err)
+	}
+
+	return imagePath, nil
+}
+
+// clipboardImage saves the image in the system clipboard as a PNG into dir and returns its path.
+// It uses osascript on macOS, wl-paste or xclip on Linux and PowerShell on Windows.
+func clipboardImage(dir string) (string, error) {
+	imagePath := filepath.Join(dir, fmt.Sprintf("clipboard_%d.png", time.Now().UnixNano()))
+
+	var cmd *exec.Cmd
+	toStdout := false
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript",
+			"-e", "set png to (the clipboard as «class PNGf»)",
+			"-e", fmt.Sprintf("set f to open for access POSIX file %q with write permission", imagePath),
+			"-e", "write png to f",
+			"-e", "close access f")
+	case "linux":
+		// wl-paste and xclip write the image to stdout
+		if _, err := exec.LookPath("wl-paste"); err == nil && os.Getenv("WAYLAND_DISPLAY") != "" {
+			cmd = exec.Command("wl-paste", "--type", "image/png")
+		} else {
+			cmd = exec.Command("xclip", "-selection", "clipboard", "-t", "image/png", "-o")
+		}
+		toStdout = true
+	case "windows":
+		script := fmt.Sprintf("Add-Type -AssemblyName System.Windows.Forms; "+
+			"$img = [System.Windows.Forms.Clipboard]::GetImage(); "+
+			"if ($img -eq $null) { exit 1 }; "+
+			"$img.Save('%s', [System.Drawing.Imaging.ImageFormat]::Png)", strings.ReplaceAll(imagePath, "'", "''"))
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+	default:
+		return "", fmt.Errorf("unsupported operating system for reading the clipboard: %s", runtime.GOOS)
+	}
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if toStdout {
+		file, err := os.Create(imagePath)
+		if err != nil {
+			return "", fmt.Errorf("error creating image file: %w", err)
+		}
+		defer file.Close()
+		cmd.Stdout = file
+	}
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error reading image from the clipboard: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// Make sure an image was actually written
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("no image in the clipboard: %w", err)
+	}
+	defer file.Close()
+
+	if _, _, err := image.DecodeConfig(file); err != nil {
+		return "", fmt.Errorf("no image in the clipboard: %w", err)
+	}
+
+	return imagePath, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// importImpl implements the import command functionality. The pages of an export from
+// source, notion or gdocs, are stored as text cards. Pages that were imported before,
+// found by their external ID, get a new version when their content changed.
+func importImpl(source, exportPath string, normalize bool) error {
+	var pages []common.ImportedPage
+	var err error
+	switch source {
+	case "notion":
+		pages, err = common.ReadNotionExport(exportPath)
+	case "gdocs":
+		pages, err = common.ReadGoogleDocsExport(exportPath)
+	default:
+		return fmt.Errorf("invalid source: %s. Must be one of 'notion' or 'gdocs'", source)
+	}
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return fmt.Errorf("no pages found in %s", exportPath)
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	// Initialize Minio client
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	// Get OpenAI API key
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	// The cards belong to the user set with UME_API_KEY, if any
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	created, updated, unchanged := 0, 0, 0
+	for _, page := range pages {
+		content := page.Content
+		if normalize {
+			content = common.NormalizeMarkdown(content)
+		}
+		if strings.TrimSpace(content) == "" {
+			fmt.Printf("Skipped \"%s\": no content\n", page.Title)
+			continue
+		}
+
+		cardID, err := queries.GetCardByExternalID(context.Background(), page.ExternalID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			cardID, err = importPage(dbpool, queries, minioClient, openaiKey, owner, page, content)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Imported \"%s\" as card %d\n", page.Title, cardID)
+			created++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error looking up %s: %w", page.ExternalID, err)
+		}
+
+		version, err := reimportPage(dbpool, queries, minioClient, openaiKey, cardID, content)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			unchanged++
+			continue
+		}
+		fmt.Printf("Updated card %d \"%s\" to version %d\n", cardID, page.Title, version)
+		updated++
+	}
+
+	fmt.Printf("\nImported %d new cards, updated %d and left %d unchanged\n", created, updated, unchanged)
+	return nil
+}
+
+// importPage creates a card from an imported page and returns its ID. The title of the
+// page is kept, and only generated when the page has none.
+func importPage(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, openaiKey string, owner pgtype.Int4, page common.ImportedPage, content string) (int32, error) {
+	cardID, err := queries.CreateCard(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("error creating card: %w", err)
+	}
+
+	err = queries.SetCardExternalID(context.Background(), database.SetCardExternalIDParams{
+		ID:         cardID,
+		ExternalID: page.ExternalID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error storing external ID: %w", err)
+	}
+
+	if owner.Valid {
+		err = queries.SetCardOwner(context.Background(), database.SetCardOwnerParams{ID: cardID, OwnerID: owner})
+		if err != nil {
+			return 0, fmt.Errorf("error setting card owner: %w", err)
+		}
+	}
+
+	if page.Title == "" {
+		_, err = storeFirstVersion(dbpool, queries, minioClient, openaiKey, cardID, content, common.MethodText)
+		return cardID, err
+	}
+
+	err = storeVersion(dbpool, queries, minioClient, openaiKey, cardID, 1, pgtype.Int4{}, content, common.MethodText)
+	if err != nil {
+		return 0, err
+	}
+
+	err = queries.SetCardTitle(context.Background(), database.SetCardTitleParams{
+		ID:    cardID,
+		Title: page.Title,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error storing card title: %w", err)
+	}
+	return cardID, nil
+}
+
+// reimportPage stores the content of a page imported before as a new version of its card.
+// It returns the new version, or 0 if the content is the same as the latest version.
+func reimportPage(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, openaiKey string, cardID int32, content string) (int32, error) {
+	latestVersion, err := queries.GetLatestMarkdownVersion(context.Background(), cardID)
+	if err != nil {
+		return 0, fmt.Errorf("error getting latest markdown version of card %d: %w", cardID, err)
+	}
+
+	latest, err := queries.GetMarkdownFile(context.Background(), database.GetMarkdownFileParams{
+		CardID: cardID,
+		Ver:    latestVersion,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error getting markdown hash of card %d: %w", cardID, err)
+	}
+	if latest.Hash == common.CalculateFileHash([]byte(content)) {
+		return 0, nil
+	}
+
+	version := latestVersion + 1
+	err = storeVersion(dbpool, queries, minioClient, openaiKey, cardID, version, pgtype.Int4{Int32: latestVersion, Valid: true}, content, common.MethodText)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
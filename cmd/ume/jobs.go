@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// jobKindUpload processes the image of a card uploaded with ume upload --async or offline
+const jobKindUpload = "upload"
+
+// jobStaleAfter is how long a job can run before it is taken to be left behind by a
+// worker that stopped, and is claimed by another worker
+const jobStaleAfter = 30 * time.Minute
+
+// enqueueJob queues a job of a kind for a card, with params stored as JSON, and returns its ID
+func enqueueJob(queries *database.Queries, cardID int32, kind string, params any) (int32, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding job params: %w", err)
+	}
+
+	jobID, err := queries.CreateJob(context.Background(), database.CreateJobParams{
+		CardID: cardID,
+		Kind:   kind,
+		Params: data,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error queuing job: %w", err)
+	}
+	return jobID, nil
+}
+
+// workerImpl implements the worker command functionality. Queued jobs are processed one
+// at a time, waiting poll for new ones. With once the worker stops when the queue is empty.
+// Interrupting the worker lets the current job finish.
+func workerImpl(poll time.Duration, once bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	// Initialize Minio client
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Println("Waiting for jobs, press Ctrl+C to stop")
+	processed := 0
+	for ctx.Err() == nil {
+		job, err := claimJob(queries)
+		if errors.Is(err, pgx.ErrNoRows) {
+			if once {
+				break
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(poll):
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error claiming job: %w", err)
+		}
+
+		fmt.Printf("Processing job %d (%s) of card %d, attempt %d/%d\n", job.ID, job.Kind, job.CardID, job.Attempts, job.MaxAttempts)
+		err = runJob(dbpool, queries, minioClient, job)
+		if err == nil {
+			if err := queries.CompleteJob(context.Background(), job.ID); err != nil {
+				return fmt.Errorf("error completing job %d: %w", job.ID, err)
+			}
+			fmt.Printf("Finished job %d of card %d\n", job.ID, job.CardID)
+			processed++
+			continue
+		}
+
+		// Retries wait longer each time, 1, 4 then 9 minutes
+		retry := time.Duration(job.Attempts*job.Attempts) * time.Minute
+		status, failErr := queries.FailJob(context.Background(), database.FailJobParams{
+			ID:           job.ID,
+			Error:        err.Error(),
+			RetrySeconds: int32(retry.Seconds()),
+		})
+		if failErr != nil {
+			return fmt.Errorf("error recording the failure of job %d: %w", job.ID, failErr)
+		}
+		if status == "failed" {
+			fmt.Printf("Job %d of card %d failed: %v. Retry it with: ume jobs retry %d\n", job.ID, job.CardID, err, job.ID)
+		} else {
+			fmt.Printf("Job %d of card %d failed: %v. Retrying in %s\n", job.ID, job.CardID, err, retry)
+		}
+	}
+
+	fmt.Printf("Processed %d jobs\n", processed)
+	return nil
+}
+
+// claimJob claims the next queued job, or a job left behind by a worker that stopped.
+// Jobs left behind during their last attempt fail first, so they don't stay running.
+func claimJob(queries *database.Queries) (database.ClaimJobRow, error) {
+	if _, err := queries.FailStaleJobs(context.Background(), int32(jobStaleAfter.Seconds())); err != nil {
+		return database.ClaimJobRow{}, fmt.Errorf("error failing stale jobs: %w", err)
+	}
+	return queries.ClaimJob(context.Background(), int32(jobStaleAfter.Seconds()))
+}
+
+// runJob processes a claimed job
+func runJob(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, job database.ClaimJobRow) (err error) {
+	span := common.StartSpan("job", "job.kind", job.Kind)
+	defer func() { span.End(err) }()
+
+	if job.Kind != jobKindUpload {
+		return fmt.Errorf("unknown job kind: %s", job.Kind)
+	}
+
+	var params uploadJob
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return fmt.Errorf("error decoding job params: %w", err)
+	}
+
+	// A job that failed before continues after the last stage that finished
+	upload, err := queries.GetCardUpload(context.Background(), job.CardID)
+	if err != nil {
+		return fmt.Errorf("error getting upload stage of card %d: %w", job.CardID, err)
+	}
+
+	// The hash of the extracted markdown is only kept with the options of the card
+	var options uploadJob
+	if json.Unmarshal(upload.UploadOptions, &options) == nil {
+		params.Extracted = options.Extracted
+	}
+
+	progress := common.NewProgress(false)
+	defer progress.Done()
+	return resumeUpload(dbpool, queries, minioClient, job.CardID, upload.UploadStage, params, progress)
+}
+
+// jobsListImpl lists the latest jobs, only the ones with a status if it is set
+func jobsListImpl(status string, limit int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	jobs, err := queries.ListJobs(context.Background(), database.ListJobsParams{
+		Status: pgtype.Text{String: status, Valid: status != ""},
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return fmt.Errorf("error listing jobs: %w", err)
+	}
+
+	if len(jobs) == 0 {
+		fmt.Println("No jobs found.")
+		return nil
+	}
+
+	fmt.Println("Job\tCard\tKind\tStatus\tTries\tUpdated\t\t\tError")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, job := range jobs {
+		fmt.Printf("%4d\t%4d\t%s\t%s\t%d/%d\t%s\t%s\n", job.ID, job.CardID, job.Kind, job.Status, job.Attempts, job.MaxAttempts,
+			job.UpdatedAt.Time.Local().Format("2006-01-02 15:04:05"), job.Error)
+	}
+	return nil
+}
+
+// jobsRetryImpl queues a failed job again, or all failed jobs if jobID is 0
+func jobsRetryImpl(jobID int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	// Jobs left behind during their last attempt are failed first, so they can be retried
+	// without a running worker
+	if _, err := queries.FailStaleJobs(context.Background(), int32(jobStaleAfter.Seconds())); err != nil {
+		return fmt.Errorf("error failing stale jobs: %w", err)
+	}
+
+	retried, err := queries.RetryJobs(context.Background(), pgtype.Int4{Int32: int32(jobID), Valid: jobID != 0})
+	if err != nil {
+		return fmt.Errorf("error queuing jobs again: %w", err)
+	}
+
+	if jobID != 0 && retried == 0 {
+		return fmt.Errorf("job %d not found or not failed", jobID)
+	}
+	fmt.Printf("Queued %d failed jobs again\n", retried)
+	return nil
+}
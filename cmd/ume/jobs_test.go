@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// TestClaimJobFailsStaleLastAttempt tests that a job left running during its last attempt
+// fails instead of staying running, and can be retried
+func TestClaimJobFailsStaleLastAttempt(t *testing.T) {
+	// Skip this test if DB_STRING isn't set
+	if os.Getenv("DB_STRING") == "" {
+		t.Skip("Skipping test because DB_STRING environment variable is not set")
+	}
+
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		t.Fatalf("Error initializing database: %v", err)
+	}
+	defer dbpool.Close()
+
+	ctx := context.Background()
+	cardID, err := queries.CreateCard(ctx)
+	if err != nil {
+		t.Fatalf("Error creating card: %v", err)
+	}
+	defer queries.DeleteCard(ctx, cardID)
+
+	jobID, err := enqueueJob(queries, cardID, jobKindUpload, struct{}{})
+	if err != nil {
+		t.Fatalf("Error queuing job: %v", err)
+	}
+
+	// Leave the job running in its last attempt by a worker that stopped long ago
+	_, err = dbpool.Exec(ctx, `UPDATE jobs SET status = 'running', attempts = max_attempts,
+		updated_at = CURRENT_TIMESTAMP - interval '1 day' WHERE id = $1`, jobID)
+	if err != nil {
+		t.Fatalf("Error updating job: %v", err)
+	}
+
+	job, err := claimJob(queries)
+	if err == nil && job.ID == jobID {
+		t.Fatalf("Expected job %d not to be claimed again", jobID)
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("Error claiming job: %v", err)
+	}
+
+	failed, err := queries.ListJobs(ctx, database.ListJobsParams{
+		Status: pgtype.Text{String: "failed", Valid: true},
+		Limit:  100,
+	})
+	if err != nil {
+		t.Fatalf("Error listing jobs: %v", err)
+	}
+	found := false
+	for _, job := range failed {
+		found = found || job.ID == jobID
+	}
+	if !found {
+		t.Errorf("Expected job %d to have failed", jobID)
+	}
+
+	retried, err := queries.RetryJobs(ctx, pgtype.Int4{Int32: jobID, Valid: true})
+	if err != nil {
+		t.Fatalf("Error retrying job: %v", err)
+	}
+	if retried != 1 {
+		t.Errorf("Expected job %d to be queued again, got %d jobs", jobID, retried)
+	}
+}
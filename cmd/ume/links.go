@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// linksImpl implements the links command functionality
+func linksImpl(cardID int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	outbound, err := queries.ListOutboundLinks(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error listing outbound links: %w", err)
+	}
+
+	inbound, err := queries.ListInboundLinks(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error listing inbound links: %w", err)
+	}
+
+	fmt.Printf("Card %d links to:\n", cardID)
+	if len(outbound) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, link := range outbound {
+		fmt.Printf("  %4d\t%s\n", link.ID, link.Title)
+	}
+
+	fmt.Printf("\nCard %d is linked from:\n", cardID)
+	if len(inbound) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, link := range inbound {
+		fmt.Printf("  %4d\t%s\n", link.ID, link.Title)
+	}
+
+	return nil
+}
+
+// resolveCardUID looks up the local ID of a card given by its UID on the command line
+func resolveCardUID(uid string) (int32, error) {
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return 0, fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	return queries.GetCardByUID(context.Background(), uid)
+}
+
+// cardUIDResolver looks up card UIDs with an open connection, for the servers
+// that resolve the UIDs in the paths of every request
+func cardUIDResolver(queries *database.Queries) func(string) (int32, error) {
+	return func(uid string) (int32, error) {
+		return queries.GetCardByUID(context.Background(), uid)
+	}
+}
+
+// storeCardLinks replaces the stored outbound links of a card with the
+// [[card:123]] and [[card:<uid>]] links found in its markdown content
+func storeCardLinks(store common.LinkStore, cardID int32, content string) error {
+	warnings, err := common.StoreCardLinks(context.Background(), store, cardID, content)
+	printLinkWarnings(warnings)
+	return err
+}
+
+// printLinkWarnings prints the links to cards that don't exist, which are kept in the
+// markdown but not stored
+func printLinkWarnings(warnings []error) {
+	for _, warning := range warnings {
+		fmt.Printf("Note: %v\n", warning)
+	}
+}
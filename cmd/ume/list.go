@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// listImpl implements the list command functionality.
+// If collection is set only the cards in that collection are listed. Archived cards are
+// only listed with includeArchived.
+func listImpl(collection string, includeArchived bool) error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	collectionID, err := resolveCollection(queries, owner, collection)
+	if err != nil {
+		return err
+	}
+
+	cards, err := queries.ListCards(context.Background(), database.ListCardsParams{
+		OwnerID:         owner,
+		CollectionID:    collectionID,
+		IncludeArchived: includeArchived,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing cards: %w", err)
+	}
+
+	if len(cards) == 0 {
+		fmt.Println(common.T(msgNoCards))
+		return nil
+	}
+
+	fmt.Println(common.T(msgListHeader))
+	fmt.Println("------------------------------------------------------------------------------")
+
+	for _, card := range cards {
+		title := card.Title
+		if title == "" {
+			title = common.MarkdownTitle(card.Text.String, 60)
+		}
+		if card.Archived {
+			title += common.T(msgArchivedSuffix)
+		}
+		fmt.Printf("%4d\t%2d\t%s\n", card.ID, card.Ver, title)
+	}
+
+	return nil
+}
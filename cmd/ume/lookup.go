@@ -1,137 +1,667 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/yasushisakai/umesao/database"
 	"github.com/yasushisakai/umesao/pkg/common"
 )
 
 // SearchResult represents a search result with distance
 type SearchResult struct {
-	CardID   int32
-	Ver      int32
-	Idx      int32
-	Model    string
-	Text     string
-	Distance float32
+	CardID int32
+	Ver    int32
+	Idx    int32
+	Model  string
+	Text   string
+	Lang   string
+	// Type and Page tell what the matched chunk is and where it is on the card, when known
+	Type  common.ChunkType
+	Page  int32
+	Title string
+	// CreatedAt is when the first version of the card was stored
+	CreatedAt time.Time
+	Distance  float32
+	// RawDistance is the distance before it was adjusted for the age of the card
+	RawDistance float32
+	// With an expanded query, Query is the phrasing that matched the chunk, FusionScore
+	// the score the card was ranked by and Phrasings the number of phrasings that found it
+	Query       string
+	FusionScore float64
+	Phrasings   int
+	// TextRank is how well the text of the chunk matched a query searched by its words
+	// offline, when there is no distance
+	TextRank float32
 }
 
-// lookupImpl implements the lookup command functionality
-func lookupImpl(searchQuery string) error {
+// lookupPageSize is the number of cards shown on a page of lookup results
+const lookupPageSize = 10
+
+// searchOptions narrows down the cards searched by searchCards
+type searchOptions struct {
+	// Owner and CollectionID limit the search to the cards accessible to a user and in a collection
+	Owner        pgtype.Int4
+	CollectionID pgtype.Int4
+	// Since and Until limit the search to cards created in a time range, unless they are zero
+	Since time.Time
+	Until time.Time
+	// RecencyHalfLife ranks newer cards higher, unless it is zero
+	RecencyHalfLife time.Duration
+	// Expansions are other phrasings of the query, searched too with the results fused
+	Expansions []string
+	// Model is the embedding model whose chunks are searched, the current one if empty
+	Model string
+	// IncludeArchived also searches the archived cards
+	IncludeArchived bool
+	// Method limits the search to the cards whose text was extracted with it, unless it is empty
+	Method common.Method
+	// AllVersions also searches the earlier versions of the cards
+	AllVersions bool
+	// Offset skips the best matching cards, to page through the results
+	Offset int
+}
+
+// lookupRequest is what ume lookup searches for. It is sent to the daemon as it is.
+type lookupRequest struct {
+	// APIKey is the UME_API_KEY of the command, which decides the cards it can search
+	APIKey string
+	Query  string
+	// Collection limits the search to the cards in a collection, unless it is empty
+	Collection string
+	// Since, Until and Recency narrow down and rank the results by when the cards were created
+	Since   time.Time
+	Until   time.Time
+	Recency time.Duration
+	// Expand also searches the query as paraphrased and translated by the chat model
+	Expand bool
+	// Model selects the embedding model whose chunks are searched, the current one if empty
+	Model           string
+	IncludeArchived bool
+	Method          common.Method
+	AllVersions     bool
+	// Page is the page of results, counted from 1
+	Page int
+}
+
+// lookupResponse is what a lookup found
+type lookupResponse struct {
+	// Expansions are the other phrasings the query was searched as
+	Expansions []string
+	Results    []SearchResult
+	// Pinned are the cards pinned by the owner
+	Pinned map[int32]bool
+	// TextSearch is set when the query couldn't be embedded offline, and the cards were
+	// searched by the words of the query instead
+	TextSearch bool
+}
+
+// lookupImpl implements the lookup command functionality. The search is delegated to
+// ume daemon when it is running, so it is done with warm connections, and done here
+// otherwise. With explain every result is followed by how its rank was scored.
+func lookupImpl(req lookupRequest, explain bool) (err error) {
 	now := time.Now()
 
-	// Get environment variables for OpenAI API
-	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	// The search is traced when OTLP is configured
+	span := common.StartSpan("lookup")
+	defer func() { span.End(err) }()
+
+	// Other phrasings are written by the chat model
+	if common.Offline && req.Expand {
+		fmt.Println(common.T(msgOfflineNoExpand))
+		req.Expand = false
+	}
+
+	req.APIKey = os.Getenv("UME_API_KEY")
+	response, err := daemonLookup(req)
+	var queries *database.Queries
+	if errors.Is(err, errNoDaemon) {
+		// Only reading, so a replica can be used
+		var dbpool *pgxpool.Pool
+		dbpool, queries, err = common.InitDBReadOnly()
+		if err != nil {
+			return fmt.Errorf("error initializing database: %w", err)
+		}
+		defer dbpool.Close()
+
+		response, err = lookupSearch(queries, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	if response.TextSearch {
+		fmt.Println(common.T(msgOfflineText))
+	}
+	for _, expansion := range response.Expansions {
+		fmt.Println(common.T(msgAlsoSearching, expansion))
+	}
+	results, pinned, page := response.Results, response.Pinned, req.Page
+
+	// Pinned cards are listed first, in the order they matched, while the best match stays
+	// the closest one
+	bestMatch := results[0]
+	sort.SliceStable(results, func(i, j int) bool {
+		return pinned[results[i].CardID] && !pinned[results[j].CardID]
+	})
+
+	// Display the results
+	fmt.Println("\n" + common.T(msgResults))
+	fmt.Println("\n" + common.T(msgResultsHeader))
+	fmt.Println("--------------------------------------------------------------------------------------")
+
+	for i, result := range results {
+		lang := result.Lang
+		if lang == "" {
+			lang = "-"
+		}
+
+		title := result.Title
+		if pinned[result.CardID] {
+			title = "* " + title
+		}
+
+		preview := fmt.Sprintf("\"%s\"", string([]rune(result.Text)[:10]))
+		if label := common.ChunkLabel(result.Type, int(result.Page)); label != "" {
+			preview += " (" + label + ")"
+		}
+
+		// Cards searched by their text have no distance
+		distance := fmt.Sprintf("%5.3f", result.Distance)
+		if response.TextSearch {
+			distance = "    -"
+		}
+
+		fmt.Printf("%2d\t%4d\t%2d\t%s\t%s\t%s\t%s\t%s\n",
+			i+1,
+			result.CardID,
+			result.Ver,
+			lang,
+			distance,
+			result.CreatedAt.Local().Format("2006-01-02"),
+			title,
+			preview)
+		if explain {
+			for _, line := range explainResult(result, pinned[result.CardID], len(response.Expansions)+1) {
+				fmt.Println("    " + line)
+			}
+		}
+	}
+
+	if pinned[results[0].CardID] {
+		fmt.Println("\n" + common.T(msgPinnedFirst))
+	}
+	fmt.Println("\n" + common.T(msgShowBestMatch, showMatchCommand(bestMatch)))
+	if len(results) == lookupPageSize {
+		fmt.Println(common.T(msgNextPage, page+1))
+	}
+
+	fmt.Println("\n" + common.T(msgTimeTaken, time.Since(now)))
+
+	// Results can be opened one after another until the prompt is left empty
+	if len(results) == 0 || !common.CanPrompt() || !common.IsTerminal(os.Stdout) {
+		return nil
+	}
+
+	// The daemon searched, so the database is only connected to for opening results
+	if queries == nil {
+		dbpool, readQueries, err := common.InitDBReadOnly()
+		if err != nil {
+			return fmt.Errorf("error initializing database: %w", err)
+		}
+		defer dbpool.Close()
+		queries = readQueries
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		action, index, err := promptResultAction(reader, len(results))
+		if err != nil {
+			return err
+		}
+		if action == "" {
+			return nil
+		}
+		if err := openResult(queries, action, results[index]); err != nil {
+			fmt.Println(common.T(msgError, err))
+		}
+	}
+}
+
+// lookupSearch searches for a lookup request, and lists the pinned cards of its owner
+func lookupSearch(queries *database.Queries, req lookupRequest) (lookupResponse, error) {
+	owner, err := apiKeyOwner(queries, req.APIKey)
 	if err != nil {
-		return fmt.Errorf("error getting OpenAI API key: %v", err)
+		return lookupResponse{}, err
 	}
 
-	// Calculate embedding for the search query
-	queryEmbeddings, err := common.LineEmbeddings(openaiKey, "text-embedding-3-small", 1536, []string{searchQuery})
+	collectionID, err := resolveCollection(queries, owner, req.Collection)
 	if err != nil {
-		return fmt.Errorf("error generating query embedding: %v", err)
+		return lookupResponse{}, err
 	}
 
-	if len(queryEmbeddings) == 0 {
-		return fmt.Errorf("no embeddings generated for the query")
+	var expansions []string
+	if req.Expand {
+		openaiClient, err := common.NewOpenAIClient()
+		if err != nil {
+			return lookupResponse{}, fmt.Errorf("error initializing OpenAI client: %w", err)
+		}
+		expanded, err := openaiClient.ExpandQuery(req.Query)
+		if err != nil {
+			return lookupResponse{}, fmt.Errorf("error expanding query: %w", err)
+		}
+		expansions = expanded[1:]
 	}
 
-	// Convert the query embedding to pgvector
-	pgvQueryEmbed := common.EmbeddingToPGVector(queryEmbeddings[0])
+	opts := searchOptions{
+		Owner:           owner,
+		CollectionID:    collectionID,
+		Since:           req.Since,
+		Until:           req.Until,
+		RecencyHalfLife: req.Recency,
+		Expansions:      expansions,
+		Model:           req.Model,
+		IncludeArchived: req.IncludeArchived,
+		Method:          req.Method,
+		AllVersions:     req.AllVersions,
+		Offset:          (req.Page - 1) * lookupPageSize,
+	}
+	results, err := searchCards(queries, req.Query, lookupPageSize, opts)
 
-	// Initialize database connection
-	dbpool, queries, err := common.InitDB()
+	// Offline a query that isn't in the query cache can't be embedded, so the cards are
+	// searched by its words
+	textSearch := errors.Is(err, common.ErrOffline)
+	if textSearch {
+		results, err = searchCardsText(queries, req.Query, lookupPageSize, opts)
+	}
 	if err != nil {
-		return fmt.Errorf("error initializing database: %v", err)
+		return lookupResponse{}, err
 	}
-	defer dbpool.Close()
 
-	// Check if we have any chunks in the database
-	var chunkCount int
-	err = dbpool.QueryRow(context.Background(), "SELECT COUNT(*) FROM chunks").Scan(&chunkCount)
+	pinned, err := pinnedCards(context.Background(), queries, owner)
 	if err != nil {
-		return fmt.Errorf("error counting chunks: %v", err)
+		return lookupResponse{}, err
 	}
+	return lookupResponse{Expansions: expansions, Results: results, Pinned: pinned, TextSearch: textSearch}, nil
+}
+
+// promptResultAction asks what to do with which result until a valid answer is entered,
+// like "v 2". Without a number the first result is used. It returns the action and the
+// index of the result, or an empty action when nothing was entered.
+func promptResultAction(reader *bufio.Reader, count int) (string, int, error) {
+	for {
+		fmt.Print("\n" + common.T(msgResultAction))
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return "", 0, fmt.Errorf("error reading input: %w", err)
+		}
+
+		fields := strings.Fields(strings.ToLower(input))
+		if len(fields) == 0 {
+			return "", 0, nil
+		}
+
+		number := 1
+		if len(fields) > 1 {
+			number, err = strconv.Atoi(fields[1])
+			if err != nil || number < 1 || number > count {
+				fmt.Println(common.T(msgResultNumber, count))
+				continue
+			}
+		}
+
+		switch fields[0] {
+		case "v", "e", "s", "o":
+			return fields[0], number - 1, nil
+		}
+		fmt.Println(common.T(msgResultActionHelp))
+	}
+}
 
-	// If no chunks, exit early
-	if chunkCount == 0 {
-		return fmt.Errorf("no chunks found in database. Please upload content first")
+// openResult views, edits, shows or opens the image of a search result
+func openResult(queries *database.Queries, action string, result SearchResult) error {
+	switch action {
+	case "v":
+		markdown, err := common.ReadMarkdown(context.Background(), queries, nil, result.CardID, result.Ver)
+		if err != nil {
+			return err
+		}
+		if result.Lang != "" {
+			minioClient, err := common.NewMinioClient()
+			if err != nil {
+				return fmt.Errorf("error initializing Minio client: %w", err)
+			}
+			markdown, err = getTranslation(queries, minioClient, int(result.CardID), result.Ver, result.Lang, markdown)
+			if err != nil {
+				return err
+			}
+		}
+		return pageText(markdown)
+	case "e":
+		return editImpl(int(result.CardID), -1, false, false, false, false)
+	case "s":
+		chunk := -1
+		if result.Idx > 0 {
+			chunk = int(result.Idx)
+		}
+		return showImpl(int(result.CardID), int(result.Ver), result.Lang, chunk)
+	case "o":
+		return common.DisplayCardImages(result.CardID, *queries)
 	}
+	return fmt.Errorf("unknown action: %s", action)
+}
 
-	// Search for the closest embeddings using only the latest version of each card
-	searchResults, err := queries.SearchLatestDistance(context.Background(), database.SearchLatestDistanceParams{
-		Embedding: pgvQueryEmbed,
-		Limit:     10,
-	})
+// explainResult describes how a result was scored: the distance of the chunk that
+// matched and what moved it up or down. Phrasings is the number the query was searched as.
+func explainResult(result SearchResult, pinned bool, phrasings int) []string {
+	var lines []string
+	if result.TextRank != 0 {
+		lines = append(lines, common.T(msgExplainTextRank, result.TextRank))
+	} else if result.Distance != result.RawDistance {
+		lines = append(lines, common.T(msgExplainRecency, result.RawDistance, result.Distance-result.RawDistance, result.Distance))
+	} else {
+		lines = append(lines, common.T(msgExplainDistance, result.RawDistance))
+	}
+
+	match := common.T(msgExplainMatch, result.Ver, result.Idx)
+	if label := common.ChunkLabel(result.Type, int(result.Page)); label != "" {
+		match += " (" + label + ")"
+	}
+	if result.Lang != "" {
+		match += common.T(msgExplainLang, result.Lang)
+	}
+	lines = append(lines, match)
+
+	if phrasings > 1 {
+		lines = append(lines, common.T(msgExplainFusion, result.FusionScore, result.Phrasings, phrasings, result.Query))
+	}
+	if pinned {
+		lines = append(lines, common.T(msgExplainPinned))
+	}
+	return lines
+}
+
+// showMatchCommand returns the ume show command that opens a result scrolled to the chunk
+// it matched. A match on the whole content has nothing to scroll to.
+func showMatchCommand(result SearchResult) string {
+	command := fmt.Sprintf("ume show --version %d", result.Ver)
+	if result.Idx > 0 {
+		command += fmt.Sprintf(" --chunk %d", result.Idx)
+	}
+	if result.Lang != "" {
+		command += " --lang " + result.Lang
+	}
+	return fmt.Sprintf("%s %d", command, result.CardID)
+}
+
+// searchCards finds the chunks closest to the query among the latest version of each card
+// matching the options. Only the best matching chunk of each card is returned, ordered by
+// distance, which is adjusted for the age of the card when ranking by recency. With
+// expansions every phrasing is searched and the rankings are fused, so cards found by
+// several phrasings come first. The first opts.Offset cards of the ranking are skipped.
+func searchCards(queries *database.Queries, searchQuery string, limit int, opts searchOptions) ([]SearchResult, error) {
+	// Get environment variables for OpenAI API. Offline only queries in the query cache
+	// can be searched, which need no key.
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil && !common.Offline {
+		return nil, fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	// The query is embedded with the model of the chunks it is compared with
+	embeddingModel, err := resolveEmbeddingModel(queries, opts.Model)
+	if err != nil {
+		return nil, err
+	}
+	opts.Model = embeddingModel.Name
+
+	// Calculate embeddings for the search query and its expansions at once. Queries
+	// searched before are read from the query cache.
+	searchQueries := append([]string{searchQuery}, opts.Expansions...)
+	queryEmbeddings, err := embeddingModel.EmbedQueries(openaiKey, searchQueries)
+	if err != nil {
+		return nil, fmt.Errorf("error generating query embedding: %w", err)
+	}
+
+	if len(queryEmbeddings) != len(searchQueries) {
+		return nil, fmt.Errorf("no embeddings generated for the query")
+	}
+
+	if len(queryEmbeddings) == 1 {
+		results, err := searchByEmbedding(queries, queryEmbeddings[0], limit, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) == 0 {
+			return nil, noResultsError(opts.Offset)
+		}
+		return results, nil
+	}
+
+	// The best matching chunk of a card over all phrasings is shown. The fused ranking
+	// is paged, so every phrasing is searched from its first card.
+	offset := opts.Offset
+	opts.Offset = 0
+	best := make(map[int32]SearchResult)
+	phrasings := make(map[int32]int)
+	var rankings [][]int32
+	for i, embedding := range queryEmbeddings {
+		results, err := searchByEmbedding(queries, embedding, offset+limit, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		ranking := make([]int32, len(results))
+		for j, result := range results {
+			ranking[j] = result.CardID
+			phrasings[result.CardID]++
+			if previous, ok := best[result.CardID]; !ok || result.Distance < previous.Distance {
+				result.Query = searchQueries[i]
+				best[result.CardID] = result
+			}
+		}
+		rankings = append(rankings, ranking)
+	}
+
+	scores := common.FusionScores(rankings)
+	var fused []SearchResult
+	for _, cardID := range common.FuseRankings(rankings) {
+		result := best[cardID]
+		result.FusionScore = scores[cardID]
+		result.Phrasings = phrasings[cardID]
+		fused = append(fused, result)
+	}
+
+	fused = fused[min(offset, len(fused)):]
+	if len(fused) == 0 {
+		return nil, noResultsError(offset)
+	}
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+
+	return fused, nil
+}
+
+// noResultsError is the error of a search without results, which past the first page
+// means the results have run out
+func noResultsError(offset int) error {
+	if offset > 0 {
+		return fmt.Errorf("no more matching results")
+	}
+	return fmt.Errorf("no matching results found")
+}
+
+// resolveEmbeddingModel returns the embedding model with a name as registered in the
+// models table, or the current model if name is empty
+func resolveEmbeddingModel(queries *database.Queries, name string) (common.EmbeddingModel, error) {
+	if name == "" {
+		return common.CurrentEmbeddingModel()
+	}
+
+	model, err := queries.GetEmbeddingModel(context.Background(), name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		models, err := queries.ListEmbeddingModels(context.Background())
+		if err != nil {
+			return common.EmbeddingModel{}, fmt.Errorf("error listing embedding models: %w", err)
+		}
+		var names []string
+		for _, m := range models {
+			names = append(names, fmt.Sprintf("%s (%d chunks)", m.Name, m.Chunks))
+		}
+		return common.EmbeddingModel{}, fmt.Errorf("unknown embedding model: %s. Must be one of %s", name, strings.Join(names, ", "))
+	}
 	if err != nil {
-		return fmt.Errorf("error searching for latest embeddings: %v", err)
+		return common.EmbeddingModel{}, fmt.Errorf("error getting embedding model %s: %w", name, err)
 	}
+	return common.EmbeddingModel{Name: model.Name, Dimension: uint(model.Dimension), Provider: model.Provider}, nil
+}
 
-	if len(searchResults) == 0 {
-		return fmt.Errorf("no matching results found")
+// searchByEmbedding finds the best matching chunk of at most limit cards for a query
+// embedding, after skipping the first opts.Offset cards
+func searchByEmbedding(queries *database.Queries, embedding []float64, limit int, opts searchOptions) ([]SearchResult, error) {
+	// Convert the query embedding to pgvector
+	pgvQueryEmbed := common.EmbeddingToPGVector(embedding)
+
+	// Ranking by recency can move older matches down, so more candidates are fetched
+	// from the first card and the page is taken after ranking them. Only the cards up to
+	// the end of the page have to be found either way.
+	candidates, offset, want := limit, opts.Offset, limit
+	if opts.RecencyHalfLife > 0 {
+		candidates, offset, want = (opts.Offset+limit)*5, 0, opts.Offset+limit
+	}
+
+	// Search for the closest embeddings, using only the latest version of each card
+	// unless all versions are searched. The filters are applied to the closest chunks, so
+	// the search is repeated with more of them when they leave too few cards.
+	dbSpan := common.StartSpan("db.search")
+	var searchResults []database.SearchLatestDistanceRow
+	err := common.WidenCandidates(common.SearchCandidates(offset+candidates), want, func(n int32) (int, error) {
+		var err error
+		searchResults, err = queries.SearchLatestDistance(context.Background(), database.SearchLatestDistanceParams{
+			Embedding:       pgvQueryEmbed,
+			AllVersions:     opts.AllVersions,
+			OwnerID:         opts.Owner,
+			CollectionID:    opts.CollectionID,
+			Since:           pgtype.Timestamptz{Time: opts.Since, Valid: !opts.Since.IsZero()},
+			Until:           pgtype.Timestamptz{Time: opts.Until, Valid: !opts.Until.IsZero()},
+			IncludeArchived: opts.IncludeArchived,
+			Model:           opts.Model,
+			Candidates:      n,
+			Method:          pgtype.Text{String: string(opts.Method), Valid: opts.Method != ""},
+			Limit:           int32(candidates),
+			Offset:          int32(offset),
+		})
+		return len(searchResults), err
+	}, func() (int32, error) {
+		return queries.CountModelChunks(context.Background(), opts.Model)
+	})
+	dbSpan.End(err)
+	if err != nil {
+		return nil, fmt.Errorf("error searching for latest embeddings: %w", err)
 	}
 
 	// Convert the search results to our custom type
 	var results []SearchResult
 
 	for _, result := range searchResults {
-		// Convert the distance from interface{} to float32
-		var distance float32
-		switch v := result.Distance.(type) {
-		case float32:
-			distance = v
-		case float64:
-			distance = float32(v)
-		default:
-			fmt.Printf("Unexpected distance type: %T with value: %v\n", result.Distance, result.Distance)
-			distance = 0
-		}
+		distance := float32(result.Distance)
+		createdAt := result.CreatedAt.Time
+		rawDistance := distance
+		distance = common.RecencyAdjustedDistance(distance, time.Since(createdAt), opts.RecencyHalfLife)
 
 		results = append(results, SearchResult{
-			CardID:   result.CardID,
-			Ver:      result.Ver,
-			Idx:      result.Idx,
-			Model:    result.Model,
-			Text:     result.Text,
-			Distance: distance,
+			CardID:      result.CardID,
+			Ver:         result.Ver,
+			Idx:         result.Idx,
+			Model:       result.Model,
+			Text:        result.Text,
+			Lang:        result.Lang,
+			Type:        common.ChunkType(result.Type),
+			Page:        result.Page,
+			Title:       result.Title,
+			CreatedAt:   createdAt,
+			Distance:    distance,
+			RawDistance: rawDistance,
 		})
 	}
 
-	// Sort the results by distance (cosine similarity)
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Distance < results[j].Distance
-	})
-
-	if err != nil {
-		return fmt.Errorf("error initializing Minio client: %v", err)
+	// Only the best matching chunk of each card is returned, whether it matched the
+	// original or a translation, so the results only have to be sorted again when the
+	// distances were adjusted for recency, with ties broken by card like in the query.
+	if opts.RecencyHalfLife > 0 {
+		sort.SliceStable(results, func(i, j int) bool {
+			if results[i].Distance != results[j].Distance {
+				return results[i].Distance < results[j].Distance
+			}
+			return results[i].CardID < results[j].CardID
+		})
+		results = results[min(opts.Offset, len(results)):]
 	}
 
-	// Display the results
-	fmt.Println("\nResults:")
-	fmt.Println("\nCard\tVer\tDist\tText")
-	fmt.Println("------------------------------------------------------------------------------")
-
-	uniques := make(map[int32]bool)
-	var uniqueCardIDs []int32
+	if len(results) > limit {
+		results = results[:limit]
+	}
 
-	for _, result := range results {
-		if _, ok := uniques[result.CardID]; !ok {
-			uniques[result.CardID] = true
-			uniqueCardIDs = append(uniqueCardIDs, result.CardID)
+	return results, nil
+}
 
-			fmt.Printf("%4d\t%2d\t%5.3f\t\"%s\"\n",
-				result.CardID,
-				result.Ver,
-				result.Distance,
-				string([]rune(result.Text)[:10]))
-		}
+// searchCardsText finds the chunks containing the words of the query among the latest
+// version of each card matching the options, for searching offline without an embedding
+// of the query. Only the best matching chunk of each card is returned, ordered by how
+// well it matched, and neither recency nor expansions are used. The chunks of a single
+// embedding model are searched, as every model has its own copy of them.
+func searchCardsText(queries *database.Queries, searchQuery string, limit int, opts searchOptions) ([]SearchResult, error) {
+	embeddingModel, err := resolveEmbeddingModel(queries, opts.Model)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("\nTime taken: %v\n", time.Since(now))
+	dbSpan := common.StartSpan("db.search_text")
+	rows, err := queries.SearchLatestText(context.Background(), database.SearchLatestTextParams{
+		Query:           searchQuery,
+		AllVersions:     opts.AllVersions,
+		OwnerID:         opts.Owner,
+		CollectionID:    opts.CollectionID,
+		Since:           pgtype.Timestamptz{Time: opts.Since, Valid: !opts.Since.IsZero()},
+		Until:           pgtype.Timestamptz{Time: opts.Until, Valid: !opts.Until.IsZero()},
+		IncludeArchived: opts.IncludeArchived,
+		Model:           embeddingModel.Name,
+		Method:          pgtype.Text{String: string(opts.Method), Valid: opts.Method != ""},
+		Limit:           int32(limit),
+		Offset:          int32(opts.Offset),
+	})
+	dbSpan.End(err)
+	if err != nil {
+		return nil, fmt.Errorf("error searching the text of the cards: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, noResultsError(opts.Offset)
+	}
 
-	return nil
+	results := make([]SearchResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, SearchResult{
+			CardID:    row.CardID,
+			Ver:       row.Ver,
+			Idx:       row.Idx,
+			Model:     row.Model,
+			Text:      row.Text,
+			Lang:      row.Lang,
+			Type:      common.ChunkType(row.Type),
+			Page:      row.Page,
+			Title:     row.Title,
+			CreatedAt: row.CreatedAt.Time,
+			TextRank:  row.Rank,
+		})
+	}
+	return results, nil
 }
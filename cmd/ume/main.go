@@ -3,335 +3,305 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/joho/godotenv"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/yasushisakai/umesao/pkg/common"
 )
 
-// CommandFunc is a function type for subcommands
-type CommandFunc func([]string) error
+// globalFlags are the flags given before the command, which apply to all commands
+var (
+	globalFlags  = flag.NewFlagSet("ume", flag.ExitOnError)
+	envFlag      = globalFlags.String("env", "", "Load environment variables from a file, overriding .env")
+	apiKeyFlag   = globalFlags.String("api-key", "", "Act as the user with this API key, overriding UME_API_KEY")
+	noInputFlag  = globalFlags.Bool("no-input", false, "Never prompt: use defaults, and fail where a confirmation is needed")
+	timeoutFlag  = globalFlags.Duration("timeout", 0, "Fail each request to an external service or the database that takes longer than this, like 2m")
+	deadlineFlag = globalFlags.Duration("deadline", 0, "Fail the command when it runs longer than this, like 10m")
+	offlineFlag  = globalFlags.Bool("offline", false, "Only use the database: search by text, show without images and queue uploads, like UME_OFFLINE")
+)
 
-// Command represents a subcommand with its name, description, and function
-type Command struct {
-	Name        string
-	Description string
-	Func        CommandFunc
-}
+// deadlineGrace is how long a command may run past its deadline before it is stopped,
+// for work that doesn't watch the deadline to fail on its own first
+const deadlineGrace = 5 * time.Second
 
 func main() {
-	// Define available commands
-	commands := []Command{
-		{
-			Name:        "lookup",
-			Description: "Search for text in the database (default if no command is specified)",
-			Func:        lookupCmd,
-		},
-		{
-			Name:        "upload",
-			Description: "Upload an image file, extract text, and store the results",
-			Func:        uploadCmd,
-		},
-		{
-			Name:        "edit",
-			Description: "Download and edit a card's markdown content",
-			Func:        editCmd,
-		},
-		{
-			Name:        "show",
-			Description: "Show a card's image and markdown content in the browser",
-			Func:        showCmd,
-		},
-		{
-			Name:        "delete",
-			Description: "Delete a card and all its associated data",
-			Func:        deleteCmd,
-		},
-		{
-			Name:        "help",
-			Description: "Show help information",
-			Func:        helpCmd,
-		},
-	}
+	globalFlags.Usage = showHelp
+	globalFlags.Parse(os.Args[1:])
+	args := globalFlags.Args()
 
-	// If no arguments provided, show help
-	if len(os.Args) < 2 {
-		fmt.Println("Error: No command or search query provided")
-		showHelp(commands)
-		os.Exit(1)
+	if *envFlag != "" {
+		if err := godotenv.Overload(*envFlag); err != nil {
+			fmt.Println(common.T(msgEnvLoadError, *envFlag, err))
+			os.Exit(1)
+		}
+	}
+	if *apiKeyFlag != "" {
+		os.Setenv("UME_API_KEY", *apiKeyFlag)
 	}
 
-	// Get the command or search query
-	cmdOrQuery := os.Args[1]
+	common.NoInput = *noInputFlag
+	common.Offline = *offlineFlag || os.Getenv("UME_OFFLINE") != ""
 
-	// Check if the user is asking for help
-	if cmdOrQuery == "-h" || cmdOrQuery == "--help" {
-		showHelp(commands)
-		return
+	common.CallTimeout = *timeoutFlag
+	if *deadlineFlag > 0 {
+		cancel := common.SetDeadline(*deadlineFlag)
+		defer cancel()
+		time.AfterFunc(*deadlineFlag+deadlineGrace, func() {
+			fmt.Println(common.T(msgDeadlineExceeded, *deadlineFlag))
+			os.Exit(exitDeadline)
+		})
 	}
 
-	// If asking for help about a specific command
-	if cmdOrQuery == "help" && len(os.Args) > 2 {
-		helpSubcommand := os.Args[2]
-		switch helpSubcommand {
-		case "lookup":
-			fmt.Println("Usage: ume lookup <search_query>")
-			fmt.Println("       ume <search_query>")
-			fmt.Println("\nSearch for text in the database and display the results.")
-			fmt.Println("\nThis command will:")
-			fmt.Println("1. Generate an embedding for your search query")
-			fmt.Println("2. Find text chunks in the database that are semantically similar")
-			fmt.Println("3. Display the top matching cards")
-			fmt.Println("4. Offer to display an image for a selected card")
-			return
-		case "upload":
-			fmt.Println("Usage: ume upload [--method=mistral|ocr|vision] [-l=language] <image_file>")
-			fmt.Println("\nUpload an image file, extract text, and store the results in the database.")
-			fmt.Println("\nOptions:")
-			fmt.Println("  --method=ocr      Use Azure OCR service(default)")
-			fmt.Println("  --method=mistral  Use Mistral OCR service")
-			fmt.Println("  --method=vision   Use OpenAI's Vision API")
-			fmt.Println("  -l, --lang        Language for OCR recognition (default: ja) - only applies to OCR method")
-			fmt.Println("                    Examples: en, de, fr, es, zh, ja")
-			fmt.Println("                    Full list: https://learn.microsoft.com/en-us/azure/ai-services/computer-vision/language-support#optical-character-recognition-ocr")
-			fmt.Println("\nThis command will:")
-			fmt.Println("1. Upload the image to storage")
-			fmt.Println("2. Extract text using the specified method (Mistral, OCR, or Vision)")
-			fmt.Println("3. Convert the result to markdown")
-			fmt.Println("4. Generate embeddings for the markdown content")
-			fmt.Println("5. Store everything in the database")
-			return
-		case "edit":
-			fmt.Println("Usage: ume edit [options] <card_id>")
-			fmt.Println("\nDownload and edit a card's markdown content.")
-			fmt.Println("\nOptions:")
-			fmt.Println("  -v, --verbose    Enable verbose output")
-			fmt.Println("\nThis command will:")
-			fmt.Println("1. Download the latest markdown version for the specified card")
-			fmt.Println("2. Open it in the neovim editor for you to edit")
-			fmt.Println("3. If you make changes, upload the new version")
-			fmt.Println("4. Generate new embeddings for the updated content")
-			return
-		case "delete":
-			fmt.Println("Usage: ume delete [options] <card_id>")
-			fmt.Println("\nDelete a card and all its associated data (images, markdown files, and embeddings).")
-			fmt.Println("\nOptions:")
-			fmt.Println("  -q, --quiet    Suppress confirmation and verbose output")
-			fmt.Println("\nThis command will:")
-			fmt.Println("1. Confirm you want to delete the card (unless --quiet is specified)")
-			fmt.Println("2. Delete object files from Minio storage (images and markdown)")
-			fmt.Println("3. Delete the card from the database (related data is cascade deleted)")
-			return
-		}
-	} else if cmdOrQuery == "help" {
-		showHelp(commands)
-		return
+	// Cards can be given by their UID or an alias wherever an ID is accepted
+	common.ResolveCardUID = resolveCardUID
+	common.ResolveCardAlias = resolveCardAlias
+
+	// If no arguments provided, show help
+	if len(args) == 0 {
+		fmt.Println(common.T(msgNoCommand))
+		showHelp()
+		os.Exit(exitUsage)
 	}
 
-	// Check if the first argument is a known command
-	var cmd *Command
-	for i, c := range commands {
-		if c.Name == cmdOrQuery {
-			cmd = &commands[i]
-			break
+	// The completion scripts ask for the candidates of the command line being completed
+	if args[0] == "__complete" {
+		if err := completeImpl(commands, args[1:]); err != nil {
+			os.Exit(1)
 		}
+		return
 	}
 
 	// If no command is found, assume it's a search query for the lookup command
+	cmd := findCommand(commands, args[0])
 	if cmd == nil {
-		// Use the lookup command with the original arguments
-		cmd = &commands[0] // lookup is the first command
+		cmd = commands[0] // lookup is the first command
 	}
 
 	// Execute the command
-	err := cmd.Func(os.Args[1:])
+	err := cmd.run(args)
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
 // showHelp displays the help information for all commands
-func showHelp(commands []Command) {
-	fmt.Printf("Usage: ume [command] [arguments]\n\n")
-	fmt.Println("Commands:")
+func showHelp() {
+	fmt.Printf("%s\n\n", common.T(msgHelpUsage))
+	fmt.Println(common.T(msgHelpCommands))
 	for _, cmd := range commands {
-		fmt.Printf("  %-10s %s\n", cmd.Name, cmd.Description)
+		fmt.Printf("  %-10s %s\n", cmd.Name, cmd.description())
 	}
-	fmt.Println("\nIf no command is specified, the input is treated as a search query for the lookup command.")
-	fmt.Println("Example: ume \"search query\" is equivalent to ume lookup \"search query\"")
+	fmt.Println("\n" + common.T(msgHelpGlobalOptions))
+	globalFlags.VisitAll(func(f *flag.Flag) {
+		fmt.Printf("  --%-8s %s\n", f.Name, common.T(common.Message{ID: "flag." + f.Name, Other: f.Usage}))
+	})
+	fmt.Println("\n" + common.T(msgHelpDefaultLookup))
+	fmt.Println(common.T(msgHelpLookupExample))
+	fmt.Println(common.T(msgHelpCommandHelp))
+	fmt.Println("\n" + common.T(msgHelpExitCodes))
 }
 
-// helpCmd shows the help information
+// helpCmd shows the help information of all commands, or of the command named by the arguments
 func helpCmd(args []string) error {
-	// Get available commands by recursively calling main()
-	commands := []Command{
-		{
-			Name:        "lookup",
-			Description: "Search for text in the database (default if no command is specified)",
-			Func:        lookupCmd,
-		},
-		{
-			Name:        "upload",
-			Description: "Upload an image file, extract text, and store the results",
-			Func:        uploadCmd,
-		},
-		{
-			Name:        "edit",
-			Description: "Download and edit a card's markdown content",
-			Func:        editCmd,
-		},
-		{
-			Name:        "show",
-			Description: "Show a card's image and markdown content in the browser",
-			Func:        showCmd,
-		},
-		{
-			Name:        "delete",
-			Description: "Delete a card and all its associated data",
-			Func:        deleteCmd,
-		},
-		{
-			Name:        "help",
-			Description: "Show help information",
-			Func:        helpCmd,
-		},
-	}
-
-	// If a specific command is specified, show help for that command
-	if len(args) > 1 {
-		cmdName := args[1]
-		fmt.Printf("Help for command: %s\n\n", cmdName)
-		for _, cmd := range commands {
-			if cmd.Name == cmdName {
-				switch cmdName {
-				case "lookup":
-					fmt.Println("Usage: ume lookup <search_query>")
-					fmt.Println("       ume <search_query>")
-					fmt.Println("\nSearch for text in the database and display the results.")
-					fmt.Println("\nThis command will:")
-					fmt.Println("1. Generate an embedding for your search query")
-					fmt.Println("2. Find text chunks in the database that are semantically similar")
-					fmt.Println("3. Display the top matching cards")
-					fmt.Println("4. Offer to display an image for a selected card")
-				case "upload":
-					fmt.Println("Usage: ume upload [--method=mistral|ocr|vision] [-l=language] <image_file>")
-					fmt.Println("\nUpload an image file, extract text, and store the results in the database.")
-					fmt.Println("\nOptions:")
-					fmt.Println("  --method=mistral  Use Mistral OCR service (default)")
-					fmt.Println("  --method=ocr      Use Azure OCR service")
-					fmt.Println("  --method=vision   Use OpenAI's Vision API")
-					fmt.Println("  -l, --lang        Language for OCR recognition (default: ja) - only applies to OCR method")
-					fmt.Println("                    Examples: en, de, fr, es, zh, ja")
-					fmt.Println("                    Full list: https://learn.microsoft.com/en-us/azure/ai-services/computer-vision/language-support#optical-character-recognition-ocr")
-					fmt.Println("\nThis command will:")
-					fmt.Println("1. Upload the image to storage")
-					fmt.Println("2. Extract text using the specified method (Mistral, OCR, or Vision)")
-					fmt.Println("3. Convert the result to markdown")
-					fmt.Println("4. Generate embeddings for the markdown content")
-					fmt.Println("5. Store everything in the database")
-				case "edit":
-					fmt.Println("Usage: ume edit [options] <card_id>")
-					fmt.Println("\nDownload and edit a card's markdown content.")
-					fmt.Println("\nOptions:")
-					fmt.Println("  -v, --verbose    Enable verbose output")
-					fmt.Println("\nThis command will:")
-					fmt.Println("1. Download the latest markdown version for the specified card")
-					fmt.Println("2. Open it in the neovim editor for you to edit")
-					fmt.Println("3. If you make changes, upload the new version")
-					fmt.Println("4. Generate new embeddings for the updated content")
-				case "delete":
-					fmt.Println("Usage: ume delete [options] <card_id>")
-					fmt.Println("\nDelete a card and all its associated data (images, markdown files, and embeddings).")
-					fmt.Println("\nOptions:")
-					fmt.Println("  -q, --quiet    Suppress confirmation and verbose output")
-					fmt.Println("\nThis command will:")
-					fmt.Println("1. Confirm you want to delete the card (unless --quiet is specified)")
-					fmt.Println("2. Delete object files from Minio storage (images and markdown)")
-					fmt.Println("3. Delete the card from the database (related data is cascade deleted)")
-				case "show":
-					fmt.Println("Usage: ume show [options] <card_id>")
-					fmt.Println("\nShow a card's image and markdown content in the browser.")
-					fmt.Println("\nOptions:")
-					fmt.Println("  -v, --version   Version number of markdown to display (default: latest)")
-					fmt.Println("  -l, --lang      Translate markdown to specified language")
-					fmt.Println("\nThis command will:")
-					fmt.Println("1. Retrieve the image and markdown content for the specified card")
-					fmt.Println("2. If --lang is specified, translate the markdown to the target language")
-					fmt.Println("3. Generate an HTML page with both the image and formatted markdown")
-					fmt.Println("4. Open the HTML page in your default browser")
-				}
-				return nil
-			}
+	if len(args) < 2 {
+		showHelp()
+		return nil
+	}
+
+	var cmd *Command
+	candidates := commands
+	for _, name := range args[1:] {
+		cmd = findCommand(candidates, name)
+		if cmd == nil {
+			return usageError{common.T(msgUnknownCommand, strings.Join(args[1:], " "))}
 		}
-		return fmt.Errorf("unknown command: %s", cmdName)
+		candidates = cmd.Subcommands
 	}
 
-	// Otherwise, show general help
-	showHelp(commands)
+	cmd.printHelp()
 	return nil
 }
 
 // lookupCmd handles the lookup command
 func lookupCmd(args []string) error {
-	// Process args based on whether this was called directly or as the default command
-	var searchQuery string
-
 	// If called as default (args[0] is not "lookup"), use args[0] as the search query
 	if args[0] != "lookup" {
-		searchQuery = args[0]
-	} else if len(args) > 1 {
-		// If called explicitly (args[0] is "lookup"), use args[1] as the search query
-		searchQuery = args[1]
-	} else {
-		// Not enough arguments
-		return fmt.Errorf("usage: ume lookup <search_query>\n       ume <search_query>")
+		fmt.Println(common.T(msgSearching, args[0]))
+		return lookupImpl(lookupRequest{Query: args[0], Page: 1}, false)
 	}
 
-	fmt.Printf("Searching for: \"%s\"\n", searchQuery)
-
 	// Initialize command-specific flags
-	// (no flags for lookup currently, but structure is here for future use)
 	lookupFlags := flag.NewFlagSet("lookup", flag.ExitOnError)
-	// Example flag: limit := lookupFlags.Int("limit", 10, "limit the number of results")
+	collectionFlag := lookupFlags.String("collection", "", "Only search the cards in this collection")
+	collectionShortFlag := lookupFlags.String("c", "", "Only search the cards in this collection")
+	sinceFlag := lookupFlags.String("since", "", "Only search cards created on or after a date (YYYY-MM-DD) or an age like 7d, 2w, 3m, 1y")
+	untilFlag := lookupFlags.String("until", "", "Only search cards created on or before a date (YYYY-MM-DD) or an age like 7d, 2w, 3m, 1y")
+	recencyFlag := lookupFlags.Int("recency", 0, "Rank newer cards higher, with a half-life in days")
+	expandFlag := lookupFlags.Bool("expand", false, "Also search paraphrases and translations of the query")
+	modelFlag := lookupFlags.String("model", "", "Search the chunks embedded with this model instead of the current one")
+	includeArchivedFlag := lookupFlags.Bool("include-archived", false, "Also search archived cards")
+	methodFlag := lookupFlags.String("method", "", "Only search the cards created with this method (ocr, mistral, vision, text or audio)")
+	allVersionsFlag := lookupFlags.Bool("all-versions", false, "Also search the earlier versions of the cards")
+	pageFlag := lookupFlags.Int("page", 1, "Show this page of results, 10 cards a page")
+	explainFlag := lookupFlags.Bool("explain", false, "Show how each result was scored")
+
+	// Parse the flags (skipping the first argument which is the command name)
+	lookupFlags.Parse(args[1:])
+
+	// If called explicitly (args[0] is "lookup"), the search query follows the flags
+	searchQuery := lookupFlags.Arg(0)
+	if searchQuery == "" {
+		// Not enough arguments
+		return fmt.Errorf("usage: ume lookup [--collection=name] [--since=date] [--until=date] [--recency=days] [--expand] [--model=name] [--method=name] [--all-versions] [--page=n] [--explain] <search_query>\n       ume <search_query>")
+	}
+
+	// If short flag is set but long flag is not, use short flag's value
+	collection := *collectionFlag
+	if collection == "" && *collectionShortFlag != "" {
+		collection = *collectionShortFlag
+	}
+
+	since, until, err := common.ParseTimeRange(*sinceFlag, *untilFlag, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if *recencyFlag < 0 {
+		return fmt.Errorf("recency must be a positive number of days")
+	}
+	recency := time.Duration(*recencyFlag) * 24 * time.Hour
 
-	// Parse the flags (skipping the first argument which is the command name or search query)
-	var flagArgs []string
-	if args[0] == "lookup" {
-		flagArgs = args[1:]
-	} else {
-		flagArgs = args[0:]
+	var method common.Method
+	if *methodFlag != "" {
+		method, err = common.ParseMethod(*methodFlag)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *pageFlag < 1 {
+		return fmt.Errorf("page must be a positive number")
 	}
 
-	// Just to handle potential flags in the future
-	lookupFlags.Parse(flagArgs)
+	fmt.Println(common.T(msgSearching, searchQuery))
 
 	// Implement the lookup functionality (from cmd/lookup/main.go)
 	// This is the actual command implementation
-	return lookupImpl(searchQuery)
+	return lookupImpl(lookupRequest{
+		Query:           searchQuery,
+		Collection:      collection,
+		Since:           since,
+		Until:           until,
+		Recency:         recency,
+		Expand:          *expandFlag,
+		Model:           *modelFlag,
+		IncludeArchived: *includeArchivedFlag,
+		Method:          method,
+		AllVersions:     *allVersionsFlag,
+		Page:            *pageFlag,
+	}, *explainFlag)
 }
 
 // uploadCmd handles the upload command
 func uploadCmd(args []string) error {
 	if len(args) < 2 {
-		return fmt.Errorf("usage: ume upload [--method=mistral|ocr|vision] [-l=language] <image_file>")
+		return fmt.Errorf("usage: ume upload [--method=mistral|ocr|vision|auto] [-l=language] [--handwriting] [--diagram] [--dry-run] [--async] <image_file>\n       ume upload [options] --url <image_url>\n       ume upload [options] --clipboard\n       ume upload [-l=language] [--normalize] --audio <audio_file>")
 	}
 
 	// Specify upload flags
 	uploadFlags := flag.NewFlagSet("upload", flag.ExitOnError)
-	methodFlag := uploadFlags.String("method", "ocr", "Method to use for text extraction: ocr (default), mistral, or vision")
-	langShortFlag := uploadFlags.String("l", "ja", "Language for OCR (default: ja)")
-	langLongFlag := uploadFlags.String("lang", "ja", "Language for OCR (default: ja). See supported languages at https://learn.microsoft.com/en-us/azure/ai-services/computer-vision/language-support#optical-character-recognition-ocr")
+	methodFlag := uploadFlags.String("method", "ocr", "Method to use for text extraction: ocr (default), mistral, vision, or auto")
+	langShortFlag := uploadFlags.String("l", common.AutoLanguage, "Language for OCR (default: auto)")
+	langLongFlag := uploadFlags.String("lang", common.AutoLanguage, "Language for OCR (default: auto, detected by the OCR service). See supported languages at https://learn.microsoft.com/en-us/azure/ai-services/computer-vision/language-support#optical-character-recognition-ocr")
+	normalizeFlag := uploadFlags.Bool("normalize", false, "Normalize the markdown before storing it")
+	handwritingFlag := uploadFlags.Bool("handwriting", false, "Use settings tuned for handwritten cards")
+	diagramFlag := uploadFlags.Bool("diagram", false, "Also describe what the diagrams of the image show")
+	urlFlag := uploadFlags.String("url", "", "Download the image from a URL instead of reading a file")
+	clipboardFlag := uploadFlags.Bool("clipboard", false, "Read the image from the system clipboard instead of a file")
+	audioFlag := uploadFlags.String("audio", "", "Create the card from a voice memo, transcribed with the speech-to-text service")
+	quietFlag := uploadFlags.Bool("q", false, "Only print the ID of the new card")
+	quietLongFlag := uploadFlags.Bool("quiet", false, "Only print the ID of the new card")
+	dryRunFlag := uploadFlags.Bool("dry-run", false, "Show the markdown, chunks and embedding cost without storing anything")
+	asyncFlag := uploadFlags.Bool("async", false, "Only upload the image and queue a job to process it with ume worker")
 
 	// Parse flags (skipping the first argument which is the command name)
 	uploadFlags.Parse(args[1:])
+	quiet := *quietFlag || *quietLongFlag
+
+	// Voice memos are transcribed instead of going through text extraction
+	if *audioFlag != "" {
+		if *dryRunFlag || *asyncFlag {
+			return fmt.Errorf("--dry-run and --async are not supported with --audio")
+		}
+		if uploadFlags.Arg(0) != "" || *urlFlag != "" || *clipboardFlag {
+			return fmt.Errorf("specify only one of a file, --url, --clipboard or --audio")
+		}
+		if *methodFlag != string(common.MethodOCR) || *handwritingFlag {
+			fmt.Println(common.T(msgAudioIgnoresOpts))
+		}
+
+		absPath, err := filepath.Abs(*audioFlag)
+		if err != nil {
+			return fmt.Errorf("error getting absolute path: %w", err)
+		}
+
+		language := *langShortFlag
+		if *langShortFlag == common.AutoLanguage && *langLongFlag != common.AutoLanguage {
+			language = *langLongFlag
+		}
+
+		_, err = audioImpl(absPath, language, *normalizeFlag, quiet)
+		return err
+	}
+
+	// Validate method flag
+	method, err := common.ParseUploadMethod(*methodFlag)
+	if err != nil {
+		return err
+	}
 
-	// Get the file path
+	// Get the file path, the image can come from a file, a URL or the clipboard
 	filePath := uploadFlags.Arg(0)
-	if filePath == "" {
+	sources := 0
+	for _, set := range []bool{filePath != "", *urlFlag != "", *clipboardFlag} {
+		if set {
+			sources++
+		}
+	}
+	if sources == 0 {
 		return fmt.Errorf("no file specified")
 	}
+	if sources > 1 {
+		return fmt.Errorf("specify only one of a file, --url or --clipboard")
+	}
+
+	if *urlFlag != "" || *clipboardFlag {
+		// Downloaded and pasted images are kept in a temporary directory until they are uploaded
+		tmpDir, err := os.MkdirTemp("", "ume_upload_")
+		if err != nil {
+			return fmt.Errorf("error creating temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		if *urlFlag != "" {
+			if !quiet {
+				fmt.Println(common.T(msgDownloading, *urlFlag))
+			}
+			filePath, err = downloadImage(*urlFlag, tmpDir)
+		} else {
+			filePath, err = clipboardImage(tmpDir)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
 	// Check if the file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -341,29 +311,71 @@ func uploadCmd(args []string) error {
 	// Get the absolute path of the file
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
-		return fmt.Errorf("error getting absolute path: %v", err)
-	}
-
-	// Validate method flag
-	method := *methodFlag
-	if method != "ocr" && method != "vision" && method != "mistral" {
-		return fmt.Errorf("invalid method: %s. Must be one of 'mistral', 'ocr', or 'vision'", method)
+		return fmt.Errorf("error getting absolute path: %w", err)
 	}
 
 	// Determine which language flag to use (prefer short flag if both are set to non-default)
-	// The language option is only relevant for the OCR method
+	// The language option is only relevant for the OCR method, which auto may pick
 	language := ""
-	if method == "ocr" {
+	if method == common.MethodOCR || method == common.MethodAuto {
 		language = *langShortFlag
-		if *langShortFlag == "ja" && *langLongFlag != "ja" {
+		if *langShortFlag == common.AutoLanguage && *langLongFlag != common.AutoLanguage {
 			language = *langLongFlag
 		}
-	} else if *langShortFlag != "ja" || *langLongFlag != "ja" {
-		fmt.Println("Note: The language option is only used with the OCR method and will be ignored.")
+	} else if *langShortFlag != common.AutoLanguage || *langLongFlag != common.AutoLanguage {
+		fmt.Println(common.T(msgLanguageIgnored))
+	}
+
+	if *dryRunFlag && *asyncFlag {
+		return fmt.Errorf("specify only one of --dry-run or --async")
+	}
+	job := uploadJob{Method: method, Language: language, Normalize: *normalizeFlag, Handwriting: *handwritingFlag, Diagram: *diagramFlag}
+	if *dryRunFlag {
+		return dryRunUploadImpl(absPath, job)
 	}
 
 	// Implement the upload functionality with the specified method and language
-	return uploadImpl(absPath, method, language)
+	_, err = uploadCard(absPath, job, nil, quiet, *asyncFlag)
+	return err
+}
+
+// compareOCRCmd handles the compare-ocr command
+func compareOCRCmd(args []string) error {
+	compareFlags := flag.NewFlagSet("compare-ocr", flag.ExitOnError)
+	methodsFlag := compareFlags.String("methods", "", "Comma-separated methods to compare (default: every configured method)")
+	langShortFlag := compareFlags.String("l", common.AutoLanguage, "Language for OCR (default: auto)")
+	langLongFlag := compareFlags.String("lang", common.AutoLanguage, "Language for OCR (default: auto)")
+	handwritingFlag := compareFlags.Bool("handwriting", false, "Use settings tuned for handwritten cards")
+	webFlag := compareFlags.Bool("web", false, "Show the results in the browser")
+	compareFlags.Parse(args[1:])
+
+	if compareFlags.NArg() != 1 {
+		return fmt.Errorf("usage: ume compare-ocr [--methods=mistral,ocr,vision] [-l=language] [--handwriting] [--web] <image_file>")
+	}
+
+	var methods []common.Method
+	if *methodsFlag != "" {
+		for _, name := range strings.Split(*methodsFlag, ",") {
+			method, err := common.ParseImageMethod(strings.TrimSpace(name))
+			if err != nil {
+				return err
+			}
+			methods = append(methods, method)
+		}
+	}
+
+	// If short flag is set but long flag is not, use short flag's value
+	language := *langShortFlag
+	if *langShortFlag == common.AutoLanguage && *langLongFlag != common.AutoLanguage {
+		language = *langLongFlag
+	}
+
+	absPath, err := filepath.Abs(compareFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("error getting absolute path: %w", err)
+	}
+
+	return compareOCRImpl(absPath, methods, language, *handwritingFlag, *webFlag)
 }
 
 // deleteCmd handles the delete command
@@ -372,14 +384,41 @@ func deleteCmd(args []string) error {
 		return fmt.Errorf("usage: ume delete [options] <card_id>")
 	}
 
-	// No flags for delete command
+	// Specify delete flags
 	deleteFlags := flag.NewFlagSet("delete", flag.ExitOnError)
 	quietFlag := deleteFlags.Bool("q", false, "Surpress verbose output")
 	quietLongFlag := deleteFlags.Bool("quiet", false, "Surpress verbose output")
+	trashFlag := deleteFlags.Bool("trash", false, "Move the card to the trash instead of deleting it")
+	beforeFlag := deleteFlags.String("before", "", "Delete all cards uploaded before this date (YYYY-MM-DD)")
+	collectionFlag := deleteFlags.String("collection", "", "Delete all cards in this collection")
+	tagFlag := deleteFlags.String("tag", "", "Delete all cards in this collection, same as --collection")
+	dryRunFlag := deleteFlags.Bool("dry-run", false, "Only show what would be deleted")
+	batchSizeFlag := deleteFlags.Int("batch-size", 50, "Number of cards deleted per transaction")
 
 	// Parse flags (skipping the first argument which is the command name)
 	deleteFlags.Parse(args[1:])
 
+	// Check if either quiet flag is set
+	quiet := *quietFlag || *quietLongFlag
+
+	collection := *collectionFlag
+	if collection == "" && *tagFlag != "" {
+		collection = *tagFlag
+	}
+
+	// Delete a set of cards selected by filters
+	if *beforeFlag != "" || collection != "" {
+		var before time.Time
+		if *beforeFlag != "" {
+			var err error
+			before, err = time.ParseInLocation("2006-01-02", *beforeFlag, time.Local)
+			if err != nil {
+				return fmt.Errorf("invalid date %q, expected YYYY-MM-DD: %w", *beforeFlag, err)
+			}
+		}
+		return bulkDeleteImpl(before, collection, *batchSizeFlag, *dryRunFlag, quiet, *trashFlag)
+	}
+
 	// Get the card ID
 	cardIDStr := deleteFlags.Arg(0)
 	if cardIDStr == "" {
@@ -389,14 +428,11 @@ func deleteCmd(args []string) error {
 	// Parse the card ID
 	cardID, err := common.ParseCardIDString(cardIDStr)
 	if err != nil {
-		return fmt.Errorf("invalid card ID: %v", err)
+		return fmt.Errorf("invalid card ID: %w", err)
 	}
 
-	// Check if either quiet flag is set
-	quiet := *quietFlag || *quietLongFlag
-
 	// Implement the delete functionality
-	return deleteImpl(cardID, quiet)
+	return deleteImpl(cardID, quiet, *trashFlag)
 }
 
 // editCmd handles the edit command
@@ -409,6 +445,13 @@ func editCmd(args []string) error {
 	editFlags := flag.NewFlagSet("edit", flag.ExitOnError)
 	verboseFlag := editFlags.Bool("v", false, "Enable verbose output")
 	verboseLongFlag := editFlags.Bool("verbose", false, "Enable verbose output")
+	versionFlag := editFlags.Int("version", -1, "Version to edit and branch from (default: latest)")
+	normalizeFlag := editFlags.Bool("normalize", false, "Normalize the markdown before saving it")
+	quietFlag := editFlags.Bool("q", false, "Suppress progress and output")
+	quietLongFlag := editFlags.Bool("quiet", false, "Suppress progress and output")
+	stdinFlag := editFlags.Bool("stdin", false, "Read the new content from stdin instead of opening an editor")
+	replaceFlag := editFlags.Bool("replace", false, "Same as --stdin")
+	stdoutFlag := editFlags.Bool("stdout", false, "Print the content to stdout instead of opening an editor")
 
 	// Parse flags (skipping the first argument which is the command name)
 	editFlags.Parse(args[1:])
@@ -422,19 +465,1077 @@ func editCmd(args []string) error {
 	// Parse the card ID
 	cardID, err := common.ParseCardIDString(cardIDStr)
 	if err != nil {
-		return fmt.Errorf("invalid card ID: %v", err)
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	// The content is printed to be edited by a script and saved again with --stdin
+	if *stdoutFlag {
+		content, err := cardMarkdown(cardID, *versionFlag)
+		if err != nil {
+			return err
+		}
+		fmt.Print(content)
+		return nil
 	}
 
 	// Check if either verbose flag is set
 	verbose := *verboseFlag || *verboseLongFlag
 
 	// Implement the edit functionality with verbose flag
-	return editImpl(cardID, verbose)
+	return editImpl(cardID, *versionFlag, *normalizeFlag, verbose, *quietFlag || *quietLongFlag, *stdinFlag || *replaceFlag)
 }
 
-// Implementation functions are defined in separate files:
-// - lookup.go: lookupImpl
-// - upload.go: uploadImpl
-// - edit.go:   editImpl
-// - delete.go: deleteImpl
+// historyCmd handles the history command
+func historyCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume history <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return historyImpl(cardID)
+}
+
+// objectHistoryCmd handles the object-history command
+func objectHistoryCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume object-history <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return objectHistoryImpl(cardID)
+}
+
+// exportCmd handles the export command
+func exportCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume export [options] <card_id>")
+	}
+
+	// Specify export flags
+	exportFlags := flag.NewFlagSet("export", flag.ExitOnError)
+	formatFlag := exportFlags.String("format", "html", "Output format: html, pdf or md")
+	versionFlag := exportFlags.Int("version", -1, "Version number of markdown file (default: latest)")
+	versionShortFlag := exportFlags.Int("v", -1, "Version number of markdown file (default: latest)")
+	outputFlag := exportFlags.String("output", "", "Output file")
+	outputShortFlag := exportFlags.String("o", "", "Output file")
+
+	// Parse flags (skipping the first argument which is the command name)
+	exportFlags.Parse(args[1:])
+
+	// Get the card ID
+	cardIDStr := exportFlags.Arg(0)
+	if cardIDStr == "" {
+		return fmt.Errorf("no card ID specified")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(cardIDStr)
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	// If short flag is set but long flag is not, use short flag's value
+	version := *versionFlag
+	if version == -1 && *versionShortFlag != -1 {
+		version = *versionShortFlag
+	}
+
+	output := *outputFlag
+	if output == "" {
+		output = *outputShortFlag
+	}
+
+	return exportImpl(cardID, version, *formatFlag, output)
+}
+
+// translateCmd handles the translate command
+func translateCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume translate [options] <card_id>")
+	}
+
+	// Specify translate flags
+	translateFlags := flag.NewFlagSet("translate", flag.ExitOnError)
+	langFlag := translateFlags.String("lang", "", "Language to translate to")
+	langShortFlag := translateFlags.String("l", "", "Language to translate to")
+	versionFlag := translateFlags.Int("version", -1, "Version number of markdown file (default: latest)")
+	versionShortFlag := translateFlags.Int("v", -1, "Version number of markdown file (default: latest)")
+	forceFlag := translateFlags.Bool("force", false, "Translate again even if a stored translation exists")
+	embedFlag := translateFlags.Bool("embed", false, "Also embed the translated chunks for search")
+
+	// Parse flags (skipping the first argument which is the command name)
+	translateFlags.Parse(args[1:])
+
+	// Get the card ID
+	cardIDStr := translateFlags.Arg(0)
+	if cardIDStr == "" {
+		return fmt.Errorf("no card ID specified")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(cardIDStr)
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	// If short flag is set but long flag is not, use short flag's value
+	lang := *langFlag
+	if lang == "" {
+		lang = *langShortFlag
+	}
+	if lang == "" {
+		return fmt.Errorf("no language specified, use --lang")
+	}
+
+	version := *versionFlag
+	if version == -1 && *versionShortFlag != -1 {
+		version = *versionShortFlag
+	}
+
+	return translateImpl(cardID, version, lang, *forceFlag, *embedFlag)
+}
+
+// listCmd handles the list command
+func listCmd(args []string) error {
+	// Specify list flags
+	listFlags := flag.NewFlagSet("list", flag.ExitOnError)
+	collectionFlag := listFlags.String("collection", "", "Only list the cards in this collection")
+	collectionShortFlag := listFlags.String("c", "", "Only list the cards in this collection")
+	includeArchivedFlag := listFlags.Bool("include-archived", false, "Also list archived cards")
+
+	// Parse flags (skipping the first argument which is the command name)
+	listFlags.Parse(args[1:])
+
+	// If short flag is set but long flag is not, use short flag's value
+	collection := *collectionFlag
+	if collection == "" && *collectionShortFlag != "" {
+		collection = *collectionShortFlag
+	}
+
+	return listImpl(collection, *includeArchivedFlag)
+}
+
+// reviewQueueCmd handles the review-queue command
+func reviewQueueCmd(args []string) error {
+	// Specify review-queue flags
+	queueFlags := flag.NewFlagSet("review-queue", flag.ExitOnError)
+	doneFlag := queueFlags.String("done", "", "Remove a card from the queue without editing it")
+
+	// Parse flags (skipping the first argument which is the command name)
+	queueFlags.Parse(args[1:])
+
+	done := 0
+	if *doneFlag != "" {
+		cardID, err := common.ParseCardIDString(*doneFlag)
+		if err != nil {
+			return fmt.Errorf("invalid card ID: %w", err)
+		}
+		done = cardID
+	}
+
+	return reviewQueueImpl(done)
+}
+
+// verifyCmd handles the verify command
+func verifyCmd(args []string) error {
+	return verifyImpl()
+}
+
+// configSetSecretCmd handles the config set-secret command
+func configSetSecretCmd(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ume config set-secret <name>")
+	}
+	return configSetSecretImpl(args[1])
+}
+
+// configDeleteSecretCmd handles the config delete-secret command
+func configDeleteSecretCmd(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ume config delete-secret <name>")
+	}
+	return configDeleteSecretImpl(args[1])
+}
+
+// catCmd handles the cat command
+func catCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume cat [options] <card_id>")
+	}
+
+	catFlags := flag.NewFlagSet("cat", flag.ExitOnError)
+	versionFlag := catFlags.Int("version", -1, "Version number of markdown file (default: latest)")
+	versionShortFlag := catFlags.Int("v", -1, "Version number of markdown file (default: latest)")
+	catFlags.Parse(args[1:])
+
+	cardID, err := common.ParseCardIDString(catFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	// If short flag is set but long flag is not, use short flag's value
+	version := *versionFlag
+	if version == -1 && *versionShortFlag != -1 {
+		version = *versionShortFlag
+	}
+
+	return catImpl(cardID, version)
+}
+
+// publishCmd handles the publish command
+func publishCmd(args []string) error {
+	publishFlags := flag.NewFlagSet("publish", flag.ExitOnError)
+	collectionFlag := publishFlags.String("collection", "", "Only publish the cards in this collection")
+	collectionShortFlag := publishFlags.String("c", "", "Only publish the cards in this collection")
+	publishFlags.Parse(args[1:])
+
+	if publishFlags.NArg() != 1 {
+		return fmt.Errorf("usage: ume publish [--collection=name] <dir>")
+	}
+
+	// If short flag is set but long flag is not, use short flag's value
+	collection := *collectionFlag
+	if collection == "" && *collectionShortFlag != "" {
+		collection = *collectionShortFlag
+	}
+
+	return publishImpl(publishFlags.Arg(0), collection)
+}
+
+// importCmd handles the import command
+func importCmd(args []string) error {
+	importFlags := flag.NewFlagSet("import", flag.ExitOnError)
+	notionFlag := importFlags.String("notion", "", "Notion \"Markdown & CSV\" export zip")
+	gdocsFlag := importFlags.String("gdocs", "", "Google Drive or Takeout export zip")
+	normalizeFlag := importFlags.Bool("normalize", false, "Normalize the markdown before storing it")
+	importFlags.Parse(args[1:])
+
+	switch {
+	case *notionFlag != "" && *gdocsFlag == "":
+		return importImpl("notion", *notionFlag, *normalizeFlag)
+	case *gdocsFlag != "" && *notionFlag == "":
+		return importImpl("gdocs", *gdocsFlag, *normalizeFlag)
+	}
+	return fmt.Errorf("usage: ume import --notion <export.zip> | --gdocs <export.zip>")
+}
+
+// syncRemoteCmd handles the sync remote command
+func syncRemoteCmd(args []string) error {
+	syncFlags := flag.NewFlagSet("sync remote", flag.ExitOnError)
+	dryRunFlag := syncFlags.Bool("dry-run", false, "Only print what would be copied")
+	syncFlags.Parse(args[1:])
+
+	if syncFlags.NArg() != 1 {
+		return fmt.Errorf("usage: ume sync remote [--dry-run] <url>")
+	}
+	return syncRemoteImpl(syncFlags.Arg(0), *dryRunFlag)
+}
+
+// cleanTmpCmd handles the clean-tmp command
+func cleanTmpCmd(args []string) error {
+	cleanFlags := flag.NewFlagSet("clean-tmp", flag.ExitOnError)
+	olderThanFlag := cleanFlags.Duration("older-than", 24*time.Hour, "Only remove files last modified longer ago than this")
+	cleanFlags.Parse(args[1:])
+
+	if cleanFlags.NArg() != 0 {
+		return fmt.Errorf("usage: ume clean-tmp [--older-than=24h]")
+	}
+	return cleanTmpImpl(*olderThanFlag)
+}
+
+// migrateEmbeddingsCmd handles the migrate-embeddings command
+func migrateEmbeddingsCmd(args []string) error {
+	migrateFlags := flag.NewFlagSet("migrate-embeddings", flag.ExitOnError)
+	precisionFlag := migrateFlags.String("precision", "", "Store embeddings with full or half precision")
+	yesFlag := migrateFlags.Bool("yes", false, "Convert without asking for confirmation")
+	migrateFlags.Parse(args[1:])
+
+	precisions := map[string]string{"full": common.PrecisionFull, "half": common.PrecisionHalf}
+	precision, ok := precisions[*precisionFlag]
+	if !ok || migrateFlags.NArg() != 0 {
+		return fmt.Errorf("usage: ume migrate-embeddings --precision=<full|half> [--yes]")
+	}
+	return migrateEmbeddingsImpl(precision, *yesFlag)
+}
+
+// resumeCmd handles the resume command
+func resumeCmd(args []string) error {
+	resumeFlags := flag.NewFlagSet("resume", flag.ExitOnError)
+	allFlag := resumeFlags.Bool("all", false, "Resume every interrupted upload")
+	quietFlag := resumeFlags.Bool("q", false, "Don't show the stages")
+	quietLongFlag := resumeFlags.Bool("quiet", false, "Don't show the stages")
+	resumeFlags.Parse(args[1:])
+	quiet := *quietFlag || *quietLongFlag
+
+	if *allFlag {
+		if resumeFlags.NArg() != 0 {
+			return fmt.Errorf("specify only one of a card ID or --all")
+		}
+		return resumeImpl(0, true, quiet)
+	}
+
+	if resumeFlags.NArg() != 1 {
+		return fmt.Errorf("usage: ume resume [-q] <card_id|--all>")
+	}
+	cardID, err := common.ParseCardIDString(resumeFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+	return resumeImpl(cardID, false, quiet)
+}
+
+// workerCmd handles the worker command
+func workerCmd(args []string) error {
+	workerFlags := flag.NewFlagSet("worker", flag.ExitOnError)
+	pollFlag := workerFlags.Duration("poll", 5*time.Second, "How often to check for new jobs when the queue is empty")
+	onceFlag := workerFlags.Bool("once", false, "Stop when the queue is empty")
+	workerFlags.Parse(args[1:])
+
+	if workerFlags.NArg() != 0 || *pollFlag <= 0 {
+		return fmt.Errorf("usage: ume worker [--poll=5s] [--once]")
+	}
+	return workerImpl(*pollFlag, *onceFlag)
+}
+
+// daemonCmd handles the daemon command
+func daemonCmd(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ume daemon")
+	}
+	return daemonImpl()
+}
+
+// cacheStatsCmd handles the cache stats command
+func cacheStatsCmd(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ume cache stats")
+	}
+	return cacheStatsImpl()
+}
 
+// cacheClearCmd handles the cache clear command
+func cacheClearCmd(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ume cache clear")
+	}
+	return cacheClearImpl()
+}
+
+// jobsListCmd handles the jobs list command
+func jobsListCmd(args []string) error {
+	listFlags := flag.NewFlagSet("jobs list", flag.ExitOnError)
+	statusFlag := listFlags.String("status", "", "Only list the jobs with this status: queued, running, done or failed")
+	limitFlag := listFlags.Int("limit", 20, "Maximum number of jobs to list")
+	listFlags.Parse(args[1:])
+
+	switch *statusFlag {
+	case "", "queued", "running", "done", "failed":
+	default:
+		return fmt.Errorf("invalid status: %s. Must be one of 'queued', 'running', 'done' or 'failed'", *statusFlag)
+	}
+	if listFlags.NArg() != 0 || *limitFlag <= 0 {
+		return fmt.Errorf("usage: ume jobs list [--status=queued|running|done|failed] [--limit=20]")
+	}
+	return jobsListImpl(*statusFlag, *limitFlag)
+}
+
+// jobsRetryCmd handles the jobs retry command
+func jobsRetryCmd(args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("usage: ume jobs retry [job_id]")
+	}
+
+	jobID := 0
+	if len(args) == 2 {
+		id, err := strconv.Atoi(args[1])
+		if err != nil || id <= 0 {
+			return fmt.Errorf("invalid job ID: %s", args[1])
+		}
+		jobID = id
+	}
+	return jobsRetryImpl(jobID)
+}
+
+// graphCmd handles the graph command
+func graphCmd(args []string) error {
+	graphFlags := flag.NewFlagSet("graph", flag.ExitOnError)
+	formatFlag := graphFlags.String("format", "dot", "Format of the graph: dot or json")
+	outputFlag := graphFlags.String("output", "", "File to write the graph to (default: stdout)")
+	outputShortFlag := graphFlags.String("o", "", "File to write the graph to (default: stdout)")
+	collectionFlag := graphFlags.String("collection", "", "Only include the cards in this collection")
+	collectionShortFlag := graphFlags.String("c", "", "Only include the cards in this collection")
+	minSimilarityFlag := graphFlags.Float64("min-similarity", defaultMinSimilarity, "Join cards at least this similar, from -1 to 1")
+	webFlag := graphFlags.Bool("web", false, "Show an interactive graph in the browser")
+	graphFlags.Parse(args[1:])
+
+	// If short flag is set but long flag is not, use short flag's value
+	output := *outputFlag
+	if output == "" && *outputShortFlag != "" {
+		output = *outputShortFlag
+	}
+	collection := *collectionFlag
+	if collection == "" && *collectionShortFlag != "" {
+		collection = *collectionShortFlag
+	}
+
+	if *formatFlag != "dot" && *formatFlag != "json" {
+		return fmt.Errorf("invalid format: %s. Must be 'dot' or 'json'", *formatFlag)
+	}
+	if *minSimilarityFlag < -1 || *minSimilarityFlag > 1 {
+		return fmt.Errorf("invalid minimum similarity: %g. Must be from -1 to 1", *minSimilarityFlag)
+	}
+	if graphFlags.NArg() != 0 {
+		return fmt.Errorf("usage: ume graph [--format=dot|json] [--output=file] [--collection=name] [--min-similarity=0.6] [--web]")
+	}
+
+	return graphImpl(*formatFlag, output, collection, *minSimilarityFlag, *webFlag)
+}
+
+// composeCmd handles the compose command
+func composeCmd(args []string) error {
+	composeFlags := flag.NewFlagSet("compose", flag.ExitOnError)
+	titleFlag := composeFlags.String("title", "", "Title of the document, the collection or the first card by default")
+	titleShortFlag := composeFlags.String("t", "", "Title of the document, the collection or the first card by default")
+	collectionFlag := composeFlags.String("collection", "", "Compose the cards in this collection")
+	collectionShortFlag := composeFlags.String("c", "", "Compose the cards in this collection")
+	arrangeFlag := composeFlags.Bool("arrange", false, "Order the cards in the editor before composing")
+	smoothFlag := composeFlags.Bool("smooth", false, "Smooth the transitions between the cards with the chat model")
+	dryRunFlag := composeFlags.Bool("dry-run", false, "Only print the document, without storing it")
+	composeFlags.Parse(args[1:])
+
+	// If short flag is set but long flag is not, use short flag's value
+	title := *titleFlag
+	if title == "" && *titleShortFlag != "" {
+		title = *titleShortFlag
+	}
+	collection := *collectionFlag
+	if collection == "" && *collectionShortFlag != "" {
+		collection = *collectionShortFlag
+	}
+
+	if composeFlags.NArg() == 0 && collection == "" {
+		return fmt.Errorf("usage: ume compose [--title=title] [--collection=name] [--arrange] [--smooth] [--dry-run] [card_id...]")
+	}
+
+	// Parse the card IDs, in the order of the document
+	var cardIDs []int
+	for _, arg := range composeFlags.Args() {
+		cardID, err := common.ParseCardIDString(arg)
+		if err != nil {
+			return fmt.Errorf("invalid card ID: %w", err)
+		}
+		cardIDs = append(cardIDs, cardID)
+	}
+
+	return composeImpl(cardIDs, collection, title, *arrangeFlag, *smoothFlag, *dryRunFlag)
+}
+
+// documentsListCmd handles the documents list command
+func documentsListCmd(args []string) error {
+	return documentsListImpl()
+}
+
+// parseDocumentID parses the document ID argument of the documents subcommands
+func parseDocumentID(args []string, usage string) (int, error) {
+	if len(args) != 2 {
+		return 0, fmt.Errorf("usage: %s", usage)
+	}
+	id, err := strconv.Atoi(args[1])
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid document ID: %s", args[1])
+	}
+	return id, nil
+}
+
+// documentsCatCmd handles the documents cat command
+func documentsCatCmd(args []string) error {
+	documentID, err := parseDocumentID(args, "ume documents cat <document_id>")
+	if err != nil {
+		return err
+	}
+	return documentsCatImpl(documentID)
+}
+
+// documentsCardsCmd handles the documents cards command
+func documentsCardsCmd(args []string) error {
+	documentID, err := parseDocumentID(args, "ume documents cards <document_id>")
+	if err != nil {
+		return err
+	}
+	return documentsCardsImpl(documentID)
+}
+
+// aliasCmd handles the alias command
+func aliasCmd(args []string) error {
+	aliasFlags := flag.NewFlagSet("alias", flag.ExitOnError)
+	deleteFlag := aliasFlags.Bool("delete", false, "Delete the alias")
+	forceFlag := aliasFlags.Bool("force", false, "Move the alias from the card it was given to")
+	aliasFlags.Parse(args[1:])
+
+	switch {
+	case *deleteFlag && aliasFlags.NArg() == 1:
+		return aliasDeleteImpl(aliasFlags.Arg(0))
+	case !*deleteFlag && aliasFlags.NArg() == 0:
+		return aliasListImpl()
+	case !*deleteFlag && aliasFlags.NArg() == 2:
+		cardID, err := common.ParseCardIDString(aliasFlags.Arg(0))
+		if err != nil {
+			return fmt.Errorf("invalid card ID: %w", err)
+		}
+		return aliasImpl(cardID, aliasFlags.Arg(1), *forceFlag)
+	}
+	return fmt.Errorf("usage: ume alias [--force] <card_id> <alias>, ume alias --delete <alias> or ume alias")
+}
+
+// pinCmd handles the pin command
+func pinCmd(args []string) error {
+	pinFlags := flag.NewFlagSet("pin", flag.ExitOnError)
+	removeFlag := pinFlags.Bool("remove", false, "Unpin the card")
+	pinFlags.Parse(args[1:])
+
+	if pinFlags.NArg() != 1 {
+		return fmt.Errorf("usage: ume pin [--remove] <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(pinFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return pinImpl(cardID, *removeFlag)
+}
+
+// pinsCmd handles the pins command
+func pinsCmd(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ume pins")
+	}
+	return pinsImpl()
+}
+
+// archiveCmd handles the archive command
+func archiveCmd(args []string) error {
+	archiveFlags := flag.NewFlagSet("archive", flag.ExitOnError)
+	restoreFlag := archiveFlags.Bool("restore", false, "Take the card out of the archive")
+	archiveFlags.Parse(args[1:])
+
+	if archiveFlags.NArg() != 1 {
+		return fmt.Errorf("usage: ume archive [--restore] <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(archiveFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return archiveImpl(cardID, !*restoreFlag)
+}
+
+// attachCmd handles the attach command
+func attachCmd(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: ume attach <card_id> <file>...")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return attachImpl(cardID, args[2:])
+}
+
+// detachCmd handles the detach command
+func detachCmd(args []string) error {
+	detachFlags := flag.NewFlagSet("detach", flag.ExitOnError)
+	yesFlag := detachFlags.Bool("yes", false, "Delete without asking for confirmation")
+	detachFlags.Parse(args[1:])
+
+	if detachFlags.NArg() != 2 {
+		return fmt.Errorf("usage: ume detach [--yes] <card_id> <filename>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(detachFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return detachImpl(cardID, detachFlags.Arg(1), *yesFlag)
+}
+
+// listAttachmentsCmd handles the list-attachments command
+func listAttachmentsCmd(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ume list-attachments <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return listAttachmentsImpl(cardID)
+}
+
+// metaSetCmd handles the meta set command
+func metaSetCmd(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: ume meta set <card_id> field=value...")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return metaSetImpl(cardID, args[2:])
+}
+
+// metaShowCmd handles the meta show command
+func metaShowCmd(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ume meta show <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return metaShowImpl(cardID)
+}
+
+// renameCmd handles the rename command
+func renameCmd(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: ume rename <card_id> <title>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	// Allow the title to be given without quotes
+	title := strings.Join(args[2:], " ")
+
+	return renameImpl(cardID, title)
+}
+
+// linksCmd handles the links command
+func linksCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume links <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return linksImpl(cardID)
+}
+
+// relatedCmd handles the related command
+func relatedCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume related [options] <card_id>")
+	}
+
+	// Specify related flags
+	relatedFlags := flag.NewFlagSet("related", flag.ExitOnError)
+	limitFlag := relatedFlags.Int("limit", 10, "Number of related cards to show")
+	limitShortFlag := relatedFlags.Int("n", 10, "Number of related cards to show")
+
+	// Parse flags (skipping the first argument which is the command name)
+	relatedFlags.Parse(args[1:])
+
+	// Get the card ID
+	cardIDStr := relatedFlags.Arg(0)
+	if cardIDStr == "" {
+		return fmt.Errorf("no card ID specified")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(cardIDStr)
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	// If short flag is set but long flag is not, use short flag's value
+	limit := *limitFlag
+	if limit == 10 && *limitShortFlag != 10 {
+		limit = *limitShortFlag
+	}
+
+	return relatedImpl(cardID, limit)
+}
+
+// mapCmd handles the map command
+func mapCmd(args []string) error {
+	// Specify map flags
+	mapFlags := flag.NewFlagSet("map", flag.ExitOnError)
+	kFlag := mapFlags.Int("k", 0, "Number of topics (default: based on the number of cards)")
+	noLabelsFlag := mapFlags.Bool("no-labels", false, "Don't label topics with the chat API")
+
+	// Parse flags (skipping the first argument which is the command name)
+	mapFlags.Parse(args[1:])
+
+	return mapImpl(*kFlag, !*noLabelsFlag)
+}
+
+// reviewCmd handles the review command
+func reviewCmd(args []string) error {
+	// Specify review flags
+	reviewFlags := flag.NewFlagSet("review", flag.ExitOnError)
+	limitFlag := reviewFlags.Int("limit", 20, "Maximum number of cards to review")
+	limitShortFlag := reviewFlags.Int("n", 20, "Maximum number of cards to review")
+	langFlag := reviewFlags.String("lang", "", "Show cards translated to the specified language")
+	langShortFlag := reviewFlags.String("l", "", "Show cards translated to the specified language")
+
+	// Parse flags (skipping the first argument which is the command name)
+	reviewFlags.Parse(args[1:])
+
+	// If short flag is set but long flag is not, use short flag's value
+	limit := *limitFlag
+	if limit == 20 && *limitShortFlag != 20 {
+		limit = *limitShortFlag
+	}
+
+	lang := *langFlag
+	if lang == "" && *langShortFlag != "" {
+		lang = *langShortFlag
+	}
+
+	return reviewImpl(limit, lang)
+}
+
+// trashListCmd handles the trash list command
+func trashListCmd(args []string) error {
+	return trashListImpl()
+}
+
+// trashRestoreCmd handles the trash restore command
+func trashRestoreCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume trash restore <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return trashRestoreImpl(cardID)
+}
+
+// trashEmptyCmd handles the trash empty command
+func trashEmptyCmd(args []string) error {
+	// Specify empty flags
+	emptyFlags := flag.NewFlagSet("trash empty", flag.ExitOnError)
+	quietFlag := emptyFlags.Bool("q", false, "Surpress confirmation and verbose output")
+	quietLongFlag := emptyFlags.Bool("quiet", false, "Surpress confirmation and verbose output")
+	emptyFlags.Parse(args[1:])
+
+	return trashEmptyImpl(*quietFlag || *quietLongFlag)
+}
+
+// tuiCmd handles the tui command
+func tuiCmd(args []string) error {
+	return tuiImpl(strings.Join(args[1:], " "))
+}
+
+// botCmd handles the bot command
+func botCmd(args []string) error {
+	// Specify bot flags
+	botFlags := flag.NewFlagSet("bot", flag.ExitOnError)
+	addrFlag := botFlags.String("addr", ":8080", "Address to listen on for Slack requests")
+	methodFlag := botFlags.String("method", "ocr", "Method to use for text extraction of posted images: ocr (default), mistral, vision, or auto")
+	langFlag := botFlags.String("lang", common.AutoLanguage, "Language for OCR (default: auto)")
+
+	// Parse flags (skipping the first argument which is the command name)
+	botFlags.Parse(args[1:])
+
+	// Validate method flag
+	method, err := common.ParseUploadMethod(*methodFlag)
+	if err != nil {
+		return err
+	}
+
+	// The language option is only relevant for the OCR method, which auto may pick
+	language := ""
+	if method == common.MethodOCR || method == common.MethodAuto {
+		language = *langFlag
+	}
+
+	return botImpl(*addrFlag, method, language)
+}
+
+// serveCmd handles the serve command
+func serveCmd(args []string) error {
+	// Specify serve flags
+	serveFlags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addrFlag := serveFlags.String("addr", ":8080", "Address to listen on")
+	langFlag := serveFlags.String("lang", "", "Translate cards to the specified language")
+	langShortFlag := serveFlags.String("l", "", "Translate cards to the specified language")
+
+	// Parse flags (skipping the first argument which is the command name)
+	serveFlags.Parse(args[1:])
+
+	// If short flag is set but long flag is not, use short flag's value
+	lang := *langFlag
+	if lang == "" && *langShortFlag != "" {
+		lang = *langShortFlag
+	}
+
+	return serveImpl(*addrFlag, lang)
+}
+
+// userAddCmd handles the user add command
+func userAddCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume user add <name>")
+	}
+	return userAddImpl(strings.Join(args[1:], " "))
+}
+
+// userListCmd handles the user list command
+func userListCmd(args []string) error {
+	return userListImpl()
+}
+
+// collectionCreateCmd handles the collection create command
+func collectionCreateCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume collection create <name>")
+	}
+	return collectionCreateImpl(args[1])
+}
+
+// collectionAddCmd handles the collection add command
+func collectionAddCmd(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: ume collection add <name> <card_id>...")
+	}
+
+	// Parse the card IDs
+	var cardIDs []int
+	for _, arg := range args[2:] {
+		cardID, err := common.ParseCardIDString(arg)
+		if err != nil {
+			return fmt.Errorf("invalid card ID: %w", err)
+		}
+		cardIDs = append(cardIDs, cardID)
+	}
+
+	return collectionAddImpl(args[1], cardIDs)
+}
+
+// collectionShareCmd handles the collection share command
+func collectionShareCmd(args []string) error {
+	// Specify share flags
+	shareFlags := flag.NewFlagSet("collection share", flag.ExitOnError)
+	writeFlag := shareFlags.Bool("write", false, "Allow the user to add cards to the collection")
+	shareFlags.Parse(args[1:])
+
+	if shareFlags.NArg() < 2 {
+		return fmt.Errorf("usage: ume collection share [--write] <name> <user>")
+	}
+
+	return collectionShareImpl(shareFlags.Arg(0), shareFlags.Arg(1), *writeFlag)
+}
+
+// collectionListCmd handles the collection list command
+func collectionListCmd(args []string) error {
+	return collectionListImpl()
+}
+
+// reconvertCmd handles the reconvert command
+func reconvertCmd(args []string) error {
+	// Specify reconvert flags
+	reconvertFlags := flag.NewFlagSet("reconvert", flag.ExitOnError)
+	modelFlag := reconvertFlags.String("model", common.Ocr2mdModel, "Model used to convert the OCR result to markdown")
+	normalizeFlag := reconvertFlags.Bool("normalize", false, "Normalize the markdown before storing it")
+	quietFlag := reconvertFlags.Bool("q", false, "Only print the new version")
+	quietLongFlag := reconvertFlags.Bool("quiet", false, "Only print the new version")
+
+	// Parse flags (skipping the first argument which is the command name)
+	reconvertFlags.Parse(args[1:])
+
+	if reconvertFlags.NArg() < 1 {
+		return fmt.Errorf("usage: ume reconvert [options] <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(reconvertFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return reconvertImpl(cardID, *modelFlag, *normalizeFlag, *quietFlag || *quietLongFlag)
+}
+
+// newCmd handles the new command
+func newCmd(args []string) error {
+	// Specify new flags
+	newFlags := flag.NewFlagSet("new", flag.ExitOnError)
+	normalizeFlag := newFlags.Bool("normalize", false, "Normalize the markdown before storing it")
+
+	// Parse flags (skipping the first argument which is the command name)
+	newFlags.Parse(args[1:])
+
+	var content []byte
+	var err error
+	switch newFlags.Arg(0) {
+	case "-":
+		// Read the markdown from stdin
+		content, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("error reading stdin: %w", err)
+		}
+	case "":
+		// Write the markdown in the editor
+		tmpFile, err := os.CreateTemp("", "ume_new_*.md")
+		if err != nil {
+			return fmt.Errorf("error creating temporary file: %w", err)
+		}
+		tmpFile.Close()
+		defer os.Remove(tmpFile.Name())
+
+		if err := openInEditor(tmpFile.Name()); err != nil {
+			return err
+		}
+
+		content, err = os.ReadFile(tmpFile.Name())
+		if err != nil {
+			return fmt.Errorf("error reading temporary file: %w", err)
+		}
+	default:
+		return fmt.Errorf("usage: ume new [--normalize] [-]")
+	}
+
+	_, err = newImpl(string(content), *normalizeFlag)
+	return err
+}
+
+// dedupeCmd handles the dedupe command
+func dedupeCmd(args []string) error {
+	// Specify dedupe flags
+	dedupeFlags := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	thresholdFlag := dedupeFlags.Float64("threshold", 0.03, "Maximum cosine distance of duplicates")
+	widthFlag := dedupeFlags.Int("width", 40, "Width of each column in the side by side view")
+
+	// Parse flags (skipping the first argument which is the command name)
+	dedupeFlags.Parse(args[1:])
+
+	if *thresholdFlag <= 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
+	if *widthFlag < 10 {
+		return fmt.Errorf("width must be at least 10")
+	}
+
+	return dedupeImpl(*thresholdFlag, *widthFlag)
+}
+
+// mergeCmd handles the merge command
+func mergeCmd(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: ume merge [options] <target_card_id> <source_card_id>")
+	}
+
+	// Specify merge flags
+	mergeFlags := flag.NewFlagSet("merge", flag.ExitOnError)
+	dryRunFlag := mergeFlags.Bool("dry-run", false, "Only show the merged markdown and what would change")
+
+	// Parse flags (skipping the first argument which is the command name)
+	mergeFlags.Parse(args[1:])
+
+	if mergeFlags.NArg() < 2 {
+		return fmt.Errorf("specify the target and the source card IDs")
+	}
+
+	// Parse the card IDs
+	targetID, err := common.ParseCardIDString(mergeFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid target card ID: %w", err)
+	}
+	sourceID, err := common.ParseCardIDString(mergeFlags.Arg(1))
+	if err != nil {
+		return fmt.Errorf("invalid source card ID: %w", err)
+	}
+
+	return mergeImpl(targetID, sourceID, *dryRunFlag)
+}
+
+// splitCmd handles the split command
+func splitCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume split <card_id>")
+	}
+
+	// Parse the card ID
+	cardID, err := common.ParseCardIDString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+
+	return splitImpl(cardID)
+}
+
+// completionCmd handles the completion command
+func completionCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ume completion <bash|zsh|fish>")
+	}
+
+	return completionImpl(args[1])
+}
+
+// Implementation functions are defined in separate files:
+// - lookup.go: lookupImpl
+// - upload.go: uploadImpl
+// - edit.go:   editImpl
+// - history.go: historyImpl
+// - delete.go: deleteImpl
+// - export.go: exportImpl
+// - translate.go: translateImpl
+// - list.go: listImpl
+// - rename.go: renameImpl
+// - links.go: linksImpl
+// - related.go: relatedImpl
+// - map.go: mapImpl
+// - review.go: reviewImpl
+// - tui.go: tuiImpl
+// - trash.go: trashListImpl, trashRestoreImpl, trashEmptyImpl
+// - bot.go: botImpl
+// - serve.go: serveImpl
+// - user.go: userAddImpl, userListImpl
+// - collection.go: collectionCreateImpl, collectionAddImpl, collectionShareImpl, collectionListImpl
+// - reconvert.go: reconvertImpl
+// - new.go: newImpl
+// - audio.go: audioImpl
+// - dedupe.go: dedupeImpl
+// - merge.go: mergeImpl
+// - split.go: splitImpl
+// - completion.go: completionImpl, completeImpl
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// topicSampleSize is the number of chunks sent to the chat API to label a topic
+const topicSampleSize = 8
+
+// topicCard is a card that has chunks in a topic
+type topicCard struct {
+	CardID int32
+	Title  string
+	Chunks int
+}
+
+// topic is a cluster of chunks
+type topic struct {
+	Label  string
+	Chunks int
+	Cards  []topicCard
+}
+
+// mapImpl implements the map command functionality
+func mapImpl(k int, label bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	embeddingModel, err := common.CurrentEmbeddingModel()
+	if err != nil {
+		return err
+	}
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := queries.ListLatestChunks(context.Background(), database.ListLatestChunksParams{
+		Model:   embeddingModel.Name,
+		OwnerID: owner,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing chunks: %w", err)
+	}
+
+	if len(chunks) == 0 {
+		return fmt.Errorf("no embeddings found, upload some cards first")
+	}
+
+	vectors := make([][]float32, len(chunks))
+	cardIDs := make(map[int32]bool)
+	for i, chunk := range chunks {
+		vectors[i] = chunk.Embedding.Slice()
+		cardIDs[chunk.CardID] = true
+	}
+
+	// Pick a number of topics from the number of cards if not specified
+	if k <= 0 {
+		k = int(math.Round(math.Sqrt(float64(len(cardIDs)) / 2)))
+		if k < 2 {
+			k = 2
+		}
+	}
+
+	assignments, centroids := common.KMeans(vectors, k, 100, 1)
+
+	var client *common.OpenAIClient
+	if label {
+		client, err = common.NewOpenAIClient()
+		if err != nil {
+			return fmt.Errorf("error initializing OpenAI client: %w", err)
+		}
+	}
+
+	topics := make([]topic, 0, len(centroids))
+	for c, centroid := range centroids {
+		var members []int
+		for i, assignment := range assignments {
+			if assignment == c {
+				members = append(members, i)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+
+		// Count the chunks of each card in the topic
+		counts := make(map[int32]int)
+		var cards []topicCard
+		for _, i := range members {
+			if counts[chunks[i].CardID] == 0 {
+				cards = append(cards, topicCard{CardID: chunks[i].CardID, Title: chunks[i].Title})
+			}
+			counts[chunks[i].CardID]++
+		}
+		for i := range cards {
+			cards[i].Chunks = counts[cards[i].CardID]
+		}
+		sort.SliceStable(cards, func(i, j int) bool {
+			return cards[i].Chunks > cards[j].Chunks
+		})
+
+		t := topic{
+			Label:  fmt.Sprintf("Topic %d", len(topics)+1),
+			Chunks: len(members),
+			Cards:  cards,
+		}
+
+		if client != nil {
+			// Label the topic with the chunks closest to its centroid
+			sort.SliceStable(members, func(i, j int) bool {
+				return cosineSimilarity(vectors[members[i]], centroid) > cosineSimilarity(vectors[members[j]], centroid)
+			})
+			var samples []string
+			for _, i := range members {
+				if len(samples) == topicSampleSize {
+					break
+				}
+				samples = append(samples, common.Snippet(chunks[i].Text, 200))
+			}
+
+			topicLabel, err := client.LabelTopic(samples)
+			if err != nil {
+				fmt.Printf("Note: could not label %s: %v\n", t.Label, err)
+			} else if topicLabel != "" {
+				t.Label = topicLabel
+			}
+		}
+
+		topics = append(topics, t)
+	}
+
+	sort.SliceStable(topics, func(i, j int) bool {
+		return topics[i].Chunks > topics[j].Chunks
+	})
+
+	fmt.Printf("%d chunks from %d cards in %d topics\n", len(chunks), len(cardIDs), len(topics))
+	for _, t := range topics {
+		fmt.Printf("\n%s (%d chunks, %d cards)\n", t.Label, t.Chunks, len(t.Cards))
+		fmt.Println("------------------------------------------------------------------------------")
+		for _, card := range t.Cards {
+			fmt.Printf("%4d\t%3d\t%s\n", card.CardID, card.Chunks, card.Title)
+		}
+	}
+
+	return nil
+}
+
+// cosineSimilarity returns the cosine similarity of two vectors
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
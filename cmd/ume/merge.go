@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// mergeSeparator separates the content of merged cards, so they can be split again
+const mergeSeparator = "\n\n" + common.SplitMarker + "\n\n"
+
+// latestMarkdown returns the latest version of a card and its markdown
+func latestMarkdown(queries *database.Queries, minioClient *common.MinioClient, cardID int32) (int32, string, error) {
+	version, err := queries.GetLatestMarkdownVersion(context.Background(), cardID)
+	if err != nil {
+		return 0, "", fmt.Errorf("error getting latest markdown version of card %d: %w", cardID, err)
+	}
+
+	content, err := common.ReadMarkdown(context.Background(), queries, minioClient, cardID, version)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return version, content, nil
+}
+
+// mergeContent concatenates the markdown of the target and the source card
+func mergeContent(target, source string) string {
+	return strings.TrimRight(target, "\n") + mergeSeparator + strings.TrimSpace(source) + "\n"
+}
+
+// mergeCards appends the latest markdown of the source card to the target card as a
+// new version, moves the images of the source to the target and moves the source to
+// the trash. It returns the new version of the target.
+func mergeCards(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, openaiKey string, targetID, sourceID int32) (int32, error) {
+	if targetID == sourceID {
+		return 0, fmt.Errorf("can't merge card %d into itself", targetID)
+	}
+	if err := requireCardWrite(queries, int(targetID), int(sourceID)); err != nil {
+		return 0, err
+	}
+
+	targetVersion, targetContent, err := latestMarkdown(queries, minioClient, targetID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, sourceContent, err := latestMarkdown(queries, minioClient, sourceID)
+	if err != nil {
+		return 0, err
+	}
+
+	// The merged content is chunked like the target card
+	methodName, err := queries.GetCardMethod(context.Background(), targetID)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving card method: %w", err)
+	}
+	method := common.Method(methodName)
+
+	version := targetVersion + 1
+	err = storeVersion(dbpool, queries, minioClient, openaiKey, targetID, version, pgtype.Int4{Int32: targetVersion, Valid: true}, mergeContent(targetContent, sourceContent), method)
+	if err != nil {
+		return 0, err
+	}
+
+	// Move the images before trashing the source, so they stay in place
+	err = queries.MoveCardImages(context.Background(), database.MoveCardImagesParams{
+		DstCardID: targetID,
+		SrcCardID: sourceID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error moving images to card %d: %w", targetID, err)
+	}
+
+	err = trashCard(queries, minioClient, sourceID, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// mergeImpl implements the merge command functionality. The source card is merged
+// into the target card, and with dryRun only the result is shown.
+func mergeImpl(targetID, sourceID int, dryRun bool) error {
+	if targetID == sourceID {
+		return fmt.Errorf("can't merge card %d into itself", targetID)
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if err := requireCardWrite(queries, targetID, sourceID); err != nil {
+		return err
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	targetTitle, err := queries.GetCardTitle(context.Background(), int32(targetID))
+	if err != nil {
+		return &common.CardError{CardID: int32(targetID), Err: err}
+	}
+	sourceTitle, err := queries.GetCardTitle(context.Background(), int32(sourceID))
+	if err != nil {
+		return &common.CardError{CardID: int32(sourceID), Err: err}
+	}
+
+	for _, cardID := range []int{targetID, sourceID} {
+		trashed, err := isTrashed(queries, int32(cardID))
+		if err != nil {
+			return err
+		}
+		if trashed {
+			return fmt.Errorf("card %d is in the trash, restore it first with: ume trash restore %d", cardID, cardID)
+		}
+	}
+
+	if dryRun {
+		targetVersion, targetContent, err := latestMarkdown(queries, minioClient, int32(targetID))
+		if err != nil {
+			return err
+		}
+		_, sourceContent, err := latestMarkdown(queries, minioClient, int32(sourceID))
+		if err != nil {
+			return err
+		}
+
+		images, err := queries.ListCardImages(context.Background(), int32(sourceID))
+		if err != nil {
+			return fmt.Errorf("error listing images of card %d: %w", sourceID, err)
+		}
+
+		fmt.Printf("Would merge card %d \"%s\" into card %d \"%s\" as version %d:\n\n", sourceID, sourceTitle, targetID, targetTitle, targetVersion+1)
+		fmt.Println(mergeContent(targetContent, sourceContent))
+		for _, image := range images {
+			fmt.Printf("Would move image %s to card %d\n", image, targetID)
+		}
+		fmt.Printf("Would move card %d to the trash\n", sourceID)
+		return nil
+	}
+
+	// The merged version is embedded again
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	version, err := mergeCards(dbpool, queries, minioClient, openaiKey, int32(targetID), int32(sourceID))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Merged card %d \"%s\" into card %d \"%s\" as version %d\n", sourceID, sourceTitle, targetID, targetTitle, version)
+	return nil
+}
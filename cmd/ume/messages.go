@@ -0,0 +1,70 @@
+package main
+
+import "github.com/yasushisakai/umesao/pkg/common"
+
+// Messages of the CLI. Their translations are in the catalogs of pkg/common/locales,
+// and the commands are translated by the IDs command.<name>.description and
+// command.<name>.help, with the names of subcommands joined by dots.
+var (
+	msgEnvLoadError     = common.Message{ID: "main.env_load_error", Other: "error loading %s: %v"}
+	msgDeadlineExceeded = common.Message{ID: "main.deadline_exceeded", Other: "error: the command did not finish within the deadline of %s"}
+	msgNoCommand        = common.Message{ID: "main.no_command", Other: "Error: No command or search query provided"}
+	msgUnknownCommand   = common.Message{ID: "main.unknown_command", Other: "unknown command: %s"}
+	msgUnknownSubcmd    = common.Message{ID: "main.unknown_subcommand", Other: "unknown %s command: %s"}
+	msgUsageError       = common.Message{ID: "main.usage_error", Other: "usage: %s"}
+
+	msgHelpUsage          = common.Message{ID: "help.usage", Other: "Usage: ume [global options] [command] [arguments]"}
+	msgHelpCommands       = common.Message{ID: "help.commands", Other: "Commands:"}
+	msgHelpGlobalOptions  = common.Message{ID: "help.global_options", Other: "Global options:"}
+	msgHelpDefaultLookup  = common.Message{ID: "help.default_lookup", Other: "If no command is specified, the input is treated as a search query for the lookup command."}
+	msgHelpLookupExample  = common.Message{ID: "help.lookup_example", Other: "Example: ume \"search query\" is equivalent to ume lookup \"search query\""}
+	msgHelpCommandHelp    = common.Message{ID: "help.command_help", Other: "Run \"ume help <command>\" or \"ume <command> --help\" for the help of a command."}
+	msgHelpExitCodes      = common.Message{ID: "help.exit_codes", Other: "Exit codes: 1 error, 2 usage, 3 not found, 4 API key missing or rejected, 5 not configured,\n6 provider unavailable, 7 database unavailable, 8 input required, 9 deadline exceeded,\n10 version conflict"}
+	msgHelpCommandUsage   = common.Message{ID: "help.command_usage", Other: "Usage: %s"}
+	msgHelpCommandUsageEx = common.Message{ID: "help.command_usage_more", Other: "       %s"}
+
+	msgConfirm         = common.Message{ID: "prompt.confirm", Other: "%s (y/n): "}
+	msgConfirmRequired = common.Message{ID: "prompt.confirm_required", Other: "confirm with %s to run without a prompt"}
+
+	msgSearching        = common.Message{ID: "lookup.searching", Other: "Searching for: \"%s\""}
+	msgAlsoSearching    = common.Message{ID: "lookup.also_searching", Other: "Also searching for: \"%s\""}
+	msgResults          = common.Message{ID: "lookup.results", Other: "Results:"}
+	msgResultsHeader    = common.Message{ID: "lookup.results_header", Other: "#\tCard\tVer\tLang\tDist\tCreated\t\tTitle\tText"}
+	msgShowBestMatch    = common.Message{ID: "lookup.show_best_match", Other: "Show the best match with: %s"}
+	msgPinnedFirst      = common.Message{ID: "lookup.pinned_first", Other: "* Pinned cards are listed first, unpin them with: ume pin --remove <card_id>"}
+	msgNextPage         = common.Message{ID: "lookup.next_page", Other: "Show more results with --page %d"}
+	msgOfflineText      = common.Message{ID: "lookup.offline_text", Other: "Offline: the query can't be embedded, so the text of the cards is searched instead of their meaning"}
+	msgOfflineNoExpand  = common.Message{ID: "lookup.offline_no_expand", Other: "Offline: the query is searched without other phrasings"}
+	msgExplainDistance  = common.Message{ID: "lookup.explain_distance", Other: "distance %.3f"}
+	msgExplainTextRank  = common.Message{ID: "lookup.explain_text_rank", Other: "text rank %.3f, matched by the words of the query"}
+	msgExplainRecency   = common.Message{ID: "lookup.explain_recency", Other: "distance %.3f + %.3f for the age of the card = %.3f"}
+	msgExplainMatch     = common.Message{ID: "lookup.explain_match", Other: "matched version %d, chunk %d"}
+	msgExplainLang      = common.Message{ID: "lookup.explain_translation", Other: " in the %s translation"}
+	msgExplainFusion    = common.Message{ID: "lookup.explain_fusion", Other: "fusion score %.4f, found by %d of %d phrasings, closest to \"%s\""}
+	msgExplainPinned    = common.Message{ID: "lookup.explain_pinned", Other: "pinned, listed before the cards that aren't"}
+	msgTimeTaken        = common.Message{ID: "lookup.time_taken", Other: "Time taken: %v"}
+	msgResultAction     = common.Message{ID: "lookup.result_action", Other: "View markdown (v), edit (e), show in browser (s) or open image (o), followed by a result number, or Enter to quit: "}
+	msgResultNumber     = common.Message{ID: "lookup.result_number", Other: "Please enter a result number from 1 to %d."}
+	msgResultActionHelp = common.Message{ID: "lookup.result_action_help", Other: "Please enter v, e, s or o."}
+	msgError            = common.Message{ID: "main.error", Other: "Error: %v"}
+
+	msgNoCards        = common.Message{ID: "list.no_cards", Other: "No cards found. Please upload content first."}
+	msgListHeader     = common.Message{ID: "list.header", Other: "Card\tVer\tTitle"}
+	msgArchivedSuffix = common.Message{ID: "list.archived_suffix", Other: " (archived)"}
+	msgCreatedCard    = common.Message{ID: "upload.created_card", Other: "Created new card with ID: %d"}
+
+	msgTrashCard        = common.Message{ID: "delete.trash_card", Other: "You are about to move card %d \"%s\" to the trash."}
+	msgDeleteCard       = common.Message{ID: "delete.delete_card", Other: "You are about to delete card %d \"%s\" and all associated data."}
+	msgDeleteConfirm    = common.Message{ID: "delete.confirm", Other: "Are you sure you want to delete this card?"}
+	msgDeleteCancelled  = common.Message{ID: "delete.cancelled", Other: "Deletion cancelled."}
+	msgWarning          = common.Message{ID: "main.warning", Other: "Warning: %v"}
+	msgDeletedCard      = common.Message{ID: "delete.deleted_card", Other: "Deleted card %d and all associated data."}
+	msgRenamedCard      = common.Message{ID: "rename.renamed_card", Other: "Renamed card %d from \"%s\" to \"%s\""}
+	msgAudioIgnoresOpts = common.Message{ID: "upload.audio_ignores_options", Other: "Note: The method and handwriting options are not used for audio and will be ignored."}
+	msgLanguageIgnored  = common.Message{ID: "upload.language_ignored", Other: "Note: The language option is only used with the OCR method and will be ignored."}
+	msgDownloading      = common.Message{ID: "upload.downloading", Other: "Downloading %s"}
+
+	msgOfflineShow   = common.Message{ID: "show.offline", Other: "Offline: showing what is stored in the database, with the images and translations cached before"}
+	msgOfflineNoLang = common.Message{ID: "show.offline_no_lang", Other: "Offline: the card is shown untranslated, %v"}
+	msgOfflineQueued = common.Message{ID: "upload.offline_queued", Other: "Offline: queued job %d to upload and process card %d, run ume worker once online"}
+)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// cardSource returns the source of a card, which is zero if none was set
+func cardSource(ctx context.Context, queries *database.Queries, cardID int32) (common.CardSource, error) {
+	row, err := queries.GetCardSource(ctx, cardID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return common.CardSource{}, nil
+	}
+	if err != nil {
+		return common.CardSource{}, fmt.Errorf("error getting the source of card %d: %w", cardID, err)
+	}
+	return common.CardSource{
+		Book:   row.Book,
+		Page:   row.Page,
+		URL:    row.Url,
+		ReadOn: row.ReadOn.Time,
+	}, nil
+}
+
+// metaSetImpl implements the meta set command functionality. The fields are given as
+// field=value, and the fields that aren't given keep their values.
+func metaSetImpl(cardID int, fields []string) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
+	}
+
+	// Make sure the card exists
+	if _, err := queries.GetCardTitle(context.Background(), int32(cardID)); err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	source, err := cardSource(context.Background(), queries, int32(cardID))
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return fmt.Errorf("invalid field: %s. Expected field=value", field)
+		}
+		if err := source.Set(strings.ToLower(strings.TrimSpace(name)), value); err != nil {
+			return err
+		}
+	}
+
+	err = queries.SetCardSource(context.Background(), database.SetCardSourceParams{
+		CardID: int32(cardID),
+		Book:   source.Book,
+		Page:   source.Page,
+		Url:    source.URL,
+		ReadOn: pgtype.Date{Time: source.ReadOn, Valid: !source.ReadOn.IsZero()},
+	})
+	if err != nil {
+		return fmt.Errorf("error saving the source of card %d: %w", cardID, err)
+	}
+
+	if source.IsZero() {
+		fmt.Printf("Cleared the source of card %d\n", cardID)
+		return nil
+	}
+	fmt.Printf("Set the source of card %d: %s\n", cardID, source.Citation())
+	return nil
+}
+
+// metaShowImpl implements the meta show command functionality
+func metaShowImpl(cardID int) error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	// Make sure the card exists
+	if _, err := queries.GetCardTitle(context.Background(), int32(cardID)); err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	source, err := cardSource(context.Background(), queries, int32(cardID))
+	if err != nil {
+		return err
+	}
+	if source.IsZero() {
+		fmt.Printf("Card %d has no source. Set one with: ume meta set %d book=\"...\" page=...\n", cardID, cardID)
+		return nil
+	}
+
+	readOn := ""
+	if !source.ReadOn.IsZero() {
+		readOn = source.ReadOn.Format("2006-01-02")
+	}
+	fmt.Printf("book: %s\npage: %s\nurl:  %s\nread: %s\n", source.Book, source.Page, source.URL, readOn)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// migrateEmbeddingsImpl implements the migrate-embeddings command functionality. The
+// chunk embeddings are converted to the pgvector type of precision, and the indexes of
+// each model are created again for it. If yes is set, the conversion isn't confirmed.
+func migrateEmbeddingsImpl(precision string, yes bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	var current string
+	err = dbpool.QueryRow(context.Background(), `SELECT format_type(atttypid, NULL) FROM pg_attribute
+		WHERE attrelid = 'chunks'::regclass AND attname = 'embedding'`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("error getting the type of the embeddings: %w", err)
+	}
+	if current == precision {
+		fmt.Printf("Embeddings are already stored as %s.\n", precision)
+		return nil
+	}
+
+	models, err := queries.ListEmbeddingModels(context.Background())
+	if err != nil {
+		return fmt.Errorf("error listing embedding models: %w", err)
+	}
+	chunks := 0
+	for _, model := range models {
+		chunks += int(model.Chunks)
+	}
+
+	if !yes {
+		question := fmt.Sprintf("Convert the embeddings of %d chunks from %s to %s?", chunks, current, precision)
+		if precision == common.PrecisionHalf {
+			question = fmt.Sprintf("Convert the embeddings of %d chunks from %s to %s? The precision that is lost can only be restored by embedding the cards again.", chunks, current, precision)
+		}
+		ok, err := confirm(question, "--yes")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Migration cancelled.")
+			return nil
+		}
+	}
+
+	// The indexes depend on the type, so they are dropped and created again in one transaction
+	tx, err := dbpool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	rows, err := tx.Query(context.Background(), `SELECT indexname FROM pg_indexes
+		WHERE tablename = 'chunks' AND indexdef LIKE '%USING ivfflat%'`)
+	if err != nil {
+		return fmt.Errorf("error listing embedding indexes: %w", err)
+	}
+	var indexes []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("error listing embedding indexes: %w", err)
+		}
+		indexes = append(indexes, name)
+	}
+	rows.Close()
+
+	for _, name := range indexes {
+		if _, err := tx.Exec(context.Background(), fmt.Sprintf("DROP INDEX %q", name)); err != nil {
+			return fmt.Errorf("error dropping index %s: %w", name, err)
+		}
+	}
+
+	fmt.Printf("Converting the embeddings to %s...\n", precision)
+	_, err = tx.Exec(context.Background(), fmt.Sprintf("ALTER TABLE chunks ALTER COLUMN embedding TYPE %s USING embedding::%s", precision, precision))
+	if err != nil {
+		return fmt.Errorf("error converting embeddings: %w", err)
+	}
+
+	for _, model := range models {
+		sql, ok := common.EmbeddingIndexSQL(common.EmbeddingModel{Name: model.Name, Dimension: uint(model.Dimension)}, precision)
+		if !ok {
+			fmt.Printf("Not indexing %s: %d dimensions are too many for an index of %s\n", model.Name, model.Dimension, precision)
+			continue
+		}
+		fmt.Printf("Indexing the embeddings of %s...\n", model.Name)
+		if _, err := tx.Exec(context.Background(), sql); err != nil {
+			return fmt.Errorf("error indexing the embeddings of %s: %w", model.Name, err)
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("error committing migration: %w", err)
+	}
+
+	fmt.Printf("Converted the embeddings of %d chunks to %s.\n", chunks, precision)
+	return nil
+}
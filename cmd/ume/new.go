@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// newImpl creates a card from markdown content, without an image, and returns the ID of the new card
+func newImpl(content string, normalize bool) (int32, error) {
+	if normalize {
+		content = common.NormalizeMarkdown(content)
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return 0, fmt.Errorf("no content, the card was not created")
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return 0, fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	// Initialize Minio client
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return 0, fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	// Get OpenAI API key
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return 0, fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	// The card belongs to the user set with UME_API_KEY, if any
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return 0, err
+	}
+
+	cardID, err := queries.CreateCard(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("error creating card: %w", err)
+	}
+
+	if owner.Valid {
+		err = queries.SetCardOwner(context.Background(), database.SetCardOwnerParams{ID: cardID, OwnerID: owner})
+		if err != nil {
+			return 0, fmt.Errorf("error setting card owner: %w", err)
+		}
+	}
+
+	title, err := storeFirstVersion(dbpool, queries, minioClient, openaiKey, cardID, content, common.MethodText)
+	if err != nil {
+		return 0, err
+	}
+
+	fmt.Printf("Created card %d \"%s\"\n", cardID, title)
+	return cardID, nil
+}
+
+// storeFirstVersion stores content as the first version of a card with its links,
+// a generated title and embeddings, and returns the title
+func storeFirstVersion(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, openaiKey string, cardID int32, content string, method common.Method) (string, error) {
+	err := storeVersion(dbpool, queries, minioClient, openaiKey, cardID, 1, pgtype.Int4{}, content, method)
+	if err != nil {
+		return "", err
+	}
+
+	// Generate a title for the card, falling back to the first heading or line
+	title := common.MarkdownTitle(content, 60)
+	openaiClient, err := common.NewOpenAIClient()
+	if err == nil {
+		var generated string
+		generated, err = openaiClient.GenerateTitle(content)
+		if err == nil && generated != "" {
+			title = generated
+		}
+	}
+	if err != nil {
+		fmt.Printf("Note: could not generate a title, using the first line instead: %v\n", err)
+	}
+
+	err = queries.SetCardTitle(context.Background(), database.SetCardTitleParams{
+		ID:    cardID,
+		Title: title,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing card title: %w", err)
+	}
+
+	return title, nil
+}
+
+// storeVersion uploads content as a version of a card and stores its hash, links and embeddings.
+// The content is chunked with the method the card was created with.
+func storeVersion(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, openaiKey string, cardID, version int32, parent pgtype.Int4, content string, method common.Method) error {
+	warnings, err := common.StoreVersion(context.Background(), dbpool, queries, minioClient, openaiKey, common.MarkdownVersion{
+		CardID:  cardID,
+		Version: version,
+		Parent:  parent,
+		Content: content,
+		Method:  method,
+	})
+	printLinkWarnings(warnings)
+	return err
+}
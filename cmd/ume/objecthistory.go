@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// objectHistoryImpl implements the object-history command functionality. It lists the
+// versions Minio keeps of the markdown objects of a card, including its translations
+// and the objects moved to the trash, which are kept even after the card is deleted.
+// Markdown stored by hash is found by the hashes of the versions of the card.
+func objectHistoryImpl(cardID int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	markdownVersions, err := queries.ListMarkdownVersions(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error listing markdown versions: %w", err)
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	bucket := minioClient.MarkdownBucket
+	name := fmt.Sprintf("%d_", cardID)
+	versions, err := minioClient.ListObjectVersions(bucket, name)
+	if err != nil {
+		return err
+	}
+	trashed, err := minioClient.ListObjectVersions(bucket, common.TrashPrefix+name)
+	if err != nil {
+		return err
+	}
+	versions = append(versions, trashed...)
+
+	listed := make(map[string]bool)
+	for _, v := range markdownVersions {
+		if !v.ByHash || listed[v.Hash] {
+			continue
+		}
+		listed[v.Hash] = true
+		stored, err := minioClient.ListObjectVersions(bucket, common.MarkdownObject(v.Hash))
+		if err != nil {
+			return err
+		}
+		versions = append(versions, stored...)
+	}
+
+	if len(versions) == 0 {
+		return fmt.Errorf("no objects found for card %d in bucket %s", cardID, bucket)
+	}
+
+	fmt.Printf("Objects of card %d in bucket %s:\n\n", cardID, bucket)
+	fmt.Printf("%-16s %10s  %-36s  %s\n", "Modified", "Size", "Version ID", "Object")
+	for _, v := range versions {
+		size := fmt.Sprintf("%d", v.Size)
+		if v.IsDeleteMarker {
+			size = "-"
+		}
+		state := ""
+		switch {
+		case v.IsDeleteMarker && v.IsLatest:
+			state = " (deleted)"
+		case v.IsDeleteMarker:
+			state = " (delete marker)"
+		case v.IsLatest:
+			state = " (latest)"
+		}
+		fmt.Printf("%-16s %10s  %-36s  %s%s\n", v.LastModified.Local().Format("2006-01-02 15:04"), size, v.VersionID, v.Key, state)
+	}
+
+	enabled, err := minioClient.VersioningEnabled(bucket)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		fmt.Printf("\nVersioning of bucket %s is off, so only the current objects are kept. Set\nMINIO_MARKDOWN_VERSIONING=true to keep every version from now on.\n", bucket)
+	}
+	return nil
+}
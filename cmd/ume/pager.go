@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// pagerCommand returns the pager set in $PAGER, or the one that comes with the OS
+func pagerCommand() []string {
+	if pager := strings.Fields(os.Getenv("PAGER")); len(pager) > 0 {
+		return pager
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"more"}
+	}
+	return []string{"less", "-R"}
+}
+
+// pageText shows text through the pager when standard output is a terminal, and
+// writes it as it is when it's piped or the pager is not installed
+func pageText(text string) error {
+	if !common.IsTerminal(os.Stdout) {
+		_, err := fmt.Print(text)
+		return err
+	}
+
+	pager := pagerCommand()
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			_, err := fmt.Print(text)
+			return err
+		}
+		return fmt.Errorf("error running pager %s: %w", pager[0], err)
+	}
+	return nil
+}
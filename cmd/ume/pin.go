@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// pinImpl implements the pin command functionality. Pinned cards are listed first by
+// ume lookup and the gallery, for the cards in use during a project. With unpin the card
+// is unpinned instead.
+func pinImpl(cardID int, unpin bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	if unpin {
+		unpinned, err := queries.UnpinCard(context.Background(), database.UnpinCardParams{
+			OwnerID: owner,
+			CardID:  int32(cardID),
+		})
+		if err != nil {
+			return fmt.Errorf("error unpinning card: %w", err)
+		}
+		if unpinned == 0 {
+			return fmt.Errorf("card %d is not pinned: %w", cardID, pgx.ErrNoRows)
+		}
+		fmt.Printf("Unpinned card %d\n", cardID)
+		return nil
+	}
+
+	// Make sure the card exists
+	title, err := queries.GetCardTitle(context.Background(), int32(cardID))
+	if err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	err = queries.PinCard(context.Background(), database.PinCardParams{
+		OwnerID: owner,
+		CardID:  int32(cardID),
+	})
+	if err != nil {
+		return fmt.Errorf("error pinning card: %w", err)
+	}
+
+	fmt.Printf("Pinned card %d \"%s\"\n", cardID, title)
+	return nil
+}
+
+// pinsImpl lists the pinned cards of the current user, the latest pinned first
+func pinsImpl() error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	pins, err := queries.ListPinnedCards(context.Background(), owner)
+	if err != nil {
+		return fmt.Errorf("error listing pinned cards: %w", err)
+	}
+
+	if len(pins) == 0 {
+		fmt.Println("No pinned cards. Pin one with: ume pin <card_id>")
+		return nil
+	}
+
+	fmt.Println("Card\tPinned\t\tTitle")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, pin := range pins {
+		fmt.Printf("%4d\t%s\t%s\n", pin.CardID, pin.CreatedAt.Time.Local().Format("2006-01-02"), pin.Title)
+	}
+	return nil
+}
+
+// pinnedCards returns the IDs of the cards pinned by the owner
+func pinnedCards(ctx context.Context, queries *database.Queries, owner pgtype.Int4) (map[int32]bool, error) {
+	pins, err := queries.ListPinnedCards(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("error listing pinned cards: %w", err)
+	}
+
+	pinned := make(map[int32]bool, len(pins))
+	for _, pin := range pins {
+		pinned[pin.CardID] = true
+	}
+	return pinned, nil
+}
+
+// markPinnedCards sets Pinned on the gallery cards pinned by the owner
+func markPinnedCards(ctx context.Context, queries *database.Queries, owner pgtype.Int4, cards []galleryCard) error {
+	pinned, err := pinnedCards(ctx, queries, owner)
+	if err != nil {
+		return err
+	}
+	for i := range cards {
+		cards[i].Pinned = pinned[cards[i].CardID]
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// confirm asks a yes/no question. Without a terminal, or with --no-input, nothing is
+// asked and an error is returned, which tells to pass skipFlag to confirm beforehand.
+func confirm(question, skipFlag string) (bool, error) {
+	if !common.CanPrompt() {
+		return false, fmt.Errorf("%w: %s", common.ErrInputRequired, common.T(msgConfirmRequired, skipFlag))
+	}
+
+	fmt.Print(common.T(msgConfirm, question))
+	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("error reading input: %w", err)
+	}
+
+	input = strings.TrimSpace(strings.ToLower(input))
+	return input == "y" || input == "yes", nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// publishRelatedCards is the number of related cards linked from each published card
+const publishRelatedCards = 5
+
+// renderedCardLinkRe matches the links to other cards, by ID or UID, in rendered markdown
+var renderedCardLinkRe = regexp.MustCompile(`<a href="/card/([0-9a-f-]+)">(.*?)</a>`)
+
+// publishedCard is a card entry rendered by the index of a published site
+type publishedCard struct {
+	galleryCard
+	// Media is the file name of the image or audio of the card, next to its page
+	Media string
+}
+
+// publishIndex is the data rendered by the index of a published site
+type publishIndex struct {
+	Title string
+	Cards []publishedCard
+}
+
+// publishPage is the data rendered by a card page of a published site
+type publishPage struct {
+	cardPage
+	Media   string
+	Related []galleryCard
+}
+
+// publishImpl implements the publish command functionality. It writes the latest version
+// of the cards as a static site to dir: an index with a search box, a page per card with
+// its image and related cards, and the stylesheet. Links only point inside the site, so it
+// can be hosted from any path, like GitHub Pages. Pages and media are named by the UID of
+// the card, so the site doesn't give away the local IDs. If collection is set only the
+// cards in that collection are published.
+func publishImpl(dir, collection string) error {
+	// Only reading, so a replica can be used
+	dbpool, queries, err := common.InitDBReadOnly()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	collectionID, err := resolveCollection(queries, owner, collection)
+	if err != nil {
+		return err
+	}
+
+	cards, err := galleryCards(queries, owner, collectionID)
+	if err != nil {
+		return err
+	}
+	if len(cards) == 0 {
+		return fmt.Errorf("no cards to publish")
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	embeddingModel, err := common.CurrentEmbeddingModel()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "cards"), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+	if err := copyStaticFiles(filepath.Join(dir, "static")); err != nil {
+		return err
+	}
+
+	// Links and related cards only point to cards that are published, by their UID
+	published := make(map[string]string)
+	for _, card := range cards {
+		published[fmt.Sprint(card.CardID)] = card.UID
+		published[card.UID] = card.UID
+	}
+
+	index := publishIndex{Title: "Cards"}
+	if collection != "" {
+		index.Title = collection
+	}
+
+	for _, card := range cards {
+		page, err := loadCardPage(queries, minioClient, int(card.CardID), int(card.Version), "", -1)
+		if err != nil {
+			return fmt.Errorf("error loading card %d: %w", card.CardID, err)
+		}
+		page.Content = template.HTML(renderedCardLinkRe.ReplaceAllStringFunc(string(page.Content), func(link string) string {
+			m := renderedCardLinkRe.FindStringSubmatch(link)
+			uid, ok := published[m[1]]
+			if !ok {
+				return m[2]
+			}
+			return fmt.Sprintf(`<a href="%s.html">%s</a>`, uid, m[2])
+		}))
+
+		var media string
+		if page.HasImage || page.HasAudio {
+			media, err = publishMedia(queries, minioClient, card, filepath.Join(dir, "cards"))
+			if err != nil {
+				return err
+			}
+		}
+
+		related, err := queries.SearchRelatedCards(context.Background(), database.SearchRelatedCardsParams{
+			CardID:       card.CardID,
+			Limit:        int32(publishRelatedCards * 4),
+			Model:        embeddingModel.Name,
+			OwnerID:      owner,
+			CollectionID: collectionID,
+		})
+		if err != nil {
+			return fmt.Errorf("error searching cards related to %d: %w", card.CardID, err)
+		}
+		var publishedRelated []galleryCard
+		for _, r := range related {
+			uid, ok := published[fmt.Sprint(r.CardID)]
+			if ok && len(publishedRelated) < publishRelatedCards {
+				publishedRelated = append(publishedRelated, galleryCard{CardID: r.CardID, UID: uid, Title: r.Title})
+			}
+		}
+
+		err = writeTemplate(filepath.Join(dir, "cards", card.UID+".html"), "publish_card.html", publishPage{
+			cardPage: page,
+			Media:    media,
+			Related:  publishedRelated,
+		})
+		if err != nil {
+			return err
+		}
+
+		index.Cards = append(index.Cards, publishedCard{galleryCard: card, Media: media})
+	}
+
+	if err := writeTemplate(filepath.Join(dir, "index.html"), "publish_index.html", index); err != nil {
+		return err
+	}
+
+	fmt.Printf("Published %d cards to %s\n", len(cards), dir)
+	return nil
+}
+
+// publishMedia downloads the image or audio of a card to dir and returns its file name
+func publishMedia(queries *database.Queries, minioClient *common.MinioClient, card galleryCard, dir string) (string, error) {
+	image, err := queries.GetCardImage(context.Background(), card.CardID)
+	if err != nil {
+		return "", fmt.Errorf("error getting card image: %w", err)
+	}
+
+	obj, _, err := minioClient.OpenObject(minioClient.ImageBucket, image.Filename)
+	if err != nil {
+		return "", fmt.Errorf("error downloading image: %w", err)
+	}
+	defer obj.Close()
+
+	name := card.UID + filepath.Ext(image.Filename)
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", fmt.Errorf("error creating %s: %w", name, err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, obj); err != nil {
+		return "", fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// copyStaticFiles writes the embedded static files to dir
+func copyStaticFiles(dir string) error {
+	static, _ := fs.Sub(staticFS, "static")
+	return fs.WalkDir(static, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		data, err := fs.ReadFile(static, path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", target, err)
+		}
+		return nil
+	})
+}
+
+// writeTemplate executes a template and writes it to a file
+func writeTemplate(path, name string, data any) error {
+	var buf bytes.Buffer
+	if err := webTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		return fmt.Errorf("error rendering %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pgvector/pgvector-go"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// reconvertImpl converts the stored raw OCR result of a card to markdown again and
+// stores the result as a new version, without running OCR again. The stages are shown
+// with a spinner on terminals, with quiet only the new version is printed.
+func reconvertImpl(cardID int, model string, normalize, quiet bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
+	}
+
+	// Initialize Minio client
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	// Use the most recent OCR result of the card
+	ocrInfo, err := queries.GetLatestOCRResult(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("no OCR result stored for card %d, it was uploaded with the vision method or before OCR results were kept", cardID)
+	}
+	method := common.Method(ocrInfo.Method)
+
+	ocrResult, err := minioClient.ReadOCRForCard(int32(cardID), ocrInfo.Ver)
+	if err != nil {
+		return fmt.Errorf("error reading OCR result: %w", err)
+	}
+
+	progress := common.NewProgress(quiet)
+	defer progress.Done()
+
+	progress.Printf("Converting the %s result of card %d, version %d with %s\n", ocrInfo.Method, cardID, ocrInfo.Ver, model)
+
+	// Get OpenAI API key
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	// Cards uploaded with --handwriting are converted with the handwriting prompt again
+	progress.Stage(fmt.Sprintf("Converting OCR result with %s", model))
+	content, err := common.ConvertOCR(openaiKey, model, string(ocrResult), ocrInfo.Handwriting, progress.Live())
+	if err != nil {
+		return fmt.Errorf("error creating markdown from OCR result: %w", err)
+	}
+
+	// The description of the diagrams isn't in the OCR result, keep the one the version had
+	converted, err := common.ReadMarkdown(context.Background(), queries, minioClient, int32(cardID), ocrInfo.Ver)
+	if err != nil {
+		return fmt.Errorf("error reading version %d: %w", ocrInfo.Ver, err)
+	}
+	if description := common.DiagramDescription(converted); description != "" {
+		content = common.CombineDiagramMarkdown(content, description)
+	}
+
+	if normalize {
+		content = common.NormalizeMarkdown(content)
+	}
+
+	versions, err := queries.ListMarkdownVersions(context.Background(), int32(cardID))
+	if err != nil || len(versions) == 0 {
+		return fmt.Errorf("error getting markdown versions: %w", err)
+	}
+	latest := versions[len(versions)-1]
+
+	hashString := common.CalculateFileHash([]byte(content))
+	if hashString == latest.Hash {
+		progress.Done()
+		fmt.Println("The converted markdown is the same as the latest version. Nothing to do.")
+		return nil
+	}
+
+	newVersion := latest.Ver + 1
+
+	progress.Stage("Storing markdown")
+	_, err = minioClient.UploadMarkdown([]byte(content))
+	if err != nil {
+		return fmt.Errorf("error uploading markdown file: %w", err)
+	}
+
+	err = queries.CreateMarkdown(context.Background(), database.CreateMarkdownParams{
+		CardID:    int32(cardID),
+		Ver:       newVersion,
+		Hash:      hashString,
+		ParentVer: pgtype.Int4{Int32: latest.Ver, Valid: true},
+		Lang:      common.DetectLanguage(content),
+		Content:   pgtype.Text{String: content, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("error storing markdown hash in database: %w", err)
+	}
+
+	// The new version is converted from the same OCR result, keep it next to it
+	needsReview, quality, err := storeOCRResult(queries, minioClient, int32(cardID), newVersion, method, ocrInfo.Handwriting, string(ocrResult))
+	if err != nil {
+		return err
+	}
+	if needsReview {
+		progress.Printf("Note: the OCR quality of card %d is %.2f, it was added to the review queue\n", cardID, quality)
+	}
+
+	// Update the links to other cards
+	err = storeCardLinks(queries, int32(cardID), content)
+	if err != nil {
+		return err
+	}
+
+	progress.Stage("Generating embeddings")
+	chunker, err := common.ChunkerFor(method)
+	if err != nil {
+		return err
+	}
+	chunks, err := common.ExtractChunks(content, chunker)
+	if err != nil {
+		return err
+	}
+	embeddingModel, err := common.CurrentEmbeddingModel()
+	if err != nil {
+		return err
+	}
+	embeddings, err := embeddingModel.Embed(openaiKey, common.ChunkTexts(chunks))
+	if err != nil {
+		return fmt.Errorf("error generating embeddings: %w", err)
+	}
+
+	progress.Stage("Storing embeddings")
+	for i, embedding := range embeddings {
+		pgvEmbed := pgvector.NewVector(common.ConvertFloat64ToFloat32(embedding))
+		err = queries.CreateEmbeddings(context.Background(), database.CreateEmbeddingsParams{
+			CardID:      int32(cardID),
+			Ver:         newVersion,
+			Idx:         int32(i),
+			Model:       embeddingModel.Name,
+			Text:        chunks[i].Text,
+			Embedding:   pgvEmbed,
+			Chunker:     chunker.Name(),
+			StartOffset: int32(chunks[i].Start),
+			EndOffset:   int32(chunks[i].End),
+			Type:        string(chunks[i].Type),
+			Page:        int32(chunks[i].Page),
+		})
+		if err != nil {
+			return fmt.Errorf("error storing embedding %d in database: %w", i, err)
+		}
+	}
+
+	progress.Done()
+	fmt.Printf("Stored the converted markdown as version %d of card %d\n", newVersion, cardID)
+	return nil
+}
+
+// storeOCRResult uploads the raw OCR result a markdown version was converted from
+// and records it in the database. Cards whose OCR quality is below the review threshold
+// are flagged for review, which is reported with the quality.
+func storeOCRResult(queries *database.Queries, minioClient *common.MinioClient, cardID, version int32, method common.Method, handwriting bool, ocrResult string) (bool, float64, error) {
+	err := minioClient.UploadOCRForCard(cardID, version, []byte(ocrResult))
+	if err != nil {
+		return false, 0, fmt.Errorf("error uploading OCR result: %w", err)
+	}
+
+	// Only results with confidences, like the ones from Azure, have a quality
+	var quality pgtype.Float4
+	if parsed, err := common.ParseOCRResult(ocrResult); err == nil {
+		if score, ok := parsed.Quality(); ok {
+			quality = pgtype.Float4{Float32: float32(score), Valid: true}
+		}
+	}
+
+	err = queries.CreateOCRResult(context.Background(), database.CreateOCRResultParams{
+		CardID:      cardID,
+		Ver:         version,
+		Method:      method.String(),
+		Handwriting: handwriting,
+		Quality:     quality,
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("error storing OCR result in database: %w", err)
+	}
+
+	needsReview := quality.Valid && float64(quality.Float32) < common.OCRReviewThreshold()
+	err = queries.SetCardNeedsReview(context.Background(), database.SetCardNeedsReviewParams{
+		ID:          cardID,
+		NeedsReview: needsReview,
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("error flagging card for review: %w", err)
+	}
+
+	return needsReview, float64(quality.Float32), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// relatedImpl implements the related command functionality
+func relatedImpl(cardID int, limit int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	title, err := queries.GetCardTitle(context.Background(), int32(cardID))
+	if err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	embeddingModel, err := common.CurrentEmbeddingModel()
+	if err != nil {
+		return err
+	}
+
+	// Compare the average embedding of the card with the chunks of all other cards
+	related, err := queries.SearchRelatedCards(context.Background(), database.SearchRelatedCardsParams{
+		CardID:  int32(cardID),
+		Limit:   int32(limit),
+		Model:   embeddingModel.Name,
+		OwnerID: owner,
+	})
+	if err != nil {
+		return fmt.Errorf("error searching related cards: %w", err)
+	}
+
+	if len(related) == 0 {
+		return fmt.Errorf("no related cards found, card %d might not have any embeddings", cardID)
+	}
+
+	fmt.Printf("Cards related to %d \"%s\":\n", cardID, title)
+	fmt.Println("\nCard\tDist\tTitle")
+	fmt.Println("------------------------------------------------------------------------------")
+
+	for _, card := range related {
+		fmt.Printf("%4d\t%5.3f\t%s\n", card.CardID, card.Distance, card.Title)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// renameImpl implements the rename command functionality
+func renameImpl(cardID int, title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return fmt.Errorf("title cannot be empty")
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
+	}
+
+	// Make sure the card exists
+	oldTitle, err := queries.GetCardTitle(context.Background(), int32(cardID))
+	if err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	err = queries.SetCardTitle(context.Background(), database.SetCardTitleParams{
+		ID:    int32(cardID),
+		Title: title,
+	})
+	if err != nil {
+		return fmt.Errorf("error renaming card: %w", err)
+	}
+
+	fmt.Println(common.T(msgRenamedCard, cardID, oldTitle, title))
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// Stages of ume upload, recorded on the card when they finish
+const (
+	stageCreated   = "created"   // the card was created, its image wasn't uploaded
+	stageUploaded  = "uploaded"  // the image is stored in Minio
+	stageExtracted = "extracted" // the markdown and the OCR result are stored in Minio
+	stageStored    = "stored"    // the markdown, title and embeddings are stored, the upload is done
+)
+
+// setUploadStage records the last stage of the upload of a card that finished
+func setUploadStage(queries *database.Queries, cardID int32, stage string) error {
+	err := queries.SetCardUploadStage(context.Background(), database.SetCardUploadStageParams{ID: cardID, UploadStage: stage})
+	if err != nil {
+		return fmt.Errorf("error recording upload stage of card %d: %w", cardID, err)
+	}
+	return nil
+}
+
+// resumeUpload continues the upload of a card after its last stage that finished
+func resumeUpload(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, cardID int32, stage string, job uploadJob, progress *common.Progress) error {
+	switch stage {
+	case stageStored:
+		return nil
+	case stageCreated:
+		// Cards uploaded offline are uploaded from the copy of their image
+		if job.Spooled != "" {
+			return uploadSpooled(dbpool, queries, minioClient, cardID, job, progress)
+		}
+		return fmt.Errorf("the image of card %d was never uploaded, upload it again and delete the card with: ume delete %d", cardID, cardID)
+	case stageExtracted:
+		// Uploads extracted before markdown was stored by hash have no hash
+		content, err := minioClient.ReadMarkdownObject(cardID, 1, job.Extracted, job.Extracted != "")
+		if err != nil {
+			return fmt.Errorf("error reading the extracted markdown of card %d: %w", cardID, err)
+		}
+		// Vision has no OCR result
+		var ocrResult []byte
+		if job.Method != common.MethodVision {
+			ocrResult, err = minioClient.ReadOCRForCard(cardID, 1)
+			if err != nil {
+				return fmt.Errorf("error reading the OCR result of card %d: %w", cardID, err)
+			}
+		}
+		return storeUpload(dbpool, queries, minioClient, cardID, string(content), string(ocrResult), job, progress)
+	case stageUploaded:
+		image, err := queries.GetCardImage(context.Background(), cardID)
+		if err != nil {
+			return fmt.Errorf("error getting image of card %d: %w", cardID, err)
+		}
+
+		// The image keeps its name, as the OCR services tell the format by the extension
+		tmpDir, err := os.MkdirTemp("", common.TempPrefix+"resume_")
+		if err != nil {
+			return fmt.Errorf("error creating temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		imagePath := filepath.Join(tmpDir, filepath.Base(image.Filename))
+		if err := minioClient.GetFileFromMinio(minioClient.ImageBucket, image.Filename, imagePath); err != nil {
+			return fmt.Errorf("error downloading image %s: %w", image.Filename, err)
+		}
+
+		// Cards uploaded offline with the auto method are classified again, as only the
+		// job of the upload is kept
+		job, err = classifyUpload(imagePath, job, progress)
+		if err != nil {
+			return err
+		}
+		return processUpload(dbpool, queries, minioClient, cardID, imagePath, job, progress)
+	default:
+		return fmt.Errorf("unknown upload stage of card %d: %s", cardID, stage)
+	}
+}
+
+// resumeImpl implements the resume command functionality. The upload of a card, or of
+// every card whose upload was interrupted if all is set, continues after its last stage
+// that finished. Cards queued for ume worker are left to it.
+func resumeImpl(cardID int, all, quiet bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	cardIDs := []int32{int32(cardID)}
+	if all {
+		unfinished, err := queries.ListUnfinishedUploads(context.Background())
+		if err != nil {
+			return fmt.Errorf("error listing unfinished uploads: %w", err)
+		}
+		if len(unfinished) == 0 {
+			fmt.Println("No interrupted uploads found.")
+			return nil
+		}
+		cardIDs = cardIDs[:0]
+		for _, card := range unfinished {
+			cardIDs = append(cardIDs, card.ID)
+		}
+	}
+
+	failed := 0
+	for _, id := range cardIDs {
+		err := resumeCard(dbpool, queries, minioClient, id, quiet)
+		if err != nil && !all {
+			return err
+		}
+		if err != nil {
+			fmt.Printf("Failed to resume card %d: %v\n", id, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to resume %d of %d cards", failed, len(cardIDs))
+	}
+	return nil
+}
+
+// resumeCard continues the upload of a card with the options it was uploaded with
+func resumeCard(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, cardID int32, quiet bool) error {
+	upload, err := queries.GetCardUpload(context.Background(), cardID)
+	if err != nil {
+		return &common.CardError{CardID: cardID, Err: err}
+	}
+	if upload.UploadStage == stageStored {
+		fmt.Printf("The upload of card %d is complete.\n", cardID)
+		return nil
+	}
+
+	var job uploadJob
+	if err := json.Unmarshal(upload.UploadOptions, &job); err != nil {
+		return fmt.Errorf("error decoding upload options of card %d: %w", cardID, err)
+	}
+
+	fmt.Printf("Resuming the upload of card %d after the %s stage\n", cardID, upload.UploadStage)
+	progress := common.NewProgress(quiet)
+	defer progress.Done()
+	if err := resumeUpload(dbpool, queries, minioClient, cardID, upload.UploadStage, job, progress); err != nil {
+		return err
+	}
+	progress.Done()
+	fmt.Printf("Finished the upload of card %d\n", cardID)
+	return nil
+}
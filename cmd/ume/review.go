@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// reviewImpl implements the review command functionality
+func reviewImpl(limit int, lang string) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	due, err := queries.ListDueReviews(context.Background(), database.ListDueReviewsParams{
+		OwnerID: owner,
+		Limit:   int32(limit),
+	})
+	if err != nil {
+		return fmt.Errorf("error listing due cards: %w", err)
+	}
+
+	if len(due) == 0 {
+		fmt.Println("No cards are due for review.")
+		return nil
+	}
+
+	// Every card is graded by the user
+	if !common.CanPrompt() {
+		return fmt.Errorf("%w: %d cards are due, review them on a terminal", common.ErrInputRequired, len(due))
+	}
+
+	// Initialize Minio client, cards are shown through the local server
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	baseURL, stop, err := startLocalServer(newCardServer(queries, minioClient, lang).mux())
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	fmt.Printf("%d cards are due for review\n", len(due))
+	fmt.Println("Grades: 0-2 forgotten, 3 hard, 4 good, 5 easy (s to skip, q to quit)")
+
+	reader := bufio.NewReader(os.Stdin)
+	reviewed := 0
+	for i, card := range due {
+		fmt.Printf("\n[%d/%d] Card %d: %s\n", i+1, len(due), card.ID, card.Title)
+
+		url := fmt.Sprintf("%s/card/%d", baseURL, card.ID)
+		if err := common.OpenBrowser(url); err != nil {
+			fmt.Printf("Could not open browser, open %s instead: %v\n", url, err)
+		}
+
+		grade, err := promptGrade(reader)
+		if err != nil {
+			return err
+		}
+		if grade == -2 {
+			break
+		}
+		if grade == -1 {
+			continue
+		}
+
+		next := common.NextReview(common.ReviewState{
+			Repetitions:  int(card.Repetitions),
+			IntervalDays: int(card.IntervalDays),
+			Ease:         float64(card.Ease),
+		}, grade)
+
+		err = queries.UpsertReview(context.Background(), database.UpsertReviewParams{
+			CardID:       card.ID,
+			Repetitions:  int32(next.Repetitions),
+			IntervalDays: int32(next.IntervalDays),
+			Ease:         float32(next.Ease),
+		})
+		if err != nil {
+			return fmt.Errorf("error storing review of card %d: %w", card.ID, err)
+		}
+
+		reviewed++
+		fmt.Printf("Next review of card %d in %d days\n", card.ID, next.IntervalDays)
+	}
+
+	fmt.Printf("\nReviewed %d cards\n", reviewed)
+	return nil
+}
+
+// promptGrade asks for a recall grade until a valid one is entered.
+// It returns -1 to skip the card and -2 to quit the review.
+func promptGrade(reader *bufio.Reader) (int, error) {
+	for {
+		fmt.Print("Grade (0-5): ")
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, fmt.Errorf("error reading input: %w", err)
+		}
+
+		input = strings.TrimSpace(strings.ToLower(input))
+		switch input {
+		case "s", "skip":
+			return -1, nil
+		case "q", "quit":
+			return -2, nil
+		}
+
+		grade, err := strconv.Atoi(input)
+		if err == nil && grade >= 0 && grade <= 5 {
+			return grade, nil
+		}
+		fmt.Println("Please enter a grade between 0 and 5, s or q.")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// reviewQueueImpl lists the cards flagged for review because their OCR quality was low.
+// If done is set that card is removed from the queue instead.
+func reviewQueueImpl(done int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if done > 0 {
+		if err := requireCardWrite(queries, done); err != nil {
+			return err
+		}
+
+		err = queries.SetCardNeedsReview(context.Background(), database.SetCardNeedsReviewParams{ID: int32(done), NeedsReview: false})
+		if err != nil {
+			return fmt.Errorf("error clearing the review flag: %w", err)
+		}
+
+		fmt.Printf("Removed card %d from the review queue\n", done)
+		return nil
+	}
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	cards, err := queries.ListCardsNeedingReview(context.Background(), owner)
+	if err != nil {
+		return fmt.Errorf("error listing cards needing review: %w", err)
+	}
+
+	if len(cards) == 0 {
+		fmt.Println("No cards need review.")
+		return nil
+	}
+
+	fmt.Println("Card\tQuality\tTitle")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, card := range cards {
+		fmt.Printf("%4d\t%.2f\t%s\n", card.ID, card.Quality, card.Title)
+	}
+
+	fmt.Println()
+	fmt.Println("Fix a card with: ume edit <card_id>")
+	return nil
+}
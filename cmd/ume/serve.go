@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// sessionCookie is the cookie that keeps a browser logged in with a session token
+const sessionCookie = "ume_session"
+
+// sessionDuration is how long a browser stays logged in
+const sessionDuration = 30 * 24 * time.Hour
+
+// userContextKey is the context key of the authenticated user
+type userContextKey struct{}
+
+// serveImpl implements the serve command functionality
+func serveImpl(addr, lang string) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+	common.ResolveCardUID = cardUIDResolver(queries)
+	common.ResolveCardAlias = cardAliasResolver(queries)
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	users, err := queries.ListUsers(context.Background())
+	if err != nil {
+		return fmt.Errorf("error listing users: %w", err)
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("no users found, create one with: ume user add <name>")
+	}
+
+	// Sessions are checked for expiry on each request, so this only keeps the table small
+	if err := queries.DeleteExpiredSessions(context.Background()); err != nil {
+		return fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+
+	mux := newCardServer(queries, minioClient, lang).mux()
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		cards, err := galleryCards(queries, requestOwner(r), pgtype.Int4{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := markPinnedCards(r.Context(), queries, requestOwner(r), cards); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		renderTemplate(w, "gallery.html", cards)
+	})
+
+	mux.HandleFunc("GET /api/search", func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			http.Error(w, "missing query parameter q", http.StatusBadRequest)
+			return
+		}
+
+		// The same time range as ume lookup --since and --until
+		since, until, err := common.ParseTimeRange(r.URL.Query().Get("since"), r.URL.Query().Get("until"), time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, err := searchCards(queries, query, 10, searchOptions{
+			Owner:           requestOwner(r),
+			Since:           since,
+			Until:           until,
+			IncludeArchived: r.URL.Query().Get("include_archived") == "true",
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	})
+
+	// Each user arranges the cards they can access on their own board
+	registerBoardHandlers(mux, queries, requestOwner)
+	registerGraphHandlers(mux, queries, requestOwner)
+
+	// Cards are copied between instances by ume sync remote
+	registerSyncHandlers(mux, queries, minioClient)
+
+	// Browsers can't send bearer tokens, so the key is posted once and exchanged for a
+	// session cookie, which never holds the key itself
+	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
+		renderTemplate(w, "login.html", nil)
+	})
+
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		user, err := userByAPIKey(queries, r.PostFormValue("key"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		token, err := common.GenerateAPIKey()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		expires := time.Now().Add(sessionDuration)
+		err = queries.CreateSession(r.Context(), database.CreateSessionParams{
+			TokenHash: common.HashAPIKey(token),
+			UserID:    user.ID,
+			ExpiresAt: pgtype.Timestamptz{Time: expires, Valid: true},
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error creating session: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    token,
+			Path:     "/",
+			Expires:  expires,
+			Secure:   isHTTPS(r),
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+
+	// Scraped by Prometheus without an API key, so it only holds counts and durations
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		common.WriteMetrics(w)
+		writePoolMetrics(w, dbpool)
+	})
+
+	fmt.Printf("Serving %d users on %s\n", len(users), addr)
+	fmt.Println("Log in at /login in a browser, or send an Authorization: Bearer <api key> header")
+	return http.ListenAndServe(addr, instrumentRequests(mux, requireUser(queries, mux)))
+}
+
+// isHTTPS reports whether a request came over HTTPS, directly or through a proxy that
+// terminates TLS. Cookies are only marked secure then, as browsers don't send secure
+// cookies over plain HTTP.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// statusRecorder keeps the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the original writer, so http.ResponseController can still flush
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrumentRequests counts the requests and records their durations by the route of the
+// mux they match, so card IDs don't make a series each
+func instrumentRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(recorder.status)
+		common.IncCounter("ume_http_requests_total", "Number of HTTP requests.", "route", route, "status", status)
+		common.ObserveDuration("ume_http_request_duration_seconds", "Duration of HTTP requests.", time.Since(start), "route", route)
+	})
+}
+
+// writePoolMetrics writes the statistics of the database pool as gauges
+func writePoolMetrics(w io.Writer, dbpool *pgxpool.Pool) {
+	stat := dbpool.Stat()
+	common.WriteGauge(w, "ume_db_pool_max_conns", "Maximum number of connections in the pool.", float64(stat.MaxConns()))
+	common.WriteGauge(w, "ume_db_pool_total_conns", "Number of connections in the pool.", float64(stat.TotalConns()))
+	common.WriteGauge(w, "ume_db_pool_acquired_conns", "Number of connections in use.", float64(stat.AcquiredConns()))
+	common.WriteGauge(w, "ume_db_pool_idle_conns", "Number of idle connections.", float64(stat.IdleConns()))
+	common.WriteGauge(w, "ume_db_pool_acquire_count", "Number of connections acquired from the pool.", float64(stat.AcquireCount()))
+	common.WriteGauge(w, "ume_db_pool_acquire_duration_seconds", "Total time spent acquiring connections.", stat.AcquireDuration().Seconds())
+	common.WriteGauge(w, "ume_db_pool_empty_acquire_count", "Number of acquires that waited for a connection.", float64(stat.EmptyAcquireCount()))
+}
+
+// requireUser authenticates requests with an API key and only lets users access the
+// cards they own, the cards shared with everyone and the cards in collections shared with them
+func requireUser(queries *database.Queries, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" || r.URL.Path == "/metrics" || strings.HasPrefix(r.URL.Path, "/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := requestUser(queries, r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Cards owned by other users are reported as missing
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/card/"); ok {
+			id, _, _ := strings.Cut(rest, "/")
+			cardID, err := common.ParseCardIDString(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			ok, err := queries.CanAccessCard(r.Context(), database.CanAccessCardParams{
+				CardID: int32(cardID),
+				UserID: user.ID,
+			})
+			if err != nil || !ok {
+				http.Error(w, "card not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey{}, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestUser returns the user of the API key in the Authorization header, or of the
+// session cookie of a browser
+func requestUser(queries *database.Queries, r *http.Request) (database.GetUserByAPIKeyHashRow, error) {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return userByAPIKey(queries, key)
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return database.GetUserByAPIKeyHashRow{}, fmt.Errorf("not logged in")
+	}
+	user, err := queries.GetUserBySessionHash(r.Context(), common.HashAPIKey(cookie.Value))
+	if err != nil {
+		return database.GetUserByAPIKeyHashRow{}, fmt.Errorf("invalid session")
+	}
+	return database.GetUserByAPIKeyHashRow{ID: user.ID, Name: user.Name}, nil
+}
+
+// requestOwner returns the authenticated user of a request as a card owner filter
+func requestOwner(r *http.Request) pgtype.Int4 {
+	user, ok := r.Context().Value(userContextKey{}).(database.GetUserByAPIKeyHashRow)
+	if !ok {
+		return pgtype.Int4{}
+	}
+	return pgtype.Int4{Int32: user.ID, Valid: true}
+}
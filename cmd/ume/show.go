@@ -1,13 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
-	"os"
-	"path/filepath"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yasushisakai/umesao/database"
 	"github.com/yasushisakai/umesao/pkg/common"
 )
 
@@ -21,6 +30,8 @@ func showCmd(args []string) error {
 	versionShortFlag := showFlags.Int("v", -1, "Version number of markdown file (default: latest)")
 	langFlag := showFlags.String("lang", "", "Translate markdown to specified language")
 	langShortFlag := showFlags.String("l", "", "Translate markdown to specified language")
+	allFlag := showFlags.Bool("all", false, "Show a gallery of all cards")
+	chunkFlag := showFlags.Int("chunk", -1, "Highlight a chunk, like the one a lookup matched")
 	showFlags.Parse(args[1:])
 
 	// If short flag is set but long flag is not, use short flag's value
@@ -34,156 +45,451 @@ func showCmd(args []string) error {
 		lang = *langShortFlag
 	}
 
+	if *allFlag {
+		return showAllImpl(lang)
+	}
+
 	cardID, err := common.ParseCardIDString(showFlags.Arg(0))
 	if err != nil {
 		return err
 	}
 
-	return showImpl(cardID, version, lang)
+	return showImpl(cardID, version, lang, *chunkFlag)
 }
 
-func showImpl(cardID int, version int, lang string) error {
-	dbpool, queries, err := common.InitDB()
+// showImpl shows a card version in the browser. If chunk is not -1 the page is scrolled
+// to the chunk with that index and it is highlighted.
+func showImpl(cardID int, version int, lang string, chunk int) error {
+	dbpool, queries, err := initShowDB(lang != "")
 	if err != nil {
 		return err
 	}
 	defer dbpool.Close()
 
-	// Get card information
-	card, err := queries.GetCardImage(context.Background(), int32(cardID))
+	// Initialize Minio client, the image is proxied through the local server
+	minioClient, err := showMinioClient()
+	if err != nil {
+		return err
+	}
+
+	server := newCardServer(queries, minioClient, lang)
+
+	// Load the page once up front so errors are reported on the command line
+	page, err := server.page(cardID, version, chunk)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Showing card %d, version %d: %s\n", cardID, page.Version, page.Title)
+	path := fmt.Sprintf("/card/%d?version=%d", cardID, version)
+	if chunk != -1 {
+		path += fmt.Sprintf("&chunk=%d#match", chunk)
+	}
+	return serveUntilEnter(server.mux(), path)
+}
+
+// initShowDB connects to the database for showing cards. If nothing is stored a replica
+// can be used, while translations and board positions are stored on the primary.
+func initShowDB(write bool) (*pgxpool.Pool, *database.Queries, error) {
+	var dbpool *pgxpool.Pool
+	var queries *database.Queries
+	var err error
+	if !write {
+		dbpool, queries, err = common.InitDBReadOnly()
+	} else {
+		dbpool, queries, err = common.InitDB()
+	}
 	if err != nil {
-		return fmt.Errorf("card not found: %w", err)
+		return nil, nil, err
+	}
+
+	// The card pages are served at /card/<uid> and /card/<alias> too
+	common.ResolveCardUID = cardUIDResolver(queries)
+	common.ResolveCardAlias = cardAliasResolver(queries)
+	return dbpool, queries, nil
+}
+
+// showMinioClient returns the Minio client images and attachments are proxied from.
+// Offline there is none, and only what is stored in the database or cached is shown.
+func showMinioClient() (*common.MinioClient, error) {
+	if common.Offline {
+		fmt.Println(common.T(msgOfflineShow))
+		return nil, nil
+	}
+	return common.NewMinioClient()
+}
+
+// galleryCard is a card entry rendered by the gallery template
+type galleryCard struct {
+	CardID  int32
+	UID     string
+	Version int32
+	Title   string
+	Snippet string
+	// Text is the whole markdown of the card, searched in published sites
+	Text     string
+	HasImage bool
+	// Pinned cards are shown in their own section of the gallery
+	Pinned bool
+}
+
+// showAllImpl shows a gallery of all cards in the browser, with the board to arrange them
+func showAllImpl(lang string) error {
+	dbpool, queries, err := initShowDB(true)
+	if err != nil {
+		return err
+	}
+	defer dbpool.Close()
+
+	minioClient, err := showMinioClient()
+	if err != nil {
+		return err
+	}
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
 	}
 
-	// Get image URL
-	minioClient, err := common.NewMinioClient()
+	cards, err := galleryCards(queries, owner, pgtype.Int4{})
 	if err != nil {
 		return err
 	}
+	if err := markPinnedCards(context.Background(), queries, owner, cards); err != nil {
+		return err
+	}
+	if minioClient == nil {
+		for i := range cards {
+			cards[i].HasImage = false
+		}
+	}
+
+	mux := newCardServer(queries, minioClient, lang).mux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		renderTemplate(w, "gallery.html", cards)
+	})
+	registerBoardHandlers(mux, queries, func(*http.Request) pgtype.Int4 { return owner })
+	registerGraphHandlers(mux, queries, func(*http.Request) pgtype.Int4 { return owner })
+
+	fmt.Printf("Showing %d cards\n", len(cards))
+	return serveUntilEnter(mux, "/")
+}
+
+// galleryCards lists the cards accessible to the owner for the gallery template.
+// If collectionID is set only the cards in that collection are listed.
+func galleryCards(queries *database.Queries, owner, collectionID pgtype.Int4) ([]galleryCard, error) {
+	rows, err := queries.ListCards(context.Background(), database.ListCardsParams{OwnerID: owner, CollectionID: collectionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cards: %w", err)
+	}
+
+	cards := make([]galleryCard, 0, len(rows))
+	for _, row := range rows {
+		title := row.Title
+		if title == "" {
+			title = common.MarkdownTitle(row.Text.String, 60)
+		}
+
+		cards = append(cards, galleryCard{
+			CardID:   row.ID,
+			UID:      row.Uid,
+			Version:  row.Ver,
+			Title:    title,
+			Snippet:  common.Snippet(row.Text.String, 200),
+			Text:     row.Text.String,
+			HasImage: row.HasImage,
+		})
+	}
+
+	return cards, nil
+}
+
+// cardServer serves card pages and images, caching rendered pages
+// so translations are only requested once per session
+type cardServer struct {
+	queries     *database.Queries
+	minioClient *common.MinioClient
+	lang        string
+
+	mu    sync.Mutex
+	pages map[[3]int]cardPage
+}
+
+// newCardServer creates a cardServer
+func newCardServer(queries *database.Queries, minioClient *common.MinioClient, lang string) *cardServer {
+	return &cardServer{
+		queries:     queries,
+		minioClient: minioClient,
+		lang:        lang,
+		pages:       make(map[[3]int]cardPage),
+	}
+}
+
+// page returns the rendered page of a card version with a chunk highlighted, loading it
+// if it's not cached yet
+func (s *cardServer) page(cardID, version, chunk int) (cardPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [3]int{cardID, version, chunk}
+	if page, ok := s.pages[key]; ok {
+		return page, nil
+	}
+
+	page, err := loadCardPage(s.queries, s.minioClient, cardID, version, s.lang, chunk)
+	if err != nil {
+		return cardPage{}, err
+	}
+	s.pages[key] = page
+	return page, nil
+}
+
+// mux creates a mux serving card pages and images
+func (s *cardServer) mux() *http.ServeMux {
+	mux := newWebMux()
+
+	mux.HandleFunc("GET /card/{id}", func(w http.ResponseWriter, r *http.Request) {
+		cardID, err := common.ParseCardIDString(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		version := -1
+		if v := r.URL.Query().Get("version"); v != "" {
+			version, err = strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "invalid version", http.StatusBadRequest)
+				return
+			}
+		}
+
+		chunk := -1
+		if c := r.URL.Query().Get("chunk"); c != "" {
+			chunk, err = strconv.Atoi(c)
+			if err != nil {
+				http.Error(w, "invalid chunk", http.StatusBadRequest)
+				return
+			}
+		}
+
+		page, err := s.page(cardID, version, chunk)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		renderTemplate(w, "card.html", page)
+	})
+
+	mux.HandleFunc("GET /card/{id}/image", func(w http.ResponseWriter, r *http.Request) {
+		cardID, err := common.ParseCardIDString(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	imageURL := minioClient.GetImageURLForCard(card.Filename)
+		card, err := s.queries.GetCardImage(r.Context(), int32(cardID))
+		if err != nil {
+			http.Error(w, "card not found", http.StatusNotFound)
+			return
+		}
 
-	var markdownContent string
+		// Images are kept in the content cache, so they are only downloaded once
+		data, err := common.ReadImage(s.minioClient, card.Filename)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, card.Filename, time.Time{}, bytes.NewReader(data))
+	})
+
+	mux.HandleFunc("GET /card/{id}/attachments/{name}", func(w http.ResponseWriter, r *http.Request) {
+		cardID, err := common.ParseCardIDString(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		attachment, err := s.queries.GetAttachment(r.Context(), database.GetAttachmentParams{
+			CardID:   int32(cardID),
+			Filename: r.PathValue("name"),
+		})
+		if err != nil {
+			http.Error(w, "attachment not found", http.StatusNotFound)
+			return
+		}
+
+		if s.minioClient == nil {
+			http.Error(w, "not available offline", http.StatusNotFound)
+			return
+		}
+
+		// Attachments are downloaded rather than opened, whatever their type
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+		serveObject(w, r, s.minioClient, s.minioClient.AttachmentBucket, attachment.ObjectName)
+	})
+
+	return mux
+}
+
+// loadCardPage loads a card's markdown, translates it if needed and renders it to HTML.
+// If version is -1 the latest version is loaded. If chunk is not -1 the blocks of the
+// chunk with that index are highlighted.
+func loadCardPage(queries *database.Queries, minioClient *common.MinioClient, cardID int, version int, lang string, chunk int) (cardPage, error) {
+	// Make sure the card exists
+	title, err := queries.GetCardTitle(context.Background(), int32(cardID))
+	if err != nil {
+		return cardPage{}, fmt.Errorf("card not found: %w", err)
+	}
+
+	// Cards created from text have no image, and cards created from a voice memo have audio instead
+	image, err := queries.GetCardImage(context.Background(), int32(cardID))
+	// Offline only cached images can be shown, and no audio.
+	hasImage := err == nil && common.Method(image.Method) != common.MethodAudio && (minioClient != nil || imageCached(image.Filename))
+	hasAudio := err == nil && common.Method(image.Method) == common.MethodAudio && minioClient != nil
 
 	// If no version is specified, get the latest version
 	if version == -1 {
 		latestVersion, err := queries.GetLatestMarkdownVersion(context.Background(), int32(cardID))
 		if err != nil {
-			return fmt.Errorf("failed to get latest markdown version: %w", err)
+			return cardPage{}, fmt.Errorf("failed to get latest markdown version: %w", err)
 		}
 		version = int(latestVersion)
 	}
 
-	// Create a temporary file to store the markdown content
-	tmpFile, err := os.CreateTemp("", fmt.Sprintf("card_%d_*.md", cardID))
+	// Get markdown content
+	markdownContent, err := common.ReadMarkdown(context.Background(), queries, minioClient, int32(cardID), int32(version))
 	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %w", err)
+		return cardPage{}, fmt.Errorf("failed to get markdown: %w", err)
 	}
-	tmpFileName := tmpFile.Name()
-	tmpFile.Close()
-	defer os.Remove(tmpFileName)
 
-	// Get markdown content
-	err = minioClient.GetMarkdownForCard(int32(cardID), int32(version), tmpFileName)
+	// If language is specified, use the stored translation or translate the markdown.
+	// Offline the card is shown untranslated unless its translation is cached.
+	if lang != "" {
+		translatedContent, err := getTranslation(queries, minioClient, cardID, int32(version), lang, markdownContent)
+		switch {
+		case errors.Is(err, common.ErrOffline):
+			fmt.Println(common.T(msgOfflineNoLang, err))
+			lang = ""
+		case err != nil:
+			return cardPage{}, err
+		default:
+			markdownContent = translatedContent
+		}
+	}
+
+	// Render the markdown on the server side, with links to other cards.
+	// Untranslated versions converted from OCR are marked with the regions of the image they came from.
+	var regions []common.OCRLine
+	if lang == "" {
+		regions = cardRegions(queries, minioClient, int32(cardID), int32(version))
+	}
+
+	// The range of the highlighted chunk is moved along with the links rewritten before it
+	start, end := chunkRange(queries, int32(cardID), int32(version), lang, chunk)
+	start, end = common.LinkifiedOffset(markdownContent, start), common.LinkifiedOffset(markdownContent, end)
+
+	var htmlContent template.HTML
+	if len(regions) > 0 || start < end {
+		htmlContent, err = common.RenderMarkdownHighlighted(common.LinkifyCardLinks(markdownContent), regions, start, end)
+	} else {
+		htmlContent, err = common.RenderMarkdown(common.LinkifyCardLinks(markdownContent))
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get markdown: %w", err)
+		return cardPage{}, err
+	}
+
+	if title == "" {
+		title = common.MarkdownTitle(markdownContent, 60)
 	}
 
-	// Read markdown content
-	markdownBytes, err := os.ReadFile(tmpFileName)
+	uid, err := queries.GetCardUID(context.Background(), int32(cardID))
 	if err != nil {
-		return fmt.Errorf("failed to read markdown file: %w", err)
+		return cardPage{}, fmt.Errorf("failed to get card UID: %w", err)
 	}
-	markdownContent = string(markdownBytes)
 
-	// If language is specified, translate the markdown
-	if lang != "" {
-		openaiClient, err := common.NewOpenAIClient()
-		if err != nil {
-			return fmt.Errorf("failed to create OpenAI client: %w", err)
-		}
+	rows, err := queries.ListAttachments(context.Background(), int32(cardID))
+	if err != nil {
+		return cardPage{}, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	attachments := make([]cardAttachment, 0, len(rows))
+	for _, row := range rows {
+		attachments = append(attachments, cardAttachment{
+			Filename: row.Filename,
+			URL:      fmt.Sprintf("/card/%d/attachments/%s", cardID, url.PathEscape(row.Filename)),
+			Size:     row.Size,
+		})
+	}
 
-		translatedContent, err := openaiClient.TranslateText(markdownContent, lang)
-		if err != nil {
-			return fmt.Errorf("failed to translate text: %w", err)
-		}
-		markdownContent = translatedContent
-	}
-
-	// Create HTML content
-	htmlContent := fmt.Sprintf(`<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Card %d - Version %d</title>
-    <style>
-        body {
-			background-color: #000000;
-            font-family: Arial, sans-serif;
-            max-width: 1200px;
-            margin: 0 auto;
-            padding: 20px;
-            display: flex;
-        }
-        .image-container {
-            flex: 1;
-            padding-right: 20px;
-        }
-        .markdown-container {
-            flex: 1;
-        }
-        img {
-			filter: invert(1);
-            max-width: 100%%;
-            max-height: 800px;
-            object-fit: contain;
-        }
-    </style>
-    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/github-markdown-css/github-markdown.min.css">
-    <script src="https://cdn.jsdelivr.net/npm/marked/marked.min.js"></script>
-</head>
-<body>
-	<div>
-    <div class="image-container">
-        <img src="%s" alt="Card Image">
-    </div>
-    <div class="markdown-container markdown-body" id="markdown-content"></div>
-    <script>
-        document.getElementById('markdown-content').innerHTML = marked.parse("%s");
-    </script>
-	</div>
-</body>
-</html>`, cardID, version, imageURL, template.JSEscapeString(markdownContent))
-
-	// Create a temporary HTML file
-	htmlTmpFile, err := os.CreateTemp("", fmt.Sprintf("card_%d_*.html", cardID))
-	if err != nil {
-		return fmt.Errorf("failed to create temporary HTML file: %w", err)
-	}
-	htmlTmpFileName := htmlTmpFile.Name()
-
-	// Write HTML content to file
-	_, err = htmlTmpFile.WriteString(htmlContent)
-	if err != nil {
-		htmlTmpFile.Close()
-		os.Remove(htmlTmpFileName)
-		return fmt.Errorf("failed to write HTML file: %w", err)
-	}
-	htmlTmpFile.Close()
-
-	// Convert to file URL
-	htmlFileURL := fmt.Sprintf("file://%s", filepath.ToSlash(htmlTmpFileName))
-
-	// Open HTML file in browser
-	err = common.OpenBrowser(htmlFileURL)
-	if err != nil {
-		os.Remove(htmlTmpFileName)
-		return err
+	source, err := cardSource(context.Background(), queries, int32(cardID))
+	if err != nil {
+		return cardPage{}, err
+	}
+
+	return cardPage{
+		CardID:      cardID,
+		UID:         uid,
+		Title:       title,
+		Version:     version,
+		Language:    lang,
+		Content:     htmlContent,
+		HasImage:    hasImage,
+		HasAudio:    hasAudio,
+		HasRegions:  len(regions) > 0,
+		Attachments: attachments,
+		Source:      source,
+	}, nil
+}
+
+// imageCached reports whether an image is in the content cache
+func imageCached(name string) bool {
+	cache, err := common.NewContentCache()
+	return err == nil && cache.HasImage(name)
+}
+
+// chunkRange returns the byte range of the markdown a chunk was taken from. Without a
+// chunk, or for chunks stored before their range was recorded, the range is empty.
+func chunkRange(queries *database.Queries, cardID, version int32, lang string, chunk int) (int, int) {
+	if chunk == -1 {
+		return 0, 0
 	}
 
-	fmt.Printf("Opened card %d in browser. Press Enter to close...\n", cardID)
-	fmt.Scanln() // Wait for user input before removing the file
+	row, err := queries.GetChunkRange(context.Background(), database.GetChunkRangeParams{
+		CardID: cardID,
+		Ver:    version,
+		Idx:    int32(chunk),
+		Lang:   lang,
+	})
+	if err != nil {
+		return 0, 0
+	}
+	return int(row.StartOffset), int(row.EndOffset)
+}
+
+// cardRegions returns the OCR lines of the result a version was converted from.
+// Cards without a stored OCR result or bounding boxes have no lines, as have all cards
+// without a Minio client to read the results from.
+func cardRegions(queries *database.Queries, minioClient *common.MinioClient, cardID, version int32) []common.OCRLine {
+	if minioClient == nil {
+		return nil
+	}
 
-	// Remove the temporary file after user is done viewing
-	return os.Remove(htmlTmpFileName)
+	ocrVersion, err := queries.FindOCRVersion(context.Background(), database.FindOCRVersionParams{
+		CardID: cardID,
+		Ver:    version,
+	})
+	if err != nil {
+		return nil
+	}
+
+	ocrResult, err := minioClient.ReadOCRForCard(cardID, ocrVersion)
+	if err != nil {
+		return nil
+	}
+
+	lines, err := common.ParseOCRLines(string(ocrResult))
+	if err != nil {
+		return nil
+	}
+	return lines
 }
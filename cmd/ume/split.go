@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// splitImpl implements the split command functionality. The latest markdown of the
+// card is opened in the editor, where sections are separated with --- lines. The
+// first section stays in the card as a new version, and every other section becomes
+// a new card that shares the card's images.
+func splitImpl(cardID int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	// Get OpenAI API key
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	if _, err := queries.GetCardTitle(context.Background(), int32(cardID)); err != nil {
+		return &common.CardError{CardID: int32(cardID), Err: err}
+	}
+
+	latestVersion, content, err := latestMarkdown(queries, minioClient, int32(cardID))
+	if err != nil {
+		return err
+	}
+
+	// Display image for the card if available
+	err = common.DisplayCardImages(int32(cardID), *queries)
+	if err != nil {
+		fmt.Printf("Note: %v (no image found or error displaying)\n", err)
+	}
+
+	tempFile, err := common.WriteTempFile(fmt.Sprintf("%s%d_%d_split_*.md", common.TempPrefix, cardID, latestVersion), []byte(content))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile)
+
+	fmt.Printf("Separate the sections of the card with lines containing only %s\n", common.SplitMarker)
+	err = openInEditor(tempFile)
+	if err != nil {
+		return err
+	}
+
+	edited, err := os.ReadFile(tempFile)
+	if err != nil {
+		return fmt.Errorf("error reading edited file: %w", err)
+	}
+
+	sections := common.SplitSections(string(edited))
+	if len(sections) < 2 {
+		fmt.Println("No split markers found, the card was not split.")
+		return nil
+	}
+
+	// The new cards are chunked like the original card and belong to the same user
+	methodName, err := queries.GetCardMethod(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error retrieving card method: %w", err)
+	}
+	method := common.Method(methodName)
+
+	owner, err := queries.GetCardOwner(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error getting card owner: %w", err)
+	}
+
+	// The first section replaces the content of the card
+	version := latestVersion + 1
+	err = storeVersion(dbpool, queries, minioClient, openaiKey, int32(cardID), version, pgtype.Int4{Int32: latestVersion, Valid: true}, sections[0], method)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Kept the first section in card %d as version %d\n", cardID, version)
+
+	for _, section := range sections[1:] {
+		newID, err := queries.CreateCard(context.Background())
+		if err != nil {
+			return fmt.Errorf("error creating card: %w", err)
+		}
+
+		if owner.Valid {
+			err = queries.SetCardOwner(context.Background(), database.SetCardOwnerParams{ID: newID, OwnerID: owner})
+			if err != nil {
+				return fmt.Errorf("error setting card owner: %w", err)
+			}
+		}
+
+		// The image objects are shared, not copied
+		err = queries.CopyCardImages(context.Background(), database.CopyCardImagesParams{
+			DstCardID: newID,
+			SrcCardID: int32(cardID),
+		})
+		if err != nil {
+			return fmt.Errorf("error copying images to card %d: %w", newID, err)
+		}
+
+		title, err := storeFirstVersion(dbpool, queries, minioClient, openaiKey, newID, section, method)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created card %d \"%s\"\n", newID, title)
+	}
+
+	fmt.Printf("Split card %d into %d cards\n", cardID, len(sections))
+	return nil
+}
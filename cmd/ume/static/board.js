@@ -0,0 +1,96 @@
+// Arrange cards on the board by dragging them, and group them by name. Positions and
+// groups are stored as soon as they change.
+var board = document.getElementById('board');
+
+function save(card) {
+    fetch('/api/board/' + card.dataset.id, {
+        method: 'PUT',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({
+            x: parseFloat(card.style.left),
+            y: parseFloat(card.style.top),
+            group: card.dataset.group
+        })
+    });
+}
+
+// The same group name always gets the same color
+function groupColor(name) {
+    var hash = 0;
+    for (var i = 0; i < name.length; i++) {
+        hash = (hash * 31 + name.charCodeAt(i)) % 360;
+    }
+    return 'hsl(' + hash + ', 60%, 55%)';
+}
+
+// Draw a labelled box around the cards of each group
+function drawGroups() {
+    board.querySelectorAll('.board-group').forEach(function (box) { box.remove(); });
+    var groups = {};
+    board.querySelectorAll('.board-card').forEach(function (card) {
+        var name = card.dataset.group;
+        card.style.borderColor = name ? groupColor(name) : '';
+        if (!name) {
+            return;
+        }
+        var left = card.offsetLeft, top = card.offsetTop;
+        var right = left + card.offsetWidth, bottom = top + card.offsetHeight;
+        var group = groups[name];
+        groups[name] = group ? {
+            left: Math.min(group.left, left), top: Math.min(group.top, top),
+            right: Math.max(group.right, right), bottom: Math.max(group.bottom, bottom)
+        } : {left: left, top: top, right: right, bottom: bottom};
+    });
+    Object.keys(groups).forEach(function (name) {
+        var group = groups[name];
+        var box = document.createElement('div');
+        box.className = 'board-group';
+        box.textContent = name;
+        box.style.borderColor = box.style.color = groupColor(name);
+        box.style.left = (group.left - 12) + 'px';
+        box.style.top = (group.top - 28) + 'px';
+        box.style.width = (group.right - group.left + 24) + 'px';
+        box.style.height = (group.bottom - group.top + 40) + 'px';
+        board.insertBefore(box, board.firstChild);
+    });
+}
+
+board.querySelectorAll('.board-card').forEach(function (card) {
+    card.addEventListener('pointerdown', function (event) {
+        if (event.target.closest('a')) {
+            return;
+        }
+        var startX = event.clientX - card.offsetLeft;
+        var startY = event.clientY - card.offsetTop;
+        card.setPointerCapture(event.pointerId);
+        card.classList.add('dragging');
+
+        function move(event) {
+            card.style.left = Math.max(0, event.clientX - startX) + 'px';
+            card.style.top = Math.max(0, event.clientY - startY) + 'px';
+        }
+        function drop() {
+            card.removeEventListener('pointermove', move);
+            card.removeEventListener('pointerup', drop);
+            card.classList.remove('dragging');
+            drawGroups();
+            save(card);
+        }
+        card.addEventListener('pointermove', move);
+        card.addEventListener('pointerup', drop);
+    });
+
+    card.addEventListener('dblclick', function () {
+        var name = prompt('Group of card ' + card.dataset.id + ' (empty for none):', card.dataset.group);
+        if (name === null) {
+            return;
+        }
+        card.dataset.group = name.trim();
+        drawGroups();
+        save(card);
+    });
+});
+
+// Images change the size of the cards once they load
+window.addEventListener('load', drawGroups);
+drawGroups();
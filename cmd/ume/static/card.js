@@ -0,0 +1,24 @@
+// Highlight the region of the image a block of markdown came from while hovering it
+var image = document.getElementById('card-image');
+var highlight = document.getElementById('region-highlight');
+
+document.querySelectorAll('[data-region]').forEach(function (block) {
+    block.addEventListener('mouseenter', function () {
+        if (!image.naturalWidth) {
+            return;
+        }
+        // Regions are in pixels of the original image, scale them to the displayed size
+        var region = block.dataset.region.split(',').map(Number);
+        var scale = image.clientWidth / image.naturalWidth;
+        highlight.style.left = (image.offsetLeft + region[0] * scale) + 'px';
+        highlight.style.top = (image.offsetTop + region[1] * scale) + 'px';
+        highlight.style.width = (region[2] * scale) + 'px';
+        highlight.style.height = (region[3] * scale) + 'px';
+        highlight.style.display = 'block';
+        block.classList.add('region-active');
+    });
+    block.addEventListener('mouseleave', function () {
+        highlight.style.display = 'none';
+        block.classList.remove('region-active');
+    });
+});
@@ -0,0 +1,9 @@
+// Filter the gallery by the words typed into the search box
+document.getElementById('search').addEventListener('input', function (event) {
+    var words = event.target.value.toLowerCase().split(/\s+/).filter(Boolean);
+    document.querySelectorAll('.gallery-item').forEach(function (item) {
+        var text = item.dataset.search.toLowerCase();
+        var match = words.every(function (word) { return text.indexOf(word) !== -1; });
+        item.style.display = match ? '' : 'none';
+    });
+});
@@ -0,0 +1,149 @@
+// Draw the cards as a force-directed graph: cards push each other away, while links and
+// similarities pull them together, so clusters and isolated cards stand out.
+var svg = document.getElementById('graph');
+var graphStatus = document.getElementById('graph-status');
+var width = svg.clientWidth || 1160;
+var height = svg.clientHeight || 800;
+var ns = 'http://www.w3.org/2000/svg';
+
+function element(name, attributes) {
+    var el = document.createElementNS(ns, name);
+    Object.keys(attributes).forEach(function (key) { el.setAttribute(key, attributes[key]); });
+    return el;
+}
+
+function draw(graph) {
+    var nodes = {};
+    graph.nodes.forEach(function (node, i) {
+        // Start on a circle so the layout is the same every time
+        var angle = 2 * Math.PI * i / graph.nodes.length;
+        node.x = width / 2 + Math.cos(angle) * width / 3;
+        node.y = height / 2 + Math.sin(angle) * height / 3;
+        node.vx = node.vy = 0;
+        node.degree = 0;
+        nodes[node.id] = node;
+    });
+    graph.edges.forEach(function (edge) {
+        nodes[edge.source].degree++;
+        nodes[edge.target].degree++;
+    });
+
+    var isolated = graph.nodes.filter(function (node) { return node.degree === 0; }).length;
+    graphStatus.textContent = graph.nodes.length + ' cards, ' + graph.edges.length + ' relationships, ' + isolated + ' isolated cards';
+
+    var lines = graph.edges.map(function (edge) {
+        var line = element('line', edge.kind === 'similar'
+            ? {'class': 'graph-similar', 'stroke-width': 1 + 2 * edge.weight}
+            : {'class': 'graph-link', 'marker-end': 'url(#arrow)'});
+        svg.appendChild(line);
+        return line;
+    });
+
+    var dragged = null;
+    var circles = graph.nodes.map(function (node) {
+        var group = element('g', {'class': node.degree === 0 ? 'graph-node graph-isolated' : 'graph-node'});
+        var title = element('title', {});
+        title.textContent = node.id + '. ' + node.title;
+        group.appendChild(title);
+        group.appendChild(element('circle', {r: 5 + Math.min(node.degree, 10)}));
+        var label = element('text', {dx: 12, dy: 4});
+        label.textContent = node.title.length > 24 ? node.title.slice(0, 24) + '…' : node.title;
+        group.appendChild(label);
+
+        var moved = false;
+        group.addEventListener('pointerdown', function (event) {
+            dragged = node;
+            moved = false;
+            group.setPointerCapture(event.pointerId);
+        });
+        group.addEventListener('pointermove', function (event) {
+            if (dragged !== node) {
+                return;
+            }
+            var box = svg.getBoundingClientRect();
+            node.x = event.clientX - box.left;
+            node.y = event.clientY - box.top;
+            moved = true;
+            reheat(0.3);
+        });
+        group.addEventListener('pointerup', function () {
+            dragged = null;
+            if (!moved) {
+                window.location = '/card/' + node.id;
+            }
+        });
+        svg.appendChild(group);
+        return group;
+    });
+
+    // The layout cools down until the cards stop moving, and warms up while one is dragged
+    var heat = 0;
+    var running = false;
+    function reheat(value) {
+        heat = Math.max(heat, value);
+        if (!running) {
+            running = true;
+            requestAnimationFrame(step);
+        }
+    }
+
+    function step() {
+        var list = graph.nodes;
+        for (var i = 0; i < list.length; i++) {
+            for (var j = i + 1; j < list.length; j++) {
+                var a = list[i], b = list[j];
+                var dx = a.x - b.x, dy = a.y - b.y;
+                var distance2 = Math.max(dx * dx + dy * dy, 1);
+                var force = 2000 / distance2;
+                a.vx += dx * force; a.vy += dy * force;
+                b.vx -= dx * force; b.vy -= dy * force;
+            }
+        }
+        graph.edges.forEach(function (edge) {
+            var a = nodes[edge.source], b = nodes[edge.target];
+            var dx = b.x - a.x, dy = b.y - a.y;
+            var force = 0.01 * edge.weight;
+            a.vx += dx * force; a.vy += dy * force;
+            b.vx -= dx * force; b.vy -= dy * force;
+        });
+        list.forEach(function (node) {
+            // Pull everything to the center, so isolated cards stay in view
+            node.vx += (width / 2 - node.x) * 0.002;
+            node.vy += (height / 2 - node.y) * 0.002;
+            if (node !== dragged) {
+                node.x = Math.min(width - 10, Math.max(10, node.x + node.vx * heat));
+                node.y = Math.min(height - 10, Math.max(10, node.y + node.vy * heat));
+            }
+            node.vx *= 0.5;
+            node.vy *= 0.5;
+        });
+
+        graph.edges.forEach(function (edge, i) {
+            lines[i].setAttribute('x1', nodes[edge.source].x);
+            lines[i].setAttribute('y1', nodes[edge.source].y);
+            lines[i].setAttribute('x2', nodes[edge.target].x);
+            lines[i].setAttribute('y2', nodes[edge.target].y);
+        });
+        list.forEach(function (node, i) {
+            circles[i].setAttribute('transform', 'translate(' + node.x + ',' + node.y + ')');
+        });
+
+        heat *= 0.99;
+        if (heat > 0.01) {
+            requestAnimationFrame(step);
+        } else {
+            running = false;
+        }
+    }
+    reheat(1);
+}
+
+fetch('/api/graph' + window.location.search)
+    .then(function (response) {
+        if (!response.ok) {
+            throw new Error(response.statusText);
+        }
+        return response.json();
+    })
+    .then(draw)
+    .catch(function (error) { graphStatus.textContent = 'Could not load the graph: ' + error.message; });
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pgvector/pgvector-go"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// maxSyncUploadSize is the largest version or image accepted from ume sync
+const maxSyncUploadSize = 64 << 20
+
+// errSyncConflict is returned when a version copied by a sync doesn't fit the card it is copied to
+var errSyncConflict = errors.New("conflict")
+
+// syncRemoteImpl implements the sync remote command functionality. The cards of this
+// instance and the ume serve instance at remoteURL are compared by their UIDs, and the
+// markdown versions, embeddings and images missing on either side are copied.
+// With dryRun only the plan is printed.
+func syncRemoteImpl(remoteURL string, dryRun bool) error {
+	key, err := common.RequireEnvVar("UME_SYNC_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting the API key of the remote: %w", err)
+	}
+	remote := syncRemote{
+		baseURL: strings.TrimRight(remoteURL, "/"),
+		key:     key,
+		client:  &http.Client{Transport: common.HTTPClient().Transport, Timeout: 2 * time.Minute},
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	localCards, localIDs, err := syncCards(ctx, queries, owner)
+	if err != nil {
+		return err
+	}
+
+	var remoteCards []common.SyncCard
+	if err := remote.getJSON("/api/sync/cards", &remoteCards); err != nil {
+		return err
+	}
+	remoteByUID := make(map[string]common.SyncCard, len(remoteCards))
+	for _, card := range remoteCards {
+		remoteByUID[card.UID] = card
+	}
+	localByUID := make(map[string]common.SyncCard, len(localCards))
+	for _, card := range localCards {
+		localByUID[card.UID] = card
+	}
+
+	plan := common.PlanSync(localCards, remoteCards)
+	fmt.Printf("Push %s, pull %s, %d conflicts\n", describeTransfers(plan.Push), describeTransfers(plan.Pull), len(plan.Conflicts))
+	for _, conflict := range plan.Conflicts {
+		fmt.Printf("Conflict in card %s \"%s\": %s\n", conflict.UID, conflict.Title, conflict.Reason)
+	}
+	if dryRun {
+		fmt.Println("Dry run: nothing was copied")
+		return nil
+	}
+
+	for _, transfer := range plan.Push {
+		cardID := localIDs[transfer.UID]
+		for _, ver := range transfer.Versions {
+			version, err := readSyncVersion(ctx, queries, minioClient, cardID, ver)
+			if err != nil {
+				return err
+			}
+			version.Title = transfer.Title
+			if err := remote.putJSON(fmt.Sprintf("/api/sync/cards/%s/versions/%d", transfer.UID, ver), version); err != nil {
+				return fmt.Errorf("error pushing version %d of card %d: %w", ver, cardID, err)
+			}
+		}
+
+		if transfer.Image {
+			card := localByUID[transfer.UID]
+			data, err := minioClient.ReadObjectFromMinio(minioClient.ImageBucket, card.Image)
+			if err != nil {
+				return fmt.Errorf("error downloading image of card %d: %w", cardID, err)
+			}
+			path := fmt.Sprintf("/api/sync/cards/%s/image?filename=%s&method=%s", transfer.UID, url.QueryEscape(card.Image), url.QueryEscape(card.Method))
+			if err := remote.putBytes(path, data); err != nil {
+				return fmt.Errorf("error pushing image of card %d: %w", cardID, err)
+			}
+		}
+		fmt.Printf("Pushed card %d \"%s\"\n", cardID, transfer.Title)
+	}
+
+	for _, transfer := range plan.Pull {
+		cardID, err := syncCardID(ctx, queries, transfer.UID, transfer.Title, owner)
+		if err != nil {
+			return err
+		}
+		ok, err := canWriteCard(queries, owner, cardID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Printf("Skipped card %d \"%s\": it is shared with you read-only\n", cardID, transfer.Title)
+			continue
+		}
+		for _, ver := range transfer.Versions {
+			var version common.SyncVersionContent
+			if err := remote.getJSON(fmt.Sprintf("/api/sync/cards/%s/versions/%d", transfer.UID, ver), &version); err != nil {
+				return fmt.Errorf("error pulling version %d of card %s: %w", ver, transfer.UID, err)
+			}
+			if err := storeSyncVersion(ctx, queries, minioClient, cardID, version); err != nil {
+				return err
+			}
+		}
+
+		if transfer.Image {
+			card := remoteByUID[transfer.UID]
+			data, err := remote.getBytes(fmt.Sprintf("/api/sync/cards/%s/image", transfer.UID))
+			if err != nil {
+				return fmt.Errorf("error pulling image of card %s: %w", transfer.UID, err)
+			}
+			if err := storeSyncImage(ctx, queries, minioClient, cardID, transfer.UID, card.Image, card.Method, data); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Pulled card %d \"%s\"\n", cardID, transfer.Title)
+	}
+
+	if len(plan.Conflicts) > 0 {
+		return fmt.Errorf("%d cards were not synced because of conflicts", len(plan.Conflicts))
+	}
+	fmt.Println("Synced")
+	return nil
+}
+
+// describeTransfers summarizes transfers like "3 versions of 2 cards"
+func describeTransfers(transfers []common.SyncTransfer) string {
+	versions := 0
+	for _, transfer := range transfers {
+		versions += len(transfer.Versions)
+	}
+	return fmt.Sprintf("%d versions of %d cards", versions, len(transfers))
+}
+
+// syncCards lists the cards accessible to the owner with their versions and images, as
+// they are compared by a sync, and the local IDs of the cards by UID
+func syncCards(ctx context.Context, queries *database.Queries, owner pgtype.Int4) ([]common.SyncCard, map[string]int32, error) {
+	rows, err := queries.ListSyncVersions(ctx, owner)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing card versions: %w", err)
+	}
+
+	var cards []common.SyncCard
+	ids := make(map[string]int32)
+	for _, row := range rows {
+		if _, ok := ids[row.Uid]; !ok {
+			ids[row.Uid] = row.CardID
+			card := common.SyncCard{UID: row.Uid, Title: row.Title, Deleted: row.Deleted}
+			if image, err := queries.GetCardImage(ctx, row.CardID); err == nil {
+				card.Image = image.Filename
+				card.Method = image.Method
+			}
+			cards = append(cards, card)
+		}
+
+		card := &cards[len(cards)-1]
+		card.Versions = append(card.Versions, common.SyncVersion{
+			Ver:       row.Ver,
+			Hash:      row.Hash,
+			ParentVer: row.ParentVer.Int32,
+		})
+	}
+	return cards, ids, nil
+}
+
+// readSyncVersion reads a markdown version with its embeddings to copy it to another instance
+func readSyncVersion(ctx context.Context, queries *database.Queries, minioClient *common.MinioClient, cardID, ver int32) (common.SyncVersionContent, error) {
+	file, err := queries.GetMarkdownFile(ctx, database.GetMarkdownFileParams{CardID: cardID, Ver: ver})
+	if err != nil {
+		return common.SyncVersionContent{}, &common.CardError{CardID: cardID, Version: ver, Err: err}
+	}
+
+	content, err := common.ReadMarkdown(ctx, queries, minioClient, cardID, ver)
+	if err != nil {
+		return common.SyncVersionContent{}, err
+	}
+
+	rows, err := queries.ListVersionChunks(ctx, database.ListVersionChunksParams{CardID: cardID, Ver: ver})
+	if err != nil {
+		return common.SyncVersionContent{}, fmt.Errorf("error listing embeddings of card %d: %w", cardID, err)
+	}
+	chunks := make([]common.SyncChunk, len(rows))
+	for i, row := range rows {
+		chunks[i] = common.SyncChunk{
+			Idx:       row.Idx,
+			Model:     row.Model,
+			Text:      row.Text,
+			Embedding: row.Embedding.Slice(),
+			Chunker:   row.Chunker,
+			Start:     row.StartOffset,
+			End:       row.EndOffset,
+			Type:      row.Type,
+			Page:      row.Page,
+		}
+	}
+
+	return common.SyncVersionContent{
+		SyncVersion: common.SyncVersion{Ver: file.Ver, Hash: file.Hash, ParentVer: file.ParentVer.Int32},
+		Content:     content,
+		Chunks:      chunks,
+	}, nil
+}
+
+// syncCardID returns the ID of the card with a UID, creating the card if it is missing
+func syncCardID(ctx context.Context, queries *database.Queries, uid, title string, owner pgtype.Int4) (int32, error) {
+	cardID, err := queries.GetCardByUID(ctx, uid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		cardID, err = queries.CreateCardWithUID(ctx, database.CreateCardWithUIDParams{
+			Uid:     uid,
+			Title:   title,
+			OwnerID: owner,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error creating card %s: %w", uid, err)
+		}
+		return cardID, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error looking up card %s: %w", uid, err)
+	}
+	return cardID, nil
+}
+
+// storeSyncVersion stores a markdown version copied from another instance with its
+// embeddings. A version that is already stored with the same content is left alone.
+func storeSyncVersion(ctx context.Context, queries *database.Queries, minioClient *common.MinioClient, cardID int32, version common.SyncVersionContent) error {
+	if common.CalculateFileHash([]byte(version.Content)) != version.Hash {
+		return fmt.Errorf("the content of version %d of card %d doesn't match its hash", version.Ver, cardID)
+	}
+
+	existing, err := queries.GetMarkdownFile(ctx, database.GetMarkdownFileParams{CardID: cardID, Ver: version.Ver})
+	if err == nil {
+		if existing.Hash == version.Hash {
+			return nil
+		}
+		return fmt.Errorf("%w: version %d of card %d was edited on both sides", errSyncConflict, version.Ver, cardID)
+	}
+
+	var parent pgtype.Int4
+	if version.ParentVer != 0 {
+		_, err := queries.GetMarkdownFile(ctx, database.GetMarkdownFileParams{CardID: cardID, Ver: version.ParentVer})
+		if err != nil {
+			return fmt.Errorf("%w: version %d of card %d was edited from version %d, which is missing", errSyncConflict, version.Ver, cardID, version.ParentVer)
+		}
+		parent = pgtype.Int4{Int32: version.ParentVer, Valid: true}
+	}
+
+	if _, err := minioClient.UploadMarkdown([]byte(version.Content)); err != nil {
+		return fmt.Errorf("error uploading markdown file: %w", err)
+	}
+
+	err = queries.CreateMarkdown(ctx, database.CreateMarkdownParams{
+		CardID:    cardID,
+		Ver:       version.Ver,
+		Hash:      version.Hash,
+		ParentVer: parent,
+		Lang:      common.DetectLanguage(version.Content),
+		Content:   pgtype.Text{String: version.Content, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("error storing markdown hash in database: %w", err)
+	}
+
+	if err := storeCardLinks(queries, cardID, version.Content); err != nil {
+		return err
+	}
+
+	for _, chunk := range version.Chunks {
+		err = queries.CreateEmbeddings(ctx, database.CreateEmbeddingsParams{
+			CardID:      cardID,
+			Ver:         version.Ver,
+			Idx:         chunk.Idx,
+			Model:       chunk.Model,
+			Text:        chunk.Text,
+			Embedding:   pgvector.NewVector(chunk.Embedding),
+			Chunker:     chunk.Chunker,
+			StartOffset: chunk.Start,
+			EndOffset:   chunk.End,
+			Type:        chunk.Type,
+			Page:        chunk.Page,
+		})
+		if err != nil {
+			return fmt.Errorf("error storing embedding %d in database: %w", chunk.Idx, err)
+		}
+	}
+	return nil
+}
+
+// storeSyncImage stores the image or audio of a card copied from another instance. The
+// object is named by syncImageName, so an image that is already stored is left alone.
+func storeSyncImage(ctx context.Context, queries *database.Queries, minioClient *common.MinioClient, cardID int32, uid, filename, method string, data []byte) error {
+	if _, err := common.ParseMethod(method); err != nil {
+		return err
+	}
+
+	name := syncImageName(uid, filename, data)
+	stored, err := queries.CardHasImage(ctx, database.CardHasImageParams{CardID: cardID, Filename: name})
+	if err != nil {
+		return fmt.Errorf("error checking the images of card %d: %w", cardID, err)
+	}
+	if stored {
+		return nil
+	}
+
+	_, err = minioClient.UploadFileToMinio(minioClient.ImageBucket, name, bytes.NewReader(data), int64(len(data)), http.DetectContentType(data))
+	if err != nil {
+		return fmt.Errorf("error uploading image: %w", err)
+	}
+
+	err = queries.CreateImage(ctx, database.CreateImageParams{
+		CardID:   cardID,
+		Filename: name,
+		Method:   method,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing image in database: %w", err)
+	}
+	return nil
+}
+
+// syncImageName names the object of a synced image after the UID of its card and the hash
+// of its content, so images copied to different cards never overwrite each other. The
+// extension comes from the content type, or from the file name for audio.
+func syncImageName(uid, filename string, data []byte) string {
+	ext, ok := imageExtensions[http.DetectContentType(data)]
+	if !ok {
+		ext = strings.ToLower(path.Ext(filename))
+	}
+	return fmt.Sprintf("%s_%s%s", uid, common.CalculateFileHash(data), ext)
+}
+
+// registerSyncHandlers adds the API ume sync talks to. Cards are addressed by their UID
+// and only the cards accessible to the user of the request can be read or written.
+func registerSyncHandlers(mux *http.ServeMux, queries *database.Queries, minioClient *common.MinioClient) {
+	mux.HandleFunc("GET /api/sync/cards", func(w http.ResponseWriter, r *http.Request) {
+		cards, _, err := syncCards(r.Context(), queries, requestOwner(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cards)
+	})
+
+	mux.HandleFunc("GET /api/sync/cards/{uid}/versions/{ver}", func(w http.ResponseWriter, r *http.Request) {
+		cardID, ok := syncRequestCard(w, r, queries, false)
+		if !ok {
+			return
+		}
+		ver, err := strconv.Atoi(r.PathValue("ver"))
+		if err != nil {
+			http.Error(w, "invalid version", http.StatusBadRequest)
+			return
+		}
+
+		version, err := readSyncVersion(r.Context(), queries, minioClient, cardID, int32(ver))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(version)
+	})
+
+	mux.HandleFunc("PUT /api/sync/cards/{uid}/versions/{ver}", func(w http.ResponseWriter, r *http.Request) {
+		var version common.SyncVersionContent
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSyncUploadSize)).Decode(&version); err != nil {
+			http.Error(w, fmt.Sprintf("invalid version: %v", err), http.StatusBadRequest)
+			return
+		}
+		if strconv.Itoa(int(version.Ver)) != r.PathValue("ver") {
+			http.Error(w, "the version doesn't match the path", http.StatusBadRequest)
+			return
+		}
+
+		// Cards pushed for the first time are created for the user of the request
+		cardID, err := queries.GetCardByUID(r.Context(), r.PathValue("uid"))
+		if errors.Is(err, pgx.ErrNoRows) {
+			cardID, err = syncCardID(r.Context(), queries, r.PathValue("uid"), version.Title, requestOwner(r))
+		} else if err == nil {
+			_, ok := syncRequestCard(w, r, queries, true)
+			if !ok {
+				return
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := storeSyncVersion(r.Context(), queries, minioClient, cardID, version); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errSyncConflict) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /api/sync/cards/{uid}/image", func(w http.ResponseWriter, r *http.Request) {
+		cardID, ok := syncRequestCard(w, r, queries, false)
+		if !ok {
+			return
+		}
+		card, err := queries.GetCardImage(r.Context(), cardID)
+		if err != nil {
+			http.Error(w, "card has no image", http.StatusNotFound)
+			return
+		}
+		serveObject(w, r, minioClient, minioClient.ImageBucket, card.Filename)
+	})
+
+	mux.HandleFunc("PUT /api/sync/cards/{uid}/image", syncImagePutHandler(queries, func(ctx context.Context, cardID int32, uid, filename, method string, data []byte) error {
+		return storeSyncImage(ctx, queries, minioClient, cardID, uid, filename, method, data)
+	}))
+}
+
+// syncImagePutHandler stores the image of a card sent in the request with storeImage.
+// Only users who can write to the card can add an image to it.
+func syncImagePutHandler(store syncCardStore, storeImage func(ctx context.Context, cardID int32, uid, filename, method string, data []byte) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cardID, ok := syncRequestCard(w, r, store, true)
+		if !ok {
+			return
+		}
+		filename := r.URL.Query().Get("filename")
+		if filename == "" || strings.ContainsAny(filename, "/\\") {
+			http.Error(w, "invalid filename", http.StatusBadRequest)
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSyncUploadSize))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error reading image: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := storeImage(r.Context(), cardID, r.PathValue("uid"), filename, r.URL.Query().Get("method"), data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// syncCardStore is the part of the database queries needed to find the card of a sync
+// request and check that the user can access it
+type syncCardStore interface {
+	GetCardByUID(ctx context.Context, uid string) (int32, error)
+	CanAccessCard(ctx context.Context, arg database.CanAccessCardParams) (bool, error)
+	CanWriteCard(ctx context.Context, arg database.CanWriteCardParams) (bool, error)
+}
+
+// syncRequestCard returns the ID of the card with the UID of the request path. Cards that
+// don't exist or belong to other users are reported as missing, and with write, cards the
+// user can only read are forbidden.
+func syncRequestCard(w http.ResponseWriter, r *http.Request, store syncCardStore, write bool) (int32, bool) {
+	cardID, err := store.GetCardByUID(r.Context(), r.PathValue("uid"))
+	if err != nil {
+		http.Error(w, "card not found", http.StatusNotFound)
+		return 0, false
+	}
+
+	owner := requestOwner(r)
+	if !owner.Valid {
+		return cardID, true
+	}
+	ok, err := store.CanAccessCard(r.Context(), database.CanAccessCardParams{CardID: cardID, UserID: owner.Int32})
+	if err != nil || !ok {
+		http.Error(w, "card not found", http.StatusNotFound)
+		return 0, false
+	}
+	if write {
+		ok, err := store.CanWriteCard(r.Context(), database.CanWriteCardParams{CardID: cardID, UserID: owner.Int32})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return 0, false
+		}
+		if !ok {
+			http.Error(w, "card is read-only for you", http.StatusForbidden)
+			return 0, false
+		}
+	}
+	return cardID, true
+}
+
+// syncRemote is a client of the sync API of a ume serve instance
+type syncRemote struct {
+	baseURL string
+	key     string
+	client  *http.Client
+}
+
+// do sends a request to the remote and returns the body of a successful response
+func (s syncRemote) do(method, path string, body io.Reader, contentType string) ([]byte, error) {
+	ctx, cancel := common.CallContext()
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.key)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to %s: %w", s.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// getJSON decodes the JSON response of a GET request into v
+func (s syncRemote) getJSON(path string, v any) error {
+	data, err := s.do(http.MethodGet, path, nil, "")
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding response of %s: %w", path, err)
+	}
+	return nil
+}
+
+// putJSON sends v as JSON with a PUT request
+func (s syncRemote) putJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %w", err)
+	}
+	_, err = s.do(http.MethodPut, path, bytes.NewReader(data), "application/json")
+	return err
+}
+
+// getBytes returns the response of a GET request
+func (s syncRemote) getBytes(path string) ([]byte, error) {
+	return s.do(http.MethodGet, path, nil, "")
+}
+
+// putBytes sends data with a PUT request
+func (s syncRemote) putBytes(path string, data []byte) error {
+	_, err := s.do(http.MethodPut, path, bytes.NewReader(data), "application/octet-stream")
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yasushisakai/umesao/database"
+)
+
+// mockSyncCardStore is an in-memory syncCardStore with one card
+type mockSyncCardStore struct {
+	uid      string
+	cardID   int32
+	readers  map[int32]bool
+	writers  map[int32]bool
+	writeErr error
+}
+
+func (s *mockSyncCardStore) GetCardByUID(ctx context.Context, uid string) (int32, error) {
+	if uid != s.uid {
+		return 0, context.Canceled
+	}
+	return s.cardID, nil
+}
+
+func (s *mockSyncCardStore) CanAccessCard(ctx context.Context, arg database.CanAccessCardParams) (bool, error) {
+	return arg.CardID == s.cardID && (s.readers[arg.UserID] || s.writers[arg.UserID]), nil
+}
+
+func (s *mockSyncCardStore) CanWriteCard(ctx context.Context, arg database.CanWriteCardParams) (bool, error) {
+	return arg.CardID == s.cardID && s.writers[arg.UserID], s.writeErr
+}
+
+func TestSyncImagePutHandler(t *testing.T) {
+	store := &mockSyncCardStore{
+		uid:     "card-uid",
+		cardID:  7,
+		readers: map[int32]bool{2: true},
+		writers: map[int32]bool{1: true},
+	}
+
+	tests := []struct {
+		name   string
+		uid    string
+		user   int32
+		status int
+		stored bool
+	}{
+		{name: "owner", uid: "card-uid", user: 1, status: http.StatusNoContent, stored: true},
+		{name: "read-only sharee", uid: "card-uid", user: 2, status: http.StatusForbidden},
+		{name: "other user", uid: "card-uid", user: 3, status: http.StatusNotFound},
+		{name: "missing card", uid: "other", user: 1, status: http.StatusNotFound},
+		{name: "no user", uid: "card-uid", status: http.StatusNoContent, stored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := false
+			mux := http.NewServeMux()
+			mux.HandleFunc("PUT /api/sync/cards/{uid}/image", syncImagePutHandler(store, func(ctx context.Context, cardID int32, uid, filename, method string, data []byte) error {
+				stored = true
+				if cardID != store.cardID || uid != "card-uid" || filename != "card.jpg" || string(data) != "image" {
+					t.Errorf("storeImage(%d, %q, %q, %q) unexpected", cardID, uid, filename, data)
+				}
+				return nil
+			}))
+
+			r := httptest.NewRequest(http.MethodPut, "/api/sync/cards/"+tt.uid+"/image?filename=card.jpg", strings.NewReader("image"))
+			if tt.user != 0 {
+				r = r.WithContext(context.WithValue(r.Context(), userContextKey{}, database.GetUserByAPIKeyHashRow{ID: tt.user}))
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if stored != tt.stored {
+				t.Errorf("stored = %v, want %v", stored, tt.stored)
+			}
+		})
+	}
+}
+
+// TestSyncImageName tests that images pushed to different cards under the same file name
+// don't overwrite each other, and that pushing the same image again gives the same name
+func TestSyncImageName(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	first := syncImageName("card-a", "image.jpg", png)
+	second := syncImageName("card-b", "image.jpg", png)
+	if first == second {
+		t.Errorf("Expected different names for different cards, got %q for both", first)
+	}
+	if again := syncImageName("card-a", "other.jpg", png); again != first {
+		t.Errorf("Expected the same image to get the same name, got %q and %q", first, again)
+	}
+	if other := syncImageName("card-a", "image.jpg", []byte("\x89PNG\r\n\x1a\n1111")); other == first {
+		t.Errorf("Expected a different name for a different image, got %q", other)
+	}
+	if !strings.HasPrefix(first, "card-a_") || !strings.HasSuffix(first, ".png") {
+		t.Errorf("Expected the name to start with the card UID and end with .png, got %q", first)
+	}
+	if audio := syncImageName("card-a", "Voice.M4A", []byte("audio")); !strings.HasSuffix(audio, ".m4a") {
+		t.Errorf("Expected the extension of the file name for audio, got %q", audio)
+	}
+}
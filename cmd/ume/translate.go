@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// translateImpl implements the translate command functionality.
+// If version is -1 the latest version is translated. If embed is set the
+// translated chunks are embedded too, so queries in that language find the card.
+// Replacing or embedding a translation needs the user to be able to change the card.
+func translateImpl(cardID int, version int, lang string, force, embed bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if force || embed {
+		if err := requireCardWrite(queries, cardID); err != nil {
+			return err
+		}
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	// If no version is specified, get the latest version
+	if version == -1 {
+		latestVersion, err := queries.GetLatestMarkdownVersion(context.Background(), int32(cardID))
+		if err != nil {
+			return fmt.Errorf("error getting latest markdown version: %w", err)
+		}
+		version = int(latestVersion)
+	}
+
+	content, err := common.ReadMarkdown(context.Background(), queries, minioClient, int32(cardID), int32(version))
+	if err != nil {
+		return err
+	}
+
+	// Cards already written in the language don't need a translation
+	if inLanguage(queries, cardID, int32(version), lang) {
+		fmt.Fprintf(os.Stderr, "Card %d, version %d is already in %s\n", cardID, version, lang)
+		fmt.Println(content)
+		return nil
+	}
+
+	// Drop the stored translation so it is created again
+	if force {
+		err = queries.DeleteTranslation(context.Background(), database.DeleteTranslationParams{
+			CardID: int32(cardID),
+			Ver:    int32(version),
+			Lang:   normalizeLanguage(lang),
+		})
+		if err != nil {
+			return fmt.Errorf("error deleting stored translation: %w", err)
+		}
+	}
+
+	translated, err := getTranslation(queries, minioClient, cardID, int32(version), lang, content)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(translated)
+
+	if embed {
+		return embedTranslation(queries, cardID, int32(version), normalizeLanguage(lang), translated)
+	}
+
+	return nil
+}
+
+// embedTranslation stores embeddings for the chunks of a translated card version,
+// replacing any that were stored before
+func embedTranslation(queries *database.Queries, cardID int, version int32, lang, translated string) error {
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
+
+	// Chunk the translation the same way as the original
+	methodName, err := queries.GetCardMethod(context.Background(), int32(cardID))
+	if err != nil {
+		return fmt.Errorf("error retrieving card method: %w", err)
+	}
+	chunker, err := common.ChunkerFor(common.Method(methodName))
+	if err != nil {
+		return err
+	}
+
+	chunks, err := common.ExtractChunks(translated, chunker)
+	if err != nil {
+		return err
+	}
+
+	embeddingModel, err := common.CurrentEmbeddingModel()
+	if err != nil {
+		return err
+	}
+	embeddings, err := embeddingModel.Embed(openaiKey, common.ChunkTexts(chunks))
+	if err != nil {
+		return fmt.Errorf("error generating embeddings: %w", err)
+	}
+
+	err = queries.DeleteTranslationEmbeddings(context.Background(), database.DeleteTranslationEmbeddingsParams{
+		CardID: int32(cardID),
+		Ver:    version,
+		Lang:   lang,
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting previous translation embeddings: %w", err)
+	}
+
+	for i, embedding := range embeddings {
+		err = queries.CreateTranslationEmbeddings(context.Background(), database.CreateTranslationEmbeddingsParams{
+			CardID:      int32(cardID),
+			Ver:         version,
+			Idx:         int32(i),
+			Model:       embeddingModel.Name,
+			Text:        chunks[i].Text,
+			Embedding:   common.EmbeddingToPGVector(embedding),
+			Lang:        lang,
+			Chunker:     chunker.Name(),
+			StartOffset: int32(chunks[i].Start),
+			EndOffset:   int32(chunks[i].End),
+			Type:        string(chunks[i].Type),
+			Page:        int32(chunks[i].Page),
+		})
+		if err != nil {
+			return fmt.Errorf("error storing embedding %d in database: %w", i, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Stored %d %s embeddings for card %d, version %d\n", len(embeddings), lang, cardID, version)
+	return nil
+}
+
+// getTranslation returns the stored translation of a card version, or translates
+// the given content and stores the result so it can be reused next time. It is only
+// stored if the user set with UME_API_KEY can change the card.
+func getTranslation(queries *database.Queries, minioClient *common.MinioClient, cardID int, version int32, lang, content string) (string, error) {
+	lang = normalizeLanguage(lang)
+
+	// Cards already written in the language are returned as they are
+	if inLanguage(queries, cardID, version, lang) {
+		return content, nil
+	}
+
+	// Reuse the stored translation if there is one. Offline it can only be read from the
+	// content cache, and nothing is translated.
+	hash, err := queries.GetTranslation(context.Background(), database.GetTranslationParams{
+		CardID: int32(cardID),
+		Ver:    version,
+		Lang:   lang,
+	})
+	if err == nil {
+		translated, err := common.ReadTranslation(minioClient, int32(cardID), version, lang, hash)
+		if err == nil {
+			return translated, nil
+		}
+		if errors.Is(err, common.ErrOffline) {
+			return "", err
+		}
+		fmt.Fprintf(os.Stderr, "Note: stored translation could not be read, translating again: %v\n", err)
+	}
+	if common.Offline {
+		return "", fmt.Errorf("%w: version %d of card %d has no %s translation", common.ErrOffline, version, cardID, lang)
+	}
+
+	openaiClient, err := common.NewOpenAIClient()
+	if err != nil {
+		return "", fmt.Errorf("failed to create OpenAI client: %w", err)
+	}
+
+	translated, err := openaiClient.TranslateText(content, lang)
+	if err != nil {
+		return "", fmt.Errorf("failed to translate text: %w", err)
+	}
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return "", err
+	}
+	writable, err := canWriteCard(queries, owner, int32(cardID))
+	if err != nil {
+		return "", err
+	}
+
+	// Store the translation in Minio and the database
+	if writable {
+		err = minioClient.UploadTranslationForCard(int32(cardID), version, lang, []byte(translated))
+		if err != nil {
+			return "", fmt.Errorf("error uploading translation: %w", err)
+		}
+
+		err = queries.CreateTranslation(context.Background(), database.CreateTranslationParams{
+			CardID: int32(cardID),
+			Ver:    version,
+			Lang:   lang,
+			Hash:   common.CalculateFileHash([]byte(translated)),
+		})
+		if err != nil {
+			return "", fmt.Errorf("error storing translation in database: %w", err)
+		}
+	}
+
+	// Kept in the content cache too, so it can be shown offline
+	if cache, err := common.NewContentCache(); err == nil {
+		cache.PutMarkdown(translated)
+	}
+
+	return translated, nil
+}
+
+// inLanguage reports whether the detected language of a card version is lang
+func inLanguage(queries *database.Queries, cardID int, version int32, lang string) bool {
+	detected, err := queries.GetMarkdownLanguage(context.Background(), database.GetMarkdownLanguageParams{
+		CardID: int32(cardID),
+		Ver:    version,
+	})
+	if err != nil {
+		return false
+	}
+	return common.SameLanguage(detected, lang)
+}
+
+// normalizeLanguage makes language names usable as keys, e.g. " JA " and "ja" are the same
+func normalizeLanguage(lang string) string {
+	return strings.ToLower(strings.TrimSpace(lang))
+}
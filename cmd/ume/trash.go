@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// trashCard moves a card's objects under the trash prefix and marks the card as deleted,
+// if the user set with UME_API_KEY can change the card
+func trashCard(queries *database.Queries, minioClient *common.MinioClient, cardID int32, quiet bool) error {
+	if err := requireCardWrite(queries, int(cardID)); err != nil {
+		return err
+	}
+
+	objects, err := common.ListCardObjects(queries, minioClient.ImageBucket, minioClient.MarkdownBucket, minioClient.OCRBucket, minioClient.AttachmentBucket, cardID)
+	if err != nil {
+		return err
+	}
+
+	if !quiet {
+		for _, object := range objects {
+			if !object.ByHash {
+				fmt.Printf("Moving %s to the trash\n", object.Name)
+			}
+		}
+	}
+
+	warnings, err := common.TrashCardObjects(queries, minioClient, objects, cardID)
+	for _, warning := range warnings {
+		fmt.Println(common.T(msgWarning, warning))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Moved card %d to the trash. Restore it with: ume trash restore %d\n", cardID, cardID)
+	return nil
+}
+
+// trashListImpl lists the cards in the trash
+func trashListImpl() error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	cards, err := queries.ListTrashedCards(context.Background(), owner)
+	if err != nil {
+		return fmt.Errorf("error listing trashed cards: %w", err)
+	}
+
+	if len(cards) == 0 {
+		fmt.Println("The trash is empty.")
+		return nil
+	}
+
+	fmt.Println("Card\tDeleted\t\t\tTitle")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, card := range cards {
+		fmt.Printf("%4d\t%s\t%s\n", card.ID, card.DeletedAt.Time.Local().Format("2006-01-02 15:04:05"), card.Title)
+	}
+
+	return nil
+}
+
+// trashRestoreImpl moves a card out of the trash
+func trashRestoreImpl(cardID int) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	if err := requireCardWrite(queries, cardID); err != nil {
+		return err
+	}
+
+	trashed, err := isTrashed(queries, int32(cardID))
+	if err != nil {
+		return err
+	}
+	if !trashed {
+		return fmt.Errorf("card %d is not in the trash", cardID)
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	objects, err := common.ListCardObjects(queries, minioClient.ImageBucket, minioClient.MarkdownBucket, minioClient.OCRBucket, minioClient.AttachmentBucket, int32(cardID))
+	if err != nil {
+		return err
+	}
+
+	warnings, err := common.RestoreCardObjects(queries, minioClient, objects, int32(cardID))
+	for _, warning := range warnings {
+		fmt.Println(common.T(msgWarning, warning))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored card %d\n", cardID)
+	return nil
+}
+
+// trashEmptyImpl permanently deletes all cards in the trash
+func trashEmptyImpl(quiet bool) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	// Users only empty the trash of the cards they can change
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	cards, err := queries.ListTrashedCards(context.Background(), owner)
+	if err != nil {
+		return fmt.Errorf("error listing trashed cards: %w", err)
+	}
+
+	if len(cards) == 0 {
+		fmt.Println("The trash is empty.")
+		return nil
+	}
+
+	// Ask for confirmation, if quiet is on, assume yes
+	if !quiet {
+		ok, err := confirm(fmt.Sprintf("Are you sure you want to permanently delete %d cards?", len(cards)), "--quiet")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Emptying the trash cancelled.")
+			return nil
+		}
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	for _, card := range cards {
+		objects, err := common.ListCardObjects(queries, minioClient.ImageBucket, minioClient.MarkdownBucket, minioClient.OCRBucket, minioClient.AttachmentBucket, card.ID)
+		if err != nil {
+			return err
+		}
+
+		warnings, err := common.DeleteCardObjects(queries, minioClient, objects, card.ID)
+		if !quiet {
+			for _, warning := range warnings {
+				fmt.Println(common.T(msgWarning, warning))
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting card %d: %w", card.ID, err)
+		}
+
+		if !quiet {
+			fmt.Printf("Deleted card %d\n", card.ID)
+		}
+	}
+
+	fmt.Printf("Emptied the trash, %d cards deleted.\n", len(cards))
+	return nil
+}
+
+// isTrashed reports whether a card is in the trash
+func isTrashed(queries *database.Queries, cardID int32) (bool, error) {
+	deletedAt, err := queries.GetCardDeletedAt(context.Background(), cardID)
+	if err != nil {
+		return false, &common.CardError{CardID: cardID, Err: err}
+	}
+	return deletedAt.Valid, nil
+}
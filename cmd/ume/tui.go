@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// tuiHelp is shown in the status bar when there is nothing else to show
+const tuiHelp = "/ search  j/k select  i image  e edit  d trash  t collection  q quit"
+
+// tuiCard is a card in the result list of the TUI
+type tuiCard struct {
+	ID    int32
+	Title string
+	// Detail is the distance of a search result or the version of a listed card
+	Detail string
+}
+
+// tuiModel is the state of the TUI
+type tuiModel struct {
+	queries     *database.Queries
+	minioClient *common.MinioClient
+	owner       pgtype.Int4
+	protocol    string
+	restore     func()
+
+	query     string
+	cards     []tuiCard
+	selected  int
+	offset    int
+	scroll    int
+	searching bool
+	showImage bool
+
+	// prompt is "delete" or "tag" while asking for a confirmation or a collection name
+	prompt string
+	input  string
+	status string
+
+	previews map[int32]string
+	images   map[int32][]byte
+}
+
+// tuiImpl implements the tui command functionality. The screen has a search bar, the
+// list of results, a preview of the markdown or image of the selected card, and a
+// status bar. Cards can be edited, moved to the trash and added to collections.
+func tuiImpl(query string) error {
+	if !common.CanPrompt() || !common.IsTerminal(os.Stdout) {
+		return fmt.Errorf("%w: ume tui needs a terminal", common.ErrInputRequired)
+	}
+
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	m := &tuiModel{
+		queries:     queries,
+		minioClient: minioClient,
+		owner:       owner,
+		protocol:    common.TerminalImageProtocol(),
+		query:       query,
+		previews:    make(map[int32]string),
+		images:      make(map[int32][]byte),
+	}
+
+	m.restore, err = enterRawMode()
+	if err != nil {
+		return err
+	}
+	defer func() { m.restore() }()
+
+	m.search()
+
+	buf := make([]byte, 64)
+	for {
+		m.draw()
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return fmt.Errorf("error reading input: %w", err)
+		}
+
+		quit, err := m.handleKey(common.ParseKey(buf[:n]))
+		if err != nil {
+			return err
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// handleKey updates the state for a key, and reports whether to quit
+func (m *tuiModel) handleKey(key string) (bool, error) {
+	if key == "ctrl+c" {
+		return true, nil
+	}
+
+	if m.prompt != "" {
+		m.handlePrompt(key)
+		return false, nil
+	}
+
+	if m.searching {
+		switch key {
+		case "enter":
+			m.searching = false
+			m.search()
+		case "esc", "tab":
+			m.searching = false
+		case "backspace":
+			if runes := []rune(m.query); len(runes) > 0 {
+				m.query = string(runes[:len(runes)-1])
+			}
+		case "up", "down", "left", "right", "pgup", "pgdown", "":
+		default:
+			m.query += key
+		}
+		return false, nil
+	}
+
+	m.status = ""
+	switch key {
+	case "q":
+		return true, nil
+	case "/", "tab":
+		m.searching = true
+	case "down", "j":
+		if m.selected < len(m.cards)-1 {
+			m.selected++
+			m.scroll = 0
+		}
+	case "up", "k":
+		if m.selected > 0 {
+			m.selected--
+			m.scroll = 0
+		}
+	case "pgdown", " ":
+		m.scroll += 10
+	case "pgup", "b":
+		m.scroll = max(m.scroll-10, 0)
+	case "i":
+		m.toggleImage()
+	case "e":
+		return false, m.edit()
+	case "d":
+		if card, ok := m.current(); ok {
+			m.prompt = "delete"
+			m.status = fmt.Sprintf("Move card %d \"%s\" to the trash? (y/N)", card.ID, card.Title)
+		}
+	case "t":
+		if _, ok := m.current(); ok {
+			m.prompt = "tag"
+			m.input = ""
+		}
+	}
+	return false, nil
+}
+
+// handlePrompt handles a key while asking for a confirmation or a collection name
+func (m *tuiModel) handlePrompt(key string) {
+	card, _ := m.current()
+
+	switch m.prompt {
+	case "delete":
+		m.prompt = ""
+		m.status = "Canceled"
+		if key == "y" || key == "Y" {
+			m.trash(card)
+		}
+	case "tag":
+		switch key {
+		case "enter":
+			m.prompt = ""
+			if err := collectionAddImpl(m.input, []int{int(card.ID)}); err != nil {
+				m.status = err.Error()
+				return
+			}
+			m.status = fmt.Sprintf("Added card %d to collection \"%s\"", card.ID, m.input)
+		case "esc":
+			m.prompt = ""
+			m.status = "Canceled"
+		case "backspace":
+			if runes := []rune(m.input); len(runes) > 0 {
+				m.input = string(runes[:len(runes)-1])
+			}
+		case "up", "down", "left", "right", "pgup", "pgdown", "tab", "":
+		default:
+			m.input += key
+		}
+	}
+}
+
+// current returns the selected card
+func (m *tuiModel) current() (tuiCard, bool) {
+	if m.selected < 0 || m.selected >= len(m.cards) {
+		return tuiCard{}, false
+	}
+	return m.cards[m.selected], true
+}
+
+// search fills the result list with the cards matching the query, or all cards
+// when the query is empty
+func (m *tuiModel) search() {
+	m.cards = nil
+	m.selected = 0
+	m.offset = 0
+	m.scroll = 0
+
+	if m.query == "" {
+		cards, err := m.queries.ListCards(context.Background(), database.ListCardsParams{OwnerID: m.owner})
+		if err != nil {
+			m.status = fmt.Sprintf("error listing cards: %v", err)
+			return
+		}
+		for _, card := range cards {
+			m.cards = append(m.cards, tuiCard{ID: card.ID, Title: card.Title, Detail: fmt.Sprintf("v%d", card.Ver)})
+		}
+		return
+	}
+
+	results, err := searchCards(m.queries, m.query, 50, searchOptions{Owner: m.owner})
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+	for _, result := range results {
+		m.cards = append(m.cards, tuiCard{ID: result.CardID, Title: result.Title, Detail: fmt.Sprintf("%.3f", result.Distance)})
+	}
+}
+
+// preview returns the latest markdown of a card
+func (m *tuiModel) preview(cardID int32) string {
+	if content, ok := m.previews[cardID]; ok {
+		return content
+	}
+
+	_, content, err := latestMarkdown(m.queries, m.minioClient, cardID)
+	if err != nil {
+		return err.Error()
+	}
+	m.previews[cardID] = content
+	return content
+}
+
+// image returns the image of a card
+func (m *tuiModel) image(cardID int32) ([]byte, error) {
+	if data, ok := m.images[cardID]; ok {
+		return data, nil
+	}
+
+	row, err := m.queries.GetCardImage(context.Background(), cardID)
+	if err != nil {
+		return nil, fmt.Errorf("card %d has no image", cardID)
+	}
+
+	data, err := common.ReadImage(m.minioClient, row.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image: %w", err)
+	}
+	m.images[cardID] = data
+	return data, nil
+}
+
+// toggleImage switches the preview between the markdown and the image of the card.
+// Without terminal graphics the image is opened in the browser instead.
+func (m *tuiModel) toggleImage() {
+	card, ok := m.current()
+	if !ok {
+		return
+	}
+
+	if m.protocol == "" {
+		if err := common.DisplayCardImages(card.ID, *m.queries); err != nil {
+			m.status = err.Error()
+			return
+		}
+		m.status = fmt.Sprintf("Opened the image of card %d in the browser", card.ID)
+		return
+	}
+
+	m.showImage = !m.showImage
+}
+
+// edit opens the selected card in the editor, outside of the TUI
+func (m *tuiModel) edit() error {
+	card, ok := m.current()
+	if !ok {
+		return nil
+	}
+
+	m.restore()
+	if err := editImpl(int(card.ID), -1, false, false, false, false); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Print("Press Enter to return to ume tui...")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+
+	restore, err := enterRawMode()
+	if err != nil {
+		m.restore = func() {}
+		return err
+	}
+	m.restore = restore
+
+	delete(m.previews, card.ID)
+	m.status = fmt.Sprintf("Edited card %d", card.ID)
+	return nil
+}
+
+// trash moves a card to the trash and removes it from the result list
+func (m *tuiModel) trash(card tuiCard) {
+	if err := trashCard(m.queries, m.minioClient, card.ID, true); err != nil {
+		m.status = err.Error()
+		return
+	}
+
+	m.cards = append(m.cards[:m.selected], m.cards[m.selected+1:]...)
+	if m.selected >= len(m.cards) {
+		m.selected = max(len(m.cards)-1, 0)
+	}
+	m.scroll = 0
+	m.status = fmt.Sprintf("Moved card %d to the trash. Restore it with: ume trash restore %d", card.ID, card.ID)
+}
+
+// draw redraws the whole screen
+func (m *tuiModel) draw() {
+	height, width := terminalSize()
+	listWidth := max(width/3, 20)
+	previewWidth := max(width-listWidth-3, 10)
+	paneHeight := max(height-3, 1)
+
+	var b strings.Builder
+	b.WriteString(common.ClearTerminalImages(m.protocol))
+	b.WriteString("\x1b[H\x1b[2J")
+
+	// Search bar
+	search := " Search: " + m.query
+	if m.searching {
+		search += "_"
+		b.WriteString("\x1b[1m")
+	}
+	b.WriteString(common.FitWidth(search, width))
+	b.WriteString("\x1b[0m")
+	fmt.Fprintf(&b, "\x1b[2;1H%s", strings.Repeat("─", width))
+
+	// Keep the selected card visible
+	if m.selected < m.offset {
+		m.offset = m.selected
+	}
+	if m.selected >= m.offset+paneHeight {
+		m.offset = m.selected - paneHeight + 1
+	}
+
+	card, ok := m.current()
+	var previewLines []string
+	if ok && !m.showImage {
+		previewLines = common.WrapLines(m.preview(card.ID), previewWidth)
+	}
+	m.scroll = min(m.scroll, max(len(previewLines)-paneHeight, 0))
+
+	for i := 0; i < paneHeight; i++ {
+		fmt.Fprintf(&b, "\x1b[%d;1H", i+3)
+
+		var item string
+		index := m.offset + i
+		if index < len(m.cards) {
+			item = fmt.Sprintf("%4d %6s %s", m.cards[index].ID, m.cards[index].Detail, m.cards[index].Title)
+		}
+		if index == m.selected && ok {
+			b.WriteString("\x1b[7m")
+		}
+		b.WriteString(common.FitWidth(item, listWidth))
+		b.WriteString("\x1b[0m │ ")
+
+		if m.scroll+i < len(previewLines) {
+			line := previewLines[m.scroll+i]
+			if strings.HasPrefix(line, "#") {
+				line = "\x1b[1m" + line + "\x1b[0m"
+			}
+			b.WriteString(line)
+		}
+	}
+
+	// Image preview, drawn with terminal graphics over the preview pane
+	if ok && m.showImage {
+		data, err := m.image(card.ID)
+		if err == nil {
+			var image string
+			image, err = common.TerminalImage(data, m.protocol, previewWidth, paneHeight)
+			if err == nil {
+				fmt.Fprintf(&b, "\x1b[3;%dH%s", listWidth+4, image)
+			}
+		}
+		if err != nil && m.status == "" {
+			m.status = err.Error()
+		}
+	}
+
+	// Status bar
+	status := m.status
+	switch {
+	case m.prompt == "tag":
+		status = "Add to collection: " + m.input + "_"
+	case status == "" && len(m.cards) == 0:
+		status = "No cards. " + tuiHelp
+	case status == "":
+		status = tuiHelp
+	}
+	fmt.Fprintf(&b, "\x1b[%d;1H\x1b[7m%s\x1b[0m", height, common.FitWidth(" "+status, width-1))
+
+	fmt.Print(b.String())
+}
+
+// enterRawMode switches the terminal to raw mode and the alternate screen, and
+// returns a function that switches back
+func enterRawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("ume tui needs a terminal: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("error switching the terminal to raw mode: %w", err)
+	}
+
+	// Switch to the alternate screen and hide the cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+
+	return func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+// terminalSize returns the number of rows and columns of the terminal
+func terminalSize() (int, int) {
+	out, err := stty("size")
+	if err == nil {
+		fields := strings.Fields(out)
+		if len(fields) == 2 {
+			rows, errRows := strconv.Atoi(fields[0])
+			cols, errCols := strconv.Atoi(fields[1])
+			if errRows == nil && errCols == nil && rows > 0 && cols > 0 {
+				return rows, cols
+			}
+		}
+	}
+	return 24, 80
+}
+
+// stty runs stty on the terminal connected to stdin
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -1,20 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"image"
-	"image/jpeg"
-	_ "image/png" // Import png decoder
 	"io"
-	"net/http"
 	"os"
-	"strings"
+	"path/filepath"
+	"strconv"
 
-	"github.com/nfnt/resize"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pgvector/pgvector-go"
 	"github.com/yasushisakai/umesao/database"
 	"github.com/yasushisakai/umesao/pkg/common"
@@ -22,326 +18,500 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 )
 
-// OpenAIRequest represents a request to the OpenAI API for vision
-type OpenAIRequest struct {
-	Model     string    `json:"model"`
-	Messages  []Message `json:"messages"`
-	MaxTokens int       `json:"max_tokens"`
+// uploadJob are the options an uploaded image is processed with, stored as the params
+// of a job when it is processed by ume worker
+type uploadJob struct {
+	Method      common.Method `json:"method"`
+	Language    string        `json:"language"`
+	Normalize   bool          `json:"normalize"`
+	Handwriting bool          `json:"handwriting"`
+	// Diagram adds a description of what the diagrams of the image show to the markdown
+	Diagram bool `json:"diagram,omitempty"`
+	// Kind is what the image was classified as when the method was auto
+	Kind common.ImageKind `json:"kind,omitempty"`
+	// Spooled is the copy of the image of a card uploaded offline, which ume worker uploads
+	Spooled string `json:"spooled,omitempty"`
+	// Extracted is the hash of the markdown extracted from the image, kept with the
+	// options of the card once it is stored
+	Extracted string `json:"extracted,omitempty"`
 }
 
-// Message represents a message in the OpenAI request
-type Message struct {
-	Role    string    `json:"role"`
-	Content []Content `json:"content"`
+// extraction is the markdown extracted from an image with a method, and the OCR result it
+// was converted from
+type extraction struct {
+	Method    common.Method
+	Content   string
+	OCRResult string
 }
 
-// Content represents content in a message
-type Content struct {
-	Type     string    `json:"type"`
-	Text     string    `json:"text,omitempty"`
-	ImageURL *ImageURL `json:"image_url,omitempty"`
+// uploadImpl implements the upload command functionality and returns the ID of the new card.
+// The stages are shown with a spinner on terminals, with quiet only the card ID is printed.
+// With async the image is stored and a job is queued to process it with ume worker.
+func uploadImpl(filePath string, method common.Method, language string, normalize, handwriting, quiet, async bool) (int32, error) {
+	job := uploadJob{Method: method, Language: language, Normalize: normalize, Handwriting: handwriting}
+	return uploadCard(filePath, job, nil, quiet, async)
 }
 
-// ImageURL represents an image URL in content
-type ImageURL struct {
-	URL    string `json:"url"`
-	Detail string `json:"detail"`
-}
-
-// OpenAIResponse represents a response from the OpenAI API
-type OpenAIResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-}
+// uploadCard creates a card from an image and returns its ID. If extracted is set, its
+// markdown is stored instead of extracting it from the image again.
+func uploadCard(filePath string, job uploadJob, extracted *extraction, quiet, async bool) (cardID int32, err error) {
+	// The stages are traced when OTLP is configured
+	span := common.StartSpan("upload", "ocr.method", job.Method.String())
+	defer func() { span.End(err) }()
 
-// uploadImpl implements the upload command functionality
-// func uploadImpl(filePath string, method string, language string) error {
-func uploadImpl(filePath, method, language string) error {
 	// Check if the file exists and is readable
-	_, err := os.Stat(filePath)
+	_, err = os.Stat(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("error accessing file: %w", err)
+	}
+
+	// The chunker is checked before anything is stored
+	_, err = common.ChunkerFor(job.Method)
 	if err != nil {
-		return fmt.Errorf("error accessing file: %v", err)
+		return 0, err
 	}
 
 	// Initialize database connection
 	dbpool, queries, err := common.InitDB()
 	if err != nil {
-		return fmt.Errorf("error initializing database: %v", err)
+		return 0, fmt.Errorf("error initializing database: %w", err)
 	}
 	defer dbpool.Close()
 
+	// The card belongs to the user set with UME_API_KEY, if any
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return 0, err
+	}
+
+	progress := common.NewProgress(quiet)
+	defer progress.Done()
+
+	// With the auto method the image is classified to pick its method. Offline it is
+	// classified by ume worker instead.
+	if !common.Offline {
+		job, err = classifyUpload(filePath, job, progress)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	// Create a new card
-	cardID, err := queries.CreateCard(context.Background())
+	cardID, err = queries.CreateCard(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("error creating card: %w", err)
+	}
+
+	fmt.Println(common.T(msgCreatedCard, cardID))
+
+	// Offline the image is kept until ume worker uploads and processes it
+	if common.Offline {
+		job.Spooled, err = spoolImage(cardID, filePath)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// The stages that finish are recorded, so an interrupted upload can be resumed
+	options, err := json.Marshal(job)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding upload options: %w", err)
+	}
+	err = queries.StartCardUpload(context.Background(), database.StartCardUploadParams{ID: cardID, UploadOptions: options})
 	if err != nil {
-		return fmt.Errorf("error creating card: %v", err)
+		return 0, fmt.Errorf("error recording upload of card %d: %w", cardID, err)
 	}
 
-	fmt.Printf("Created new card with ID: %d\n", cardID)
+	if owner.Valid {
+		err = queries.SetCardOwner(context.Background(), database.SetCardOwnerParams{ID: cardID, OwnerID: owner})
+		if err != nil {
+			return 0, fmt.Errorf("error setting card owner: %w", err)
+		}
+	}
+
+	if common.Offline {
+		jobID, err := enqueueJob(queries, cardID, jobKindUpload, job)
+		if err != nil {
+			return 0, err
+		}
+		progress.Printf("%s\n", common.T(msgOfflineQueued, jobID, cardID))
+		return cardID, nil
+	}
 
 	// Initialize Minio client from common package
 	minioClient, err := common.NewMinioClient()
 	if err != nil {
-		return fmt.Errorf("error initializing Minio client: %v", err)
+		return 0, fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	if err := storeCardImage(queries, minioClient, cardID, filePath, job, progress); err != nil {
+		return 0, err
+	}
+
+	// The worker reads the image from Minio, so the upload is done here
+	if async {
+		jobID, err := enqueueJob(queries, cardID, jobKindUpload, job)
+		if err != nil {
+			return 0, err
+		}
+		progress.Printf("Queued job %d to process card %d, run ume worker to process it\n", jobID, cardID)
+		return cardID, nil
+	}
+
+	if extracted != nil {
+		if err := saveExtraction(queries, minioClient, cardID, extracted.Content, extracted.OCRResult, progress); err != nil {
+			return 0, err
+		}
+		err = storeUpload(dbpool, queries, minioClient, cardID, extracted.Content, extracted.OCRResult, job, progress)
+	} else {
+		err = processUpload(dbpool, queries, minioClient, cardID, filePath, job, progress)
+	}
+	if err != nil {
+		return 0, err
 	}
+	return cardID, nil
+}
 
+// storeCardImage uploads the image of a new card to Minio, associates it with the card
+// and records that the stage finished
+func storeCardImage(queries *database.Queries, minioClient *common.MinioClient, cardID int32, filePath string, job uploadJob, progress *common.Progress) error {
 	// Upload the image file for the card
+	progress.Stage("Uploading image")
 	imageName, err := minioClient.UploadImageForCard(cardID, filePath)
 	if err != nil {
-		return fmt.Errorf("error uploading image file: %v", err)
+		return fmt.Errorf("error uploading image file: %w", err)
 	}
 
-	fmt.Printf("Successfully uploaded image %s\n", imageName)
+	progress.Printf("Successfully uploaded image %s\n", imageName)
 
 	// Associate the image with the card in the database
 	err = queries.CreateImage(context.Background(), database.CreateImageParams{
 		CardID:   cardID,
 		Filename: imageName,
-		Method:   method,
+		Method:   job.Method.String(),
 	})
 
 	if err != nil {
-		return fmt.Errorf("error associating image with card: %v", err)
+		return fmt.Errorf("error associating image with card: %w", err)
 	}
 
-	fmt.Printf("Successfully associated image %s with card %d in the database\n", imageName, cardID)
+	progress.Printf("Successfully associated image %s with card %d in the database\n", imageName, cardID)
 
-	// Get OpenAI API key
-	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if job.Kind != "" {
+		err = queries.SetImageKind(context.Background(), database.SetImageKindParams{
+			CardID: cardID,
+			Kind:   pgtype.Text{String: string(job.Kind), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error recording the kind of image: %w", err)
+		}
+	}
+
+	return setUploadStage(queries, cardID, stageUploaded)
+}
+
+// spoolImage keeps a copy of the image of a card uploaded offline in the cache directory
+// and returns its path. The image keeps its name, as the OCR services tell the format by
+// the extension.
+func spoolImage(cardID int32, filePath string) (string, error) {
+	dir, err := common.CacheDir()
 	if err != nil {
-		return fmt.Errorf("error getting OpenAI API key: %v", err)
+		return "", err
+	}
+	dir = filepath.Join(dir, "uploads", strconv.Itoa(int(cardID)))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("error creating upload directory: %w", err)
 	}
 
-	// Extract text from the image based on the method
-	var content string
-	switch method {
-	case "ocr":
-		content, err = processWithOCR(filePath, language)
-	case "mistral":
-		content, err = processWithMistral(filePath, openaiKey)
-	default:
-		content, err = processWithVision(filePath, openaiKey)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading image file: %w", err)
+	}
+	spooled := filepath.Join(dir, filepath.Base(filePath))
+	if err := os.WriteFile(spooled, data, 0o600); err != nil {
+		return "", fmt.Errorf("error keeping image for upload: %w", err)
+	}
+	return spooled, nil
+}
+
+// uploadSpooled uploads the image of a card uploaded offline from the copy kept by
+// spoolImage, classifying it first with the auto method, and processes it
+func uploadSpooled(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, cardID int32, job uploadJob, progress *common.Progress) error {
+	if _, err := os.Stat(job.Spooled); err != nil {
+		return fmt.Errorf("the image of card %d was uploaded offline on another machine, run ume worker there: %w", cardID, err)
 	}
 
+	job, err := classifyUpload(job.Spooled, job, progress)
 	if err != nil {
 		return err
 	}
+	if err := storeCardImage(queries, minioClient, cardID, job.Spooled, job, progress); err != nil {
+		return err
+	}
 
-	fmt.Println("Successfully converted result to markdown")
+	// A retry reads the image from Minio once it is uploaded, so the copy is removed
+	defer os.RemoveAll(filepath.Dir(job.Spooled))
+	return processUpload(dbpool, queries, minioClient, cardID, job.Spooled, job, progress)
+}
 
-	// Extract chunks from markdown
-	chunks := common.ExtractChunks(content, method)
-	fmt.Printf("Extracted %d chunks from content\n", len(chunks))
+// classifyUpload picks the method of an upload with the auto method, from what the image
+// is classified as. The method, the handwriting and diagram settings and the kind are set
+// in the job returned. Jobs with another method are returned as they are.
+func classifyUpload(filePath string, job uploadJob, progress *common.Progress) (uploadJob, error) {
+	if job.Method != common.MethodAuto {
+		return job, nil
+	}
 
-	// Generate embeddings for chunks
-	embeddings, err := common.LineEmbeddings(openaiKey, "text-embedding-3-small", 1536, chunks)
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
 	if err != nil {
-		return fmt.Errorf("error generating embeddings: %v", err)
+		return job, fmt.Errorf("error getting OpenAI API key: %w", err)
 	}
 
-	fmt.Printf("Generated %d embeddings\n", len(embeddings))
+	progress.Stage("Classifying image")
+	kind, err := common.ClassifyImage(filePath, openaiKey)
+	if err != nil {
+		return job, fmt.Errorf("error classifying image: %w", err)
+	}
 
-	// Calculate hash of markdown content
-	hashString := common.CalculateFileHash([]byte(content))
+	route := kind.Route(common.ConfiguredImageMethods())
+	job.Method = route.Method
+	job.Handwriting = job.Handwriting || route.Handwriting
+	job.Diagram = job.Diagram || route.Diagram
+	job.Kind = kind
 
-	// Set the markdown version for new cards
-	markdownVersion := 1
+	// The language is only used by the ocr method
+	if route.Method != common.MethodOCR {
+		job.Language = ""
+	}
 
-	// Upload the markdown file using the common function
-	err = minioClient.UploadMarkdownForCard(cardID, int32(markdownVersion), []byte(content))
+	progress.Printf("The image looks like %s, extracting its text with %s\n", kind, route.Method)
+	return job, nil
+}
+
+// processUpload extracts the markdown of the image of a new card and stores it with its
+// title and embeddings as the first version
+func processUpload(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, cardID int32, filePath string, job uploadJob, progress *common.Progress) error {
+	content, ocrResult, err := extractUpload(queries, minioClient, cardID, filePath, job, progress)
 	if err != nil {
-		return fmt.Errorf("error uploading markdown file: %v", err)
+		return err
 	}
+	return storeUpload(dbpool, queries, minioClient, cardID, content, ocrResult, job, progress)
+}
 
-	fmt.Printf("Successfully uploaded markdown file for card %d, version %d\n", cardID, markdownVersion)
-
-	// Store the markdown hash in the database
-	err = queries.CreateMarkdown(context.Background(), database.CreateMarkdownParams{
-		CardID: cardID,
-		Ver:    int32(markdownVersion),
-		Hash:   hashString,
-	})
+// extractUpload extracts the markdown of the image of a new card and keeps it with the
+// OCR result with saveExtraction
+func extractUpload(queries *database.Queries, minioClient *common.MinioClient, cardID int32, filePath string, job uploadJob, progress *common.Progress) (string, string, error) {
+	// Get OpenAI API key
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return "", "", fmt.Errorf("error getting OpenAI API key: %w", err)
+	}
 
+	// Extract text from the image based on the method
+	progress.Stage(fmt.Sprintf("Extracting text with %s", job.Method))
+	content, ocrResult, err := extractJob(filePath, job, openaiKey, progress.Live())
 	if err != nil {
-		return fmt.Errorf("error storing markdown hash in database: %v", err)
+		return "", "", err
 	}
 
-	fmt.Printf("Successfully stored markdown hash in database for card %d, version %d\n", cardID, markdownVersion)
+	progress.Printf("Successfully converted result to markdown\n")
 
-	// Store embeddings in the database
-	for i, embedding := range embeddings {
-		if strings.TrimSpace(chunks[i]) == "" {
-			continue
-		}
+	// Normalize the markdown before it is chunked and hashed
+	if job.Normalize {
+		content = common.NormalizeMarkdown(content)
+	}
 
-		pgvEmbed := pgvector.NewVector(common.ConvertFloat64ToFloat32(embedding))
-		err = queries.CreateEmbeddings(context.Background(), database.CreateEmbeddingsParams{
-			CardID:    cardID,
-			Ver:       int32(markdownVersion),
-			Idx:       int32(i),
-			Model:     "text-embedding-3-small",
-			Text:      chunks[i],
-			Embedding: pgvEmbed,
-		})
+	if err := saveExtraction(queries, minioClient, cardID, content, ocrResult, progress); err != nil {
+		return "", "", err
+	}
+	return content, ocrResult, nil
+}
+
+// extractJob extracts the markdown of an image with the method and settings of an upload
+func extractJob(filePath string, job uploadJob, openaiKey string, live io.Writer) (string, string, error) {
+	if job.Diagram {
+		return common.ExtractDiagramMarkdown(filePath, job.Method, job.Language, openaiKey, job.Handwriting, live)
+	}
+	return common.ExtractMarkdown(filePath, job.Method, job.Language, openaiKey, job.Handwriting, live)
+}
+
+// saveExtraction keeps the markdown extracted from the image of a new card and the OCR
+// result in Minio, so a resumed upload doesn't extract them again
+func saveExtraction(queries *database.Queries, minioClient *common.MinioClient, cardID int32, content, ocrResult string, progress *common.Progress) error {
+	// Upload the markdown file using the common function
+	progress.Stage("Storing markdown")
+	hash, err := minioClient.UploadMarkdown([]byte(content))
+	if err != nil {
+		return fmt.Errorf("error uploading markdown file: %w", err)
+	}
+
+	progress.Printf("Successfully uploaded markdown file for card %d, version 1\n", cardID)
 
+	if ocrResult != "" {
+		err = minioClient.UploadOCRForCard(cardID, 1, []byte(ocrResult))
 		if err != nil {
-			return fmt.Errorf("error storing embedding %d in database: %v", i, err)
+			return fmt.Errorf("error uploading OCR result: %w", err)
 		}
 	}
 
-	fmt.Printf("Successfully stored %d embeddings in database for card %d, version %d\n", len(embeddings), cardID, markdownVersion)
-	fmt.Println("Upload process completed successfully!")
-
+	// The hash is kept to find the markdown when the upload is resumed
+	err = queries.SetCardUploadExtracted(context.Background(), database.SetCardUploadExtractedParams{ID: cardID, Hash: hash})
+	if err != nil {
+		return fmt.Errorf("error recording upload stage of card %d: %w", cardID, err)
+	}
 	return nil
 }
 
-// processWithOCR extracts text from an image using Azure OCR
-func processWithOCR(filePath, language string) (string, error) {
-
-	ocrResult, err := common.AzureOCR(filePath, language)
-
+// storeUpload stores the markdown extracted from the image of a new card as its first
+// version, with its title and embeddings. Everything is stored in one transaction, so a
+// failed upload can be stored again.
+func storeUpload(dbpool *pgxpool.Pool, queries *database.Queries, minioClient *common.MinioClient, cardID int32, content, ocrResult string, job uploadJob, progress *common.Progress) (err error) {
+	chunker, err := common.ChunkerFor(job.Method)
 	if err != nil {
-		return "", fmt.Errorf("error processing image with Azure OCR: %v", err)
+		return err
 	}
 
-	fmt.Println("Successfully fetched OCR result")
-
+	// Get OpenAI API key
 	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
-
 	if err != nil {
-		return "", fmt.Errorf("error getting OpenAI key: %v", err)
+		return fmt.Errorf("error getting OpenAI API key: %w", err)
 	}
 
-	// Convert OCR result to markdown
-	md, err := common.Ocr2md(openaiKey, "o1-mini", ocrResult)
+	// Extract chunks from markdown
+	chunks, err := common.ExtractChunks(content, chunker)
 	if err != nil {
-		return "", fmt.Errorf("error creating markdown from OCR result: %v", err)
+		return err
 	}
+	progress.Printf("Extracted %d chunks from content\n", len(chunks))
 
-	return md, nil
-}
-
-// processWithMistral extracts text from an image using Mistral's OCR API
-func processWithMistral(filePath string, openaiKey string) (string, error) {
-	// Use Mistral OCR to extract text from the image
-	ocrResult, err := common.MistralOCR(filePath)
+	// Generate embeddings for chunks
+	progress.Stage("Generating embeddings")
+	embeddingModel, err := common.CurrentEmbeddingModel()
 	if err != nil {
-		return "", fmt.Errorf("error processing image with Mistral OCR: %v", err)
+		return err
+	}
+	embeddings, err := embeddingModel.Embed(openaiKey, common.ChunkTexts(chunks))
+	if err != nil {
+		return fmt.Errorf("error generating embeddings: %w", err)
 	}
 
-	fmt.Println("Successfully fetched Mistral OCR result")
-
-	// Convert OCR result to markdown using OpenAI
-	md, err := common.Ocr2md(openaiKey, "o1-mini", ocrResult)
+	progress.Printf("Generated %d embeddings\n", len(embeddings))
+
+	// Generate a title for the card, falling back to the first heading or line
+	progress.Stage("Generating title")
+	title := common.MarkdownTitle(content, 60)
+	openaiClient, err := common.NewOpenAIClient()
+	if err == nil {
+		var generated string
+		generated, err = openaiClient.GenerateTitle(content)
+		if err == nil && generated != "" {
+			title = generated
+		}
+	}
 	if err != nil {
-		return "", fmt.Errorf("error creating markdown from Mistral OCR result: %v", err)
+		progress.Printf("Note: could not generate a title, using the first line instead: %v\n", err)
 	}
 
-	return md, nil
-}
+	// Calculate hash of markdown content
+	hashString := common.CalculateFileHash([]byte(content))
 
-// processWithVision extracts text from an image using OpenAI's Vision API
-func processWithVision(filePath string, apiKey string) (string, error) {
-	// Open the image file
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open image file: %v", err)
+	// Set the markdown version for new cards
+	markdownVersion := 1
+
+	// Detect the language of the content, falling back to the language given for OCR
+	lang := common.DetectLanguage(content)
+	if lang == "" && job.Language != common.AutoLanguage {
+		lang = job.Language
 	}
-	defer file.Close()
 
-	// Decode the image
-	img, _, err := image.Decode(file)
+	tx, err := dbpool.Begin(context.Background())
 	if err != nil {
-		return "", fmt.Errorf("failed to decode image: %v", err)
+		return fmt.Errorf("error starting transaction: %w", err)
 	}
+	defer tx.Rollback(context.Background())
+	qtx := queries.WithTx(tx)
 
-	// Resize the image to fit within 1024x512 while maintaining aspect ratio
-	bounds := img.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
-	var newWidth, newHeight uint
+	// Store the markdown hash in the database
+	dbSpan := common.StartSpan("db.create_markdown")
+	err = qtx.CreateMarkdown(context.Background(), database.CreateMarkdownParams{
+		CardID:  cardID,
+		Ver:     int32(markdownVersion),
+		Hash:    hashString,
+		Lang:    lang,
+		Content: pgtype.Text{String: content, Valid: true},
+	})
+	dbSpan.End(err)
 
-	if width > height { // Landscape orientation
-		newWidth = 1024
-		newHeight = uint(float64(height) * (1024.0 / float64(width)))
-	} else { // Portrait or square orientation
-		newHeight = 512
-		newWidth = uint(float64(width) * (512.0 / float64(height)))
+	if err != nil {
+		return fmt.Errorf("error storing markdown hash in database: %w", err)
 	}
 
-	resizedImg := resize.Resize(newWidth, newHeight, img, resize.Lanczos3)
+	progress.Printf("Successfully stored markdown hash in database for card %d, version %d\n", cardID, markdownVersion)
 
-	// Convert image to base64
-	var buf bytes.Buffer
-	err = jpeg.Encode(&buf, resizedImg, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to encode image to JPEG: %v", err)
-	}
-
-	base64Img := base64.StdEncoding.EncodeToString(buf.Bytes())
-
-	// Create the request to OpenAI API
-	reqBody := OpenAIRequest{
-		Model: "gpt-4o-mini",
-		Messages: []Message{
-			{
-				Role: "user",
-				Content: []Content{
-					{
-						Type: "text",
-						Text: "This is a image that is either a diagram, graph, chart or table. Explain what this visualization is and the insights. Output only the results as a complete paragraph, so this could be used as an caption.",
-					},
-					{
-						Type: "image_url",
-						ImageURL: &ImageURL{
-							URL:    fmt.Sprintf("data:image/jpeg;base64,%s", base64Img),
-							Detail: "high",
-						},
-					},
-				},
-			},
-		},
-		MaxTokens: 300,
-	}
-
-	jsonReqBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %v", err)
+	// Keep the raw OCR result so the markdown can be converted again with ume reconvert
+	if ocrResult != "" {
+		needsReview, quality, err := storeOCRResult(qtx, minioClient, cardID, int32(markdownVersion), job.Method, job.Handwriting, ocrResult)
+		if err != nil {
+			return err
+		}
+
+		progress.Printf("Successfully stored OCR result for card %d, version %d\n", cardID, markdownVersion)
+		if needsReview {
+			progress.Printf("Note: the OCR quality of card %d is %.2f, it was added to the review queue\n", cardID, quality)
+		}
 	}
 
-	// Make the API request
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonReqBody))
+	// Store the links to other cards
+	err = storeCardLinks(qtx, cardID, content)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	err = qtx.SetCardTitle(context.Background(), database.SetCardTitleParams{
+		ID:    cardID,
+		Title: title,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
+		return fmt.Errorf("error storing card title: %w", err)
 	}
-	defer resp.Body.Close()
 
-	// Parse the response
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	progress.Printf("Card %d is titled \"%s\"\n", cardID, title)
+
+	// Store embeddings in the database
+	progress.Stage("Storing embeddings")
+	dbSpan = common.StartSpan("db.create_embeddings")
+	defer func() { dbSpan.End(err) }()
+	for i, embedding := range embeddings {
+		pgvEmbed := pgvector.NewVector(common.ConvertFloat64ToFloat32(embedding))
+		err = qtx.CreateEmbeddings(context.Background(), database.CreateEmbeddingsParams{
+			CardID:      cardID,
+			Ver:         int32(markdownVersion),
+			Idx:         int32(i),
+			Model:       embeddingModel.Name,
+			Text:        chunks[i].Text,
+			Embedding:   pgvEmbed,
+			Chunker:     chunker.Name(),
+			StartOffset: int32(chunks[i].Start),
+			EndOffset:   int32(chunks[i].End),
+			Type:        string(chunks[i].Type),
+			Page:        int32(chunks[i].Page),
+		})
+
+		if err != nil {
+			return fmt.Errorf("error storing embedding %d in database: %w", i, err)
+		}
 	}
 
-	var openAIResp OpenAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+	if err = setUploadStage(qtx, cardID, stageStored); err != nil {
+		return err
 	}
 
-	// Get the result
-	if len(openAIResp.Choices) > 0 {
-		fmt.Println("Successfully received response from Vision API")
-		return openAIResp.Choices[0].Message.Content, nil
+	if err = tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("error committing card %d: %w", cardID, err)
 	}
 
-	return "", fmt.Errorf("no content in the Vision API response")
+	progress.Printf("Successfully stored %d embeddings in database for card %d, version %d\n", len(embeddings), cardID, markdownVersion)
+	progress.Printf("Upload process completed successfully!\n")
+
+	return nil
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// userAddImpl creates a user and prints its API key
+func userAddImpl(name string) error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	key, err := common.GenerateAPIKey()
+	if err != nil {
+		return err
+	}
+
+	userID, err := queries.CreateUser(context.Background(), database.CreateUserParams{
+		Name:       name,
+		ApiKeyHash: common.HashAPIKey(key),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating user: %w", err)
+	}
+
+	fmt.Printf("Created user %d \"%s\"\n", userID, name)
+	fmt.Println("\nAPI key (it is only shown once):")
+	fmt.Println(key)
+	fmt.Println("\nUse it from the command line with:")
+	fmt.Printf("export UME_API_KEY=%s\n", key)
+	return nil
+}
+
+// userListImpl lists the users
+func userListImpl() error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	users, err := queries.ListUsers(context.Background())
+	if err != nil {
+		return fmt.Errorf("error listing users: %w", err)
+	}
+
+	if len(users) == 0 {
+		fmt.Println("No users found. Create one with: ume user add <name>")
+		return nil
+	}
+
+	fmt.Println("User\tCards\tCreated\t\tName")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, user := range users {
+		fmt.Printf("%4d\t%5d\t%s\t%s\n", user.ID, user.Cards, user.CreatedAt.Time.Local().Format("2006-01-02"), user.Name)
+	}
+
+	return nil
+}
+
+// userByAPIKey returns the user an API key belongs to
+func userByAPIKey(queries *database.Queries, key string) (database.GetUserByAPIKeyHashRow, error) {
+	user, err := queries.GetUserByAPIKeyHash(context.Background(), common.HashAPIKey(key))
+	if err != nil {
+		return database.GetUserByAPIKeyHashRow{}, fmt.Errorf("invalid API key")
+	}
+	return user, nil
+}
+
+// currentOwner returns the user set with UME_API_KEY, used to own new cards and filter
+// listings. Without UME_API_KEY all cards are accessible.
+func currentOwner(queries *database.Queries) (pgtype.Int4, error) {
+	return apiKeyOwner(queries, os.Getenv("UME_API_KEY"))
+}
+
+// apiKeyOwner returns the user an API key set with UME_API_KEY belongs to, or no user
+// without a key
+func apiKeyOwner(queries *database.Queries, key string) (pgtype.Int4, error) {
+	if key == "" {
+		return pgtype.Int4{}, nil
+	}
+
+	user, err := userByAPIKey(queries, key)
+	if err != nil {
+		return pgtype.Int4{}, fmt.Errorf("UME_API_KEY: %w", err)
+	}
+	return pgtype.Int4{Int32: user.ID, Valid: true}, nil
+}
+
+// requireCardWrite returns an error unless the user set with UME_API_KEY can change the cards
+func requireCardWrite(queries *database.Queries, cardIDs ...int) error {
+	owner, err := currentOwner(queries)
+	if err != nil {
+		return err
+	}
+
+	for _, cardID := range cardIDs {
+		if err := checkCardWrite(queries, owner, int32(cardID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canWriteCard reports whether the user can change a card. Without a user all cards can
+// be changed.
+func canWriteCard(queries *database.Queries, owner pgtype.Int4, cardID int32) (bool, error) {
+	if !owner.Valid {
+		return true, nil
+	}
+
+	ok, err := queries.CanWriteCard(context.Background(), database.CanWriteCardParams{
+		CardID: cardID,
+		UserID: owner.Int32,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error checking access to card %d: %w", cardID, err)
+	}
+	return ok, nil
+}
+
+// checkCardWrite returns an error unless the user can change a card: cards the user
+// can't see are reported as missing, cards only shared with them read-only as read-only.
+func checkCardWrite(queries *database.Queries, owner pgtype.Int4, cardID int32) error {
+	ok, err := canWriteCard(queries, owner, cardID)
+	if err != nil || ok {
+		return err
+	}
+
+	ok, err = queries.CanAccessCard(context.Background(), database.CanAccessCardParams{
+		CardID: cardID,
+		UserID: owner.Int32,
+	})
+	if err != nil {
+		return fmt.Errorf("error checking access to card %d: %w", cardID, err)
+	}
+	if !ok {
+		return &common.CardError{CardID: cardID}
+	}
+	return fmt.Errorf("card %d is shared with you read-only", cardID)
+}
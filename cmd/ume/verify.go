@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// verifyProblem is a discrepancy found by verify, with a suggestion to fix it
+type verifyProblem struct {
+	CardID  int32
+	Problem string
+	Fix     string
+}
+
+// verifyImpl checks that the stored objects match the database. Every markdown object is
+// downloaded and its hash compared with the stored hash, every markdown version must have
+// embeddings and every image must have an object. The copy of the markdown in the database
+// is filled in or replaced from Minio where it is missing or differs, and markdown stored
+// before markdown was stored by its hash is moved to the name of its hash. It returns an
+// error if there are problems.
+func verifyImpl() error {
+	// Initialize database connection
+	dbpool, queries, err := common.InitDB()
+	if err != nil {
+		return fmt.Errorf("error initializing database: %w", err)
+	}
+	defer dbpool.Close()
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return fmt.Errorf("error initializing Minio client: %w", err)
+	}
+
+	progress := common.NewProgress(false)
+	defer progress.Done()
+
+	var problems []verifyProblem
+
+	progress.Stage("Checking markdown")
+	files, err := queries.ListAllMarkdownFiles(context.Background())
+	if err != nil {
+		return fmt.Errorf("error listing markdown files: %w", err)
+	}
+
+	copied, moved := 0, 0
+	for _, file := range files {
+		if file.Embeddings == 0 {
+			problems = append(problems, verifyProblem{
+				CardID:  file.CardID,
+				Problem: fmt.Sprintf("version %d has no embeddings, so it is never found by lookup", file.Ver),
+				Fix:     fmt.Sprintf("save the card again with: ume edit %d, which embeds the new version", file.CardID),
+			})
+		}
+
+		objectName := common.LegacyMarkdownObject(file.CardID, file.Ver)
+		if file.ByHash {
+			objectName = common.MarkdownObject(file.Hash)
+		}
+
+		exists, err := minioClient.ObjectExists(minioClient.MarkdownBucket, objectName)
+		if err != nil {
+			return fmt.Errorf("error checking %s: %w", objectName, err)
+		}
+		if !exists {
+			problems = append(problems, verifyProblem{
+				CardID:  file.CardID,
+				Problem: fmt.Sprintf("markdown %s of version %d is missing", objectName, file.Ver),
+				Fix:     fmt.Sprintf("restore %s to the %s bucket from a backup", objectName, minioClient.MarkdownBucket),
+			})
+		} else {
+			content, err := minioClient.ReadObjectFromMinio(minioClient.MarkdownBucket, objectName)
+			if errors.Is(err, common.ErrChecksumMismatch) {
+				problems = append(problems, verifyProblem{
+					CardID:  file.CardID,
+					Problem: fmt.Sprintf("markdown %s doesn't match the checksum it was stored with, it was corrupted in Minio", objectName),
+					Fix:     fmt.Sprintf("restore %s to the %s bucket from a backup", objectName, minioClient.MarkdownBucket),
+				})
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("error reading %s: %w", objectName, err)
+			}
+
+			hash := common.CalculateFileHash(content)
+			if hash != file.Hash {
+				problems = append(problems, verifyProblem{
+					CardID:  file.CardID,
+					Problem: fmt.Sprintf("markdown %s was changed, its hash is %.12s instead of %.12s", objectName, hash, file.Hash),
+					Fix:     fmt.Sprintf("check the content with: ume show --version %d %d, then restore it from a backup or save it as a new version with: ume edit --version %d %d", file.Ver, file.CardID, file.Ver, file.CardID),
+				})
+			} else if !file.Content.Valid || file.Content.String != string(content) {
+				// Minio holds the canonical copy, so the one in the database follows it
+				err = queries.SetMarkdownContent(context.Background(), database.SetMarkdownContentParams{
+					CardID:  file.CardID,
+					Ver:     file.Ver,
+					Content: pgtype.Text{String: string(content), Valid: true},
+				})
+				if err != nil {
+					return fmt.Errorf("error storing the content of %s in the database: %w", objectName, err)
+				}
+				copied++
+			}
+
+			// The version only points to its hash once the markdown is stored as it, and
+			// the old object is only removed then
+			if !file.ByHash && hash == file.Hash {
+				if err := minioClient.CopyMarkdownToHash(file.CardID, file.Ver, file.Hash); err != nil {
+					return err
+				}
+				err = queries.SetMarkdownByHash(context.Background(), database.SetMarkdownByHashParams{CardID: file.CardID, Ver: file.Ver})
+				if err != nil {
+					return fmt.Errorf("error recording that %s is stored by hash: %w", objectName, err)
+				}
+				if err := minioClient.DeleteFileFromMinio(minioClient.MarkdownBucket, objectName); err != nil {
+					return fmt.Errorf("error removing %s: %w", objectName, err)
+				}
+				moved++
+			}
+		}
+	}
+
+	progress.Stage("Checking images")
+	images, err := queries.ListAllImages(context.Background())
+	if err != nil {
+		return fmt.Errorf("error listing images: %w", err)
+	}
+
+	for _, image := range images {
+		exists, err := minioClient.ObjectExists(minioClient.ImageBucket, image.Filename)
+		if err != nil {
+			return fmt.Errorf("error checking %s: %w", image.Filename, err)
+		}
+		if !exists {
+			problems = append(problems, verifyProblem{
+				CardID:  image.CardID,
+				Problem: fmt.Sprintf("image %s is missing", image.Filename),
+				Fix:     fmt.Sprintf("restore %s to the %s bucket from a backup", image.Filename, minioClient.ImageBucket),
+			})
+		}
+	}
+
+	progress.Stage("Checking uploads")
+	unfinished, err := queries.ListUnfinishedUploads(context.Background())
+	if err != nil {
+		return fmt.Errorf("error listing unfinished uploads: %w", err)
+	}
+
+	for _, card := range unfinished {
+		problems = append(problems, verifyProblem{
+			CardID:  card.ID,
+			Problem: fmt.Sprintf("the upload was interrupted after the %s stage, so it is never found by lookup", card.UploadStage),
+			Fix:     fmt.Sprintf("continue it with: ume resume %d", card.ID),
+		})
+	}
+	progress.Done()
+
+	if copied > 0 {
+		fmt.Printf("Copied the markdown of %d versions from Minio to the database.\n", copied)
+	}
+	if moved > 0 {
+		fmt.Printf("Moved the markdown of %d versions to the names of their hashes.\n", moved)
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("Checked %d markdown versions and %d images, no problems found.\n", len(files), len(images))
+		return nil
+	}
+
+	for _, problem := range problems {
+		fmt.Printf("Card %d: %s\n", problem.CardID, problem.Problem)
+		fmt.Printf("  fix: %s\n", problem.Fix)
+	}
+	return fmt.Errorf("found %d problems in %d markdown versions and %d images", len(problems), len(files), len(images))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+//go:embed static
+var staticFS embed.FS
+
+// webTemplates holds the parsed HTML templates for the web view
+var webTemplates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// cardPage is the data rendered by the card template
+type cardPage struct {
+	CardID int
+	// UID identifies the card across instances
+	UID      string
+	Title    string
+	Version  int
+	Language string
+	Content  template.HTML
+	// HasImage is not set for cards created from text or a voice memo
+	HasImage bool
+	// HasAudio is set for cards created from a voice memo
+	HasAudio bool
+	// HasRegions is set when blocks of Content are marked with the region of the image they came from
+	HasRegions bool
+	// Attachments are the files attached to the card, shown as download links
+	Attachments []cardAttachment
+	// Source is where the material of the card was taken from, cited below Content
+	Source common.CardSource
+}
+
+// cardAttachment is a file attached to a card, downloaded from URL
+type cardAttachment struct {
+	Filename string
+	URL      string
+	Size     int64
+}
+
+// newWebMux creates a mux that already serves the embedded static files
+func newWebMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	static, _ := fs.Sub(staticFS, "static")
+	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.FS(static))))
+	return mux
+}
+
+// renderTemplate executes a template and writes it to the response
+func renderTemplate(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := webTemplates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveObject streams an object from Minio to the response
+func serveObject(w http.ResponseWriter, r *http.Request, minioClient *common.MinioClient, bucketName, objectName string) {
+	obj, info, err := minioClient.OpenObject(bucketName, objectName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer obj.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	http.ServeContent(w, r, objectName, info.LastModified, obj)
+}
+
+// startLocalServer serves the handler on a free local port and returns its
+// base URL together with a function that shuts the server down
+func startLocalServer(handler http.Handler) (string, func() error, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("error starting local server: %w", err)
+	}
+
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+
+	stop := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(ctx)
+	}
+
+	return "http://" + listener.Addr().String(), stop, nil
+}
+
+// serveUntilEnter serves the handler on a local port, opens the given path in
+// the browser and shuts the server down once the user presses Enter
+func serveUntilEnter(handler http.Handler, path string) error {
+	baseURL, stop, err := startLocalServer(handler)
+	if err != nil {
+		return err
+	}
+
+	url := baseURL + path
+	if err := common.OpenBrowser(url); err != nil {
+		fmt.Printf("Could not open browser: %v\n", err)
+	}
+
+	// Without a terminal to press Enter in, the server runs until it is interrupted
+	if !common.CanPrompt() {
+		fmt.Printf("Serving on %s. Press Ctrl+C to stop...\n", url)
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		return stop()
+	}
+
+	fmt.Printf("Serving on %s. Press Enter to stop...\n", url)
+	bufio.NewReader(os.Stdin).ReadString('\n')
+
+	return stop()
+}
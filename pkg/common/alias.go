@@ -0,0 +1,35 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxCardAliasLength is the longest alias a card can be given
+const maxCardAliasLength = 64
+
+// ResolveCardAlias looks up the ID of the card with an alias. Commands set it to a
+// database lookup, so ParseCardIDString accepts aliases wherever it accepts IDs.
+var ResolveCardAlias func(alias string) (int32, error)
+
+// cardAliasRe matches aliases: a letter followed by letters, digits, dots, dashes and
+// underscores, so an alias is never taken for an ID
+var cardAliasRe = regexp.MustCompile(`^\pL[\pL\pN._-]*$`)
+
+// IsCardAlias reports whether s has the form of a card alias
+func IsCardAlias(s string) bool {
+	return cardAliasRe.MatchString(s) && !IsCardUID(s)
+}
+
+// NormalizeCardAlias returns an alias in the form it is stored in, checking that it is valid
+func NormalizeCardAlias(alias string) (string, error) {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	if len(alias) > maxCardAliasLength {
+		return "", fmt.Errorf("alias is longer than %d bytes: %s", maxCardAliasLength, alias)
+	}
+	if !IsCardAlias(alias) {
+		return "", fmt.Errorf("invalid alias: %s. It must start with a letter and only contain letters, digits, '.', '-' and '_'", alias)
+	}
+	return alias, nil
+}
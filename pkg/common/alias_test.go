@@ -0,0 +1,45 @@
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestNormalizeCardAlias tests the NormalizeCardAlias function
+func TestNormalizeCardAlias(t *testing.T) {
+	alias, err := NormalizeCardAlias(" Metabolism-Notes ")
+	if err != nil || alias != "metabolism-notes" {
+		t.Errorf("Expected metabolism-notes, got %q, %v", alias, err)
+	}
+	if alias, err := NormalizeCardAlias("梅棹.カード_1"); err != nil || alias != "梅棹.カード_1" {
+		t.Errorf("Expected letters of any script to be accepted, got %q, %v", alias, err)
+	}
+
+	for _, invalid := range []string{"", "123", "1st", "two words", "a/b", "0190b4c8-7e2a-4f4b-9a51-3c2d8e6f1a2b"} {
+		if _, err := NormalizeCardAlias(invalid); err == nil {
+			t.Errorf("Expected error for alias %q, got nil", invalid)
+		}
+	}
+}
+
+// TestParseCardIDStringAlias tests that aliases are resolved with ResolveCardAlias
+func TestParseCardIDStringAlias(t *testing.T) {
+	ResolveCardAlias = func(s string) (int32, error) {
+		if s != "metabolism-notes" {
+			return 0, errors.New("no such alias")
+		}
+		return 42, nil
+	}
+	defer func() { ResolveCardAlias = nil }()
+
+	cardID, err := ParseCardIDString("Metabolism-Notes")
+	if err != nil || cardID != 42 {
+		t.Errorf("Expected cardID 42 for a known alias, got %d, %v", cardID, err)
+	}
+	if _, err := ParseCardIDString("unknown"); err == nil {
+		t.Error("Expected error for an unknown alias, got nil")
+	}
+	if cardID, err := ParseCardIDString("7"); err != nil || cardID != 7 {
+		t.Errorf("Expected IDs to be parsed as before, got %d, %v", cardID, err)
+	}
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// apiKeyPrefix makes API keys recognizable, e.g. in leaked credential scans
+const apiKeyPrefix = "ume_"
+
+// GenerateAPIKey creates a new random API key
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating API key: %w", err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// HashAPIKey returns the hash under which an API key is stored, so keys are never stored in plain text
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGenerateAPIKey tests the GenerateAPIKey function
+func TestGenerateAPIKey(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !strings.HasPrefix(key, "ume_") || len(key) != len("ume_")+64 {
+		t.Errorf("Expected a ume_ prefixed key with 64 hex characters, got: %s", key)
+	}
+
+	other, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if key == other {
+		t.Error("Expected two generated keys to differ")
+	}
+}
+
+// TestHashAPIKey tests the HashAPIKey function
+func TestHashAPIKey(t *testing.T) {
+	hash := HashAPIKey("ume_test")
+
+	if hash != HashAPIKey("ume_test") {
+		t.Error("Expected the same key to hash the same")
+	}
+	if hash == HashAPIKey("ume_other") {
+		t.Error("Expected different keys to hash differently")
+	}
+	if strings.Contains(hash, "ume_test") {
+		t.Error("Expected the hash not to contain the key")
+	}
+}
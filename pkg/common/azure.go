@@ -6,86 +6,128 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 )
 
-func AzureOCR(filePath, language string) (string, error) {
+// Statuses of an Azure Read operation
+const (
+	AzureStatusNotStarted = "notStarted"
+	AzureStatusRunning    = "running"
+	AzureStatusSucceeded  = "succeeded"
+	AzureStatusFailed     = "failed"
+)
+
+// AzureOCRPollInterval is how often the result of a Read operation is fetched, and
+// AzureOCRTimeout how long to wait for it to finish
+var (
+	AzureOCRPollInterval = 1 * time.Second
+	AzureOCRTimeout      = 2 * time.Minute
+)
+
+// azureFetchAttempts is the number of times a failed fetch of the result is retried
+const azureFetchAttempts = 3
+
+// AzureOCR extracts the text of an image with Azure's Read API and returns it as an
+// OCRResult encoded in JSON. The raw response is kept in it when UME_OCR_KEEP_RAW is set.
+// With handwriting the lines are returned in natural reading order, which suits handwritten
+// notes better than the default left-to-right, top-to-bottom order.
+func AzureOCR(filePath, language string, handwriting bool) (string, error) {
 
 	azureEndpoint, err := RequireEnvVar("AZURE_ENDPOINT")
 
 	if err != nil {
-		return "", fmt.Errorf("Failed to get Azure endpoint: %v", err)
+		return "", fmt.Errorf("Failed to get Azure endpoint: %w", err)
 	}
 
 	azureKey, err := RequireEnvVar("AZURE_KEY")
 
 	if err != nil {
-		return "", fmt.Errorf("Failed to get Azure key: %v", err)
+		return "", fmt.Errorf("Failed to get Azure key: %w", err)
 	}
 
 	// Send OCR request to Azure with the specified language
-	location, err := AzureOCRRequestWithLanguage(azureEndpoint, azureKey, filePath, language)
+	readingOrder := ""
+	if handwriting {
+		readingOrder = "natural"
+	}
+	location, err := AzureOCRRequestWithLanguage(azureEndpoint, azureKey, filePath, language, readingOrder)
 	if err != nil {
-		return "", fmt.Errorf("error sending OCR request: %v", err)
+		return "", fmt.Errorf("error sending OCR request: %w", err)
 	}
 
-	// Fetch OCR result
-	var ocrResult string
-	attempt := 3
+	raw, err := pollAzureOCR(azureKey, location, AzureOCRPollInterval, AzureOCRTimeout)
+	if err != nil {
+		return "", err
+	}
 
-	for {
-		time.Sleep(3 * time.Second)
-		ocrResult, err = AzureOCRFetchResult(azureKey, location)
-		if err != nil && attempt > 0 {
-			fmt.Printf("OCR fetch did not succeed: %s\nRetrying in 3 seconds...\n", err)
-			attempt = attempt - 1
-		} else {
-			break
-		}
+	result, err := ParseAzureOCR([]byte(raw))
+	if err != nil {
+		return "", err
+	}
+	if os.Getenv("UME_OCR_KEEP_RAW") != "" {
+		result.Raw = json.RawMessage(raw)
 	}
 
-	if attempt < 0 {
-		return "", fmt.Errorf("too many failed OCR fetch attempts")
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("error encoding OCR result: %w", err)
 	}
 
-	return ocrResult, nil
+	return string(resultBytes), nil
 
 }
 
-// AzureOCRRequestWithLanguage sends an OCR request to Azure with a specified language
-func AzureOCRRequestWithLanguage(endpoint, key, path, language string) (string, error) {
+// AzureOCRRequestWithLanguage sends an OCR request to Azure with a specified language,
+// or AutoLanguage to let Azure detect it.
+// readingOrder is either "basic" or "natural", if empty Azure's default is used.
+func AzureOCRRequestWithLanguage(endpoint, key, path, language, readingOrder string) (string, error) {
 
 	// Read the image file into memory.
 	fileData, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Failed to read image file: %v", err)
+		return "", fmt.Errorf("failed to read image file: %w", err)
 	}
 
-	// Define the URL with the query parameter.
-	url := fmt.Sprintf("%s/vision/v3.2/read/analyze?language=%s", endpoint, language)
+	// Define the URL with the query parameters. Without a language Azure detects it.
+	params := neturl.Values{}
+	if language != "" && language != AutoLanguage {
+		params.Set("language", language)
+	}
+	if readingOrder != "" {
+		params.Set("readingOrder", readingOrder)
+	}
+	url := fmt.Sprintf("%s/vision/v3.2/read/analyze", endpoint)
+	if len(params) > 0 {
+		url += "?" + params.Encode()
+	}
 	// Create a new POST request with the image data as the body.
 	req, err := http.NewRequest("POST", url, bytes.NewReader(fileData))
 	if err != nil {
-		log.Fatalf("Failed to create HTTP request: %v", err)
+		return "", fmt.Errorf("failed to create OCR request: %w", err)
 	}
 
 	// Set the necessary headers.
 	req.Header.Set("Ocp-Apim-Subscription-Key", key)
 	req.Header.Set("Content-Type", "application/octet-stream")
 
-	// Use the default HTTP client to send the request.
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	ctx, cancel := CallContext()
+	defer cancel()
+	resp, err := HTTPClient().Do(req.WithContext(ctx))
 	if err != nil {
-		log.Fatalf("HTTP request failed: %v", err)
+		return "", &ProviderError{Provider: "Azure", Err: err}
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusAccepted {
+		return "", responseError("Azure", resp)
+	}
+
 	// Retrieve the "Operation-Location" header from the response.
 	operationLocation := resp.Header.Get("Operation-Location")
 
@@ -96,61 +138,113 @@ func AzureOCRRequestWithLanguage(endpoint, key, path, language string) (string,
 	return operationLocation, nil
 }
 
-func AzureOCRFetchResult(key, location string) (string, error) {
+// pollAzureOCR fetches the result of a Read operation until it succeeds or fails, or the
+// timeout passes. Failed fetches, e.g. network errors or throttling, are retried a few times.
+func pollAzureOCR(key, location string, interval, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	attempts := azureFetchAttempts
+	status := AzureStatusNotStarted
+
+	for {
+		if err := Sleep(interval); err != nil {
+			return "", fmt.Errorf("OCR did not finish before the deadline, the last status was %q: %w", status, err)
+		}
+
+		var ocrResult string
+		var err error
+		status, ocrResult, err = AzureOCRFetchResult(key, location)
+		switch {
+		case status == AzureStatusSucceeded:
+			return ocrResult, nil
+		case status == AzureStatusFailed:
+			return "", err
+		case err != nil && attempts == 0:
+			return "", fmt.Errorf("too many failed OCR fetch attempts: %w", err)
+		case err != nil:
+			attempts--
+			ReportRetry("OCR fetch did not succeed: %s, retrying in %v", err, interval)
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("OCR did not finish within %v, the last status was %q", timeout, status)
+		}
+	}
+}
+
+// azureError is the error Azure returns with a failed request or operation
+type azureError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// AzureOCRFetchResult fetches the result of a Read operation and returns its status. The
+// raw response is only returned when the status is succeeded, and an error with Azure's details
+// when it is failed. notStarted and running mean the result should be fetched again later.
+func AzureOCRFetchResult(key, location string) (string, string, error) {
 
 	req, err := http.NewRequest("GET", location, bytes.NewBufferString(""))
 
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	req.Header.Set("Ocp-Apim-Subscription-Key", key)
 
-	resp, err := http.DefaultClient.Do(req)
+	ctx, cancel := CallContext()
+	defer cancel()
+	resp, err := HTTPClient().Do(req.WithContext(ctx))
 	if err != nil {
-		return "", err
+		return "", "", &ProviderError{Provider: "Azure", Err: err}
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", errors.New("API request failed: " + string(bodyBytes))
+		var errorPayload struct {
+			Error azureError `json:"error"`
+		}
+		if json.Unmarshal(bodyBytes, &errorPayload) == nil && errorPayload.Error.Code != "" {
+			return "", "", &ProviderError{Provider: "Azure", StatusCode: resp.StatusCode, Err: fmt.Errorf("%s: %s", errorPayload.Error.Code, errorPayload.Error.Message)}
+		}
+		return "", "", &ProviderError{Provider: "Azure", StatusCode: resp.StatusCode, Err: errors.New(string(bodyBytes))}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading OCR result: %w", err)
 	}
 
 	var ocrResultPayload struct {
 		Status        string `json:"status"`
 		AnalyzeResult struct {
-			ReadResult []struct {
-				Lines []struct {
-					BoundingBox []uint16 `json:"boundingBox"`
-					Text        string   `json:"text"`
-					Appearance  struct {
-						Style struct {
-							Confidence float64 `json:"confidence"`
-						} `json:"style"`
-					} `json:"appearance"`
-				} `json:"lines"`
-			} `json:"readResults"`
+			Errors []azureError `json:"errors"`
 		} `json:"analyzeResult"`
+		Error *azureError `json:"error"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&ocrResultPayload); err != nil {
-		log.Print("decode\n")
-		return "", err
-	}
-
-	if ocrResultPayload.Status != "succeeded" {
-		return "", errors.New("ocr failed")
+	if err := json.Unmarshal(body, &ocrResultPayload); err != nil {
+		return "", "", fmt.Errorf("error decoding OCR result: %w", err)
 	}
 
-	payloadBytes, err := json.Marshal(ocrResultPayload)
-
-	if err != nil {
-		log.Print("marshal\n")
-		return "", err
+	switch ocrResultPayload.Status {
+	case AzureStatusNotStarted, AzureStatusRunning:
+		return ocrResultPayload.Status, "", nil
+	case AzureStatusFailed:
+		var details []string
+		if ocrResultPayload.Error != nil {
+			details = append(details, fmt.Sprintf("%s: %s", ocrResultPayload.Error.Code, ocrResultPayload.Error.Message))
+		}
+		for _, e := range ocrResultPayload.AnalyzeResult.Errors {
+			details = append(details, fmt.Sprintf("%s: %s", e.Code, e.Message))
+		}
+		if len(details) == 0 {
+			return AzureStatusFailed, "", errors.New("OCR failed without details from Azure")
+		}
+		return AzureStatusFailed, "", fmt.Errorf("OCR failed: %s", strings.Join(details, "; "))
+	case AzureStatusSucceeded:
+		return AzureStatusSucceeded, string(body), nil
 	}
-
-	return string(payloadBytes), nil
+	return "", "", fmt.Errorf("unexpected OCR status %q", ocrResultPayload.Status)
 
 }
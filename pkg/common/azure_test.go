@@ -0,0 +1,91 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPollAzureOCR tests that running operations are polled until they succeed
+func TestPollAzureOCR(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Ocp-Apim-Subscription-Key") != "test-key" {
+			t.Errorf("Expected the subscription key header, got %q", r.Header.Get("Ocp-Apim-Subscription-Key"))
+		}
+
+		fetches++
+		switch fetches {
+		case 1:
+			w.Write([]byte(`{"status":"notStarted"}`))
+		case 2:
+			w.Write([]byte(`{"status":"running"}`))
+		default:
+			w.Write([]byte(`{"status":"succeeded","analyzeResult":{"readResults":[{"lines":[{"text":"hello"}]}]}}`))
+		}
+	}))
+	defer server.Close()
+
+	result, err := pollAzureOCR("test-key", server.URL, time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatalf("pollAzureOCR returned an error: %v", err)
+	}
+	if fetches != 3 {
+		t.Errorf("Expected 3 fetches, got %d", fetches)
+	}
+	if !strings.Contains(result, `"text":"hello"`) {
+		t.Errorf("Expected the recognized text in the result, got %s", result)
+	}
+}
+
+// TestPollAzureOCRFailed tests that Azure's error details are returned without retrying
+func TestPollAzureOCRFailed(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write([]byte(`{"status":"failed","analyzeResult":{"errors":[{"code":"InvalidImage","message":"The image is corrupted."}]}}`))
+	}))
+	defer server.Close()
+
+	_, err := pollAzureOCR("test-key", server.URL, time.Millisecond, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "InvalidImage: The image is corrupted.") {
+		t.Errorf("Expected the error details from Azure, got %v", err)
+	}
+	if fetches != 1 {
+		t.Errorf("Expected 1 fetch, got %d", fetches)
+	}
+}
+
+// TestPollAzureOCRTimeout tests that polling stops at the deadline
+func TestPollAzureOCRTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"running"}`))
+	}))
+	defer server.Close()
+
+	_, err := pollAzureOCR("test-key", server.URL, time.Millisecond, 20*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), `"running"`) {
+		t.Errorf("Expected a timeout error with the last status, got %v", err)
+	}
+}
+
+// TestPollAzureOCRRetries tests that failed fetches are retried a few times
+func TestPollAzureOCRRetries(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":"429","message":"Rate limit is exceeded."}}`))
+	}))
+	defer server.Close()
+
+	_, err := pollAzureOCR("test-key", server.URL, time.Millisecond, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "Rate limit is exceeded.") {
+		t.Errorf("Expected the error details from Azure, got %v", err)
+	}
+	if fetches != azureFetchAttempts+1 {
+		t.Errorf("Expected %d fetches, got %d", azureFetchAttempts+1, fetches)
+	}
+}
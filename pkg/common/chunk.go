@@ -1,64 +1,379 @@
 package common
 
 import (
+	"fmt"
+	"os"
 	"regexp"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
 	"github.com/yuin/goldmark/text"
 )
 
-func ExtractChunks(content, method string) []string {
-	var chunks []string
-	// var currentHeader string
+// Chunker splits the content of a card into the pieces that are embedded and searched
+type Chunker interface {
+	// Name is the strategy, recorded with the chunks so they can be reproduced
+	Name() string
+	// Chunk splits content into chunks, without the whole content
+	Chunk(content string) ([]Chunk, error)
+}
+
+// Chunk is a piece of content that is embedded, with the byte range of the content it
+// was taken from so a search match can be shown in place
+type Chunk struct {
+	Text  string
+	Start int
+	End   int
+	// Type is what the chunk is, like a heading or a table row
+	Type ChunkType
+	// Page is the page of a multi-page card the chunk is on, counted from 1, or 0 when the
+	// content has no pages
+	Page int
+}
 
-	chunks = append(chunks, content)
+// ChunkType is what a chunk of content is, so a search match can be previewed and
+// filtered by it
+type ChunkType string
 
-	if method == "ocr" {
+// Chunk types, stored with the chunks. Chunks stored before their type was recorded have
+// an empty type.
+const (
+	ChunkDocument ChunkType = "document"  // the whole content
+	ChunkHeading  ChunkType = "heading"   // a heading
+	ChunkSentence ChunkType = "sentence"  // a sentence of a paragraph
+	ChunkTableRow ChunkType = "table-row" // a row of a table, its cells separated by " | "
+	ChunkCaption  ChunkType = "caption"   // a sentence of the description of a diagram
+	ChunkPassage  ChunkType = "passage"   // a window or a run of merged sentences
+)
 
-		md := goldmark.DefaultParser()
-		reader := text.NewReader([]byte(content))
-		root := md.Parse(reader)
+// ChunkTypes are the types of chunks
+var ChunkTypes = []ChunkType{ChunkDocument, ChunkHeading, ChunkSentence, ChunkTableRow, ChunkCaption, ChunkPassage}
 
-		// Iterate over markdown AST nodes
-		ast.Walk(root, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
-			if heading, ok := node.(*ast.Heading); ok && entering {
-				// Extract heading text
-				var headerText string
-				for child := heading.FirstChild(); child != nil; child = child.NextSibling() {
-					if textNode, ok := child.(*ast.Text); ok {
-						headerText += string(textNode.Value([]byte(content)))
-					}
-				}
-				// Store header as chunk
-				chunks = append(chunks, headerText)
-				// currentHeader = headerText
-			} else if paragraph, ok := node.(*ast.Paragraph); ok && entering {
-				// Extract paragraph text
-				var paragraphText string
-				for child := paragraph.FirstChild(); child != nil; child = child.NextSibling() {
-					if textNode, ok := child.(*ast.Text); ok {
-						paragraphText += string(textNode.Value([]byte(content)))
-					}
+// ParseChunkType returns the chunk type with a name
+func ParseChunkType(name string) (ChunkType, error) {
+	if chunkType := ChunkType(name); slices.Contains(ChunkTypes, chunkType) {
+		return chunkType, nil
+	}
+	names := make([]string, len(ChunkTypes))
+	for i, chunkType := range ChunkTypes {
+		names[i] = string(chunkType)
+	}
+	return "", fmt.Errorf("invalid chunk type: %s. Must be one of %s", name, strings.Join(names, ", "))
+}
+
+// Chunking strategies, set with UME_CHUNKER
+const (
+	ChunkerMarkdown = "markdown-ast" // headings and the sentences of paragraphs
+	ChunkerSentence = "sentences"    // every sentence
+	ChunkerWindow   = "fixed-window" // windows of a fixed number of characters
+	ChunkerSemantic = "semantic"     // sentences merged while their embeddings are similar
+)
+
+// Chunkers are the chunking strategies
+var Chunkers = []string{ChunkerMarkdown, ChunkerSentence, ChunkerWindow, ChunkerSemantic}
+
+// DefaultChunkWindow and DefaultChunkOverlap are the characters in a chunk of the
+// fixed-window strategy, and the characters it shares with the previous chunk
+const (
+	DefaultChunkWindow  = 400
+	DefaultChunkOverlap = 80
+)
+
+// ParseChunker returns the chunker of a strategy
+func ParseChunker(name string) (Chunker, error) {
+	switch name {
+	case ChunkerMarkdown:
+		return MarkdownChunker{}, nil
+	case ChunkerSentence:
+		return SentenceChunker{}, nil
+	case ChunkerWindow:
+		return WindowChunker{Size: DefaultChunkWindow, Overlap: DefaultChunkOverlap}, nil
+	case ChunkerSemantic:
+		threshold, err := semanticThreshold()
+		if err != nil {
+			return nil, err
+		}
+		return SemanticChunker{Embed: embedSentences, Threshold: threshold, MaxRunes: DefaultChunkWindow}, nil
+	default:
+		return nil, fmt.Errorf("invalid chunker: %s. Must be one of %s", name, strings.Join(Chunkers, ", "))
+	}
+}
+
+// ChunkerFor returns the chunker set with UME_CHUNKER. Without it, markdown is split by
+// its structure and vision captions, which have none, into sentences.
+func ChunkerFor(method Method) (Chunker, error) {
+	if name := os.Getenv("UME_CHUNKER"); name != "" {
+		return ParseChunker(name)
+	}
+	if method == MethodVision {
+		return SentenceChunker{}, nil
+	}
+	return MarkdownChunker{}, nil
+}
+
+// ChunkLabel describes what and where a chunk is, like "table-row, p. 2", or "" when
+// neither is known
+func ChunkLabel(chunkType ChunkType, page int) string {
+	var parts []string
+	if chunkType != "" {
+		parts = append(parts, string(chunkType))
+	}
+	if page > 0 {
+		parts = append(parts, fmt.Sprintf("p. %d", page))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ExtractChunks splits content with a chunker. The first chunk is the whole content.
+// Blank chunks are dropped, so the index of a chunk is also the index of its embedding
+// and the idx it is stored with. The chunks in the description of a diagram are
+// captions, and the chunks of content with page markers are given their page.
+func ExtractChunks(content string, chunker Chunker) ([]Chunk, error) {
+	chunks, err := chunker.Chunk(content)
+	if err != nil {
+		return nil, fmt.Errorf("error chunking content with %s: %w", chunker.Name(), err)
+	}
+
+	if start, end, ok := diagramDescriptionRange(content); ok {
+		for i := range chunks {
+			if chunks[i].Start >= start && chunks[i].End <= end {
+				chunks[i].Type = ChunkCaption
+			}
+		}
+	}
+
+	whole := Chunk{Text: content, Start: 0, End: len(content), Type: ChunkDocument}
+	chunks = append([]Chunk{whole}, chunks...)
+	if starts := pageStarts(content); len(starts) > 0 {
+		for i := range chunks {
+			chunks[i].Page = pageAt(starts, chunks[i].Start)
+		}
+	}
+	return dropBlankChunks(chunks), nil
+}
+
+// pageMarkerRe matches the comment marking where a page starts in the markdown of a
+// multi-page card, as joined by MistralOCRResponse.Markdown
+var pageMarkerRe = regexp.MustCompile(`<!-- page (\d+) -->`)
+
+// pageStarts returns the byte offsets where each page after the first starts in content,
+// in order, or nil if it has no page markers
+func pageStarts(content string) []int {
+	var starts []int
+	for _, m := range pageMarkerRe.FindAllStringIndex(content, -1) {
+		starts = append(starts, m[0])
+	}
+	return starts
+}
+
+// pageAt returns the page the byte at offset is on, counted from 1
+func pageAt(starts []int, offset int) int {
+	page := 1
+	for _, start := range starts {
+		if offset < start {
+			break
+		}
+		page++
+	}
+	return page
+}
+
+// ChunkTexts returns the texts of chunks, in the same order
+func ChunkTexts(chunks []Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
+
+// dropBlankChunks removes the chunks that are empty or only whitespace, which can't be embedded
+func dropBlankChunks(chunks []Chunk) []Chunk {
+	kept := chunks[:0]
+	for _, chunk := range chunks {
+		if strings.TrimSpace(chunk.Text) != "" {
+			kept = append(kept, chunk)
+		}
+	}
+	return kept
+}
+
+// MarkdownChunker splits markdown into its headings and the sentences of its paragraphs
+type MarkdownChunker struct{}
+
+// Name returns the strategy of the chunker
+func (MarkdownChunker) Name() string {
+	return ChunkerMarkdown
+}
+
+// Chunk splits markdown into its headings and the sentences of its paragraphs
+func (MarkdownChunker) Chunk(content string) ([]Chunk, error) {
+	var chunks []Chunk
+
+	reader := text.NewReader([]byte(content))
+	root := chunkParser.Parse(reader)
+
+	// Iterate over markdown AST nodes
+	ast.Walk(root, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := node.(*ast.Heading); ok && entering {
+			// Extract heading text
+			var headerText string
+			for child := heading.FirstChild(); child != nil; child = child.NextSibling() {
+				if textNode, ok := child.(*ast.Text); ok {
+					headerText += string(textNode.Value([]byte(content)))
 				}
-				// Split paragraph into sentences
-				sentences := splitSentences(paragraphText)
-				for _, sentence := range sentences {
-					chunks = append(chunks, sentence)
+			}
+			// Store header as chunk
+			start, end := blockRange(heading)
+			chunks = append(chunks, Chunk{Text: headerText, Start: start, End: end, Type: ChunkHeading})
+		} else if (node.Kind() == extast.KindTableHeader || node.Kind() == extast.KindTableRow) && entering {
+			// Store each row of a table with its cells, so a row can be matched on its own
+			chunks = append(chunks, tableRowChunk(node, content))
+			return ast.WalkSkipChildren, nil
+		} else if paragraph, ok := node.(*ast.Paragraph); ok && entering {
+			// Extract paragraph text
+			var paragraphText string
+			for child := paragraph.FirstChild(); child != nil; child = child.NextSibling() {
+				if textNode, ok := child.(*ast.Text); ok {
+					paragraphText += string(textNode.Value([]byte(content)))
 				}
 			}
-			return ast.WalkContinue, nil
-		})
+			// Split paragraph into sentences
+			start, end := blockRange(paragraph)
+			chunks = append(chunks, locateSentences(content, splitSentences(paragraphText), start, end)...)
+		}
+		return ast.WalkContinue, nil
+	})
 
-	} else if method == "vision" {
-		// just split by new lines and sentences
-		chunks = splitSentences(content)
+	return chunks, nil
+}
+
+// chunkParser parses markdown for the markdown chunker, with tables so their rows are
+// chunked instead of being split into sentences
+var chunkParser = goldmark.New(goldmark.WithExtensions(extension.Table)).Parser()
+
+// tableRowChunk returns the chunk of a row of a table, with the text of its cells
+// separated by " | " and the range from its first cell to its last
+func tableRowChunk(row ast.Node, content string) Chunk {
+	var cells []string
+	start, end := -1, 0
+	for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+		var cellText string
+		for child := cell.FirstChild(); child != nil; child = child.NextSibling() {
+			if textNode, ok := child.(*ast.Text); ok {
+				cellText += string(textNode.Value([]byte(content)))
+			}
+		}
+		cells = append(cells, strings.TrimSpace(cellText))
+		if cellStart, cellEnd := blockRange(cell); cellEnd > 0 {
+			if start == -1 {
+				start = cellStart
+			}
+			end = cellEnd
+		}
 	}
+	return Chunk{Text: strings.Join(cells, " | "), Start: max(start, 0), End: end, Type: ChunkTableRow}
+}
+
+// blockRange returns the byte range of the lines of a block node
+func blockRange(node ast.Node) (int, int) {
+	lines := node.Lines()
+	if lines.Len() == 0 {
+		return 0, 0
+	}
+	return lines.At(0).Start, lines.At(lines.Len() - 1).Stop
+}
 
+// locateSentences finds sentences in order in the range start to end of content. A sentence
+// that isn't found as it is, like one spanning a line break, gets the whole range.
+func locateSentences(content string, sentences []string, start, end int) []Chunk {
+	chunks := make([]Chunk, len(sentences))
+	cursor := start
+	for i, sentence := range sentences {
+		chunks[i] = Chunk{Text: sentence, Start: start, End: end, Type: ChunkSentence}
+		if at := strings.Index(content[cursor:end], sentence); at >= 0 {
+			chunks[i].Start = cursor + at
+			chunks[i].End = cursor + at + len(sentence)
+			cursor = chunks[i].End
+		}
+	}
 	return chunks
 }
 
+// SentenceChunker splits content into sentences, ignoring its structure
+type SentenceChunker struct{}
+
+// Name returns the strategy of the chunker
+func (SentenceChunker) Name() string {
+	return ChunkerSentence
+}
+
+// Chunk splits content into sentences
+func (SentenceChunker) Chunk(content string) ([]Chunk, error) {
+	return locateSentences(content, splitSentences(content), 0, len(content)), nil
+}
+
+// WindowChunker splits content into windows of Size characters, each sharing Overlap
+// characters with the previous one so sentences cut at the edge are still found
+type WindowChunker struct {
+	Size    int
+	Overlap int
+}
+
+// Name returns the strategy of the chunker
+func (WindowChunker) Name() string {
+	return ChunkerWindow
+}
+
+// Chunk splits content into overlapping windows. Whitespace is collapsed first so the
+// windows hold text rather than indentation.
+func (c WindowChunker) Chunk(content string) ([]Chunk, error) {
+	if c.Size <= 0 {
+		return nil, fmt.Errorf("window size must be positive, got %d", c.Size)
+	}
+
+	// Every kept character remembers where it starts and ends in the content
+	var runes []rune
+	var starts, ends []int
+	space := false
+	for i, r := range content {
+		if unicode.IsSpace(r) {
+			space = len(runes) > 0
+			continue
+		}
+		if space {
+			runes = append(runes, ' ')
+			starts = append(starts, i)
+			ends = append(ends, i)
+			space = false
+		}
+		runes = append(runes, r)
+		starts = append(starts, i)
+		ends = append(ends, i+utf8.RuneLen(r))
+	}
+
+	step := c.Size - c.Overlap
+	if step <= 0 {
+		step = c.Size
+	}
+
+	var chunks []Chunk
+	for start := 0; start < len(runes); start += step {
+		end := min(start+c.Size, len(runes))
+		chunks = append(chunks, Chunk{Text: string(runes[start:end]), Start: starts[start], End: ends[end-1], Type: ChunkPassage})
+		if end == len(runes) {
+			break
+		}
+	}
+	return chunks, nil
+}
+
 func splitSentences(text string) []string {
 	re := regexp.MustCompile(`[。！？!?.]`)
 	sentences := re.Split(text, -1)
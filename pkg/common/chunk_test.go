@@ -0,0 +1,233 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestChunkerFor tests that the chunker is chosen by UME_CHUNKER, or by the method without it
+func TestChunkerFor(t *testing.T) {
+	originalChunker := os.Getenv("UME_CHUNKER")
+	defer os.Setenv("UME_CHUNKER", originalChunker)
+
+	os.Setenv("UME_CHUNKER", "")
+	if chunker, err := ChunkerFor(MethodOCR); err != nil || chunker.Name() != ChunkerMarkdown {
+		t.Errorf("Expected the markdown chunker for ocr, got %v, %v", chunker, err)
+	}
+	if chunker, err := ChunkerFor(MethodVision); err != nil || chunker.Name() != ChunkerSentence {
+		t.Errorf("Expected the sentence chunker for vision, got %v, %v", chunker, err)
+	}
+
+	os.Setenv("UME_CHUNKER", ChunkerWindow)
+	if chunker, err := ChunkerFor(MethodOCR); err != nil || chunker.Name() != ChunkerWindow {
+		t.Errorf("Expected UME_CHUNKER to take precedence, got %v, %v", chunker, err)
+	}
+
+	os.Setenv("UME_CHUNKER", "paragraphs")
+	if _, err := ChunkerFor(MethodOCR); err == nil {
+		t.Errorf("Expected an error for an unknown chunker")
+	}
+}
+
+// TestWindowChunker tests the WindowChunker
+func TestWindowChunker(t *testing.T) {
+	chunker := WindowChunker{Size: 10, Overlap: 4}
+
+	chunks, _ := chunker.Chunk("abcdefghij\n\n  klmnop")
+	expected := []string{"abcdefghij", "ghij klmno", "lmnop"}
+	if strings.Join(ChunkTexts(chunks), "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, chunks)
+	}
+
+	// Windows count characters, not bytes
+	chunks, _ = chunker.Chunk("梅棹忠夫の知的生産の技術")
+	if len(chunks) != 2 || chunks[0].Text != "梅棹忠夫の知的生産の" {
+		t.Errorf("Expected windows of 10 characters, got %q", chunks)
+	}
+
+	if chunks, _ := chunker.Chunk("   "); len(chunks) != 0 {
+		t.Errorf("Expected no chunks for blank content, got %q", chunks)
+	}
+}
+
+// TestSemanticChunker tests that neighbouring sentences are merged while their embeddings are similar
+func TestSemanticChunker(t *testing.T) {
+	// Sentences about cats point one way and sentences about taxes another
+	vectors := map[string][]float64{
+		"Cats sleep a lot":         {1, 0.1},
+		"Cats like boxes":          {1, 0.2},
+		"Taxes are due in April":   {0.1, 1},
+		"Receipts should be kept":  {0.2, 1},
+		"Cats ignore their owners": {1, 0},
+	}
+	var embedded []string
+	chunker := SemanticChunker{
+		Embed: func(sentences []string) ([][]float64, error) {
+			embedded = sentences
+			embeddings := make([][]float64, len(sentences))
+			for i, sentence := range sentences {
+				embeddings[i] = vectors[sentence]
+			}
+			return embeddings, nil
+		},
+		Threshold: 0.8,
+	}
+
+	content := "Cats sleep a lot. Cats like boxes.\n\nTaxes are due in April. Receipts should be kept.\n\nCats ignore their owners."
+	chunks, err := chunker.Chunk(content)
+	if err != nil {
+		t.Fatalf("Chunk returned an error: %v", err)
+	}
+	expected := []string{"Cats sleep a lot Cats like boxes", "Taxes are due in April Receipts should be kept", "Cats ignore their owners"}
+	if strings.Join(ChunkTexts(chunks), "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, chunks)
+	}
+	if len(embedded) != 5 {
+		t.Errorf("Expected the 5 sentences to be embedded at once, got %q", embedded)
+	}
+
+	// Similar sentences are still split once a chunk is full
+	chunker.MaxRunes = 20
+	chunks, _ = chunker.Chunk(content)
+	if len(chunks) != 5 {
+		t.Errorf("Expected every sentence in its own chunk, got %q", chunks)
+	}
+
+	chunker.Embed = func(sentences []string) ([][]float64, error) {
+		return nil, fmt.Errorf("rate limited")
+	}
+	if _, err := ExtractChunks(content, chunker); err == nil {
+		t.Errorf("Expected the embedding error to be returned")
+	}
+}
+
+// blankChunker returns fixed chunks, for testing what ExtractChunks does with them
+type blankChunker []string
+
+func (blankChunker) Name() string { return "test" }
+
+func (c blankChunker) Chunk(content string) ([]Chunk, error) {
+	chunks := make([]Chunk, len(c))
+	for i, text := range c {
+		chunks[i] = Chunk{Text: text}
+	}
+	return chunks, nil
+}
+
+// TestExtractChunksDropsBlank tests that blank chunks are dropped so chunks, embeddings and idx line up
+func TestExtractChunksDropsBlank(t *testing.T) {
+	chunks, err := ExtractChunks("content", blankChunker{"first", "", "  \n", "second"})
+	if err != nil {
+		t.Fatalf("ExtractChunks returned an error: %v", err)
+	}
+	expected := []string{"content", "first", "second"}
+	if strings.Join(ChunkTexts(chunks), "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, chunks)
+	}
+
+	// An empty heading doesn't leave a blank chunk
+	chunks, _ = ExtractChunks("#\n\nA sentence.", MarkdownChunker{})
+	if len(chunks) != 2 || chunks[1].Text != "A sentence" {
+		t.Errorf("Expected the content and the sentence, got %q", chunks)
+	}
+
+	if chunks, _ := ExtractChunks(" \n", MarkdownChunker{}); len(chunks) != 0 {
+		t.Errorf("Expected no chunks for blank content, got %q", chunks)
+	}
+}
+
+// TestChunkRanges tests that chunks point back to the bytes of the content they were taken from
+func TestChunkRanges(t *testing.T) {
+	content := "# Title\n\nFirst sentence. Second sentence.\n\n- 梅棹 item\n"
+	chunks, err := ExtractChunks(content, MarkdownChunker{})
+	if err != nil {
+		t.Fatalf("ExtractChunks returned an error: %v", err)
+	}
+	if chunks[0].Start != 0 || chunks[0].End != len(content) {
+		t.Errorf("Expected the whole content to span it all, got %d-%d", chunks[0].Start, chunks[0].End)
+	}
+	for _, chunk := range chunks[1:] {
+		if source := content[chunk.Start:chunk.End]; source != chunk.Text {
+			t.Errorf("Expected chunk %q to be found at %d-%d, got %q", chunk.Text, chunk.Start, chunk.End, source)
+		}
+	}
+
+	// Windows over collapsed whitespace still point at the original bytes
+	chunks, _ = WindowChunker{Size: 6, Overlap: 0}.Chunk("梅棹\n\n  忠夫 の知的")
+	if len(chunks) != 2 || chunks[0].Start != 0 || chunks[1].End != len("梅棹\n\n  忠夫 の知的") {
+		t.Errorf("Expected windows to span the content, got %+v", chunks)
+	}
+	if content := "梅棹\n\n  忠夫 の知的"; content[chunks[0].Start:chunks[0].End] != "梅棹\n\n  忠夫 " {
+		t.Errorf("Expected the first window to end after its last character, got %q", content[chunks[0].Start:chunks[0].End])
+	}
+}
+
+// TestChunkTypes tests that the markdown chunker tells headings, sentences, table rows and captions apart
+func TestChunkTypes(t *testing.T) {
+	content := "# Prices\n\nFruit is cheap.\n\n| Fruit | Price |\n| --- | --- |\n| Apple | 100 |\n\n" +
+		DiagramDescriptionHeading + "\n\nA bar chart of prices.\n"
+	chunks, err := ExtractChunks(content, MarkdownChunker{})
+	if err != nil {
+		t.Fatalf("ExtractChunks returned an error: %v", err)
+	}
+
+	expected := []Chunk{
+		{Text: content, Type: ChunkDocument},
+		{Text: "Prices", Type: ChunkHeading},
+		{Text: "Fruit is cheap", Type: ChunkSentence},
+		{Text: "Fruit | Price", Type: ChunkTableRow},
+		{Text: "Apple | 100", Type: ChunkTableRow},
+		{Text: "Diagram description", Type: ChunkHeading},
+		{Text: "A bar chart of prices", Type: ChunkCaption},
+	}
+	if len(chunks) != len(expected) {
+		t.Fatalf("Expected %d chunks, got %+v", len(expected), chunks)
+	}
+	for i, chunk := range chunks {
+		if chunk.Text != expected[i].Text || chunk.Type != expected[i].Type {
+			t.Errorf("Expected chunk %d to be %s %q, got %s %q", i, expected[i].Type, expected[i].Text, chunk.Type, chunk.Text)
+		}
+	}
+
+	// A table row points at the bytes from its first cell to its last
+	if source := content[chunks[4].Start:chunks[4].End]; source != "Apple | 100" {
+		t.Errorf("Expected the row to be found at %d-%d, got %q", chunks[4].Start, chunks[4].End, source)
+	}
+}
+
+// TestChunkPages tests that chunks of content with page markers are given their page
+func TestChunkPages(t *testing.T) {
+	response := MistralOCRResponse{Pages: []MistralOCRPage{
+		{Index: 0, Markdown: "First page."},
+		{Index: 1, Markdown: "Second page."},
+	}}
+	chunks, err := ExtractChunks(response.Markdown(), SentenceChunker{})
+	if err != nil {
+		t.Fatalf("ExtractChunks returned an error: %v", err)
+	}
+
+	pages := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		pages[i] = chunk.Page
+	}
+	if fmt.Sprint(pages) != "[1 1 2 2]" {
+		t.Errorf("Expected the pages [1 1 2 2], got %v for %q", pages, ChunkTexts(chunks))
+	}
+
+	// Content without page markers has no pages
+	if chunks, _ := ExtractChunks("One. Two.", SentenceChunker{}); chunks[1].Page != 0 {
+		t.Errorf("Expected no page without page markers, got %d", chunks[1].Page)
+	}
+}
+
+// TestChunkLabel tests the ChunkLabel function
+func TestChunkLabel(t *testing.T) {
+	if label := ChunkLabel(ChunkTableRow, 2); label != "table-row, p. 2" {
+		t.Errorf("Expected %q, got %q", "table-row, p. 2", label)
+	}
+	if label := ChunkLabel("", 0); label != "" {
+		t.Errorf("Expected no label for chunks stored before their type, got %q", label)
+	}
+}
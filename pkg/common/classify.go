@@ -0,0 +1,99 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ImageKind is what a card image mostly contains, which decides the method its text is
+// extracted with when the method is auto
+type ImageKind string
+
+const (
+	KindHandwriting ImageKind = "handwriting" // handwritten notes
+	KindTable       ImageKind = "table"       // tables of printed text
+	KindDiagram     ImageKind = "diagram"     // diagrams, charts and drawings
+	KindPrinted     ImageKind = "printed"     // printed or typed text
+)
+
+// ImageKinds are all the kinds an image can be classified as
+var ImageKinds = []ImageKind{KindHandwriting, KindTable, KindDiagram, KindPrinted}
+
+// ImageRoute is how the text of an image is extracted
+type ImageRoute struct {
+	Method Method
+	// Handwriting is set to use the settings tuned for handwriting
+	Handwriting bool
+	// Diagram is set to add a description of the diagram with ExtractDiagramMarkdown
+	Diagram bool
+}
+
+// kindRoutes are the methods suited to each kind, the best first, and the settings they
+// are used with
+var kindRoutes = map[ImageKind]struct {
+	methods     []Method
+	handwriting bool
+	diagram     bool
+}{
+	KindHandwriting: {[]Method{MethodVision, MethodOCR, MethodMistral}, true, false},
+	KindTable:       {[]Method{MethodMistral, MethodOCR, MethodVision}, false, false},
+	KindDiagram:     {[]Method{MethodMistral, MethodOCR, MethodVision}, false, true},
+	KindPrinted:     {[]Method{MethodMistral, MethodOCR, MethodVision}, false, false},
+}
+
+// classifyPrompt asks for the kind of an image as a single word
+const classifyPrompt = "Classify this image of a note card by what it mostly contains. Answer with exactly one word: " +
+	"handwriting (handwritten notes), table (a table of printed text), diagram (a diagram, chart or drawing) or " +
+	"printed (printed or typed text)."
+
+// Route returns how the text of an image of the kind is extracted, with the best one of
+// the configured methods. Vision needs no other provider than OpenAI, so it is used when
+// no other method is configured.
+func (k ImageKind) Route(configured []Method) ImageRoute {
+	route, ok := kindRoutes[k]
+	if !ok {
+		route = kindRoutes[KindPrinted]
+	}
+	method := MethodVision
+	for _, m := range route.methods {
+		if slices.Contains(configured, m) {
+			method = m
+			break
+		}
+	}
+	return ImageRoute{Method: method, Handwriting: route.handwriting, Diagram: route.diagram}
+}
+
+// ParseImageKind returns the kind named in the answer of the vision model, which may
+// have other words or punctuation around it
+func ParseImageKind(answer string) (ImageKind, error) {
+	words := strings.FieldsFunc(strings.ToLower(answer), func(r rune) bool {
+		return !('a' <= r && r <= 'z')
+	})
+	for _, word := range words {
+		if kind := ImageKind(word); slices.Contains(ImageKinds, kind) {
+			return kind, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected image classification: %q", answer)
+}
+
+// ClassifyImage tells what an image mostly contains with a small vision request, on a
+// downscaled copy of the image so the request stays cheap
+func ClassifyImage(filePath, apiKey string) (kind ImageKind, err error) {
+	span := StartSpan("classify_image")
+	defer func() { span.End(err) }()
+
+	base64Img, err := encodeImageForVision(filePath, 512, 512)
+	if err != nil {
+		return "", err
+	}
+
+	temperature := 0.0
+	answer, err := visionCompletion(apiKey, "gpt-4o-mini", classifyPrompt, base64Img, 5, &temperature)
+	if err != nil {
+		return "", err
+	}
+	return ParseImageKind(answer)
+}
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestParseImageKind tests the ParseImageKind function
+func TestParseImageKind(t *testing.T) {
+	tests := map[string]ImageKind{
+		"handwriting":   KindHandwriting,
+		"Table.":        KindTable,
+		" **Diagram** ": KindDiagram,
+		"It's printed":  KindPrinted,
+	}
+	for answer, expected := range tests {
+		if kind, err := ParseImageKind(answer); err != nil || kind != expected {
+			t.Errorf("Expected %s for %q, got %q, %v", expected, answer, kind, err)
+		}
+	}
+
+	if _, err := ParseImageKind("a photo"); err == nil {
+		t.Error("Expected error for an answer without a kind, got nil")
+	}
+}
+
+// TestImageKindRoute tests that each kind is routed to the best configured method
+func TestImageKindRoute(t *testing.T) {
+	all := []Method{MethodMistral, MethodOCR, MethodVision}
+
+	if route := KindHandwriting.Route(all); route != (ImageRoute{Method: MethodVision, Handwriting: true}) {
+		t.Errorf("Expected handwriting to be transcribed with vision, got %+v", route)
+	}
+	if route := KindTable.Route(all); route != (ImageRoute{Method: MethodMistral}) {
+		t.Errorf("Expected tables to use mistral, got %+v", route)
+	}
+	if route := KindTable.Route([]Method{MethodOCR, MethodVision}); route.Method != MethodOCR {
+		t.Errorf("Expected tables to fall back to ocr without Mistral, got %+v", route)
+	}
+	if route := KindDiagram.Route(all); route != (ImageRoute{Method: MethodMistral, Diagram: true}) {
+		t.Errorf("Expected diagrams to be transcribed with mistral and described, got %+v", route)
+	}
+	if route := KindPrinted.Route(nil); route.Method != MethodVision {
+		t.Errorf("Expected vision when no method is configured, got %+v", route)
+	}
+}
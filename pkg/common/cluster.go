@@ -0,0 +1,160 @@
+package common
+
+import (
+	"math"
+	"math/rand"
+)
+
+// KMeans clusters vectors into k groups by cosine similarity, using k-means++ seeding.
+// Parameters:
+//
+//	vectors    - The vectors to cluster, all of the same dimension.
+//	k          - The number of clusters, capped to the number of vectors.
+//	iterations - The maximum number of refinement iterations.
+//	seed       - Seed for the random initialization, so results are reproducible.
+//
+// Returns:
+//
+//	The cluster index assigned to each vector and the cluster centroids.
+func KMeans(vectors [][]float32, k, iterations int, seed int64) ([]int, [][]float32) {
+	if len(vectors) == 0 || k <= 0 {
+		return nil, nil
+	}
+	if k > len(vectors) {
+		k = len(vectors)
+	}
+
+	// Normalize so that euclidean distance follows cosine similarity
+	points := make([][]float64, len(vectors))
+	for i, v := range vectors {
+		points[i] = normalizeVector(v)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	centroids := seedCentroids(points, k, rng)
+	assignments := make([]int, len(points))
+
+	for iter := 0; iter < iterations; iter++ {
+		changed := false
+		for i, p := range points {
+			if best := nearestCentroid(p, centroids); best != assignments[i] {
+				assignments[i] = best
+				changed = true
+			}
+		}
+
+		if !changed && iter > 0 {
+			break
+		}
+
+		// Move each centroid to the mean of its points
+		dim := len(points[0])
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+		for c := range sums {
+			sums[c] = make([]float64, dim)
+		}
+		for i, p := range points {
+			c := assignments[i]
+			counts[c]++
+			for d, x := range p {
+				sums[c][d] += x
+			}
+		}
+		for c := range centroids {
+			// Keep the previous centroid of an empty cluster
+			if counts[c] == 0 {
+				continue
+			}
+			for d := range sums[c] {
+				sums[c][d] /= float64(counts[c])
+			}
+			centroids[c] = sums[c]
+		}
+	}
+
+	result := make([][]float32, k)
+	for c, centroid := range centroids {
+		result[c] = make([]float32, len(centroid))
+		for d, x := range centroid {
+			result[c][d] = float32(x)
+		}
+	}
+
+	return assignments, result
+}
+
+// seedCentroids picks initial centroids with the k-means++ strategy
+func seedCentroids(points [][]float64, k int, rng *rand.Rand) [][]float64 {
+	centroids := [][]float64{points[rng.Intn(len(points))]}
+	distances := make([]float64, len(points))
+
+	for len(centroids) < k {
+		total := 0.0
+		for i, p := range points {
+			d := squaredDistance(p, centroids[nearestCentroid(p, centroids)])
+			distances[i] = d
+			total += d
+		}
+
+		// All remaining points coincide with a centroid
+		if total == 0 {
+			centroids = append(centroids, points[rng.Intn(len(points))])
+			continue
+		}
+
+		target := rng.Float64() * total
+		for i, d := range distances {
+			target -= d
+			if target <= 0 {
+				centroids = append(centroids, points[i])
+				break
+			}
+		}
+		if target > 0 {
+			centroids = append(centroids, points[len(points)-1])
+		}
+	}
+
+	return centroids
+}
+
+// nearestCentroid returns the index of the centroid closest to p
+func nearestCentroid(p []float64, centroids [][]float64) int {
+	best := 0
+	bestDistance := math.Inf(1)
+	for c, centroid := range centroids {
+		if d := squaredDistance(p, centroid); d < bestDistance {
+			best = c
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// squaredDistance returns the squared euclidean distance between two vectors
+func squaredDistance(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		diff := a[i] - b[i]
+		sum += diff * diff
+	}
+	return sum
+}
+
+// normalizeVector converts a vector to float64 and scales it to unit length
+func normalizeVector(v []float32) []float64 {
+	norm := 0.0
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	norm = math.Sqrt(norm)
+
+	result := make([]float64, len(v))
+	for i, x := range v {
+		if norm > 0 {
+			result[i] = float64(x) / norm
+		}
+	}
+	return result
+}
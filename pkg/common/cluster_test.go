@@ -0,0 +1,50 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestKMeans tests the KMeans function
+func TestKMeans(t *testing.T) {
+	// Two groups of vectors pointing in clearly different directions
+	vectors := [][]float32{
+		{1.0, 0.1, 0.0},
+		{0.9, 0.0, 0.1},
+		{2.0, 0.2, 0.1},
+		{0.0, 1.0, 0.1},
+		{0.1, 0.9, 0.0},
+		{0.0, 3.0, 0.2},
+	}
+
+	assignments, centroids := KMeans(vectors, 2, 20, 42)
+
+	if len(assignments) != len(vectors) {
+		t.Fatalf("Expected %d assignments, got: %d", len(vectors), len(assignments))
+	}
+	if len(centroids) != 2 {
+		t.Fatalf("Expected 2 centroids, got: %d", len(centroids))
+	}
+
+	// Vectors in the same direction should share a cluster regardless of length
+	if assignments[0] != assignments[1] || assignments[0] != assignments[2] {
+		t.Errorf("Expected the first three vectors in one cluster, got: %v", assignments)
+	}
+	if assignments[3] != assignments[4] || assignments[3] != assignments[5] {
+		t.Errorf("Expected the last three vectors in one cluster, got: %v", assignments)
+	}
+	if assignments[0] == assignments[3] {
+		t.Errorf("Expected two different clusters, got: %v", assignments)
+	}
+
+	// Test that k is capped to the number of vectors
+	assignments, centroids = KMeans(vectors[:2], 5, 10, 1)
+	if len(centroids) != 2 || len(assignments) != 2 {
+		t.Errorf("Expected k to be capped at 2, got %d centroids", len(centroids))
+	}
+
+	// Test with no vectors
+	assignments, centroids = KMeans(nil, 3, 10, 1)
+	if assignments != nil || centroids != nil {
+		t.Error("Expected nil results for no vectors")
+	}
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SideBySide lays out two texts in columns of width cells each, wrapping long lines.
+// Wide characters such as kanji take two cells, so Japanese cards line up too.
+func SideBySide(left, right string, width int) string {
+	return Columns([]string{left, right}, width)
+}
+
+// Columns lays out texts in columns of width cells each, separated by bars, wrapping
+// long lines
+func Columns(texts []string, width int) string {
+	columns := make([][]string, len(texts))
+	rows := 0
+	for i, text := range texts {
+		columns[i] = WrapLines(text, width)
+		rows = max(rows, len(columns[i]))
+	}
+
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		for i, lines := range columns {
+			var line string
+			if row < len(lines) {
+				line = lines[row]
+			}
+
+			// The last column isn't padded, so lines don't end with spaces
+			if i == len(columns)-1 {
+				b.WriteString(strings.TrimRight(line, " "))
+				break
+			}
+			b.WriteString(line)
+			b.WriteString(strings.Repeat(" ", width-textWidth(line)))
+			b.WriteString(" | ")
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// WrapLines splits text into lines of at most width cells
+func WrapLines(text string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line = strings.ReplaceAll(strings.TrimRight(line, " \r"), "\t", "    ")
+
+		var current strings.Builder
+		currentWidth := 0
+		for _, r := range line {
+			w := runeWidth(r)
+			if currentWidth+w > width {
+				lines = append(lines, current.String())
+				current.Reset()
+				currentWidth = 0
+			}
+			current.WriteRune(r)
+			currentWidth += w
+		}
+		lines = append(lines, current.String())
+	}
+	return lines
+}
+
+// FitWidth truncates or pads a line with spaces so it takes exactly width cells
+func FitWidth(line string, width int) string {
+	var b strings.Builder
+	w := 0
+	for _, r := range line {
+		if w+runeWidth(r) > width {
+			break
+		}
+		b.WriteRune(r)
+		w += runeWidth(r)
+	}
+	b.WriteString(strings.Repeat(" ", width-w))
+	return b.String()
+}
+
+// textWidth returns the number of terminal cells a string takes
+func textWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// runeWidth returns 2 for wide East Asian characters and 1 for everything else
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303f) || // CJK punctuation
+		(r >= 0xff01 && r <= 0xff60) { // fullwidth forms
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestSideBySide tests the SideBySide function
+func TestSideBySide(t *testing.T) {
+	// Test columns of different lengths
+	output := SideBySide("# A\nbody", "# B", 6)
+	expected := "# A    | # B\nbody   | \n"
+	if output != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, output)
+	}
+
+	// Test wrapping of long lines
+	output = SideBySide("abcdefgh", "x", 4)
+	expected = "abcd | x\nefgh | \n"
+	if output != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, output)
+	}
+
+	// Test that wide characters take two cells
+	output = SideBySide("梅棹忠夫", "ok", 4)
+	expected = "梅棹 | ok\n忠夫 | \n"
+	if output != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, output)
+	}
+}
+
+// TestColumns tests the Columns function
+func TestColumns(t *testing.T) {
+	// Test three columns of different lengths
+	output := Columns([]string{"a\nb\nc", "d", "e\nf"}, 2)
+	expected := "a  | d  | e\nb  |    | f\nc  |    | \n"
+	if output != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, output)
+	}
+
+	// Test a single column
+	output = Columns([]string{"abc  "}, 5)
+	if output != "abc\n" {
+		t.Errorf("Expected %q, got %q", "abc\n", output)
+	}
+}
+
+// TestFitWidth tests the FitWidth function
+func TestFitWidth(t *testing.T) {
+	// Test padding of short lines
+	if output := FitWidth("abc", 5); output != "abc  " {
+		t.Errorf("Expected %q, got %q", "abc  ", output)
+	}
+
+	// Test truncation of long lines
+	if output := FitWidth("abcdef", 4); output != "abcd" {
+		t.Errorf("Expected %q, got %q", "abcd", output)
+	}
+
+	// Test that a wide character that doesn't fit is replaced with padding
+	if output := FitWidth("梅棹", 3); output != "梅 " {
+		t.Errorf("Expected %q, got %q", "梅 ", output)
+	}
+}
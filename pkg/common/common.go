@@ -7,7 +7,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pgvector/pgvector-go"
@@ -16,38 +19,69 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 )
 
-// RequireEnvVar checks if an environment variable is set and returns its value or an error
+// RequireEnvVar checks if an environment variable is set and returns its value or an error.
+// Secrets that aren't set are read from the OS keychain.
 func RequireEnvVar(name string) (string, error) {
-	value := os.Getenv(name)
+	value := Secret(name)
 	if value == "" {
-		return "", fmt.Errorf("%s environment variable is not set", name)
+		return "", missingEnvError(name)
 	}
 	return value, nil
 }
 
-// InitDB sets up database connection pool and initializes database queries
+// InitDB sets up database connection pool and initializes database queries.
+// The database is pinged before returning, and tried again a few times if it can't be reached.
+// With UME_READ_ONLY set it connects like InitDBReadOnly instead.
 func InitDB() (*pgxpool.Pool, *database.Queries, error) {
-	dbString, err := RequireEnvVar("DB_STRING")
-	if err != nil {
-		return nil, nil, err
+	if readOnly() {
+		return InitDBReadOnly()
 	}
 
-	dbpool, err := pgxpool.New(context.Background(), dbString)
+	config, err := dbPoolConfig("DB_STRING")
 	if err != nil {
-		return nil, nil, fmt.Errorf("error connecting to database: %v", err)
+		return nil, nil, err
 	}
+	return openDB(config)
+}
+
+// ResolveCardUID looks up the local ID of the card with a UID. Commands set it to a
+// database lookup, so ParseCardIDString accepts UIDs wherever it accepts IDs.
+var ResolveCardUID func(uid string) (int32, error)
+
+// cardUIDRe matches the UIDs that identify cards across instances
+var cardUIDRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 
-	// Create database queries
-	queries := database.New(dbpool)
-	return dbpool, queries, nil
+// IsCardUID reports whether s is a card UID rather than a local card ID
+func IsCardUID(s string) bool {
+	return cardUIDRe.MatchString(s)
 }
 
-// ParseCardIDString parses a string to extract a card ID
+// ParseCardIDString parses a string to extract a card ID. The string is either the
+// local ID of the card, its UID, which is resolved with ResolveCardUID, or one of its
+// aliases, which are resolved with ResolveCardAlias.
 func ParseCardIDString(cardIDStr string) (int, error) {
+	if IsCardUID(cardIDStr) {
+		if ResolveCardUID == nil {
+			return 0, fmt.Errorf("error parsing card ID: card UIDs can't be resolved here")
+		}
+		cardID, err := ResolveCardUID(strings.ToLower(cardIDStr))
+		if err != nil {
+			return 0, fmt.Errorf("error resolving card UID %s: %w", cardIDStr, err)
+		}
+		return int(cardID), nil
+	}
+
 	// Parse card ID from string
 	cardID, err := strconv.Atoi(cardIDStr)
 	if err != nil {
-		return 0, fmt.Errorf("error parsing card ID: %v", err)
+		if ResolveCardAlias != nil && IsCardAlias(cardIDStr) {
+			aliasID, err := ResolveCardAlias(strings.ToLower(cardIDStr))
+			if err != nil {
+				return 0, fmt.Errorf("error resolving card alias %s: %w", cardIDStr, err)
+			}
+			return int(aliasID), nil
+		}
+		return 0, fmt.Errorf("error parsing card ID: %w", err)
 	}
 
 	return cardID, nil
@@ -62,6 +96,10 @@ func ParseCardID(args []string) (int, error) {
 		// Get card ID from command line argument
 		cardIDStr = args[1]
 	} else if len(args) == 1 {
+		if NoInput {
+			return 0, fmt.Errorf("%w: no card ID given", ErrInputRequired)
+		}
+
 		// Read from stdin if no arguments provided
 		fmt.Println("Enter card ID:")
 		scanner := bufio.NewScanner(os.Stdin)
@@ -69,7 +107,7 @@ func ParseCardID(args []string) (int, error) {
 			cardIDStr = scanner.Text()
 		} else {
 			if err := scanner.Err(); err != nil {
-				return 0, fmt.Errorf("error reading from stdin: %v", err)
+				return 0, fmt.Errorf("error reading from stdin: %w", err)
 			} else {
 				return 0, fmt.Errorf("no input provided")
 			}
@@ -101,17 +139,13 @@ func EmbeddingToPGVector(embedding []float64) pgvector.Vector {
 	return pgvector.NewVector(ConvertFloat64ToFloat32(embedding))
 }
 
-// For testing purposes, we can override the exit behavior
-var osExit = func(code int) {
-	os.Exit(code)
-}
-
-// CheckError handles errors, prints a message, and exits if an error is present
-func CheckError(err error, message string) {
+// CheckError adds a message to an error so the caller can return it with context.
+// It returns nil if err is nil.
+func CheckError(err error, message string) error {
 	if err != nil {
-		fmt.Printf("%s: %v\n", message, err)
-		osExit(1)
+		return fmt.Errorf("%s: %w", message, err)
 	}
+	return nil
 }
 
 // DisplayCardImages retrieves image for a card and displays it in browser
@@ -119,22 +153,41 @@ func DisplayCardImages(cardID int32, queries database.Queries) error {
 	// Get the image associated with the card
 	row, err := queries.GetCardImage(context.Background(), cardID)
 	if err != nil {
-		return fmt.Errorf("error getting card image: %v", err)
+		return fmt.Errorf("error getting card image: %w", err)
 	}
 
 	// Initialize Minio client
 	minioClient, err := NewMinioClient()
 	if err != nil {
-		return fmt.Errorf("error initializing Minio client: %v", err)
+		return fmt.Errorf("error initializing Minio client: %w", err)
 	}
 
 	// Get the URL to the image
 	imageURL := minioClient.GetImageURLForCard(row.Filename)
 
+	// The browser can't decrypt the stored image, so a decrypted copy is opened instead
+	if minioClient.Encrypted() {
+		// The browser reads the file after this returns, so it is left for ume clean-tmp
+		imageFile, err := os.CreateTemp("", TempPrefix+"image_*"+filepath.Ext(row.Filename))
+		if err != nil {
+			return fmt.Errorf("error creating temporary file: %w", err)
+		}
+		imageFile.Close()
+		imagePath := imageFile.Name()
+		data, err := ReadImage(minioClient, row.Filename)
+		if err != nil {
+			return fmt.Errorf("error downloading image: %w", err)
+		}
+		if err := os.WriteFile(imagePath, data, 0o600); err != nil {
+			return fmt.Errorf("error writing image: %w", err)
+		}
+		imageURL = "file://" + imagePath
+	}
+
 	// Open the image URL in the default browser
 	fmt.Printf("Opening image in browser: %s\n", imageURL)
 	if err := OpenBrowser(imageURL); err != nil {
-		return fmt.Errorf("error opening image: %v", err)
+		return fmt.Errorf("error opening image: %w", err)
 	}
 
 	return nil
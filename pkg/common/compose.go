@@ -0,0 +1,58 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ComposedCard is a card a document is composed from
+type ComposedCard struct {
+	CardID  int32
+	Title   string
+	Content string
+}
+
+// ComposeDocument assembles the markdown of cards, in order, into a draft document under
+// a title. Each card becomes a section whose heading is the first heading of the card, or
+// its title if it doesn't start with one, and the other headings of the card move one level
+// down. A comment before each section records the card it was taken from.
+func ComposeDocument(title string, cards []ComposedCard) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title)
+	for _, card := range cards {
+		fmt.Fprintf(&b, "\n<!-- card:%d -->\n%s", card.CardID, composeSection(card))
+	}
+	return b.String()
+}
+
+// composeSection returns the markdown of a card as a section of a document
+func composeSection(card ComposedCard) string {
+	lines := strings.Split(strings.TrimSpace(card.Content), "\n")
+
+	// The first heading names the section, unless the card starts with text
+	var result []string
+	if m := atxHeadingRe.FindStringSubmatch(lines[0]); m != nil && m[2] != "" {
+		result = append(result, "## "+m[2])
+		lines = lines[1:]
+	} else {
+		title := card.Title
+		if title == "" {
+			title = MarkdownTitle(card.Content, 60)
+		}
+		result = append(result, "## "+title, "")
+	}
+
+	inFence := false
+	for _, line := range lines {
+		if isFence(line) {
+			inFence = !inFence
+		}
+		if m := atxHeadingRe.FindStringSubmatch(line); !inFence && m != nil {
+			level := min(len(m[1])+1, 6)
+			line = strings.Repeat("#", level) + " " + m[2]
+		}
+		result = append(result, line)
+	}
+
+	return strings.TrimRight(strings.Join(result, "\n"), "\n") + "\n"
+}
@@ -0,0 +1,32 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestComposeDocument tests the ComposeDocument function
+func TestComposeDocument(t *testing.T) {
+	document := ComposeDocument("Essay", []ComposedCard{
+		{CardID: 3, Title: "Cards", Content: "# Cards\n\nOne idea per card.\n\n## Why\n\nThey can be reordered.\n"},
+		{CardID: 7, Title: "Order", Content: "Ordering cards finds the structure.\n```\n# not a heading\n```\n"},
+	})
+
+	expected := "# Essay\n" +
+		"\n<!-- card:3 -->\n## Cards\n\nOne idea per card.\n\n### Why\n\nThey can be reordered.\n" +
+		"\n<!-- card:7 -->\n## Order\n\nOrdering cards finds the structure.\n```\n# not a heading\n```\n"
+	if document != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, document)
+	}
+
+	// Test that a card without a title is named by its content
+	document = ComposeDocument("Essay", []ComposedCard{{CardID: 1, Content: "**Umesao** wrote on cards\n"}})
+	if document != "# Essay\n\n<!-- card:1 -->\n## Umesao wrote on cards\n\n**Umesao** wrote on cards\n" {
+		t.Errorf("Expected the section to be named by the content, got:\n%s", document)
+	}
+
+	// Test that headings stop at level 6
+	document = ComposeDocument("Essay", []ComposedCard{{CardID: 1, Content: "# A\n###### Deep\n"}})
+	if document != "# Essay\n\n<!-- card:1 -->\n## A\n###### Deep\n" {
+		t.Errorf("Expected the deepest heading to stay at level 6, got:\n%s", document)
+	}
+}
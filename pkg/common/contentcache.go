@@ -0,0 +1,128 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Directories of the content cache, for each kind of content it keeps
+const (
+	CacheMarkdown = "markdown"
+	CacheImages   = "images"
+)
+
+// ContentCache keeps markdown and images downloaded from Minio in files, so they are
+// only downloaded once and can be read offline. Markdown, including translations, is
+// kept by the hash of its content, which is checked when it is read. Images are kept by
+// their object name and ETag, so an image replaced under the same name is downloaded
+// again, and only the last one downloaded is kept.
+type ContentCache struct {
+	Dir string
+}
+
+// NewContentCache returns the content cache in the cache directory
+func NewContentCache() (*ContentCache, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &ContentCache{Dir: filepath.Join(dir, "content")}, nil
+}
+
+// imagePath returns the file an image with an object name and ETag is kept in. The
+// extension is kept, so the type of the image can be told by it.
+func (c *ContentCache) imagePath(name, etag string) string {
+	return filepath.Join(c.Dir, CacheImages, CalculateFileHash([]byte(name))+"_"+CalculateFileHash([]byte(etag))+filepath.Ext(name))
+}
+
+// imageFiles returns the files kept for an image with an object name, whatever its ETag
+func (c *ContentCache) imageFiles(name string) []string {
+	files, _ := filepath.Glob(filepath.Join(c.Dir, CacheImages, CalculateFileHash([]byte(name))+"_*"))
+	return files
+}
+
+// Markdown returns the markdown with a hash, and whether it was cached unchanged.
+// Files that don't match their hash are removed.
+func (c *ContentCache) Markdown(hash string) (string, bool) {
+	path := filepath.Join(c.Dir, CacheMarkdown, hash+".md")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	if CalculateFileHash(data) != hash {
+		os.Remove(path)
+		return "", false
+	}
+	return string(data), true
+}
+
+// PutMarkdown keeps markdown by the hash of its content
+func (c *ContentCache) PutMarkdown(content string) error {
+	path := filepath.Join(c.Dir, CacheMarkdown, CalculateFileHash([]byte(content))+".md")
+	if err := writeCacheFile(path, []byte(content)); err != nil {
+		return fmt.Errorf("error caching markdown: %w", err)
+	}
+	return nil
+}
+
+// Image returns the image with an object name and ETag, and whether it was cached.
+// Without an ETag, like offline, the image last downloaded with the name is returned.
+func (c *ContentCache) Image(name, etag string) ([]byte, bool) {
+	path := c.imagePath(name, etag)
+	if etag == "" {
+		files := c.imageFiles(name)
+		if len(files) == 0 {
+			return nil, false
+		}
+		path = files[0]
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// HasImage reports whether an image with an object name is cached
+func (c *ContentCache) HasImage(name string) bool {
+	return len(c.imageFiles(name)) > 0
+}
+
+// PutImage keeps an image by its object name and ETag, replacing the image kept before
+// with the name
+func (c *ContentCache) PutImage(name, etag string, data []byte) error {
+	path := c.imagePath(name, etag)
+	if err := writeCacheFile(path, data); err != nil {
+		return fmt.Errorf("error caching image: %w", err)
+	}
+	for _, file := range c.imageFiles(name) {
+		if file != path {
+			os.Remove(file)
+		}
+	}
+	return nil
+}
+
+// writeCacheFile writes a file of a cache only the user can read. It is written next to
+// its final name and renamed, so a concurrent command never reads half of it.
+func writeCacheFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "cache-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
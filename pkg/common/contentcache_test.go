@@ -0,0 +1,80 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestContentCache tests that markdown is kept by its hash and images by their name and ETag
+func TestContentCache(t *testing.T) {
+	cache := &ContentCache{Dir: t.TempDir()}
+
+	content := "# Knowledge work\n\nCards are kept in a box."
+	hash := CalculateFileHash([]byte(content))
+	if _, ok := cache.Markdown(hash); ok {
+		t.Error("Expected no markdown before it is cached")
+	}
+	if err := cache.PutMarkdown(content); err != nil {
+		t.Fatalf("PutMarkdown returned an error: %v", err)
+	}
+	if cached, ok := cache.Markdown(hash); !ok || cached != content {
+		t.Errorf("Expected the cached markdown, got %q, %v", cached, ok)
+	}
+
+	// A file that doesn't match its hash is not used
+	path := filepath.Join(cache.Dir, CacheMarkdown, hash+".md")
+	os.WriteFile(path, []byte("changed"), 0o600)
+	if _, ok := cache.Markdown(hash); ok {
+		t.Error("Expected changed markdown not to be used")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected changed markdown to be removed, got %v", err)
+	}
+
+	if cache.HasImage("IMG_0001.jpg") {
+		t.Error("Expected no image before it is cached")
+	}
+	if err := cache.PutImage("IMG_0001.jpg", "etag-1", []byte{0xff, 0xd8}); err != nil {
+		t.Fatalf("PutImage returned an error: %v", err)
+	}
+	if data, ok := cache.Image("IMG_0001.jpg", "etag-1"); !ok || len(data) != 2 || !cache.HasImage("IMG_0001.jpg") {
+		t.Errorf("Expected the cached image, got %v, %v", data, ok)
+	}
+	if _, ok := cache.Image("IMG_0002.jpg", "etag-1"); ok {
+		t.Error("Expected no image for another name")
+	}
+
+	// An image replaced under the same name has another ETag and isn't read from the cache
+	if _, ok := cache.Image("IMG_0001.jpg", "etag-2"); ok {
+		t.Error("Expected no image for another ETag")
+	}
+	if err := cache.PutImage("IMG_0001.jpg", "etag-2", []byte{0xff, 0xd8, 0xff}); err != nil {
+		t.Fatalf("PutImage returned an error: %v", err)
+	}
+	if _, ok := cache.Image("IMG_0001.jpg", "etag-1"); ok {
+		t.Error("Expected the replaced image to be removed")
+	}
+	if data, ok := cache.Image("IMG_0001.jpg", ""); !ok || len(data) != 3 {
+		t.Errorf("Expected the last image without an ETag, got %v, %v", data, ok)
+	}
+}
+
+// TestReadImageOffline tests that only cached images are read without a Minio client
+func TestReadImageOffline(t *testing.T) {
+	t.Setenv("UME_CACHE_DIR", t.TempDir())
+
+	if _, err := ReadImage(nil, "IMG_0001.jpg"); !errors.Is(err, ErrOffline) {
+		t.Errorf("Expected ErrOffline for an image that isn't cached, got %v", err)
+	}
+
+	cache, err := NewContentCache()
+	if err != nil {
+		t.Fatalf("NewContentCache returned an error: %v", err)
+	}
+	cache.PutImage("IMG_0001.jpg", "etag-1", []byte{0xff, 0xd8})
+	if data, err := ReadImage(nil, "IMG_0001.jpg"); err != nil || len(data) != 2 {
+		t.Errorf("Expected the cached image, got %v, %v", data, err)
+	}
+}
@@ -0,0 +1,178 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yasushisakai/umesao/database"
+)
+
+// DefaultDBConnectTimeout is how long a connection to the database is tried, unless
+// DB_CONNECT_TIMEOUT is set
+const DefaultDBConnectTimeout = 5 * time.Second
+
+// DefaultDBConnectRetries is how many more times the database is tried on start when it
+// can't be reached, unless DB_CONNECT_RETRIES is set
+const DefaultDBConnectRetries = 3
+
+// dbRetryDelay is the wait before the first retry, doubled for every retry after it
+var dbRetryDelay = time.Second
+
+// InitDBReadOnly sets up a database connection pool for commands that only read, like
+// lookup and list. It connects to the replica in DB_REPLICA_STRING if set, or to DB_STRING
+// otherwise, and every transaction is read-only so a stray write fails instead of being lost.
+func InitDBReadOnly() (*pgxpool.Pool, *database.Queries, error) {
+	config, err := readOnlyConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	return openDB(config)
+}
+
+// readOnlyConfig reads the pool settings of the replica, or of the primary without one,
+// with read-only transactions
+func readOnlyConfig() (*pgxpool.Config, error) {
+	source := "DB_STRING"
+	if os.Getenv("DB_REPLICA_STRING") != "" {
+		source = "DB_REPLICA_STRING"
+	}
+
+	config, err := dbPoolConfig(source)
+	if err != nil {
+		return nil, err
+	}
+	config.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	return config, nil
+}
+
+// readOnly reports whether UME_READ_ONLY is set, which makes every command read-only
+func readOnly() bool {
+	return os.Getenv("UME_READ_ONLY") != ""
+}
+
+// openDB creates a pool from its config and checks that the database can be reached
+func openDB(config *pgxpool.Config) (*pgxpool.Pool, *database.Queries, error) {
+	retries, err := dbConnectRetries()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	if err := pingDB(dbpool, retries); err != nil {
+		dbpool.Close()
+		return nil, nil, err
+	}
+	return dbpool, database.New(dbpool), nil
+}
+
+// InitDBLazy sets up the database connection pool like InitDB, but without connecting.
+// The first query connects, so commands that may not need the database start right away.
+func InitDBLazy() (*pgxpool.Pool, *database.Queries, error) {
+	config, err := dbPoolConfig("DB_STRING")
+	if err != nil {
+		return nil, nil, err
+	}
+	if readOnly() {
+		config.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	}
+
+	// Keeping idle connections open would connect right away
+	config.MinConns = 0
+
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+	return dbpool, database.New(dbpool), nil
+}
+
+// dbPoolConfig reads the pool settings from the connection string in an environment
+// variable and the optional DB_MAX_CONNS, DB_MIN_CONNS and DB_CONNECT_TIMEOUT
+func dbPoolConfig(source string) (*pgxpool.Config, error) {
+	dbString, err := RequireEnvVar(source)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := pgxpool.ParseConfig(dbString)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", source, err)
+	}
+
+	if value := os.Getenv("DB_MAX_CONNS"); value != "" {
+		maxConns, err := strconv.Atoi(value)
+		if err != nil || maxConns < 1 {
+			return nil, fmt.Errorf("DB_MAX_CONNS must be a positive number, got %q", value)
+		}
+		config.MaxConns = int32(maxConns)
+	}
+
+	if value := os.Getenv("DB_MIN_CONNS"); value != "" {
+		minConns, err := strconv.Atoi(value)
+		if err != nil || minConns < 0 || int32(minConns) > config.MaxConns {
+			return nil, fmt.Errorf("DB_MIN_CONNS must be a number from 0 to %d, got %q", config.MaxConns, value)
+		}
+		config.MinConns = int32(minConns)
+	}
+
+	config.ConnConfig.ConnectTimeout = DefaultDBConnectTimeout
+	if value := os.Getenv("DB_CONNECT_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("DB_CONNECT_TIMEOUT must be a duration like 5s, got %q", value)
+		}
+		config.ConnConfig.ConnectTimeout = timeout
+	}
+
+	// Postgres cancels statements that run longer than the timeout of a call
+	if CallTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(CallTimeout.Milliseconds(), 10)
+	}
+
+	return config, nil
+}
+
+// dbConnectRetries returns how many more times the database is tried on start
+func dbConnectRetries() (int, error) {
+	value := os.Getenv("DB_CONNECT_RETRIES")
+	if value == "" {
+		return DefaultDBConnectRetries, nil
+	}
+
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		return 0, fmt.Errorf("DB_CONNECT_RETRIES must be a number of 0 or more, got %q", value)
+	}
+	return retries, nil
+}
+
+// pingDB checks that the database can be reached, trying again with a growing delay
+// when it is briefly unavailable, like while Postgres is starting
+func pingDB(dbpool *pgxpool.Pool, retries int) error {
+	delay := dbRetryDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := CallContext()
+		err := dbpool.Ping(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt == retries {
+			return fmt.Errorf("%w: %w", ErrDatabaseUnavailable, err)
+		}
+
+		ReportRetry("Database is not reachable, retrying in %s (%d/%d): %v", delay, attempt+1, retries, err)
+		if err := Sleep(delay); err != nil {
+			return fmt.Errorf("error connecting to database: %w", err)
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,123 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestDBPoolConfig tests reading the pool settings from the environment
+func TestDBPoolConfig(t *testing.T) {
+	t.Setenv("DB_STRING", "host=localhost dbname=umesao")
+	t.Setenv("DB_MAX_CONNS", "")
+	t.Setenv("DB_MIN_CONNS", "")
+	t.Setenv("DB_CONNECT_TIMEOUT", "")
+
+	config, err := dbPoolConfig("DB_STRING")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if config.ConnConfig.ConnectTimeout != DefaultDBConnectTimeout {
+		t.Errorf("Expected the default connect timeout, got %v", config.ConnConfig.ConnectTimeout)
+	}
+
+	t.Setenv("DB_MAX_CONNS", "8")
+	t.Setenv("DB_MIN_CONNS", "2")
+	t.Setenv("DB_CONNECT_TIMEOUT", "2s")
+	config, err = dbPoolConfig("DB_STRING")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if config.MaxConns != 8 || config.MinConns != 2 {
+		t.Errorf("Expected 2 to 8 connections, got %d to %d", config.MinConns, config.MaxConns)
+	}
+	if config.ConnConfig.ConnectTimeout != 2*time.Second {
+		t.Errorf("Expected a connect timeout of 2s, got %v", config.ConnConfig.ConnectTimeout)
+	}
+
+	// Test invalid settings
+	t.Setenv("DB_MIN_CONNS", "9")
+	if _, err := dbPoolConfig("DB_STRING"); err == nil {
+		t.Error("Expected an error for more minimum than maximum connections")
+	}
+	t.Setenv("DB_MIN_CONNS", "")
+	t.Setenv("DB_CONNECT_TIMEOUT", "5")
+	if _, err := dbPoolConfig("DB_STRING"); err == nil {
+		t.Error("Expected an error for a timeout without a unit")
+	}
+}
+
+// TestDBConnectRetries tests the dbConnectRetries function
+func TestDBConnectRetries(t *testing.T) {
+	t.Setenv("DB_CONNECT_RETRIES", "")
+	if retries, err := dbConnectRetries(); err != nil || retries != DefaultDBConnectRetries {
+		t.Errorf("Expected the default retries, got %d, %v", retries, err)
+	}
+
+	t.Setenv("DB_CONNECT_RETRIES", "0")
+	if retries, err := dbConnectRetries(); err != nil || retries != 0 {
+		t.Errorf("Expected no retries, got %d, %v", retries, err)
+	}
+
+	t.Setenv("DB_CONNECT_RETRIES", "-1")
+	if _, err := dbConnectRetries(); err == nil {
+		t.Error("Expected an error for negative retries")
+	}
+}
+
+// TestPingDBRetries tests that an unreachable database is tried again before giving up
+func TestPingDBRetries(t *testing.T) {
+	originalDelay := dbRetryDelay
+	dbRetryDelay = time.Millisecond
+	defer func() {
+		dbRetryDelay = originalDelay
+	}()
+
+	config, err := pgxpool.ParseConfig("host=127.0.0.1 port=1 dbname=umesao connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer dbpool.Close()
+
+	start := time.Now()
+	if err := pingDB(dbpool, 2); err == nil {
+		t.Fatal("Expected an error for an unreachable database")
+	}
+	// Two retries wait 1ms and 2ms
+	if elapsed := time.Since(start); elapsed < 3*time.Millisecond {
+		t.Errorf("Expected the retries to wait, took %v", elapsed)
+	}
+}
+
+// TestReadOnlyConfig tests that read-only pools use the replica with read-only transactions
+func TestReadOnlyConfig(t *testing.T) {
+	t.Setenv("DB_STRING", "host=primary dbname=umesao")
+	t.Setenv("DB_REPLICA_STRING", "host=replica dbname=umesao")
+
+	config, err := readOnlyConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if config.ConnConfig.Host != "replica" {
+		t.Errorf("Expected the replica host, got %s", config.ConnConfig.Host)
+	}
+	if config.ConnConfig.RuntimeParams["default_transaction_read_only"] != "on" {
+		t.Error("Expected read-only transactions")
+	}
+
+	// Without a replica the primary is read
+	t.Setenv("DB_REPLICA_STRING", "")
+	config, err = readOnlyConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if config.ConnConfig.Host != "primary" {
+		t.Errorf("Expected the primary host, got %s", config.ConnConfig.Host)
+	}
+}
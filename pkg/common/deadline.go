@@ -0,0 +1,49 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// CallTimeout limits each request to an external service, like OpenAI, Azure, Mistral
+// and Minio, and each database statement. Zero means no limit. Commands set it with --timeout.
+var CallTimeout time.Duration
+
+// commandCtx is done when the deadline of the command passes
+var commandCtx = context.Background()
+
+// SetDeadline makes the requests of the command fail once it has run for longer than d.
+// Commands set it with --deadline. The returned function releases the timer.
+func SetDeadline(d time.Duration) context.CancelFunc {
+	var cancel context.CancelFunc
+	commandCtx, cancel = context.WithTimeout(context.Background(), d)
+	return cancel
+}
+
+// CommandContext returns the context of the command, done when its deadline passes.
+// It is used for streams that outlive a single call, like objects read from Minio.
+func CommandContext() context.Context {
+	return commandCtx
+}
+
+// CallContext returns the context of a single request to an external service, done
+// after CallTimeout or when the deadline of the command passes, whichever is first
+func CallContext() (context.Context, context.CancelFunc) {
+	if CallTimeout > 0 {
+		return context.WithTimeout(commandCtx, CallTimeout)
+	}
+	return context.WithCancel(commandCtx)
+}
+
+// Sleep waits for d, or returns early with an error when the deadline of the command passes
+func Sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-commandCtx.Done():
+		return commandCtx.Err()
+	}
+}
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestCallContext tests that calls are limited by the call timeout and the deadline of the command
+func TestCallContext(t *testing.T) {
+	defer func() {
+		CallTimeout = 0
+		commandCtx = context.Background()
+	}()
+
+	ctx, cancel := CallContext()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Expected no deadline without a timeout or a deadline")
+	}
+	cancel()
+
+	CallTimeout = time.Hour
+	ctx, cancel = CallContext()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Hour {
+		t.Errorf("Expected a deadline within an hour, got %v", deadline)
+	}
+	cancel()
+
+	// The deadline of the command comes before the call timeout
+	stop := SetDeadline(time.Minute)
+	defer stop()
+	ctx, cancel = CallContext()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("Expected a deadline within a minute, got %v", deadline)
+	}
+	cancel()
+
+	stop()
+	if err := Sleep(time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Sleep to return when the command is done, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+)
+
+// CardStore is the part of the database queries needed to find and delete a card's data
+type CardStore interface {
+	GetCardDeletedAt(ctx context.Context, id int32) (pgtype.Timestamptz, error)
+	ListCardImages(ctx context.Context, cardID int32) ([]string, error)
+	ListMarkdownVersions(ctx context.Context, cardID int32) ([]database.ListMarkdownVersionsRow, error)
+	ListSharedMarkdownHashes(ctx context.Context, cardID int32) ([]string, error)
+	ListCardTranslations(ctx context.Context, cardID int32) ([]database.ListCardTranslationsRow, error)
+	ListOCRVersions(ctx context.Context, cardID int32) ([]int32, error)
+	ListCardAttachmentObjects(ctx context.Context, cardID int32) ([]string, error)
+	DeleteCard(ctx context.Context, id int32) error
+}
+
+// ObjectRemover removes objects from storage
+type ObjectRemover interface {
+	DeleteFileFromMinio(bucketName, objectName string) error
+}
+
+// CardObject is an object stored in Minio for a card
+type CardObject struct {
+	Bucket string
+	Name   string
+	// ByHash is set for markdown stored by its hash, which other cards can store too. It
+	// isn't moved to the trash with the card, as their versions are still stored as it.
+	ByHash bool
+}
+
+// ListCardObjects lists the images, markdown versions, translations, raw OCR results and
+// attachments stored for a card, as recorded in the database. Markdown stored by its hash
+// is listed once, and not at all when versions of other cards are stored as it. The
+// objects of a card in the trash are listed under the trash prefix, where they were moved.
+func ListCardObjects(store CardStore, imageBucket, markdownBucket, ocrBucket, attachmentBucket string, cardID int32) ([]CardObject, error) {
+	deletedAt, err := store.GetCardDeletedAt(context.Background(), cardID)
+	if err != nil {
+		return nil, &CardError{CardID: cardID, Err: err}
+	}
+
+	objects, err := listCardObjects(store, imageBucket, markdownBucket, ocrBucket, attachmentBucket, cardID)
+	if err != nil {
+		return nil, err
+	}
+
+	if deletedAt.Valid {
+		for i := range objects {
+			if !objects[i].ByHash {
+				objects[i].Name = TrashPrefix + objects[i].Name
+			}
+		}
+	}
+	return objects, nil
+}
+
+// listCardObjects lists the objects of a card under the names they are stored as outside the trash
+func listCardObjects(store CardStore, imageBucket, markdownBucket, ocrBucket, attachmentBucket string, cardID int32) ([]CardObject, error) {
+	var objects []CardObject
+
+	images, err := store.ListCardImages(context.Background(), cardID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing images: %w", err)
+	}
+	for _, filename := range images {
+		objects = append(objects, CardObject{Bucket: imageBucket, Name: filename})
+	}
+
+	versions, err := store.ListMarkdownVersions(context.Background(), cardID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing markdown versions: %w", err)
+	}
+	shared, err := store.ListSharedMarkdownHashes(context.Background(), cardID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing shared markdown: %w", err)
+	}
+	listed := make(map[string]bool)
+	for _, hash := range shared {
+		listed[hash] = true
+	}
+	for _, version := range versions {
+		if !version.ByHash {
+			objects = append(objects, CardObject{Bucket: markdownBucket, Name: LegacyMarkdownObject(cardID, version.Ver)})
+			continue
+		}
+		if listed[version.Hash] {
+			continue
+		}
+		listed[version.Hash] = true
+		objects = append(objects, CardObject{Bucket: markdownBucket, Name: MarkdownObject(version.Hash), ByHash: true})
+	}
+
+	translations, err := store.ListCardTranslations(context.Background(), cardID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing translations: %w", err)
+	}
+	for _, translation := range translations {
+		objects = append(objects, CardObject{
+			Bucket: markdownBucket,
+			Name:   fmt.Sprintf("%d_%d_%s.md", cardID, translation.Ver, translation.Lang),
+		})
+	}
+
+	ocrVersions, err := store.ListOCRVersions(context.Background(), cardID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing OCR results: %w", err)
+	}
+	for _, ver := range ocrVersions {
+		objects = append(objects, CardObject{
+			Bucket: ocrBucket,
+			Name:   fmt.Sprintf("%d_%d.json", cardID, ver),
+		})
+	}
+
+	attachments, err := store.ListCardAttachmentObjects(context.Background(), cardID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing attachments: %w", err)
+	}
+	for _, name := range attachments {
+		objects = append(objects, CardObject{Bucket: attachmentBucket, Name: name})
+	}
+
+	return objects, nil
+}
+
+// DeleteCardObjects removes the given objects and then deletes the card from the database.
+// Objects that can't be removed don't stop the deletion, they are returned as warnings.
+// Parameters:
+//
+//	store   - The database queries.
+//	remover - The object storage.
+//	objects - The card's objects, as returned by ListCardObjects.
+//	cardID  - The card to delete.
+//
+// Returns:
+//
+//	One warning per object that couldn't be removed and an error if the card couldn't be deleted.
+func DeleteCardObjects(store CardStore, remover ObjectRemover, objects []CardObject, cardID int32) ([]error, error) {
+	var warnings []error
+	for _, object := range objects {
+		if err := remover.DeleteFileFromMinio(object.Bucket, object.Name); err != nil {
+			warnings = append(warnings, fmt.Errorf("failed to delete %s: %w", object.Name, err))
+		}
+	}
+
+	// Cascade deletion takes care of the other database records
+	if err := store.DeleteCard(context.Background(), cardID); err != nil {
+		return warnings, fmt.Errorf("error deleting card: %w", err)
+	}
+
+	return warnings, nil
+}
+
+// TrashStore is the part of the database queries needed to move a card to the trash and back
+type TrashStore interface {
+	TrashCard(ctx context.Context, id int32) error
+	RestoreCard(ctx context.Context, id int32) error
+}
+
+// ObjectMover moves objects under the trash prefix and back
+type ObjectMover interface {
+	MoveObjectToTrash(bucketName, objectName string) error
+	RestoreObjectFromTrash(bucketName, objectName string) error
+}
+
+// TrashCardObjects moves the given objects under the trash prefix and then marks the card
+// as deleted. Markdown stored by its hash stays in place, as other cards can store it too.
+// Objects that can't be moved don't stop the card from being trashed, they are returned
+// as warnings.
+func TrashCardObjects(store TrashStore, mover ObjectMover, objects []CardObject, cardID int32) ([]error, error) {
+	var warnings []error
+	for _, object := range objects {
+		if object.ByHash {
+			continue
+		}
+		if err := mover.MoveObjectToTrash(object.Bucket, object.Name); err != nil {
+			warnings = append(warnings, fmt.Errorf("failed to move %s to the trash: %w", object.Name, err))
+		}
+	}
+
+	if err := store.TrashCard(context.Background(), cardID); err != nil {
+		return warnings, fmt.Errorf("error moving card to the trash: %w", err)
+	}
+	return warnings, nil
+}
+
+// RestoreCardObjects moves the given objects of a trashed card, as listed under the trash
+// prefix by ListCardObjects, back to their names and then restores the card, like
+// TrashCardObjects in reverse
+func RestoreCardObjects(store TrashStore, mover ObjectMover, objects []CardObject, cardID int32) ([]error, error) {
+	var warnings []error
+	for _, object := range objects {
+		if object.ByHash {
+			continue
+		}
+		if err := mover.RestoreObjectFromTrash(object.Bucket, strings.TrimPrefix(object.Name, TrashPrefix)); err != nil {
+			warnings = append(warnings, fmt.Errorf("failed to restore %s: %w", object.Name, err))
+		}
+	}
+
+	if err := store.RestoreCard(context.Background(), cardID); err != nil {
+		return warnings, fmt.Errorf("error restoring card: %w", err)
+	}
+	return warnings, nil
+}
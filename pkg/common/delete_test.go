@@ -0,0 +1,260 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+)
+
+// mockCardStore is an in-memory CardStore
+type mockCardStore struct {
+	images       []string
+	versions     []int32
+	byHash       map[int32]string
+	shared       []string
+	translations []database.ListCardTranslationsRow
+	ocrVersions  []int32
+	attachments  []string
+	imagesErr    error
+	deleted      []int32
+	trashed      []int32
+	restored     []int32
+	inTrash      bool
+}
+
+func (s *mockCardStore) GetCardDeletedAt(ctx context.Context, id int32) (pgtype.Timestamptz, error) {
+	return pgtype.Timestamptz{Valid: s.inTrash}, nil
+}
+
+func (s *mockCardStore) ListCardImages(ctx context.Context, cardID int32) ([]string, error) {
+	return s.images, s.imagesErr
+}
+
+func (s *mockCardStore) ListMarkdownVersions(ctx context.Context, cardID int32) ([]database.ListMarkdownVersionsRow, error) {
+	var rows []database.ListMarkdownVersionsRow
+	for _, ver := range s.versions {
+		hash, ok := s.byHash[ver]
+		rows = append(rows, database.ListMarkdownVersionsRow{Ver: ver, Hash: hash, ByHash: ok})
+	}
+	return rows, nil
+}
+
+func (s *mockCardStore) ListSharedMarkdownHashes(ctx context.Context, cardID int32) ([]string, error) {
+	return s.shared, nil
+}
+
+func (s *mockCardStore) ListCardTranslations(ctx context.Context, cardID int32) ([]database.ListCardTranslationsRow, error) {
+	return s.translations, nil
+}
+
+func (s *mockCardStore) ListOCRVersions(ctx context.Context, cardID int32) ([]int32, error) {
+	return s.ocrVersions, nil
+}
+
+func (s *mockCardStore) ListCardAttachmentObjects(ctx context.Context, cardID int32) ([]string, error) {
+	return s.attachments, nil
+}
+
+func (s *mockCardStore) DeleteCard(ctx context.Context, id int32) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+func (s *mockCardStore) TrashCard(ctx context.Context, id int32) error {
+	s.trashed = append(s.trashed, id)
+	return nil
+}
+
+func (s *mockCardStore) RestoreCard(ctx context.Context, id int32) error {
+	s.restored = append(s.restored, id)
+	return nil
+}
+
+// mockRemover records removed objects and fails for the objects in fail
+type mockRemover struct {
+	removed []string
+	fail    map[string]bool
+}
+
+func (r *mockRemover) DeleteFileFromMinio(bucketName, objectName string) error {
+	if r.fail[objectName] {
+		return fmt.Errorf("object not found")
+	}
+	r.removed = append(r.removed, bucketName+"/"+objectName)
+	return nil
+}
+
+func (r *mockRemover) MoveObjectToTrash(bucketName, objectName string) error {
+	return r.DeleteFileFromMinio(bucketName, objectName)
+}
+
+func (r *mockRemover) RestoreObjectFromTrash(bucketName, objectName string) error {
+	return r.DeleteFileFromMinio(bucketName, objectName)
+}
+
+// TestListCardObjects tests the ListCardObjects function
+func TestListCardObjects(t *testing.T) {
+	// Versions are not necessarily contiguous, e.g. after a version was removed
+	store := &mockCardStore{
+		images:       []string{"scan.jpg", "rescan.jpg"},
+		versions:     []int32{1, 3},
+		translations: []database.ListCardTranslationsRow{{Ver: 3, Lang: "english"}},
+		ocrVersions:  []int32{1},
+		attachments:  []string{"7/data.csv"},
+	}
+
+	objects, err := ListCardObjects(store, "images", "markdown", "ocr", "attachments", 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := []CardObject{
+		{Bucket: "images", Name: "scan.jpg"},
+		{Bucket: "images", Name: "rescan.jpg"},
+		{Bucket: "markdown", Name: "7_1.md"},
+		{Bucket: "markdown", Name: "7_3.md"},
+		{Bucket: "markdown", Name: "7_3_english.md"},
+		{Bucket: "ocr", Name: "7_1.json"},
+		{Bucket: "attachments", Name: "7/data.csv"},
+	}
+	if len(objects) != len(expected) {
+		t.Fatalf("Expected %d objects, got: %v", len(expected), objects)
+	}
+	for i := range expected {
+		if objects[i] != expected[i] {
+			t.Errorf("Expected object %v, got: %v", expected[i], objects[i])
+		}
+	}
+
+	// Test that the objects of a card in the trash are listed where they were moved to
+	store.inTrash = true
+	objects, err = ListCardObjects(store, "images", "markdown", "ocr", "attachments", 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(objects) != len(expected) {
+		t.Fatalf("Expected %d objects, got: %v", len(expected), objects)
+	}
+	for i := range expected {
+		if objects[i].Name != TrashPrefix+expected[i].Name {
+			t.Errorf("Expected object %s, got: %v", TrashPrefix+expected[i].Name, objects[i])
+		}
+	}
+
+	// Test that a failed lookup is reported instead of being ignored
+	store.imagesErr = fmt.Errorf("connection refused")
+	if _, err := ListCardObjects(store, "images", "markdown", "ocr", "attachments", 7); err == nil {
+		t.Error("Expected an error when images can't be listed")
+	}
+}
+
+// TestListCardObjectsByHash tests that markdown stored by hash is listed once, unless other cards store it too
+func TestListCardObjectsByHash(t *testing.T) {
+	// Version 3 reverted to version 2, version 4 is shared with another card
+	store := &mockCardStore{
+		versions: []int32{1, 2, 3, 4},
+		byHash:   map[int32]string{2: "aaa", 3: "aaa", 4: "bbb"},
+		shared:   []string{"bbb"},
+	}
+
+	objects, err := ListCardObjects(store, "images", "markdown", "ocr", "attachments", 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := []CardObject{
+		{Bucket: "markdown", Name: "7_1.md"},
+		{Bucket: "markdown", Name: "sha256/aaa.md", ByHash: true},
+	}
+	if len(objects) != len(expected) {
+		t.Fatalf("Expected %d objects, got: %v", len(expected), objects)
+	}
+	for i := range expected {
+		if objects[i] != expected[i] {
+			t.Errorf("Expected object %v, got: %v", expected[i], objects[i])
+		}
+	}
+}
+
+// TestDeleteCardObjects tests the DeleteCardObjects function
+func TestDeleteCardObjects(t *testing.T) {
+	store := &mockCardStore{}
+	remover := &mockRemover{fail: map[string]bool{"7_1.md": true}}
+	objects := []CardObject{
+		{Bucket: "images", Name: "scan.jpg"},
+		{Bucket: "markdown", Name: "7_1.md"},
+		{Bucket: "markdown", Name: "7_2.md"},
+	}
+
+	warnings, err := DeleteCardObjects(store, remover, objects, 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// A missing object should not stop the other deletions
+	if len(warnings) != 1 {
+		t.Errorf("Expected 1 warning, got: %v", warnings)
+	}
+	if len(remover.removed) != 2 || remover.removed[0] != "images/scan.jpg" || remover.removed[1] != "markdown/7_2.md" {
+		t.Errorf("Expected scan.jpg and 7_2.md to be removed, got: %v", remover.removed)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != 7 {
+		t.Errorf("Expected card 7 to be deleted, got: %v", store.deleted)
+	}
+
+	// Test a card without any objects
+	store = &mockCardStore{}
+	warnings, err = DeleteCardObjects(store, &mockRemover{}, nil, 8)
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("Expected no error or warnings, got: %v, %v", err, warnings)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != 8 {
+		t.Errorf("Expected card 8 to be deleted, got: %v", store.deleted)
+	}
+}
+
+// TestTrashCardObjects tests that markdown stored by hash stays in place when a card is trashed and restored
+func TestTrashCardObjects(t *testing.T) {
+	store := &mockCardStore{}
+	mover := &mockRemover{fail: map[string]bool{"7_1.md": true}}
+	objects := []CardObject{
+		{Bucket: "images", Name: "scan.jpg"},
+		{Bucket: "markdown", Name: "7_1.md"},
+		{Bucket: "markdown", Name: "sha256/aaa.md", ByHash: true},
+	}
+
+	warnings, err := TrashCardObjects(store, mover, objects, 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Expected 1 warning, got: %v", warnings)
+	}
+	if len(mover.removed) != 1 || mover.removed[0] != "images/scan.jpg" {
+		t.Errorf("Expected only scan.jpg to be moved, got: %v", mover.removed)
+	}
+	if len(store.trashed) != 1 || store.trashed[0] != 7 || len(store.deleted) != 0 {
+		t.Errorf("Expected card 7 to be trashed and not deleted, got: %v, %v", store.trashed, store.deleted)
+	}
+
+	// Objects are restored as listed for the trashed card, under the trash prefix
+	mover = &mockRemover{}
+	trashed := []CardObject{
+		{Bucket: "images", Name: TrashPrefix + "scan.jpg"},
+		{Bucket: "markdown", Name: TrashPrefix + "7_1.md"},
+		{Bucket: "markdown", Name: "sha256/aaa.md", ByHash: true},
+	}
+	warnings, err = RestoreCardObjects(store, mover, trashed, 7)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("Expected no error or warnings, got: %v, %v", err, warnings)
+	}
+	if len(mover.removed) != 2 || mover.removed[0] != "images/scan.jpg" || mover.removed[1] != "markdown/7_1.md" {
+		t.Errorf("Expected scan.jpg and 7_1.md to be restored, got: %v", mover.removed)
+	}
+	if len(store.restored) != 1 || store.restored[0] != 7 {
+		t.Errorf("Expected card 7 to be restored, got: %v", store.restored)
+	}
+}
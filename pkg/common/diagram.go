@@ -0,0 +1,79 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DiagramDescriptionHeading is the heading of the section of a card that describes what
+// its diagrams show
+const DiagramDescriptionHeading = "## Diagram description"
+
+// ExtractDiagramMarkdown extracts the markdown of a diagram-heavy card in two passes: the
+// text on the image is transcribed with method, and what the diagram shows is captioned
+// with vision. The caption is added under DiagramDescriptionHeading, so the card can also
+// be found by what its diagrams show. The vision method transcribes the text instead of
+// describing it in the first pass. The OCR result of the transcription is returned with
+// the markdown, empty for the vision method.
+func ExtractDiagramMarkdown(filePath string, method Method, language, openaiKey string, handwriting bool, live io.Writer) (string, string, error) {
+	transcription, ocrResult, err := ExtractMarkdown(filePath, method, language, openaiKey, handwriting || method == MethodVision, live)
+	if err != nil {
+		return "", "", err
+	}
+
+	caption, err := captionWithVision(filePath, openaiKey)
+	if err != nil {
+		return "", "", fmt.Errorf("error describing the diagram: %w", err)
+	}
+
+	return CombineDiagramMarkdown(transcription, caption), ocrResult, nil
+}
+
+// CombineDiagramMarkdown adds the caption of a diagram to the markdown transcribed from
+// it, in a section under DiagramDescriptionHeading
+func CombineDiagramMarkdown(transcription, caption string) string {
+	section := DiagramDescriptionHeading + "\n\n" + strings.TrimSpace(caption) + "\n"
+	transcription = strings.TrimSpace(transcription)
+	if transcription == "" {
+		return section
+	}
+	return transcription + "\n\n" + section
+}
+
+// DiagramDescription returns the caption in the section under DiagramDescriptionHeading,
+// or "" if the markdown has none. The section ends at the next heading of its level or
+// above.
+func DiagramDescription(markdown string) string {
+	start, end, ok := diagramDescriptionRange(markdown)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(markdown[start:end])
+}
+
+// diagramDescriptionRange returns the byte range of the section under
+// DiagramDescriptionHeading, without the heading, and whether the markdown has one
+func diagramDescriptionRange(markdown string) (int, int, bool) {
+	start, offset := -1, 0
+	inFence := false
+	for _, line := range strings.SplitAfter(markdown, "\n") {
+		lineStart := offset
+		offset += len(line)
+		line = strings.TrimSuffix(line, "\n")
+		if isFence(line) {
+			inFence = !inFence
+		}
+		m := atxHeadingRe.FindStringSubmatch(line)
+		if inFence || m == nil {
+			continue
+		}
+		if start >= 0 && len(m[1]) <= 2 {
+			return start, lineStart, true
+		}
+		if start < 0 && strings.TrimSpace(line) == DiagramDescriptionHeading {
+			start = offset
+		}
+	}
+	return start, len(markdown), start >= 0
+}
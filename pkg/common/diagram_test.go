@@ -0,0 +1,39 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestCombineDiagramMarkdown tests the CombineDiagramMarkdown function
+func TestCombineDiagramMarkdown(t *testing.T) {
+	output := CombineDiagramMarkdown("# Water cycle\n\nEvaporation\n", " Arrows show water rising from the sea. ")
+	expected := "# Water cycle\n\nEvaporation\n\n## Diagram description\n\nArrows show water rising from the sea.\n"
+	if output != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, output)
+	}
+
+	// A diagram without text only has the description
+	output = CombineDiagramMarkdown("  \n", "A bar chart.")
+	expected = "## Diagram description\n\nA bar chart.\n"
+	if output != expected {
+		t.Errorf("Expected:\n%q\nGot:\n%q", expected, output)
+	}
+}
+
+// TestDiagramDescription tests the DiagramDescription function
+func TestDiagramDescription(t *testing.T) {
+	markdown := CombineDiagramMarkdown("# Water cycle\n\nEvaporation", "Arrows show water rising.\n\n### Labels\n\nSea, cloud")
+	if description := DiagramDescription(markdown); description != "Arrows show water rising.\n\n### Labels\n\nSea, cloud" {
+		t.Errorf("Expected the description with its subsections, got %q", description)
+	}
+
+	// The section ends at the next heading of its level
+	markdown = "# Notes\n\n## Diagram description\n\nA chart.\n\n## Sources\n\nBook"
+	if description := DiagramDescription(markdown); description != "A chart." {
+		t.Errorf("Expected %q, got %q", "A chart.", description)
+	}
+
+	if description := DiagramDescription("# Notes\n\nNo diagram"); description != "" {
+		t.Errorf("Expected no description, got %q", description)
+	}
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// encryptedHeader starts every object encrypted by ume, so objects stored before
+// encryption was turned on can still be read
+var encryptedHeader = []byte("UMEENC1\n")
+
+// EncryptionKey returns the key objects are encrypted with from UME_ENCRYPTION_KEY, a
+// base64 encoded 32 byte key, or nil when encryption is not configured
+func EncryptionKey() ([]byte, error) {
+	value := Secret("UME_ENCRYPTION_KEY")
+	if value == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UME_ENCRYPTION_KEY: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid UME_ENCRYPTION_KEY: expected 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// IsEncrypted reports whether data was encrypted by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedHeader)
+}
+
+// Encrypt encrypts data with AES-256-GCM. The result is the header, the nonce and the
+// sealed data.
+func Encrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, encryptedHeader...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, encryptedHeader), nil
+}
+
+// Decrypt decrypts data encrypted by Encrypt. Data without the header wasn't encrypted
+// and is returned as it is.
+func Decrypt(key, data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	if key == nil {
+		return nil, fmt.Errorf("object is encrypted but UME_ENCRYPTION_KEY is not set")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := data[len(encryptedHeader):]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted object is truncated")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], encryptedHeader)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting object, is UME_ENCRYPTION_KEY the key it was stored with? %w", err)
+	}
+	return plain, nil
+}
+
+// newGCM creates an AES-GCM cipher for a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
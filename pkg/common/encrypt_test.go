@@ -0,0 +1,74 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"testing"
+)
+
+// TestEncryptionKey tests the EncryptionKey function
+func TestEncryptionKey(t *testing.T) {
+	originalKey := os.Getenv("UME_ENCRYPTION_KEY")
+	defer os.Setenv("UME_ENCRYPTION_KEY", originalKey)
+
+	os.Setenv("UME_ENCRYPTION_KEY", "")
+	if key, err := EncryptionKey(); key != nil || err != nil {
+		t.Errorf("Expected no key when UME_ENCRYPTION_KEY is not set, got %v, %v", key, err)
+	}
+
+	os.Setenv("UME_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if key, err := EncryptionKey(); len(key) != 32 || err != nil {
+		t.Errorf("Expected a 32 byte key, got %v, %v", key, err)
+	}
+
+	os.Setenv("UME_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString([]byte("short")))
+	if _, err := EncryptionKey(); err == nil {
+		t.Errorf("Expected an error for a key that is too short")
+	}
+
+	os.Setenv("UME_ENCRYPTION_KEY", "not base64!")
+	if _, err := EncryptionKey(); err == nil {
+		t.Errorf("Expected an error for a key that is not base64")
+	}
+}
+
+// TestEncrypt tests the Encrypt and Decrypt functions
+func TestEncrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	content := []byte("# Notes\n\nsensitive")
+
+	encrypted, err := Encrypt(key, content)
+	if err != nil {
+		t.Fatalf("Encrypt returned an error: %v", err)
+	}
+	if !IsEncrypted(encrypted) || bytes.Contains(encrypted, []byte("sensitive")) {
+		t.Errorf("Expected the content to be encrypted, got %q", encrypted)
+	}
+
+	decrypted, err := Decrypt(key, encrypted)
+	if err != nil {
+		t.Fatalf("Decrypt returned an error: %v", err)
+	}
+	if !bytes.Equal(decrypted, content) {
+		t.Errorf("Expected %q, got %q", content, decrypted)
+	}
+
+	// Objects stored before encryption was turned on are read as they are
+	if plain, err := Decrypt(key, content); err != nil || !bytes.Equal(plain, content) {
+		t.Errorf("Expected unencrypted content to be returned as it is, got %q, %v", plain, err)
+	}
+
+	if _, err := Decrypt(nil, encrypted); err == nil {
+		t.Errorf("Expected an error when decrypting without a key")
+	}
+
+	if _, err := Decrypt(bytes.Repeat([]byte{2}, 32), encrypted); err == nil {
+		t.Errorf("Expected an error when decrypting with another key")
+	}
+
+	encrypted[len(encrypted)-1] ^= 1
+	if _, err := Decrypt(key, encrypted); err == nil {
+		t.Errorf("Expected an error for tampered content")
+	}
+}
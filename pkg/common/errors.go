@@ -0,0 +1,117 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Errors commands fail with, which can be told apart with errors.Is
+var (
+	// ErrCardNotFound is returned when a card, or a version of it, doesn't exist
+	ErrCardNotFound = errors.New("card not found")
+	// ErrNoAPIKey is returned when an API key, token or other secret isn't set, or is
+	// rejected by the service
+	ErrNoAPIKey = errors.New("API key not set")
+	// ErrNotConfigured is returned when a setting a command needs isn't set
+	ErrNotConfigured = errors.New("not configured")
+	// ErrProviderUnavailable is returned when an external service like OpenAI or Azure
+	// can't be reached, limits the rate of requests or fails on its side
+	ErrProviderUnavailable = errors.New("provider unavailable")
+	// ErrDatabaseUnavailable is returned when the database can't be reached
+	ErrDatabaseUnavailable = errors.New("database unavailable")
+	// ErrOffline is returned instead of contacting an external service with Offline set
+	ErrOffline = errors.New("offline")
+	// ErrChecksumMismatch is returned when an object read from Minio doesn't match the
+	// checksum or hash it was stored with
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrVersionConflict is returned when another edit stored the same version of a card
+	// first
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// CardError is an error about a card, which is ErrCardNotFound when the card or the
+// version doesn't exist
+type CardError struct {
+	CardID int32
+	// Version is the version of the card, 0 for the card itself
+	Version int32
+	Err     error
+}
+
+// Error describes the card that wasn't found
+func (e *CardError) Error() string {
+	msg := fmt.Sprintf("card %d not found", e.CardID)
+	if e.Version != 0 {
+		msg = fmt.Sprintf("version %d not found for card %d", e.Version, e.CardID)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the error of the lookup of the card
+func (e *CardError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the card doesn't exist, rather than couldn't be looked up
+func (e *CardError) Is(target error) bool {
+	return target == ErrCardNotFound && (e.Err == nil || errors.Is(e.Err, pgx.ErrNoRows))
+}
+
+// ProviderError is an error of a request to an external service like OpenAI or Azure
+type ProviderError struct {
+	Provider string
+	// StatusCode is the HTTP status of the response, 0 if there was no response
+	StatusCode int
+	Err        error
+}
+
+// Error describes the failed request
+func (e *ProviderError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s API request failed with status %d: %v", e.Provider, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s API request failed: %v", e.Provider, e.Err)
+}
+
+// Unwrap returns the error of the request
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports ErrProviderUnavailable when the service couldn't be reached, limited the
+// rate or failed on its side, and ErrNoAPIKey when it rejected the key
+func (e *ProviderError) Is(target error) bool {
+	switch target {
+	case ErrProviderUnavailable:
+		return e.StatusCode == 0 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+	case ErrNoAPIKey:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// responseError returns a ProviderError with the status and the body of a failed response
+func responseError(provider string, resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	return &ProviderError{Provider: provider, StatusCode: resp.StatusCode, Err: errors.New(strings.TrimSpace(string(body)))}
+}
+
+// missingEnvError returns the error of an environment variable that isn't set,
+// ErrNoAPIKey for keys, tokens and secrets and ErrNotConfigured for other settings
+func missingEnvError(name string) error {
+	sentinel := ErrNotConfigured
+	for _, suffix := range []string{"_KEY", "_TOKEN", "_SECRET", "_PASSWORD", "_USER"} {
+		if strings.HasSuffix(name, suffix) {
+			sentinel = ErrNoAPIKey
+		}
+	}
+	return fmt.Errorf("%w: %s environment variable is not set", sentinel, name)
+}
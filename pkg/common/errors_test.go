@@ -0,0 +1,96 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestCardError(t *testing.T) {
+	// Test that a card that doesn't exist is ErrCardNotFound through wrapping
+	err := fmt.Errorf("error deleting card: %w", &CardError{CardID: 12, Err: pgx.ErrNoRows})
+	if !errors.Is(err, ErrCardNotFound) {
+		t.Errorf("Expected ErrCardNotFound, got: %v", err)
+	}
+	if err.Error() != "error deleting card: card 12 not found: no rows in result set" {
+		t.Errorf("Unexpected message: %v", err)
+	}
+
+	var cardErr *CardError
+	if !errors.As(err, &cardErr) || cardErr.CardID != 12 {
+		t.Errorf("Expected the card ID in the error, got: %v", err)
+	}
+
+	if err := (&CardError{CardID: 3, Version: 2}); err.Error() != "version 2 not found for card 3" || !errors.Is(err, ErrCardNotFound) {
+		t.Errorf("Expected version 2 of card 3 not to be found, got: %v", err)
+	}
+
+	// Test that a card that couldn't be looked up is not
+	if errors.Is(&CardError{CardID: 12, Err: errors.New("connection reset")}, ErrCardNotFound) {
+		t.Error("Expected a failed lookup not to be ErrCardNotFound")
+	}
+}
+
+func TestProviderError(t *testing.T) {
+	tests := []struct {
+		status      int
+		unavailable bool
+		noAPIKey    bool
+	}{
+		{0, true, false},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusBadGateway, true, false},
+		{http.StatusUnauthorized, false, true},
+		{http.StatusBadRequest, false, false},
+	}
+
+	for _, tt := range tests {
+		err := fmt.Errorf("error converting: %w", &ProviderError{Provider: "OpenAI", StatusCode: tt.status, Err: errors.New("failed")})
+		if errors.Is(err, ErrProviderUnavailable) != tt.unavailable {
+			t.Errorf("Expected status %d to be unavailable: %v", tt.status, tt.unavailable)
+		}
+		if errors.Is(err, ErrNoAPIKey) != tt.noAPIKey {
+			t.Errorf("Expected status %d to be a rejected key: %v", tt.status, tt.noAPIKey)
+		}
+	}
+
+	// Test that a failed response keeps its status and body
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "overloaded\n")
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	err = responseError("Azure", resp)
+	if err.Error() != "Azure API request failed with status 503: overloaded" {
+		t.Errorf("Unexpected message: %v", err)
+	}
+	if !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("Expected ErrProviderUnavailable, got: %v", err)
+	}
+}
+
+func TestRequireEnvVarError(t *testing.T) {
+	t.Setenv("MISTRAL_KEY", "")
+	t.Setenv("UME_TEST_SETTING", "")
+	keychainGet = func(string) (string, error) { return "", errors.New("not found") }
+	defer func() { keychainGet = getKeychainSecret }()
+
+	if _, err := RequireEnvVar("MISTRAL_KEY"); !errors.Is(err, ErrNoAPIKey) {
+		t.Errorf("Expected ErrNoAPIKey, got: %v", err)
+	}
+	if _, err := RequireEnvVar("UME_TEST_SETTING"); !errors.Is(err, ErrNotConfigured) || errors.Is(err, ErrNoAPIKey) {
+		t.Errorf("Expected ErrNotConfigured, got: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxQueryExpansions is the most paraphrases and translations a query is expanded with
+const MaxQueryExpansions = 3
+
+// fusionK dampens the weight of the top ranks in reciprocal rank fusion, 60 is the
+// value the method was proposed with
+const fusionK = 60
+
+// listMarker matches the bullet or number a model may start a line with
+var listMarker = regexp.MustCompile(`^(\d+[.)]|[-*•])\s+`)
+
+// ExpandQuery asks the chat model for paraphrases and translations of a search query, so
+// short queries also match cards worded differently or written in another language.
+// The query itself comes first, followed by at most MaxQueryExpansions expansions.
+func (c *OpenAIClient) ExpandQuery(query string) ([]string, error) {
+	reply, err := c.complete(
+		"You help search a personal archive of note cards written in several languages. Output only the alternative queries, one per line, without numbering, quotes or any additional explanation.",
+		"Write 2 or 3 alternative search queries for the following query: paraphrases with related terms, and translations into English or Japanese if it is written in another language.\n\n"+query,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []string{query}
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(query)): true}
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.Trim(strings.TrimSpace(listMarker.ReplaceAllString(strings.TrimSpace(line), "")), "\"'「」")
+		key := strings.ToLower(line)
+		if line == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		queries = append(queries, line)
+		if len(queries) == MaxQueryExpansions+1 {
+			break
+		}
+	}
+	return queries, nil
+}
+
+// FuseRankings merges rankings of card IDs with reciprocal rank fusion: a card scores
+// 1/(60+rank) in every ranking it is in, so cards found by several queries rise to the
+// top. Cards with the same score keep the order they were first seen in.
+func FuseRankings(rankings [][]int32) []int32 {
+	scores := FusionScores(rankings)
+	seen := map[int32]bool{}
+	var order []int32
+	for _, ranking := range rankings {
+		for _, id := range ranking {
+			if !seen[id] {
+				seen[id] = true
+				order = append(order, id)
+			}
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	return order
+}
+
+// FusionScores returns the reciprocal rank fusion score of each card in rankings, the
+// sum of 1/(60+rank) over the rankings it is in
+func FusionScores(rankings [][]int32) map[int32]float64 {
+	scores := map[int32]float64{}
+	for _, ranking := range rankings {
+		for rank, id := range ranking {
+			scores[id] += 1 / float64(fusionK+rank+1)
+		}
+	}
+	return scores
+}
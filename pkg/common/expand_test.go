@@ -0,0 +1,88 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestExpandQuery tests the ExpandQuery function with a mocked chat completions API
+func TestExpandQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		if len(reqBody.Messages) != 2 || !strings.HasSuffix(reqBody.Messages[1].Content, "mobility") {
+			t.Errorf("Expected the query in the user message, got %v", reqBody.Messages)
+		}
+
+		// The model numbers its lines, repeats the query and suggests one query too many
+		reply := "1. urban transportation\n2. \"Mobility\"\n\n- 移動手段\n3. commuting\n4. transit planning\n"
+		content, _ := json.Marshal(reply)
+		w.Write([]byte(`{"choices":[{"message":{"content":` + string(content) + `},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	originalHTTPNewRequest := httpNewRequest
+	defer func() {
+		httpNewRequest = originalHTTPNewRequest
+	}()
+
+	httpNewRequest = func(method, url string, body io.Reader) (*http.Request, error) {
+		return http.NewRequest(method, server.URL, body)
+	}
+
+	client := &OpenAIClient{ApiKey: "test-key", Model: "test-model"}
+	queries, err := client.ExpandQuery("mobility")
+	if err != nil {
+		t.Fatalf("ExpandQuery returned an error: %v", err)
+	}
+
+	expected := []string{"mobility", "urban transportation", "移動手段", "commuting"}
+	if strings.Join(queries, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, queries)
+	}
+}
+
+// TestFuseRankings tests the FuseRankings function
+func TestFuseRankings(t *testing.T) {
+	// Card 3 is second in every ranking, so it beats cards that are first only once
+	fused := FuseRankings([][]int32{
+		{1, 3, 5},
+		{2, 3},
+		{4, 3, 1},
+	})
+
+	expected := []int32{3, 1, 2, 4, 5}
+	if len(fused) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, fused)
+	}
+	for i := range expected {
+		if fused[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, fused)
+			break
+		}
+	}
+
+	if fused := FuseRankings(nil); len(fused) != 0 {
+		t.Errorf("Expected no cards without rankings, got %v", fused)
+	}
+}
+
+// TestFusionScores tests that a card scores in every ranking it is in
+func TestFusionScores(t *testing.T) {
+	scores := FusionScores([][]int32{{1, 3}, {3}})
+	if expected := 1.0/62 + 1.0/61; math.Abs(scores[3]-expected) > 1e-12 {
+		t.Errorf("Expected card 3 to score %f, got %f", expected, scores[3])
+	}
+	if expected := 1.0 / 61; math.Abs(scores[1]-expected) > 1e-12 {
+		t.Errorf("Expected card 1 to score %f, got %f", expected, scores[1])
+	}
+}
@@ -0,0 +1,311 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png" // Import png decoder
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nfnt/resize"
+)
+
+// visionRequest represents a request to the OpenAI API for vision
+type visionRequest struct {
+	Model       string          `json:"model"`
+	Messages    []visionMessage `json:"messages"`
+	MaxTokens   int             `json:"max_tokens"`
+	Temperature *float64        `json:"temperature,omitempty"`
+}
+
+// visionMessage represents a message in the vision request
+type visionMessage struct {
+	Role    string          `json:"role"`
+	Content []visionContent `json:"content"`
+}
+
+// visionContent represents content in a message
+type visionContent struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *visionImageURL `json:"image_url,omitempty"`
+}
+
+// visionImageURL represents an image URL in content
+type visionImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail"`
+}
+
+// visionResponse represents a response from the OpenAI API for vision
+type visionResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+// Ocr2mdModel is the model used to convert OCR results to markdown
+const Ocr2mdModel = "o1-mini"
+
+// ExtractMarkdown extracts the content of a card image as markdown.
+// Parameters:
+//
+//	filePath    - The path of the image.
+//	method      - ocr (Azure OCR), mistral (Mistral OCR) or vision (OpenAI caption).
+//	language    - The language of the text, only used by the ocr method.
+//	openaiKey   - The OpenAI API key used to format the result.
+//	handwriting - Use settings tuned for handwritten cards. The vision method then
+//	              transcribes the card instead of describing it.
+//	live        - Where the markdown converted from the OCR result is written as it is
+//	              generated, or nil.
+//
+// Returns:
+//
+//	The markdown content, the OCR result the markdown was converted from
+//	(empty for the vision method) and an error if any occurred.
+func ExtractMarkdown(filePath string, method Method, language, openaiKey string, handwriting bool, live io.Writer) (string, string, error) {
+	if method == MethodVision {
+		if handwriting {
+			md, err := transcribeWithVision(filePath, openaiKey)
+			return md, "", err
+		}
+		md, err := captionWithVision(filePath, openaiKey)
+		return md, "", err
+	}
+
+	ocrResult, err := RunOCR(filePath, method, language, handwriting)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Convert OCR result to markdown
+	md, err := ConvertOCR(openaiKey, Ocr2mdModel, ocrResult, handwriting, live)
+	if err != nil {
+		return "", "", fmt.Errorf("error creating markdown from OCR result: %w", err)
+	}
+
+	return md, ocrResult, nil
+}
+
+// RunOCR extracts the text of an image with the OCR provider of a method,
+// returning an OCRResult in JSON for Azure and the markdown for Mistral.
+// Parameters:
+//
+//	filePath    - The path of the image.
+//	method      - ocr (Azure OCR) or mistral (Mistral OCR).
+//	language    - The language of the text, only used by the ocr method.
+//	handwriting - Use settings tuned for handwriting, only used by the ocr method.
+func RunOCR(filePath string, method Method, language string, handwriting bool) (result string, err error) {
+	span := StartSpan("ocr", "ocr.method", method.String())
+	start := time.Now()
+	defer func() {
+		span.End(err)
+		ObserveDuration("ume_ocr_duration_seconds", "Duration of OCR requests.", time.Since(start), "method", method.String(), "result", metricResult(err))
+	}()
+
+	switch method {
+	case MethodOCR:
+		ocrResult, err := AzureOCR(filePath, language, handwriting)
+		if err != nil {
+			return "", fmt.Errorf("error processing image with Azure OCR: %w", err)
+		}
+		return ocrResult, nil
+	case MethodMistral:
+		ocrResult, err := MistralOCR(filePath)
+		if err != nil {
+			return "", fmt.Errorf("error processing image with Mistral OCR: %w", err)
+		}
+		return ocrResult, nil
+	default:
+		return "", fmt.Errorf("method %s doesn't run OCR", method)
+	}
+}
+
+// ConvertOCR converts an OCR result to markdown, with the handwriting prompt if set.
+// Azure results are sent as plain text lines rather than JSON to save prompt tokens.
+// The markdown is written to live as it is generated, unless live is nil.
+// OCR text over Ocr2mdTokenBudget is converted in sections, each told the headings it
+// continues under, and the markdown of the sections is joined.
+func ConvertOCR(openaiKey, model, ocrResult string, handwriting bool, live io.Writer) (md string, err error) {
+	prompt := ocr2mdPrompt
+	if handwriting {
+		prompt = handwritingOcr2mdPrompt
+	}
+
+	sections := SplitByTokens(OCRPromptText(ocrResult), Ocr2mdTokenBudget)
+	span := StartSpan("ocr2md", "openai.model", model, "ocr2md.sections", strconv.Itoa(len(sections)))
+	defer func() { span.End(err) }()
+
+	if len(sections) == 1 {
+		return ocr2md(openaiKey, model, prompt, sections[0], live)
+	}
+
+	var parts []string
+	for i, section := range sections {
+		sectionPrompt := prompt
+		if i > 0 {
+			sectionPrompt = continuationPrompt(i+1, len(sections), HeadingPath(strings.Join(parts, "\n\n"))) + prompt
+			if live != nil {
+				io.WriteString(live, "\n\n")
+			}
+		}
+
+		md, err := ocr2md(openaiKey, model, sectionPrompt, section, live)
+		if err != nil {
+			return "", fmt.Errorf("error converting section %d of %d: %w", i+1, len(sections), err)
+		}
+		parts = append(parts, strings.TrimSpace(md))
+	}
+
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// continuationPrompt tells the model which part of a long OCR result it converts, and the
+// headings the markdown so far ends under so it continues at the same levels
+func continuationPrompt(part, total int, headings []string) string {
+	prompt := fmt.Sprintf("The OCR result is too long to convert at once, this is part %d of %d. Do not add a title for this part. ", part, total)
+	if len(headings) > 0 {
+		prompt += "The markdown of the previous parts ends under these headings:\n\n" + strings.Join(headings, "\n") + "\n\nDo not repeat them, continue the text under the last one and keep the heading levels consistent with them. "
+	}
+	return prompt
+}
+
+// captionWithVision describes an image using OpenAI's Vision API
+func captionWithVision(filePath string, apiKey string) (string, error) {
+	base64Img, err := encodeImageForVision(filePath, 1024, 512)
+	if err != nil {
+		return "", err
+	}
+
+	prompt := "This is a image that is either a diagram, graph, chart or table. Explain what this visualization is and the insights. Output only the results as a complete paragraph, so this could be used as an caption."
+	return visionCompletion(apiKey, "gpt-4o-mini", prompt, base64Img, 300, nil)
+}
+
+// transcribeWithVision transcribes a handwritten card to markdown using OpenAI's Vision API.
+// A low temperature keeps the model from making up words it can't read.
+func transcribeWithVision(filePath string, apiKey string) (string, error) {
+	base64Img, err := encodeImageForVision(filePath, 2048, 2048)
+	if err != nil {
+		return "", err
+	}
+
+	prompt := "Transcribe the handwritten notes in this image into Markdown. Keep the wording of the notes, use headings, lists and tables where the notes have them. When a word is uncertain write your best reading followed by [?], or write [?] alone if it can't be read at all. Output only the Markdown without any additional explanation or code block."
+	temperature := 0.0
+	return visionCompletion(apiKey, "gpt-4o", prompt, base64Img, 4096, &temperature)
+}
+
+// encodeImageForVision resizes an image to fit within maxWidth x maxHeight, keeping the
+// aspect ratio, and encodes it as base64 JPEG for the Vision API
+func encodeImageForVision(filePath string, maxWidth, maxHeight uint) (string, error) {
+	// Open the image file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open image file: %w", err)
+	}
+	defer file.Close()
+
+	// Decode the image
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	// Resize the image to fit within maxWidth x maxHeight while maintaining aspect ratio
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var newWidth, newHeight uint
+
+	if width > height { // Landscape orientation
+		newWidth = maxWidth
+		newHeight = uint(float64(height) * (float64(maxWidth) / float64(width)))
+	} else { // Portrait or square orientation
+		newHeight = maxHeight
+		newWidth = uint(float64(width) * (float64(maxHeight) / float64(height)))
+	}
+
+	resizedImg := resize.Resize(newWidth, newHeight, img, resize.Lanczos3)
+
+	// Convert image to base64
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, resizedImg, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode image to JPEG: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// visionCompletion sends a prompt with a base64 JPEG image to OpenAI's Vision API.
+// If temperature is nil the API's default is used.
+func visionCompletion(apiKey, model, prompt, base64Img string, maxTokens int, temperature *float64) (string, error) {
+	// Create the request to OpenAI API
+	reqBody := visionRequest{
+		Model: model,
+		Messages: []visionMessage{
+			{
+				Role: "user",
+				Content: []visionContent{
+					{
+						Type: "text",
+						Text: prompt,
+					},
+					{
+						Type: "image_url",
+						ImageURL: &visionImageURL{
+							URL:    fmt.Sprintf("data:image/jpeg;base64,%s", base64Img),
+							Detail: "high",
+						},
+					},
+				},
+			},
+		},
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+	}
+
+	jsonReqBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	// Make the API request
+	req, err := OpenAIEndpointFor(OpenAIVision).newRequest("chat/completions", model, apiKey, bytes.NewBuffer(jsonReqBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	ctx, cancel := CallContext()
+	defer cancel()
+	resp, err := HTTPClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", &ProviderError{Provider: "OpenAI", Err: err}
+	}
+	defer resp.Body.Close()
+
+	// Parse the response
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError("OpenAI", resp)
+	}
+
+	var openAIResp visionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Get the result
+	if len(openAIResp.Choices) > 0 {
+		return openAIResp.Choices[0].Message.Content, nil
+	}
+
+	return "", fmt.Errorf("no content in the Vision API response")
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DefaultOpenAIBaseURL is the API OpenAI requests are sent to unless OPENAI_BASE_URL is set
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// Purposes of OpenAI requests, which can be sent to their own endpoint with
+// OPENAI_<PURPOSE>_BASE_URL
+const (
+	OpenAIChat       = "CHAT"
+	OpenAIEmbeddings = "EMBEDDINGS"
+	OpenAIVision     = "VISION"
+)
+
+// OpenAIEndpoint is an OpenAI compatible API: OpenAI itself, a gateway like LiteLLM or
+// vLLM, or Azure OpenAI
+type OpenAIEndpoint struct {
+	// BaseURL is the URL the API paths are appended to, DefaultOpenAIBaseURL if empty
+	BaseURL string
+	// APIVersion is the api-version of Azure OpenAI. When it is set the model is the name
+	// of a deployment, which is part of the URL, and the key is sent in the api-key header.
+	APIVersion string
+}
+
+// OpenAIEndpointFor returns the endpoint requests for a purpose are sent to. It is
+// OPENAI_<PURPOSE>_BASE_URL and OPENAI_<PURPOSE>_API_VERSION if the URL is set, and
+// OPENAI_BASE_URL and OPENAI_API_VERSION otherwise.
+func OpenAIEndpointFor(purpose string) OpenAIEndpoint {
+	if baseURL := os.Getenv("OPENAI_" + purpose + "_BASE_URL"); baseURL != "" {
+		return OpenAIEndpoint{BaseURL: baseURL, APIVersion: os.Getenv("OPENAI_" + purpose + "_API_VERSION")}
+	}
+	return OpenAIEndpoint{BaseURL: os.Getenv("OPENAI_BASE_URL"), APIVersion: os.Getenv("OPENAI_API_VERSION")}
+}
+
+// URL returns the URL of an API path, like chat/completions, for a model
+func (e OpenAIEndpoint) URL(path, model string) string {
+	base := strings.TrimSuffix(e.BaseURL, "/")
+	if base == "" {
+		base = DefaultOpenAIBaseURL
+	}
+	if e.APIVersion == "" {
+		return base + "/" + path
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s", base, url.PathEscape(model), path, url.QueryEscape(e.APIVersion))
+}
+
+// newRequest creates a request posting JSON to an API path for a model, authorized with key
+func (e OpenAIEndpoint) newRequest(path, model, key string, body io.Reader) (*http.Request, error) {
+	req, err := httpNewRequest("POST", e.URL(path, model), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIVersion != "" {
+		req.Header.Set("api-key", key)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	return req, nil
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of edges between cards in a graph
+const (
+	EdgeLink    = "link"    // the source card links to the target card
+	EdgeSimilar = "similar" // the embeddings of the cards are similar
+)
+
+// GraphNode is a card in a graph
+type GraphNode struct {
+	ID    int32  `json:"id"`
+	Title string `json:"title"`
+}
+
+// GraphEdge is a relationship between two cards in a graph. Weight is the similarity of
+// the cards for similar edges and 1 for links.
+type GraphEdge struct {
+	Source int32   `json:"source"`
+	Target int32   `json:"target"`
+	Kind   string  `json:"kind"`
+	Weight float64 `json:"weight"`
+}
+
+// Graph holds cards and the relationships between them
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Isolated returns the nodes that have no edges
+func (g Graph) Isolated() []GraphNode {
+	connected := make(map[int32]bool)
+	for _, edge := range g.Edges {
+		connected[edge.Source] = true
+		connected[edge.Target] = true
+	}
+
+	var isolated []GraphNode
+	for _, node := range g.Nodes {
+		if !connected[node.ID] {
+			isolated = append(isolated, node)
+		}
+	}
+	return isolated
+}
+
+// DOT returns the graph in the DOT language of Graphviz. Links are drawn as arrows and
+// similar cards are joined by dashed lines, thicker the more similar they are.
+func (g Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph cards {\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "  %d [label=%s];\n", node.ID, dotQuote(fmt.Sprintf("%d. %s", node.ID, node.Title)))
+	}
+	for _, edge := range g.Edges {
+		if edge.Kind == EdgeSimilar {
+			fmt.Fprintf(&b, "  %d -> %d [dir=none, style=dashed, penwidth=%.2f, label=\"%.2f\"];\n",
+				edge.Source, edge.Target, 1+2*edge.Weight, edge.Weight)
+			continue
+		}
+		fmt.Fprintf(&b, "  %d -> %d;\n", edge.Source, edge.Target)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote quotes a string as a DOT identifier
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", " ")
+	return `"` + s + `"`
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestGraphDOT tests the DOT method of Graph
+func TestGraphDOT(t *testing.T) {
+	graph := Graph{
+		Nodes: []GraphNode{{ID: 1, Title: `Say "hi"`}, {ID: 2, Title: "Cards"}},
+		Edges: []GraphEdge{
+			{Source: 1, Target: 2, Kind: EdgeLink, Weight: 1},
+			{Source: 1, Target: 2, Kind: EdgeSimilar, Weight: 0.5},
+		},
+	}
+
+	expected := "digraph cards {\n" +
+		"  node [shape=box];\n" +
+		"  1 [label=\"1. Say \\\"hi\\\"\"];\n" +
+		"  2 [label=\"2. Cards\"];\n" +
+		"  1 -> 2;\n" +
+		"  1 -> 2 [dir=none, style=dashed, penwidth=2.00, label=\"0.50\"];\n" +
+		"}\n"
+	if dot := graph.DOT(); dot != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, dot)
+	}
+}
+
+// TestGraphIsolated tests the Isolated method of Graph
+func TestGraphIsolated(t *testing.T) {
+	graph := Graph{
+		Nodes: []GraphNode{{ID: 1}, {ID: 2}, {ID: 3}},
+		Edges: []GraphEdge{{Source: 2, Target: 1, Kind: EdgeLink, Weight: 1}},
+	}
+
+	isolated := graph.Isolated()
+	if len(isolated) != 1 || isolated[0].ID != 3 {
+		t.Errorf("Expected only card 3 to be isolated, got %v", isolated)
+	}
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultHTTPTimeout limits a whole request to an external service, including reading a
+// streamed response, unless UME_HTTP_TIMEOUT is set
+const DefaultHTTPTimeout = 10 * time.Minute
+
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+// Offline is set by the global --offline flag or UME_OFFLINE. Only the database is used
+// then, and every request to an external service fails with ErrOffline without being sent.
+var Offline bool
+
+// HTTPClient returns the client requests to external services are sent with. It is
+// configured once from the environment: requests go through the proxy in HTTPS_PROXY
+// or HTTP_PROXY, except for the hosts in NO_PROXY, and servers are also trusted when
+// their certificate is signed by the CA in UME_CA_CERT, for self-hosted Minio or LLM
+// gateways. A configuration that can't be read fails every request with its error, and
+// Offline fails them with ErrOffline.
+func HTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		httpClient = newHTTPClient()
+	})
+	return httpClient
+}
+
+// newHTTPClient creates the client HTTPClient returns
+func newHTTPClient() *http.Client {
+	timeout := DefaultHTTPTimeout
+	if value := os.Getenv("UME_HTTP_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return &http.Client{Transport: errTransport{fmt.Errorf("UME_HTTP_TIMEOUT must be a duration like 5m, got %q", value)}}
+		}
+		timeout = parsed
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	if path := os.Getenv("UME_CA_CERT"); path != "" {
+		pool, err := certPool(path)
+		if err != nil {
+			return &http.Client{Transport: errTransport{err}}
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: offlineTransport{transport}, Timeout: timeout}
+}
+
+// certPool returns the system certificates with the PEM certificates in a file added
+func certPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading UME_CA_CERT: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in UME_CA_CERT %s", path)
+	}
+	return pool, nil
+}
+
+// errTransport fails every request with an error in the configuration of the client
+type errTransport struct {
+	err error
+}
+
+// RoundTrip returns the error of the configuration
+func (t errTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// offlineTransport fails every request while Offline is set, and sends them otherwise
+type offlineTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends the request unless ume is offline
+func (t offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Offline {
+		return nil, fmt.Errorf("%w: not contacting %s", ErrOffline, req.URL.Host)
+	}
+	return t.base.RoundTrip(req)
+}
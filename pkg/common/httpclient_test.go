@@ -0,0 +1,73 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestNewHTTPClient tests that the client is configured from the environment
+func TestNewHTTPClient(t *testing.T) {
+	t.Setenv("UME_HTTP_TIMEOUT", "")
+	t.Setenv("UME_CA_CERT", "")
+
+	client := newHTTPClient()
+	if client.Timeout != DefaultHTTPTimeout {
+		t.Errorf("Expected the default timeout, got %v", client.Timeout)
+	}
+	offline, ok := client.Transport.(offlineTransport)
+	transport, _ := offline.base.(*http.Transport)
+	if !ok || transport == nil || transport.Proxy == nil || !transport.ForceAttemptHTTP2 {
+		t.Errorf("Expected a transport with a proxy and HTTP/2, got %#v", client.Transport)
+	}
+
+	t.Setenv("UME_HTTP_TIMEOUT", "30s")
+	if client := newHTTPClient(); client.Timeout != 30*time.Second {
+		t.Errorf("Expected a timeout of 30s, got %v", client.Timeout)
+	}
+
+	// A CA that can't be read fails the requests instead of being ignored
+	t.Setenv("UME_CA_CERT", filepath.Join(t.TempDir(), "missing.pem"))
+	req, _ := http.NewRequest("GET", "https://example.com", nil)
+	if _, err := newHTTPClient().Do(req); err == nil {
+		t.Error("Expected error for a missing CA certificate, got nil")
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	os.WriteFile(invalid, []byte("not a certificate"), 0644)
+	t.Setenv("UME_CA_CERT", invalid)
+	if _, err := newHTTPClient().Do(req); err == nil {
+		t.Error("Expected error for a file without certificates, got nil")
+	}
+}
+
+// TestOfflineTransport tests that no request is sent offline
+func TestOfflineTransport(t *testing.T) {
+	sent := false
+	client := &http.Client{Transport: offlineTransport{roundTripFunc(func(*http.Request) (*http.Response, error) {
+		sent = true
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})}}
+
+	Offline = true
+	defer func() { Offline = false }()
+	if _, err := client.Get("https://api.openai.com/v1/embeddings"); !errors.Is(err, ErrOffline) || sent {
+		t.Errorf("Expected ErrOffline without sending the request, got %v, sent %v", err, sent)
+	}
+
+	Offline = false
+	if _, err := client.Get("https://api.openai.com/v1/embeddings"); err != nil || !sent {
+		t.Errorf("Expected the request to be sent online, got %v, sent %v", err, sent)
+	}
+}
+
+// roundTripFunc is a transport answering requests with a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls the function
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// localeFS holds the message catalogs, one JSON object of message IDs and translations
+// per language, like locales/ja.json
+//
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// DefaultLanguage is the language of the messages in the code, used when no catalog
+// matches the language of the user
+const DefaultLanguage = "en"
+
+// Message is a message of the CLI, in the style of go-i18n: its ID is looked up in the
+// catalog of the language of the user, and Other is the English message used when the
+// catalog doesn't have it. Both are formats of fmt.Sprintf.
+type Message struct {
+	ID    string
+	Other string
+}
+
+// catalogs are the translations of the messages by language
+var catalogs = loadCatalogs()
+
+// loadCatalogs reads the embedded message catalogs
+func loadCatalogs() map[string]map[string]string {
+	catalogs := map[string]map[string]string{}
+	files, _ := fs.Glob(localeFS, "locales/*.json")
+	for _, file := range files {
+		data, err := localeFS.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			continue
+		}
+		catalogs[strings.TrimSuffix(path.Base(file), ".json")] = messages
+	}
+	return catalogs
+}
+
+// Language returns the language of the CLI: UME_LANG, or the language of the locale in
+// LC_ALL, LC_MESSAGES or LANG, like ja for ja_JP.UTF-8. It is DefaultLanguage when none
+// is set, or there is no catalog for it.
+func Language() string {
+	for _, name := range []string{"UME_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		language := strings.ToLower(value)
+		if i := strings.IndexAny(language, "_.@-"); i >= 0 {
+			language = language[:i]
+		}
+		if _, ok := catalogs[language]; ok {
+			return language
+		}
+		return DefaultLanguage
+	}
+	return DefaultLanguage
+}
+
+// T returns a message in the language of the user, formatted with args
+func T(m Message, args ...any) string {
+	format := m.Other
+	if translated, ok := catalogs[Language()][m.ID]; ok {
+		format = translated
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
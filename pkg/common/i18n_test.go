@@ -0,0 +1,60 @@
+package common
+
+import "testing"
+
+func TestLanguage(t *testing.T) {
+	tests := []struct {
+		umeLang, lcAll, lang string
+		expected             string
+	}{
+		{"", "", "", "en"},
+		{"ja", "", "", "ja"},
+		{"", "", "ja_JP.UTF-8", "ja"},
+		{"", "ja_JP", "en_US.UTF-8", "ja"},
+		{"en", "", "ja_JP.UTF-8", "en"},
+		{"fr", "", "ja_JP.UTF-8", "en"},
+		{"", "C", "", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("UME_LANG", tt.umeLang)
+		t.Setenv("LC_ALL", tt.lcAll)
+		t.Setenv("LC_MESSAGES", "")
+		t.Setenv("LANG", tt.lang)
+		if language := Language(); language != tt.expected {
+			t.Errorf("Expected %q for UME_LANG=%q LC_ALL=%q LANG=%q, got %q", tt.expected, tt.umeLang, tt.lcAll, tt.lang, language)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if len(catalogs["ja"]) == 0 {
+		t.Fatal("Expected the Japanese catalog to be loaded")
+	}
+
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "")
+
+	created := Message{ID: "upload.created_card", Other: "Created new card with ID: %d"}
+
+	t.Setenv("UME_LANG", "en")
+	if msg := T(created, 12); msg != "Created new card with ID: 12" {
+		t.Errorf("Expected the English message, got %q", msg)
+	}
+
+	t.Setenv("UME_LANG", "ja")
+	if msg := T(created, 12); msg != "ID 12 のカードを作成しました" {
+		t.Errorf("Expected the Japanese message, got %q", msg)
+	}
+
+	// Test that a message missing from the catalog falls back to English
+	if msg := T(Message{ID: "test.missing", Other: "%d%% done"}, 50); msg != "50% done" {
+		t.Errorf("Expected the English message, got %q", msg)
+	}
+
+	// Test that a message without arguments isn't formatted
+	if msg := T(Message{ID: "test.missing", Other: "100%"}); msg != "100%" {
+		t.Errorf("Expected the message as it is, got %q", msg)
+	}
+}
@@ -0,0 +1,245 @@
+package common
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ImportedPage is a page of an export from another note app, converted to markdown
+type ImportedPage struct {
+	// ExternalID identifies the page across exports, like notion:<page id>, so importing
+	// a newer export updates the cards instead of duplicating them
+	ExternalID string
+	Title      string
+	Content    string
+}
+
+// notionIDRe matches the page ID Notion appends to the names of exported files
+var notionIDRe = regexp.MustCompile(`\s+([0-9a-f]{32})$`)
+
+// ReadNotionExport reads the pages of a Notion "Markdown & CSV" export. Large exports
+// are split into zips inside the zip, which are read too. Databases exported as CSV and
+// attachments are not imported.
+func ReadNotionExport(zipPath string) ([]ImportedPage, error) {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", zipPath, err)
+	}
+	defer r.Close()
+
+	pages, err := readNotionZip(&r.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sortPages(pages)
+	return pages, nil
+}
+
+// readNotionZip reads the markdown pages of a Notion export and of the zips inside it
+func readNotionZip(r *zip.Reader) ([]ImportedPage, error) {
+	var pages []ImportedPage
+	for _, f := range r.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		if ext != ".md" && ext != ".zip" {
+			continue
+		}
+
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		if ext == ".zip" {
+			inner, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				return nil, fmt.Errorf("error opening %s: %w", f.Name, err)
+			}
+			innerPages, err := readNotionZip(inner)
+			if err != nil {
+				return nil, err
+			}
+			pages = append(pages, innerPages...)
+			continue
+		}
+
+		name := strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))
+		page := ImportedPage{
+			ExternalID: "notion:" + strings.TrimSuffix(f.Name, path.Ext(f.Name)),
+			Title:      name,
+			Content:    string(data),
+		}
+		if m := notionIDRe.FindStringSubmatch(name); m != nil {
+			page.ExternalID = "notion:" + m[1]
+			page.Title = strings.TrimSpace(name[:len(name)-len(m[0])])
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// ReadGoogleDocsExport reads the documents of a Google Drive download or a Takeout
+// export. Google Docs exported as Word documents are converted to markdown, and
+// markdown and text files are read as they are. Documents are identified by their path
+// in the export, as Drive doesn't include their IDs.
+func ReadGoogleDocsExport(zipPath string) ([]ImportedPage, error) {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", zipPath, err)
+	}
+	defer r.Close()
+
+	var pages []ImportedPage
+	for _, f := range r.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		if ext != ".docx" && ext != ".md" && ext != ".txt" {
+			continue
+		}
+
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		content := string(data)
+		if ext == ".docx" {
+			content, err = DocxMarkdown(data)
+			if err != nil {
+				return nil, fmt.Errorf("error converting %s: %w", f.Name, err)
+			}
+		}
+
+		pages = append(pages, ImportedPage{
+			ExternalID: "gdocs:" + strings.TrimSuffix(f.Name, path.Ext(f.Name)),
+			Title:      strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name)),
+			Content:    content,
+		})
+	}
+	sortPages(pages)
+	return pages, nil
+}
+
+// sortPages orders pages by external ID, so imports are reproducible
+func sortPages(pages []ImportedPage) {
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].ExternalID < pages[j].ExternalID
+	})
+}
+
+// readZipFile reads a file of a zip
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", f.Name, err)
+	}
+	return data, nil
+}
+
+// DocxMarkdown converts the text of a Word document to markdown. Titles and headings
+// become markdown headings and list paragraphs become list items. Formatting, tables
+// and images are dropped.
+func DocxMarkdown(data []byte) (string, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("error opening document: %w", err)
+	}
+
+	var document *zip.File
+	for _, f := range r.File {
+		if f.Name == "word/document.xml" {
+			document = f
+		}
+	}
+	if document == nil {
+		return "", fmt.Errorf("word/document.xml not found")
+	}
+
+	rc, err := document.Open()
+	if err != nil {
+		return "", fmt.Errorf("error opening word/document.xml: %w", err)
+	}
+	defer rc.Close()
+
+	var paragraphs []string
+	var text strings.Builder
+	var style string
+	var list, inText bool
+
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error parsing word/document.xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				text.Reset()
+				style, list = "", false
+			case "pStyle":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "val" {
+						style = attr.Value
+					}
+				}
+			case "numPr":
+				list = true
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if line := strings.TrimSpace(text.String()); line != "" {
+					paragraphs = append(paragraphs, docxPrefix(style, list)+line)
+				}
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+
+	if len(paragraphs) == 0 {
+		return "", nil
+	}
+	return strings.Join(paragraphs, "\n\n") + "\n", nil
+}
+
+// docxPrefix returns the markdown that starts a paragraph with a Word style
+func docxPrefix(style string, list bool) string {
+	if style == "Title" {
+		return "# "
+	}
+	if level, ok := strings.CutPrefix(style, "Heading"); ok && len(level) == 1 && level[0] >= '1' && level[0] <= '5' {
+		return strings.Repeat("#", int(level[0]-'0')+1) + " "
+	}
+	if list {
+		return "- "
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeZip writes files to a zip and returns its contents
+func writeZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Error creating %s: %v", name, err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Error closing zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestReadNotionExport tests that pages are read with their Notion IDs, also from zips inside the export
+func TestReadNotionExport(t *testing.T) {
+	inner := writeZip(t, map[string]string{
+		"Workspace/Reading list 0123456789abcdef0123456789abcdef.md": "# Reading list\n\nUmesao",
+	})
+	path := filepath.Join(t.TempDir(), "export.zip")
+	os.WriteFile(path, writeZip(t, map[string]string{
+		"Ideas 11111111111111111111111111111111.md":        "# Ideas\n\nCards",
+		"Ideas/Tasks 22222222222222222222222222222222.csv": "Name,Done",
+		"Part-2.zip": string(inner),
+	}), 0644)
+
+	pages, err := ReadNotionExport(path)
+	if err != nil {
+		t.Fatalf("ReadNotionExport returned an error: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %+v", pages)
+	}
+	if pages[0].ExternalID != "notion:0123456789abcdef0123456789abcdef" || pages[0].Title != "Reading list" {
+		t.Errorf("Expected the page of the inner zip with its ID and title, got %+v", pages[0])
+	}
+	if pages[1].ExternalID != "notion:11111111111111111111111111111111" || pages[1].Content != "# Ideas\n\nCards" {
+		t.Errorf("Expected the page with its ID and content, got %+v", pages[1])
+	}
+}
+
+// TestReadGoogleDocsExport tests that Word documents are converted and identified by their path
+func TestReadGoogleDocsExport(t *testing.T) {
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Notes</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Cards</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">One idea </w:t></w:r><w:r><w:t>per card.</w:t></w:r></w:p>
+<w:p></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>Write</w:t></w:r></w:p>
+</w:body></w:document>`
+	docx := writeZip(t, map[string]string{"word/document.xml": document})
+
+	path := filepath.Join(t.TempDir(), "takeout.zip")
+	os.WriteFile(path, writeZip(t, map[string]string{
+		"Takeout/Drive/Notes.docx": string(docx),
+		"Takeout/Drive/todo.txt":   "milk",
+		"Takeout/Drive/photo.jpg":  "",
+	}), 0644)
+
+	pages, err := ReadGoogleDocsExport(path)
+	if err != nil {
+		t.Fatalf("ReadGoogleDocsExport returned an error: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %+v", pages)
+	}
+
+	expected := "# Notes\n\n## Cards\n\nOne idea per card.\n\n- Write\n"
+	if pages[0].ExternalID != "gdocs:Takeout/Drive/Notes" || pages[0].Title != "Notes" || pages[0].Content != expected {
+		t.Errorf("Expected the converted document, got %+v", pages[0])
+	}
+	if pages[1].ExternalID != "gdocs:Takeout/Drive/todo" || pages[1].Content != "milk" {
+		t.Errorf("Expected the text file as it is, got %+v", pages[1])
+	}
+}
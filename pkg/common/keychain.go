@@ -0,0 +1,70 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+// keychainService is the service the secrets of ume are stored under in the OS keychain
+const keychainService = "ume"
+
+// SecretNames are the environment variables that can be stored in the OS keychain
+// instead of the environment or .env
+var SecretNames = []string{
+	"OPENAI_KEY",
+	"AZURE_KEY",
+	"MISTRAL_KEY",
+	"MINIO_USER",
+	"MINIO_PASSWORD",
+	"UME_ENCRYPTION_KEY",
+	"UME_SYNC_KEY",
+}
+
+// keychainGet reads a secret from the OS keychain, replaced in tests
+var keychainGet = getKeychainSecret
+
+// Secret returns the value of an environment variable, or the secret stored under its
+// name in the OS keychain when it is not set and is one of SecretNames. A keychain that
+// can't be read is treated as empty, so the usual "not set" errors are reported.
+func Secret(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	if !slices.Contains(SecretNames, name) {
+		return ""
+	}
+
+	value, err := keychainGet(name)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// SetSecret stores a secret in the OS keychain under the name of its environment variable
+func SetSecret(name, value string) error {
+	if !slices.Contains(SecretNames, name) {
+		return fmt.Errorf("%s can't be stored in the keychain, expected one of %v", name, SecretNames)
+	}
+	if value == "" {
+		return fmt.Errorf("the value of %s is empty", name)
+	}
+
+	if err := setKeychainSecret(name, value); err != nil {
+		return fmt.Errorf("error storing %s in the keychain: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteSecret removes a secret from the OS keychain
+func DeleteSecret(name string) error {
+	if !slices.Contains(SecretNames, name) {
+		return fmt.Errorf("%s can't be stored in the keychain, expected one of %v", name, SecretNames)
+	}
+
+	if err := deleteKeychainSecret(name); err != nil {
+		return fmt.Errorf("error removing %s from the keychain: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// getKeychainSecret reads a secret from the macOS Keychain
+func getKeychainSecret(name string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", name, "-w").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// setKeychainSecret stores a secret in the macOS Keychain, replacing the one stored before.
+// The value is given to security on its interactive prompt, so it doesn't show up in
+// process listings.
+func setKeychainSecret(name, value string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		keychainService, name, quoteSecurityArg(value)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// deleteKeychainSecret removes a secret from the macOS Keychain
+func deleteKeychainSecret(name string) error {
+	out, err := exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// quoteSecurityArg quotes an argument for the interactive mode of security
+func quoteSecurityArg(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestSecret tests that secrets are read from the environment before the keychain
+func TestSecret(t *testing.T) {
+	originalKeychainGet := keychainGet
+	originalKey := os.Getenv("MISTRAL_KEY")
+	defer func() {
+		keychainGet = originalKeychainGet
+		os.Setenv("MISTRAL_KEY", originalKey)
+	}()
+
+	var asked []string
+	keychainGet = func(name string) (string, error) {
+		asked = append(asked, name)
+		if name == "MISTRAL_KEY" {
+			return "from-keychain", nil
+		}
+		return "", fmt.Errorf("not found")
+	}
+
+	os.Setenv("MISTRAL_KEY", "from-env")
+	if value := Secret("MISTRAL_KEY"); value != "from-env" {
+		t.Errorf("Expected the environment to take precedence, got %q", value)
+	}
+
+	os.Unsetenv("MISTRAL_KEY")
+	if value := Secret("MISTRAL_KEY"); value != "from-keychain" {
+		t.Errorf("Expected the secret from the keychain, got %q", value)
+	}
+	if value, err := RequireEnvVar("MISTRAL_KEY"); value != "from-keychain" || err != nil {
+		t.Errorf("Expected RequireEnvVar to read the keychain, got %q, %v", value, err)
+	}
+
+	if value := Secret("UME_ENCRYPTION_KEY"); value != "" && os.Getenv("UME_ENCRYPTION_KEY") == "" {
+		t.Errorf("Expected a secret missing from the keychain to be empty, got %q", value)
+	}
+
+	// Only secrets are looked up in the keychain
+	asked = nil
+	os.Unsetenv("UME_TEST_NOT_A_SECRET")
+	if value := Secret("UME_TEST_NOT_A_SECRET"); value != "" || len(asked) != 0 {
+		t.Errorf("Expected other variables not to be read from the keychain, got %q from %v", value, asked)
+	}
+
+	if err := SetSecret("DB_STRING", "value"); err == nil {
+		t.Errorf("Expected an error when storing a variable that isn't a secret")
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !darwin && !windows
+
+package common
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// getKeychainSecret reads a secret from the Secret Service (GNOME Keyring, KWallet)
+// with secret-tool
+func getKeychainSecret(name string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keychainService, "account", name).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// setKeychainSecret stores a secret in the Secret Service, replacing the one stored before.
+// secret-tool reads the value from its standard input.
+func setKeychainSecret(name, value string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", keychainService+" "+name,
+		"service", keychainService, "account", name)
+	cmd.Stdin = strings.NewReader(value)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// deleteKeychainSecret removes a secret from the Secret Service
+func deleteKeychainSecret(name string) error {
+	out, err := exec.Command("secret-tool", "clear", "service", keychainService, "account", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+// credential is the CREDENTIALW structure of the Windows Credential Manager
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credentialTarget returns the name a secret is stored under in the Credential Manager
+func credentialTarget(name string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(keychainService + ":" + name)
+}
+
+// getKeychainSecret reads a secret from the Windows Credential Manager
+func getKeychainSecret(name string) (string, error) {
+	target, err := credentialTarget(name)
+	if err != nil {
+		return "", err
+	}
+
+	var cred *credential
+	ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ret == 0 {
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+// setKeychainSecret stores a secret in the Windows Credential Manager, replacing the one
+// stored before
+func setKeychainSecret(name, value string) error {
+	target, err := credentialTarget(name)
+	if err != nil {
+		return err
+	}
+	blob := []byte(value)
+
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		CredentialBlob:     &blob[0],
+		Persist:            credPersistLocalMachine,
+	}
+	ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
+
+// deleteKeychainSecret removes a secret from the Windows Credential Manager
+func deleteKeychainSecret(name string) error {
+	target, err := credentialTarget(name)
+	if err != nil {
+		return err
+	}
+
+	ret, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
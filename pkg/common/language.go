@@ -0,0 +1,140 @@
+package common
+
+import (
+	"strings"
+	"unicode"
+)
+
+// AutoLanguage lets the OCR provider detect the language of the text
+const AutoLanguage = "auto"
+
+// languageNames maps the detected language codes to their English names,
+// so they can be compared to languages given by name
+var languageNames = map[string]string{
+	"ja": "japanese",
+	"zh": "chinese",
+	"ko": "korean",
+	"ru": "russian",
+	"el": "greek",
+	"ar": "arabic",
+	"he": "hebrew",
+	"th": "thai",
+	"hi": "hindi",
+	"en": "english",
+	"de": "german",
+	"fr": "french",
+	"es": "spanish",
+	"it": "italian",
+	"pt": "portuguese",
+	"nl": "dutch",
+}
+
+// stopwords are frequent words used to tell languages written in the Latin script apart
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "ein", "ich", "zu"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "du", "pas", "pour"},
+	"es": {"el", "los", "las", "y", "es", "del", "que", "una", "por", "con"},
+	"it": {"il", "di", "che", "è", "gli", "della", "per", "non", "un", "sono"},
+	"pt": {"o", "os", "e", "do", "da", "não", "que", "uma", "para", "com"},
+	"nl": {"de", "het", "een", "en", "van", "is", "niet", "dat", "met", "voor"},
+}
+
+// DetectLanguage guesses the language of a text and returns its ISO 639-1 code,
+// or an empty string if it can't tell. The script of the letters decides most
+// languages, text in the Latin script is told apart by its most frequent words.
+func DetectLanguage(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			counts["kana"]++
+		case unicode.Is(unicode.Han, r):
+			counts["han"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+		case unicode.Is(unicode.Greek, r):
+			counts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["he"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["th"]++
+		case unicode.Is(unicode.Devanagari, r):
+			counts["hi"]++
+		case unicode.Is(unicode.Latin, r):
+			counts["latin"]++
+		}
+	}
+
+	if letters == 0 {
+		return ""
+	}
+
+	// Japanese mixes kana with kanji, Chinese uses only Han characters
+	if counts["kana"] > 0 && counts["kana"]+counts["han"] >= letters/4 {
+		return "ja"
+	}
+	if counts["han"] >= letters/4 && counts["han"] > 0 {
+		return "zh"
+	}
+
+	script, most := "", 0
+	for name, count := range counts {
+		if count > most || (count == most && name < script) {
+			script, most = name, count
+		}
+	}
+
+	switch script {
+	case "latin":
+		return detectLatinLanguage(text)
+	case "kana", "han":
+		return ""
+	default:
+		return script
+	}
+}
+
+// detectLatinLanguage guesses the language of a text in the Latin script by counting stopwords
+func detectLatinLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	best, bestCount := "", 0
+	for code, list := range stopwords {
+		count := 0
+		for _, word := range words {
+			for _, stopword := range list {
+				if word == stopword {
+					count++
+					break
+				}
+			}
+		}
+		if count > bestCount || (count == bestCount && count > 0 && code < best) {
+			best, bestCount = code, count
+		}
+	}
+
+	return best
+}
+
+// SameLanguage reports whether a detected language code and a language given by
+// code or English name, like "en" or "English", are the same language
+func SameLanguage(code, lang string) bool {
+	if code == "" {
+		return false
+	}
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	return lang == code || lang == languageNames[code]
+}
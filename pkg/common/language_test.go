@@ -0,0 +1,42 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestDetectLanguage tests the DetectLanguage function
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]string{
+		"今日は天気がいいので、散歩に行きました。":                      "ja",
+		"# 知的生産の技術\n\nカードに書く":                       "ja",
+		"我们今天去公园散步。":                                "zh",
+		"오늘은 날씨가 좋습니다.":                             "ko",
+		"Сегодня хорошая погода.":                   "ru",
+		"The weather is nice and it is sunny.":      "en",
+		"Das Wetter ist schön und ich gehe nicht.":  "de",
+		"Le temps est beau et les oiseaux chantent": "fr",
+		"12345 !!!": "",
+	}
+
+	for text, expected := range tests {
+		if lang := DetectLanguage(text); lang != expected {
+			t.Errorf("Expected '%s' for '%s', got: '%s'", expected, text, lang)
+		}
+	}
+}
+
+// TestSameLanguage tests the SameLanguage function
+func TestSameLanguage(t *testing.T) {
+	if !SameLanguage("en", "English") {
+		t.Error("Expected 'en' and 'English' to be the same language")
+	}
+	if !SameLanguage("ja", "ja") {
+		t.Error("Expected 'ja' and 'ja' to be the same language")
+	}
+	if SameLanguage("ja", "english") {
+		t.Error("Expected 'ja' and 'english' to be different languages")
+	}
+	if SameLanguage("", "") {
+		t.Error("Expected an unknown language to never match")
+	}
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cardLinkRe matches links to other cards written as [[card:123]], or with the UID of the
+// card as [[card:0190b4c8-...]] so the link stays valid on other instances
+var cardLinkRe = regexp.MustCompile(`\[\[card:(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})\]\]`)
+
+// ParseCardLinks returns the IDs of the cards linked by ID from markdown content, without duplicates
+func ParseCardLinks(content string) []int32 {
+	seen := make(map[int32]bool)
+	var ids []int32
+	for _, m := range cardLinkRe.FindAllStringSubmatch(content, -1) {
+		if IsCardUID(m[1]) {
+			continue
+		}
+		id, err := strconv.ParseInt(m[1], 10, 32)
+		if err != nil || seen[int32(id)] {
+			continue
+		}
+		seen[int32(id)] = true
+		ids = append(ids, int32(id))
+	}
+	return ids
+}
+
+// ParseCardLinkUIDs returns the UIDs of the cards linked by UID from markdown content, without duplicates
+func ParseCardLinkUIDs(content string) []string {
+	seen := make(map[string]bool)
+	var uids []string
+	for _, m := range cardLinkRe.FindAllStringSubmatch(content, -1) {
+		uid := strings.ToLower(m[1])
+		if !IsCardUID(uid) || seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+// LinkifyCardLinks rewrites [[card:123]] links into markdown links pointing to /card/123.
+// Links by UID point to /card/<uid> and are labelled with the start of the UID.
+func LinkifyCardLinks(content string) string {
+	return cardLinkRe.ReplaceAllStringFunc(content, func(match string) string {
+		return cardLinkMarkdown(cardLinkRe.FindStringSubmatch(match)[1])
+	})
+}
+
+// cardLinkMarkdown returns the markdown link a [[card:...]] link is rewritten into
+func cardLinkMarkdown(ref string) string {
+	if IsCardUID(ref) {
+		ref = strings.ToLower(ref)
+		return fmt.Sprintf("[card %s](/card/%s)", ref[:8], ref)
+	}
+	return fmt.Sprintf("[card %s](/card/%s)", ref, ref)
+}
+
+// LinkifiedOffset returns where a byte offset of content ends up after LinkifyCardLinks
+func LinkifiedOffset(content string, offset int) int {
+	shifted := offset
+	for _, m := range cardLinkRe.FindAllStringSubmatchIndex(content, -1) {
+		if m[1] > offset {
+			break
+		}
+		shifted += len(cardLinkMarkdown(content[m[2]:m[3]])) - (m[1] - m[0])
+	}
+	return shifted
+}
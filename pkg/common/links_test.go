@@ -0,0 +1,65 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseCardLinks tests the ParseCardLinks function
+func TestParseCardLinks(t *testing.T) {
+	content := "See [[card:12]] and [[card:3]].\n\nAlso [[card:12]] again, but not [[card:abc]] or [card:4]."
+	links := ParseCardLinks(content)
+
+	expected := []int32{12, 3}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("Expected links %v, got: %v", expected, links)
+	}
+
+	// Test without links
+	if links := ParseCardLinks("no links here"); len(links) != 0 {
+		t.Errorf("Expected no links, got: %v", links)
+	}
+}
+
+// TestLinkifyCardLinks tests the LinkifyCardLinks function
+func TestLinkifyCardLinks(t *testing.T) {
+	content := "See [[card:12]] for details."
+	expected := "See [card 12](/card/12) for details."
+
+	if linked := LinkifyCardLinks(content); linked != expected {
+		t.Errorf("Expected '%s', got: '%s'", expected, linked)
+	}
+}
+
+// TestLinkifiedOffset tests that offsets are moved past the links that were rewritten before them
+func TestLinkifiedOffset(t *testing.T) {
+	content := "See [[card:12]] for details."
+	linked := LinkifyCardLinks(content)
+
+	offset := strings.Index(content, "for")
+	if shifted := LinkifiedOffset(content, offset); linked[shifted:shifted+3] != "for" {
+		t.Errorf("Expected the offset of 'for' to be moved to %d, got %d", strings.Index(linked, "for"), shifted)
+	}
+	if shifted := LinkifiedOffset(content, 2); shifted != 2 {
+		t.Errorf("Expected offsets before a link to stay, got %d", shifted)
+	}
+}
+
+// TestCardLinksByUID tests that links by UID are told apart from links by ID
+func TestCardLinksByUID(t *testing.T) {
+	uid := "0190b4c8-7e2a-4f4b-9a51-3c2d8e6f1a2b"
+	content := "See [[card:12]] and [[card:" + strings.ToUpper(uid) + "]], and [[card:" + uid + "]] again."
+
+	if links := ParseCardLinks(content); !reflect.DeepEqual(links, []int32{12}) {
+		t.Errorf("Expected only the link by ID, got: %v", links)
+	}
+	if uids := ParseCardLinkUIDs(content); !reflect.DeepEqual(uids, []string{uid}) {
+		t.Errorf("Expected the UID %s once, got: %v", uid, uids)
+	}
+
+	expected := "See [card 0190b4c8](/card/" + uid + ")"
+	if linked := LinkifyCardLinks("See [[card:" + uid + "]]"); linked != expected {
+		t.Errorf("Expected '%s', got: '%s'", expected, linked)
+	}
+}
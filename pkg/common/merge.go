@@ -0,0 +1,55 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// MergeMarkdown performs a 3-way merge of two edits made on top of the same base content.
+// It relies on `git merge-file`, so git needs to be installed.
+// Parameters:
+//
+//	base   - The content both edits started from.
+//	ours   - The content edited in this session.
+//	theirs - The content saved by another session in the meantime.
+//
+// Returns:
+//
+//	The merged content, whether conflict markers were left in it and an error if any occurred.
+func MergeMarkdown(base, ours, theirs []byte) ([]byte, bool, error) {
+	oursFile, err := WriteTempFile("ume_ours_*.md", ours)
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(oursFile)
+
+	baseFile, err := WriteTempFile("ume_base_*.md", base)
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(baseFile)
+
+	theirsFile, err := WriteTempFile("ume_theirs_*.md", theirs)
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(theirsFile)
+
+	cmd := exec.Command("git", "merge-file", "-p",
+		"-L", "edited", "-L", "base", "-L", "latest",
+		oursFile, baseFile, theirsFile)
+	merged, err := cmd.Output()
+	if err == nil {
+		return merged, false, nil
+	}
+
+	// git merge-file exits with the number of conflicts, or a negative value on error
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+		return merged, true, nil
+	}
+
+	return nil, false, fmt.Errorf("error running git merge-file: %w", err)
+}
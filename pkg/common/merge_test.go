@@ -0,0 +1,47 @@
+package common
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestMergeMarkdown tests the MergeMarkdown function
+func TestMergeMarkdown(t *testing.T) {
+	// Skip this test if git isn't available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Skipping test because git is not installed")
+	}
+
+	base := []byte("# Title\n\nfirst line\n\nsecond line\n\nthird line\n")
+
+	// Test with edits to different parts of the file
+	ours := []byte("# Title\n\nfirst line edited\n\nsecond line\n\nthird line\n")
+	theirs := []byte("# Title\n\nfirst line\n\nsecond line\n\nthird line edited\n")
+
+	merged, conflict, err := MergeMarkdown(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("Expected no error for clean merge, got: %v", err)
+	}
+	if conflict {
+		t.Error("Expected no conflict for edits to different lines")
+	}
+	expected := "# Title\n\nfirst line edited\n\nsecond line\n\nthird line edited\n"
+	if string(merged) != expected {
+		t.Errorf("Expected merged content '%s', got: '%s'", expected, string(merged))
+	}
+
+	// Test with edits to the same line
+	theirs = []byte("# Title\n\nfirst line changed elsewhere\n\nsecond line\n\nthird line\n")
+
+	merged, conflict, err = MergeMarkdown(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("Expected no error for conflicting merge, got: %v", err)
+	}
+	if !conflict {
+		t.Error("Expected conflict for edits to the same line")
+	}
+	if !strings.Contains(string(merged), "<<<<<<< edited") || !strings.Contains(string(merged), ">>>>>>> latest") {
+		t.Errorf("Expected conflict markers in merged content, got: '%s'", string(merged))
+	}
+}
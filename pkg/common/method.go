@@ -0,0 +1,107 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Method is how the content of a card was acquired. It is stored with the image of a
+// card and with its OCR results, where the schema checks it is one of the methods below.
+type Method string
+
+const (
+	MethodOCR     Method = "ocr"     // Azure OCR, formatted to markdown with OpenAI
+	MethodMistral Method = "mistral" // Mistral OCR, formatted to markdown with OpenAI
+	MethodVision  Method = "vision"  // OpenAI vision caption, for diagrams and charts
+	MethodText    Method = "text"    // written as text with ume new
+	MethodAudio   Method = "audio"   // transcribed from a voice memo
+)
+
+// MethodAuto picks the method for each image after classifying it with ClassifyImage.
+// Only the method it picks is stored.
+const MethodAuto Method = "auto"
+
+// Methods are all the methods, in the order they are listed in help
+var Methods = []Method{MethodOCR, MethodMistral, MethodVision, MethodText, MethodAudio}
+
+// ImageMethods are the methods text can be extracted from an image with
+var ImageMethods = []Method{MethodMistral, MethodOCR, MethodVision}
+
+// methodSecrets are the secrets each method needs besides OPENAI_KEY
+var methodSecrets = map[Method][]string{
+	MethodOCR:     {"AZURE_ENDPOINT", "AZURE_KEY"},
+	MethodMistral: {"MISTRAL_KEY"},
+}
+
+// Configured reports whether the secrets the method needs are set
+func (m Method) Configured() bool {
+	for _, name := range append([]string{"OPENAI_KEY"}, methodSecrets[m]...) {
+		if Secret(name) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ConfiguredImageMethods returns the methods text can be extracted from an image with
+// whose providers are configured
+func ConfiguredImageMethods() []Method {
+	var methods []Method
+	for _, method := range ImageMethods {
+		if method.Configured() {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// ParseMethod returns the method with a name
+func ParseMethod(name string) (Method, error) {
+	method := Method(name)
+	if !slices.Contains(Methods, method) {
+		return "", fmt.Errorf("invalid method: %s. Must be one of %s", name, quoteMethods(Methods))
+	}
+	return method, nil
+}
+
+// ParseImageMethod returns the method with a name if text can be extracted from an image with it
+func ParseImageMethod(name string) (Method, error) {
+	method := Method(name)
+	if !method.IsImage() {
+		return "", fmt.Errorf("invalid method: %s. Must be one of %s", name, quoteMethods(ImageMethods))
+	}
+	return method, nil
+}
+
+// ParseUploadMethod returns the method with a name if images can be uploaded with it,
+// which are the image methods and auto
+func ParseUploadMethod(name string) (Method, error) {
+	method := Method(name)
+	if method != MethodAuto && !method.IsImage() {
+		return "", fmt.Errorf("invalid method: %s. Must be one of %s", name, quoteMethods(append(slices.Clone(ImageMethods), MethodAuto)))
+	}
+	return method, nil
+}
+
+// IsImage reports whether text is extracted from an image with the method
+func (m Method) IsImage() bool {
+	return slices.Contains(ImageMethods, m)
+}
+
+// String returns the name of the method as it is stored
+func (m Method) String() string {
+	return string(m)
+}
+
+// quoteMethods lists methods like 'ocr', 'mistral', or 'vision'
+func quoteMethods(methods []Method) string {
+	quoted := make([]string, len(methods))
+	for i, method := range methods {
+		quoted[i] = "'" + string(method) + "'"
+	}
+	if len(quoted) < 2 {
+		return strings.Join(quoted, "")
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + ", or " + quoted[len(quoted)-1]
+}
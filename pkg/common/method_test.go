@@ -0,0 +1,96 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestParseMethod tests the ParseMethod and ParseImageMethod functions
+func TestParseMethod(t *testing.T) {
+	for _, method := range Methods {
+		if parsed, err := ParseMethod(string(method)); err != nil || parsed != method {
+			t.Errorf("Expected %s to be parsed, got %q, %v", method, parsed, err)
+		}
+	}
+
+	if _, err := ParseMethod("ocr2"); err == nil {
+		t.Errorf("Expected an error for an unknown method")
+	}
+
+	if method, err := ParseImageMethod("mistral"); err != nil || method != MethodMistral {
+		t.Errorf("Expected mistral to be an image method, got %q, %v", method, err)
+	}
+
+	_, err := ParseImageMethod("text")
+	if err == nil {
+		t.Fatalf("Expected text not to be an image method")
+	}
+	expected := "invalid method: text. Must be one of 'mistral', 'ocr', or 'vision'"
+	if err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+// TestParseUploadMethod tests that auto is accepted along with the image methods
+func TestParseUploadMethod(t *testing.T) {
+	for _, name := range []string{"auto", "ocr", "mistral", "vision"} {
+		if method, err := ParseUploadMethod(name); err != nil || method != Method(name) {
+			t.Errorf("Expected %s to be accepted, got %s, %v", name, method, err)
+		}
+	}
+
+	_, err := ParseUploadMethod("text")
+	expected := "invalid method: text. Must be one of 'mistral', 'ocr', 'vision', or 'auto'"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+// TestExtractChunksByMethod tests that markdown is chunked the same for every method that produces it
+func TestExtractChunksByMethod(t *testing.T) {
+	content := "# Title\n\nFirst sentence. Second sentence."
+
+	for _, method := range []Method{MethodOCR, MethodMistral, MethodText, MethodAudio} {
+		chunker, err := ChunkerFor(method)
+		if err != nil {
+			t.Fatalf("ChunkerFor returned an error: %v", err)
+		}
+		chunks, err := ExtractChunks(content, chunker)
+		if err != nil {
+			t.Fatalf("ExtractChunks returned an error: %v", err)
+		}
+		if len(chunks) != 4 || chunks[0].Text != content || chunks[1].Text != "Title" {
+			t.Errorf("Expected the content, heading and sentences for %s, got %q", method, ChunkTexts(chunks))
+		}
+	}
+
+	chunker, _ := ChunkerFor(MethodVision)
+	chunks, _ := ExtractChunks("A chart. It goes up.", chunker)
+	if len(chunks) != 3 || chunks[1].Text != "A chart" {
+		t.Errorf("Expected the caption and its sentences for vision, got %q", ChunkTexts(chunks))
+	}
+}
+
+// TestConfiguredImageMethods tests that only the methods whose secrets are set are configured
+func TestConfiguredImageMethods(t *testing.T) {
+	originalKeychainGet := keychainGet
+	defer func() { keychainGet = originalKeychainGet }()
+	keychainGet = func(name string) (string, error) {
+		return "", fmt.Errorf("not found")
+	}
+
+	t.Setenv("OPENAI_KEY", "openai")
+	t.Setenv("MISTRAL_KEY", "mistral")
+	t.Setenv("AZURE_ENDPOINT", "")
+	t.Setenv("AZURE_KEY", "azure")
+
+	methods := ConfiguredImageMethods()
+	if len(methods) != 2 || methods[0] != MethodMistral || methods[1] != MethodVision {
+		t.Errorf("Expected mistral and vision without an Azure endpoint, got %v", methods)
+	}
+
+	t.Setenv("OPENAI_KEY", "")
+	if methods := ConfiguredImageMethods(); len(methods) != 0 {
+		t.Errorf("Expected no methods without an OpenAI key, got %v", methods)
+	}
+}
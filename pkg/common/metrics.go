@@ -0,0 +1,151 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds in seconds of the duration histograms. OCR and
+// markdown conversion take tens of seconds, so they go further than the usual buckets.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metric is a counter or a histogram with its series by label set
+type metric struct {
+	kind   string
+	help   string
+	series map[string]*series
+}
+
+// series is the value of a metric for one set of labels
+type series struct {
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+var (
+	metrics   = map[string]*metric{}
+	metricsMu sync.Mutex
+)
+
+// IncCounter adds one to a counter. Labels are given as name and value pairs.
+func IncCounter(name, help string, labels ...string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	getSeries(name, "counter", help, labels).value++
+}
+
+// ObserveDuration records a duration in seconds in a histogram. Labels are given as name
+// and value pairs.
+func ObserveDuration(name, help string, d time.Duration, labels ...string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	s := getSeries(name, "histogram", help, labels)
+	seconds := d.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += seconds
+	s.count++
+}
+
+// getSeries returns the series of a metric for a set of labels, creating both if needed
+func getSeries(name, kind, help string, labels []string) *series {
+	m, ok := metrics[name]
+	if !ok {
+		m = &metric{kind: kind, help: help, series: map[string]*series{}}
+		metrics[name] = m
+	}
+
+	key := formatLabels(labels)
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{counts: make([]uint64, len(durationBuckets))}
+		m.series[key] = s
+	}
+	return s
+}
+
+// formatLabels formats name and value pairs as Prometheus labels, like {method="GET"}
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pairs = append(pairs, labels[i]+`="`+value+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel adds a label to formatted labels
+func withLabel(labels, name, value string) string {
+	label := fmt.Sprintf(`%s="%s"`, name, value)
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return labels[:len(labels)-1] + "," + label + "}"
+}
+
+// metricResult labels the result of an operation by its error
+func metricResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// WriteMetrics writes the counters and histograms in the Prometheus text format
+func WriteMetrics(w io.Writer) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := metrics[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, m.kind)
+
+		keys := make([]string, 0, len(m.series))
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := m.series[key]
+			if m.kind == "counter" {
+				fmt.Fprintf(w, "%s%s %g\n", name, key, s.value)
+				continue
+			}
+
+			for i, bound := range durationBuckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(key, "le", fmt.Sprint(bound)), s.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(key, "le", "+Inf"), s.count)
+			fmt.Fprintf(w, "%s_sum%s %g\n", name, key, s.sum)
+			fmt.Fprintf(w, "%s_count%s %d\n", name, key, s.count)
+		}
+	}
+}
+
+// WriteGauge writes a single gauge in the Prometheus text format, for values read when
+// the metrics are scraped
+func WriteGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWriteMetrics tests writing counters and histograms in the Prometheus text format
+func TestWriteMetrics(t *testing.T) {
+	IncCounter("test_requests_total", "Test requests.", "route", "GET /", "status", "200")
+	IncCounter("test_requests_total", "Test requests.", "route", "GET /", "status", "200")
+	ObserveDuration("test_duration_seconds", "Test durations.", 300*time.Millisecond, "route", `say "hi"`)
+
+	var out strings.Builder
+	WriteMetrics(&out)
+	text := out.String()
+
+	expected := []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{route="GET /",status="200"} 2` + "\n",
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{route="say \"hi\"",le="0.25"} 0` + "\n",
+		`test_duration_seconds_bucket{route="say \"hi\"",le="0.5"} 1` + "\n",
+		`test_duration_seconds_bucket{route="say \"hi\"",le="+Inf"} 1` + "\n",
+		`test_duration_seconds_sum{route="say \"hi\""} 0.3` + "\n",
+		`test_duration_seconds_count{route="say \"hi\""} 1` + "\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(text, line) {
+			t.Errorf("Expected %q in the metrics, got:\n%s", line, text)
+		}
+	}
+}
+
+// TestWriteGauge tests the WriteGauge function
+func TestWriteGauge(t *testing.T) {
+	var out strings.Builder
+	WriteGauge(&out, "test_conns", "Test connections.", 3)
+
+	if out.String() != "# HELP test_conns Test connections.\n# TYPE test_conns gauge\ntest_conns 3\n" {
+		t.Errorf("Unexpected gauge: %q", out.String())
+	}
+}
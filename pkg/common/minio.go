@@ -3,17 +3,28 @@ package common
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"hash"
 	"io"
+	"mime"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"github.com/yasushisakai/umesao/database"
 )
 
 // MinioClient represents a connection to the Minio service
@@ -23,13 +34,33 @@ type MinioClient struct {
 	UseSSL         bool
 	ImageBucket    string
 	MarkdownBucket string
+	OCRBucket      string
+	// AttachmentBucket holds the files attached to cards, like PDFs, audio or datasets
+	AttachmentBucket string
+	// Prefix is put before the name of every object, so deployments can share buckets
+	Prefix string
+	// Versioning keeps every version of the markdown objects, so overwritten or deleted
+	// objects can be recovered
+	Versioning bool
+	// LockDays is how many days versions of markdown objects are locked against
+	// deletion, 0 when they aren't
+	LockDays int
+	// markdownChecked is set once versioning of the markdown bucket has been checked
+	markdownChecked atomic.Bool
+	// encryptionKey encrypts objects before they are stored, nil when they are stored as they are
+	encryptionKey []byte
 }
 
 // NewMinioClient creates a new MinioClient instance
 func NewMinioClient() (*MinioClient, error) {
+	// Failing at once, as Minio would retry the requests the offline transport fails
+	if Offline {
+		return nil, fmt.Errorf("%w: not connecting to Minio", ErrOffline)
+	}
+
 	endpoint := os.Getenv("MINIO_ENDPOINT")
-	accessKeyID := os.Getenv("MINIO_USER")
-	secretAccessKey := os.Getenv("MINIO_PASSWORD")
+	accessKeyID := Secret("MINIO_USER")
+	secretAccessKey := Secret("MINIO_PASSWORD")
 	useSSL := true
 
 	if endpoint == "" || accessKeyID == "" || secretAccessKey == "" {
@@ -37,60 +68,269 @@ func NewMinioClient() (*MinioClient, error) {
 	}
 
 	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
-		Secure: useSSL,
+		Creds:     credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
+		Secure:    useSSL,
+		Transport: HTTPClient().Transport,
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize Minio client: %v", err)
+		return nil, fmt.Errorf("failed to initialize Minio client: %w", err)
+	}
+
+	encryptionKey, err := EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MinioClient{
+		Client:        client,
+		Endpoint:      endpoint,
+		UseSSL:        useSSL,
+		encryptionKey: encryptionKey,
+	}
+	if err := m.configureBuckets(); err != nil {
+		return nil, err
 	}
+	if err := m.configureVersioning(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
 
-	return &MinioClient{
-		Client:         client,
-		Endpoint:       endpoint,
-		UseSSL:         useSSL,
-		ImageBucket:    "card-images",
-		MarkdownBucket: "card-markdown",
-	}, nil
+// minioBuckets are the environment variables the buckets can be named with per
+// deployment, and their default names
+var minioBuckets = []struct {
+	env  string
+	name string
+}{
+	{"MINIO_IMAGE_BUCKET", "card-images"},
+	{"MINIO_MARKDOWN_BUCKET", "card-markdown"},
+	{"MINIO_OCR_BUCKET", "card-ocr"},
+	{"MINIO_ATTACHMENT_BUCKET", "card-attachments"},
+}
+
+// configureBuckets sets the buckets and the object prefix from the environment. Names
+// S3 doesn't accept and buckets used for two kinds of objects are rejected, so a
+// mistake is reported before anything is stored.
+func (m *MinioClient) configureBuckets() error {
+	fields := []*string{&m.ImageBucket, &m.MarkdownBucket, &m.OCRBucket, &m.AttachmentBucket}
+	used := make(map[string]string)
+	for i, bucket := range minioBuckets {
+		name := os.Getenv(bucket.env)
+		if name == "" {
+			name = bucket.name
+		}
+		if err := s3utils.CheckValidBucketNameStrict(name); err != nil {
+			return fmt.Errorf("%w: invalid %s %q: %v", ErrNotConfigured, bucket.env, name, err)
+		}
+		if other, ok := used[name]; ok {
+			return fmt.Errorf("%w: %s and %s are both bucket %s, use a bucket for each", ErrNotConfigured, other, bucket.env, name)
+		}
+		used[name] = bucket.env
+		*fields[i] = name
+	}
+
+	prefix, err := ParseObjectPrefix(os.Getenv("MINIO_PREFIX"))
+	if err != nil {
+		return fmt.Errorf("%w: invalid MINIO_PREFIX: %v", ErrNotConfigured, err)
+	}
+	m.Prefix = prefix
+	return nil
+}
+
+// configureVersioning sets versioning and object locking of the markdown bucket from
+// MINIO_MARKDOWN_VERSIONING and MINIO_MARKDOWN_LOCK_DAYS. Locking versions needs
+// versioning, so it is turned on with it.
+func (m *MinioClient) configureVersioning() error {
+	if value := os.Getenv("MINIO_MARKDOWN_VERSIONING"); value != "" {
+		versioning, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%w: invalid MINIO_MARKDOWN_VERSIONING %q, use true or false", ErrNotConfigured, value)
+		}
+		m.Versioning = versioning
+	}
+
+	if value := os.Getenv("MINIO_MARKDOWN_LOCK_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return fmt.Errorf("%w: invalid MINIO_MARKDOWN_LOCK_DAYS %q, use a number of days", ErrNotConfigured, value)
+		}
+		m.LockDays = days
+		if days > 0 {
+			m.Versioning = true
+		}
+	}
+	return nil
+}
+
+// objectPrefixRe matches a segment of an object prefix
+var objectPrefixRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ParseObjectPrefix returns the prefix of object names set with MINIO_PREFIX, like dev
+// or users/alice, ending with a slash so it reads as a folder. An empty prefix is
+// returned as it is.
+func ParseObjectPrefix(prefix string) (string, error) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return "", nil
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		if !objectPrefixRe.MatchString(segment) || segment == "." || segment == ".." {
+			return "", fmt.Errorf("%q must be folder names of letters, digits, dots, hyphens and underscores separated by slashes", prefix)
+		}
+	}
+	return prefix + "/", nil
+}
+
+// object returns the name an object is stored as, with the prefix of the deployment
+func (m *MinioClient) object(name string) string {
+	return m.Prefix + name
 }
 
 // EnsureBucketExists checks if a bucket exists and creates it if it doesn't
 func (m *MinioClient) EnsureBucketExists(bucketName string) error {
-	exists, err := m.Client.BucketExists(context.Background(), bucketName)
+	ctx, cancel := CallContext()
+	defer cancel()
+	exists, err := m.Client.BucketExists(ctx, bucketName)
 	if err != nil {
-		return fmt.Errorf("error checking if bucket %s exists: %v", bucketName, err)
+		return fmt.Errorf("error checking if bucket %s exists: %w", bucketName, err)
 	}
 
+	// Object locking can only be turned on when a bucket is created
+	markdown := bucketName == m.MarkdownBucket
 	if !exists {
-		err = m.Client.MakeBucket(context.Background(), bucketName, minio.MakeBucketOptions{})
+		err = m.Client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{ObjectLocking: markdown && m.LockDays > 0})
 		if err != nil {
-			return fmt.Errorf("error creating bucket %s: %v", bucketName, err)
+			return fmt.Errorf("error creating bucket %s: %w", bucketName, err)
 		}
 		fmt.Printf("Successfully created bucket %s\n", bucketName)
 	}
 
+	if markdown && m.Versioning && !m.markdownChecked.Load() {
+		if err := m.ensureVersioning(ctx, bucketName); err != nil {
+			return err
+		}
+		m.markdownChecked.Store(true)
+	}
+
+	return nil
+}
+
+// ensureVersioning turns on versioning of a bucket, and locks new versions for LockDays
+// in governance mode, which an administrator can still bypass. Versioning is never
+// turned off, as that wouldn't bring back the versions that weren't kept.
+func (m *MinioClient) ensureVersioning(ctx context.Context, bucketName string) error {
+	config, err := m.Client.GetBucketVersioning(ctx, bucketName)
+	if err != nil {
+		return fmt.Errorf("error getting versioning of bucket %s: %w", bucketName, err)
+	}
+	if !config.Enabled() {
+		if err := m.Client.EnableVersioning(ctx, bucketName); err != nil {
+			return fmt.Errorf("error enabling versioning of bucket %s: %w", bucketName, err)
+		}
+		fmt.Printf("Enabled versioning of bucket %s\n", bucketName)
+	}
+
+	if m.LockDays == 0 {
+		return nil
+	}
+	lock, mode, validity, unit, err := m.Client.GetObjectLockConfig(ctx, bucketName)
+	if err != nil || lock != "Enabled" {
+		return fmt.Errorf("%w: bucket %s was created without object locking, which can't be turned on later; unset MINIO_MARKDOWN_LOCK_DAYS or use a new bucket", ErrNotConfigured, bucketName)
+	}
+	if mode != nil && *mode == minio.Governance && validity != nil && *validity == uint(m.LockDays) && unit != nil && *unit == minio.Days {
+		return nil
+	}
+
+	governance, days, daysUnit := minio.Governance, uint(m.LockDays), minio.Days
+	if err := m.Client.SetObjectLockConfig(ctx, bucketName, &governance, &days, &daysUnit); err != nil {
+		return fmt.Errorf("error locking objects of bucket %s: %w", bucketName, err)
+	}
+	fmt.Printf("Locked new objects of bucket %s for %d days\n", bucketName, m.LockDays)
 	return nil
 }
 
-// UploadFileToMinio uploads a file to a Minio bucket
-func (m *MinioClient) UploadFileToMinio(bucketName, objectName string, reader io.Reader, size int64, contentType string) (minio.UploadInfo, error) {
+// VersioningEnabled reports whether every version of the objects of a bucket is kept
+func (m *MinioClient) VersioningEnabled(bucketName string) (bool, error) {
+	ctx, cancel := CallContext()
+	defer cancel()
+	config, err := m.Client.GetBucketVersioning(ctx, bucketName)
+	if err != nil {
+		return false, fmt.Errorf("error getting versioning of bucket %s: %w", bucketName, err)
+	}
+	return config.Enabled(), nil
+}
+
+// ListObjectVersions returns the stored versions of the objects whose names start with
+// prefix, including the markers left where they were deleted. The names are returned
+// without the prefix of the deployment.
+func (m *MinioClient) ListObjectVersions(bucketName, prefix string) ([]minio.ObjectInfo, error) {
+	ctx, cancel := CallContext()
+	defer cancel()
+
+	var versions []minio.ObjectInfo
+	for object := range m.Client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:       m.object(prefix),
+		Recursive:    true,
+		WithVersions: true,
+	}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("error listing versions of %s: %w", prefix, object.Err)
+		}
+		object.Key = strings.TrimPrefix(object.Key, m.Prefix)
+		versions = append(versions, object)
+	}
+	return versions, nil
+}
+
+// Encrypted reports whether objects are encrypted before they are stored
+func (m *MinioClient) Encrypted() bool {
+	return m.encryptionKey != nil
+}
+
+// UploadFileToMinio uploads a file to a Minio bucket with the checksum of what is stored,
+// encrypting it first when UME_ENCRYPTION_KEY is set
+func (m *MinioClient) UploadFileToMinio(bucketName, objectName string, reader io.Reader, size int64, contentType string) (info minio.UploadInfo, err error) {
+	span := StartSpan("minio.put", "minio.bucket", bucketName, "minio.object", objectName)
+	defer func() { span.End(err) }()
+
 	// Ensure the bucket exists
 	if err := m.EnsureBucketExists(bucketName); err != nil {
 		return minio.UploadInfo{}, err
 	}
 
-	// Upload the file
-	info, err := m.Client.PutObject(
-		context.Background(),
+	// The content is read whole to take its checksum
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, fmt.Errorf("error reading file: %w", err)
+	}
+	if m.encryptionKey != nil {
+		content, err = Encrypt(m.encryptionKey, content)
+		if err != nil {
+			return minio.UploadInfo{}, fmt.Errorf("error encrypting file: %w", err)
+		}
+	}
+
+	// Minio rejects an object that doesn't match its SHA-256, and keeps the checksum to
+	// check the object when it is read. It is the checksum of the whole object, so the
+	// object is sent in one part.
+	ctx, cancel := CallContext()
+	defer cancel()
+	info, err = m.Client.PutObject(
+		ctx,
 		bucketName,
-		objectName,
-		reader,
-		size,
-		minio.PutObjectOptions{ContentType: contentType},
+		m.object(objectName),
+		bytes.NewReader(content),
+		int64(len(content)),
+		minio.PutObjectOptions{
+			ContentType:      contentType,
+			UserMetadata:     map[string]string{checksumHeader: ObjectChecksum(content)},
+			DisableMultipart: true,
+		},
 	)
 
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("error uploading file to Minio: %v", err)
+		return minio.UploadInfo{}, fmt.Errorf("error uploading file to Minio: %w", err)
 	}
 
 	return info, nil
@@ -101,32 +341,50 @@ func (m *MinioClient) UploadFileFromPath(bucketName, objectName, filePath string
 	// Read the file
 	fileContent, err := os.ReadFile(filePath)
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("error reading file: %v", err)
+		return minio.UploadInfo{}, fmt.Errorf("error reading file: %w", err)
 	}
 
 	// Get file size
 	fileSize := int64(len(fileContent))
 
-	// Determine content type based on file extension
-	contentType := "application/octet-stream"
-	if ext := filepath.Ext(filePath); ext != "" {
-		switch ext {
-		case ".jpg", ".jpeg":
-			contentType = "image/jpeg"
-		case ".png":
-			contentType = "image/png"
-		case ".gif":
-			contentType = "image/gif"
-		case ".md":
-			contentType = "text/markdown"
-		}
-	}
-
 	// Create a reader from the file content
 	fileReader := bytes.NewReader(fileContent)
 
 	// Upload the file
-	return m.UploadFileToMinio(bucketName, objectName, fileReader, fileSize, contentType)
+	return m.UploadFileToMinio(bucketName, objectName, fileReader, fileSize, ContentTypeForFile(filePath))
+}
+
+// ContentTypeForFile determines the content type of a file from its extension
+func ContentTypeForFile(filePath string) string {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	switch ext {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".m4a":
+		return "audio/mp4"
+	case ".mp3":
+		return "audio/mpeg"
+	case ".wav":
+		return "audio/wav"
+	case ".ogg":
+		return "audio/ogg"
+	case ".webm":
+		return "audio/webm"
+	case ".md":
+		return "text/markdown"
+	}
+
+	// Attachments can be any file, known to the system's MIME types or not
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
 }
 
 // UploadImageForCard uploads an image file for a specific card
@@ -143,37 +401,448 @@ func (m *MinioClient) UploadImageForCard(cardID int32, imagePath string) (string
 	return fileName, nil
 }
 
-// UploadMarkdownForCard uploads a markdown file for a specific card
-func (m *MinioClient) UploadMarkdownForCard(cardID, version int32, content []byte) error {
-	// Create the markdown filename
-	markdownFileName := fmt.Sprintf("%d_%d.md", cardID, version)
+// MarkdownObject returns the name markdown with a hash is stored as
+func MarkdownObject(hash string) string {
+	return "sha256/" + hash + ".md"
+}
+
+// LegacyMarkdownObject returns the name the markdown of a card version was stored as
+// before markdown was stored by its hash
+func LegacyMarkdownObject(cardID, version int32) string {
+	return fmt.Sprintf("%d_%d.md", cardID, version)
+}
+
+// UploadMarkdown stores markdown by the hash of its content and returns the hash.
+// Markdown that is already stored, by any card, isn't uploaded again.
+func (m *MinioClient) UploadMarkdown(content []byte) (string, error) {
+	hash, _, err := m.UploadMarkdownObject(content)
+	return hash, err
+}
+
+// UploadMarkdownObject stores markdown like UploadMarkdown, and also reports whether it
+// was uploaded rather than already stored
+func (m *MinioClient) UploadMarkdownObject(content []byte) (string, bool, error) {
+	hash := CalculateFileHash(content)
+	name := MarkdownObject(hash)
+
+	exists, err := m.ObjectExists(m.MarkdownBucket, name)
+	if err != nil {
+		return "", false, fmt.Errorf("error checking %s: %w", name, err)
+	}
+	if exists {
+		return hash, false, nil
+	}
+
+	_, err = m.UploadFileToMinio(m.MarkdownBucket, name, bytes.NewReader(content), int64(len(content)), "text/markdown")
+	if err != nil {
+		return "", false, err
+	}
+	return hash, true, nil
+}
+
+// DeleteMarkdownObject deletes markdown stored by the hash of its content
+func (m *MinioClient) DeleteMarkdownObject(hash string) error {
+	return m.DeleteFileFromMinio(m.MarkdownBucket, MarkdownObject(hash))
+}
+
+// ReadMarkdownObject reads the markdown of a card version, by its hash when it is
+// stored by hash and by the name of the version otherwise. The markdown must match the
+// hash, which can be empty for a version whose hash isn't known.
+func (m *MinioClient) ReadMarkdownObject(cardID, version int32, hash string, byHash bool) ([]byte, error) {
+	name := LegacyMarkdownObject(cardID, version)
+	if byHash {
+		name = MarkdownObject(hash)
+	}
+	content, err := m.ReadObjectFromMinio(m.MarkdownBucket, name)
+	if err != nil {
+		return nil, err
+	}
+	if hash != "" && CalculateFileHash(content) != hash {
+		return nil, fmt.Errorf("%w: markdown %s of version %d of card %d doesn't match its hash", ErrChecksumMismatch, name, version, cardID)
+	}
+	return content, nil
+}
+
+// CopyMarkdownToHash stores the markdown of a card version stored before markdown was
+// stored by its hash under the name of its hash, unless another version stored it already
+func (m *MinioClient) CopyMarkdownToHash(cardID, version int32, hash string) error {
+	name := MarkdownObject(hash)
+	exists, err := m.ObjectExists(m.MarkdownBucket, name)
+	if err != nil {
+		return fmt.Errorf("error checking %s: %w", name, err)
+	}
+	if exists {
+		return nil
+	}
 
-	// Create a reader from the markdown content
-	reader := bytes.NewReader(content)
-	size := int64(len(content))
+	ctx, cancel := CallContext()
+	defer cancel()
+	_, err = m.Client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: m.MarkdownBucket, Object: m.object(name)},
+		minio.CopySrcOptions{Bucket: m.MarkdownBucket, Object: m.object(LegacyMarkdownObject(cardID, version))})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", LegacyMarkdownObject(cardID, version), name, err)
+	}
+	return nil
+}
 
-	// Upload the markdown file
-	_, err := m.UploadFileToMinio(m.MarkdownBucket, markdownFileName, reader, size, "text/markdown")
+// UploadOCRForCard uploads the OCR result a markdown version was converted from
+func (m *MinioClient) UploadOCRForCard(cardID, version int32, content []byte) error {
+	ocrFileName := fmt.Sprintf("%d_%d.json", cardID, version)
+	_, err := m.UploadFileToMinio(m.OCRBucket, ocrFileName, bytes.NewReader(content), int64(len(content)), "application/json")
 	return err
 }
 
+// ReadOCRForCard reads the OCR result stored for a markdown version
+func (m *MinioClient) ReadOCRForCard(cardID, version int32) ([]byte, error) {
+	ocrFileName := fmt.Sprintf("%d_%d.json", cardID, version)
+	return m.ReadObjectFromMinio(m.OCRBucket, ocrFileName)
+}
+
 // GetFileFromMinio downloads a file from a Minio bucket to a local path
 func (m *MinioClient) GetFileFromMinio(bucketName, objectName, filePath string) error {
-	return m.Client.FGetObject(context.Background(), bucketName, objectName, filePath, minio.GetObjectOptions{})
+	content, err := m.ReadObjectFromMinio(bucketName, objectName)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, content, 0644)
 }
 
-// GetMarkdownForCard downloads a markdown file for a specific card
-func (m *MinioClient) GetMarkdownForCard(cardID, version int32, outputPath string) error {
-	// Create the markdown filename
-	markdownFileName := fmt.Sprintf("%d_%d.md", cardID, version)
+// GetObjectFromMinio opens an object in a Minio bucket for reading as it is stored,
+// without decrypting it
+func (m *MinioClient) GetObjectFromMinio(bucketName, objectName string) (*minio.Object, error) {
+	// The object is read after this returns, so only the deadline of the command applies
+	return m.Client.GetObject(CommandContext(), bucketName, m.object(objectName), minio.GetObjectOptions{Checksum: true})
+}
+
+// checksumHeader is the header the SHA-256 of an object is sent to Minio with
+const checksumHeader = "X-Amz-Checksum-Sha256"
+
+// ObjectChecksum returns the SHA-256 of an object as Minio keeps it, base64 encoded
+func ObjectChecksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
 
-	// Download the markdown file
-	return m.GetFileFromMinio(m.MarkdownBucket, markdownFileName, outputPath)
+// VerifyObjectChecksum checks that the content read of an object matches the checksum it
+// was stored with. Objects stored without a checksum can't be checked and pass.
+func VerifyObjectChecksum(info minio.ObjectInfo, content []byte) error {
+	sum := sha256.Sum256(content)
+	return verifyObjectSum(info, sum[:])
+}
+
+// verifyObjectSum checks the SHA-256 of the content read of an object against the
+// checksum it was stored with
+func verifyObjectSum(info minio.ObjectInfo, sum []byte) error {
+	if info.ChecksumSHA256 == "" || info.ChecksumSHA256 == base64.StdEncoding.EncodeToString(sum) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s doesn't match the SHA-256 it was stored with", ErrChecksumMismatch, info.Key)
+}
+
+// OpenObject opens an object in a Minio bucket for reading, decrypting it if it was
+// stored encrypted
+func (m *MinioClient) OpenObject(bucketName, objectName string) (io.ReadSeekCloser, minio.ObjectInfo, error) {
+	obj, err := m.GetObjectFromMinio(bucketName, objectName)
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	// Unencrypted objects are streamed and checked once read to the end, encrypted ones
+	// have to be read whole to be opened
+	if m.encryptionKey == nil {
+		if info.ChecksumSHA256 == "" {
+			return obj, info, nil
+		}
+		return newChecksumReader(obj, info), info, nil
+	}
+
+	content, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	if err := VerifyObjectChecksum(info, content); err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	content, err = Decrypt(m.encryptionKey, content)
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	info.Size = int64(len(content))
+	return nopCloser{bytes.NewReader(content)}, info, nil
+}
+
+// checksumReader streams an object and checks it against the checksum it was stored
+// with when it is read to the end, returning ErrChecksumMismatch instead of io.EOF.
+// Reads after seeking anywhere but the start or where the checked content ends, like
+// for a range request, can't be checked.
+type checksumReader struct {
+	io.ReadSeekCloser
+	info minio.ObjectInfo
+	hash hash.Hash
+	// checked is how much of the content was hashed, offset where the next read starts
+	checked int64
+	offset  int64
+}
+
+// newChecksumReader returns a checksumReader reading obj from the start
+func newChecksumReader(obj io.ReadSeekCloser, info minio.ObjectInfo) *checksumReader {
+	return &checksumReader{ReadSeekCloser: obj, info: info, hash: sha256.New()}
+}
+
+// Read reads from the object, hashing what is read in order
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	if r.offset == r.checked {
+		r.hash.Write(p[:n])
+		r.checked += int64(n)
+	}
+	r.offset += int64(n)
+
+	if err == io.EOF && r.checked == r.offset && r.checked == r.info.Size {
+		if err := verifyObjectSum(r.info, r.hash.Sum(nil)); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// Seek seeks in the object, starting the hash over when seeking to the start
+func (r *checksumReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeekCloser.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	if pos == 0 {
+		r.hash.Reset()
+		r.checked = 0
+	}
+	r.offset = pos
+	return pos, nil
+}
+
+// nopCloser adds a Close method that does nothing to a ReadSeeker
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+// Close does nothing
+func (nopCloser) Close() error {
+	return nil
+}
+
+// ReadObjectFromMinio reads the whole content of an object in a Minio bucket,
+// decrypting it if it was stored encrypted
+func (m *MinioClient) ReadObjectFromMinio(bucketName, objectName string) ([]byte, error) {
+	obj, err := m.GetObjectFromMinio(bucketName, objectName)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	content, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, err
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyObjectChecksum(info, content); err != nil {
+		return nil, err
+	}
+	return Decrypt(m.encryptionKey, content)
+}
+
+// ObjectETag returns the ETag of an object in a Minio bucket, which changes when the
+// object is replaced
+func (m *MinioClient) ObjectETag(bucketName, objectName string) (string, error) {
+	ctx, cancel := CallContext()
+	defer cancel()
+	info, err := m.Client.StatObject(ctx, bucketName, m.object(objectName), minio.StatObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	return info.ETag, nil
+}
+
+// ObjectExists reports whether an object is in a Minio bucket
+func (m *MinioClient) ObjectExists(bucketName, objectName string) (bool, error) {
+	ctx, cancel := CallContext()
+	defer cancel()
+	_, err := m.Client.StatObject(ctx, bucketName, m.object(objectName), minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return false, nil
+	}
+	return false, err
+}
+
+// GetMarkdownForCard downloads the markdown of a card version to a file
+func (m *MinioClient) GetMarkdownForCard(cardID, version int32, hash string, byHash bool, outputPath string) error {
+	content, err := m.ReadMarkdownObject(cardID, version, hash, byHash)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, content, 0644)
+}
+
+// ReadMarkdown returns the markdown of a card version. It is read from the copy in the
+// database, and only downloaded from Minio for versions stored before the copy was kept,
+// which are kept in the content cache once downloaded. m can be nil, in which case a
+// Minio client is only created when it is needed. Offline only the versions in the
+// database or the content cache can be read.
+func ReadMarkdown(ctx context.Context, queries *database.Queries, m *MinioClient, cardID, version int32) (string, error) {
+	row, err := queries.GetMarkdownContent(ctx, database.GetMarkdownContentParams{CardID: cardID, Ver: version})
+	if err != nil {
+		return "", fmt.Errorf("error getting version %d of card %d: %w", version, cardID, err)
+	}
+	if row.Content.Valid {
+		return row.Content.String, nil
+	}
+
+	// The cache only saves a download, so it is skipped when it can't be used
+	cache, cacheErr := NewContentCache()
+	if cacheErr == nil {
+		if content, ok := cache.Markdown(row.Hash); ok {
+			return content, nil
+		}
+	}
+	if Offline {
+		return "", fmt.Errorf("%w: version %d of card %d is only stored in Minio", ErrOffline, version, cardID)
+	}
+
+	if m == nil {
+		m, err = NewMinioClient()
+		if err != nil {
+			return "", fmt.Errorf("error initializing Minio client: %w", err)
+		}
+	}
+	data, err := m.ReadMarkdownObject(cardID, version, row.Hash, row.ByHash)
+	if err != nil {
+		return "", fmt.Errorf("error downloading content file of card %d: %w", cardID, err)
+	}
+	if cacheErr == nil {
+		cache.PutMarkdown(string(data))
+	}
+	return string(data), nil
+}
+
+// ReadTranslation returns the stored translation of a card version with a hash. It is
+// read from the content cache, or downloaded from Minio and cached. m can be nil offline,
+// when only cached translations can be read.
+func ReadTranslation(m *MinioClient, cardID, version int32, lang, hash string) (string, error) {
+	cache, cacheErr := NewContentCache()
+	if cacheErr == nil {
+		if content, ok := cache.Markdown(hash); ok {
+			return content, nil
+		}
+	}
+	if m == nil {
+		return "", fmt.Errorf("%w: the %s translation of version %d of card %d isn't cached", ErrOffline, lang, version, cardID)
+	}
+
+	data, err := m.ReadTranslationForCard(cardID, version, lang)
+	if err != nil {
+		return "", err
+	}
+	if cacheErr == nil {
+		cache.PutMarkdown(string(data))
+	}
+	return string(data), nil
+}
+
+// ReadImage returns a card image with an object name. It is read from the content cache
+// if the cached image has the ETag of the object, or downloaded from Minio and cached.
+// m can be nil offline, when the cached image is read whatever its ETag.
+func ReadImage(m *MinioClient, name string) ([]byte, error) {
+	cache, cacheErr := NewContentCache()
+	if m == nil {
+		if cacheErr == nil {
+			if data, ok := cache.Image(name, ""); ok {
+				return data, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: image %s isn't cached", ErrOffline, name)
+	}
+
+	etag, err := m.ObjectETag(m.ImageBucket, name)
+	if err != nil {
+		return nil, err
+	}
+	if cacheErr == nil {
+		if data, ok := cache.Image(name, etag); ok {
+			return data, nil
+		}
+	}
+
+	data, err := m.ReadObjectFromMinio(m.ImageBucket, name)
+	if err != nil {
+		return nil, err
+	}
+	if cacheErr == nil {
+		cache.PutImage(name, etag, data)
+	}
+	return data, nil
+}
+
+// UploadTranslationForCard uploads a translated markdown file for a specific card version
+func (m *MinioClient) UploadTranslationForCard(cardID, version int32, lang string, content []byte) error {
+	// Create the translation filename
+	translationFileName := fmt.Sprintf("%d_%d_%s.md", cardID, version, lang)
+
+	// Upload the translation next to the original markdown
+	_, err := m.UploadFileToMinio(m.MarkdownBucket, translationFileName, bytes.NewReader(content), int64(len(content)), "text/markdown")
+	return err
+}
+
+// ReadTranslationForCard reads a translated markdown file for a specific card version
+func (m *MinioClient) ReadTranslationForCard(cardID, version int32, lang string) ([]byte, error) {
+	translationFileName := fmt.Sprintf("%d_%d_%s.md", cardID, version, lang)
+	return m.ReadObjectFromMinio(m.MarkdownBucket, translationFileName)
 }
 
 // DeleteFileFromMinio deletes a file from a Minio bucket
 func (m *MinioClient) DeleteFileFromMinio(bucketName, objectName string) error {
-	return m.Client.RemoveObject(context.Background(), bucketName, objectName, minio.RemoveObjectOptions{})
+	ctx, cancel := CallContext()
+	defer cancel()
+	return m.Client.RemoveObject(ctx, bucketName, m.object(objectName), minio.RemoveObjectOptions{})
+}
+
+// TrashPrefix is the prefix of objects belonging to cards in the trash
+const TrashPrefix = "trash/"
+
+// MoveObjectToTrash moves an object under the trash prefix of the same bucket
+func (m *MinioClient) MoveObjectToTrash(bucketName, objectName string) error {
+	return m.moveObject(bucketName, objectName, TrashPrefix+objectName)
+}
+
+// RestoreObjectFromTrash moves an object from the trash prefix back to its original name
+func (m *MinioClient) RestoreObjectFromTrash(bucketName, objectName string) error {
+	return m.moveObject(bucketName, TrashPrefix+objectName, objectName)
+}
+
+// moveObject copies an object to a new name in the same bucket and removes the original
+func (m *MinioClient) moveObject(bucketName, srcName, dstName string) error {
+	ctx, cancel := CallContext()
+	defer cancel()
+	_, err := m.Client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: bucketName, Object: m.object(dstName)},
+		minio.CopySrcOptions{Bucket: bucketName, Object: m.object(srcName)})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", srcName, dstName, err)
+	}
+
+	return m.DeleteFileFromMinio(bucketName, srcName)
 }
 
 // GetImageURLForCard returns the public URL for a card's image
@@ -182,7 +851,21 @@ func (m *MinioClient) GetImageURLForCard(imageName string) string {
 	if !m.UseSSL {
 		protocol = "http"
 	}
-	return fmt.Sprintf("%s://%s/%s/%s", protocol, m.Endpoint, m.ImageBucket, imageName)
+	return fmt.Sprintf("%s://%s/%s/%s", protocol, m.Endpoint, m.ImageBucket, m.object(imageName))
+}
+
+// PresignedImageURL returns a temporary URL that gives access to a card's image without credentials.
+// Encrypted images can't be read through a URL, so it fails when encryption is on.
+func (m *MinioClient) PresignedImageURL(imageName string, expiry time.Duration) (string, error) {
+	if m.encryptionKey != nil {
+		return "", fmt.Errorf("images are encrypted and can't be shared by URL")
+	}
+
+	u, err := m.Client.PresignedGetObject(context.Background(), m.ImageBucket, m.object(imageName), expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign image URL: %w", err)
+	}
+	return u.String(), nil
 }
 
 // OpenBrowser opens a URL in the default browser
@@ -195,7 +878,8 @@ func OpenBrowser(url string) error {
 	case "linux":
 		cmd = exec.Command("xdg-open", url)
 	case "windows":
-		cmd = exec.Command("cmd", "/c", "start", url)
+		// The empty title keeps start from taking a quoted path as the window title
+		cmd = exec.Command("cmd", "/c", "start", "", url)
 	default:
 		return fmt.Errorf("unsupported operating system for opening browser: %s", os)
 	}
@@ -1,11 +1,15 @@
 package common
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
+	"io"
 	"os"
 	"testing"
 
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/minio/minio-go/v7"
 )
 
 // TestGetImageURLForCard tests the GetImageURLForCard function
@@ -35,6 +39,140 @@ func TestGetImageURLForCard(t *testing.T) {
 	if url != expectedURL {
 		t.Errorf("Expected URL '%s', got: '%s'", expectedURL, url)
 	}
+
+	// Test with an object prefix
+	client.Prefix = "dev/"
+	url = client.GetImageURLForCard(imageName)
+	expectedURL = "https://localhost:9000/card-images/dev/test-image.jpg"
+
+	if url != expectedURL {
+		t.Errorf("Expected URL '%s', got: '%s'", expectedURL, url)
+	}
+}
+
+// TestConfigureBuckets tests that bucket names and the object prefix are read from the environment and checked
+func TestConfigureBuckets(t *testing.T) {
+	for _, env := range []string{"MINIO_IMAGE_BUCKET", "MINIO_MARKDOWN_BUCKET", "MINIO_OCR_BUCKET", "MINIO_ATTACHMENT_BUCKET", "MINIO_PREFIX"} {
+		t.Setenv(env, "")
+	}
+
+	client := &MinioClient{}
+	if err := client.configureBuckets(); err != nil {
+		t.Fatalf("configureBuckets returned an error: %v", err)
+	}
+	if client.ImageBucket != "card-images" || client.MarkdownBucket != "card-markdown" || client.OCRBucket != "card-ocr" || client.AttachmentBucket != "card-attachments" || client.Prefix != "" {
+		t.Errorf("Expected the default buckets without a prefix, got %+v", client)
+	}
+
+	t.Setenv("MINIO_MARKDOWN_BUCKET", "dev-markdown")
+	t.Setenv("MINIO_PREFIX", "/users/alice/")
+	if err := client.configureBuckets(); err != nil {
+		t.Fatalf("configureBuckets returned an error: %v", err)
+	}
+	if client.MarkdownBucket != "dev-markdown" || client.Prefix != "users/alice/" {
+		t.Errorf("Expected dev-markdown and users/alice/, got %s and %s", client.MarkdownBucket, client.Prefix)
+	}
+	if name := client.object("1_1.md"); name != "users/alice/1_1.md" {
+		t.Errorf("Expected the object name to have the prefix, got %s", name)
+	}
+
+	t.Setenv("MINIO_MARKDOWN_BUCKET", "Card_Markdown")
+	if err := client.configureBuckets(); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected ErrNotConfigured for an invalid bucket name, got %v", err)
+	}
+	t.Setenv("MINIO_MARKDOWN_BUCKET", "card-images")
+	if err := client.configureBuckets(); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected ErrNotConfigured for a bucket used twice, got %v", err)
+	}
+	t.Setenv("MINIO_MARKDOWN_BUCKET", "")
+
+	for _, prefix := range []string{"../prod", "dev//alice", "dev alice", "dev/./alice"} {
+		if _, err := ParseObjectPrefix(prefix); err == nil {
+			t.Errorf("Expected an error for the prefix %q", prefix)
+		}
+	}
+}
+
+// TestConfigureVersioning tests that locking markdown objects turns on versioning
+func TestConfigureVersioning(t *testing.T) {
+	t.Setenv("MINIO_MARKDOWN_VERSIONING", "")
+	t.Setenv("MINIO_MARKDOWN_LOCK_DAYS", "")
+
+	client := &MinioClient{}
+	if err := client.configureVersioning(); err != nil || client.Versioning || client.LockDays != 0 {
+		t.Errorf("Expected no versioning by default, got %v, %d, %v", client.Versioning, client.LockDays, err)
+	}
+
+	t.Setenv("MINIO_MARKDOWN_LOCK_DAYS", "30")
+	if err := client.configureVersioning(); err != nil || !client.Versioning || client.LockDays != 30 {
+		t.Errorf("Expected versioning with 30 days of locking, got %v, %d, %v", client.Versioning, client.LockDays, err)
+	}
+
+	t.Setenv("MINIO_MARKDOWN_LOCK_DAYS", "a month")
+	if err := client.configureVersioning(); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected ErrNotConfigured for invalid lock days, got %v", err)
+	}
+	t.Setenv("MINIO_MARKDOWN_LOCK_DAYS", "")
+	t.Setenv("MINIO_MARKDOWN_VERSIONING", "sometimes")
+	if err := client.configureVersioning(); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected ErrNotConfigured for invalid versioning, got %v", err)
+	}
+}
+
+// TestVerifyObjectChecksum tests that content read from Minio is checked against the checksum it was stored with
+func TestVerifyObjectChecksum(t *testing.T) {
+	content := []byte("# Knowledge work")
+	info := minio.ObjectInfo{Key: "sha256/abc.md", ChecksumSHA256: ObjectChecksum(content)}
+
+	if err := VerifyObjectChecksum(info, content); err != nil {
+		t.Errorf("Expected the content to match its checksum, got %v", err)
+	}
+	if err := VerifyObjectChecksum(info, []byte("# Knowledge wrok")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch for changed content, got %v", err)
+	}
+
+	// Objects stored before checksums were sent have none
+	if err := VerifyObjectChecksum(minio.ObjectInfo{Key: "1_1.md"}, content); err != nil {
+		t.Errorf("Expected content without a checksum to pass, got %v", err)
+	}
+}
+
+// TestChecksumReader tests that a streamed object is checked once it is read to the end
+func TestChecksumReader(t *testing.T) {
+	content := []byte("# Knowledge work")
+	info := minio.ObjectInfo{Key: "sha256/abc.md", Size: int64(len(content)), ChecksumSHA256: ObjectChecksum(content)}
+
+	r := newChecksumReader(nopCloser{bytes.NewReader(content)}, info)
+	if read, err := io.ReadAll(r); err != nil || !bytes.Equal(read, content) {
+		t.Errorf("Expected the content to be read without error, got %q, %v", read, err)
+	}
+
+	changed := []byte("# Knowledge wrok")
+	r = newChecksumReader(nopCloser{bytes.NewReader(changed)}, info)
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch for changed content, got %v", err)
+	}
+
+	// Finding the size and reading from the start, like http.ServeContent, is checked
+	r = newChecksumReader(nopCloser{bytes.NewReader(changed)}, info)
+	if _, err := r.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch after seeking back to the start, got %v", err)
+	}
+
+	// A range from the middle can't be checked
+	r = newChecksumReader(nopCloser{bytes.NewReader(changed)}, info)
+	if _, err := r.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := io.ReadAll(r); err != nil || string(read) != string(changed[4:]) {
+		t.Errorf("Expected the range to be read without error, got %q, %v", read, err)
+	}
 }
 
 func TestUploadCardImage(t *testing.T) {
@@ -8,9 +8,11 @@ import (
 	"image"
 	"image/jpeg"
 	_ "image/png" // Import png decoder for automatic format detection
-	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	_ "github.com/joho/godotenv/autoload"
 )
@@ -24,15 +26,66 @@ type MistralOCRRequest struct {
 	Document Document `json:"document"`
 }
 
-// Document represents the document part of the OCR request
+// Document represents the document part of the OCR request, an image or a PDF
 type Document struct {
-	Type     string `json:"type"`
-	ImageURL string `json:"image_url"`
+	Type        string `json:"type"`
+	ImageURL    string `json:"image_url,omitempty"`
+	DocumentURL string `json:"document_url,omitempty"`
 }
 
 // MistralOCRResponse represents the response from Mistral OCR API
 type MistralOCRResponse struct {
-	Text string `json:"text"`
+	// Text is the flat result of older responses, newer ones hold the markdown of each page
+	Text  string           `json:"text"`
+	Pages []MistralOCRPage `json:"pages"`
+	Model string           `json:"model"`
+}
+
+// MistralOCRPage is the markdown of a page and the images found in it
+type MistralOCRPage struct {
+	Index    int               `json:"index"`
+	Markdown string            `json:"markdown"`
+	Images   []MistralOCRImage `json:"images"`
+}
+
+// MistralOCRImage is an image in a page, referenced by its ID in the markdown.
+// The coordinates are in pixels of the page.
+type MistralOCRImage struct {
+	ID           string `json:"id"`
+	TopLeftX     int    `json:"top_left_x"`
+	TopLeftY     int    `json:"top_left_y"`
+	BottomRightX int    `json:"bottom_right_x"`
+	BottomRightY int    `json:"bottom_right_y"`
+	ImageBase64  string `json:"image_base64,omitempty"`
+}
+
+// Markdown joins the markdown of the pages in order, with a comment marking where each
+// page after the first starts. Older responses without pages return their text.
+func (r MistralOCRResponse) Markdown() string {
+	if len(r.Pages) == 0 {
+		return r.Text
+	}
+
+	pages := make([]MistralOCRPage, len(r.Pages))
+	copy(pages, r.Pages)
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Index < pages[j].Index })
+
+	var b strings.Builder
+	for i, page := range pages {
+		if i > 0 {
+			fmt.Fprintf(&b, "\n\n<!-- page %d -->\n\n", i+1)
+		}
+		b.WriteString(strings.TrimSpace(page.Markdown))
+	}
+	return b.String()
+}
+
+// PageCount returns the number of pages in the response
+func (r MistralOCRResponse) PageCount() int {
+	if len(r.Pages) == 0 && r.Text != "" {
+		return 1
+	}
+	return len(r.Pages)
 }
 
 // MistralOCR sends an image to Mistral's OCR API and returns the extracted text.
@@ -44,76 +97,102 @@ type MistralOCRResponse struct {
 //
 //	A string containing the OCR result text and an error if any occurred.
 func MistralOCR(path string) (string, error) {
+	text, _, err := MistralOCRPages(path)
+	return text, err
+}
+
+// MistralOCRPages sends an image or a PDF to Mistral's OCR API and returns the markdown of
+// all pages joined, and the number of pages.
+func MistralOCRPages(path string) (string, int, error) {
 	// 0. load ENV "MISTRAL_KEY"
 	mistralKey, err := RequireEnvVar("MISTRAL_KEY")
 	if err != nil {
-		return "", fmt.Errorf("failed to get env MISTRAL_KEY: %v", err)
-	}
-
-	// 1. Read and process the image file
-	file, err := os.Open(path)
-	if err != nil {
-		return "", fmt.Errorf("failed to open image file: %v", err)
+		return "", 0, fmt.Errorf("failed to get env MISTRAL_KEY: %w", err)
 	}
-	defer file.Close()
 
-	// Decode the image (supports multiple formats through image decoders)
-	img, _, err := image.Decode(file)
+	// 1. Encode the file, PDFs are sent as they are and images as JPEG
+	document, err := mistralDocument(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode image: %v", err)
+		return "", 0, err
 	}
 
-	// 2. Convert image to base64
-	var buf bytes.Buffer
-	err = jpeg.Encode(&buf, img, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to encode image to JPEG: %v", err)
-	}
-
-	base64Img := base64.StdEncoding.EncodeToString(buf.Bytes())
-	imageURL := fmt.Sprintf("data:image/jpeg;base64,%s", base64Img)
-
-	// 3. Build the Mistral OCR API request
+	// 2. Build the Mistral OCR API request
 	reqBody := MistralOCRRequest{
-		Model: "mistral-ocr-latest",
-		Document: Document{
-			Type:     "image_url",
-			ImageURL: imageURL,
-		},
+		Model:    "mistral-ocr-latest",
+		Document: document,
 	}
 
 	jsonReqBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %v", err)
+		return "", 0, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	// 4. Make the API request
+	// 3. Make the API request
 	url := "https://api.mistral.ai/v1/ocr"
 	req, err := httpNewRequest("POST", url, bytes.NewBuffer(jsonReqBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+mistralKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	ctx, cancel := CallContext()
+	defer cancel()
+	resp, err := HTTPClient().Do(req.WithContext(ctx))
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
+		return "", 0, &ProviderError{Provider: "Mistral", Err: err}
 	}
 	defer resp.Body.Close()
 
-	// 5. Parse the response
+	// 4. Parse the response
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		return "", 0, responseError("Mistral", resp)
 	}
 
 	var ocrResp MistralOCRResponse
 	if err := json.NewDecoder(resp.Body).Decode(&ocrResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+		return "", 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return ocrResp.Markdown(), ocrResp.PageCount(), nil
+}
+
+// mistralDocument encodes a file as the document of an OCR request
+func mistralDocument(path string) (Document, error) {
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Document{}, fmt.Errorf("failed to read PDF file: %w", err)
+		}
+		return Document{
+			Type:        "document_url",
+			DocumentURL: "data:application/pdf;base64," + base64.StdEncoding.EncodeToString(data),
+		}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to open image file: %w", err)
+	}
+	defer file.Close()
+
+	// Decode the image (supports multiple formats through image decoders)
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	return ocrResp.Text, nil
+	// Convert image to base64
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, nil)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to encode image to JPEG: %w", err)
+	}
+
+	base64Img := base64.StdEncoding.EncodeToString(buf.Bytes())
+	return Document{
+		Type:     "image_url",
+		ImageURL: fmt.Sprintf("data:image/jpeg;base64,%s", base64Img),
+	}, nil
 }
@@ -113,3 +113,32 @@ func TestMistralOCR(t *testing.T) {
 
 // Using the httpNewRequest variable defined in mistral.go
 
+
+// TestMistralOCRResponseMarkdown tests joining the pages of a response
+func TestMistralOCRResponseMarkdown(t *testing.T) {
+	var resp MistralOCRResponse
+	body := `{"pages":[` +
+		`{"index":1,"markdown":"second page\n","images":[]},` +
+		`{"index":0,"markdown":"# First\n\n![img-0.jpeg](img-0.jpeg)","images":[{"id":"img-0.jpeg","top_left_x":10,"top_left_y":20,"bottom_right_x":110,"bottom_right_y":220}]}` +
+		`],"model":"mistral-ocr-latest"}`
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	expected := "# First\n\n![img-0.jpeg](img-0.jpeg)\n\n<!-- page 2 -->\n\nsecond page"
+	if md := resp.Markdown(); md != expected {
+		t.Errorf("Expected the pages in order, got %q", md)
+	}
+	if resp.PageCount() != 2 {
+		t.Errorf("Expected 2 pages, got %d", resp.PageCount())
+	}
+	if image := resp.Pages[1].Images[0]; image.ID != "img-0.jpeg" || image.BottomRightY != 220 {
+		t.Errorf("Expected the image of the first page, got %+v", image)
+	}
+
+	// Older responses only have text
+	legacy := MistralOCRResponse{Text: "flat text"}
+	if legacy.Markdown() != "flat text" || legacy.PageCount() != 1 {
+		t.Errorf("Expected the text as a single page, got %q with %d pages", legacy.Markdown(), legacy.PageCount())
+	}
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EmbeddingModel is a model chunks are embedded with. Vectors of different models, or of
+// one model at different dimensions, can't be compared, so searches only compare vectors
+// of the same model.
+type EmbeddingModel struct {
+	Name      string
+	Dimension uint
+	Provider  string
+}
+
+// DefaultEmbeddingModel is the model chunks are embedded with unless UME_EMBEDDING_MODEL is set
+var DefaultEmbeddingModel = EmbeddingModel{Name: "text-embedding-3-small", Dimension: 1536, Provider: "openai"}
+
+// EmbeddingModels are the models ume can embed with. The schema registers the same
+// models in the models table.
+var EmbeddingModels = []EmbeddingModel{
+	DefaultEmbeddingModel,
+	{Name: "text-embedding-3-large", Dimension: 3072, Provider: "openai"},
+}
+
+// FindEmbeddingModel returns the embedding model with a name
+func FindEmbeddingModel(name string) (EmbeddingModel, error) {
+	names := make([]string, len(EmbeddingModels))
+	for i, model := range EmbeddingModels {
+		if model.Name == name {
+			return model, nil
+		}
+		names[i] = model.Name
+	}
+	return EmbeddingModel{}, fmt.Errorf("unknown embedding model: %s. Must be one of %s", name, strings.Join(names, ", "))
+}
+
+// CurrentEmbeddingModel returns the model new chunks are embedded with, set with
+// UME_EMBEDDING_MODEL. Chunks embedded with another model are kept, and can still be
+// searched with ume lookup --model.
+func CurrentEmbeddingModel() (EmbeddingModel, error) {
+	if name := os.Getenv("UME_EMBEDDING_MODEL"); name != "" {
+		return FindEmbeddingModel(name)
+	}
+	return DefaultEmbeddingModel, nil
+}
+
+// Embed returns the embeddings of texts, in the same order
+func (m EmbeddingModel) Embed(key string, texts []string) ([][]float64, error) {
+	if m.Provider != "openai" {
+		return nil, fmt.Errorf("unsupported provider %s of embedding model %s", m.Provider, m.Name)
+	}
+	return LineEmbeddings(key, m.Name, m.Dimension, texts)
+}
+
+// Embedding precisions, the pgvector types chunk embeddings are stored as. Half precision
+// takes half the space, and its indexes are smaller and faster, for a little accuracy.
+const (
+	PrecisionFull = "vector"
+	PrecisionHalf = "halfvec"
+)
+
+// maxIndexDimensions is the most dimensions an ivfflat index supports for each precision
+var maxIndexDimensions = map[string]uint{
+	PrecisionFull: 2000,
+	PrecisionHalf: 4000,
+}
+
+// candidatesPerCard is how many of the closest chunks are looked up with the index for
+// each card a search returns, as chunks of the same card, older versions and the cards
+// left out by filters are only dropped after the lookup
+const candidatesPerCard = 20
+
+// SearchCandidates returns how many of the closest chunks a search of cards looks up
+func SearchCandidates(cards int) int32 {
+	return int32(max(cards*candidatesPerCard, 200))
+}
+
+// WidenCandidates runs a search with candidates closest chunks, and again with more of
+// them while it finds fewer than want cards, until all chunks of the model were candidates.
+// search returns the number of cards it found and chunks the number of chunks of the model,
+// which is only counted when the first search comes back short.
+func WidenCandidates(candidates int32, want int, search func(candidates int32) (int, error), chunks func() (int32, error)) error {
+	total := int32(-1)
+	for {
+		found, err := search(candidates)
+		if err != nil || found >= want {
+			return err
+		}
+
+		if total < 0 {
+			total, err = chunks()
+			if err != nil {
+				return fmt.Errorf("error counting chunks: %w", err)
+			}
+		}
+		if candidates >= total {
+			return nil
+		}
+		candidates = int32(min(int64(candidates)*4, int64(total)))
+	}
+}
+
+// EmbeddingIndexSQL returns the statement that creates the index of the chunks of a model
+// stored with a precision. An index needs a fixed dimension, so each model has its own.
+// It returns false when the model has more dimensions than an index of the precision supports.
+func EmbeddingIndexSQL(model EmbeddingModel, precision string) (string, bool) {
+	if model.Dimension > maxIndexDimensions[precision] {
+		return "", false
+	}
+	return fmt.Sprintf("CREATE INDEX ON chunks USING ivfflat ((embedding::%s(%d)) %s_cosine_ops) WHERE model = '%s'",
+		precision, model.Dimension, precision, strings.ReplaceAll(model.Name, "'", "''")), true
+}
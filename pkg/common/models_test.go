@@ -0,0 +1,175 @@
+package common
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// TestCurrentEmbeddingModel tests that the model is chosen by UME_EMBEDDING_MODEL
+func TestCurrentEmbeddingModel(t *testing.T) {
+	original := os.Getenv("UME_EMBEDDING_MODEL")
+	defer os.Setenv("UME_EMBEDDING_MODEL", original)
+
+	os.Setenv("UME_EMBEDDING_MODEL", "")
+	if model, err := CurrentEmbeddingModel(); err != nil || model != DefaultEmbeddingModel {
+		t.Errorf("Expected the default model without UME_EMBEDDING_MODEL, got %v, %v", model, err)
+	}
+
+	os.Setenv("UME_EMBEDDING_MODEL", "text-embedding-3-large")
+	model, err := CurrentEmbeddingModel()
+	if err != nil || model.Dimension != 3072 {
+		t.Errorf("Expected text-embedding-3-large with 3072 dimensions, got %v, %v", model, err)
+	}
+
+	os.Setenv("UME_EMBEDDING_MODEL", "word2vec")
+	if _, err := CurrentEmbeddingModel(); err == nil {
+		t.Error("Expected error for an unknown model, got nil")
+	}
+}
+
+// TestEmbeddingIndexSQL tests that indexes are only created within the dimensions supported by a precision
+func TestEmbeddingIndexSQL(t *testing.T) {
+	large, _ := FindEmbeddingModel("text-embedding-3-large")
+
+	expected := "CREATE INDEX ON chunks USING ivfflat ((embedding::vector(1536)) vector_cosine_ops) WHERE model = 'text-embedding-3-small'"
+	if sql, ok := EmbeddingIndexSQL(DefaultEmbeddingModel, PrecisionFull); !ok || sql != expected {
+		t.Errorf("Expected %q, got %q", expected, sql)
+	}
+
+	if _, ok := EmbeddingIndexSQL(large, PrecisionFull); ok {
+		t.Error("Expected no full precision index for 3072 dimensions")
+	}
+
+	expected = "CREATE INDEX ON chunks USING ivfflat ((embedding::halfvec(3072)) halfvec_cosine_ops) WHERE model = 'text-embedding-3-large'"
+	if sql, ok := EmbeddingIndexSQL(large, PrecisionHalf); !ok || sql != expected {
+		t.Errorf("Expected %q, got %q", expected, sql)
+	}
+}
+
+// TestSearchCandidates tests that searches look up more chunks than the cards they return
+func TestSearchCandidates(t *testing.T) {
+	if got := SearchCandidates(1); got != 200 {
+		t.Errorf("Expected at least 200 candidates, got %d", got)
+	}
+	if got := SearchCandidates(50); got != 1000 {
+		t.Errorf("Expected 1000 candidates for 50 cards, got %d", got)
+	}
+}
+
+// TestWidenCandidates tests that a search is run with more candidates when the filters
+// drop most of them, until it finds enough cards or every chunk was a candidate
+func TestWidenCandidates(t *testing.T) {
+	// One in 100 chunks belongs to a card that passes the filters
+	const total = 10000
+	matching := func(candidates int32) int { return int(candidates) / 100 }
+
+	var tried []int32
+	search := func(candidates int32) (int, error) {
+		tried = append(tried, candidates)
+		return min(matching(candidates), 10), nil
+	}
+	counted := 0
+	chunks := func() (int32, error) {
+		counted++
+		return total, nil
+	}
+
+	if err := WidenCandidates(SearchCandidates(10), 10, search, chunks); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := tried[len(tried)-1]; matching(got) < 10 {
+		t.Errorf("Expected the last search to find 10 cards, it had %d candidates: %v", got, tried)
+	}
+	if counted != 1 {
+		t.Errorf("Expected the chunks to be counted once, got %d", counted)
+	}
+
+	// The search stops once every chunk was a candidate, even if it found fewer cards
+	tried = nil
+	if err := WidenCandidates(SearchCandidates(10), 500, search, chunks); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := tried[len(tried)-1]; got != total {
+		t.Errorf("Expected the last search to have all %d chunks as candidates, got %v", total, tried)
+	}
+
+	// A search that finds enough cards right away doesn't count the chunks
+	tried, counted = nil, 0
+	if err := WidenCandidates(SearchCandidates(1), 1, search, chunks); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(tried) != 1 || counted != 0 {
+		t.Errorf("Expected a single search without counting, got %v and %d counts", tried, counted)
+	}
+}
+
+// TestNearestChunksUsesIndex tests that the closest chunks are found with the index of the
+// model, for the precision the embeddings are stored as
+func TestNearestChunksUsesIndex(t *testing.T) {
+	// Skip this test if DB_STRING isn't set
+	if os.Getenv("DB_STRING") == "" {
+		t.Skip("Skipping test because DB_STRING environment variable is not set")
+	}
+
+	dbpool, _, err := InitDB()
+	if err != nil {
+		t.Fatalf("Error initializing database: %v", err)
+	}
+	defer dbpool.Close()
+
+	ctx := context.Background()
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var precision string
+	err = tx.QueryRow(ctx, `SELECT format_type(atttypid, NULL) FROM pg_attribute
+		WHERE attrelid = 'chunks'::regclass AND attname = 'embedding'`).Scan(&precision)
+	if err != nil {
+		t.Fatalf("Error getting the type of the embeddings: %v", err)
+	}
+
+	// The index is created like ume migrate-embeddings does, and dropped with the transaction
+	sql, ok := EmbeddingIndexSQL(DefaultEmbeddingModel, precision)
+	if !ok {
+		t.Fatalf("Expected an index of %s for %s", DefaultEmbeddingModel.Name, precision)
+	}
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		t.Fatalf("Error creating index: %v", err)
+	}
+
+	// Without rows to scan, only a plan that can't use the index falls back to a sequential scan
+	if _, err := tx.Exec(ctx, "SET LOCAL enable_seqscan = off"); err != nil {
+		t.Fatalf("Error disabling sequential scans: %v", err)
+	}
+
+	var stmt string
+	if err := tx.QueryRow(ctx, "SELECT nearest_chunks_query($1)", DefaultEmbeddingModel.Name).Scan(&stmt); err != nil {
+		t.Fatalf("Error building the nearest chunks statement: %v", err)
+	}
+
+	query := pgvector.NewVector(make([]float32, DefaultEmbeddingModel.Dimension))
+	rows, err := tx.Query(ctx, "EXPLAIN "+stmt, query, 10)
+	if err != nil {
+		t.Fatalf("Error explaining the nearest chunks statement: %v", err)
+	}
+	var plan []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			t.Fatalf("Error reading the plan: %v", err)
+		}
+		plan = append(plan, line)
+	}
+	rows.Close()
+
+	if !strings.Contains(strings.Join(plan, "\n"), "Index Scan") {
+		t.Errorf("Expected an index scan, got:\n%s", strings.Join(plan, "\n"))
+	}
+}
@@ -0,0 +1,141 @@
+package common
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	atxHeadingRe    = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?$`)
+	refImageRe      = regexp.MustCompile(`!\[([^\]]*)\]\[([^\]]*)\]`)
+	refDefinitionRe = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:[ \t]*(\S+)(?:[ \t]+("[^"]*"|'[^']*'|\([^)]*\)))?[ \t]*$`)
+	refLinkRe       = regexp.MustCompile(`\[([^\]]*)\]\[([^\]]*)\]`)
+	shortcutRefRe   = regexp.MustCompile(`\[([^\]]+)\](?:[^(\[:]|$)`)
+)
+
+// NormalizeMarkdown rewrites markdown into a canonical form, so that trivial
+// formatting differences don't produce different hashes. It
+//
+//   - converts line endings to \n and strips trailing whitespace,
+//   - collapses runs of blank lines into a single blank line,
+//   - makes heading levels consistent (starting at # and never skipping a level),
+//   - inlines reference-style image links and drops definitions that are no longer used,
+//   - ends the content with exactly one newline.
+//
+// Fenced code blocks are left untouched.
+func NormalizeMarkdown(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+	lines := strings.Split(content, "\n")
+
+	// Collect reference definitions so image links can be inlined
+	definitions := make(map[string]string)
+	inFence := false
+	for _, line := range lines {
+		if isFence(line) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if m := refDefinitionRe.FindStringSubmatch(line); m != nil {
+			target := m[2]
+			if m[3] != "" {
+				target += " " + m[3]
+			}
+			definitions[strings.ToLower(m[1])] = target
+		}
+	}
+
+	var result []string
+	inFence = false
+	prevLevel := 0
+	for _, line := range lines {
+		if isFence(line) {
+			inFence = !inFence
+			result = append(result, strings.TrimRight(line, " \t"))
+			continue
+		}
+		if inFence {
+			result = append(result, line)
+			continue
+		}
+
+		line = strings.TrimRight(line, " \t")
+
+		// Collapse multiple blank lines
+		if line == "" && (len(result) == 0 || result[len(result)-1] == "") {
+			continue
+		}
+
+		// Make heading levels consistent
+		if m := atxHeadingRe.FindStringSubmatch(line); m != nil && m[2] != "" {
+			level := len(m[1])
+			if level > prevLevel+1 {
+				level = prevLevel + 1
+			}
+			prevLevel = level
+			line = strings.Repeat("#", level) + " " + m[2]
+		}
+
+		// Inline reference-style images
+		line = refImageRe.ReplaceAllStringFunc(line, func(match string) string {
+			m := refImageRe.FindStringSubmatch(match)
+			ref := m[2]
+			if ref == "" {
+				ref = m[1]
+			}
+			target, ok := definitions[strings.ToLower(ref)]
+			if !ok {
+				return match
+			}
+			return "![" + m[1] + "](" + target + ")"
+		})
+
+		result = append(result, line)
+	}
+
+	// Drop definitions that are no longer referenced by any link
+	used := make(map[string]bool)
+	for _, line := range result {
+		if refDefinitionRe.MatchString(line) {
+			continue
+		}
+		for _, m := range refLinkRe.FindAllStringSubmatch(line, -1) {
+			label := m[2]
+			if label == "" {
+				label = m[1]
+			}
+			used[strings.ToLower(label)] = true
+		}
+		for _, m := range shortcutRefRe.FindAllStringSubmatch(line, -1) {
+			used[strings.ToLower(m[1])] = true
+		}
+	}
+
+	var cleaned []string
+	inFence = false
+	for _, line := range result {
+		if isFence(line) {
+			inFence = !inFence
+		}
+		if !inFence {
+			if m := refDefinitionRe.FindStringSubmatch(line); m != nil && !used[strings.ToLower(m[1])] {
+				continue
+			}
+		}
+		if !inFence && line == "" && (len(cleaned) == 0 || cleaned[len(cleaned)-1] == "") {
+			continue
+		}
+		cleaned = append(cleaned, line)
+	}
+
+	return strings.TrimRight(strings.Join(cleaned, "\n"), "\n") + "\n"
+}
+
+// isFence reports whether a line opens or closes a fenced code block
+func isFence(line string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	return strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+}
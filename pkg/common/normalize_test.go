@@ -0,0 +1,58 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestNormalizeMarkdownWhitespace tests line ending, trailing whitespace and blank line handling
+func TestNormalizeMarkdownWhitespace(t *testing.T) {
+	content := "\n# Title  \r\n\r\n\r\nfirst line\t\nsecond line   \n\n\n"
+	expected := "# Title\n\nfirst line\nsecond line\n"
+
+	normalized := NormalizeMarkdown(content)
+	if normalized != expected {
+		t.Errorf("Expected '%q', got: '%q'", expected, normalized)
+	}
+
+	// Normalizing twice should not change the result
+	if NormalizeMarkdown(normalized) != normalized {
+		t.Errorf("Expected normalization to be idempotent, got: '%q'", NormalizeMarkdown(normalized))
+	}
+
+	// Content that differs only in whitespace should hash the same
+	if CalculateFileHash([]byte(NormalizeMarkdown("a  \nb\n\n\n"))) != CalculateFileHash([]byte(NormalizeMarkdown("a\nb"))) {
+		t.Error("Expected whitespace-only differences to produce the same hash")
+	}
+}
+
+// TestNormalizeMarkdownHeadings tests heading level normalization
+func TestNormalizeMarkdownHeadings(t *testing.T) {
+	content := "## Title ##\n\n#### Section\n\n##### Subsection\n\n## Other\n\n#hashtag\n"
+	expected := "# Title\n\n## Section\n\n### Subsection\n\n## Other\n\n#hashtag\n"
+
+	normalized := NormalizeMarkdown(content)
+	if normalized != expected {
+		t.Errorf("Expected '%q', got: '%q'", expected, normalized)
+	}
+}
+
+// TestNormalizeMarkdownReferenceImages tests inlining of reference-style image links
+func TestNormalizeMarkdownReferenceImages(t *testing.T) {
+	content := "# Card\n\n![diagram][fig1] and ![Logo][]\n\nsee [the docs][docs]\n\n[fig1]: https://example.com/fig1.png \"Figure 1\"\n[logo]: https://example.com/logo.png\n[docs]: https://example.com/docs\n"
+	expected := "# Card\n\n![diagram](https://example.com/fig1.png \"Figure 1\") and ![Logo](https://example.com/logo.png)\n\nsee [the docs][docs]\n\n[docs]: https://example.com/docs\n"
+
+	normalized := NormalizeMarkdown(content)
+	if normalized != expected {
+		t.Errorf("Expected '%q', got: '%q'", expected, normalized)
+	}
+}
+
+// TestNormalizeMarkdownCodeFence tests that fenced code blocks are left untouched
+func TestNormalizeMarkdownCodeFence(t *testing.T) {
+	content := "# Code\n\n```\n### not a heading  \n\n\n[x]: unused\n```\n"
+
+	normalized := NormalizeMarkdown(content)
+	if normalized != content {
+		t.Errorf("Expected '%q', got: '%q'", content, normalized)
+	}
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// OCRResult is the text Azure OCR recognized in a card, line by line. It is stored with
+// the markdown converted from it, and rendered as plain text for the conversion prompt.
+type OCRResult struct {
+	Lines []OCRLine `json:"lines"`
+	// Raw is the full response from Azure, only kept when UME_OCR_KEEP_RAW is set
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// Text renders the lines as plain text, one per line
+func (r OCRResult) Text() string {
+	texts := make([]string, len(r.Lines))
+	for i, line := range r.Lines {
+		texts[i] = line.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ParseAzureOCR reads the lines, their bounding boxes and confidences from the response
+// of Azure's Read API
+func ParseAzureOCR(raw []byte) (OCRResult, error) {
+	var payload struct {
+		AnalyzeResult struct {
+			ReadResults []struct {
+				Lines []struct {
+					BoundingBox []int  `json:"boundingBox"`
+					Text        string `json:"text"`
+					Words       []struct {
+						Confidence float64 `json:"confidence"`
+					} `json:"words"`
+				} `json:"lines"`
+			} `json:"readResults"`
+		} `json:"analyzeResult"`
+	}
+
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return OCRResult{}, fmt.Errorf("error decoding OCR result: %w", err)
+	}
+
+	var result OCRResult
+
+	// Cards are single images, so only the first page has to be considered
+	if len(payload.AnalyzeResult.ReadResults) == 0 {
+		return result, nil
+	}
+
+	for _, line := range payload.AnalyzeResult.ReadResults[0].Lines {
+		// The bounding box holds the four corners as x1, y1, ..., x4, y4
+		if len(line.BoundingBox) != 8 {
+			continue
+		}
+
+		x0, y0 := line.BoundingBox[0], line.BoundingBox[1]
+		x1, y1 := x0, y0
+		for i := 2; i < 8; i += 2 {
+			x0, x1 = min(x0, line.BoundingBox[i]), max(x1, line.BoundingBox[i])
+			y0, y1 = min(y0, line.BoundingBox[i+1]), max(y1, line.BoundingBox[i+1])
+		}
+
+		// Lines without words are as certain as it gets
+		confidence := 1.0
+		for _, word := range line.Words {
+			confidence = min(confidence, word.Confidence)
+		}
+
+		result.Lines = append(result.Lines, OCRLine{
+			Text:       line.Text,
+			Region:     Region{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0},
+			Confidence: confidence,
+		})
+	}
+
+	return result, nil
+}
+
+// ParseOCRResult reads a stored OCR result. Raw Azure responses, which were stored before
+// OCRResult, are parsed too. Other results, like the ones from Mistral OCR, have no lines.
+func ParseOCRResult(stored string) (OCRResult, error) {
+	var probe struct {
+		AnalyzeResult json.RawMessage `json:"analyzeResult"`
+	}
+	if err := json.Unmarshal([]byte(stored), &probe); err != nil {
+		return OCRResult{}, fmt.Errorf("error decoding OCR result: %w", err)
+	}
+
+	if probe.AnalyzeResult != nil {
+		return ParseAzureOCR([]byte(stored))
+	}
+
+	var result OCRResult
+	if err := json.Unmarshal([]byte(stored), &result); err != nil {
+		return OCRResult{}, fmt.Errorf("error decoding OCR result: %w", err)
+	}
+	return result, nil
+}
+
+// OCRPromptText returns the text of a stored OCR result to convert to markdown. Azure
+// results are rendered as plain text lines, other results are returned as they are.
+func OCRPromptText(stored string) string {
+	result, err := ParseOCRResult(stored)
+	if err != nil || len(result.Lines) == 0 {
+		return stored
+	}
+	return result.Text()
+}
+
+// DefaultOCRReviewThreshold is the OCR quality below which a card needs review, unless
+// UME_OCR_REVIEW_THRESHOLD is set
+const DefaultOCRReviewThreshold = 0.8
+
+// Quality scores how certain the OCR is of the text, from 0 to 1. It is the confidence of
+// the lines weighted by their length, so a single unsure word counts less than an unsure
+// paragraph. It reports false when there are no lines to score, like for Mistral OCR.
+func (r OCRResult) Quality() (float64, bool) {
+	var sum, total float64
+	for _, line := range r.Lines {
+		weight := float64(utf8.RuneCountInString(strings.TrimSpace(line.Text)))
+		sum += line.Confidence * weight
+		total += weight
+	}
+
+	if total == 0 {
+		return 0, false
+	}
+	return sum / total, true
+}
+
+// OCRReviewThreshold returns the OCR quality below which a card needs review
+func OCRReviewThreshold() float64 {
+	threshold, err := strconv.ParseFloat(os.Getenv("UME_OCR_REVIEW_THRESHOLD"), 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		return DefaultOCRReviewThreshold
+	}
+	return threshold
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// azureResponse is a response of Azure's Read API with two lines
+const azureResponse = `{"status":"succeeded","analyzeResult":{"readResults":[{"lines":[` +
+	`{"boundingBox":[10,20,110,22,109,40,9,38],"text":"Hello world","words":[{"text":"Hello","confidence":0.98},{"text":"world","confidence":0.61}]},` +
+	`{"boundingBox":[10,50,60,50,60,70,10,70],"text":"second"}]}]}}`
+
+// TestParseAzureOCR tests the ParseAzureOCR function
+func TestParseAzureOCR(t *testing.T) {
+	result, err := ParseAzureOCR([]byte(azureResponse))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(result.Lines) != 2 {
+		t.Fatalf("Expected 2 lines, got: %v", result.Lines)
+	}
+
+	// The confidence of a line is the lowest of its words
+	if result.Lines[0].Confidence != 0.61 {
+		t.Errorf("Expected confidence 0.61, got %v", result.Lines[0].Confidence)
+	}
+	if result.Lines[1].Confidence != 1 {
+		t.Errorf("Expected confidence 1 for a line without words, got %v", result.Lines[1].Confidence)
+	}
+
+	if text := result.Text(); text != "Hello world\nsecond" {
+		t.Errorf("Expected the lines as text, got %q", text)
+	}
+}
+
+// TestOCRPromptText tests the OCRPromptText function
+func TestOCRPromptText(t *testing.T) {
+	// Test a stored OCRResult
+	result, _ := ParseAzureOCR([]byte(azureResponse))
+	stored, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to encode OCR result: %v", err)
+	}
+	if text := OCRPromptText(string(stored)); text != "Hello world\nsecond" {
+		t.Errorf("Expected the lines as text, got %q", text)
+	}
+
+	// Test a raw Azure response stored before OCRResult
+	if text := OCRPromptText(azureResponse); text != "Hello world\nsecond" {
+		t.Errorf("Expected the lines of the raw response as text, got %q", text)
+	}
+
+	// Test that other results, like Mistral's markdown, are kept as they are
+	if text := OCRPromptText("# Hello\n\nworld"); text != "# Hello\n\nworld" {
+		t.Errorf("Expected the markdown as it is, got %q", text)
+	}
+}
+
+// TestParseOCRResult tests that stored results keep their regions
+func TestParseOCRResult(t *testing.T) {
+	stored := `{"lines":[{"text":"Hello","region":{"x":1,"y":2,"width":3,"height":4},"confidence":0.9}]}`
+
+	result, err := ParseOCRResult(stored)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(result.Lines) != 1 || result.Lines[0].Region != (Region{X: 1, Y: 2, Width: 3, Height: 4}) {
+		t.Errorf("Expected one line with its region, got %v", result.Lines)
+	}
+}
+
+// TestOCRResultQuality tests the Quality method of OCRResult
+func TestOCRResultQuality(t *testing.T) {
+	// Lines are weighted by their length
+	result := OCRResult{Lines: []OCRLine{
+		{Text: "abc", Confidence: 0.5},
+		{Text: "a", Confidence: 0.9},
+	}}
+	quality, ok := result.Quality()
+	if !ok {
+		t.Fatal("Expected a quality for a result with lines")
+	}
+	if quality < 0.599 || quality > 0.601 {
+		t.Errorf("Expected quality 0.6, got %v", quality)
+	}
+
+	// Test a result without lines, like the ones from Mistral OCR
+	if _, ok := (OCRResult{}).Quality(); ok {
+		t.Error("Expected no quality for a result without lines")
+	}
+
+	// Test a result with only blank lines
+	if _, ok := (OCRResult{Lines: []OCRLine{{Text: " ", Confidence: 0.1}}}).Quality(); ok {
+		t.Error("Expected no quality for a result with only blank lines")
+	}
+}
+
+// TestOCRReviewThreshold tests the OCRReviewThreshold function
+func TestOCRReviewThreshold(t *testing.T) {
+	t.Setenv("UME_OCR_REVIEW_THRESHOLD", "")
+	if threshold := OCRReviewThreshold(); threshold != DefaultOCRReviewThreshold {
+		t.Errorf("Expected the default threshold, got %v", threshold)
+	}
+
+	t.Setenv("UME_OCR_REVIEW_THRESHOLD", "0.5")
+	if threshold := OCRReviewThreshold(); threshold != 0.5 {
+		t.Errorf("Expected threshold 0.5, got %v", threshold)
+	}
+
+	// Values outside 0 to 1 are ignored
+	t.Setenv("UME_OCR_REVIEW_THRESHOLD", "5")
+	if threshold := OCRReviewThreshold(); threshold != DefaultOCRReviewThreshold {
+		t.Errorf("Expected the default threshold for an invalid value, got %v", threshold)
+	}
+}
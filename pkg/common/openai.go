@@ -1,6 +1,7 @@
 package common
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -9,6 +10,10 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // ocr2md sends an OCR result to OpenAI's API and returns the formatted Markdown output.
@@ -17,17 +22,60 @@ import (
 //	key   - OpenAI API key.
 //	model - The model to use (e.g., "o1-mini").
 //	ocr   - OCR result text as a JSON string.
+//	live  - Where the markdown is written as it is generated, or nil.
 //
 // Returns:
 //
 //	A string containing the formatted markdown and an error if any occurred.
-func Ocr2md(key, model, ocr string) (string, error) {
-	// OpenAI API endpoint
-	url := "https://api.openai.com/v1/chat/completions"
+func Ocr2md(key, model, ocr string, live io.Writer) (string, error) {
+	return ocr2md(key, model, ocr2mdPrompt, ocr, live)
+}
+
+// HandwritingOcr2md converts the OCR result of handwriting to markdown like Ocr2md,
+// with a prompt that marks words it can't make out with [?] instead of guessing.
+func HandwritingOcr2md(key, model, ocr string, live io.Writer) (string, error) {
+	return ocr2md(key, model, handwritingOcr2mdPrompt, ocr, live)
+}
+
+const (
+	ocr2mdPrompt            = "Reconstruct the following OCR file into a Markdown file. If parts of the output look like an error, delete or modify them. You might need to change the heading or create lists or even tables. Here is the OCR result:\n\n"
+	handwritingOcr2mdPrompt = "Reconstruct the following OCR file of handwritten notes into a Markdown file. Handwriting is often recognized incorrectly: fix words only when the intended word is clear from the context, and when a word is uncertain keep your best reading followed by [?], or write [?] alone if it can't be read at all. Do not add content that is not in the notes. You might need to change the heading or create lists or even tables. Here is the OCR result:\n\n"
+)
 
+// ocr2mdAttempts is how many times a conversion that was cut off is tried
+const ocr2mdAttempts = 3
+
+// errIncompleteMarkdown is returned when the markdown stream ended before the conversion finished
+var errIncompleteMarkdown = errors.New("the markdown was cut off")
+
+// ocr2md sends an OCR result with a prompt to OpenAI's API and returns the formatted Markdown output.
+// The output is streamed, so a conversion that is cut off is noticed as soon as the stream ends
+// and tried again.
+func ocr2md(key, model, prompt, ocr string, live io.Writer) (string, error) {
+	var err error
+	for attempt := 1; attempt <= ocr2mdAttempts; attempt++ {
+		var md string
+		md, err = streamOcr2md(key, model, prompt, ocr, live)
+		if err == nil {
+			return md, nil
+		}
+		if !errors.Is(err, errIncompleteMarkdown) {
+			return "", err
+		}
+		if attempt < ocr2mdAttempts {
+			ReportRetry("%v, converting again (attempt %d of %d)", err, attempt+1, ocr2mdAttempts)
+		}
+	}
+	return "", err
+}
+
+// streamOcr2md converts an OCR result to markdown with a single streamed request,
+// writing the markdown to live as it arrives
+func streamOcr2md(key, model, prompt, ocr string, live io.Writer) (string, error) {
 	// Define the request payload
 	reqPayload := map[string]interface{}{
-		"model": model,
+		"model":  model,
+		"stream": true,
 		"messages": []map[string]string{
 			{
 				"role":    "assistant",
@@ -35,7 +83,7 @@ func Ocr2md(key, model, ocr string) (string, error) {
 			},
 			{
 				"role":    "user",
-				"content": "Reconstruct the following OCR file into a Markdown file. If parts of the output look like an error, delete or modify them. You might need to change the heading or create lists or even tables. Here is the OCR result:\n\n" + ocr,
+				"content": prompt + ocr,
 			},
 		},
 	}
@@ -47,51 +95,75 @@ func Ocr2md(key, model, ocr string) (string, error) {
 	}
 
 	// Create HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := OpenAIEndpointFor(OpenAIChat).newRequest("chat/completions", model, key, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+key)
 
 	// Execute the request
-	resp, err := http.DefaultClient.Do(req)
+	ctx, cancel := CallContext()
+	defer cancel()
+	resp, err := HTTPClient().Do(req.WithContext(ctx))
 	if err != nil {
-		return "", err
+		return "", &ProviderError{Provider: "OpenAI", Err: err}
 	}
 	defer resp.Body.Close()
 
 	// Check HTTP status
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", errors.New("API request failed: " + string(bodyBytes))
-	}
-
-	// Parse response JSON
-	var resPayload struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-
-			FinishReason string `json:"finish_reason"`
-		} `json:"choices"`
+		return "", responseError("OpenAI", resp)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&resPayload); err != nil {
-		return "", err
+	// Every server-sent event holds the next piece of the markdown
+	var md strings.Builder
+	finishReason := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return "", fmt.Errorf("error decoding stream: %w", err)
+		}
+		if len(event.Choices) == 0 {
+			continue
+		}
+
+		content := event.Choices[0].Delta.Content
+		md.WriteString(content)
+		if live != nil && content != "" {
+			io.WriteString(live, content)
+		}
+		if event.Choices[0].FinishReason != nil {
+			finishReason = *event.Choices[0].FinishReason
+		}
 	}
-
-	// Extract Markdown content
-	if len(resPayload.Choices) == 0 {
-		return "", errors.New("no valid response from API")
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("%w: %w", errIncompleteMarkdown, err)
 	}
 
-	if resPayload.Choices[0].FinishReason != "stop" {
-		return "", errors.New("finish reason is not 'stop.'")
+	switch finishReason {
+	case "stop":
+		return md.String(), nil
+	case "":
+		return "", fmt.Errorf("%w: the stream ended early", errIncompleteMarkdown)
+	case "length":
+		return "", fmt.Errorf("%w: the token limit was reached", errIncompleteMarkdown)
+	default:
+		return "", fmt.Errorf("finish reason is %q, not 'stop'", finishReason)
 	}
-
-	return resPayload.Choices[0].Message.Content, nil
 }
 
 type EmbeddingData struct {
@@ -106,10 +178,79 @@ func (a ByIndex) Len() int           { return len(a) }
 func (a ByIndex) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByIndex) Less(i, j int) bool { return a[i].Index < a[j].Index }
 
-/* calculate a list of embeddings data from a list of strings */
-func LineEmbeddings(key, model string, dimension uint, texts []string) ([][]float64, error) {
+// EmbeddingBatchSize is the number of chunks sent in one embeddings request
+const EmbeddingBatchSize = 64
 
-	url := "https://api.openai.com/v1/embeddings"
+// EmbeddingWorkers is the number of embeddings requests sent at the same time
+const EmbeddingWorkers = 4
+
+// EmbeddingPricePerMillionTokens is the price in USD of text-embedding-3-small
+const EmbeddingPricePerMillionTokens = 0.02
+
+// EstimateEmbeddingCost estimates the tokens and the price in USD of embedding chunks
+func EstimateEmbeddingCost(chunks []string) (int, float64) {
+	tokens := 0
+	for _, chunk := range chunks {
+		tokens += EstimateTokens(chunk)
+	}
+	return tokens, float64(tokens) * EmbeddingPricePerMillionTokens / 1e6
+}
+
+// LineEmbeddings calculates a list of embeddings from a list of strings.
+// Long lists are split into batches which are embedded by a bounded pool of workers.
+// The embeddings are returned in the order of the texts, and the errors of all failed
+// batches are reported together.
+func LineEmbeddings(key, model string, dimension uint, texts []string) (embeddings [][]float64, err error) {
+	span := StartSpan("embeddings", "openai.model", model, "embeddings.chunks", strconv.Itoa(len(texts)))
+	defer func() { span.End(err) }()
+
+	if len(texts) <= EmbeddingBatchSize {
+		return embedBatch(key, model, dimension, texts)
+	}
+
+	result := make([][]float64, len(texts))
+	errs := make([]error, (len(texts)+EmbeddingBatchSize-1)/EmbeddingBatchSize)
+
+	batches := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(EmbeddingWorkers, len(errs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				start := b * EmbeddingBatchSize
+				end := min(start+EmbeddingBatchSize, len(texts))
+
+				embeddings, err := embedBatch(key, model, dimension, texts[start:end])
+				if err != nil {
+					errs[b] = fmt.Errorf("chunks %d-%d: %w", start, end-1, err)
+					continue
+				}
+				copy(result[start:end], embeddings)
+			}
+		}()
+	}
+
+	for b := range errs {
+		batches <- b
+	}
+	close(batches)
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// embedBatch calculates the embeddings of texts with a single request
+func embedBatch(key, model string, dimension uint, texts []string) (embeddings [][]float64, err error) {
+	span := startLeafSpan("embeddings.batch", "embeddings.chunks", strconv.Itoa(len(texts)))
+	start := time.Now()
+	defer func() {
+		span.End(err)
+		ObserveDuration("ume_embedding_request_duration_seconds", "Duration of embeddings requests.", time.Since(start), "model", model, "result", metricResult(err))
+	}()
 
 	reqPayload := map[string]interface{}{
 		"input":           texts,
@@ -124,23 +265,27 @@ func LineEmbeddings(key, model string, dimension uint, texts []string) ([][]floa
 		return [][]float64{}, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := OpenAIEndpointFor(OpenAIEmbeddings).newRequest("embeddings", model, key, bytes.NewBuffer(jsonData))
 
 	if err != nil {
 		return [][]float64{}, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+key)
-	req.Header.Set("Content-Type", "application/json")
-
 	var resPayload struct {
 		Data []EmbeddingData `json:"data"`
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	ctx, cancel := CallContext()
+	defer cancel()
+	resp, err := HTTPClient().Do(req.WithContext(ctx))
 
 	if err != nil {
-		return [][]float64{}, err
+		return [][]float64{}, &ProviderError{Provider: "OpenAI", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return [][]float64{}, responseError("OpenAI", resp)
 	}
 
 	// sort
@@ -151,6 +296,10 @@ func LineEmbeddings(key, model string, dimension uint, texts []string) ([][]floa
 	data := resPayload.Data
 	sort.Sort(ByIndex(data))
 
+	if len(data) != len(texts) {
+		return [][]float64{}, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(data))
+	}
+
 	result := make([][]float64, len(data))
 	for i, eData := range data {
 		result[i] = eData.Embedding
@@ -162,13 +311,15 @@ func LineEmbeddings(key, model string, dimension uint, texts []string) ([][]floa
 type OpenAIClient struct {
 	ApiKey string
 	Model  string
+	// Endpoint is the API the requests are sent to
+	Endpoint OpenAIEndpoint
 }
 
 // NewOpenAIClient creates a new OpenAI client
 func NewOpenAIClient() (*OpenAIClient, error) {
-	apiKey := os.Getenv("OPENAI_KEY")
+	apiKey := Secret("OPENAI_KEY")
 	if apiKey == "" {
-		return nil, errors.New("OPENAI_KEY environment variable not set")
+		return nil, missingEnvError("OPENAI_KEY")
 	}
 
 	// Default to a reasonable model if not specified
@@ -178,27 +329,78 @@ func NewOpenAIClient() (*OpenAIClient, error) {
 	}
 
 	return &OpenAIClient{
-		ApiKey: apiKey,
-		Model:  model,
+		ApiKey:   apiKey,
+		Model:    model,
+		Endpoint: OpenAIEndpointFor(OpenAIChat),
 	}, nil
 }
 
 // TranslateText translates the given text to the specified language using OpenAI
 func (c *OpenAIClient) TranslateText(text, targetLanguage string) (string, error) {
-	url := "https://api.openai.com/v1/chat/completions"
-
 	prompt := fmt.Sprintf("Translate the following text to %s. Preserve the markdown formatting:\n\n%s", targetLanguage, text)
 
+	return c.complete(
+		"You are a professional translator. Translate the given text while preserving all markdown formatting exactly as it appears in the original text.",
+		prompt,
+	)
+}
+
+// GenerateTitle generates a short title for the given markdown using OpenAI
+func (c *OpenAIClient) GenerateTitle(markdown string) (string, error) {
+	title, err := c.complete(
+		"You write short titles for note cards. Output only the title, in the same language as the note, without quotes or any additional explanation.",
+		"Write a title of at most 8 words for the following note:\n\n"+markdown,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(strings.TrimSpace(title), "\"'「」#* "), nil
+}
+
+// TranscriptToMarkdown formats the transcript of a voice memo as a markdown note using OpenAI
+func (c *OpenAIClient) TranscriptToMarkdown(transcript string) (string, error) {
+	return c.complete(
+		"You turn transcripts of voice memos into markdown notes. Keep the wording and the language of the speaker, only remove filler words and false starts, and add headings, lists or paragraphs where they help. Output only the final markdown without any additional explanation, and without a code block around it.",
+		"Format the following transcript as a markdown note:\n\n"+transcript,
+	)
+}
+
+// LabelTopic generates a short topic label for a group of related texts using OpenAI
+func (c *OpenAIClient) LabelTopic(texts []string) (string, error) {
+	label, err := c.complete(
+		"You name topics for groups of note excerpts. Output only the topic name, in the same language as the excerpts, without quotes or any additional explanation.",
+		"Name the common topic of the following excerpts in at most 5 words:\n\n- "+strings.Join(texts, "\n- "),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(strings.TrimSpace(label), "\"'「」#* "), nil
+}
+
+// SmoothTransitions rewrites the joins between the sections of a document composed from
+// cards using OpenAI, so it reads as one text. The sections, their headings and the
+// comments naming their cards are kept.
+func (c *OpenAIClient) SmoothTransitions(document string) (string, error) {
+	return c.complete(
+		"You edit drafts composed from note cards, one section per card. Add a sentence or two where needed so each section leads into the next, and otherwise change as little as possible. Keep every section in its order with its heading, keep the <!-- card:N --> comments, and write in the language of the draft. Output only the final markdown without any additional explanation, and without a code block around it.",
+		"Smooth the transitions of the following draft:\n\n"+document,
+	)
+}
+
+// complete sends a system and a user message to the chat completions API and returns the reply
+func (c *OpenAIClient) complete(systemPrompt, userPrompt string) (string, error) {
 	reqPayload := map[string]interface{}{
 		"model": c.Model,
 		"messages": []map[string]string{
 			{
 				"role":    "system",
-				"content": "You are a professional translator. Translate the given text while preserving all markdown formatting exactly as it appears in the original text.",
+				"content": systemPrompt,
 			},
 			{
 				"role":    "user",
-				"content": prompt,
+				"content": userPrompt,
 			},
 		},
 	}
@@ -208,22 +410,21 @@ func (c *OpenAIClient) TranslateText(text, targetLanguage string) (string, error
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := c.Endpoint.newRequest("chat/completions", c.Model, c.ApiKey, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.ApiKey)
 
-	resp, err := http.DefaultClient.Do(req)
+	ctx, cancel := CallContext()
+	defer cancel()
+	resp, err := HTTPClient().Do(req.WithContext(ctx))
 	if err != nil {
-		return "", err
+		return "", &ProviderError{Provider: "OpenAI", Err: err}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		return "", responseError("OpenAI", resp)
 	}
 
 	var resPayload struct {
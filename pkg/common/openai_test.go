@@ -0,0 +1,311 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGenerateTitle(t *testing.T) {
+	// Set up a mock server to handle the chat completion request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Verify headers
+		authHeader := r.Header.Get("Authorization")
+		if authHeader != "Bearer test-key" {
+			t.Errorf("Expected Authorization header 'Bearer test-key', got %s", authHeader)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// Read and validate request body
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read request body: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var reqBody struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.Unmarshal(body, &reqBody); err != nil {
+			t.Errorf("Failed to unmarshal request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if reqBody.Model != "test-model" {
+			t.Errorf("Expected model 'test-model', got '%s'", reqBody.Model)
+		}
+
+		if len(reqBody.Messages) != 2 || !strings.Contains(reqBody.Messages[1].Content, "card content") {
+			t.Errorf("Expected the note in the user message, got %v", reqBody.Messages)
+		}
+
+		// Return a successful response with a quoted title
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"\"The Card Method\"\n"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	// Save the original function and replace with our test version
+	originalHTTPNewRequest := httpNewRequest
+	defer func() {
+		httpNewRequest = originalHTTPNewRequest
+	}()
+
+	httpNewRequest = func(method, url string, body io.Reader) (*http.Request, error) {
+		return http.NewRequest(method, server.URL, body)
+	}
+
+	client := &OpenAIClient{ApiKey: "test-key", Model: "test-model"}
+	title, err := client.GenerateTitle("# Notes\n\ncard content")
+	if err != nil {
+		t.Fatalf("GenerateTitle returned an error: %v", err)
+	}
+
+	if title != "The Card Method" {
+		t.Errorf("Expected title 'The Card Method', got '%s'", title)
+	}
+}
+
+func TestLineEmbeddings(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning, requests := 0, 0, 0
+
+	// The mock server embeds every text as its length, in reverse order like the API may
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		requests++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+
+		var reqBody struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(reqBody.Input) > EmbeddingBatchSize {
+			t.Errorf("Expected at most %d texts in a request, got %d", EmbeddingBatchSize, len(reqBody.Input))
+		}
+		if reqBody.Input[0] == "fail" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("rate limited"))
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		var data []EmbeddingData
+		for i := len(reqBody.Input) - 1; i >= 0; i-- {
+			data = append(data, EmbeddingData{Embedding: []float64{float64(len(reqBody.Input[i]))}, Index: i})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer server.Close()
+
+	originalHTTPNewRequest := httpNewRequest
+	defer func() {
+		httpNewRequest = originalHTTPNewRequest
+	}()
+
+	httpNewRequest = func(method, url string, body io.Reader) (*http.Request, error) {
+		return http.NewRequest(method, server.URL, body)
+	}
+
+	texts := make([]string, EmbeddingBatchSize*EmbeddingWorkers*2+1)
+	for i := range texts {
+		texts[i] = strings.Repeat("x", i)
+	}
+
+	embeddings, err := LineEmbeddings("test-key", "test-model", 3, texts)
+	if err != nil {
+		t.Fatalf("LineEmbeddings returned an error: %v", err)
+	}
+	if len(embeddings) != len(texts) {
+		t.Fatalf("Expected %d embeddings, got %d", len(texts), len(embeddings))
+	}
+	for i, embedding := range embeddings {
+		if embedding[0] != float64(i) {
+			t.Errorf("Expected embedding %d to be in order, got %v", i, embedding)
+			break
+		}
+	}
+
+	if requests != len(texts)/EmbeddingBatchSize+1 {
+		t.Errorf("Expected %d requests, got %d", len(texts)/EmbeddingBatchSize+1, requests)
+	}
+	if maxRunning > EmbeddingWorkers {
+		t.Errorf("Expected at most %d requests at a time, got %d", EmbeddingWorkers, maxRunning)
+	}
+
+	// Test that the errors of all failed batches are reported
+	texts[0] = "fail"
+	texts[2*EmbeddingBatchSize] = "fail"
+	_, err = LineEmbeddings("test-key", "test-model", 3, texts)
+	if err == nil {
+		t.Fatal("Expected an error for failed batches")
+	}
+	if !strings.Contains(err.Error(), "chunks 0-63") || !strings.Contains(err.Error(), "chunks 128-191") {
+		t.Errorf("Expected both failed batches in the error, got: %v", err)
+	}
+}
+
+func TestOcr2mdStream(t *testing.T) {
+	requests := 0
+
+	// The first stream is cut off, the second one finishes
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		var reqBody struct {
+			Stream bool `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		if !reqBody.Stream {
+			t.Error("Expected a streamed request")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"# Title\\n\"},\"finish_reason\":null}]}\n\n"))
+		if requests == 1 {
+			return
+		}
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"body\"},\"finish_reason\":null}]}\n\n"))
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	originalHTTPNewRequest := httpNewRequest
+	defer func() {
+		httpNewRequest = originalHTTPNewRequest
+	}()
+
+	httpNewRequest = func(method, url string, body io.Reader) (*http.Request, error) {
+		return http.NewRequest(method, server.URL, body)
+	}
+
+	var live strings.Builder
+	md, err := Ocr2md("test-key", "test-model", "ocr text", &live)
+	if err != nil {
+		t.Fatalf("Ocr2md returned an error: %v", err)
+	}
+
+	if md != "# Title\nbody" {
+		t.Errorf("Expected the markdown of the second stream, got %q", md)
+	}
+	if requests != 2 {
+		t.Errorf("Expected the cut off stream to be retried once, got %d requests", requests)
+	}
+	if live.String() != "# Title\n# Title\nbody" {
+		t.Errorf("Expected both streams to be shown live, got %q", live.String())
+	}
+}
+
+func TestOcr2mdTokenLimit(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"# Ti\"},\"finish_reason\":\"length\"}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	originalHTTPNewRequest := httpNewRequest
+	defer func() {
+		httpNewRequest = originalHTTPNewRequest
+	}()
+
+	httpNewRequest = func(method, url string, body io.Reader) (*http.Request, error) {
+		return http.NewRequest(method, server.URL, body)
+	}
+
+	_, err := Ocr2md("test-key", "test-model", "ocr text", nil)
+	if err == nil || !strings.Contains(err.Error(), "token limit") {
+		t.Errorf("Expected a token limit error, got: %v", err)
+	}
+	if requests != ocr2mdAttempts {
+		t.Errorf("Expected %d attempts, got %d", ocr2mdAttempts, requests)
+	}
+}
+
+// TestEstimateEmbeddingCost tests the EstimateEmbeddingCost function
+func TestEstimateEmbeddingCost(t *testing.T) {
+	tokens, cost := EstimateEmbeddingCost([]string{"abcdefgh", "梅棹"})
+	if tokens != 4 {
+		t.Errorf("Expected 4 tokens, got %d", tokens)
+	}
+	if expected := 4 * EmbeddingPricePerMillionTokens / 1e6; cost != expected {
+		t.Errorf("Expected a cost of %g, got %g", expected, cost)
+	}
+
+	if tokens, cost := EstimateEmbeddingCost(nil); tokens != 0 || cost != 0 {
+		t.Errorf("Expected no cost without chunks, got %d tokens and %g", tokens, cost)
+	}
+}
+
+func TestOpenAIEndpoint(t *testing.T) {
+	t.Setenv("OPENAI_BASE_URL", "")
+	t.Setenv("OPENAI_API_VERSION", "")
+	t.Setenv("OPENAI_EMBEDDINGS_BASE_URL", "")
+	t.Setenv("OPENAI_EMBEDDINGS_API_VERSION", "")
+
+	// Test that OpenAI is used by default
+	if url := OpenAIEndpointFor(OpenAIChat).URL("chat/completions", "gpt-4o"); url != "https://api.openai.com/v1/chat/completions" {
+		t.Errorf("Expected the OpenAI URL by default, got %s", url)
+	}
+
+	// Test that a gateway is used for every purpose
+	t.Setenv("OPENAI_BASE_URL", "http://localhost:4000/v1/")
+	if url := OpenAIEndpointFor(OpenAIEmbeddings).URL("embeddings", "text-embedding-3-small"); url != "http://localhost:4000/v1/embeddings" {
+		t.Errorf("Expected the gateway URL, got %s", url)
+	}
+
+	// Test that a purpose can be sent to Azure OpenAI
+	t.Setenv("OPENAI_EMBEDDINGS_BASE_URL", "https://example.openai.azure.com")
+	t.Setenv("OPENAI_EMBEDDINGS_API_VERSION", "2024-10-21")
+	endpoint := OpenAIEndpointFor(OpenAIEmbeddings)
+	if url := endpoint.URL("embeddings", "my embeddings"); url != "https://example.openai.azure.com/openai/deployments/my%20embeddings/embeddings?api-version=2024-10-21" {
+		t.Errorf("Expected the Azure deployment URL, got %s", url)
+	}
+	if url := OpenAIEndpointFor(OpenAIChat).URL("chat/completions", "gpt-4o"); url != "http://localhost:4000/v1/chat/completions" {
+		t.Errorf("Expected the other purposes to use the gateway, got %s", url)
+	}
+
+	// Test that Azure OpenAI gets the key in its own header
+	req, err := endpoint.newRequest("embeddings", "my-embeddings", "test-key", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("newRequest returned an error: %v", err)
+	}
+	if req.Header.Get("api-key") != "test-key" || req.Header.Get("Authorization") != "" {
+		t.Errorf("Expected the key in the api-key header, got %v", req.Header)
+	}
+
+	req, err = OpenAIEndpoint{}.newRequest("embeddings", "text-embedding-3-small", "test-key", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("newRequest returned an error: %v", err)
+	}
+	if req.Header.Get("Authorization") != "Bearer test-key" || req.Header.Get("api-key") != "" {
+		t.Errorf("Expected the key as a bearer token, got %v", req.Header)
+	}
+}
@@ -0,0 +1,256 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// spinnerFrames are drawn in turn while a stage is running
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinnerInterval is how often the spinner is redrawn
+const spinnerInterval = 100 * time.Millisecond
+
+// activeProgress is the spinner being drawn, which retries deep in the pipeline are reported to
+var (
+	activeProgress   *Progress
+	activeProgressMu sync.Mutex
+)
+
+// Progress shows the stage of a long operation with a spinner, the elapsed time and the
+// number of retries. The spinner is only drawn when stderr is a terminal, and nothing is
+// shown when quiet.
+type Progress struct {
+	out     io.Writer
+	quiet   bool
+	spinner bool
+
+	mu           sync.Mutex
+	stage        string
+	stageStarted time.Time
+	retries      int
+	frame        int
+	streaming    bool
+	lineStart    bool
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewProgress starts showing the progress of an operation. Call Done when it finishes.
+func NewProgress(quiet bool) *Progress {
+	p := &Progress{
+		out:     os.Stderr,
+		quiet:   quiet,
+		spinner: !quiet && IsTerminal(os.Stderr),
+		stop:    make(chan struct{}),
+	}
+
+	if p.spinner {
+		activeProgressMu.Lock()
+		activeProgress = p
+		activeProgressMu.Unlock()
+
+		go p.spin()
+	}
+	return p
+}
+
+// IsTerminal reports whether a file is a terminal rather than a pipe or a regular file
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// NoInput is set by the global --no-input flag, for scripts and cron jobs that must
+// never wait for input
+var NoInput bool
+
+// ErrInputRequired is returned when a command has to ask the user but can't
+var ErrInputRequired = errors.New("input required")
+
+// CanPrompt reports whether the user can be asked for input: standard input is a
+// terminal and --no-input isn't set
+func CanPrompt() bool {
+	return !NoInput && IsTerminal(os.Stdin)
+}
+
+// Stage finishes the current stage and starts the next one
+func (p *Progress) Stage(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.finishStage()
+	p.stage = name
+	p.stageStarted = time.Now()
+	p.retries = 0
+	p.draw()
+}
+
+// Retry counts a retry of the current stage. Without a spinner, or while text is
+// streamed, the reason is printed.
+func (p *Progress) Retry(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.retries++
+	if p.quiet {
+		return
+	}
+	if !p.spinner || p.streaming {
+		// The text streamed so far is discarded, so the reason is kept below it
+		p.endStream()
+		fmt.Fprintf(p.out, format+"\n", args...)
+		return
+	}
+	p.draw()
+}
+
+// Printf prints a message to stdout above the spinner, unless quiet
+func (p *Progress) Printf(format string, args ...any) {
+	if p.quiet {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.endStream()
+	p.clear()
+	fmt.Printf(format, args...)
+	p.draw()
+}
+
+// Live returns a writer that shows generated text as it arrives in place of the spinner,
+// or nil when there is no spinner. The spinner is drawn again with the next stage.
+func (p *Progress) Live() io.Writer {
+	if !p.spinner {
+		return nil
+	}
+	return liveWriter{p}
+}
+
+// liveWriter writes streamed text to the terminal of a Progress
+type liveWriter struct {
+	p *Progress
+}
+
+// Write shows the text, replacing the spinner line when the stream starts
+func (w liveWriter) Write(b []byte) (int, error) {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if !w.p.streaming {
+		w.p.clear()
+		w.p.streaming = true
+	}
+	w.p.lineStart = b[len(b)-1] == '\n'
+	return w.p.out.Write(b)
+}
+
+// Done finishes the last stage and stops the spinner
+func (p *Progress) Done() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+
+		activeProgressMu.Lock()
+		if activeProgress == p {
+			activeProgress = nil
+		}
+		activeProgressMu.Unlock()
+	})
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.finishStage()
+	p.stage = ""
+}
+
+// ReportRetry reports a retry to the spinner being drawn, or prints the reason when
+// there is none
+func ReportRetry(format string, args ...any) {
+	activeProgressMu.Lock()
+	p := activeProgress
+	activeProgressMu.Unlock()
+
+	if p == nil {
+		fmt.Printf(format+"\n", args...)
+		return
+	}
+	p.Retry(format, args...)
+}
+
+// spin redraws the spinner until the progress is done
+func (p *Progress) spin() {
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame++
+			p.draw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// endStream ends the streamed text on its own line, so the spinner can be drawn again
+func (p *Progress) endStream() {
+	if !p.streaming {
+		return
+	}
+	if !p.lineStart {
+		fmt.Fprintln(p.out)
+	}
+	p.streaming = false
+}
+
+// finishStage replaces the spinner of the current stage with the time it took
+func (p *Progress) finishStage() {
+	p.endStream()
+	if !p.spinner || p.stage == "" {
+		return
+	}
+
+	p.clear()
+	fmt.Fprintf(p.out, "✓ %s (%s)\n", p.stage, formatElapsed(time.Since(p.stageStarted)))
+}
+
+// draw draws the spinner line of the current stage
+func (p *Progress) draw() {
+	if !p.spinner || p.stage == "" || p.streaming {
+		return
+	}
+
+	line := fmt.Sprintf("%s %s %s", spinnerFrames[p.frame%len(spinnerFrames)], p.stage, formatElapsed(time.Since(p.stageStarted)))
+	if p.retries > 0 {
+		line += fmt.Sprintf(" (retry %d)", p.retries)
+	}
+	fmt.Fprintf(p.out, "\r\x1b[K%s", line)
+}
+
+// clear removes the spinner line
+func (p *Progress) clear() {
+	if p.spinner {
+		fmt.Fprint(p.out, "\r\x1b[K")
+	}
+}
+
+// formatElapsed formats a duration with a tenth of a second precision
+func formatElapsed(d time.Duration) string {
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
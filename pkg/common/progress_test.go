@@ -0,0 +1,91 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestProgressWithoutTerminal tests that only retries are printed without a terminal
+func TestProgressWithoutTerminal(t *testing.T) {
+	var out bytes.Buffer
+	p := &Progress{out: &out, stop: make(chan struct{})}
+
+	p.Stage("Extracting text")
+	p.Retry("attempt %d failed", 1)
+	p.Done()
+
+	if out.String() != "attempt 1 failed\n" {
+		t.Errorf("Expected only the retry, got %q", out.String())
+	}
+	if p.retries != 1 {
+		t.Errorf("Expected 1 retry, got %d", p.retries)
+	}
+}
+
+// TestProgressSpinner tests the lines drawn on a terminal
+func TestProgressSpinner(t *testing.T) {
+	var out bytes.Buffer
+	p := &Progress{out: &out, spinner: true, stop: make(chan struct{})}
+
+	p.Stage("Uploading image")
+	if !strings.HasSuffix(out.String(), "⠋ Uploading image 0.0s") {
+		t.Errorf("Expected the spinner line, got %q", out.String())
+	}
+
+	p.Retry("failed")
+	if !strings.HasSuffix(out.String(), "(retry 1)") {
+		t.Errorf("Expected the retry count, got %q", out.String())
+	}
+
+	// Finished stages are kept with the time they took
+	p.Stage("Generating embeddings")
+	if !strings.Contains(out.String(), "✓ Uploading image (0.0s)\n") {
+		t.Errorf("Expected the finished stage, got %q", out.String())
+	}
+
+	p.Done()
+	if !strings.HasSuffix(out.String(), "✓ Generating embeddings (0.0s)\n") {
+		t.Errorf("Expected the last stage to be finished, got %q", out.String())
+	}
+}
+
+// TestProgressQuiet tests that nothing is shown when quiet
+func TestProgressQuiet(t *testing.T) {
+	var out bytes.Buffer
+	p := &Progress{out: &out, quiet: true, stop: make(chan struct{})}
+
+	p.Stage("Uploading image")
+	p.Retry("failed")
+	p.Done()
+
+	if out.Len() != 0 {
+		t.Errorf("Expected no output, got %q", out.String())
+	}
+}
+
+// TestProgressLive tests that streamed text replaces the spinner until the next stage
+func TestProgressLive(t *testing.T) {
+	var out bytes.Buffer
+	p := &Progress{out: &out, spinner: true, stop: make(chan struct{})}
+
+	p.Stage("Converting")
+	live := p.Live()
+	live.Write([]byte("# Title"))
+	p.draw()
+	if !strings.HasSuffix(out.String(), "\r\x1b[K# Title") {
+		t.Errorf("Expected the text in place of the spinner, got %q", out.String())
+	}
+
+	// The text ends on its own line before the stage is finished
+	p.Stage("Storing")
+	if !strings.Contains(out.String(), "# Title\n\r\x1b[K✓ Converting") {
+		t.Errorf("Expected the stream to end before the finished stage, got %q", out.String())
+	}
+	p.Done()
+
+	// Without a spinner nothing is streamed
+	if (&Progress{out: &out}).Live() != nil {
+		t.Error("Expected no live writer without a spinner")
+	}
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultQueryCacheTTL is how long the embedding of a search query is kept, unless it is
+// set with UME_QUERY_CACHE_TTL
+const DefaultQueryCacheTTL = 30 * 24 * time.Hour
+
+// CacheDir returns the directory ume keeps local caches in, set with UME_CACHE_DIR, or
+// ~/.cache/umesao
+func CacheDir() (string, error) {
+	if dir := os.Getenv("UME_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding the cache directory, set UME_CACHE_DIR: %w", err)
+	}
+	return filepath.Join(home, ".cache", "umesao"), nil
+}
+
+// QueryCache keeps the embeddings of search queries in files, so a query searched again
+// isn't embedded again
+type QueryCache struct {
+	Dir string
+	TTL time.Duration
+}
+
+// cachedQuery is the file a query embedding is kept in
+type cachedQuery struct {
+	Model     string    `json:"model"`
+	Query     string    `json:"query"`
+	Embedding []float64 `json:"embedding"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewQueryCache returns the query cache in the cache directory, with the TTL set with
+// UME_QUERY_CACHE_TTL. A TTL of 0 turns the cache off, and nil is returned.
+func NewQueryCache() (*QueryCache, error) {
+	ttl := DefaultQueryCacheTTL
+	if value := os.Getenv("UME_QUERY_CACHE_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid UME_QUERY_CACHE_TTL: %s, expected a duration like 720h, or 0 to turn the cache off", value)
+		}
+		ttl = parsed
+	}
+	if ttl == 0 {
+		return nil, nil
+	}
+
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &QueryCache{Dir: filepath.Join(dir, "queries"), TTL: ttl}, nil
+}
+
+// NormalizeQuery returns a query with its whitespace collapsed, so queries that only
+// differ by spacing share their embedding
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// path returns the file the embedding of a query with a model is kept in
+func (c *QueryCache) path(model, query string) string {
+	sum := sha256.Sum256([]byte(model + "\n" + NormalizeQuery(query)))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get returns the embedding of a query with a model, and whether it was cached and hasn't
+// expired. Expired embeddings are removed.
+func (c *QueryCache) Get(model, query string) ([]float64, bool) {
+	path := c.path(model, query)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var cached cachedQuery
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Model != model || cached.Query != NormalizeQuery(query) {
+		return nil, false
+	}
+	if time.Since(cached.CreatedAt) > c.TTL {
+		os.Remove(path)
+		return nil, false
+	}
+	return cached.Embedding, true
+}
+
+// Put keeps the embedding of a query with a model
+func (c *QueryCache) Put(model, query string, embedding []float64) error {
+	data, err := json.Marshal(cachedQuery{
+		Model:     model,
+		Query:     NormalizeQuery(query),
+		Embedding: embedding,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding query embedding: %w", err)
+	}
+
+	if err := writeCacheFile(c.path(model, query), data); err != nil {
+		return fmt.Errorf("error caching query embedding: %w", err)
+	}
+	return nil
+}
+
+// EmbedQueries returns the embeddings of search queries, in the same order. Queries are
+// looked up in the query cache first, and only the others are embedded and then cached.
+// The cache is skipped when it can't be used, as it only saves time.
+func (m EmbeddingModel) EmbedQueries(key string, queries []string) ([][]float64, error) {
+	cache, err := NewQueryCache()
+	if err != nil {
+		return nil, err
+	}
+	if cache == nil {
+		return m.Embed(key, queries)
+	}
+
+	embeddings := make([][]float64, len(queries))
+	var missing []string
+	var missingAt []int
+	for i, query := range queries {
+		if embedding, ok := cache.Get(m.Name, query); ok {
+			embeddings[i] = embedding
+			continue
+		}
+		missing = append(missing, NormalizeQuery(query))
+		missingAt = append(missingAt, i)
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	embedded, err := m.Embed(key, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedded) != len(missing) {
+		return nil, fmt.Errorf("expected %d query embeddings, got %d", len(missing), len(embedded))
+	}
+	for j, i := range missingAt {
+		embeddings[i] = embedded[j]
+		cache.Put(m.Name, missing[j], embedded[j])
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+// TestQueryCache tests that query embeddings are kept by model and normalized query until they expire
+func TestQueryCache(t *testing.T) {
+	cache := &QueryCache{Dir: t.TempDir(), TTL: time.Hour}
+
+	if err := cache.Put("text-embedding-3-small", "  knowledge  work ", []float64{0.1, 0.2}); err != nil {
+		t.Fatalf("Put returned an error: %v", err)
+	}
+
+	if embedding, ok := cache.Get("text-embedding-3-small", "knowledge work"); !ok || len(embedding) != 2 || embedding[1] != 0.2 {
+		t.Errorf("Expected the embedding of the normalized query, got %v, %v", embedding, ok)
+	}
+	if _, ok := cache.Get("text-embedding-3-large", "knowledge work"); ok {
+		t.Error("Expected the embedding of another model not to be used")
+	}
+
+	// An expired embedding is not used
+	cache.TTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, ok := cache.Get("text-embedding-3-small", "knowledge work"); ok {
+		t.Error("Expected the expired embedding not to be used")
+	}
+}
+
+// TestEmbedQueriesCached tests that cached queries are not embedded again
+func TestEmbedQueriesCached(t *testing.T) {
+	t.Setenv("UME_CACHE_DIR", t.TempDir())
+	t.Setenv("UME_QUERY_CACHE_TTL", "")
+
+	cache, err := NewQueryCache()
+	if err != nil || cache == nil {
+		t.Fatalf("Expected a query cache, got %v, %v", cache, err)
+	}
+	cache.Put(DefaultEmbeddingModel.Name, "first", []float64{1})
+	cache.Put(DefaultEmbeddingModel.Name, "second", []float64{2})
+
+	// Without a key, embedding anything would fail
+	embeddings, err := DefaultEmbeddingModel.EmbedQueries("", []string{"second", "first"})
+	if err != nil || len(embeddings) != 2 || embeddings[0][0] != 2 || embeddings[1][0] != 1 {
+		t.Errorf("Expected the cached embeddings in order, got %v, %v", embeddings, err)
+	}
+
+	t.Setenv("UME_QUERY_CACHE_TTL", "0")
+	if cache, err := NewQueryCache(); err != nil || cache != nil {
+		t.Errorf("Expected no cache with a TTL of 0, got %v, %v", cache, err)
+	}
+	t.Setenv("UME_QUERY_CACHE_TTL", "a week")
+	if _, err := NewQueryCache(); err == nil {
+		t.Error("Expected an error for an invalid TTL")
+	}
+}
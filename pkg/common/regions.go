@@ -0,0 +1,85 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// OCRLine is a line of text recognized by OCR and where it was found in the image
+type OCRLine struct {
+	Text   string `json:"text"`
+	Region Region `json:"region"`
+	// Confidence is the lowest confidence of the words in the line, from 0 to 1
+	Confidence float64 `json:"confidence"`
+}
+
+// Region is a rectangle in the image, in pixels
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// String formats the region as "x,y,width,height"
+func (r Region) String() string {
+	return fmt.Sprintf("%d,%d,%d,%d", r.X, r.Y, r.Width, r.Height)
+}
+
+// union returns the smallest region containing both regions
+func (r Region) union(other Region) Region {
+	x0, y0 := min(r.X, other.X), min(r.Y, other.Y)
+	x1, y1 := max(r.X+r.Width, other.X+other.Width), max(r.Y+r.Height, other.Y+other.Height)
+	return Region{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}
+}
+
+// ParseOCRLines reads the lines and their bounding boxes from a stored OCR result.
+// Results without bounding boxes, like the ones from Mistral OCR, have no lines.
+func ParseOCRLines(ocrResult string) ([]OCRLine, error) {
+	result, err := ParseOCRResult(ocrResult)
+	if err != nil {
+		return nil, err
+	}
+	return result.Lines, nil
+}
+
+// TextRegion finds the region of the image a piece of markdown was converted from,
+// by looking for the OCR lines it contains. Whitespace, punctuation and case are ignored
+// as the conversion to markdown often changes them. It returns false if no line was found.
+func TextRegion(text string, lines []OCRLine) (Region, bool) {
+	normalized := normalizeForMatching(text)
+	if normalized == "" {
+		return Region{}, false
+	}
+
+	var region Region
+	found := false
+	for _, line := range lines {
+		// Very short lines, like bullets or stray marks, would match almost anything
+		lineText := normalizeForMatching(line.Text)
+		if len([]rune(lineText)) < 2 || !strings.Contains(normalized, lineText) {
+			continue
+		}
+
+		if found {
+			region = region.union(line.Region)
+		} else {
+			region = line.Region
+			found = true
+		}
+	}
+
+	return region, found
+}
+
+// normalizeForMatching keeps only the letters and digits of a text, in lower case
+func normalizeForMatching(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestParseOCRLines tests the ParseOCRLines function
+func TestParseOCRLines(t *testing.T) {
+	ocrResult := `{"status":"succeeded","analyzeResult":{"readResults":[{"lines":[` +
+		`{"boundingBox":[10,20,110,22,109,40,9,38],"text":"Hello world"},` +
+		`{"boundingBox":[10,50,60,50,60,70,10,70],"text":"second"}]}]}}`
+
+	lines, err := ParseOCRLines(ocrResult)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got: %v", lines)
+	}
+
+	// The region should contain all four corners of the bounding box
+	expected := Region{X: 9, Y: 20, Width: 101, Height: 20}
+	if lines[0].Text != "Hello world" || lines[0].Region != expected {
+		t.Errorf("Expected line 'Hello world' at %v, got: '%s' at %v", expected, lines[0].Text, lines[0].Region)
+	}
+
+	// Test that results without bounding boxes have no lines
+	lines, err = ParseOCRLines(`{"pages":[{"markdown":"# Hello"}]}`)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(lines) != 0 {
+		t.Errorf("Expected no lines, got: %v", lines)
+	}
+
+	// Test that invalid JSON is reported
+	if _, err := ParseOCRLines("not json"); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+// TestTextRegion tests the TextRegion function
+func TestTextRegion(t *testing.T) {
+	lines := []OCRLine{
+		{Text: "Hello world", Region: Region{X: 10, Y: 20, Width: 100, Height: 20}},
+		{Text: "second line", Region: Region{X: 10, Y: 50, Width: 50, Height: 20}},
+		{Text: "other", Region: Region{X: 200, Y: 300, Width: 40, Height: 20}},
+		{Text: "-", Region: Region{X: 0, Y: 0, Width: 5, Height: 5}},
+	}
+
+	// Lines joined into one paragraph should cover both lines, ignoring punctuation and case
+	region, ok := TextRegion("**Hello, World!** Second line.", lines)
+	expected := Region{X: 10, Y: 20, Width: 100, Height: 50}
+	if !ok || region != expected {
+		t.Errorf("Expected region %v, got: %v (found: %v)", expected, region, ok)
+	}
+
+	// Test with Japanese text
+	region, ok = TextRegion("今日は晴れ", []OCRLine{{Text: "今日は 晴れ", Region: Region{X: 1, Y: 2, Width: 3, Height: 4}}})
+	if !ok || region != (Region{X: 1, Y: 2, Width: 3, Height: 4}) {
+		t.Errorf("Expected Japanese text to match, got: %v (found: %v)", region, ok)
+	}
+
+	// Test that text not in the image has no region
+	if _, ok := TextRegion("nothing here", lines); ok {
+		t.Error("Expected no region for text that is not in the OCR result")
+	}
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdownRenderer renders GitHub flavored markdown. Raw HTML in the markdown is not rendered.
+var markdownRenderer = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+)
+
+// RenderMarkdown converts markdown content to HTML that can be embedded in a template
+func RenderMarkdown(content string) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(content), &buf); err != nil {
+		return "", fmt.Errorf("error rendering markdown: %w", err)
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// RenderMarkdownWithRegions converts markdown content to HTML like RenderMarkdown, and marks
+// each paragraph, heading, list item and table row with the region of the image it was
+// converted from, as a data-region="x,y,width,height" attribute.
+func RenderMarkdownWithRegions(content string, lines []OCRLine) (template.HTML, error) {
+	return RenderMarkdownHighlighted(content, lines, 0, 0)
+}
+
+// RenderMarkdownHighlighted converts markdown content to HTML like RenderMarkdownWithRegions,
+// and marks the blocks overlapping the bytes start to end of the content, like a chunk that
+// matched a search, with class="match". The first of them gets id="match", so the page can
+// be opened scrolled to it. An empty range highlights nothing.
+func RenderMarkdownHighlighted(content string, lines []OCRLine, start, end int) (template.HTML, error) {
+	source := []byte(content)
+	doc := markdownRenderer.Parser().Parse(text.NewReader(source))
+
+	matched := false
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n.(type) {
+		case *ast.Paragraph:
+			// Paragraphs in list items are covered by the list item
+			if _, ok := n.Parent().(*ast.ListItem); ok {
+				return ast.WalkSkipChildren, nil
+			}
+		case *ast.Heading, *ast.ListItem, *extast.TableRow, *extast.TableHeader:
+		default:
+			return ast.WalkContinue, nil
+		}
+
+		if region, ok := TextRegion(nodeText(n, source), lines); ok {
+			n.SetAttributeString("data-region", []byte(region.String()))
+		}
+		if nodeStart, nodeEnd, ok := nodeRange(n); ok && start < end && nodeStart < end && start < nodeEnd {
+			n.SetAttributeString("class", []byte("match"))
+			if !matched {
+				n.SetAttributeString("id", []byte("match"))
+				matched = true
+			}
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marking regions: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := markdownRenderer.Renderer().Render(&buf, source, doc); err != nil {
+		return "", fmt.Errorf("error rendering markdown: %w", err)
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// nodeRange returns the byte range of the source a node and its children were parsed from
+func nodeRange(n ast.Node) (int, int, bool) {
+	start, end, found := 0, 0, false
+	extend := func(s, e int) {
+		if !found || s < start {
+			start = s
+		}
+		if !found || e > end {
+			end = e
+		}
+		found = true
+	}
+
+	_ = ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if t, ok := child.(*ast.Text); ok {
+			extend(t.Segment.Start, t.Segment.Stop)
+		} else if child.Type() == ast.TypeBlock {
+			lines := child.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				extend(lines.At(i).Start, lines.At(i).Stop)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return start, end, found
+}
+
+// nodeText returns the text of a node and its children
+func nodeText(n ast.Node, source []byte) string {
+	var b bytes.Buffer
+	_ = ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			if t, ok := child.(*ast.Text); ok {
+				b.Write(t.Segment.Value(source))
+				b.WriteByte(' ')
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRenderMarkdown tests the RenderMarkdown function
+func TestRenderMarkdown(t *testing.T) {
+	// Test with headings, lists and tables
+	content := "# Title\n\n- one\n- two\n\n| a | b |\n|---|---|\n| 1 | 2 |\n"
+	html, err := RenderMarkdown(content)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, expected := range []string{"<h1>Title</h1>", "<li>one</li>", "<table>", "<td>1</td>"} {
+		if !strings.Contains(string(html), expected) {
+			t.Errorf("Expected rendered HTML to contain '%s', got: '%s'", expected, html)
+		}
+	}
+
+	// Test that raw HTML is not passed through
+	html, err = RenderMarkdown("<script>alert(1)</script>\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if strings.Contains(string(html), "<script>") {
+		t.Errorf("Expected raw HTML to be omitted, got: '%s'", html)
+	}
+}
+
+// TestRenderMarkdownWithRegions tests the RenderMarkdownWithRegions function
+func TestRenderMarkdownWithRegions(t *testing.T) {
+	lines := []OCRLine{
+		{Text: "Title", Region: Region{X: 10, Y: 20, Width: 100, Height: 30}},
+		{Text: "first item", Region: Region{X: 10, Y: 60, Width: 80, Height: 20}},
+	}
+
+	html, err := RenderMarkdownWithRegions("# Title\n\n- first item\n- not in the image\n", lines)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, expected := range []string{`<h1 data-region="10,20,100,30">Title</h1>`, `<li data-region="10,60,80,20">first item</li>`, "<li>not in the image</li>"} {
+		if !strings.Contains(string(html), expected) {
+			t.Errorf("Expected rendered HTML to contain '%s', got: '%s'", expected, html)
+		}
+	}
+}
+
+// TestRenderMarkdownHighlighted tests that the blocks of a matched chunk are highlighted
+func TestRenderMarkdownHighlighted(t *testing.T) {
+	content := "# Title\n\nNot this one.\n\n- the match\n- and more of it\n"
+	start := strings.Index(content, "the match")
+	end := strings.Index(content, "more of it")
+
+	html, err := RenderMarkdownHighlighted(content, nil, start, end)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, expected := range []string{"<h1>Title</h1>", "<p>Not this one.</p>", `<li class="match" id="match">the match</li>`, `<li class="match">and more of it</li>`} {
+		if !strings.Contains(string(html), expected) {
+			t.Errorf("Expected rendered HTML to contain '%s', got: '%s'", expected, html)
+		}
+	}
+
+	// An empty range highlights nothing
+	html, _ = RenderMarkdownHighlighted(content, nil, 0, 0)
+	if strings.Contains(string(html), `class="match"`) {
+		t.Errorf("Expected nothing to be highlighted, got: '%s'", html)
+	}
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"math"
+)
+
+// DefaultEase is the ease factor of a card that has never been reviewed
+const DefaultEase = 2.5
+
+// minEase is the lowest ease factor SM-2 allows
+const minEase = 1.3
+
+// ReviewState is the spaced repetition schedule of a card
+type ReviewState struct {
+	Repetitions  int     // number of successful reviews in a row
+	IntervalDays int     // days until the next review
+	Ease         float64 // how quickly the interval grows
+}
+
+// NextReview computes the schedule after a review, following the SM-2 algorithm.
+// Parameters:
+//
+//	state - The schedule before the review.
+//	grade - How well the card was recalled, from 0 (blackout) to 5 (perfect).
+//
+// Returns:
+//
+//	The schedule after the review.
+func NextReview(state ReviewState, grade int) ReviewState {
+	if grade < 0 {
+		grade = 0
+	}
+	if grade > 5 {
+		grade = 5
+	}
+	if state.Ease == 0 {
+		state.Ease = DefaultEase
+	}
+
+	next := state
+	if grade >= 3 {
+		switch state.Repetitions {
+		case 0:
+			next.IntervalDays = 1
+		case 1:
+			next.IntervalDays = 6
+		default:
+			next.IntervalDays = int(math.Round(float64(state.IntervalDays) * state.Ease))
+		}
+		next.Repetitions = state.Repetitions + 1
+	} else {
+		// Start over when the card was forgotten
+		next.Repetitions = 0
+		next.IntervalDays = 1
+	}
+
+	q := float64(5 - grade)
+	next.Ease = state.Ease + (0.1 - q*(0.08+q*0.02))
+	if next.Ease < minEase {
+		next.Ease = minEase
+	}
+
+	return next
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"math"
+	"testing"
+)
+
+// TestNextReview tests the NextReview function
+func TestNextReview(t *testing.T) {
+	// Test the first successful reviews of a new card
+	state := NextReview(ReviewState{}, 4)
+	if state.Repetitions != 1 || state.IntervalDays != 1 {
+		t.Errorf("Expected 1 repetition and an interval of 1 day, got: %+v", state)
+	}
+	if state.Ease != DefaultEase {
+		t.Errorf("Expected ease %v for grade 4, got: %v", DefaultEase, state.Ease)
+	}
+
+	state = NextReview(state, 4)
+	if state.Repetitions != 2 || state.IntervalDays != 6 {
+		t.Errorf("Expected 2 repetitions and an interval of 6 days, got: %+v", state)
+	}
+
+	state = NextReview(state, 5)
+	if state.Repetitions != 3 || state.IntervalDays != 15 {
+		t.Errorf("Expected 3 repetitions and an interval of 15 days, got: %+v", state)
+	}
+	if math.Abs(state.Ease-2.6) > 1e-9 {
+		t.Errorf("Expected ease 2.6 after a perfect grade, got: %v", state.Ease)
+	}
+
+	// Test that a forgotten card starts over
+	state = NextReview(state, 1)
+	if state.Repetitions != 0 || state.IntervalDays != 1 {
+		t.Errorf("Expected the schedule to start over, got: %+v", state)
+	}
+
+	// Test that the ease never drops below the minimum
+	state = ReviewState{Ease: minEase}
+	state = NextReview(state, 0)
+	if state.Ease != minEase {
+		t.Errorf("Expected ease to stay at %v, got: %v", minEase, state.Ease)
+	}
+}
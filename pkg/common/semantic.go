@@ -0,0 +1,105 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// DefaultSemanticThreshold is the cosine similarity of the embeddings of neighbouring
+// sentences above which they are kept in the same chunk by the semantic chunker
+const DefaultSemanticThreshold = 0.5
+
+// SemanticChunker merges neighbouring sentences into a chunk while their embeddings stay
+// similar, so a chunk holds one topic. The sentences are the chunks of the markdown
+// chunker, headings included, and a chunk is ended before it grows beyond MaxRunes.
+type SemanticChunker struct {
+	// Embed returns the embeddings of sentences
+	Embed     func(sentences []string) ([][]float64, error)
+	Threshold float64
+	MaxRunes  int
+}
+
+// Name returns the strategy of the chunker
+func (SemanticChunker) Name() string {
+	return ChunkerSemantic
+}
+
+// Chunk splits markdown into sentences and merges neighbours with similar embeddings
+func (c SemanticChunker) Chunk(content string) ([]Chunk, error) {
+	sentences, err := MarkdownChunker{}.Chunk(content)
+	if err != nil {
+		return nil, err
+	}
+	sentences = dropBlankChunks(sentences)
+	if len(sentences) < 2 {
+		return sentences, nil
+	}
+
+	embeddings, err := c.Embed(ChunkTexts(sentences))
+	if err != nil {
+		return nil, fmt.Errorf("error embedding sentences: %w", err)
+	}
+	if len(embeddings) != len(sentences) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(sentences), len(embeddings))
+	}
+
+	var chunks []Chunk
+	current := sentences[0]
+	runes := len([]rune(current.Text))
+	for i := 1; i < len(sentences); i++ {
+		length := len([]rune(sentences[i].Text))
+		similar := embeddingSimilarity(embeddings[i-1], embeddings[i]) >= c.Threshold
+		if similar && (c.MaxRunes <= 0 || runes+1+length <= c.MaxRunes) {
+			current.Text += " " + sentences[i].Text
+			current.End = max(current.End, sentences[i].End)
+			current.Type = ChunkPassage
+			runes += 1 + length
+			continue
+		}
+
+		chunks = append(chunks, current)
+		current = sentences[i]
+		runes = length
+	}
+	return append(chunks, current), nil
+}
+
+// embedSentences embeds sentences for the semantic chunker with the model used for chunks
+func embedSentences(sentences []string) ([][]float64, error) {
+	key, err := RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return nil, err
+	}
+	return LineEmbeddings(key, "text-embedding-3-small", 1536, sentences)
+}
+
+// semanticThreshold returns the similarity threshold of the semantic chunker from
+// UME_SEMANTIC_THRESHOLD, or the default when it is not set
+func semanticThreshold() (float64, error) {
+	value := os.Getenv("UME_SEMANTIC_THRESHOLD")
+	if value == "" {
+		return DefaultSemanticThreshold, nil
+	}
+
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold < -1 || threshold > 1 {
+		return 0, fmt.Errorf("invalid UME_SEMANTIC_THRESHOLD: %s, expected a similarity from -1 to 1", value)
+	}
+	return threshold, nil
+}
+
+// embeddingSimilarity returns the cosine similarity of two embeddings
+func embeddingSimilarity(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
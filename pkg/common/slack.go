@@ -0,0 +1,49 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// slackMaxRequestAge is how old a signed Slack request may be before it's rejected as a replay
+const slackMaxRequestAge = 5 * time.Minute
+
+// VerifySlackSignature checks that a request was sent by Slack, following
+// https://api.slack.com/authentication/verifying-requests-from-slack
+// Parameters:
+//
+//	signingSecret - The signing secret of the Slack app.
+//	timestamp     - The X-Slack-Request-Timestamp header.
+//	signature     - The X-Slack-Signature header.
+//	body          - The raw request body.
+//	now           - The current time, used to reject old requests.
+//
+// Returns:
+//
+//	An error if the signature doesn't match or the request is too old.
+func VerifySlackSignature(signingSecret, timestamp, signature string, body []byte, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid Slack request timestamp: %w", err)
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return fmt.Errorf("Slack request is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("invalid Slack request signature")
+	}
+
+	return nil
+}
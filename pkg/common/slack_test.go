@@ -0,0 +1,46 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+// TestVerifySlackSignature tests the VerifySlackSignature function
+func TestVerifySlackSignature(t *testing.T) {
+	secret := "test-secret"
+	timestamp := "1700000000"
+	body := []byte("command=%2Fume&text=search+cards")
+	now := time.Unix(1700000060, 0)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + string(body)))
+	signature := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	// Test with a valid signature
+	if err := VerifySlackSignature(secret, timestamp, signature, body, now); err != nil {
+		t.Errorf("Expected valid signature, got: %v", err)
+	}
+
+	// Test with a tampered body
+	if err := VerifySlackSignature(secret, timestamp, signature, []byte("command=%2Fume&text=delete"), now); err == nil {
+		t.Error("Expected error for tampered body")
+	}
+
+	// Test with the wrong secret
+	if err := VerifySlackSignature("other-secret", timestamp, signature, body, now); err == nil {
+		t.Error("Expected error for wrong secret")
+	}
+
+	// Test with a replayed request
+	if err := VerifySlackSignature(secret, timestamp, signature, body, now.Add(time.Hour)); err == nil {
+		t.Error("Expected error for old request")
+	}
+
+	// Test with an invalid timestamp
+	if err := VerifySlackSignature(secret, "yesterday", signature, body, now); err == nil {
+		t.Error("Expected error for invalid timestamp")
+	}
+}
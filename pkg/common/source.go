@@ -0,0 +1,109 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SourceFields are the names of the fields of a card source, as given to ume meta set
+var SourceFields = []string{"book", "page", "url", "read"}
+
+// CardSource is where the material of a card was taken from, so quotes can be traced
+// back to it
+type CardSource struct {
+	Book string
+	Page string
+	URL  string
+	// ReadOn is the date the source was read, zero if it isn't known
+	ReadOn time.Time
+}
+
+// IsZero reports whether no field of the source is set
+func (s CardSource) IsZero() bool {
+	return s.Book == "" && s.Page == "" && s.URL == "" && s.ReadOn.IsZero()
+}
+
+// Set sets a field of the source by name, checking the URL and the date (YYYY-MM-DD).
+// An empty value clears the field.
+func (s *CardSource) Set(field, value string) error {
+	value = strings.TrimSpace(value)
+	switch field {
+	case "book":
+		s.Book = value
+	case "page":
+		s.Page = value
+	case "url":
+		if value != "" {
+			u, err := url.Parse(value)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid URL: %s. Expected an http or https URL", value)
+			}
+		}
+		s.URL = value
+	case "read":
+		if value == "" {
+			s.ReadOn = time.Time{}
+			return nil
+		}
+		readOn, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return fmt.Errorf("invalid date: %s. Expected YYYY-MM-DD", value)
+		}
+		s.ReadOn = readOn
+	default:
+		return fmt.Errorf("unknown source field: %s. Must be one of %s", field, strings.Join(SourceFields, ", "))
+	}
+	return nil
+}
+
+// Citation formats the source as a line to cite it by, such as
+// "The Art of Note Taking, p. 12 (read 2024-05-01) https://example.com/notes"
+func (s CardSource) Citation() string {
+	var parts []string
+	if s.Book != "" {
+		parts = append(parts, s.Book)
+	}
+	if s.Page != "" {
+		if len(parts) > 0 {
+			parts[len(parts)-1] += ","
+		}
+		parts = append(parts, "p. "+s.Page)
+	}
+	if !s.ReadOn.IsZero() {
+		parts = append(parts, "(read "+s.ReadOn.Format("2006-01-02")+")")
+	}
+	if s.URL != "" {
+		parts = append(parts, s.URL)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ExportFrontmatter returns the YAML frontmatter of an exported card, with its source
+// if one is set. Strings are double quoted so any title can be written.
+func ExportFrontmatter(title, uid string, version int, source CardSource) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", strconv.Quote(title))
+	fmt.Fprintf(&b, "uid: %s\n", uid)
+	fmt.Fprintf(&b, "version: %d\n", version)
+	if !source.IsZero() {
+		b.WriteString("source:\n")
+		if source.Book != "" {
+			fmt.Fprintf(&b, "  book: %s\n", strconv.Quote(source.Book))
+		}
+		if source.Page != "" {
+			fmt.Fprintf(&b, "  page: %s\n", strconv.Quote(source.Page))
+		}
+		if source.URL != "" {
+			fmt.Fprintf(&b, "  url: %s\n", strconv.Quote(source.URL))
+		}
+		if !source.ReadOn.IsZero() {
+			fmt.Fprintf(&b, "  read: %s\n", source.ReadOn.Format("2006-01-02"))
+		}
+	}
+	b.WriteString("---\n")
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCardSourceSet tests the Set method of CardSource
+func TestCardSourceSet(t *testing.T) {
+	var source CardSource
+	if !source.IsZero() {
+		t.Error("Expected a new source to be zero")
+	}
+
+	if err := source.Set("book", " The Art of Note Taking "); err != nil || source.Book != "The Art of Note Taking" {
+		t.Errorf("Expected the book to be set, got %q, %v", source.Book, err)
+	}
+	if err := source.Set("read", "2024-05-01"); err != nil || !source.ReadOn.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the date read to be 2024-05-01, got %v, %v", source.ReadOn, err)
+	}
+	if err := source.Set("url", "https://example.com/notes"); err != nil || source.URL != "https://example.com/notes" {
+		t.Errorf("Expected the URL to be set, got %q, %v", source.URL, err)
+	}
+
+	if err := source.Set("read", "May 1st"); err == nil {
+		t.Error("Expected error for an invalid date, got nil")
+	}
+	if err := source.Set("url", "example.com"); err == nil {
+		t.Error("Expected error for a URL without a scheme, got nil")
+	}
+	if err := source.Set("author", "Umesao"); err == nil {
+		t.Error("Expected error for an unknown field, got nil")
+	}
+
+	if err := source.Set("read", ""); err != nil || !source.ReadOn.IsZero() {
+		t.Errorf("Expected an empty value to clear the date, got %v, %v", source.ReadOn, err)
+	}
+}
+
+// TestCardSourceCitation tests the Citation method of CardSource
+func TestCardSourceCitation(t *testing.T) {
+	source := CardSource{
+		Book:   "The Art of Note Taking",
+		Page:   "12",
+		URL:    "https://example.com/notes",
+		ReadOn: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	expected := "The Art of Note Taking, p. 12 (read 2024-05-01) https://example.com/notes"
+	if citation := source.Citation(); citation != expected {
+		t.Errorf("Expected %q, got %q", expected, citation)
+	}
+
+	if citation := (CardSource{Page: "3"}).Citation(); citation != "p. 3" {
+		t.Errorf("Expected %q, got %q", "p. 3", citation)
+	}
+	if citation := (CardSource{}).Citation(); citation != "" {
+		t.Errorf("Expected an empty citation, got %q", citation)
+	}
+}
+
+// TestExportFrontmatter tests the ExportFrontmatter function
+func TestExportFrontmatter(t *testing.T) {
+	frontmatter := ExportFrontmatter(`Notes on "Umesao"`, "0190b4c8-7e2a-4f4b-9a51-3c2d8e6f1a2b", 2, CardSource{Book: "知的生産の技術", Page: "45"})
+	expected := `---
+title: "Notes on \"Umesao\""
+uid: 0190b4c8-7e2a-4f4b-9a51-3c2d8e6f1a2b
+version: 2
+source:
+  book: "知的生産の技術"
+  page: "45"
+---
+`
+	if frontmatter != expected {
+		t.Errorf("Expected frontmatter:\n%s\ngot:\n%s", expected, frontmatter)
+	}
+
+	frontmatter = ExportFrontmatter("Notes", "0190b4c8-7e2a-4f4b-9a51-3c2d8e6f1a2b", 1, CardSource{})
+	expected = "---\ntitle: \"Notes\"\nuid: 0190b4c8-7e2a-4f4b-9a51-3c2d8e6f1a2b\nversion: 1\n---\n"
+	if frontmatter != expected {
+		t.Errorf("Expected frontmatter without a source:\n%s\ngot:\n%s", expected, frontmatter)
+	}
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"strings"
+)
+
+// SplitMarker is the line that separates the sections of a card to split
+const SplitMarker = "---"
+
+// SplitSections splits markdown into sections at lines that only contain SplitMarker.
+// Markers inside fenced code blocks are ignored, and empty sections are dropped.
+func SplitSections(content string) []string {
+	var sections []string
+	var current []string
+	inFence := false
+
+	flush := func() {
+		section := strings.TrimSpace(strings.Join(current, "\n"))
+		if section != "" {
+			sections = append(sections, section+"\n")
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if isFence(line) {
+			inFence = !inFence
+		}
+		if !inFence && strings.TrimSpace(line) == SplitMarker {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+
+	return sections
+}
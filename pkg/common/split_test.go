@@ -0,0 +1,32 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestSplitSections tests the SplitSections function
+func TestSplitSections(t *testing.T) {
+	// Test splitting at markers
+	sections := SplitSections("# First\n\nidea one\n\n---\n\n# Second\nidea two\n---\n")
+	if len(sections) != 2 {
+		t.Fatalf("Expected 2 sections, got %d: %q", len(sections), sections)
+	}
+	if sections[0] != "# First\n\nidea one\n" {
+		t.Errorf("Expected first section '# First\\n\\nidea one\\n', got: %q", sections[0])
+	}
+	if sections[1] != "# Second\nidea two\n" {
+		t.Errorf("Expected second section '# Second\\nidea two\\n', got: %q", sections[1])
+	}
+
+	// Test that markers in code blocks are kept
+	sections = SplitSections("intro\n```yaml\n---\nkey: value\n```\n")
+	if len(sections) != 1 {
+		t.Errorf("Expected 1 section, got %d: %q", len(sections), sections)
+	}
+
+	// Test content without markers
+	sections = SplitSections("just one idea\n")
+	if len(sections) != 1 || sections[0] != "just one idea\n" {
+		t.Errorf("Expected the content as the only section, got: %q", sections)
+	}
+}
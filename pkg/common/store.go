@@ -0,0 +1,204 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pgvector/pgvector-go"
+	"github.com/yasushisakai/umesao/database"
+)
+
+// uniqueViolation is the SQLSTATE of an insert of a row that is already stored
+const uniqueViolation = "23505"
+
+// LinkStore is the part of the database queries needed to store the links of a card
+type LinkStore interface {
+	DeleteCardLinks(ctx context.Context, srcCardID int32) error
+	GetCardByUID(ctx context.Context, uid string) (int32, error)
+	GetCardTitle(ctx context.Context, id int32) (string, error)
+	CreateCardLink(ctx context.Context, arg database.CreateCardLinkParams) error
+}
+
+// VersionStore is the part of the database queries needed to store a markdown version
+type VersionStore interface {
+	LinkStore
+	CreateMarkdown(ctx context.Context, arg database.CreateMarkdownParams) error
+	CreateEmbeddings(ctx context.Context, arg database.CreateEmbeddingsParams) error
+}
+
+// MarkdownUploader stores markdown in object storage, and deletes what it uploaded for
+// a version that couldn't be stored
+type MarkdownUploader interface {
+	UploadMarkdownObject(content []byte) (string, bool, error)
+	DeleteMarkdownObject(hash string) error
+}
+
+// MarkdownVersion is a version of a card to store with StoreVersion
+type MarkdownVersion struct {
+	CardID  int32
+	Version int32
+	// Parent is the version this one was edited from, not set for the first version
+	Parent  pgtype.Int4
+	Content string
+	// Method is the method the card was created with, which chooses its chunker
+	Method Method
+}
+
+// VersionEmbeddings are the chunks of a markdown version and their embeddings
+type VersionEmbeddings struct {
+	Model      EmbeddingModel
+	Chunker    string
+	Chunks     []Chunk
+	Embeddings [][]float64
+}
+
+// StoreCardLinks replaces the stored outbound links of a card with the [[card:123]] and
+// [[card:<uid>]] links found in its markdown content. Links to cards that don't exist are
+// kept in the markdown but not stored, and returned as warnings.
+func StoreCardLinks(ctx context.Context, store LinkStore, cardID int32, content string) ([]error, error) {
+	if err := store.DeleteCardLinks(ctx, cardID); err != nil {
+		return nil, fmt.Errorf("error deleting card links: %w", err)
+	}
+
+	var warnings []error
+	links := ParseCardLinks(content)
+	for _, uid := range ParseCardLinkUIDs(content) {
+		dst, err := store.GetCardByUID(ctx, uid)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("card %d links to card %s, which does not exist", cardID, uid))
+			continue
+		}
+		links = append(links, dst)
+	}
+
+	for _, dst := range links {
+		if dst == cardID {
+			continue
+		}
+		if _, err := store.GetCardTitle(ctx, dst); err != nil {
+			warnings = append(warnings, fmt.Errorf("card %d links to card %d, which does not exist", cardID, dst))
+			continue
+		}
+
+		err := store.CreateCardLink(ctx, database.CreateCardLinkParams{SrcCardID: cardID, DstCardID: dst})
+		if err != nil {
+			return warnings, fmt.Errorf("error storing link to card %d: %w", dst, err)
+		}
+	}
+
+	return warnings, nil
+}
+
+// EmbedVersion splits markdown content into chunks with the chunker of the method the card
+// was created with, and embeds them with the current embedding model
+func EmbedVersion(content string, method Method, openaiKey string) (VersionEmbeddings, error) {
+	chunker, err := ChunkerFor(method)
+	if err != nil {
+		return VersionEmbeddings{}, err
+	}
+	chunks, err := ExtractChunks(content, chunker)
+	if err != nil {
+		return VersionEmbeddings{}, err
+	}
+	model, err := CurrentEmbeddingModel()
+	if err != nil {
+		return VersionEmbeddings{}, err
+	}
+	embeddings, err := model.Embed(openaiKey, ChunkTexts(chunks))
+	if err != nil {
+		return VersionEmbeddings{}, fmt.Errorf("error generating embeddings: %w", err)
+	}
+
+	return VersionEmbeddings{Model: model, Chunker: chunker.Name(), Chunks: chunks, Embeddings: embeddings}, nil
+}
+
+// StoreVersionRecords stores the hash, links and embeddings of a markdown version, and
+// returns the links that weren't stored as warnings. It fails with ErrVersionConflict if
+// the version is already stored.
+func StoreVersionRecords(ctx context.Context, store VersionStore, version MarkdownVersion, embedded VersionEmbeddings) ([]error, error) {
+	err := store.CreateMarkdown(ctx, database.CreateMarkdownParams{
+		CardID:    version.CardID,
+		Ver:       version.Version,
+		Hash:      CalculateFileHash([]byte(version.Content)),
+		ParentVer: version.Parent,
+		Lang:      DetectLanguage(version.Content),
+		Content:   pgtype.Text{String: version.Content, Valid: true},
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return nil, fmt.Errorf("%w: version %d of card %d was stored by another edit, edit the card again", ErrVersionConflict, version.Version, version.CardID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error storing markdown hash in database: %w", err)
+	}
+
+	warnings, err := StoreCardLinks(ctx, store, version.CardID, version.Content)
+	if err != nil {
+		return warnings, err
+	}
+
+	for i, embedding := range embedded.Embeddings {
+		chunk := embedded.Chunks[i]
+		err = store.CreateEmbeddings(ctx, database.CreateEmbeddingsParams{
+			CardID:      version.CardID,
+			Ver:         version.Version,
+			Idx:         int32(i),
+			Model:       embedded.Model.Name,
+			Text:        chunk.Text,
+			Embedding:   pgvector.NewVector(ConvertFloat64ToFloat32(embedding)),
+			Chunker:     embedded.Chunker,
+			StartOffset: int32(chunk.Start),
+			EndOffset:   int32(chunk.End),
+			Type:        string(chunk.Type),
+			Page:        int32(chunk.Page),
+		})
+		if err != nil {
+			return warnings, fmt.Errorf("error storing embedding %d in database: %w", i, err)
+		}
+	}
+
+	return warnings, nil
+}
+
+// StoreVersion embeds a markdown version of a card and stores its hash, links and
+// embeddings in one transaction, so a version is never stored without them. The version
+// is inserted before its markdown is uploaded, so an edit storing the same version at the
+// same time waits for this one and fails with ErrVersionConflict. The links that weren't
+// stored are returned as warnings.
+func StoreVersion(ctx context.Context, dbpool *pgxpool.Pool, queries *database.Queries, uploader MarkdownUploader, openaiKey string, version MarkdownVersion) ([]error, error) {
+	// Embedding takes a while, so it is done before the transaction is started
+	embedded, err := EmbedVersion(version.Content, version.Method, openaiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	warnings, err := StoreVersionRecords(ctx, queries.WithTx(tx), version, embedded)
+	if err != nil {
+		return warnings, err
+	}
+
+	hash, uploaded, err := uploader.UploadMarkdownObject([]byte(version.Content))
+	if err != nil {
+		return warnings, fmt.Errorf("error uploading markdown file: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		// Markdown stored by other versions is kept, only what was uploaded for this one is
+		// deleted
+		if uploaded {
+			uploader.DeleteMarkdownObject(hash)
+		}
+		return warnings, fmt.Errorf("error committing version %d of card %d: %w", version.Version, version.CardID, err)
+	}
+	return warnings, nil
+}
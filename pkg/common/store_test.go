@@ -0,0 +1,158 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yasushisakai/umesao/database"
+)
+
+// mockVersionStore is an in-memory VersionStore
+type mockVersionStore struct {
+	titles     map[int32]string
+	uids       map[string]int32
+	markdown   []database.CreateMarkdownParams
+	links      []database.CreateCardLinkParams
+	embeddings []database.CreateEmbeddingsParams
+	deleted    []int32
+	// markdownErr is returned when a markdown version is stored
+	markdownErr error
+}
+
+func (s *mockVersionStore) DeleteCardLinks(ctx context.Context, srcCardID int32) error {
+	s.deleted = append(s.deleted, srcCardID)
+	return nil
+}
+
+func (s *mockVersionStore) GetCardByUID(ctx context.Context, uid string) (int32, error) {
+	if id, ok := s.uids[uid]; ok {
+		return id, nil
+	}
+	return 0, fmt.Errorf("no rows")
+}
+
+func (s *mockVersionStore) GetCardTitle(ctx context.Context, id int32) (string, error) {
+	if title, ok := s.titles[id]; ok {
+		return title, nil
+	}
+	return "", fmt.Errorf("no rows")
+}
+
+func (s *mockVersionStore) CreateCardLink(ctx context.Context, arg database.CreateCardLinkParams) error {
+	s.links = append(s.links, arg)
+	return nil
+}
+
+func (s *mockVersionStore) CreateMarkdown(ctx context.Context, arg database.CreateMarkdownParams) error {
+	if s.markdownErr != nil {
+		return s.markdownErr
+	}
+	s.markdown = append(s.markdown, arg)
+	return nil
+}
+
+func (s *mockVersionStore) CreateEmbeddings(ctx context.Context, arg database.CreateEmbeddingsParams) error {
+	s.embeddings = append(s.embeddings, arg)
+	return nil
+}
+
+// TestStoreCardLinks tests that only the links to other cards that exist are stored
+func TestStoreCardLinks(t *testing.T) {
+	uid := "0b6f3c1e-8f0a-4d5e-9a6b-2c1d3e4f5a6b"
+	store := &mockVersionStore{
+		titles: map[int32]string{1: "Self", 2: "Other", 3: "By UID"},
+		uids:   map[string]int32{uid: 3},
+	}
+
+	content := fmt.Sprintf("See [[card:1]], [[card:2]], [[card:9]] and [[card:%s]]", uid)
+	warnings, err := StoreCardLinks(context.Background(), store, 1, content)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(store.deleted) != 1 || store.deleted[0] != 1 {
+		t.Errorf("Expected the old links of card 1 to be deleted, got %v", store.deleted)
+	}
+	if len(store.links) != 2 {
+		t.Fatalf("Expected 2 links, got %v", store.links)
+	}
+	for _, link := range store.links {
+		if link.SrcCardID != 1 || (link.DstCardID != 2 && link.DstCardID != 3) {
+			t.Errorf("Unexpected link %v", link)
+		}
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Expected a warning for the link to card 9, got %v", warnings)
+	}
+}
+
+// TestStoreVersionRecords tests that a version is stored with its links and one embedding per chunk
+func TestStoreVersionRecords(t *testing.T) {
+	store := &mockVersionStore{titles: map[int32]string{2: "Other"}}
+	content := "# Title\n\nSee [[card:2]]"
+	version := MarkdownVersion{
+		CardID:  1,
+		Version: 3,
+		Parent:  pgtype.Int4{Int32: 2, Valid: true},
+		Content: content,
+		Method:  MethodText,
+	}
+	embedded := VersionEmbeddings{
+		Model:      DefaultEmbeddingModel,
+		Chunker:    "markdown",
+		Chunks:     []Chunk{{Text: "# Title", Start: 0, End: 7}, {Text: "See [[card:2]]", Start: 9, End: len(content)}},
+		Embeddings: [][]float64{{0.1, 0.2}, {0.3, 0.4}},
+	}
+
+	warnings, err := StoreVersionRecords(context.Background(), store, version, embedded)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("Expected no error or warnings, got: %v, %v", err, warnings)
+	}
+
+	if len(store.markdown) != 1 {
+		t.Fatalf("Expected one markdown version, got %d", len(store.markdown))
+	}
+	markdown := store.markdown[0]
+	if markdown.Ver != 3 || markdown.ParentVer.Int32 != 2 || markdown.Hash != CalculateFileHash([]byte(content)) || markdown.Content.String != content {
+		t.Errorf("Unexpected markdown version %+v", markdown)
+	}
+	if len(store.links) != 1 || store.links[0].DstCardID != 2 {
+		t.Errorf("Expected a link to card 2, got %v", store.links)
+	}
+	if len(store.embeddings) != 2 {
+		t.Fatalf("Expected 2 embeddings, got %d", len(store.embeddings))
+	}
+	second := store.embeddings[1]
+	if second.Idx != 1 || second.Ver != 3 || second.Model != DefaultEmbeddingModel.Name || second.Chunker != "markdown" || second.StartOffset != 9 {
+		t.Errorf("Unexpected embedding %+v", second)
+	}
+}
+
+// TestStoreVersionRecordsConflict tests that storing a version another edit already stored
+// is reported as a conflict, and nothing else of the version is stored
+func TestStoreVersionRecordsConflict(t *testing.T) {
+	store := &mockVersionStore{markdownErr: &pgconn.PgError{Code: "23505"}}
+	version := MarkdownVersion{CardID: 1, Version: 2, Content: "# Title", Method: MethodText}
+	embedded := VersionEmbeddings{
+		Model:      DefaultEmbeddingModel,
+		Chunks:     []Chunk{{Text: "# Title", Start: 0, End: 7}},
+		Embeddings: [][]float64{{0.1, 0.2}},
+	}
+
+	_, err := StoreVersionRecords(context.Background(), store, version, embedded)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+	if len(store.deleted) != 0 || len(store.embeddings) != 0 {
+		t.Errorf("Expected nothing else to be stored, got links deleted for %v and %d embeddings", store.deleted, len(store.embeddings))
+	}
+
+	store.markdownErr = errors.New("connection reset")
+	if _, err := StoreVersionRecords(context.Background(), store, version, embedded); err == nil || errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected another error not to be a conflict, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SyncCard is a card as it is compared between two instances when syncing. Cards are
+// matched by their UID, as the integer IDs of the instances differ.
+type SyncCard struct {
+	UID     string
+	Title   string
+	Deleted bool
+	// Image is the file name of the image or audio of the card, empty for text cards
+	Image    string
+	Method   string
+	Versions []SyncVersion
+}
+
+// SyncVersion is a markdown version of a card, compared by its hash
+type SyncVersion struct {
+	Ver  int32
+	Hash string
+	// ParentVer is the version this one was edited from, 0 for the first version
+	ParentVer int32
+}
+
+// SyncVersionContent is a markdown version with its embeddings, as it is sent between
+// instances so the receiving side doesn't have to embed it again
+type SyncVersionContent struct {
+	SyncVersion
+	// Title is the title of the card, used when the card is created by the sync
+	Title   string
+	Content string
+	Chunks  []SyncChunk
+}
+
+// SyncChunk is an embedded chunk of a markdown version
+type SyncChunk struct {
+	Idx       int32
+	Model     string
+	Text      string
+	Embedding []float32
+	Chunker   string
+	Start     int32
+	End       int32
+	Type      string
+	Page      int32
+}
+
+// SyncTransfer is what has to be copied of a card to the other instance
+type SyncTransfer struct {
+	UID      string
+	Title    string
+	Versions []int32
+	Image    bool
+}
+
+// SyncConflict is a card that can't be synced without a person deciding which side wins
+type SyncConflict struct {
+	UID    string
+	Title  string
+	Ver    int32
+	Reason string
+}
+
+// SyncPlan is what a sync copies from the local instance to the remote one (Push) and
+// back (Pull), and the cards it leaves alone because they conflict
+type SyncPlan struct {
+	Push      []SyncTransfer
+	Pull      []SyncTransfer
+	Conflicts []SyncConflict
+}
+
+// PlanSync compares the cards of the local and the remote instance. Versions missing on
+// one side are copied in order. When both sides have a version with a different hash,
+// the card was edited on both, and the version and the ones after it are reported as a
+// conflict. Cards in the trash on either side are only reported when their versions differ.
+func PlanSync(local, remote []SyncCard) SyncPlan {
+	remoteByUID := make(map[string]SyncCard, len(remote))
+	for _, card := range remote {
+		remoteByUID[card.UID] = card
+	}
+
+	var plan SyncPlan
+	seen := make(map[string]bool, len(local))
+	for _, l := range local {
+		seen[l.UID] = true
+		r, ok := remoteByUID[l.UID]
+		if !ok {
+			if !l.Deleted {
+				plan.Push = append(plan.Push, fullTransfer(l))
+			}
+			continue
+		}
+
+		push, pull, conflict := compareVersions(l, r)
+		if (l.Deleted || r.Deleted) && (len(push) > 0 || len(pull) > 0 || conflict != nil) {
+			plan.Conflicts = append(plan.Conflicts, SyncConflict{UID: l.UID, Title: l.Title, Reason: "in the trash on one side and changed on the other"})
+			continue
+		}
+		if conflict != nil {
+			plan.Conflicts = append(plan.Conflicts, *conflict)
+		}
+
+		if len(push) > 0 || (l.Image != "" && r.Image == "") {
+			plan.Push = append(plan.Push, SyncTransfer{UID: l.UID, Title: l.Title, Versions: push, Image: l.Image != "" && r.Image == ""})
+		}
+		if len(pull) > 0 || (r.Image != "" && l.Image == "") {
+			plan.Pull = append(plan.Pull, SyncTransfer{UID: r.UID, Title: r.Title, Versions: pull, Image: r.Image != "" && l.Image == ""})
+		}
+	}
+
+	for _, r := range remote {
+		if !seen[r.UID] && !r.Deleted {
+			plan.Pull = append(plan.Pull, fullTransfer(r))
+		}
+	}
+	return plan
+}
+
+// fullTransfer copies every version and the image of a card missing on the other side
+func fullTransfer(card SyncCard) SyncTransfer {
+	versions := make([]int32, len(card.Versions))
+	for i, v := range card.Versions {
+		versions[i] = v.Ver
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return SyncTransfer{UID: card.UID, Title: card.Title, Versions: versions, Image: card.Image != ""}
+}
+
+// compareVersions returns the versions only the local card has, the versions only the
+// remote card has, and the first version both have with a different hash. Versions
+// after a conflict are not copied, as they were edited from different content.
+func compareVersions(local, remote SyncCard) ([]int32, []int32, *SyncConflict) {
+	localHashes := make(map[int32]string, len(local.Versions))
+	for _, v := range local.Versions {
+		localHashes[v.Ver] = v.Hash
+	}
+	remoteHashes := make(map[int32]string, len(remote.Versions))
+	for _, v := range remote.Versions {
+		remoteHashes[v.Ver] = v.Hash
+	}
+
+	versions := make([]int32, 0, len(localHashes)+len(remoteHashes))
+	for ver := range localHashes {
+		versions = append(versions, ver)
+	}
+	for ver := range remoteHashes {
+		if _, ok := localHashes[ver]; !ok {
+			versions = append(versions, ver)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	var push, pull []int32
+	for _, ver := range versions {
+		localHash, inLocal := localHashes[ver]
+		remoteHash, inRemote := remoteHashes[ver]
+		switch {
+		case inLocal && inRemote && localHash != remoteHash:
+			return push, pull, &SyncConflict{
+				UID:    local.UID,
+				Title:  local.Title,
+				Ver:    ver,
+				Reason: fmt.Sprintf("version %d was edited on both sides", ver),
+			}
+		case inLocal && !inRemote:
+			push = append(push, ver)
+		case inRemote && !inLocal:
+			pull = append(pull, ver)
+		}
+	}
+	return push, pull, nil
+}
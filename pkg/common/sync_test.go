@@ -0,0 +1,52 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestPlanSync tests that missing versions are copied to the side that lacks them and that edits on both sides conflict
+func TestPlanSync(t *testing.T) {
+	v := func(ver int32, hash string) SyncVersion { return SyncVersion{Ver: ver, Hash: hash} }
+
+	local := []SyncCard{
+		{UID: "laptop-only", Versions: []SyncVersion{v(1, "a")}, Image: "card.jpg"},
+		{UID: "edited-on-laptop", Versions: []SyncVersion{v(1, "a"), v(2, "b")}},
+		{UID: "edited-on-both", Title: "Both", Versions: []SyncVersion{v(1, "a"), v(2, "b"), v(3, "c")}},
+		{UID: "trashed", Deleted: true, Versions: []SyncVersion{v(1, "a")}},
+		{UID: "trashed-and-edited", Deleted: true, Versions: []SyncVersion{v(1, "a")}},
+	}
+	remote := []SyncCard{
+		{UID: "server-only", Versions: []SyncVersion{v(2, "b"), v(1, "a")}},
+		{UID: "edited-on-laptop", Versions: []SyncVersion{v(1, "a")}},
+		{UID: "edited-on-both", Versions: []SyncVersion{v(1, "a"), v(2, "x"), v(3, "y")}},
+		{UID: "trashed", Versions: []SyncVersion{v(1, "a")}},
+		{UID: "trashed-and-edited", Versions: []SyncVersion{v(1, "a"), v(2, "b")}},
+		{UID: "trashed-on-server", Deleted: true, Versions: []SyncVersion{v(1, "a")}},
+	}
+
+	plan := PlanSync(local, remote)
+
+	expectedPush := []SyncTransfer{
+		{UID: "laptop-only", Versions: []int32{1}, Image: true},
+		{UID: "edited-on-laptop", Versions: []int32{2}},
+	}
+	if !reflect.DeepEqual(plan.Push, expectedPush) {
+		t.Errorf("Expected to push %+v, got %+v", expectedPush, plan.Push)
+	}
+
+	expectedPull := []SyncTransfer{{UID: "server-only", Versions: []int32{1, 2}}}
+	if !reflect.DeepEqual(plan.Pull, expectedPull) {
+		t.Errorf("Expected to pull %+v, got %+v", expectedPull, plan.Pull)
+	}
+
+	if len(plan.Conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %+v", plan.Conflicts)
+	}
+	if plan.Conflicts[0].UID != "edited-on-both" || plan.Conflicts[0].Ver != 2 {
+		t.Errorf("Expected version 2 of the card edited on both sides to conflict, got %+v", plan.Conflicts[0])
+	}
+	if plan.Conflicts[1].UID != "trashed-and-edited" {
+		t.Errorf("Expected the card trashed on one side and edited on the other to conflict, got %+v", plan.Conflicts[1])
+	}
+}
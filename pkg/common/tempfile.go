@@ -0,0 +1,67 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TempPrefix starts the names of the temporary files and directories ume creates, so
+// ume clean-tmp can find the ones that were left behind
+const TempPrefix = "ume_"
+
+// legacyTempRe matches the temporary files older versions of edit and split wrote to
+// predictable paths like /tmp/12_3.md
+var legacyTempRe = regexp.MustCompile(`^\d+_\d+(_split)?\.md$`)
+
+// WriteTempFile writes content to a new temporary file and returns its path.
+// The pattern is used like in os.CreateTemp and should start with TempPrefix.
+func WriteTempFile(pattern string, content []byte) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(content); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("error writing temporary file: %w", err)
+	}
+
+	return file.Name(), nil
+}
+
+// CleanTempFiles removes the temporary files and directories of ume in dir that were
+// last modified before cutoff, and returns their paths. Commands remove their files
+// when they finish, but files are left behind when a command is killed, and images
+// opened in the browser are kept for the browser to read. Files of other users, which
+// can't be removed, are skipped.
+func CleanTempFiles(dir string, cutoff time.Time) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, TempPrefix) && !legacyTempRe.MatchString(name) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if err := os.RemoveAll(path); err != nil {
+			continue
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestCleanTempFiles tests that only old temporary files of ume are removed
+func TestCleanTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+
+	for _, name := range []string{"ume_12_3_123.md", "12_3.md", "ume_new_456.md", "other.md"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("content"), 0600); err != nil {
+			t.Fatalf("Error writing %s: %v", name, err)
+		}
+		if name != "ume_new_456.md" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatalf("Error setting the time of %s: %v", name, err)
+			}
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "ume_upload_789"), 0700); err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	os.Chtimes(filepath.Join(dir, "ume_upload_789"), old, old)
+
+	removed, err := CleanTempFiles(dir, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := []string{filepath.Join(dir, "12_3.md"), filepath.Join(dir, "ume_12_3_123.md"), filepath.Join(dir, "ume_upload_789")}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("Expected %v to be removed, got: %v", expected, removed)
+	}
+
+	for _, name := range []string{"ume_new_456.md", "other.md"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be kept, got: %v", name, err)
+		}
+	}
+}
+
+// TestWriteTempFile tests that each call writes a new file
+func TestWriteTempFile(t *testing.T) {
+	first, err := WriteTempFile("ume_test_*.md", []byte("first"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer os.Remove(first)
+
+	second, err := WriteTempFile("ume_test_*.md", []byte("second"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer os.Remove(second)
+
+	if first == second {
+		t.Errorf("Expected different paths, got %s twice", first)
+	}
+	if content, _ := os.ReadFile(first); string(content) != "first" {
+		t.Errorf("Expected 'first', got: '%s'", content)
+	}
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Import jpeg decoder for automatic format detection
+	"image/png"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// kittyChunkSize is the maximum size of the base64 payload in one kitty graphics command
+const kittyChunkSize = 4096
+
+// TerminalImageProtocol returns the graphics protocol supported by the terminal, "kitty"
+// or "iterm", or "" when images can't be shown in the terminal
+func TerminalImageProtocol() string {
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("TERM") == "xterm-kitty" || os.Getenv("TERM_PROGRAM") == "ghostty":
+		return "kitty"
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm":
+		return "iterm"
+	}
+	return ""
+}
+
+// TerminalImage returns the escape sequence that draws an image at the cursor position,
+// fitted into a box of cols x rows cells while keeping its aspect ratio
+func TerminalImage(data []byte, protocol string, cols, rows int) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("error decoding image: %w", err)
+	}
+	bounds := img.Bounds()
+	cols, rows = FitImageCells(bounds.Dx(), bounds.Dy(), cols, rows)
+
+	switch protocol {
+	case "kitty":
+		// kitty only takes PNG
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return "", fmt.Errorf("error encoding image: %w", err)
+		}
+		payload := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+		var b strings.Builder
+		for i := 0; i < len(payload); i += kittyChunkSize {
+			end := min(i+kittyChunkSize, len(payload))
+			more := 0
+			if end < len(payload) {
+				more = 1
+			}
+			if i == 0 {
+				fmt.Fprintf(&b, "\x1b_Ga=T,f=100,q=2,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, payload[i:end])
+			} else {
+				fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, payload[i:end])
+			}
+		}
+		return b.String(), nil
+	case "iterm":
+		payload := base64.StdEncoding.EncodeToString(data)
+		return fmt.Sprintf("\x1b]1337;File=inline=1;width=%d;height=%d;preserveAspectRatio=1:%s\a", cols, rows, payload), nil
+	}
+	return "", fmt.Errorf("unsupported terminal image protocol: %q", protocol)
+}
+
+// ClearTerminalImages returns the escape sequence that removes the images drawn with a protocol.
+// Images drawn with the iterm protocol are overwritten by text, so nothing is needed.
+func ClearTerminalImages(protocol string) string {
+	if protocol == "kitty" {
+		return "\x1b_Ga=d,q=2\x1b\\"
+	}
+	return ""
+}
+
+// FitImageCells returns the largest number of columns and rows, within a box of cols x rows
+// cells, that an image of width x height pixels fills. Cells are about twice as tall as wide.
+func FitImageCells(width, height, cols, rows int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return cols, rows
+	}
+
+	needed := cols * height / width / 2
+	if needed <= rows {
+		return cols, max(needed, 1)
+	}
+	return max(rows*2*width/height, 1), rows
+}
+
+// ParseKey returns the name of the key in the input read from a terminal in raw mode:
+// "up", "down", "left", "right", "pgup", "pgdown", "enter", "esc", "backspace", "tab",
+// "ctrl+c", or the typed text
+func ParseKey(input []byte) string {
+	switch string(input) {
+	case "\x1b[A", "\x1bOA":
+		return "up"
+	case "\x1b[B", "\x1bOB":
+		return "down"
+	case "\x1b[C", "\x1bOC":
+		return "right"
+	case "\x1b[D", "\x1bOD":
+		return "left"
+	case "\x1b[5~":
+		return "pgup"
+	case "\x1b[6~":
+		return "pgdown"
+	case "\r", "\n":
+		return "enter"
+	case "\x1b":
+		return "esc"
+	case "\x7f", "\b":
+		return "backspace"
+	case "\t":
+		return "tab"
+	case "\x03":
+		return "ctrl+c"
+	}
+
+	// Unknown escape sequences and control characters are ignored
+	if len(input) == 0 || input[0] < 0x20 || !utf8.Valid(input) {
+		return ""
+	}
+	return string(input)
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// TestParseKey tests the ParseKey function
+func TestParseKey(t *testing.T) {
+	tests := map[string]string{
+		"\x1b[A":  "up",
+		"\x1bOB":  "down",
+		"\x1b[6~": "pgdown",
+		"\r":      "enter",
+		"\x1b":    "esc",
+		"\x7f":    "backspace",
+		"\x03":    "ctrl+c",
+		"q":       "q",
+		"梅":       "梅",
+		"\x1b[Z":  "",
+		"\x01":    "",
+	}
+
+	for input, expected := range tests {
+		if key := ParseKey([]byte(input)); key != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, input, key)
+		}
+	}
+}
+
+// TestFitImageCells tests the FitImageCells function
+func TestFitImageCells(t *testing.T) {
+	// Test a wide image limited by the columns
+	cols, rows := FitImageCells(600, 400, 40, 30)
+	if cols != 40 || rows != 13 {
+		t.Errorf("Expected 40x13 cells, got %dx%d", cols, rows)
+	}
+
+	// Test a tall image limited by the rows
+	cols, rows = FitImageCells(400, 600, 40, 10)
+	if cols != 13 || rows != 10 {
+		t.Errorf("Expected 13x10 cells, got %dx%d", cols, rows)
+	}
+}
+
+// TestTerminalImage tests the TerminalImage function
+func TestTerminalImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	// Test the kitty protocol
+	output, err := TerminalImage(buf.Bytes(), "kitty", 10, 10)
+	if err != nil {
+		t.Fatalf("TerminalImage returned an error: %v", err)
+	}
+	if !strings.HasPrefix(output, "\x1b_Ga=T,f=100,q=2,c=10,r=2,m=0;") || !strings.HasSuffix(output, "\x1b\\") {
+		t.Errorf("Unexpected kitty sequence: %q", output)
+	}
+
+	// Test the iterm protocol
+	output, err = TerminalImage(buf.Bytes(), "iterm", 10, 10)
+	if err != nil {
+		t.Fatalf("TerminalImage returned an error: %v", err)
+	}
+	if !strings.HasPrefix(output, "\x1b]1337;File=inline=1;width=10;height=2;") || !strings.HasSuffix(output, "\a") {
+		t.Errorf("Unexpected iterm sequence: %q", output)
+	}
+
+	// Test an unsupported protocol
+	if _, err := TerminalImage(buf.Bytes(), "", 10, 10); err == nil {
+		t.Errorf("Expected an error for an unsupported protocol")
+	}
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// RecencyPenalty is the distance added to the oldest cards when ranking by recency
+const RecencyPenalty = 0.1
+
+// ParseTimeRange parses the --since and --until values of a search. Values are either
+// dates (YYYY-MM-DD) or ages relative to now such as 7d, 2w, 3m or 1y. An until date
+// includes the whole day. Empty values return the zero time.
+func ParseTimeRange(since, until string, now time.Time) (time.Time, time.Time, error) {
+	from, _, err := parseTimeBound(since, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid since %q: %w", since, err)
+	}
+
+	to, isDate, err := parseTimeBound(until, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid until %q: %w", until, err)
+	}
+	if isDate {
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("since %q is not before until %q", since, until)
+	}
+
+	return from, to, nil
+}
+
+// parseTimeBound parses a date or a relative age, and reports whether the value was a date
+func parseTimeBound(value string, now time.Time) (time.Time, bool, error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, true, nil
+	}
+
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, false, fmt.Errorf("expected YYYY-MM-DD or an age like 7d, 2w, 3m or 1y")
+	}
+
+	switch value[len(value)-1] {
+	case 'd':
+		return now.AddDate(0, 0, -n), false, nil
+	case 'w':
+		return now.AddDate(0, 0, -7*n), false, nil
+	case 'm':
+		return now.AddDate(0, -n, 0), false, nil
+	case 'y':
+		return now.AddDate(-n, 0, 0), false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("expected YYYY-MM-DD or an age like 7d, 2w, 3m or 1y")
+}
+
+// RecencyAdjustedDistance adds up to RecencyPenalty to the distance of a search result
+// depending on its age, so that newer cards rank higher. The penalty is half of its
+// maximum for cards that are halfLife old.
+func RecencyAdjustedDistance(distance float32, age, halfLife time.Duration) float32 {
+	if halfLife <= 0 || age <= 0 {
+		return distance
+	}
+
+	decay := math.Pow(0.5, age.Hours()/halfLife.Hours())
+	return distance + float32(RecencyPenalty*(1-decay))
+}
@@ -0,0 +1,71 @@
+package common
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestParseTimeRange tests the ParseTimeRange function
+func TestParseTimeRange(t *testing.T) {
+	now := time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	// Test dates, the until date includes the whole day
+	from, to, err := ParseTimeRange("2025-02-01", "2025-02-28", now)
+	if err != nil {
+		t.Fatalf("ParseTimeRange returned an error: %v", err)
+	}
+	if !from.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected since 2025-02-01, got %v", from)
+	}
+	if !to.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected until 2025-03-01, got %v", to)
+	}
+
+	// Test relative ages
+	from, to, err = ParseTimeRange("1m", "1w", now)
+	if err != nil {
+		t.Fatalf("ParseTimeRange returned an error: %v", err)
+	}
+	if !from.Equal(time.Date(2025, 2, 15, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected since 2025-02-15 12:00, got %v", from)
+	}
+	if !to.Equal(time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected until 2025-03-08 12:00, got %v", to)
+	}
+
+	// Test empty values
+	from, to, err = ParseTimeRange("", "", now)
+	if err != nil || !from.IsZero() || !to.IsZero() {
+		t.Errorf("Expected zero times for empty values, got %v, %v, %v", from, to, err)
+	}
+
+	// Test invalid values
+	if _, _, err := ParseTimeRange("last month", "", now); err == nil {
+		t.Errorf("Expected an error for an invalid value")
+	}
+	if _, _, err := ParseTimeRange("2025-03-01", "2025-02-01", now); err == nil {
+		t.Errorf("Expected an error when since is after until")
+	}
+}
+
+// TestRecencyAdjustedDistance tests the RecencyAdjustedDistance function
+func TestRecencyAdjustedDistance(t *testing.T) {
+	halfLife := 30 * 24 * time.Hour
+
+	// Test that new cards are not penalized
+	if d := RecencyAdjustedDistance(0.8, 0, halfLife); d != 0.8 {
+		t.Errorf("Expected distance 0.8 for a new card, got %v", d)
+	}
+
+	// Test half of the penalty at the half-life
+	d := RecencyAdjustedDistance(0.8, halfLife, halfLife)
+	if math.Abs(float64(d)-(0.8+RecencyPenalty/2)) > 1e-6 {
+		t.Errorf("Expected distance %v at the half-life, got %v", 0.8+RecencyPenalty/2, d)
+	}
+
+	// Test that the boost is off without a half-life
+	if d := RecencyAdjustedDistance(0.8, halfLife, 0); d != 0.8 {
+		t.Errorf("Expected distance 0.8 without a half-life, got %v", d)
+	}
+}
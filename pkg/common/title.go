@@ -0,0 +1,41 @@
+package common
+
+import (
+	"strings"
+)
+
+// MarkdownTitle derives a display title from markdown content.
+// The first heading is used if there is one, otherwise the first non-empty line.
+func MarkdownTitle(content string, maxRunes int) string {
+	var firstLine string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if m := atxHeadingRe.FindStringSubmatch(line); m != nil && m[2] != "" {
+			return Snippet(m[2], maxRunes)
+		}
+		if firstLine == "" {
+			firstLine = line
+		}
+	}
+	return Snippet(firstLine, maxRunes)
+}
+
+// Snippet flattens markdown into a single line of plain text and truncates it to maxRunes
+func Snippet(content string, maxRunes int) string {
+	var words []string
+	for _, word := range strings.Fields(content) {
+		word = strings.Trim(word, "#*_`>")
+		if word != "" && word != "-" {
+			words = append(words, word)
+		}
+	}
+
+	runes := []rune(strings.Join(words, " "))
+	if len(runes) <= maxRunes {
+		return string(runes)
+	}
+	return string(runes[:maxRunes]) + "…"
+}
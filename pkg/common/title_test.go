@@ -0,0 +1,41 @@
+package common
+
+import (
+	"testing"
+)
+
+// TestMarkdownTitle tests the MarkdownTitle function
+func TestMarkdownTitle(t *testing.T) {
+	// Test with a heading that is not on the first line
+	title := MarkdownTitle("some intro\n\n## The **Idea**\n\nbody", 40)
+	if title != "The Idea" {
+		t.Errorf("Expected title 'The Idea', got: '%s'", title)
+	}
+
+	// Test without a heading
+	title = MarkdownTitle("\n\n- first item\n- second item\n", 40)
+	if title != "first item" {
+		t.Errorf("Expected title 'first item', got: '%s'", title)
+	}
+
+	// Test truncation with multibyte characters
+	title = MarkdownTitle("# 梅棹忠夫の知的生産の技術について", 5)
+	if title != "梅棹忠夫の…" {
+		t.Errorf("Expected title '梅棹忠夫の…', got: '%s'", title)
+	}
+
+	// Test with empty content
+	title = MarkdownTitle("", 40)
+	if title != "" {
+		t.Errorf("Expected empty title, got: '%s'", title)
+	}
+}
+
+// TestSnippet tests the Snippet function
+func TestSnippet(t *testing.T) {
+	snippet := Snippet("# Title\n\nSome *emphasized*   text\nover lines", 100)
+	expected := "Title Some emphasized text over lines"
+	if snippet != expected {
+		t.Errorf("Expected snippet '%s', got: '%s'", expected, snippet)
+	}
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Ocr2mdTokenBudget is the most tokens of OCR text converted to markdown in one request.
+// The markdown is about as long as the OCR text, so this leaves room for it in the context.
+const Ocr2mdTokenBudget = 12000
+
+// EstimateTokens estimates the number of tokens of a text without a tokenizer. Latin
+// scripts take about four characters a token, while CJK characters take a token each.
+func EstimateTokens(s string) int {
+	wide, other := 0, 0
+	for _, r := range s {
+		if isWide(r) {
+			wide++
+		} else {
+			other++
+		}
+	}
+	return wide + (other+3)/4
+}
+
+// isWide reports whether a character takes a token of its own
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// SplitByTokens splits a text into sections of at most budget tokens at line breaks.
+// Once a section is half full it is ended before a heading or a blank line if there is
+// one, so related lines stay together. Lines longer than the budget are split on their own.
+func SplitByTokens(s string, budget int) []string {
+	if EstimateTokens(s) <= budget {
+		return []string{s}
+	}
+
+	var sections []string
+	var current []string
+	tokens := 0
+	// breakAt is where the current section is ended when it is full, 0 for the end
+	breakAt := 0
+
+	for _, line := range strings.Split(s, "\n") {
+		for _, piece := range splitLongLine(line, budget) {
+			lineTokens := EstimateTokens(piece) + 1
+
+			if tokens+lineTokens > budget && len(current) > 0 {
+				if breakAt == 0 {
+					breakAt = len(current)
+				}
+				sections = append(sections, strings.Join(current[:breakAt], "\n"))
+				current = append([]string{}, current[breakAt:]...)
+				tokens = 0
+				for _, kept := range current {
+					tokens += EstimateTokens(kept) + 1
+				}
+				breakAt = 0
+			}
+
+			trimmed := strings.TrimSpace(piece)
+			if tokens >= budget/2 && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+				breakAt = len(current)
+			}
+			current = append(current, piece)
+			tokens += lineTokens
+		}
+	}
+
+	if strings.TrimSpace(strings.Join(current, "\n")) != "" {
+		sections = append(sections, strings.Join(current, "\n"))
+	}
+	return sections
+}
+
+// splitLongLine splits a line into pieces of at most budget tokens
+func splitLongLine(line string, budget int) []string {
+	if EstimateTokens(line) <= budget {
+		return []string{line}
+	}
+
+	var pieces []string
+	var piece strings.Builder
+	wide, other := 0, 0
+	for _, r := range line {
+		if isWide(r) {
+			wide++
+		} else {
+			other++
+		}
+		if wide+(other+3)/4 > budget {
+			pieces = append(pieces, piece.String())
+			piece.Reset()
+			wide, other = 0, 0
+			if isWide(r) {
+				wide++
+			} else {
+				other++
+			}
+		}
+		piece.WriteRune(r)
+	}
+	return append(pieces, piece.String())
+}
+
+// HeadingPath returns the headings the end of a markdown document is under, from the
+// top level down, like "# Notes" and "## Meeting"
+func HeadingPath(content string) []string {
+	source := []byte(content)
+	root := goldmark.DefaultParser().Parse(text.NewReader(source))
+
+	var path []string
+	var levels []int
+	ast.Walk(root, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		// A heading replaces the headings at its level and below
+		for len(levels) > 0 && levels[len(levels)-1] >= heading.Level {
+			levels = levels[:len(levels)-1]
+			path = path[:len(path)-1]
+		}
+		title := strings.TrimSpace(string(heading.Lines().Value(source)))
+		levels = append(levels, heading.Level)
+		path = append(path, strings.Repeat("#", heading.Level)+" "+title)
+		return ast.WalkSkipChildren, nil
+	})
+	return path
+}
@@ -0,0 +1,118 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestEstimateTokens tests the EstimateTokens function
+func TestEstimateTokens(t *testing.T) {
+	if tokens := EstimateTokens("abcdefgh"); tokens != 2 {
+		t.Errorf("Expected 2 tokens for 8 latin characters, got %d", tokens)
+	}
+	if tokens := EstimateTokens("梅棹忠夫"); tokens != 4 {
+		t.Errorf("Expected a token for every CJK character, got %d", tokens)
+	}
+	if tokens := EstimateTokens(""); tokens != 0 {
+		t.Errorf("Expected no tokens for an empty text, got %d", tokens)
+	}
+}
+
+// TestSplitByTokens tests the SplitByTokens function
+func TestSplitByTokens(t *testing.T) {
+	// A short text is kept as it is
+	if sections := SplitByTokens("one\ntwo", 100); len(sections) != 1 || sections[0] != "one\ntwo" {
+		t.Errorf("Expected a single section, got %q", sections)
+	}
+
+	// Sections end before a heading once they are half full
+	line := strings.Repeat("x", 36)
+	text := strings.Join([]string{line, line, line, "# Next", line, line, line}, "\n")
+	sections := SplitByTokens(text, 40)
+	if len(sections) != 2 {
+		t.Fatalf("Expected 2 sections, got %q", sections)
+	}
+	if !strings.HasPrefix(sections[1], "# Next") {
+		t.Errorf("Expected the second section to start with the heading, got %q", sections[1])
+	}
+	if strings.Join(sections, "\n") != text {
+		t.Errorf("Expected the sections to hold the whole text, got %q", sections)
+	}
+	for _, section := range sections {
+		if EstimateTokens(section) > 40 {
+			t.Errorf("Expected at most 40 tokens in a section, got %d", EstimateTokens(section))
+		}
+	}
+
+	// Lines longer than the budget are split on their own
+	sections = SplitByTokens(strings.Repeat("y", 100), 10)
+	if len(sections) != 3 || strings.Join(sections, "") != strings.Repeat("y", 100) {
+		t.Errorf("Expected a long line in 3 sections, got %q", sections)
+	}
+}
+
+// TestHeadingPath tests the HeadingPath function
+func TestHeadingPath(t *testing.T) {
+	content := "# Notes\n\n## First\n\ntext\n\n## Second\n\n### Detail\n\n```\n# not a heading\n```\n"
+	path := HeadingPath(content)
+	expected := []string{"# Notes", "## Second", "### Detail"}
+	if strings.Join(path, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, path)
+	}
+
+	if path := HeadingPath("no headings"); len(path) != 0 {
+		t.Errorf("Expected no headings, got %q", path)
+	}
+}
+
+// TestConvertOCRSections tests that long OCR text is converted in sections
+func TestConvertOCRSections(t *testing.T) {
+	var prompts []string
+
+	// The mock server converts every section to a heading with its first word
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		prompt := reqBody.Messages[1].Content
+		prompts = append(prompts, prompt)
+
+		ocr := prompt[strings.Index(prompt, "Here is the OCR result:\n\n")+len("Here is the OCR result:\n\n"):]
+		md, _ := json.Marshal("## " + strings.Fields(ocr)[0])
+		w.Write([]byte(`data: {"choices":[{"delta":{"content":` + string(md) + `},"finish_reason":"stop"}]}` + "\n\n"))
+	}))
+	defer server.Close()
+
+	originalHTTPNewRequest := httpNewRequest
+	defer func() {
+		httpNewRequest = originalHTTPNewRequest
+	}()
+
+	httpNewRequest = func(method, url string, body io.Reader) (*http.Request, error) {
+		return http.NewRequest(method, server.URL, body)
+	}
+
+	// Two lines of two thirds of the budget each
+	line := strings.Repeat("x", Ocr2mdTokenBudget*8/3)
+	md, err := ConvertOCR("test-key", "test-model", "first "+line+"\n\nsecond "+line, false, nil)
+	if err != nil {
+		t.Fatalf("ConvertOCR returned an error: %v", err)
+	}
+
+	if md != "## first\n\n## second" {
+		t.Errorf("Expected the sections to be joined, got %q", md)
+	}
+	if len(prompts) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(prompts))
+	}
+	if !strings.Contains(prompts[1], "part 2 of 2") || !strings.Contains(prompts[1], "## first") {
+		t.Errorf("Expected the second prompt to continue under the previous heading, got %q", prompts[1][:200])
+	}
+}
@@ -0,0 +1,258 @@
+package common
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceExportTimeout is how long exporting the spans of a trace may take
+const traceExportTimeout = 5 * time.Second
+
+// Span is a timed operation of a trace, like an OCR call or a database write. Spans are only
+// recorded when an OTLP endpoint is configured, otherwise StartSpan returns nil and the
+// methods of a nil Span do nothing.
+type Span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    []string
+	err      error
+}
+
+var (
+	// openSpans are the spans that were started and haven't ended, the last one is the
+	// parent of the next span
+	openSpans []*Span
+	// endedSpans are waiting to be exported with their trace
+	endedSpans []*Span
+	traceMu    sync.Mutex
+)
+
+// traceEndpoint returns the OTLP/HTTP endpoint spans are exported to, empty when tracing
+// is not configured or ume is offline
+func traceEndpoint() string {
+	if Offline {
+		return ""
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// StartSpan starts a span as the child of the latest span that hasn't ended, or a new trace
+// when there is none. Spans started before it ends become its children. Attributes are
+// given as name and value pairs.
+func StartSpan(name string, attrs ...string) *Span {
+	return startSpan(name, true, attrs)
+}
+
+// startLeafSpan starts a span that never becomes a parent, for operations that run
+// concurrently like embedding batches
+func startLeafSpan(name string, attrs ...string) *Span {
+	return startSpan(name, false, attrs)
+}
+
+// startSpan starts a span, making it the parent of the next spans if open is set
+func startSpan(name string, open bool, attrs []string) *Span {
+	if traceEndpoint() == "" {
+		return nil
+	}
+
+	traceMu.Lock()
+	defer traceMu.Unlock()
+
+	span := &Span{spanID: randomID(8), name: name, start: time.Now(), attrs: attrs}
+	if len(openSpans) > 0 {
+		parent := openSpans[len(openSpans)-1]
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		span.traceID = randomID(16)
+	}
+
+	if open {
+		openSpans = append(openSpans, span)
+	}
+	return span
+}
+
+// SetAttributes adds name and value pairs to the attributes of the span
+func (s *Span) SetAttributes(attrs ...string) {
+	if s == nil {
+		return
+	}
+
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End ends the span, marking it as failed if err is set. When the first span of a trace
+// ends, the trace is exported.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	traceMu.Lock()
+	s.end = time.Now()
+	s.err = err
+	endedSpans = append(endedSpans, s)
+	for i := len(openSpans) - 1; i >= 0; i-- {
+		if openSpans[i] == s {
+			openSpans = append(openSpans[:i], openSpans[i+1:]...)
+			break
+		}
+	}
+
+	if s.parentID != "" {
+		traceMu.Unlock()
+		return
+	}
+
+	var spans []*Span
+	var rest []*Span
+	for _, ended := range endedSpans {
+		if ended.traceID == s.traceID {
+			spans = append(spans, ended)
+		} else {
+			rest = append(rest, ended)
+		}
+	}
+	endedSpans = rest
+	traceMu.Unlock()
+
+	// A trace that can't be exported shouldn't fail the command it traced
+	if err := exportSpans(traceEndpoint(), spans); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not export trace: %v\n", err)
+	}
+}
+
+// exportSpans sends spans to an OTLP/HTTP endpoint encoded in JSON
+func exportSpans(endpoint string, spans []*Span) error {
+	type keyValue struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+	attributes := func(pairs []string) []keyValue {
+		var kvs []keyValue
+		for i := 0; i+1 < len(pairs); i += 2 {
+			kv := keyValue{Key: pairs[i]}
+			kv.Value.StringValue = pairs[i+1]
+			kvs = append(kvs, kv)
+		}
+		return kvs
+	}
+
+	type status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	type otlpSpan struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            status     `json:"status"`
+	}
+
+	converted := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		converted[i] = otlpSpan{
+			TraceID:           span.traceID,
+			SpanID:            span.spanID,
+			ParentSpanID:      span.parentID,
+			Name:              span.name,
+			Kind:              1, // internal
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        attributes(span.attrs),
+			Status:            status{Code: 1}, // ok
+		}
+		if span.err != nil {
+			converted[i].Status = status{Code: 2, Message: span.err.Error()}
+		}
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "ume"
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{
+			{
+				"resource": map[string]interface{}{
+					"attributes": attributes([]string{"service.name", serviceName}),
+				},
+				"scopeSpans": []map[string]interface{}{
+					{
+						"scope": map[string]string{"name": "github.com/yasushisakai/umesao"},
+						"spans": converted,
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Headers like authentication are given as name=value pairs separated by commas
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if name, value, ok := strings.Cut(header, "="); ok {
+			req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+
+	client := &http.Client{Transport: HTTPClient().Transport, Timeout: traceExportTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("collector returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// randomID returns a random ID of n bytes in hex, as used for trace and span IDs
+func randomID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
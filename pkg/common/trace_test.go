@@ -0,0 +1,98 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSpansWithoutEndpoint tests that nothing is recorded when tracing is not configured
+func TestSpansWithoutEndpoint(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	span := StartSpan("upload")
+	if span != nil {
+		t.Fatal("Expected no span without an endpoint")
+	}
+	// Methods of a nil span do nothing
+	span.SetAttributes("key", "value")
+	span.End(nil)
+}
+
+// TestSpansExport tests that a trace is exported with its nested spans when it ends
+func TestSpansExport(t *testing.T) {
+	var payload struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Status       struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Expected the traces path, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Expected the configured header, got %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL+"/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer token")
+
+	root := StartSpan("upload")
+	ocr := StartSpan("ocr")
+	ocr.End(errors.New("timeout"))
+	batch := startLeafSpan("embeddings.batch")
+	nested := StartSpan("minio.put")
+	nested.End(nil)
+	batch.End(nil)
+
+	if requests != 0 {
+		t.Fatal("Expected the trace to be exported when the root span ends")
+	}
+	root.End(nil)
+	if requests != 1 {
+		t.Fatalf("Expected 1 export, got %d", requests)
+	}
+
+	spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 4 {
+		t.Fatalf("Expected 4 spans, got %d", len(spans))
+	}
+
+	byName := map[string]int{}
+	for i, span := range spans {
+		byName[span.Name] = i
+		if span.TraceID != spans[0].TraceID || len(span.TraceID) != 32 {
+			t.Errorf("Expected every span in the same trace, got %q", span.TraceID)
+		}
+	}
+	rootID := spans[byName["upload"]].SpanID
+	for _, name := range []string{"ocr", "embeddings.batch", "minio.put"} {
+		// Leaf spans are not parents, so minio.put is a child of the root too
+		if spans[byName[name]].ParentSpanID != rootID {
+			t.Errorf("Expected %s to be a child of the root span", name)
+		}
+	}
+	if spans[byName["ocr"]].Status.Code != 2 {
+		t.Errorf("Expected the failed span to have an error status, got %d", spans[byName["ocr"]].Status.Code)
+	}
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultSTTURL is the speech-to-text endpoint used when UME_STT_URL is not set
+const defaultSTTURL = "https://api.openai.com/v1/audio/transcriptions"
+
+// TranscribeAudio sends an audio file to a speech-to-text API and returns the transcript.
+// OpenAI Whisper is used by default. Any provider with an OpenAI compatible
+// transcription endpoint can be configured with UME_STT_URL, UME_STT_MODEL and
+// UME_STT_KEY, which falls back to OPENAI_KEY. The language is detected if it is
+// empty or AutoLanguage.
+func TranscribeAudio(filePath, language string) (string, error) {
+	key := os.Getenv("UME_STT_KEY")
+	if key == "" {
+		var err error
+		key, err = RequireEnvVar("OPENAI_KEY")
+		if err != nil {
+			return "", fmt.Errorf("failed to get env UME_STT_KEY or OPENAI_KEY: %w", err)
+		}
+	}
+
+	url := os.Getenv("UME_STT_URL")
+	if url == "" {
+		url = defaultSTTURL
+	}
+
+	model := os.Getenv("UME_STT_MODEL")
+	if model == "" {
+		model = "whisper-1"
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open audio file: %w", err)
+	}
+	defer file.Close()
+
+	// Build the multipart form with the audio file and the options
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(filePath))
+	if err != nil {
+		return "", fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return "", fmt.Errorf("failed to read audio file: %w", err)
+	}
+
+	fields := map[string]string{
+		"model":           model,
+		"response_format": "json",
+	}
+	if language != "" && language != AutoLanguage {
+		fields["language"] = language
+	}
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return "", fmt.Errorf("failed to write form field %s: %w", name, err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	req, err := httpNewRequest("POST", url, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	ctx, cancel := CallContext()
+	defer cancel()
+	resp, err := HTTPClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", &ProviderError{Provider: "Speech-to-text", Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError("Speech-to-text", resp)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to unmarshal response JSON: %w", err)
+	}
+
+	return strings.TrimSpace(result.Text), nil
+}
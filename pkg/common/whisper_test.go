@@ -0,0 +1,68 @@
+package common
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscribeAudio(t *testing.T) {
+	// Set up a mock server to handle the transcription request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer stt-key" {
+			t.Errorf("Expected Authorization header 'Bearer stt-key', got %s", auth)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected an audio file in the form: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		if header.Filename != "memo.m4a" {
+			t.Errorf("Expected file name 'memo.m4a', got '%s'", header.Filename)
+		}
+
+		audio, _ := io.ReadAll(file)
+		if string(audio) != "audio data" {
+			t.Errorf("Expected the audio file content, got '%s'", string(audio))
+		}
+
+		if model := r.FormValue("model"); model != "whisper-1" {
+			t.Errorf("Expected model 'whisper-1', got '%s'", model)
+		}
+
+		if language := r.FormValue("language"); language != "ja" {
+			t.Errorf("Expected language 'ja', got '%s'", language)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text":" Buy milk and call the bank. "}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("UME_STT_KEY", "stt-key")
+	t.Setenv("UME_STT_URL", server.URL)
+	t.Setenv("UME_STT_MODEL", "")
+
+	path := filepath.Join(t.TempDir(), "memo.m4a")
+	if err := os.WriteFile(path, []byte("audio data"), 0644); err != nil {
+		t.Fatalf("Failed to write audio file: %v", err)
+	}
+
+	transcript, err := TranscribeAudio(path, "ja")
+	if err != nil {
+		t.Fatalf("TranscribeAudio returned an error: %v", err)
+	}
+
+	if transcript != "Buy milk and call the bank." {
+		t.Errorf("Expected trimmed transcript, got '%s'", transcript)
+	}
+}
@@ -0,0 +1,461 @@
+// Package umesao is a client library for the umesao card archive.
+//
+// It runs the same pipeline as the ume command: card images are stored in Minio,
+// their text is extracted to markdown, and the markdown is versioned, chunked and
+// embedded in Postgres for semantic search. Nothing is printed and errors are
+// always returned, so the package can be embedded in other programs.
+//
+// The client is configured from the same environment variables as the command:
+// DB_STRING, MINIO_ENDPOINT, MINIO_USER, MINIO_PASSWORD and OPENAI_KEY, plus the
+// OCR provider keys when the ocr or mistral methods are used. Cards created with
+// UME_API_KEY set belong to its user, like with the command.
+package umesao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yasushisakai/umesao/database"
+	"github.com/yasushisakai/umesao/pkg/common"
+)
+
+// Method is how the text of a card is extracted from its image
+type Method = common.Method
+
+// Text extraction methods for CreateCardFromImage
+const (
+	MethodOCR     = common.MethodOCR     // Azure OCR, formatted to markdown with OpenAI
+	MethodMistral = common.MethodMistral // Mistral OCR, formatted to markdown with OpenAI
+	MethodVision  = common.MethodVision  // OpenAI vision caption, for diagrams and charts
+)
+
+// ErrUnchanged is returned by Edit when the content is the same as the latest version
+var ErrUnchanged = errors.New("content is unchanged")
+
+// Client gives access to the cards of an archive
+type Client struct {
+	pool      *pgxpool.Pool
+	queries   *database.Queries
+	minio     *common.MinioClient
+	openaiKey string
+	// owner is the user of UME_API_KEY, who owns the cards the client creates
+	owner pgtype.Int4
+}
+
+// Card is a card and its latest markdown version
+type Card struct {
+	ID int32
+	// UID identifies the card across instances, while ID is local to this archive
+	UID     string
+	Title   string
+	Version int32
+}
+
+// CreateOptions configures how a card is created from an image
+type CreateOptions struct {
+	Method    Method // one of the Method constants, MethodOCR if empty
+	Language  string // language of the text for MethodOCR, detected if empty
+	Normalize bool   // normalize the markdown before storing it
+	// Handwriting uses settings tuned for handwritten cards, marking uncertain words with [?].
+	// With MethodVision the card is transcribed instead of described.
+	Handwriting bool
+	// Diagram also describes what the diagrams of the image show, in a section after the
+	// text transcribed from it
+	Diagram bool
+}
+
+// SearchResult is the best matching chunk of a card
+type SearchResult struct {
+	CardID   int32
+	Version  int32
+	Title    string
+	Text     string
+	Lang     string // language of the matched translation, empty for the original
+	Type     string // what the matched chunk is, like heading or table-row, empty if not known
+	Page     int    // page of a multi-page card the chunk is on, 0 if the card has no pages
+	Distance float32
+}
+
+// New creates a client configured from the environment
+func New() (*Client, error) {
+	openaiKey, err := common.RequireEnvVar("OPENAI_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	minioClient, err := common.NewMinioClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pool, queries, err := common.InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var owner pgtype.Int4
+	if key := os.Getenv("UME_API_KEY"); key != "" {
+		user, err := queries.GetUserByAPIKeyHash(context.Background(), common.HashAPIKey(key))
+		if err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("UME_API_KEY: invalid API key")
+		}
+		owner = pgtype.Int4{Int32: user.ID, Valid: true}
+	}
+
+	return &Client{
+		pool:      pool,
+		queries:   queries,
+		minio:     minioClient,
+		openaiKey: openaiKey,
+		owner:     owner,
+	}, nil
+}
+
+// Close releases the database connections of the client
+func (c *Client) Close() {
+	c.pool.Close()
+}
+
+// CreateCardFromImage uploads an image, extracts its content as markdown and
+// stores it as the first version of a new card.
+func (c *Client) CreateCardFromImage(ctx context.Context, imagePath string, opts CreateOptions) (Card, error) {
+	method := opts.Method
+	if method == "" {
+		method = MethodOCR
+	}
+	if !method.IsImage() {
+		return Card{}, fmt.Errorf("invalid method: %s", method)
+	}
+	language := opts.Language
+	if method == MethodOCR && language == "" {
+		language = common.AutoLanguage
+	}
+
+	cardID, err := c.createCard(ctx)
+	if err != nil {
+		return Card{}, err
+	}
+
+	imageName, err := c.minio.UploadImageForCard(cardID, imagePath)
+	if err != nil {
+		return Card{}, fmt.Errorf("error uploading image file: %w", err)
+	}
+
+	err = c.queries.CreateImage(ctx, database.CreateImageParams{
+		CardID:   cardID,
+		Filename: imageName,
+		Method:   method.String(),
+	})
+	if err != nil {
+		return Card{}, fmt.Errorf("error associating image with card: %w", err)
+	}
+
+	extract := common.ExtractMarkdown
+	if opts.Diagram {
+		extract = common.ExtractDiagramMarkdown
+	}
+	content, ocrResult, err := extract(imagePath, method, language, c.openaiKey, opts.Handwriting, nil)
+	if err != nil {
+		return Card{}, err
+	}
+
+	if opts.Normalize {
+		content = common.NormalizeMarkdown(content)
+	}
+
+	if err := c.storeVersion(ctx, cardID, 1, pgtype.Int4{}, content, method); err != nil {
+		return Card{}, err
+	}
+
+	// Keep the raw OCR result so the markdown can be converted again later
+	if ocrResult != "" {
+		if err := c.minio.UploadOCRForCard(cardID, 1, []byte(ocrResult)); err != nil {
+			return Card{}, fmt.Errorf("error uploading OCR result: %w", err)
+		}
+
+		// Cards the OCR was unsure of are flagged for review
+		var quality pgtype.Float4
+		if parsed, err := common.ParseOCRResult(ocrResult); err == nil {
+			if score, ok := parsed.Quality(); ok {
+				quality = pgtype.Float4{Float32: float32(score), Valid: true}
+			}
+		}
+
+		err = c.queries.CreateOCRResult(ctx, database.CreateOCRResultParams{
+			CardID:      cardID,
+			Ver:         1,
+			Method:      method.String(),
+			Handwriting: opts.Handwriting,
+			Quality:     quality,
+		})
+		if err != nil {
+			return Card{}, fmt.Errorf("error storing OCR result: %w", err)
+		}
+
+		if quality.Valid && float64(quality.Float32) < common.OCRReviewThreshold() {
+			err = c.queries.SetCardNeedsReview(ctx, database.SetCardNeedsReviewParams{ID: cardID, NeedsReview: true})
+			if err != nil {
+				return Card{}, fmt.Errorf("error flagging card for review: %w", err)
+			}
+		}
+	}
+
+	return c.titleCard(ctx, cardID, content)
+}
+
+// CreateCardFromMarkdown stores markdown content as the first version of a new card
+// without an image. Only the Normalize option is used.
+func (c *Client) CreateCardFromMarkdown(ctx context.Context, content string, opts CreateOptions) (Card, error) {
+	if opts.Normalize {
+		content = common.NormalizeMarkdown(content)
+	}
+	if strings.TrimSpace(content) == "" {
+		return Card{}, fmt.Errorf("no content")
+	}
+
+	cardID, err := c.createCard(ctx)
+	if err != nil {
+		return Card{}, err
+	}
+
+	if err := c.storeVersion(ctx, cardID, 1, pgtype.Int4{}, content, common.MethodText); err != nil {
+		return Card{}, err
+	}
+
+	return c.titleCard(ctx, cardID, content)
+}
+
+// titleCard generates and stores the title of a new card, falling back to the first heading or line
+func (c *Client) titleCard(ctx context.Context, cardID int32, content string) (Card, error) {
+	title := common.MarkdownTitle(content, 60)
+	if openaiClient, err := common.NewOpenAIClient(); err == nil {
+		if generated, err := openaiClient.GenerateTitle(content); err == nil && generated != "" {
+			title = generated
+		}
+	}
+
+	err := c.queries.SetCardTitle(ctx, database.SetCardTitleParams{ID: cardID, Title: title})
+	if err != nil {
+		return Card{}, fmt.Errorf("error storing card title: %w", err)
+	}
+
+	uid, err := c.queries.GetCardUID(ctx, cardID)
+	if err != nil {
+		return Card{}, fmt.Errorf("error getting card UID: %w", err)
+	}
+
+	return Card{ID: cardID, UID: uid, Title: title, Version: 1}, nil
+}
+
+// CardID returns the local ID of the card with a UID
+func (c *Client) CardID(ctx context.Context, uid string) (int32, error) {
+	cardID, err := c.queries.GetCardByUID(ctx, strings.ToLower(uid))
+	if err != nil {
+		return 0, fmt.Errorf("error finding card %s: %w", uid, err)
+	}
+	return cardID, nil
+}
+
+// createCard creates an empty card owned by the user of the client
+func (c *Client) createCard(ctx context.Context) (int32, error) {
+	cardID, err := c.queries.CreateCard(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error creating card: %w", err)
+	}
+
+	if c.owner.Valid {
+		err = c.queries.SetCardOwner(ctx, database.SetCardOwnerParams{ID: cardID, OwnerID: c.owner})
+		if err != nil {
+			return 0, fmt.Errorf("error setting card owner: %w", err)
+		}
+	}
+	return cardID, nil
+}
+
+// Search returns the cards whose latest version is closest to the query,
+// with the best matching chunk of each card, ordered by distance.
+func (c *Client) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	embeddingModel, err := common.CurrentEmbeddingModel()
+	if err != nil {
+		return nil, err
+	}
+	embeddings, err := embeddingModel.EmbedQueries(c.openaiKey, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("error generating query embedding: %w", err)
+	}
+	if len(embeddings) == 0 {
+		return nil, fmt.Errorf("no embeddings generated for the query")
+	}
+
+	var rows []database.SearchLatestDistanceRow
+	err = common.WidenCandidates(common.SearchCandidates(limit), limit, func(candidates int32) (int, error) {
+		var err error
+		rows, err = c.queries.SearchLatestDistance(ctx, database.SearchLatestDistanceParams{
+			Embedding:  common.EmbeddingToPGVector(embeddings[0]),
+			Model:      embeddingModel.Name,
+			Candidates: candidates,
+			Limit:      int32(limit),
+		})
+		return len(rows), err
+	}, func() (int32, error) {
+		return c.queries.CountModelChunks(ctx, embeddingModel.Name)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching embeddings: %w", err)
+	}
+
+	results := make([]SearchResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, SearchResult{
+			CardID:   row.CardID,
+			Version:  row.Ver,
+			Title:    row.Title,
+			Text:     row.Text,
+			Lang:     row.Lang,
+			Type:     row.Type,
+			Page:     int(row.Page),
+			Distance: float32(row.Distance),
+		})
+	}
+
+	return results, nil
+}
+
+// GetMarkdown returns the markdown of a card version, or of the latest version if version is 0
+func (c *Client) GetMarkdown(ctx context.Context, cardID, version int32) (string, error) {
+	if version <= 0 {
+		latest, err := c.queries.GetLatestMarkdownVersion(ctx, cardID)
+		if err != nil {
+			return "", fmt.Errorf("error getting latest markdown version: %w", err)
+		}
+		version = latest
+	}
+
+	content, err := common.ReadMarkdown(ctx, c.queries, c.minio, cardID, version)
+	if err != nil {
+		return "", fmt.Errorf("error reading markdown: %w", err)
+	}
+
+	return content, nil
+}
+
+// Edit stores content as a new version of a card, on top of the latest version.
+// It returns the new version, or ErrUnchanged if the content didn't change.
+func (c *Client) Edit(ctx context.Context, cardID int32, content string) (int32, error) {
+	latest, err := c.queries.GetLatestMarkdownVersion(ctx, cardID)
+	if err != nil {
+		return 0, fmt.Errorf("error getting latest markdown version: %w", err)
+	}
+
+	current, err := c.GetMarkdown(ctx, cardID, latest)
+	if err != nil {
+		return 0, err
+	}
+	if common.CalculateFileHash([]byte(current)) == common.CalculateFileHash([]byte(content)) {
+		return latest, ErrUnchanged
+	}
+
+	// Chunk the content the same way it was chunked on upload
+	methodName, err := c.queries.GetCardMethod(ctx, cardID)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving card method: %w", err)
+	}
+	method := common.Method(methodName)
+
+	version := latest + 1
+	err = c.storeVersion(ctx, cardID, version, pgtype.Int4{Int32: latest, Valid: true}, content, method)
+	if err != nil {
+		return 0, err
+	}
+
+	// The card was looked at, so it no longer needs review
+	err = c.queries.SetCardNeedsReview(ctx, database.SetCardNeedsReviewParams{ID: cardID, NeedsReview: false})
+	if err != nil {
+		return 0, fmt.Errorf("error clearing the review flag: %w", err)
+	}
+
+	return version, nil
+}
+
+// Delete permanently deletes a card with all its images, markdown versions, translations
+// and embeddings
+func (c *Client) Delete(ctx context.Context, cardID int32) error {
+	objects, err := c.cardObjects(ctx, cardID)
+	if err != nil {
+		return err
+	}
+
+	warnings, err := common.DeleteCardObjects(c.queries, c.minio, objects, cardID)
+	if err != nil {
+		return err
+	}
+	if len(warnings) > 0 {
+		return fmt.Errorf("card %d was deleted, but some objects were left behind: %w", cardID, errors.Join(warnings...))
+	}
+
+	return nil
+}
+
+// Trash moves a card to the trash, from where it can be restored with Restore
+func (c *Client) Trash(ctx context.Context, cardID int32) error {
+	objects, err := c.cardObjects(ctx, cardID)
+	if err != nil {
+		return err
+	}
+
+	warnings, err := common.TrashCardObjects(c.queries, c.minio, objects, cardID)
+	if err != nil {
+		return err
+	}
+	if len(warnings) > 0 {
+		return fmt.Errorf("card %d was moved to the trash, but some objects were left behind: %w", cardID, errors.Join(warnings...))
+	}
+
+	return nil
+}
+
+// Restore moves a card out of the trash
+func (c *Client) Restore(ctx context.Context, cardID int32) error {
+	objects, err := c.cardObjects(ctx, cardID)
+	if err != nil {
+		return err
+	}
+
+	warnings, err := common.RestoreCardObjects(c.queries, c.minio, objects, cardID)
+	if err != nil {
+		return err
+	}
+	if len(warnings) > 0 {
+		return fmt.Errorf("card %d was restored, but some objects were left in the trash: %w", cardID, errors.Join(warnings...))
+	}
+
+	return nil
+}
+
+// cardObjects lists the objects stored for a card, which has to exist
+func (c *Client) cardObjects(ctx context.Context, cardID int32) ([]common.CardObject, error) {
+	if _, err := c.queries.GetCardTitle(ctx, cardID); err != nil {
+		return nil, &common.CardError{CardID: cardID, Err: err}
+	}
+
+	return common.ListCardObjects(c.queries, c.minio.ImageBucket, c.minio.MarkdownBucket, c.minio.OCRBucket, c.minio.AttachmentBucket, cardID)
+}
+
+// storeVersion uploads a markdown version and stores its hash, links and embeddings, like
+// the command does. Links to cards that don't exist are skipped.
+func (c *Client) storeVersion(ctx context.Context, cardID, version int32, parent pgtype.Int4, content string, method Method) error {
+	_, err := common.StoreVersion(ctx, c.pool, c.queries, c.minio, c.openaiKey, common.MarkdownVersion{
+		CardID:  cardID,
+		Version: version,
+		Parent:  parent,
+		Content: content,
+		Method:  method,
+	})
+	return err
+}
@@ -0,0 +1,69 @@
+package umesao
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestNewRequiresOpenAIKey tests that a client isn't created without OPENAI_KEY
+func TestNewRequiresOpenAIKey(t *testing.T) {
+	t.Setenv("OPENAI_KEY", "")
+
+	if _, err := New(); err == nil {
+		t.Error("Expected error without OPENAI_KEY, got nil")
+	}
+}
+
+// TestClientLifecycle tests creating, editing, trashing, restoring and deleting a card
+// with the same pipeline as the command
+func TestClientLifecycle(t *testing.T) {
+	// Skip this test if the database, Minio or OpenAI aren't configured
+	for _, name := range []string{"DB_STRING", "MINIO_ENDPOINT", "OPENAI_KEY"} {
+		if os.Getenv(name) == "" {
+			t.Skipf("Skipping test because %s environment variable is not set", name)
+		}
+	}
+	t.Setenv("UME_API_KEY", "")
+
+	client, err := New()
+	if err != nil {
+		t.Fatalf("Error creating client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	card, err := client.CreateCardFromMarkdown(ctx, "# Client test\n\nThe first version.", CreateOptions{})
+	if err != nil {
+		t.Fatalf("Error creating card: %v", err)
+	}
+	defer client.Delete(ctx, card.ID)
+
+	content := "# Client test\n\nThe second version."
+	version, err := client.Edit(ctx, card.ID, content)
+	if err != nil || version != 2 {
+		t.Fatalf("Expected version 2, got %d, %v", version, err)
+	}
+	if _, err := client.Edit(ctx, card.ID, content); !errors.Is(err, ErrUnchanged) {
+		t.Errorf("Expected ErrUnchanged for the same content, got %v", err)
+	}
+
+	if err := client.Trash(ctx, card.ID); err != nil {
+		t.Fatalf("Error trashing card: %v", err)
+	}
+	if err := client.Restore(ctx, card.ID); err != nil {
+		t.Fatalf("Error restoring card: %v", err)
+	}
+	got, err := client.GetMarkdown(ctx, card.ID, 0)
+	if err != nil || got != content {
+		t.Errorf("Expected the second version after restoring, got %q, %v", got, err)
+	}
+
+	if err := client.Delete(ctx, card.ID); err != nil {
+		t.Fatalf("Error deleting card: %v", err)
+	}
+	if _, err := client.GetMarkdown(ctx, card.ID, 0); err == nil {
+		t.Error("Expected error for a deleted card, got nil")
+	}
+}
@@ -4,21 +4,254 @@ INSERT INTO cards DEFAULT
     RETURNING
         id;
 
+-- name: GetCardByExternalID :one
+SELECT
+    id
+FROM
+    cards
+WHERE
+    external_id = sqlc.arg(external_id)::text;
+
+-- name: SetCardExternalID :exec
+UPDATE
+    cards
+SET
+    external_id = sqlc.arg(external_id)::text
+WHERE
+    id = sqlc.arg(id);
+
+-- name: SetCardTitle :exec
+UPDATE
+    cards
+SET
+    title = $2
+WHERE
+    id = $1;
+
+-- name: GetCardTitle :one
+SELECT
+    title
+FROM
+    cards
+WHERE
+    id = $1;
+
 -- name: DeleteCard :exec
 DELETE FROM cards
 WHERE id = $1;
 
+-- name: SetCardOwner :exec
+UPDATE
+    cards
+SET
+    owner_id = $2
+WHERE
+    id = $1;
+
+-- name: GetCardOwner :one
+SELECT
+    owner_id
+FROM
+    cards
+WHERE
+    id = $1;
+
+-- name: TrashCard :exec
+UPDATE
+    cards
+SET
+    deleted_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1;
+
+-- name: GetCardDeletedAt :one
+-- set when the card is in the trash
+SELECT
+    deleted_at
+FROM
+    cards
+WHERE
+    id = $1;
+
+-- name: RestoreCard :exec
+UPDATE
+    cards
+SET
+    deleted_at = NULL
+WHERE
+    id = $1;
+
+-- name: SetCardNeedsReview :exec
+UPDATE
+    cards
+SET
+    needs_review = $2
+WHERE
+    id = $1;
+
+-- name: ListCardsNeedingReview :many
+-- flagged cards with the quality of their latest OCR, least certain first
+SELECT
+    cards.id,
+    cards.title,
+    COALESCE((
+        SELECT
+            quality
+        FROM
+            ocr_results
+        WHERE
+            ocr_results.card_id = cards.id
+        ORDER BY
+            ver DESC
+        LIMIT 1), 0)::real AS quality
+FROM
+    cards
+WHERE
+    cards.needs_review
+    AND cards.deleted_at IS NULL
+    AND (sqlc.narg(owner_id)::int IS NULL
+        OR cards.owner_id IS NULL
+        OR cards.owner_id = sqlc.narg(owner_id))
+ORDER BY
+    quality,
+    cards.id;
+
+-- name: ListTrashedCards :many
+-- only the cards the user can restore or delete
+SELECT
+    id,
+    title,
+    deleted_at
+FROM
+    cards
+WHERE
+    deleted_at IS NOT NULL
+    AND (sqlc.narg(owner_id)::int IS NULL
+        OR cards.owner_id = sqlc.narg(owner_id)
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+                INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+            WHERE
+                cc.card_id = cards.id
+                AND cs.user_id = sqlc.narg(owner_id)
+                AND cs.can_write))
+ORDER BY
+    deleted_at DESC;
+
 -- name: CreateImage :exec
 INSERT INTO images (card_id, filename, method)
     VALUES ($1, $2, $3);
 
+-- name: CardHasImage :one
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            images
+        WHERE
+            card_id = $1
+            AND filename = $2);
+
+-- name: SetImageKind :exec
+UPDATE
+    images
+SET
+    kind = $2
+WHERE
+    card_id = $1;
+
 -- name: CreateMarkdown :exec
-INSERT INTO markdown_files (card_id, ver, hash)
-    VALUES ($1, $2, $3);
+INSERT INTO markdown_files (card_id, ver, hash, parent_ver, lang, content, by_hash)
+    VALUES ($1, $2, $3, $4, $5, $6, TRUE);
+
+-- name: GetMarkdownContent :one
+SELECT
+    content,
+    hash,
+    by_hash
+FROM
+    markdown_files
+WHERE
+    card_id = $1
+    AND ver = $2;
+
+-- name: SetMarkdownContent :exec
+UPDATE
+    markdown_files
+SET
+    content = $3
+WHERE
+    card_id = $1
+    AND ver = $2;
+
+-- name: SetMarkdownByHash :exec
+-- the markdown of the version was moved to the name of its hash
+UPDATE
+    markdown_files
+SET
+    by_hash = TRUE
+WHERE
+    card_id = $1
+    AND ver = $2;
+
+-- name: ListSharedMarkdownHashes :many
+-- hashes of the card's markdown stored by hash that versions of other cards share
+SELECT DISTINCT
+    mf.hash
+FROM
+    markdown_files mf
+WHERE
+    mf.card_id = $1
+    AND mf.by_hash
+    AND EXISTS (
+        SELECT
+            1
+        FROM
+            markdown_files other
+        WHERE
+            other.hash = mf.hash
+            AND other.by_hash
+            AND other.card_id <> mf.card_id);
+
+-- name: GetMarkdownLanguage :one
+SELECT
+    lang
+FROM
+    markdown_files
+WHERE
+    card_id = $1
+    AND ver = $2;
 
 -- name: CreateEmbeddings :exec
-INSERT INTO chunks (card_id, ver, idx, model, text, embedding)
-    VALUES ($1, $2, $3, $4, $5, $6);
+INSERT INTO chunks (card_id, ver, idx, model, text, embedding, chunker, start_offset, end_offset, type, page)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
+
+-- name: CreateTranslationEmbeddings :exec
+INSERT INTO chunks (card_id, ver, idx, model, text, embedding, lang, chunker, start_offset, end_offset, type, page)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);
+
+-- name: GetChunkRange :one
+SELECT
+    start_offset,
+    end_offset
+FROM
+    chunks
+WHERE
+    card_id = $1
+    AND ver = $2
+    AND idx = $3
+    AND lang = $4
+LIMIT 1;
+
+-- name: DeleteTranslationEmbeddings :exec
+DELETE FROM chunks
+WHERE card_id = $1
+    AND ver = $2
+    AND lang = $3;
 
 -- name: GetLatestMarkdownVersion :one
 SELECT
@@ -31,14 +264,74 @@ ORDER BY
     ver DESC
 LIMIT 1;
 
+-- name: GetMarkdownFile :one
+SELECT
+    ver,
+    hash,
+    parent_ver,
+    created_at
+FROM
+    markdown_files
+WHERE
+    card_id = $1
+    AND ver = $2;
+
+-- name: ListMarkdownVersions :many
+SELECT
+    ver,
+    hash,
+    parent_ver,
+    by_hash,
+    created_at
+FROM
+    markdown_files
+WHERE
+    card_id = $1
+ORDER BY
+    ver ASC;
+
+-- name: GetEmbeddingModel :one
+SELECT
+    name,
+    dimension,
+    provider
+FROM
+    models
+WHERE
+    name = $1;
+
+-- name: CountModelChunks :one
+SELECT
+    COUNT(*)::int
+FROM
+    chunks
+WHERE
+    model = $1;
+
+-- name: ListEmbeddingModels :many
+-- models with the number of chunks embedded with them
+SELECT
+    models.name,
+    models.dimension,
+    models.provider,
+    COUNT(chunks.model)::int AS chunks
+FROM
+    models
+    LEFT JOIN chunks ON chunks.model = models.name
+GROUP BY
+    models.name
+ORDER BY
+    models.name;
+
 -- name: SearchDistance :many
+-- distances are cosine distances, like in nearest_chunks and the indexes of the models
 SELECT
     card_id,
     ver,
     idx,
     model,
     text,
-    embedding <-> $1 AS distance
+    embedding <=> $1 AS distance
 FROM
     chunks
 ORDER BY
@@ -46,6 +339,592 @@ ORDER BY
 LIMIT $2;
 
 -- name: SearchLatestDistance :many
+-- cards are dated by their first version. Only the best matching chunk of each card is
+-- kept, so the limit and offset page through cards, and ties are broken by the card and
+-- chunk so pages don't overlap. With all_versions the chunks of every version are
+-- searched, not only of the latest one. The candidates closest chunks are found first with
+-- the index of the model, and only those are filtered, so a short page is searched again
+-- with more candidates
+WITH nearest AS (
+    SELECT
+        *
+    FROM
+        nearest_chunks (sqlc.arg(embedding)::vector, sqlc.arg(model), sqlc.arg(candidates)::int)
+),
+latest_versions AS (
+    SELECT
+        card_id,
+        MAX(ver) AS max_ver,
+        MIN(created_at) AS created_at
+    FROM
+        markdown_files
+    GROUP BY
+        card_id
+),
+best_chunks AS (
+    SELECT DISTINCT ON (c.card_id)
+        c.card_id,
+        c.ver,
+        c.idx,
+        c.model,
+        c.text,
+        c.lang,
+        c.type,
+        c.page,
+        cards.title,
+        lv.created_at::timestamptz AS created_at,
+        n.distance::float8 AS distance
+    FROM
+        nearest n
+        INNER JOIN chunks c ON c.card_id = n.card_id
+            AND c.ver = n.ver
+            AND c.model = sqlc.arg(model)
+            AND c.lang = n.lang
+            AND c.idx = n.idx
+        INNER JOIN latest_versions lv ON c.card_id = lv.card_id
+            AND (sqlc.arg(all_versions)::bool
+                OR c.ver = lv.max_ver)
+        INNER JOIN cards ON cards.id = c.card_id
+    WHERE
+        cards.deleted_at IS NULL
+        AND (sqlc.narg(owner_id)::int IS NULL
+            OR cards.owner_id IS NULL
+            OR cards.owner_id = sqlc.narg(owner_id)
+            OR EXISTS (
+                SELECT
+                    1
+                FROM
+                    collection_cards cc
+                    INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+                WHERE
+                    cc.card_id = cards.id
+                    AND cs.user_id = sqlc.narg(owner_id)))
+        AND (sqlc.narg(collection_id)::int IS NULL
+            OR EXISTS (
+                SELECT
+                    1
+                FROM
+                    collection_cards cc
+                WHERE
+                    cc.card_id = cards.id
+                    AND cc.collection_id = sqlc.narg(collection_id)))
+        AND (sqlc.narg(since)::timestamptz IS NULL
+            OR lv.created_at >= sqlc.narg(since))
+        AND (sqlc.narg(until)::timestamptz IS NULL
+            OR lv.created_at < sqlc.narg(until))
+        AND (sqlc.arg(include_archived)::bool
+            OR cards.archived_at IS NULL)
+        -- cards created from text have no image, like in GetCardMethod
+        AND (sqlc.narg(method)::text IS NULL
+            OR COALESCE((
+                SELECT
+                    method
+                FROM images
+                WHERE
+                    images.card_id = cards.id
+                LIMIT 1), 'text') = sqlc.narg(method))
+    ORDER BY
+        c.card_id,
+        distance ASC,
+        c.ver DESC,
+        c.idx ASC,
+        c.lang ASC
+)
+SELECT
+    card_id,
+    ver,
+    idx,
+    model,
+    text,
+    lang,
+    type,
+    page,
+    title,
+    created_at,
+    distance
+FROM
+    best_chunks
+ORDER BY
+    distance ASC,
+    card_id ASC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: SearchLatestText :many
+-- full-text search of the chunks, for looking up offline when the query can't be
+-- embedded. Like in SearchLatestDistance only the best matching chunk of each card is
+-- kept. Words are matched with the simple configuration, and the whole query is also
+-- matched as a substring and ranked higher, for languages like Japanese that aren't
+-- split into words
+WITH latest_versions AS (
+    SELECT
+        card_id,
+        MAX(ver) AS max_ver,
+        MIN(created_at) AS created_at
+    FROM
+        markdown_files
+    GROUP BY
+        card_id
+),
+best_chunks AS (
+    SELECT DISTINCT ON (c.card_id)
+        c.card_id,
+        c.ver,
+        c.idx,
+        c.model,
+        c.text,
+        c.lang,
+        c.type,
+        c.page,
+        cards.title,
+        lv.created_at::timestamptz AS created_at,
+        (ts_rank(to_tsvector('simple', c.text), websearch_to_tsquery('simple', sqlc.arg(query)::text))
+            + CASE WHEN strpos(lower(c.text), lower(sqlc.arg(query)::text)) > 0 THEN 1 ELSE 0 END)::real AS rank
+    FROM
+        chunks c
+        INNER JOIN latest_versions lv ON c.card_id = lv.card_id
+            AND (sqlc.arg(all_versions)::bool
+                OR c.ver = lv.max_ver)
+        INNER JOIN cards ON cards.id = c.card_id
+    WHERE
+        cards.deleted_at IS NULL
+        AND (to_tsvector('simple', c.text) @@ websearch_to_tsquery('simple', sqlc.arg(query)::text)
+            OR strpos(lower(c.text), lower(sqlc.arg(query)::text)) > 0)
+        AND (sqlc.narg(owner_id)::int IS NULL
+            OR cards.owner_id IS NULL
+            OR cards.owner_id = sqlc.narg(owner_id)
+            OR EXISTS (
+                SELECT
+                    1
+                FROM
+                    collection_cards cc
+                    INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+                WHERE
+                    cc.card_id = cards.id
+                    AND cs.user_id = sqlc.narg(owner_id)))
+        AND (sqlc.narg(collection_id)::int IS NULL
+            OR EXISTS (
+                SELECT
+                    1
+                FROM
+                    collection_cards cc
+                WHERE
+                    cc.card_id = cards.id
+                    AND cc.collection_id = sqlc.narg(collection_id)))
+        AND (sqlc.narg(since)::timestamptz IS NULL
+            OR lv.created_at >= sqlc.narg(since))
+        AND (sqlc.narg(until)::timestamptz IS NULL
+            OR lv.created_at < sqlc.narg(until))
+        AND (sqlc.arg(include_archived)::bool
+            OR cards.archived_at IS NULL)
+        AND c.model = sqlc.arg(model)
+        AND (sqlc.narg(method)::text IS NULL
+            OR COALESCE((
+                SELECT
+                    method
+                FROM images
+                WHERE
+                    images.card_id = cards.id
+                LIMIT 1), 'text') = sqlc.narg(method))
+    ORDER BY
+        c.card_id,
+        rank DESC,
+        c.ver DESC,
+        c.idx ASC,
+        c.lang ASC
+)
+SELECT
+    card_id,
+    ver,
+    idx,
+    model,
+    text,
+    lang,
+    type,
+    page,
+    title,
+    created_at,
+    rank
+FROM
+    best_chunks
+ORDER BY
+    rank DESC,
+    card_id ASC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetCardMethod :one
+-- cards created from text have no image
+SELECT
+    COALESCE((
+        SELECT
+            method
+        FROM images
+        WHERE
+            images.card_id = cards.id
+        LIMIT 1), 'text')::text AS method
+FROM
+    cards
+WHERE
+    cards.id = $1;
+
+-- name: GetCardImage :one
+-- merged cards have several images, the first one is shown
+SELECT
+    filename,
+    method
+FROM
+    images
+WHERE
+    card_id = $1
+ORDER BY
+    created_at
+LIMIT 1;
+
+-- name: ListCardImages :many
+-- images shared with other cards after a split are left out, so they are kept
+-- when the card is deleted
+SELECT
+    filename
+FROM
+    images
+WHERE
+    card_id = $1
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            images other
+        WHERE
+            other.filename = images.filename
+            AND other.card_id <> images.card_id)
+ORDER BY
+    created_at;
+
+-- name: CopyCardImages :exec
+INSERT INTO images (card_id, filename, method)
+SELECT
+    sqlc.arg(dst_card_id),
+    filename,
+    method
+FROM
+    images
+WHERE
+    card_id = sqlc.arg(src_card_id);
+
+-- name: MoveCardImages :exec
+-- images the destination already has, e.g. when merging split cards, stay with the source
+UPDATE
+    images
+SET
+    card_id = sqlc.arg(dst_card_id)
+WHERE
+    card_id = sqlc.arg(src_card_id)
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            images dst
+        WHERE
+            dst.card_id = sqlc.arg(dst_card_id)
+            AND dst.filename = images.filename);
+
+-- name: ListCardTranslations :many
+SELECT
+    ver,
+    lang
+FROM
+    translations
+WHERE
+    card_id = $1
+ORDER BY
+    ver,
+    lang;
+
+-- name: CreateOCRResult :exec
+INSERT INTO ocr_results (card_id, ver, method, handwriting, quality)
+    VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetLatestOCRResult :one
+SELECT
+    ver,
+    method,
+    handwriting
+FROM
+    ocr_results
+WHERE
+    card_id = $1
+ORDER BY
+    ver DESC
+LIMIT 1;
+
+-- name: FindOCRVersion :one
+-- the OCR result a version was converted from, or edited from a conversion of
+SELECT
+    ver
+FROM
+    ocr_results
+WHERE
+    card_id = $1
+    AND ver <= $2
+ORDER BY
+    ver DESC
+LIMIT 1;
+
+-- name: ListOCRVersions :many
+SELECT
+    ver
+FROM
+    ocr_results
+WHERE
+    card_id = $1
+ORDER BY
+    ver;
+
+
+-- name: ListCards :many
+WITH latest_versions AS (
+    SELECT
+        card_id,
+        MAX(ver) AS max_ver
+    FROM
+        markdown_files
+    GROUP BY
+        card_id
+)
+SELECT
+    cards.id,
+    cards.uid::text AS uid,
+    cards.title,
+    EXISTS (
+        SELECT
+            1
+        FROM
+            images
+        WHERE
+            images.card_id = cards.id
+            AND images.method <> 'audio')::bool AS has_image,
+    lv.max_ver::int AS ver,
+    chunks.text,
+    (cards.archived_at IS NOT NULL)::bool AS archived
+FROM
+    cards
+    INNER JOIN latest_versions lv ON lv.card_id = cards.id
+    LEFT JOIN chunks ON chunks.card_id = cards.id
+        AND chunks.ver = lv.max_ver
+        AND chunks.idx = 0
+        AND chunks.lang = ''
+WHERE
+    cards.deleted_at IS NULL
+    AND (sqlc.narg(owner_id)::int IS NULL
+        OR cards.owner_id IS NULL
+        OR cards.owner_id = sqlc.narg(owner_id)
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+                INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+            WHERE
+                cc.card_id = cards.id
+                AND cs.user_id = sqlc.narg(owner_id)))
+    AND (sqlc.narg(collection_id)::int IS NULL
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+            WHERE
+                cc.card_id = cards.id
+                AND cc.collection_id = sqlc.narg(collection_id)))
+    AND (sqlc.arg(include_archived)::bool
+        OR cards.archived_at IS NULL)
+ORDER BY
+    cards.id DESC;
+
+-- name: CreateTranslation :exec
+INSERT INTO translations (card_id, ver, lang, hash)
+    VALUES ($1, $2, $3, $4)
+ON CONFLICT (card_id, ver, lang)
+    DO UPDATE SET
+        hash = EXCLUDED.hash, created_at = CURRENT_TIMESTAMP;
+
+-- name: GetTranslation :one
+SELECT
+    hash
+FROM
+    translations
+WHERE
+    card_id = $1
+    AND ver = $2
+    AND lang = $3;
+
+-- name: DeleteTranslation :exec
+DELETE FROM translations
+WHERE card_id = $1
+    AND ver = $2
+    AND lang = $3;
+
+-- name: DeleteCardLinks :exec
+DELETE FROM card_links
+WHERE src_card_id = $1;
+
+-- name: CreateCardLink :exec
+INSERT INTO card_links (src_card_id, dst_card_id)
+    VALUES ($1, $2)
+ON CONFLICT
+    DO NOTHING;
+
+-- name: ListOutboundLinks :many
+SELECT
+    cards.id,
+    cards.title
+FROM
+    card_links
+    INNER JOIN cards ON cards.id = card_links.dst_card_id
+WHERE
+    card_links.src_card_id = $1
+ORDER BY
+    cards.id;
+
+-- name: ListInboundLinks :many
+SELECT
+    cards.id,
+    cards.title
+FROM
+    card_links
+    INNER JOIN cards ON cards.id = card_links.src_card_id
+WHERE
+    card_links.dst_card_id = $1
+ORDER BY
+    cards.id;
+
+-- name: SearchRelatedCards :many
+WITH latest_versions AS (
+    SELECT
+        card_id,
+        MAX(ver) AS max_ver
+    FROM
+        markdown_files
+    GROUP BY
+        card_id
+),
+latest_chunks AS (
+    SELECT
+        c.card_id,
+        c.embedding
+    FROM
+        chunks c
+        INNER JOIN latest_versions lv ON c.card_id = lv.card_id
+            AND c.ver = lv.max_ver
+    WHERE
+        c.model = sqlc.arg(model)
+),
+target AS (
+    -- the average of the chunk embeddings represents the whole card
+    SELECT
+        AVG(embedding) AS embedding
+    FROM
+        latest_chunks
+    WHERE
+        card_id = sqlc.arg(card_id)
+),
+distances AS (
+    SELECT
+        lc.card_id,
+        MIN(lc.embedding <=> target.embedding) AS distance
+    FROM
+        latest_chunks lc
+        CROSS JOIN target
+    WHERE
+        lc.card_id <> sqlc.arg(card_id)
+    GROUP BY
+        lc.card_id
+)
+SELECT
+    d.card_id,
+    cards.title,
+    d.distance::real AS distance
+FROM
+    distances d
+    INNER JOIN cards ON cards.id = d.card_id
+WHERE
+    cards.deleted_at IS NULL
+    AND (sqlc.narg(owner_id)::int IS NULL
+        OR cards.owner_id IS NULL
+        OR cards.owner_id = sqlc.narg(owner_id)
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+                INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+            WHERE
+                cc.card_id = cards.id
+                AND cs.user_id = sqlc.narg(owner_id)))
+    AND (sqlc.narg(collection_id)::int IS NULL
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+            WHERE
+                cc.card_id = cards.id
+                AND cc.collection_id = sqlc.narg(collection_id)))
+ORDER BY
+    d.distance ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListDuplicateCards :many
+-- the first chunk of a version holds its whole content, so it stands for the card. Only
+-- the cards the user can change are compared, as duplicates are merged or trashed
+WITH latest_versions AS (
+    SELECT
+        card_id,
+        MAX(ver) AS max_ver
+    FROM
+        markdown_files
+    GROUP BY
+        card_id
+),
+card_embeddings AS (
+    SELECT
+        c.card_id,
+        c.embedding
+    FROM
+        chunks c
+        INNER JOIN latest_versions lv ON c.card_id = lv.card_id
+            AND c.ver = lv.max_ver
+        INNER JOIN cards ON cards.id = c.card_id
+    WHERE
+        c.idx = 0
+        AND c.lang = ''
+        AND c.model = sqlc.arg(model)
+        AND cards.deleted_at IS NULL
+        AND (sqlc.narg(owner_id)::int IS NULL
+            OR cards.owner_id = sqlc.narg(owner_id)
+            OR EXISTS (
+                SELECT
+                    1
+                FROM
+                    collection_cards cc
+                    INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+                WHERE
+                    cc.card_id = cards.id
+                    AND cs.user_id = sqlc.narg(owner_id)
+                    AND cs.can_write))
+)
+SELECT
+    a.card_id AS card_id_a,
+    b.card_id AS card_id_b,
+    (a.embedding <=> b.embedding)::real AS distance
+FROM
+    card_embeddings a
+    INNER JOIN card_embeddings b ON a.card_id < b.card_id
+WHERE
+    a.embedding <=> b.embedding <= sqlc.arg(max_distance)::real
+ORDER BY
+    distance ASC;
+
+-- name: ListLatestChunks :many
 WITH latest_versions AS (
     SELECT
         card_id,
@@ -57,25 +936,899 @@ WITH latest_versions AS (
 )
 SELECT
     c.card_id,
-    c.ver,
     c.idx,
-    c.model,
     c.text,
-    c.embedding <-> $1 AS distance
+    c.embedding,
+    cards.title
 FROM
     chunks c
     INNER JOIN latest_versions lv ON c.card_id = lv.card_id
         AND c.ver = lv.max_ver
+    INNER JOIN cards ON cards.id = c.card_id
+WHERE
+    c.lang = ''
+    AND c.model = sqlc.arg(model)
+    AND cards.deleted_at IS NULL
+    AND (sqlc.narg(owner_id)::int IS NULL
+        OR cards.owner_id IS NULL
+        OR cards.owner_id = sqlc.narg(owner_id)
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+                INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+            WHERE
+                cc.card_id = cards.id
+                AND cs.user_id = sqlc.narg(owner_id)))
+ORDER BY
+    c.card_id,
+    c.idx;
+
+-- name: ListDueReviews :many
+-- cards that were never reviewed are due right away. Grading changes the schedule of a
+-- card, so only the cards the user can change are reviewed
+SELECT
+    cards.id,
+    cards.title,
+    COALESCE(r.repetitions, 0)::int AS repetitions,
+    COALESCE(r.interval_days, 0)::int AS interval_days,
+    COALESCE(r.ease, 2.5)::real AS ease
+FROM
+    cards
+    LEFT JOIN reviews r ON r.card_id = cards.id
+WHERE
+    cards.deleted_at IS NULL
+    AND (r.card_id IS NULL
+        OR r.due_at <= CURRENT_TIMESTAMP)
+    AND (sqlc.narg(owner_id)::int IS NULL
+        OR cards.owner_id = sqlc.narg(owner_id)
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+                INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+            WHERE
+                cc.card_id = cards.id
+                AND cs.user_id = sqlc.narg(owner_id)
+                AND cs.can_write))
+ORDER BY
+    r.due_at ASC NULLS LAST,
+    cards.id
+LIMIT sqlc.arg('limit');
+
+-- name: UpsertReview :exec
+INSERT INTO reviews (card_id, repetitions, interval_days, ease, due_at, reviewed_at)
+    VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + $3 * INTERVAL '1 day', CURRENT_TIMESTAMP)
+ON CONFLICT (card_id)
+    DO UPDATE SET
+        repetitions = EXCLUDED.repetitions,
+        interval_days = EXCLUDED.interval_days,
+        ease = EXCLUDED.ease,
+        due_at = EXCLUDED.due_at,
+        reviewed_at = EXCLUDED.reviewed_at;
+
+-- name: ListCardsToDelete :many
+-- cards outside the trash selected by the filters of ume delete, unset filters match all.
+-- a card is created with its first markdown version, cards from text have no image. Only
+-- the cards the user can change are selected
+SELECT
+    cards.id,
+    cards.title,
+    MIN(markdown_files.created_at)::timestamptz AS created_at
+FROM
+    cards
+    INNER JOIN markdown_files ON markdown_files.card_id = cards.id
+WHERE
+    cards.deleted_at IS NULL
+    AND (sqlc.narg(collection_id)::int IS NULL
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+            WHERE
+                cc.card_id = cards.id
+                AND cc.collection_id = sqlc.narg(collection_id)))
+    AND (sqlc.narg(owner_id)::int IS NULL
+        OR cards.owner_id = sqlc.narg(owner_id)
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+                INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+            WHERE
+                cc.card_id = cards.id
+                AND cs.user_id = sqlc.narg(owner_id)
+                AND cs.can_write))
+GROUP BY
+    cards.id
+HAVING
+    sqlc.narg(before)::timestamptz IS NULL
+    OR MIN(markdown_files.created_at) < sqlc.narg(before)::timestamptz
+ORDER BY
+    cards.id;
+
+-- name: CountCardRows :one
+-- rows that are cascade deleted with a card
+SELECT
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            markdown_files
+        WHERE
+            markdown_files.card_id = sqlc.arg(card_id))::int AS versions,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            chunks
+        WHERE
+            chunks.card_id = sqlc.arg(card_id))::int AS chunks,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            card_links
+        WHERE
+            card_links.src_card_id = sqlc.arg(card_id)
+            OR card_links.dst_card_id = sqlc.arg(card_id))::int AS links;
+
+-- name: ListAllMarkdownFiles :many
+-- markdown versions of the cards outside the trash with the number of their embeddings
+SELECT
+    markdown_files.card_id,
+    markdown_files.ver,
+    markdown_files.hash,
+    markdown_files.content,
+    markdown_files.by_hash,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            chunks
+        WHERE
+            chunks.card_id = markdown_files.card_id
+            AND chunks.ver = markdown_files.ver
+            AND chunks.lang = '')::int AS embeddings
+FROM
+    markdown_files
+    INNER JOIN cards ON cards.id = markdown_files.card_id
+WHERE
+    cards.deleted_at IS NULL
+ORDER BY
+    markdown_files.card_id,
+    markdown_files.ver;
+
+-- name: ListAllImages :many
+SELECT
+    images.card_id,
+    images.filename
+FROM
+    images
+    INNER JOIN cards ON cards.id = images.card_id
+WHERE
+    cards.deleted_at IS NULL
+ORDER BY
+    images.card_id,
+    images.filename;
+
+-- name: CreateUser :one
+INSERT INTO users (name, api_key_hash)
+    VALUES ($1, $2)
+RETURNING
+    id;
+
+-- name: GetUserByAPIKeyHash :one
+SELECT
+    id,
+    name
+FROM
+    users
+WHERE
+    api_key_hash = $1;
+
+-- name: CreateSession :exec
+INSERT INTO sessions (token_hash, user_id, expires_at)
+    VALUES ($1, $2, $3);
+
+-- name: GetUserBySessionHash :one
+SELECT
+    users.id,
+    users.name
+FROM
+    sessions
+    INNER JOIN users ON users.id = sessions.user_id
+WHERE
+    sessions.token_hash = $1
+    AND sessions.expires_at > now();
+
+-- name: DeleteExpiredSessions :exec
+DELETE FROM sessions
+WHERE expires_at <= now();
+
+-- name: ListUsers :many
+SELECT
+    users.id,
+    users.name,
+    users.created_at,
+    COUNT(cards.id)::int AS cards
+FROM
+    users
+    LEFT JOIN cards ON cards.owner_id = users.id
+GROUP BY
+    users.id
+ORDER BY
+    users.id;
+
+-- name: CanAccessCard :one
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            cards
+        WHERE
+            cards.id = sqlc.arg(card_id)
+            AND (cards.owner_id IS NULL
+                OR cards.owner_id = sqlc.arg(user_id)
+                OR EXISTS (
+                    SELECT
+                        1
+                    FROM
+                        collection_cards cc
+                        INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+                    WHERE
+                        cc.card_id = cards.id
+                        AND cs.user_id = sqlc.arg(user_id))));
+
+-- name: CanWriteCard :one
+-- cards can only be changed by their owner and the users of a collection shared with
+-- them to write, cards without an owner only by the CLI without an API key
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            cards
+        WHERE
+            cards.id = sqlc.arg(card_id)
+            AND (cards.owner_id = sqlc.arg(user_id)
+                OR EXISTS (
+                    SELECT
+                        1
+                    FROM
+                        collection_cards cc
+                        INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+                    WHERE
+                        cc.card_id = cards.id
+                        AND cs.user_id = sqlc.arg(user_id)
+                        AND cs.can_write)));
+
+-- name: GetUserByName :one
+SELECT
+    id,
+    name
+FROM
+    users
+WHERE
+    name = $1;
+
+-- name: CreateCollection :one
+INSERT INTO collections (name, owner_id)
+    VALUES ($1, $2)
+RETURNING
+    id;
+
+-- name: FindCollection :one
+-- collections owned by the user come before the ones shared with them
+SELECT
+    c.id,
+    c.name,
+    c.owner_id,
+    (sqlc.narg(user_id)::int IS NULL
+        OR c.owner_id IS NULL
+        OR c.owner_id = sqlc.narg(user_id)
+        OR COALESCE(cs.can_write, FALSE))::bool AS can_write
+FROM
+    collections c
+    LEFT JOIN collection_shares cs ON cs.collection_id = c.id
+        AND cs.user_id = sqlc.narg(user_id)
+WHERE
+    c.name = sqlc.arg(name)
+    AND (sqlc.narg(user_id)::int IS NULL
+        OR c.owner_id IS NULL
+        OR c.owner_id = sqlc.narg(user_id)
+        OR cs.user_id IS NOT NULL)
+ORDER BY
+    c.owner_id = sqlc.narg(user_id) DESC NULLS LAST
+LIMIT 1;
+
+-- name: ListCollections :many
+SELECT
+    c.id,
+    c.name,
+    COALESCE(u.name, '')::text AS owner_name,
+    COUNT(cc.card_id)::int AS cards
+FROM
+    collections c
+    LEFT JOIN users u ON u.id = c.owner_id
+    LEFT JOIN collection_cards cc ON cc.collection_id = c.id
+WHERE
+    sqlc.narg(user_id)::int IS NULL
+    OR c.owner_id IS NULL
+    OR c.owner_id = sqlc.narg(user_id)
+    OR EXISTS (
+        SELECT
+            1
+        FROM
+            collection_shares cs
+        WHERE
+            cs.collection_id = c.id
+            AND cs.user_id = sqlc.narg(user_id))
+GROUP BY
+    c.id,
+    u.name
+ORDER BY
+    c.name;
+
+-- name: AddCardToCollection :exec
+INSERT INTO collection_cards (collection_id, card_id)
+    VALUES ($1, $2)
+ON CONFLICT
+    DO NOTHING;
+
+-- name: ShareCollection :exec
+INSERT INTO collection_shares (collection_id, user_id, can_write)
+    VALUES ($1, $2, $3)
+ON CONFLICT (collection_id, user_id)
+    DO UPDATE SET
+        can_write = EXCLUDED.can_write;
+
+-- name: ListSyncVersions :many
+SELECT
+    cards.id AS card_id,
+    cards.uid::text AS uid,
+    cards.title,
+    (cards.deleted_at IS NOT NULL)::bool AS deleted,
+    mf.ver,
+    mf.hash,
+    mf.parent_ver
+FROM
+    cards
+    INNER JOIN markdown_files mf ON mf.card_id = cards.id
+WHERE
+    sqlc.narg(owner_id)::int IS NULL
+    OR cards.owner_id IS NULL
+    OR cards.owner_id = sqlc.narg(owner_id)
+    OR EXISTS (
+        SELECT
+            1
+        FROM
+            collection_cards cc
+            INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+        WHERE
+            cc.card_id = cards.id
+            AND cs.user_id = sqlc.narg(owner_id))
+ORDER BY
+    cards.id,
+    mf.ver;
+
+-- name: GetCardUID :one
+SELECT
+    uid::text
+FROM
+    cards
+WHERE
+    id = $1;
+
+-- name: GetCardByUID :one
+SELECT
+    id
+FROM
+    cards
+WHERE
+    uid = CAST(sqlc.arg(uid)::text AS uuid);
+
+-- name: CreateCardWithUID :one
+INSERT INTO cards (uid, title, owner_id)
+    VALUES (CAST(sqlc.arg(uid)::text AS uuid), sqlc.arg(title), sqlc.narg(owner_id))
+RETURNING
+    id;
+
+-- name: ListVersionChunks :many
+SELECT
+    idx,
+    model,
+    text,
+    embedding,
+    chunker,
+    start_offset,
+    end_offset,
+    type,
+    page
+FROM
+    chunks
+WHERE
+    card_id = $1
+    AND ver = $2
+    AND lang = ''
+ORDER BY
+    idx;
+
+-- name: CreateJob :one
+INSERT INTO jobs (card_id, kind, params)
+    VALUES ($1, $2, $3)
+RETURNING
+    id;
+
+-- name: FailStaleJobs :execrows
+-- jobs left behind by a worker that stopped during their last attempt can't be claimed
+-- again, so they fail and can be queued again with ume jobs retry
+UPDATE
+    jobs
+SET
+    status = 'failed',
+    error = 'the worker stopped during the last attempt',
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    status = 'running'
+    AND attempts >= max_attempts
+    AND updated_at < CURRENT_TIMESTAMP - sqlc.arg(stale_seconds)::int * interval '1 second';
+
+-- name: ClaimJob :one
+-- jobs running for longer than stale_seconds were left behind by a worker that stopped,
+-- and are claimed again while they have attempts left
+UPDATE
+    jobs
+SET
+    status = 'running',
+    attempts = attempts + 1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = (
+        SELECT
+            id
+        FROM
+            jobs
+        WHERE (status = 'queued'
+            AND run_after <= CURRENT_TIMESTAMP)
+        OR (status = 'running'
+            AND attempts < max_attempts
+            AND updated_at < CURRENT_TIMESTAMP - sqlc.arg(stale_seconds)::int * interval '1 second')
     ORDER BY
-        distance ASC
-    LIMIT $2;
+        id
+    LIMIT 1
+    FOR UPDATE
+        SKIP LOCKED)
+RETURNING
+    id,
+    card_id,
+    kind,
+    params,
+    attempts,
+    max_attempts;
 
--- name: GetCardImage :one
+-- name: CompleteJob :exec
+UPDATE
+    jobs
+SET
+    status = 'done',
+    error = '',
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1;
+
+-- name: FailJob :one
+-- the job is queued again after retry_seconds, unless it ran out of attempts
+UPDATE
+    jobs
+SET
+    status = CASE WHEN attempts < max_attempts THEN
+        'queued'
+    ELSE
+        'failed'
+    END,
+    error = sqlc.arg(error),
+    run_after = CURRENT_TIMESTAMP + sqlc.arg(retry_seconds)::int * interval '1 second',
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = sqlc.arg(id)
+RETURNING
+    status;
+
+-- name: ListJobs :many
+SELECT
+    jobs.id,
+    jobs.card_id,
+    jobs.kind,
+    jobs.status,
+    jobs.attempts,
+    jobs.max_attempts,
+    jobs.error,
+    jobs.updated_at
+FROM
+    jobs
+WHERE
+    sqlc.narg(status)::text IS NULL
+    OR jobs.status = sqlc.narg(status)
+ORDER BY
+    jobs.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: RetryJobs :execrows
+-- failed jobs are queued again with all their attempts
+UPDATE
+    jobs
+SET
+    status = 'queued',
+    attempts = 0,
+    error = '',
+    run_after = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    status = 'failed'
+    AND (sqlc.narg(id)::int IS NULL
+        OR id = sqlc.narg(id));
+
+-- name: StartCardUpload :exec
+UPDATE
+    cards
+SET
+    upload_stage = 'created',
+    upload_options = $2
+WHERE
+    id = $1;
+
+-- name: SetCardUploadExtracted :exec
+-- the hash of the extracted markdown is kept with the options, to resume with it
+UPDATE
+    cards
+SET
+    upload_stage = 'extracted',
+    upload_options = upload_options || jsonb_build_object('extracted', sqlc.arg(hash)::text)
+WHERE
+    id = sqlc.arg(id);
+
+-- name: SetCardUploadStage :exec
+UPDATE
+    cards
+SET
+    upload_stage = $2
+WHERE
+    id = $1;
+
+-- name: GetCardUpload :one
+SELECT
+    upload_stage,
+    upload_options
+FROM
+    cards
+WHERE
+    id = $1;
+
+-- name: ListUnfinishedUploads :many
+-- cards with a queued or running job are left to ume worker
+SELECT
+    id,
+    upload_stage
+FROM
+    cards
+WHERE
+    upload_stage <> 'stored'
+    AND deleted_at IS NULL
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            jobs
+        WHERE
+            jobs.card_id = cards.id
+            AND jobs.status IN ('queued', 'running'))
+ORDER BY
+    id;
+
+-- name: CreateDocument :one
+INSERT INTO documents (title, owner_id, content, smoothed)
+    VALUES ($1, $2, $3, $4)
+RETURNING
+    id;
+
+-- name: AddDocumentCard :exec
+INSERT INTO document_cards (document_id, position, card_id, ver)
+    VALUES ($1, $2, $3, $4);
+
+-- name: ListDocuments :many
+SELECT
+    d.id,
+    d.title,
+    d.smoothed,
+    d.created_at,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            document_cards dc
+        WHERE
+            dc.document_id = d.id)::int AS cards
+FROM
+    documents d
+WHERE
+    sqlc.narg(owner_id)::int IS NULL
+    OR d.owner_id IS NULL
+    OR d.owner_id = sqlc.narg(owner_id)
+ORDER BY
+    d.id;
+
+-- name: GetDocument :one
+SELECT
+    id,
+    title,
+    owner_id,
+    content
+FROM
+    documents
+WHERE
+    id = $1;
+
+-- name: ListDocumentCards :many
+SELECT
+    dc.card_id,
+    dc.ver,
+    cards.title
+FROM
+    document_cards dc
+    INNER JOIN cards ON cards.id = dc.card_id
+WHERE
+    dc.document_id = $1
+ORDER BY
+    dc.position;
+
+-- name: ListLayouts :many
+SELECT
+    card_id,
+    x,
+    y,
+    group_name
+FROM
+    layouts
+WHERE
+    owner_id IS NOT DISTINCT FROM sqlc.narg(owner_id)::int;
+
+-- name: SaveLayout :exec
+INSERT INTO layouts (owner_id, card_id, x, y, group_name)
+    VALUES (sqlc.narg(owner_id), sqlc.arg(card_id), sqlc.arg(x), sqlc.arg(y), sqlc.arg(group_name))
+ON CONFLICT ((COALESCE(owner_id, 0)), card_id)
+    DO UPDATE SET
+        x = EXCLUDED.x, y = EXCLUDED.y, group_name = EXCLUDED.group_name, updated_at = CURRENT_TIMESTAMP;
+
+-- name: ListCardLinks :many
+-- only the links between cards the user can access
+SELECT
+    l.src_card_id,
+    l.dst_card_id
+FROM
+    card_links l
+    INNER JOIN cards src ON src.id = l.src_card_id
+    INNER JOIN cards dst ON dst.id = l.dst_card_id
+WHERE
+    (sqlc.narg(owner_id)::int IS NULL
+        OR src.owner_id IS NULL
+        OR src.owner_id = sqlc.narg(owner_id)
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+                INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+            WHERE
+                cc.card_id = src.id
+                AND cs.user_id = sqlc.narg(owner_id)))
+    AND (sqlc.narg(owner_id)::int IS NULL
+        OR dst.owner_id IS NULL
+        OR dst.owner_id = sqlc.narg(owner_id)
+        OR EXISTS (
+            SELECT
+                1
+            FROM
+                collection_cards cc
+                INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+            WHERE
+                cc.card_id = dst.id
+                AND cs.user_id = sqlc.narg(owner_id)))
+ORDER BY
+    src_card_id,
+    dst_card_id;
+
+-- name: ListSimilarCards :many
+-- the first chunk of a version holds its whole content, so it stands for the card
+WITH latest_versions AS (
+    SELECT
+        card_id,
+        MAX(ver) AS max_ver
+    FROM
+        markdown_files
+    GROUP BY
+        card_id
+),
+card_embeddings AS (
+    SELECT
+        c.card_id,
+        c.embedding
+    FROM
+        chunks c
+        INNER JOIN latest_versions lv ON c.card_id = lv.card_id
+            AND c.ver = lv.max_ver
+        INNER JOIN cards ON cards.id = c.card_id
+    WHERE
+        c.idx = 0
+        AND c.lang = ''
+        AND c.model = sqlc.arg(model)
+        AND cards.deleted_at IS NULL
+)
+SELECT
+    a.card_id AS card_id_a,
+    b.card_id AS card_id_b,
+    (1 - (a.embedding <=> b.embedding))::real AS similarity
+FROM
+    card_embeddings a
+    INNER JOIN card_embeddings b ON a.card_id < b.card_id
+WHERE
+    1 - (a.embedding <=> b.embedding) >= sqlc.arg(min_similarity)::real
+ORDER BY
+    similarity DESC;
+
+-- name: GetCardByAlias :one
+SELECT
+    card_id
+FROM
+    aliases
+WHERE
+    alias = $1;
+
+-- name: SetCardAlias :exec
+INSERT INTO aliases (alias, card_id)
+    VALUES ($1, $2)
+ON CONFLICT (alias)
+    DO UPDATE SET
+        card_id = EXCLUDED.card_id, created_at = CURRENT_TIMESTAMP;
+
+-- name: DeleteCardAlias :execrows
+DELETE FROM aliases
+WHERE alias = $1;
+
+-- name: ListCardAliases :many
+SELECT
+    a.alias,
+    a.card_id,
+    cards.title
+FROM
+    aliases a
+    INNER JOIN cards ON cards.id = a.card_id
+WHERE
+    sqlc.narg(owner_id)::int IS NULL
+    OR cards.owner_id IS NULL
+    OR cards.owner_id = sqlc.narg(owner_id)
+    OR EXISTS (
+        SELECT
+            1
+        FROM
+            collection_cards cc
+            INNER JOIN collection_shares cs ON cs.collection_id = cc.collection_id
+        WHERE
+            cc.card_id = cards.id
+            AND cs.user_id = sqlc.narg(owner_id))
+ORDER BY
+    a.alias;
+
+-- name: PinCard :exec
+INSERT INTO pins (owner_id, card_id)
+    VALUES (sqlc.narg(owner_id), sqlc.arg(card_id))
+ON CONFLICT ((COALESCE(owner_id, 0)), card_id)
+    DO NOTHING;
+
+-- name: UnpinCard :execrows
+DELETE FROM pins
+WHERE owner_id IS NOT DISTINCT FROM sqlc.narg(owner_id)::int
+    AND card_id = sqlc.arg(card_id);
+
+-- name: ListPinnedCards :many
 SELECT
+    pins.card_id,
+    cards.title,
+    pins.created_at
+FROM
+    pins
+    INNER JOIN cards ON cards.id = pins.card_id
+WHERE
+    pins.owner_id IS NOT DISTINCT FROM sqlc.narg(owner_id)::int
+    AND cards.deleted_at IS NULL
+ORDER BY
+    pins.created_at DESC;
+
+-- name: SetCardArchived :execrows
+-- cards archived before keep the time they were archived
+UPDATE
+    cards
+SET
+    archived_at = CASE WHEN sqlc.arg(archived)::bool THEN
+        COALESCE(archived_at, CURRENT_TIMESTAMP)
+    ELSE
+        NULL
+    END
+WHERE
+    id = sqlc.arg(id)
+    AND deleted_at IS NULL;
+
+-- name: CreateAttachment :one
+-- attaching a file with the same name again replaces it
+INSERT INTO attachments (card_id, filename, object_name, content_type, size)
+    VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (card_id, filename)
+    DO UPDATE SET
+        object_name = EXCLUDED.object_name, content_type = EXCLUDED.content_type, size = EXCLUDED.size, created_at = CURRENT_TIMESTAMP
+    RETURNING
+        id;
+
+-- name: ListAttachments :many
+SELECT
+    id,
     filename,
-    method
+    object_name,
+    content_type,
+    size,
+    created_at
 FROM
-    images
+    attachments
+WHERE
+    card_id = $1
+ORDER BY
+    filename;
+
+-- name: GetAttachment :one
+SELECT
+    id,
+    filename,
+    object_name,
+    content_type,
+    size,
+    created_at
+FROM
+    attachments
+WHERE
+    card_id = $1
+    AND filename = $2;
+
+-- name: DeleteAttachment :execrows
+DELETE FROM attachments
+WHERE card_id = $1
+    AND filename = $2;
+
+-- name: ListCardAttachmentObjects :many
+SELECT
+    object_name
+FROM
+    attachments
+WHERE
+    card_id = $1;
+
+-- name: GetCardSource :one
+SELECT
+    book,
+    page,
+    url,
+    read_on
+FROM
+    sources
 WHERE
     card_id = $1;
 
+-- name: SetCardSource :exec
+INSERT INTO sources (card_id, book, page, url, read_on)
+    VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (card_id)
+    DO UPDATE SET
+        book = EXCLUDED.book, page = EXCLUDED.page, url = EXCLUDED.url, read_on = EXCLUDED.read_on, updated_at = CURRENT_TIMESTAMP;
@@ -1,14 +1,55 @@
 CREATE EXTENSION vector;
 
+-- users of a shared deployment, authenticated by API key
+CREATE TABLE users (
+    id serial PRIMARY KEY,
+    name text UNIQUE NOT NULL,
+    -- sha256 of the API key, the key itself is only shown once
+    api_key_hash text UNIQUE NOT NULL,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+);
+
+-- browsers logged in to ume serve, which keep a session token in a cookie instead of the API key
+CREATE TABLE sessions (
+    -- sha256 of the session token, like api_key_hash
+    token_hash text PRIMARY KEY,
+    user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+    expires_at timestamp with time zone NOT NULL
+);
+
 CREATE TABLE cards (
-    id serial PRIMARY KEY
+    id serial PRIMARY KEY,
+    title text NOT NULL DEFAULT '',
+    -- NULL for cards shared with every user
+    owner_id int REFERENCES users (id) ON DELETE SET NULL,
+    -- set when the card is moved to the trash
+    deleted_at timestamp with time zone,
+    -- set when the OCR of the card was unsure, cleared when the card is edited
+    needs_review boolean NOT NULL DEFAULT FALSE,
+    -- page the card was imported from, like notion:<page id>, NULL for cards created in ume
+    external_id text UNIQUE,
+    -- identifies the card across instances, whose integer IDs differ
+    uid uuid NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+    -- the last stage of ume upload that finished: created, uploaded, extracted or stored.
+    -- ume resume continues the uploads that were interrupted before they were stored
+    upload_stage text NOT NULL DEFAULT 'stored',
+    -- the options the card was uploaded with, to resume the upload with them
+    upload_options jsonb,
+    -- set when the card is archived, archived cards are left out of searches and lists
+    -- unless they are asked for
+    archived_at timestamp with time zone
 );
 
 CREATE TABLE images (
     card_id serial REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
     filename text NOT NULL,
     created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
-    method text NOT NULL,
+    -- the methods of common.Method
+    method text NOT NULL CHECK (method IN ('ocr', 'mistral', 'vision', 'text', 'audio')),
+    -- the common.ImageKind the image was classified as to pick its method with --method=auto,
+    -- NULL when the method was given
+    kind text,
     PRIMARY KEY (card_id, filename)
 );
 
@@ -16,23 +57,275 @@ CREATE TABLE markdown_files (
     card_id serial REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
     ver int NOT NULL,
     hash text NOT NULL,
+    -- version this one was edited from, NULL for the first version
+    parent_ver int,
+    -- detected language of the content as an ISO 639-1 code, empty if unknown
+    lang text NOT NULL DEFAULT '',
+    -- copy of the markdown in minio, which stays the canonical copy.
+    -- NULL for versions stored before it was added, until ume verify fills it
+    content text,
+    -- whether the markdown is stored in minio by its hash as sha256/<hash>.md, shared by
+    -- the versions with the same content. Versions stored before are <card_id>_<ver>.md
+    -- until ume verify moves them
+    by_hash boolean NOT NULL DEFAULT FALSE,
     created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
     PRIMARY KEY (card_id, ver)
 );
 
+-- embedding models chunks are embedded with. Vectors are only compared with vectors of
+-- the same model, as their dimensions and spaces differ.
+CREATE TABLE models (
+    name text PRIMARY KEY,
+    dimension int NOT NULL,
+    provider text NOT NULL,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO models (name, dimension, provider)
+    VALUES ('text-embedding-3-small', 1536, 'openai'),
+    ('text-embedding-3-large', 3072, 'openai');
+
 -- each markdown_file has multiple embeddings
 CREATE TABLE chunks (
     card_id serial REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
     ver int NOT NULL,
     text text NOT NULL,
     idx int NOT NULL, -- 0 is whole text
-    -- this might change in the future
-    model text NOT NULL,
-    -- open ai call can restrict the number of dimensions
-    embedding vector (1536),
-    PRIMARY KEY (card_id, ver, model, idx),
+    model text NOT NULL REFERENCES models (name),
+    -- the dimension depends on the model. ume migrate-embeddings --precision=half
+    -- converts the column to halfvec
+    embedding vector,
+    -- language of a stored translation, empty for the original text
+    lang text NOT NULL DEFAULT '',
+    -- chunking strategy the text was split with, empty for chunks stored before it was recorded
+    chunker text NOT NULL DEFAULT '',
+    -- byte range of the markdown the text was taken from, 0 to 0 when it is not known
+    start_offset int NOT NULL DEFAULT 0,
+    end_offset int NOT NULL DEFAULT 0,
+    -- what the text is: document, heading, sentence, table-row, caption or passage.
+    -- empty for chunks stored before it was recorded
+    type text NOT NULL DEFAULT '',
+    -- page of a multi-page card the text is on, counted from 1. 0 when the card has no pages
+    page int NOT NULL DEFAULT 0,
+    PRIMARY KEY (card_id, ver, model, lang, idx),
     FOREIGN KEY (card_id, ver) REFERENCES markdown_files (card_id, ver) ON DELETE CASCADE
 );
 
-CREATE INDEX ON chunks USING ivfflat (embedding vector_cosine_ops);
+-- an index needs a fixed dimension, so there is one per model. ivfflat indexes up to
+-- 2000 dimensions, which leaves out text-embedding-3-large unless stored as halfvec.
+CREATE INDEX ON chunks USING ivfflat ((embedding::vector(1536)) vector_cosine_ops)
+WHERE
+    model = 'text-embedding-3-small';
+
+-- the statement that finds the chunks of a model closest to the query embedding $1, at
+-- most $2 of them. The embeddings are cast and compared like in the index of the model,
+-- for the dimension of the model and the type the column is stored as, so the index is used.
+CREATE FUNCTION nearest_chunks_query (model_name text)
+    RETURNS text
+    LANGUAGE sql
+    STABLE
+    AS $$
+    SELECT
+        format('SELECT card_id, ver, idx, lang, (embedding::%1$s(%2$s)) <=> $1::%1$s(%2$s) AS distance
+            FROM chunks WHERE model = %3$L ORDER BY (embedding::%1$s(%2$s)) <=> $1::%1$s(%2$s) LIMIT $2',
+            format_type(pg_attribute.atttypid, NULL), models.dimension, models.name)
+    FROM
+        models,
+        pg_attribute
+    WHERE
+        models.name = model_name
+        AND pg_attribute.attrelid = 'chunks'::regclass
+        AND pg_attribute.attname = 'embedding';
+$$;
+
+-- the chunks of a model closest to a query embedding by cosine distance, found with the
+-- statement of nearest_chunks_query
+CREATE FUNCTION nearest_chunks (query vector, model_name text, candidates int)
+    RETURNS TABLE (
+        card_id int,
+        ver int,
+        idx int,
+        lang text,
+        distance double precision)
+    LANGUAGE plpgsql
+    STABLE
+    AS $$
+DECLARE
+    stmt text := nearest_chunks_query (model_name);
+BEGIN
+    IF stmt IS NULL THEN
+        RETURN;
+    END IF;
+    RETURN QUERY EXECUTE stmt
+    USING query, candidates;
+END
+$$;
+
+
+-- translated markdown, stored in minio next to the original version
+CREATE TABLE translations (
+    card_id serial REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    ver int NOT NULL,
+    lang text NOT NULL,
+    hash text NOT NULL,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (card_id, ver, lang),
+    FOREIGN KEY (card_id, ver) REFERENCES markdown_files (card_id, ver) ON DELETE CASCADE
+);
+
+-- raw OCR result a markdown version was converted from, stored in minio
+-- so the markdown can be converted again without running OCR
+CREATE TABLE ocr_results (
+    card_id serial REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    ver int NOT NULL,
+    -- only methods that run OCR have a result
+    method text NOT NULL CHECK (method IN ('ocr', 'mistral')),
+    -- converted with the handwriting settings
+    handwriting boolean NOT NULL DEFAULT FALSE,
+    -- confidence of the OCR from 0 to 1, NULL when the method has none
+    quality real,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (card_id, ver),
+    FOREIGN KEY (card_id, ver) REFERENCES markdown_files (card_id, ver) ON DELETE CASCADE
+);
+
+-- links written as [[card:123]] in the latest markdown of the source card
+CREATE TABLE card_links (
+    src_card_id int REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    dst_card_id int REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    PRIMARY KEY (src_card_id, dst_card_id)
+);
+
+-- spaced repetition schedule of a card, following SM-2
+CREATE TABLE reviews (
+    card_id int PRIMARY KEY REFERENCES cards (id) ON DELETE CASCADE,
+    repetitions int NOT NULL DEFAULT 0,
+    interval_days int NOT NULL DEFAULT 0,
+    ease real NOT NULL DEFAULT 2.5,
+    due_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at timestamp with time zone
+);
+
+-- named groups of cards that can be shared with other users
+CREATE TABLE collections (
+    id serial PRIMARY KEY,
+    name text NOT NULL,
+    -- NULL for collections without an owner, accessible to every user
+    owner_id int REFERENCES users (id) ON DELETE CASCADE,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (owner_id, name)
+);
+
+CREATE TABLE collection_cards (
+    collection_id int REFERENCES collections (id) ON DELETE CASCADE NOT NULL,
+    card_id int REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    PRIMARY KEY (collection_id, card_id)
+);
+
+-- users a collection is shared with, read-only unless can_write is set
+CREATE TABLE collection_shares (
+    collection_id int REFERENCES collections (id) ON DELETE CASCADE NOT NULL,
+    user_id int REFERENCES users (id) ON DELETE CASCADE NOT NULL,
+    can_write boolean NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (collection_id, user_id)
+);
+
+-- processing queued by ume upload --async and run by ume worker. params holds the options
+-- of the job as JSON. Failed jobs are queued again after run_after until they run out of
+-- attempts, then they stay failed until ume jobs retry.
+CREATE TABLE jobs (
+    id serial PRIMARY KEY,
+    card_id int REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    kind text NOT NULL,
+    params jsonb NOT NULL DEFAULT '{}',
+    -- queued, running, done or failed
+    status text NOT NULL DEFAULT 'queued',
+    attempts int NOT NULL DEFAULT 0,
+    max_attempts int NOT NULL DEFAULT 3,
+    error text NOT NULL DEFAULT '',
+    run_after timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX ON jobs (status, run_after);
+
+-- drafts composed by ume compose from the latest markdown of cards, in the order the
+-- user chose
+CREATE TABLE documents (
+    id serial PRIMARY KEY,
+    title text NOT NULL,
+    -- NULL for documents composed without a user, accessible to every user
+    owner_id int REFERENCES users (id) ON DELETE CASCADE,
+    content text NOT NULL,
+    -- the transitions between the cards were smoothed by the chat model
+    smoothed boolean NOT NULL DEFAULT FALSE,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the cards a document was composed from, with the version that was used
+CREATE TABLE document_cards (
+    document_id int REFERENCES documents (id) ON DELETE CASCADE NOT NULL,
+    position int NOT NULL,
+    card_id int REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    ver int NOT NULL,
+    PRIMARY KEY (document_id, position)
+);
 
+-- positions of cards on the board of ume serve and show --all, arranged like cards spread
+-- on a desk. Each user has their own board.
+CREATE TABLE layouts (
+    -- NULL for the board of ume show --all without a user
+    owner_id int REFERENCES users (id) ON DELETE CASCADE,
+    card_id int REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    x real NOT NULL,
+    y real NOT NULL,
+    -- cards with the same group name are drawn together, empty for no group
+    group_name text NOT NULL DEFAULT '',
+    updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX ON layouts ((COALESCE(owner_id, 0)), card_id);
+
+-- memorable names for cards, accepted wherever a card ID is
+CREATE TABLE aliases (
+    -- lowercase, starting with a letter so it can't be taken for an ID
+    alias text PRIMARY KEY,
+    card_id int REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX ON aliases (card_id);
+
+-- cards pinned by a user for a project in progress, listed first by ume lookup and the gallery
+CREATE TABLE pins (
+    -- NULL for the pins made without a user
+    owner_id int REFERENCES users (id) ON DELETE CASCADE,
+    card_id int REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX ON pins ((COALESCE(owner_id, 0)), card_id);
+
+-- files attached to a card, such as recordings, PDFs or datasets, stored in the card-attachments bucket
+CREATE TABLE attachments (
+    id serial PRIMARY KEY,
+    card_id int REFERENCES cards (id) ON DELETE CASCADE NOT NULL,
+    -- the name of the file when it was attached, unique within the card
+    filename text NOT NULL,
+    object_name text NOT NULL UNIQUE,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (card_id, filename)
+);
+
+-- where the material of a card was taken from, so quotes can be traced back to it
+CREATE TABLE sources (
+    card_id int PRIMARY KEY REFERENCES cards (id) ON DELETE CASCADE,
+    book text NOT NULL DEFAULT '',
+    page text NOT NULL DEFAULT '',
+    url text NOT NULL DEFAULT '',
+    read_on date,
+    updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP
+);